@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/pkg/db"
+	"workflow-code-test/api/services/auth"
+	"workflow-code-test/api/services/storage"
+)
+
+// runCreateAPIKey implements the "create-api-key" subcommand, which
+// bootstraps the first admin key before anyone can call the API:
+//
+//	api create-api-key -name ops -role admin
+//
+// -workspace binds the key to one workspace. The key is printed to stdout
+// once; only its hash is stored.
+func runCreateAPIKey(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("create-api-key", flag.ContinueOnError)
+	name := fs.String("name", "", "name of the key, shown in logs and listings")
+	roleName := fs.String("role", string(auth.RoleAdmin), "role of the key: viewer, editor, publisher or admin")
+	workspace := fs.String("workspace", "", "workspace the key may act in; empty for every workspace")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	role, ok := auth.ParseRole(*roleName)
+	if *name == "" || !ok || (*workspace != "" && !storage.ValidWorkspaceID(*workspace)) {
+		fs.Usage()
+		return 2
+	}
+
+	dbURL, ok := os.LookupEnv("DATABASE_URL")
+	if !ok {
+		slog.Error("DATABASE_URL is not set")
+		return 1
+	}
+	pool, err := db.Connect(ctx, db.DefaultConfig(dbURL))
+	if err != nil {
+		slog.Error("Failed to connect to database", "error", err)
+		return 1
+	}
+	defer pool.Close()
+	store, err := storage.NewInstance(pool)
+	if err != nil {
+		slog.Error("Failed to create store instance", "error", err)
+		return 1
+	}
+
+	secret, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		slog.Error("Failed to generate API key", "error", err)
+		return 1
+	}
+	key := &storage.APIKey{
+		ID:          uuid.New(),
+		Name:        *name,
+		Prefix:      prefix,
+		KeyHash:     auth.HashAPIKey(secret),
+		Role:        string(role),
+		WorkspaceID: *workspace,
+		CreatedBy:   "create-api-key",
+	}
+	if err := store.CreateAPIKey(ctx, key); err != nil {
+		slog.Error("Failed to create API key", "error", err)
+		return 1
+	}
+	slog.Info("Created API key", "key", key.ID, "prefix", key.Prefix, "role", key.Role, "workspace", key.WorkspaceID)
+	fmt.Println(secret)
+	return 0
+}
+
+// bootstrapAdminKey stores key, read from AUTH_ADMIN_KEY, as an admin key.
+// The in-memory store starts without API keys and create-api-key needs a
+// database, so this is how a server without DATABASE_URL gets its first.
+func bootstrapAdminKey(ctx context.Context, store storage.Storage, key string) error {
+	prefix, ok := auth.ParseAPIKey(key)
+	if !ok {
+		return fmt.Errorf("AUTH_ADMIN_KEY is not of the form %s<12 hex>_<secret>", auth.APIKeyPrefix)
+	}
+	return store.CreateAPIKey(ctx, &storage.APIKey{
+		ID:        uuid.New(),
+		Name:      "bootstrap",
+		Prefix:    prefix,
+		KeyHash:   auth.HashAPIKey(key),
+		Role:      string(auth.RoleAdmin),
+		CreatedBy: "AUTH_ADMIN_KEY",
+	})
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"workflow-code-test/api/pkg/clients/email"
+	"workflow-code-test/api/pkg/clients/flood"
+	"workflow-code-test/api/pkg/clients/sms"
+	"workflow-code-test/api/pkg/clients/weather"
+	"workflow-code-test/api/services/bundle"
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/storage"
+	"workflow-code-test/api/services/workflow"
+)
+
+// runValidate implements "wfctl validate <file>".
+func (c *cli) runValidate(args []string) int {
+	fs := c.flagSet("validate", "<file>")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	wf, err := loadWorkflow(fs.Arg(0))
+	if err != nil {
+		c.errorf("validate", "%v", err)
+		return exitFailed
+	}
+	// Validation never calls the clients, so stubs are enough.
+	if err := workflow.Validate(wf, stubDeps(0, 0)); err != nil {
+		c.errorf("validate", "%s: %v", fs.Arg(0), err)
+		return exitFailed
+	}
+	fmt.Fprintf(c.stdout, "%s: workflow %q is valid (%d nodes, %d edges)\n", fs.Arg(0), wf.Name, len(wf.Nodes), len(wf.Edges))
+	return exitOK
+}
+
+// runLocal implements "wfctl run [flags] <file>".
+func (c *cli) runLocal(ctx context.Context, args []string) int {
+	fs := c.flagSet("run", "<file>")
+	var in inputFlags
+	in.register(fs)
+	output := fs.String("o", "table", "output format: table or json")
+	stub := fs.Bool("stub", false, "use stub weather and flood clients instead of calling Open-Meteo")
+	temperature := fs.Float64("temperature", 25, "temperature in °C reported by the stub weather client")
+	discharge := fs.Float64("discharge", 50, "river discharge in m³/s reported by the stub flood client")
+	dryRun := fs.Bool("dry-run", false, "render email and SMS payloads without sending them")
+	mocksFile := fs.String("mocks", "", "JSON or YAML file with recorded integration responses {\"mocks\": {...}}; requires -dry-run")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if *output != "table" && *output != "json" {
+		c.errorf("run", "-o must be table or json")
+		return exitUsage
+	}
+
+	if *mocksFile != "" && !*dryRun {
+		c.errorf("run", "-mocks requires -dry-run")
+		return exitUsage
+	}
+
+	inputs, err := in.values()
+	if err != nil {
+		c.errorf("run", "%v", err)
+		return exitUsage
+	}
+	wf, err := loadWorkflow(fs.Arg(0))
+	if err != nil {
+		c.errorf("run", "%v", err)
+		return exitFailed
+	}
+	opts := workflow.ExecuteOptions{DryRun: *dryRun, Workflows: bundleLoader(filepath.Dir(fs.Arg(0)))}
+	if *mocksFile != "" {
+		if opts.Mocks, err = loadMocks(*mocksFile); err != nil {
+			c.errorf("run", "%v", err)
+			return exitFailed
+		}
+		if err := workflow.ValidateMocks(wf, opts.Mocks); err != nil {
+			c.errorf("run", "%s: %v", *mocksFile, err)
+			return exitFailed
+		}
+	}
+
+	deps := realDeps()
+	if *stub {
+		deps = stubDeps(*temperature, *discharge)
+	}
+
+	result, err := workflow.Execute(ctx, wf, inputs, deps, opts)
+	if err != nil {
+		c.errorf("run", "%s: %v", fs.Arg(0), err)
+		return exitFailed
+	}
+	return c.printResult("run", result, *output)
+}
+
+// loadWorkflow reads an exported bundle (JSON or YAML) from path and turns it
+// into the storage representation the engine executes.
+func loadWorkflow(path string) (*storage.Workflow, error) {
+	b, err := readBundle(path)
+	if err != nil {
+		return nil, err
+	}
+	wf, err := b.ToWorkflow()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return wf, nil
+}
+
+func readBundle(path string) (*bundle.Bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := bundle.Decode(bytes.NewReader(data), bundle.DetectFormat(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return b, nil
+}
+
+// bundleLoader is the WorkflowLoader for subworkflow nodes of local runs
+// and test cases. The called workflow is the bundle in dir with its ID; a
+// pinned version must be a bundle exported from that snapshot. Files that
+// are not bundles, such as test cases, are skipped.
+func bundleLoader(dir string) workflow.WorkflowLoader {
+	return func(_ context.Context, id uuid.UUID, version int) (*storage.Workflow, error) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			switch filepath.Ext(e.Name()) {
+			case ".json", ".yaml", ".yml":
+			default:
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+			b, err := readBundle(path)
+			if err != nil || b.Workflow.ID != id {
+				continue
+			}
+			if version != 0 && (b.Source == nil || b.Source.SnapshotVersion != version) {
+				continue
+			}
+			wf, err := b.ToWorkflow()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			return wf, nil
+		}
+		return nil, pgx.ErrNoRows
+	}
+}
+
+// realDeps returns the same clients the API server is wired with.
+func realDeps() nodes.Deps {
+	return nodes.Deps{
+		Weather: weather.NewOpenMeteoClient(nil),
+		Email:   email.NewStubClient("weather-alerts@example.com"),
+		SMS:     sms.NewStubClient(),
+		Flood:   flood.NewOpenMeteoClient(nil),
+	}
+}
+
+// stubDeps returns clients that never leave the process.
+func stubDeps(temperature, discharge float64) nodes.Deps {
+	return nodes.Deps{
+		Weather: weather.NewStubClient(temperature),
+		Email:   email.NewStubClient("weather-alerts@example.com"),
+		SMS:     sms.NewStubClient(),
+		Flood:   flood.NewStubClient(discharge),
+	}
+}
+
+// inputFlags collects workflow inputs from repeated -input key=value flags
+// and an optional -inputs JSON file. Flags override keys from the file.
+type inputFlags struct {
+	pairs []string
+	file  string
+}
+
+func (f *inputFlags) register(fs *flag.FlagSet) {
+	fs.Func("input", "workflow input as key=value; values are parsed as JSON when possible (repeatable)", func(s string) error {
+		if !strings.Contains(s, "=") {
+			return fmt.Errorf("expected key=value, got %q", s)
+		}
+		f.pairs = append(f.pairs, s)
+		return nil
+	})
+	fs.StringVar(&f.file, "inputs", "", "JSON file with a workflow inputs object")
+}
+
+func (f *inputFlags) values() (map[string]any, error) {
+	inputs := make(map[string]any)
+	if f.file != "" {
+		data, err := os.ReadFile(f.file)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &inputs); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.file, err)
+		}
+	}
+	for _, p := range f.pairs {
+		key, raw, _ := strings.Cut(p, "=")
+		inputs[key] = parseInputValue(raw)
+	}
+	return inputs, nil
+}
+
+// parseInputValue decodes raw as JSON so numbers and booleans reach the
+// engine with the same types the web UI sends. Anything that is not valid
+// JSON (e.g. an unquoted city name) is kept as a string.
+func parseInputValue(raw string) any {
+	var v any
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		return raw
+	}
+	return v
+}
+
+// flagSet creates a flag set whose usage line names the command.
+func (c *cli) flagSet(cmd, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: wfctl %s [flags] %s\n", cmd, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
@@ -0,0 +1,104 @@
+// Command wfctl validates and runs workflow definitions from the command
+// line, either locally from an exported bundle file or against a running API.
+//
+// Usage:
+//
+//	wfctl validate <file>
+//	wfctl run [flags] <file>
+//	wfctl test [flags] <file|workflow-id>
+//	wfctl get [flags] <workflow-id>
+//	wfctl publish [flags] <workflow-id>
+//	wfctl execute [flags] <workflow-id>
+//
+// run and execute exit with status 1 when the workflow does not complete,
+// and test when any test case fails, so they can be used directly in CI.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"workflow-code-test/api/pkg/redact"
+)
+
+const (
+	exitOK      = 0
+	exitFailed  = 1 // the command ran but the workflow is invalid or did not complete
+	exitUsage   = 2
+	usageHeader = `Usage: wfctl <command> [flags] <args>
+
+Commands:
+  validate <file>        construct and validate every node and the graph
+  run <file>             execute a workflow bundle locally
+  test <file|id>         run workflow test cases locally or on the API
+  get <workflow-id>      download a workflow bundle from the API
+  publish <workflow-id>  publish the current draft as a new snapshot
+  execute <workflow-id>  execute a workflow on the API
+
+Run "wfctl <command> -h" for the flags of a command. Remote commands send
+$WFCTL_TOKEN, an API key or JWT, as a bearer token when it is set.
+`
+)
+
+// cli holds the process-level dependencies of every command so tests can
+// capture output and point remote commands at a test server.
+type cli struct {
+	stdout     io.Writer
+	stderr     io.Writer
+	httpClient *http.Client
+	getenv     func(string) string
+}
+
+func main() {
+	// Node clients log through slog; keep those lines off stdout so table
+	// and JSON output stay machine-readable.
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn, ReplaceAttr: redact.ReplaceAttr})))
+
+	c := &cli{
+		stdout:     os.Stdout,
+		stderr:     os.Stderr,
+		httpClient: &http.Client{Timeout: 90 * time.Second},
+		getenv:     os.Getenv,
+	}
+	os.Exit(c.run(context.Background(), os.Args[1:]))
+}
+
+// run dispatches to a subcommand and returns the process exit code.
+func (c *cli) run(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(c.stderr, usageHeader)
+		return exitUsage
+	}
+
+	cmd, rest := args[0], args[1:]
+	switch cmd {
+	case "validate":
+		return c.runValidate(rest)
+	case "run":
+		return c.runLocal(ctx, rest)
+	case "test":
+		return c.runTest(ctx, rest)
+	case "get":
+		return c.runGet(ctx, rest)
+	case "publish":
+		return c.runPublish(ctx, rest)
+	case "execute":
+		return c.runExecute(ctx, rest)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(c.stdout, usageHeader)
+		return exitOK
+	default:
+		fmt.Fprintf(c.stderr, "wfctl: unknown command %q\n\n%s", cmd, usageHeader)
+		return exitUsage
+	}
+}
+
+// errorf prints an error prefixed with the command name.
+func (c *cli) errorf(cmd, format string, args ...any) {
+	fmt.Fprintf(c.stderr, "wfctl %s: %s\n", cmd, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"workflow-code-test/api/services/workflow"
+)
+
+// printResult writes an execution result as a step table or as the same
+// JSON the execute endpoint returns, and maps its status to an exit code.
+func (c *cli) printResult(cmd string, result *workflow.ExecutionResponse, output string) int {
+	if output == "json" {
+		enc := json.NewEncoder(c.stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			c.errorf(cmd, "encode result: %v", err)
+			return exitFailed
+		}
+	} else {
+		c.printSteps(result)
+	}
+
+	if result.Status != "completed" {
+		return exitFailed
+	}
+	return exitOK
+}
+
+func (c *cli) printSteps(result *workflow.ExecutionResponse) {
+	tw := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tNODE\tTYPE\tSTATUS\tDURATION\tOUTPUT")
+	for i, step := range result.Steps {
+		detail := formatOutput(step.Output)
+		if step.Error != "" {
+			detail = "error: " + step.Error
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%dms\t%s\n", i+1, step.NodeID, step.Type, step.Status, step.DurationMs, detail)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(c.stdout, "\nstatus: %s\n", result.Status)
+	if result.Mode != "" {
+		fmt.Fprintf(c.stdout, "mode: %s\n", result.Mode)
+	}
+	if result.Error != "" {
+		fmt.Fprintf(c.stdout, "error: %s\n", result.Error)
+	}
+}
+
+// formatOutput renders step output as sorted key=value pairs.
+func formatOutput(output map[string]any) string {
+	keys := make([]string, 0, len(output))
+	for k := range output {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		v, err := json.Marshal(output[k])
+		if err != nil {
+			v = []byte(fmt.Sprint(output[k]))
+		}
+		parts = append(parts, k+"="+string(v))
+	}
+	return strings.Join(parts, " ")
+}
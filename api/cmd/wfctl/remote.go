@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/services/workflow"
+)
+
+// defaultAPIURL matches the address the API listens on in local development.
+const defaultAPIURL = "http://localhost:8080/api/v1"
+
+// apiError is the structured error body returned by the API.
+type apiError struct {
+	Status  int
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("API returned %d", e.Status)
+	}
+	return fmt.Sprintf("API returned %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+// runGet implements "wfctl get [flags] <workflow-id>". It downloads the
+// workflow as a bundle, which "wfctl run" and "wfctl validate" accept.
+func (c *cli) runGet(ctx context.Context, args []string) int {
+	fs := c.flagSet("get", "<workflow-id>")
+	apiURL := c.apiFlag(fs)
+	format := fs.String("format", "json", "bundle format: json or yaml")
+	version := fs.Int("version", 0, "download a published snapshot version instead of the draft")
+	id, ok := parseIDArgs(fs, args)
+	if !ok {
+		return exitUsage
+	}
+
+	q := url.Values{"format": {*format}}
+	if *version > 0 {
+		q.Set("version", strconv.Itoa(*version))
+	}
+	body, err := c.call(ctx, http.MethodGet, *apiURL, "/workflows/"+id.String()+"/export?"+q.Encode(), nil)
+	if err != nil {
+		c.errorf("get", "%v", err)
+		return exitFailed
+	}
+	if _, err := c.stdout.Write(body); err != nil {
+		c.errorf("get", "%v", err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+// runPublish implements "wfctl publish [flags] <workflow-id>".
+func (c *cli) runPublish(ctx context.Context, args []string) int {
+	fs := c.flagSet("publish", "<workflow-id>")
+	apiURL := c.apiFlag(fs)
+	id, ok := parseIDArgs(fs, args)
+	if !ok {
+		return exitUsage
+	}
+
+	body, err := c.call(ctx, http.MethodPost, *apiURL, "/workflows/"+id.String()+"/publish", nil)
+	if err != nil {
+		c.errorf("publish", "%v", err)
+		return exitFailed
+	}
+	var snap struct {
+		SnapshotID    string `json:"snapshotId"`
+		VersionNumber int    `json:"versionNumber"`
+	}
+	if err := json.Unmarshal(body, &snap); err != nil {
+		c.errorf("publish", "decode response: %v", err)
+		return exitFailed
+	}
+	fmt.Fprintf(c.stdout, "published workflow %s as version %d (snapshot %s)\n", id, snap.VersionNumber, snap.SnapshotID)
+	return exitOK
+}
+
+// runExecute implements "wfctl execute [flags] <workflow-id>".
+func (c *cli) runExecute(ctx context.Context, args []string) int {
+	fs := c.flagSet("execute", "<workflow-id>")
+	apiURL := c.apiFlag(fs)
+	var in inputFlags
+	in.register(fs)
+	output := fs.String("o", "table", "output format: table or json")
+	dryRun := fs.Bool("dry-run", false, "render email and SMS payloads without sending them")
+	mocksFile := fs.String("mocks", "", "JSON or YAML file with recorded integration responses {\"mocks\": {...}}; requires -dry-run")
+	id, ok := parseIDArgs(fs, args)
+	if !ok {
+		return exitUsage
+	}
+	if *output != "table" && *output != "json" {
+		c.errorf("execute", "-o must be table or json")
+		return exitUsage
+	}
+	if *mocksFile != "" && !*dryRun {
+		c.errorf("execute", "-mocks requires -dry-run")
+		return exitUsage
+	}
+	inputs, err := in.values()
+	if err != nil {
+		c.errorf("execute", "%v", err)
+		return exitUsage
+	}
+
+	// The engine flattens formData and condition into one variables map, so
+	// sending everything as formData is equivalent to the web UI's request.
+	payload := map[string]any{"formData": inputs}
+	if *mocksFile != "" {
+		mocks, err := loadMocks(*mocksFile)
+		if err != nil {
+			c.errorf("execute", "%v", err)
+			return exitFailed
+		}
+		payload["mocks"] = mocks
+	}
+	reqBody, err := json.Marshal(payload)
+	if err != nil {
+		c.errorf("execute", "%v", err)
+		return exitFailed
+	}
+	path := "/workflows/" + id.String() + "/execute"
+	if *dryRun {
+		path += "?mode=" + workflow.ModeDryRun
+	}
+	body, err := c.call(ctx, http.MethodPost, *apiURL, path, reqBody)
+	if err != nil {
+		c.errorf("execute", "%v", err)
+		return exitFailed
+	}
+	var result workflow.ExecutionResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		c.errorf("execute", "decode response: %v", err)
+		return exitFailed
+	}
+	return c.printResult("execute", &result, *output)
+}
+
+// apiFlag registers -api, defaulting to $WFCTL_API_URL.
+func (c *cli) apiFlag(fs *flag.FlagSet) *string {
+	def := c.getenv("WFCTL_API_URL")
+	if def == "" {
+		def = defaultAPIURL
+	}
+	return fs.String("api", def, "base URL of the workflow API (env WFCTL_API_URL)")
+}
+
+// parseIDArgs parses flags and the single workflow ID argument.
+func parseIDArgs(fs *flag.FlagSet, args []string) (uuid.UUID, bool) {
+	if err := fs.Parse(args); err != nil {
+		return uuid.Nil, false
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return uuid.Nil, false
+	}
+	id, err := uuid.Parse(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(fs.Output(), "invalid workflow id %q\n", fs.Arg(0))
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// call sends a request to the API and returns the body of a 2xx response.
+// Any other status is returned as an *apiError.
+func (c *cli) call(ctx context.Context, method, baseURL, path string, body []byte) ([]byte, error) {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(baseURL, "/")+path, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token := c.getenv("WFCTL_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", method, req.URL, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &apiError{Status: resp.StatusCode}
+		_ = json.Unmarshal(data, apiErr) // non-JSON bodies still report the status
+		return nil, apiErr
+	}
+	return data, nil
+}
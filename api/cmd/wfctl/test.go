@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+
+	"workflow-code-test/api/services/bundle"
+	"workflow-code-test/api/services/workflow"
+)
+
+// runTest implements "wfctl test". Given a bundle file it runs the cases
+// from -cases locally; given a workflow ID it runs them on the API, using
+// the stored cases unless -cases is set.
+func (c *cli) runTest(ctx context.Context, args []string) int {
+	fs := c.flagSet("test", "<file|workflow-id>")
+	apiURL := c.apiFlag(fs)
+	casesFile := fs.String("cases", "", "JSON or YAML file with {\"cases\": [...]}; required for bundle files")
+	save := fs.Bool("save", false, "store the -cases on the API before running them")
+	version := fs.Int("version", 0, "run against a published snapshot version instead of the draft (API only)")
+	output := fs.String("o", "table", "output format: table or json")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if *output != "table" && *output != "json" {
+		c.errorf("test", "-o must be table or json")
+		return exitUsage
+	}
+
+	var cases []workflow.TestCase
+	if *casesFile != "" {
+		var err error
+		if cases, err = loadTestCases(*casesFile); err != nil {
+			c.errorf("test", "%v", err)
+			return exitFailed
+		}
+	}
+
+	var report *workflow.TestReport
+	if id, err := uuid.Parse(fs.Arg(0)); err == nil {
+		if *save && *casesFile == "" {
+			c.errorf("test", "-save requires -cases")
+			return exitUsage
+		}
+		if report, err = c.remoteTest(ctx, *apiURL, id, cases, *casesFile != "", *save, *version); err != nil {
+			c.errorf("test", "%v", err)
+			return exitFailed
+		}
+	} else {
+		if *casesFile == "" || *save || *version != 0 {
+			c.errorf("test", "running a bundle file needs -cases and does not take -save or -version")
+			return exitUsage
+		}
+		wf, err := loadWorkflow(fs.Arg(0))
+		if err != nil {
+			c.errorf("test", "%v", err)
+			return exitFailed
+		}
+		if err := workflow.ValidateTestCases(cases); err != nil {
+			c.errorf("test", "%s: %v", *casesFile, err)
+			return exitFailed
+		}
+		report = workflow.RunTestCases(ctx, wf, cases, bundleLoader(filepath.Dir(fs.Arg(0))))
+	}
+
+	return c.printReport(report, *output)
+}
+
+// remoteTest optionally saves cases on the API and then runs either the
+// inline cases or the stored ones.
+func (c *cli) remoteTest(ctx context.Context, apiURL string, id uuid.UUID, cases []workflow.TestCase, inline, save bool, version int) (*workflow.TestReport, error) {
+	var body []byte
+	if inline {
+		var err error
+		if body, err = json.Marshal(map[string]any{"cases": cases}); err != nil {
+			return nil, err
+		}
+	}
+	if save {
+		if _, err := c.call(ctx, http.MethodPut, apiURL, "/workflows/"+id.String()+"/tests", body); err != nil {
+			return nil, fmt.Errorf("save test cases: %w", err)
+		}
+		body = nil // run what was just stored
+	}
+
+	path := "/workflows/" + id.String() + "/test"
+	if version > 0 {
+		path += "?version=" + strconv.Itoa(version)
+	}
+	data, err := c.call(ctx, http.MethodPost, apiURL, path, body)
+	if err != nil {
+		return nil, err
+	}
+	var report workflow.TestReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &report, nil
+}
+
+// loadTestCases reads {"cases": [...]} from a JSON or YAML file.
+func loadTestCases(path string) ([]workflow.TestCase, error) {
+	var file struct {
+		Cases []workflow.TestCase `json:"cases"`
+	}
+	if err := decodeFile(path, &file); err != nil {
+		return nil, err
+	}
+	return file.Cases, nil
+}
+
+// loadMocks reads {"mocks": {"<node-id>": {...}}} from a JSON or YAML file.
+func loadMocks(path string) (map[string]workflow.MockResponse, error) {
+	var file struct {
+		Mocks map[string]workflow.MockResponse `json:"mocks"`
+	}
+	if err := decodeFile(path, &file); err != nil {
+		return nil, err
+	}
+	return file.Mocks, nil
+}
+
+// decodeFile decodes a JSON or YAML file into v. YAML is converted to JSON
+// first so both formats share the JSON field names and reject unknown
+// fields the same way the API does.
+func decodeFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if bundle.DetectFormat(data) == bundle.FormatYAML {
+		var doc any
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// printReport writes a test report and maps it to an exit code. A run with
+// no cases fails, since it almost always means the cases were not found.
+func (c *cli) printReport(report *workflow.TestReport, output string) int {
+	if output == "json" {
+		enc := json.NewEncoder(c.stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			c.errorf("test", "encode report: %v", err)
+			return exitFailed
+		}
+	} else {
+		tw := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "CASE\tRESULT\tSTATUS\tDURATION\tPATH")
+		for _, res := range report.Cases {
+			result := "PASS"
+			if !res.Passed {
+				result = "FAIL"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%dms\t%s\n", res.Name, result, res.Status, res.DurationMs, strings.Join(res.Path, " → "))
+		}
+		tw.Flush()
+
+		for _, res := range report.Cases {
+			for _, f := range res.Failures {
+				fmt.Fprintf(c.stdout, "\n%s: %s", res.Name, f)
+			}
+		}
+		fmt.Fprintf(c.stdout, "\n%d passed, %d failed\n", report.Passed, report.Failed)
+	}
+
+	if len(report.Cases) == 0 {
+		c.errorf("test", "no test cases to run")
+		return exitFailed
+	}
+	if report.Failed > 0 {
+		return exitFailed
+	}
+	return exitOK
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"workflow-code-test/api/services/storage"
+	"workflow-code-test/api/services/workflow"
+)
+
+var weatherInputs = []string{
+	"-input", "name=Alice",
+	"-input", "email=alice@example.com",
+	"-input", "city=Sydney",
+	"-input", "operator=greater_than",
+	"-input", "threshold=25",
+}
+
+// newTestAPI serves the workflow API over a seeded in-memory store, with
+// stub clients reporting 31.5°C.
+func newTestAPI(t *testing.T) *httptest.Server {
+	t.Helper()
+	store, err := storage.NewMemoryInstance(storage.SeedFixtures())
+	if err != nil {
+		t.Fatalf("NewMemoryInstance: %v", err)
+	}
+	svc, err := workflow.NewService(store, stubDeps(31.5, 50))
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	r := mux.NewRouter()
+	svc.LoadRoutes(r.PathPrefix("/api/v1").Subrouter())
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// runCLI runs wfctl with args and returns its exit code, stdout and stderr.
+func runCLI(t *testing.T, srv *httptest.Server, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	c := &cli{
+		stdout:     &stdout,
+		stderr:     &stderr,
+		httpClient: http.DefaultClient,
+		getenv: func(key string) string {
+			if key == "WFCTL_API_URL" && srv != nil {
+				return srv.URL + "/api/v1"
+			}
+			return ""
+		},
+	}
+	code := c.run(context.Background(), args)
+	return code, stdout.String(), stderr.String()
+}
+
+// downloadBundle fetches the seeded weather workflow into a temp file.
+func downloadBundle(t *testing.T, srv *httptest.Server, format string) string {
+	t.Helper()
+	code, out, errOut := runCLI(t, srv, "get", "-format", format, storage.SeedWeatherWorkflowID.String())
+	if code != exitOK {
+		t.Fatalf("get: exit %d: %s", code, errOut)
+	}
+	path := filepath.Join(t.TempDir(), "weather."+format)
+	if err := os.WriteFile(path, []byte(out), 0o600); err != nil {
+		t.Fatalf("write bundle: %v", err)
+	}
+	return path
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	srv := newTestAPI(t)
+
+	for _, format := range []string{"json", "yaml"} {
+		path := downloadBundle(t, srv, format)
+		code, out, errOut := runCLI(t, nil, "validate", path)
+		if code != exitOK {
+			t.Fatalf("validate %s: exit %d: %s", format, code, errOut)
+		}
+		if !strings.Contains(out, `"Weather Check System" is valid`) {
+			t.Errorf("unexpected output: %s", out)
+		}
+	}
+
+	// A well-formed bundle can still describe an unexecutable graph.
+	data, err := os.ReadFile(downloadBundle(t, srv, "json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	broken := filepath.Join(t.TempDir(), "broken.json")
+	data = bytes.Replace(data, []byte(`"target": "end"`), []byte(`"target": "start"`), 1)
+	if err := os.WriteFile(broken, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	code, _, errOut := runCLI(t, nil, "validate", broken)
+	if code != exitFailed || !strings.Contains(errOut, "must not have incoming edges") {
+		t.Errorf("expected validation failure, got exit %d: %s", code, errOut)
+	}
+}
+
+func TestRunLocal(t *testing.T) {
+	t.Parallel()
+	path := downloadBundle(t, newTestAPI(t), "yaml")
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantStatus string
+		wantSteps  []string
+	}{
+		{
+			name:       "hot day sends the alert",
+			args:       append([]string{"run", "-stub", "-temperature", "31.5", "-o", "json"}, weatherInputs...),
+			wantCode:   exitOK,
+			wantStatus: "completed",
+			wantSteps:  []string{"start", "form", "weather-api", "condition", "email", "end"},
+		},
+		{
+			name:       "cool day skips the alert",
+			args:       append([]string{"run", "-stub", "-temperature", "12", "-o", "json"}, weatherInputs...),
+			wantCode:   exitOK,
+			wantStatus: "completed",
+			wantSteps:  []string{"start", "form", "weather-api", "condition", "end"},
+		},
+		{
+			name:       "missing inputs fail at the form",
+			args:       []string{"run", "-stub", "-o", "json"},
+			wantCode:   exitFailed,
+			wantStatus: "failed",
+			wantSteps:  []string{"start", "form"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			code, out, errOut := runCLI(t, nil, append(tt.args, path)...)
+			if code != tt.wantCode {
+				t.Fatalf("expected exit %d, got %d: %s", tt.wantCode, code, errOut)
+			}
+			var result workflow.ExecutionResponse
+			if err := json.Unmarshal([]byte(out), &result); err != nil {
+				t.Fatalf("decode output: %v\n%s", err, out)
+			}
+			if result.Status != tt.wantStatus {
+				t.Errorf("expected status %q, got %q (%s)", tt.wantStatus, result.Status, result.Error)
+			}
+			var got []string
+			for _, s := range result.Steps {
+				got = append(got, s.NodeID)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantSteps, ",") {
+				t.Errorf("expected path %v, got %v", tt.wantSteps, got)
+			}
+		})
+	}
+}
+
+func TestRunLocal_Table(t *testing.T) {
+	t.Parallel()
+	path := downloadBundle(t, newTestAPI(t), "json")
+
+	args := append([]string{"run", "-stub", "-temperature", "31.5"}, weatherInputs...)
+	code, out, errOut := runCLI(t, nil, append(args, path)...)
+	if code != exitOK {
+		t.Fatalf("exit %d: %s", code, errOut)
+	}
+	for _, want := range []string{"NODE", "weather-api", "temperature=31.5", "status: completed"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected table to contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestRemoteCommands(t *testing.T) {
+	t.Parallel()
+	srv := newTestAPI(t)
+	id := storage.SeedWeatherWorkflowID.String()
+
+	code, out, errOut := runCLI(t, srv, "publish", id)
+	if code != exitOK || !strings.Contains(out, "as version 1") {
+		t.Fatalf("publish: exit %d: %s%s", code, out, errOut)
+	}
+
+	code, out, errOut = runCLI(t, srv, append([]string{"execute", "-o", "json"}, append(weatherInputs, id)...)...)
+	if code != exitOK {
+		t.Fatalf("execute: exit %d: %s%s", code, out, errOut)
+	}
+	var result workflow.ExecutionResponse
+	if err := json.Unmarshal([]byte(out), &result); err != nil {
+		t.Fatalf("decode output: %v", err)
+	}
+	if result.Status != "completed" || len(result.Steps) != 6 {
+		t.Errorf("expected completed run with 6 steps, got %s with %d", result.Status, len(result.Steps))
+	}
+
+	code, _, errOut = runCLI(t, srv, "get", "8d3c0a4e-0000-4000-8000-000000000000")
+	if code != exitFailed || !strings.Contains(errOut, "404 NOT_FOUND") {
+		t.Errorf("expected 404 error, got exit %d: %s", code, errOut)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{name: "no command", args: nil},
+		{name: "unknown command", args: []string{"deploy"}},
+		{name: "missing file", args: []string{"run"}},
+		{name: "invalid workflow id", args: []string{"publish", "nope"}},
+		{name: "invalid input flag", args: []string{"execute", "-input", "novalue", "8d3c0a4e-0000-4000-8000-000000000000"}},
+		{name: "invalid output format", args: []string{"run", "-o", "xml", "file.json"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if code, _, _ := runCLI(t, nil, tt.args...); code != exitUsage {
+				t.Errorf("expected exit %d, got %d", exitUsage, code)
+			}
+		})
+	}
+}
+
+const weatherCasesYAML = `
+cases:
+  - name: hot day
+    inputs: {name: Alice, email: alice@example.com, city: Sydney, operator: greater_than, threshold: 25}
+    mocks:
+      weather-api: {temperature: 31.5}
+    expect:
+      path: [start, form, weather-api, condition, email, end]
+      variables: {temperature: 31.5}
+      messages:
+        - {channel: email, to: alice@example.com, bodyContains: "31.5°C"}
+  - name: cool day
+    inputs: {name: Alice, email: alice@example.com, city: Sydney, operator: greater_than, threshold: 25}
+    mocks:
+      weather-api: {temperature: 12}
+    expect:
+      messages: []
+`
+
+func TestTestCommand(t *testing.T) {
+	t.Parallel()
+	srv := newTestAPI(t)
+	id := storage.SeedWeatherWorkflowID.String()
+	bundlePath := downloadBundle(t, srv, "json")
+
+	dir := t.TempDir()
+	passing := filepath.Join(dir, "cases.yaml")
+	failing := filepath.Join(dir, "failing.json")
+	if err := os.WriteFile(passing, []byte(weatherCasesYAML), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	failingCases := `{"cases":[{"name":"expects an alert","inputs":{"city":"Sydney","name":"A","email":"a@example.com"},` +
+		`"mocks":{"weather-api":{"temperature":12}},"expect":{"variables":{"conditionMet":true}}}]}`
+	if err := os.WriteFile(failing, []byte(failingCases), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	code, out, errOut := runCLI(t, nil, "test", "-cases", passing, bundlePath)
+	if code != exitOK || !strings.Contains(out, "2 passed, 0 failed") {
+		t.Fatalf("local test: exit %d: %s%s", code, out, errOut)
+	}
+
+	code, out, _ = runCLI(t, nil, "test", "-cases", failing, bundlePath)
+	if code != exitFailed || !strings.Contains(out, `expects an alert: expected variable "conditionMet" to be true, got false`) {
+		t.Errorf("expected failing case to be reported, got exit %d: %s", code, out)
+	}
+
+	code, out, errOut = runCLI(t, srv, "test", "-cases", passing, "-save", "-o", "json", id)
+	if code != exitOK {
+		t.Fatalf("remote test with -save: exit %d: %s%s", code, out, errOut)
+	}
+
+	// The saved cases are used when none are passed, including on snapshots.
+	if code, _, errOut = runCLI(t, srv, "publish", id); code != exitOK {
+		t.Fatalf("publish: %s", errOut)
+	}
+	code, out, errOut = runCLI(t, srv, "test", "-version", "1", "-o", "json", id)
+	if code != exitOK {
+		t.Fatalf("remote test of stored cases: exit %d: %s%s", code, out, errOut)
+	}
+	var report workflow.TestReport
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if report.Version != 1 || report.Passed != 2 {
+		t.Errorf("expected 2 passing cases on version 1, got %+v", report)
+	}
+
+	if code, _, _ = runCLI(t, nil, "test", bundlePath); code != exitUsage {
+		t.Errorf("expected a bundle without -cases to be a usage error, got %d", code)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	t.Parallel()
+	srv := newTestAPI(t)
+	path := downloadBundle(t, srv, "json")
+	mocks := filepath.Join(t.TempDir(), "mocks.yaml")
+	if err := os.WriteFile(mocks, []byte("mocks:\n  weather-api:\n    temperature: 31.5\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		// The recorded response stands in for Open-Meteo, so no -stub is needed.
+		{name: "run", args: append([]string{"run", "-dry-run", "-mocks", mocks, "-o", "json"}, append(weatherInputs, path)...)},
+		{name: "execute", args: append([]string{"execute", "-dry-run", "-o", "json"}, append(weatherInputs, storage.SeedWeatherWorkflowID.String())...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			code, out, errOut := runCLI(t, srv, tt.args...)
+			if code != exitOK {
+				t.Fatalf("expected exit 0, got %d: %s", code, errOut)
+			}
+			var result workflow.ExecutionResponse
+			if err := json.Unmarshal([]byte(out), &result); err != nil {
+				t.Fatalf("decode output: %v\n%s", err, out)
+			}
+			if result.Mode != workflow.ModeDryRun {
+				t.Errorf("expected mode %q, got %q", workflow.ModeDryRun, result.Mode)
+			}
+			email := result.Steps[len(result.Steps)-2]
+			if email.NodeID != "email" || email.Status != "skipped" || email.Output["emailSent"] != false {
+				t.Errorf("expected the email step to be skipped, got %+v", email)
+			}
+		})
+	}
+
+	if code, _, errOut := runCLI(t, nil, "run", "-mocks", mocks, path); code != exitUsage || !strings.Contains(errOut, "-mocks requires -dry-run") {
+		t.Errorf("expected usage error, got exit %d: %s", code, errOut)
+	}
+}
+
+// briefingBundle calls the seeded weather workflow through a subworkflow
+// node, as start -> weather-check -> end.
+const briefingBundle = `{
+  "apiVersion": "workflow.bundle/v1",
+  "kind": "WorkflowBundle",
+  "workflow": {
+    "id": "7d3c1e52-2f4b-4b8e-9c61-0a5e8f3b2d14",
+    "name": "Morning Briefing",
+    "nodes": [
+      {"id": "start", "type": "start", "blueprint": "0b8f6f0e-4e0c-4b8a-8f55-1c2d3e4f5a61", "position": {"x": 0, "y": 0}},
+      {"id": "weather-check", "type": "subworkflow", "blueprint": "0b8f6f0e-4e0c-4b8a-8f55-1c2d3e4f5a62", "position": {"x": 0, "y": 100}},
+      {"id": "end", "type": "end", "blueprint": "0b8f6f0e-4e0c-4b8a-8f55-1c2d3e4f5a63", "position": {"x": 0, "y": 200}}
+    ],
+    "edges": [
+      {"id": "e1", "source": "start", "target": "weather-check", "type": "smoothstep", "animated": false},
+      {"id": "e2", "source": "weather-check", "target": "end", "type": "smoothstep", "animated": false}
+    ]
+  },
+  "blueprints": [
+    {"id": "0b8f6f0e-4e0c-4b8a-8f55-1c2d3e4f5a61", "nodeType": "start", "label": "Start", "description": "", "metadata": {"hasHandles": {"source": true, "target": false}}},
+    {"id": "0b8f6f0e-4e0c-4b8a-8f55-1c2d3e4f5a62", "nodeType": "subworkflow", "label": "Weather Check", "description": "",
+     "metadata": {"hasHandles": {"source": true, "target": true}, "workflowId": "550e8400-e29b-41d4-a716-446655440000",
+                  "inputMapping": {"name": "name", "email": "email", "city": "city", "operator": "operator", "threshold": "threshold"},
+                  "outputMapping": {"conditionMet": "conditionMet"}}},
+    {"id": "0b8f6f0e-4e0c-4b8a-8f55-1c2d3e4f5a63", "nodeType": "end", "label": "End", "description": "", "metadata": {"hasHandles": {"source": false, "target": true}}}
+  ]
+}`
+
+func TestTestCommand_Subworkflow(t *testing.T) {
+	t.Parallel()
+	srv := newTestAPI(t)
+	// The called workflow is found among the bundles next to the caller.
+	dir := filepath.Dir(downloadBundle(t, srv, "yaml"))
+	caller := filepath.Join(dir, "briefing.json")
+	cases := filepath.Join(dir, "cases.json")
+	if err := os.WriteFile(caller, []byte(briefingBundle), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	briefingCases := `{"cases":[{"name":"hot day","inputs":{"name":"Alice","email":"alice@example.com","city":"Sydney","operator":"greater_than","threshold":25},` +
+		`"mocks":{"weather-check/weather-api":{"temperature":31.5}},"expect":{"variables":{"conditionMet":true},"messages":[{"node":"weather-check/email"}]}}]}`
+	if err := os.WriteFile(cases, []byte(briefingCases), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if code, out, errOut := runCLI(t, nil, "test", "-cases", cases, caller); code != exitOK || !strings.Contains(out, "1 passed, 0 failed") {
+		t.Errorf("expected the case to pass, got exit %d: %s%s", code, out, errOut)
+	}
+}
@@ -17,7 +17,12 @@ import (
 	"workflow-code-test/api/pkg/clients/sms"
 	"workflow-code-test/api/pkg/clients/weather"
 	"workflow-code-test/api/pkg/db"
+	"workflow-code-test/api/pkg/metrics"
+	"workflow-code-test/api/pkg/redact"
+	"workflow-code-test/api/pkg/tracing"
+	"workflow-code-test/api/services/auth"
 	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/secrets"
 	"workflow-code-test/api/services/storage"
 	"workflow-code-test/api/services/workflow"
 )
@@ -25,59 +30,227 @@ import (
 func main() {
 	ctx := context.Background()
 	logHandler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelDebug,
+		Level:       slog.LevelDebug,
+		ReplaceAttr: redact.ReplaceAttr,
 	})
 	slog.SetDefault(slog.New(logHandler))
 
-	dbURL, ok := os.LookupEnv("DATABASE_URL")
-	if !ok {
-		slog.Error("DATABASE_URL is not set")
-		return
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(ctx, os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "create-api-key" {
+		os.Exit(runCreateAPIKey(ctx, os.Args[2:]))
 	}
 
-	dbCfg := db.DefaultConfig(dbURL)
-	pool, err := db.Connect(ctx, dbCfg)
+	// Spans are exported only when an OTLP endpoint is configured.
+	shutdownTracing, err := tracing.Setup(ctx, os.Getenv)
 	if err != nil {
-		slog.Error("Failed to connect to database", "error", err)
+		slog.Error("Failed to set up tracing", "error", err)
 		return
 	}
-	defer pool.Close()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			slog.Error("Failed to flush traces", "error", err)
+		}
+	}()
+
+	m := metrics.New()
+
+	// Without DATABASE_URL, fall back to an in-memory store seeded with the
+	// same fixtures as the Flyway migrations. Data is lost on restart.
+	var store storage.Storage
+	dbURL, ok := os.LookupEnv("DATABASE_URL")
+	inMemory := !ok
+	if ok {
+		dbCfg := db.DefaultConfig(dbURL)
+		pool, err := db.Connect(ctx, dbCfg)
+		if err != nil {
+			slog.Error("Failed to connect to database", "error", err)
+			return
+		}
+		defer pool.Close()
+
+		// Apply pending migrations unless disabled (e.g. when migrations are
+		// run as a separate `migrate` step in a deployment pipeline).
+		if os.Getenv("AUTO_MIGRATE") != "false" {
+			migrator, err := db.NewMigrator(pool)
+			if err != nil {
+				slog.Error("Failed to load migrations", "error", err)
+				return
+			}
+			if err := applyMigrations(ctx, migrator); err != nil {
+				slog.Error("Failed to apply migrations", "error", err)
+				return
+			}
+		}
+
+		if err := m.Register(db.NewPoolCollector(pool)); err != nil {
+			slog.Error("Failed to register pool metrics", "error", err)
+			return
+		}
+
+		store, err = storage.NewInstance(pool)
+		if err != nil {
+			slog.Error("Failed to create store instance", "error", err)
+			return
+		}
+	} else {
+		slog.Warn("DATABASE_URL is not set, using in-memory storage")
+		var err error
+		store, err = storage.NewMemoryInstance(storage.SeedFixtures())
+		if err != nil {
+			slog.Error("Failed to create memory store instance", "error", err)
+			return
+		}
+	}
 
 	// setup router
 	mainRouter := mux.NewRouter()
+	mainRouter.Handle("/metrics", m.Handler()).Methods("GET")
 
 	apiRouter := mainRouter.PathPrefix("/api/v1").Subrouter()
+	apiRouter.Use(tracing.Middleware)
+	apiRouter.Use(m.Middleware)
 
-	pgStore, err := storage.NewInstance(pool)
-	if err != nil {
-		slog.Error("Failed to create store instance", "error", err)
-		return
-	}
-
-	weatherClient := weather.NewOpenMeteoClient(nil)
+	// Outbound calls carry the W3C trace context of the node that made them.
+	tracedHTTP := &http.Client{Transport: tracing.Transport(nil)}
+	weatherClient := weather.NewOpenMeteoClient(tracedHTTP)
 	emailClient := email.NewStubClient("weather-alerts@example.com")
 	smsClient := sms.NewStubClient()
-	floodClient := flood.NewOpenMeteoClient(nil)
+	floodClient := flood.NewOpenMeteoClient(tracedHTTP)
 	deps := nodes.Deps{
-		Weather: weatherClient,
-		Email:   emailClient,
-		SMS:     smsClient,
-		Flood:   floodClient,
+		Weather: m.Weather(weatherClient),
+		Email:   m.Email(emailClient),
+		SMS:     m.SMS(smsClient),
+		Flood:   m.Flood(floodClient),
 	}
 
-	workflowService, err := workflow.NewService(pgStore, deps)
+	workflowService, err := workflow.NewService(store, deps)
 	if err != nil {
 		slog.Error("Failed to create workflow service", "error", err)
 		return
 	}
 
+	// How long Idempotency-Key responses are replayed, e.g. "48h".
+	if v, ok := os.LookupEnv("IDEMPOTENCY_RETENTION"); ok {
+		retention, err := time.ParseDuration(v)
+		if err != nil || retention <= 0 {
+			slog.Error("Invalid IDEMPOTENCY_RETENTION", "value", v, "error", err)
+			return
+		}
+		workflowService.SetIdempotencyRetention(retention)
+	}
+
+	// Runs pruned by a workflow's retention policy are archived under this
+	// directory first, as compressed NDJSON, when it is set.
+	if dir := os.Getenv("RUN_ARCHIVE_DIR"); dir != "" {
+		archiver, err := workflow.NewFileArchiver(dir)
+		if err != nil {
+			slog.Error("Invalid RUN_ARCHIVE_DIR", "value", dir, "error", err)
+			return
+		}
+		workflowService.SetRunArchiver(archiver)
+	}
+	retentionInterval := workflow.DefaultRetentionInterval
+	if v, ok := os.LookupEnv("RETENTION_INTERVAL"); ok {
+		retentionInterval, err = time.ParseDuration(v)
+		if err != nil || retentionInterval <= 0 {
+			slog.Error("Invalid RETENTION_INTERVAL", "value", v, "error", err)
+			return
+		}
+	}
+
+	// How often the execution limits are reloaded from the database.
+	limitsInterval := workflow.DefaultLimitsRefreshInterval
+	if v, ok := os.LookupEnv("LIMITS_REFRESH_INTERVAL"); ok {
+		limitsInterval, err = time.ParseDuration(v)
+		if err != nil || limitsInterval <= 0 {
+			slog.Error("Invalid LIMITS_REFRESH_INTERVAL", "value", v, "error", err)
+			return
+		}
+	}
+
+	// Every route needs an API key or JWT unless AUTH_DISABLED=true, e.g.
+	// for local development with the web app, which sends no credentials.
+	if os.Getenv("AUTH_DISABLED") == "true" {
+		slog.Warn("AUTH_DISABLED is set, the API accepts unauthenticated requests")
+	} else {
+		jwtCfg := auth.JWTConfig{
+			HS256Secret: []byte(os.Getenv("AUTH_JWT_SECRET")),
+			JWKSFile:    os.Getenv("AUTH_JWKS_FILE"),
+			Issuer:      os.Getenv("AUTH_JWT_ISSUER"),
+			Audience:    os.Getenv("AUTH_JWT_AUDIENCE"),
+		}
+		// The in-memory store has no API keys, so without AUTH_ADMIN_KEY
+		// or JWTs every request would be rejected.
+		if inMemory {
+			if key := os.Getenv("AUTH_ADMIN_KEY"); key != "" {
+				if err := bootstrapAdminKey(ctx, store, key); err != nil {
+					slog.Error("Failed to create the AUTH_ADMIN_KEY API key", "error", err)
+					return
+				}
+			} else if len(jwtCfg.HS256Secret) == 0 && jwtCfg.JWKSFile == "" {
+				slog.Error("Authentication is enabled but nothing can authenticate with in-memory storage: set AUTH_ADMIN_KEY, AUTH_JWT_SECRET or AUTH_JWKS_FILE, or AUTH_DISABLED=true")
+				return
+			}
+		}
+		authenticator, err := auth.NewAuthenticator(store, jwtCfg)
+		if err != nil {
+			slog.Error("Failed to set up authentication", "error", err)
+			return
+		}
+		workflowService.SetAuthenticator(authenticator)
+	}
+
+	// Secrets referenced from node metadata as {{secret:NAME}}, and the
+	// values runs are stored with masked, are sealed with this base64
+	// AES-256 key; without it the secrets API is disabled. Changing the key
+	// makes every stored secret unreadable.
+	if v := os.Getenv("SECRETS_KEY"); v != "" {
+		key, err := secrets.ParseKey(v)
+		if err != nil {
+			slog.Error("Invalid SECRETS_KEY", "error", err)
+			return
+		}
+		box, err := secrets.NewBox(key)
+		if err != nil {
+			slog.Error("Invalid SECRETS_KEY", "error", err)
+			return
+		}
+		workflowService.SetSecretsBox(box)
+	} else {
+		slog.Warn("SECRETS_KEY is not set, workflows cannot use secrets and masked run values are not sealed")
+	}
+
+	workflowService.SetMetrics(m)
 	workflowService.LoadRoutes(apiRouter)
 
+	// Expire approval and input tasks whose deadline has passed, resume
+	// runs whose delay or wait_until timer is due and delete expired
+	// idempotency keys.
+	schedulerCtx, stopScheduler := context.WithCancel(ctx)
+	defer stopScheduler()
+	go workflowService.RunScheduler(schedulerCtx, 10*time.Second)
+
+	// Prune runs past their workflow's retention policy.
+	go workflowService.RunRetention(schedulerCtx, retentionInterval)
+
+	// Rate limit and cap executions; the limits are loaded before serving
+	// and reloaded so edits to execution_limits apply without a restart.
+	if err := workflowService.RefreshLimits(ctx); err != nil {
+		slog.Error("Failed to load execution limits", "error", err)
+		return
+	}
+	go workflowService.RunLimitsRefresh(schedulerCtx, limitsInterval)
+
 	corsHandler := handlers.CORS(
 		// Frontend URL
 		handlers.AllowedOrigins([]string{"http://localhost:3003"}),
 		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
-		handlers.AllowedHeaders([]string{"Content-Type", "Authorization"}),
+		handlers.AllowedHeaders([]string{"Content-Type", "Authorization", "Idempotency-Key", "traceparent", "tracestate"}),
+		handlers.ExposedHeaders([]string{"Retry-After"}),
 		handlers.AllowCredentials(),
 	)(mainRouter)
 
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"workflow-code-test/api/pkg/db"
+)
+
+// runMigrate implements the "migrate" subcommand:
+//
+//	api migrate            apply pending migrations and exit
+//	api migrate -dry-run   list applied and pending migrations without changing anything
+func runMigrate(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "list pending migrations without applying them")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	dbURL, ok := os.LookupEnv("DATABASE_URL")
+	if !ok {
+		slog.Error("DATABASE_URL is not set")
+		return 1
+	}
+
+	pool, err := db.Connect(ctx, db.DefaultConfig(dbURL))
+	if err != nil {
+		slog.Error("Failed to connect to database", "error", err)
+		return 1
+	}
+	defer pool.Close()
+
+	migrator, err := db.NewMigrator(pool)
+	if err != nil {
+		slog.Error("Failed to load migrations", "error", err)
+		return 1
+	}
+
+	if *dryRun {
+		states, err := migrator.Status(ctx)
+		if err != nil {
+			slog.Error("Failed to read migration status", "error", err)
+			return 1
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tDESCRIPTION\tCHECKSUM\tSTATE")
+		for _, st := range states {
+			state := "pending"
+			if st.Applied {
+				state = "applied"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", st.Version, st.Description, st.Checksum, state)
+		}
+		tw.Flush()
+		return 0
+	}
+
+	if err := applyMigrations(ctx, migrator); err != nil {
+		slog.Error("Failed to apply migrations", "error", err)
+		return 1
+	}
+	return 0
+}
+
+// applyMigrations runs all pending migrations and logs what was applied.
+func applyMigrations(ctx context.Context, migrator *db.Migrator) error {
+	applied, err := migrator.Migrate(ctx)
+	if err != nil {
+		return err
+	}
+	for _, m := range applied {
+		slog.Info("Applied migration", "version", m.Version, "script", m.Script)
+	}
+	if len(applied) == 0 {
+		slog.Info("Database schema is up to date")
+	}
+	return nil
+}
@@ -3,6 +3,8 @@ package email
 import (
 	"context"
 	"log/slog"
+
+	"workflow-code-test/api/pkg/redact"
 )
 
 // Message represents an email to be sent.
@@ -38,7 +40,7 @@ func NewStubClient(fromAddress string) *StubClient {
 }
 
 func (c *StubClient) Send(_ context.Context, msg Message) (*Result, error) {
-	slog.Info("sending email (stub)", "to", msg.To, "from", msg.From, "subject", msg.Subject)
+	slog.Info("sending email (stub)", "to", redact.Email(msg.To), "from", msg.From, "subject", msg.Subject)
 	return &Result{
 		DeliveryStatus: "sent",
 		Sent:           true,
@@ -93,3 +93,22 @@ func classifyRisk(discharge float64) string {
 		return "low"
 	}
 }
+
+// StubClient returns a fixed river discharge for every location, classified
+// with the same thresholds as the real client.
+type StubClient struct {
+	Discharge float64
+}
+
+// NewStubClient creates a flood client that always reports discharge.
+func NewStubClient(discharge float64) *StubClient {
+	return &StubClient{Discharge: discharge}
+}
+
+func (c *StubClient) GetFloodRisk(_ context.Context, lat, lon float64) (*Result, error) {
+	slog.Info("getting flood risk (stub)", "lat", lat, "lon", lon, "discharge", c.Discharge)
+	return &Result{
+		Discharge: c.Discharge,
+		RiskLevel: classifyRisk(c.Discharge),
+	}, nil
+}
@@ -3,6 +3,8 @@ package sms
 import (
 	"context"
 	"log/slog"
+
+	"workflow-code-test/api/pkg/redact"
 )
 
 // Message represents an SMS to be sent.
@@ -31,7 +33,9 @@ func NewStubClient() *StubClient {
 }
 
 func (c *StubClient) Send(_ context.Context, msg Message) (*Result, error) {
-	slog.Info("sending sms (stub)", "to", msg.To, "body", msg.Body)
+	// The body may carry anything the template pulled in, so only its
+	// length is logged.
+	slog.Info("sending sms (stub)", "to", redact.Phone(msg.To), "bodyLength", len(msg.Body))
 	return &Result{
 		DeliveryStatus: "sent",
 		Sent:           true,
@@ -69,3 +69,19 @@ func (c *OpenMeteoClient) GetTemperature(ctx context.Context, lat, lon float64)
 
 	return result.CurrentWeather.Temperature, nil
 }
+
+// StubClient returns a fixed temperature for every location.
+// Used for offline runs (e.g. wfctl run -stub) and tests.
+type StubClient struct {
+	Temperature float64
+}
+
+// NewStubClient creates a weather client that always reports temperature.
+func NewStubClient(temperature float64) *StubClient {
+	return &StubClient{Temperature: temperature}
+}
+
+func (c *StubClient) GetTemperature(_ context.Context, lat, lon float64) (float64, error) {
+	slog.Info("getting temperature (stub)", "lat", lat, "lon", lon, "temperature", c.Temperature)
+	return c.Temperature, nil
+}
@@ -0,0 +1,12 @@
+package db
+
+import "io/fs"
+
+// NewMigratorFromFS builds a Migrator over test migrations instead of the embedded set.
+func NewMigratorFromFS(db MigrationDB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
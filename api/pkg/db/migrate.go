@@ -0,0 +1,396 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// migrationFiles embeds the Flyway-style SQL migrations so the API binary
+// can bring an empty database up to date without the Flyway container.
+//
+//go:embed migration/*.sql
+var migrationFiles embed.FS
+
+// historyTable is Flyway's default schema history table. Reusing its name and
+// layout means databases migrated by Flyway and by the API are interchangeable.
+const historyTable = "flyway_schema_history"
+
+// migrationLockID is the advisory lock key held while migrating, so replicas
+// starting at the same time apply migrations exactly once.
+const migrationLockID int64 = 0x776b666c6f77 // "wkflow"
+
+// migrationName matches Flyway versioned migrations: V<version>__<description>.sql
+var migrationName = regexp.MustCompile(`^V([0-9]+(?:[._][0-9]+)*)__(.+)\.sql$`)
+
+// Migration is a single versioned SQL script.
+type Migration struct {
+	Version     string
+	Description string
+	Script      string
+	Checksum    int32
+	SQL         string
+
+	version []int // parsed Version, for ordering
+}
+
+// MigrationState is a migration together with whether it has been applied.
+type MigrationState struct {
+	Migration
+	Applied   bool
+	AppliedAt *time.Time
+}
+
+// MigrationDB abstracts the database handle used by the Migrator.
+// Satisfied by *pgxpool.Pool in production and pgxmock in tests.
+type MigrationDB interface {
+	BeginTx(ctx context.Context, txOptions pgx.TxOptions) (pgx.Tx, error)
+}
+
+// Migrator applies embedded migrations and records them in a
+// Flyway-compatible history table.
+type Migrator struct {
+	db         MigrationDB
+	migrations []Migration
+}
+
+// NewMigrator creates a Migrator for the migrations embedded in the binary.
+func NewMigrator(db MigrationDB) (*Migrator, error) {
+	if db == nil {
+		return nil, fmt.Errorf("migrator: db cannot be nil")
+	}
+	migrations, err := LoadMigrations(migrationFiles)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// LoadMigrations reads every V*__*.sql file under a "migration" directory
+// in fsys and returns them ordered by version.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "migration")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	var migrations []Migration
+	seen := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		m := migrationName.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+		content, err := fs.ReadFile(fsys, path.Join("migration", entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s: %w", entry.Name(), err)
+		}
+
+		version := strings.ReplaceAll(m[1], "_", ".")
+		parsed, err := parseVersion(version)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("migrations %s and %s share version %s", other, entry.Name(), version)
+		}
+		seen[version] = entry.Name()
+
+		migrations = append(migrations, Migration{
+			Version:     version,
+			Description: strings.ReplaceAll(m[2], "_", " "),
+			Script:      entry.Name(),
+			Checksum:    Checksum(content),
+			SQL:         string(content),
+			version:     parsed,
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return compareVersions(migrations[i].version, migrations[j].version) < 0
+	})
+	return migrations, nil
+}
+
+// Checksum computes Flyway's migration checksum: a CRC32 over each line of
+// the script with line terminators (and a leading UTF-8 BOM) removed.
+func Checksum(content []byte) int32 {
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	crc := crc32.NewIEEE()
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(content)+1)
+	for scanner.Scan() {
+		crc.Write(scanner.Bytes())
+	}
+	return int32(crc.Sum32())
+}
+
+// historyRow is one row of flyway_schema_history.
+type historyRow struct {
+	rank      int
+	version   *string
+	script    string
+	kind      string
+	checksum  *int32
+	success   bool
+	installed time.Time
+}
+
+// Status returns every known migration with its applied state, without
+// changing the database. It is the dry-run view of Migrate.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationState, error) {
+	tx, err := m.db.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction for migration status: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, historyTable).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("check schema history table: %w", err)
+	}
+
+	var history []historyRow
+	if exists {
+		if history, err = readHistory(ctx, tx); err != nil {
+			return nil, err
+		}
+	}
+
+	pending, err := m.plan(history)
+	if err != nil {
+		return nil, err
+	}
+	pendingSet := make(map[string]bool, len(pending))
+	for _, p := range pending {
+		pendingSet[p.Version] = true
+	}
+	appliedAt := make(map[string]time.Time)
+	for _, h := range history {
+		if h.version != nil {
+			appliedAt[*h.version] = h.installed
+		}
+	}
+
+	states := make([]MigrationState, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		st := MigrationState{Migration: mig, Applied: !pendingSet[mig.Version]}
+		if at, ok := appliedAt[mig.Version]; ok {
+			st.AppliedAt = &at
+		}
+		states = append(states, st)
+	}
+	return states, tx.Commit(ctx)
+}
+
+// Migrate applies all pending migrations in a single transaction while
+// holding an advisory lock, and returns the migrations it applied. A failure
+// rolls back every migration in the batch, leaving the history untouched.
+func (m *Migrator) Migrate(ctx context.Context) ([]Migration, error) {
+	tx, err := m.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction for migrate: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Blocks until any other replica finishes; released on commit/rollback.
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+		return nil, fmt.Errorf("acquire migration lock: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+        CREATE TABLE IF NOT EXISTS flyway_schema_history (
+            installed_rank INT NOT NULL PRIMARY KEY,
+            version VARCHAR(50),
+            description VARCHAR(200) NOT NULL,
+            type VARCHAR(20) NOT NULL,
+            script VARCHAR(1000) NOT NULL,
+            checksum INT,
+            installed_by VARCHAR(100) NOT NULL,
+            installed_on TIMESTAMP NOT NULL DEFAULT now(),
+            execution_time INT NOT NULL,
+            success BOOLEAN NOT NULL
+        );`)
+	if err != nil {
+		return nil, fmt.Errorf("create schema history table: %w", err)
+	}
+
+	history, err := readHistory(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := m.plan(history)
+	if err != nil {
+		return nil, err
+	}
+
+	nextRank := 1
+	if len(history) > 0 {
+		nextRank = history[len(history)-1].rank + 1
+	}
+
+	for _, mig := range pending {
+		start := time.Now()
+		if _, err := tx.Exec(ctx, mig.SQL); err != nil {
+			return nil, fmt.Errorf("apply migration %s: %w", mig.Script, err)
+		}
+		elapsed := time.Since(start).Milliseconds()
+
+		_, err = tx.Exec(ctx, `
+            INSERT INTO flyway_schema_history (
+                installed_rank, version, description, type, script,
+                checksum, installed_by, execution_time, success
+            ) VALUES ($1, $2, $3, 'SQL', $4, $5, current_user, $6, true)`,
+			nextRank, mig.Version, mig.Description, mig.Script, mig.Checksum, elapsed)
+		if err != nil {
+			return nil, fmt.Errorf("record migration %s: %w", mig.Script, err)
+		}
+		nextRank++
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit migrations: %w", err)
+	}
+	return pending, nil
+}
+
+// readHistory loads the schema history ordered by installed_rank.
+func readHistory(ctx context.Context, tx pgx.Tx) ([]historyRow, error) {
+	rows, err := tx.Query(ctx, `
+        SELECT installed_rank, version, script, type, checksum, success, installed_on
+        FROM flyway_schema_history
+        ORDER BY installed_rank`)
+	if err != nil {
+		return nil, fmt.Errorf("read schema history: %w", err)
+	}
+	defer rows.Close()
+
+	var history []historyRow
+	for rows.Next() {
+		var h historyRow
+		if err := rows.Scan(&h.rank, &h.version, &h.script, &h.kind, &h.checksum, &h.success, &h.installed); err != nil {
+			return nil, fmt.Errorf("scan schema history row: %w", err)
+		}
+		history = append(history, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("schema history rows error: %w", err)
+	}
+	return history, nil
+}
+
+// plan validates the recorded history against the embedded migrations and
+// returns the migrations still to apply. Like Flyway's validate, it refuses
+// to continue after a failed migration, a checksum mismatch, an applied
+// migration missing from the binary, or a pending migration older than the
+// latest applied one.
+func (m *Migrator) plan(history []historyRow) ([]Migration, error) {
+	byVersion := make(map[string]Migration, len(m.migrations))
+	for _, mig := range m.migrations {
+		byVersion[mig.Version] = mig
+	}
+
+	applied := make(map[string]bool)
+	var baseline, latest []int
+	for _, h := range history {
+		if !h.success {
+			return nil, fmt.Errorf("migration %s failed previously; repair the schema history before migrating", h.script)
+		}
+		if h.version == nil {
+			continue // repeatable migrations are not used here
+		}
+		v, err := parseVersion(*h.version)
+		if err != nil {
+			return nil, fmt.Errorf("schema history: %w", err)
+		}
+		if h.kind == "BASELINE" {
+			baseline = v
+			continue
+		}
+
+		mig, ok := byVersion[*h.version]
+		if !ok {
+			return nil, fmt.Errorf("applied migration %s (version %s) not found in binary", h.script, *h.version)
+		}
+		if h.checksum == nil || *h.checksum != mig.Checksum {
+			return nil, fmt.Errorf("checksum mismatch for migration %s: applied %s, local %d",
+				mig.Script, formatChecksum(h.checksum), mig.Checksum)
+		}
+		applied[*h.version] = true
+		if latest == nil || compareVersions(v, latest) > 0 {
+			latest = v
+		}
+	}
+
+	var pending []Migration
+	for _, mig := range m.migrations {
+		if applied[mig.Version] {
+			continue
+		}
+		if baseline != nil && compareVersions(mig.version, baseline) <= 0 {
+			continue
+		}
+		if latest != nil && compareVersions(mig.version, latest) < 0 {
+			return nil, fmt.Errorf("migration %s is older than the latest applied version; out-of-order migrations are not supported", mig.Script)
+		}
+		pending = append(pending, mig)
+	}
+	return pending, nil
+}
+
+func formatChecksum(c *int32) string {
+	if c == nil {
+		return "null"
+	}
+	return strconv.Itoa(int(*c))
+}
+
+// parseVersion splits a dotted version ("1", "2.1") into numeric parts.
+func parseVersion(v string) ([]int, error) {
+	parts := strings.Split(v, ".")
+	out := make([]int, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q", v)
+		}
+		out[i] = n
+	}
+	return out, nil
+}
+
+// compareVersions orders versions numerically part by part; missing parts count as 0.
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,312 @@
+package db_test
+
+import (
+	"context"
+	"hash/crc32"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+
+	"workflow-code-test/api/pkg/db"
+)
+
+var testMigrations = fstest.MapFS{
+	"migration/V1__create_things.sql": {Data: []byte("CREATE TABLE things (id INT);\n")},
+	"migration/V2__seed_things.sql":   {Data: []byte("INSERT INTO things VALUES (1);\n")},
+	"migration/V10__add_column.sql":   {Data: []byte("ALTER TABLE things ADD COLUMN name TEXT;\n")},
+	"migration/README.md":             {Data: []byte("not a migration")},
+}
+
+var historyColumns = []string{"installed_rank", "version", "script", "type", "checksum", "success", "installed_on"}
+
+func checksumOf(path string) int32 {
+	return db.Checksum(testMigrations[path].Data)
+}
+
+func strPtr(s string) *string { return &s }
+func i32Ptr(i int32) *int32   { return &i }
+
+func TestChecksum(t *testing.T) {
+	t.Parallel()
+	want := int32(crc32.ChecksumIEEE([]byte("SELECT 1;SELECT 2;")))
+
+	for name, content := range map[string]string{
+		"LF line endings":   "SELECT 1;\nSELECT 2;\n",
+		"CRLF line endings": "SELECT 1;\r\nSELECT 2;\r\n",
+		"no trailing EOL":   "SELECT 1;\nSELECT 2;",
+		"UTF-8 BOM":         "\xef\xbb\xbfSELECT 1;\nSELECT 2;\n",
+	} {
+		if got := db.Checksum([]byte(content)); got != want {
+			t.Errorf("%s: expected %d, got %d", name, want, got)
+		}
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	t.Parallel()
+
+	migrations, err := db.LoadMigrations(testMigrations)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var versions []string
+	for _, m := range migrations {
+		versions = append(versions, m.Version)
+	}
+	if strings.Join(versions, ",") != "1,2,10" {
+		t.Errorf("expected numeric version order 1,2,10, got %v", versions)
+	}
+	if migrations[0].Description != "create things" {
+		t.Errorf("expected description 'create things', got %q", migrations[0].Description)
+	}
+
+	dup := fstest.MapFS{
+		"migration/V1__a.sql": {Data: []byte("SELECT 1;")},
+		"migration/V1__b.sql": {Data: []byte("SELECT 2;")},
+	}
+	if _, err := db.LoadMigrations(dup); err == nil {
+		t.Error("expected error for duplicate versions, got nil")
+	}
+}
+
+func TestNewMigrator_EmbedsRepositoryMigrations(t *testing.T) {
+	t.Parallel()
+
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("failed to create mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	// Nothing applied yet, so every embedded migration is pending.
+	mock.ExpectBeginTx(pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	mock.ExpectQuery("SELECT to_regclass").
+		WithArgs("flyway_schema_history").
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectCommit()
+
+	m, err := db.NewMigrator(mock)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	states, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(states) < 6 {
+		t.Fatalf("expected at least the V1–V6 migrations, got %d", len(states))
+	}
+	if states[0].Script != "V1__create_workflow_orchestrator_system.sql" {
+		t.Errorf("expected V1 first, got %s", states[0].Script)
+	}
+	for _, st := range states {
+		if st.Applied {
+			t.Errorf("expected %s to be pending", st.Script)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		history     func() *pgxmock.Rows
+		wantApplied []string
+		wantRanks   []int
+		wantErr     string
+	}{
+		{
+			name:        "fresh database applies everything",
+			history:     func() *pgxmock.Rows { return pgxmock.NewRows(historyColumns) },
+			wantApplied: []string{"V1__create_things.sql", "V2__seed_things.sql", "V10__add_column.sql"},
+			wantRanks:   []int{1, 2, 3},
+		},
+		{
+			name: "partially migrated database applies the rest",
+			history: func() *pgxmock.Rows {
+				return pgxmock.NewRows(historyColumns).
+					AddRow(1, strPtr("0"), "<< Flyway Baseline >>", "BASELINE", nil, true, now).
+					AddRow(2, strPtr("1"), "V1__create_things.sql", "SQL", i32Ptr(checksumOf("migration/V1__create_things.sql")), true, now)
+			},
+			wantApplied: []string{"V2__seed_things.sql", "V10__add_column.sql"},
+			wantRanks:   []int{3, 4},
+		},
+		{
+			name: "up-to-date database is a no-op",
+			history: func() *pgxmock.Rows {
+				return pgxmock.NewRows(historyColumns).
+					AddRow(1, strPtr("1"), "V1__create_things.sql", "SQL", i32Ptr(checksumOf("migration/V1__create_things.sql")), true, now).
+					AddRow(2, strPtr("2"), "V2__seed_things.sql", "SQL", i32Ptr(checksumOf("migration/V2__seed_things.sql")), true, now).
+					AddRow(3, strPtr("10"), "V10__add_column.sql", "SQL", i32Ptr(checksumOf("migration/V10__add_column.sql")), true, now)
+			},
+		},
+		{
+			name: "checksum mismatch is rejected",
+			history: func() *pgxmock.Rows {
+				return pgxmock.NewRows(historyColumns).
+					AddRow(1, strPtr("1"), "V1__create_things.sql", "SQL", i32Ptr(42), true, now)
+			},
+			wantErr: "checksum mismatch for migration V1__create_things.sql",
+		},
+		{
+			name: "failed migration blocks further migrations",
+			history: func() *pgxmock.Rows {
+				return pgxmock.NewRows(historyColumns).
+					AddRow(1, strPtr("1"), "V1__create_things.sql", "SQL", i32Ptr(checksumOf("migration/V1__create_things.sql")), false, now)
+			},
+			wantErr: "failed previously",
+		},
+		{
+			name: "applied migration missing from binary is rejected",
+			history: func() *pgxmock.Rows {
+				return pgxmock.NewRows(historyColumns).
+					AddRow(1, strPtr("99"), "V99__future.sql", "SQL", i32Ptr(1), true, now)
+			},
+			wantErr: "not found in binary",
+		},
+		{
+			name: "out-of-order pending migration is rejected",
+			history: func() *pgxmock.Rows {
+				return pgxmock.NewRows(historyColumns).
+					AddRow(1, strPtr("1"), "V1__create_things.sql", "SQL", i32Ptr(checksumOf("migration/V1__create_things.sql")), true, now).
+					AddRow(2, strPtr("10"), "V10__add_column.sql", "SQL", i32Ptr(checksumOf("migration/V10__add_column.sql")), true, now)
+			},
+			wantErr: "out-of-order",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("failed to create mock pool: %v", err)
+			}
+			defer mock.Close()
+
+			mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+			mock.ExpectExec("SELECT pg_advisory_xact_lock").
+				WithArgs(pgxmock.AnyArg()).
+				WillReturnResult(pgxmock.NewResult("SELECT", 1))
+			mock.ExpectExec("CREATE TABLE IF NOT EXISTS flyway_schema_history").
+				WillReturnResult(pgxmock.NewResult("CREATE TABLE", 0))
+			mock.ExpectQuery("FROM flyway_schema_history").WillReturnRows(tt.history())
+
+			if tt.wantErr != "" {
+				mock.ExpectRollback()
+			} else {
+				for i, script := range tt.wantApplied {
+					path := "migration/" + script
+					mock.ExpectExec(regexp.QuoteMeta(string(testMigrations[path].Data))).
+						WillReturnResult(pgxmock.NewResult("OK", 0))
+					mock.ExpectExec("INSERT INTO flyway_schema_history").
+						WithArgs(tt.wantRanks[i], pgxmock.AnyArg(), pgxmock.AnyArg(), script, checksumOf(path), pgxmock.AnyArg()).
+						WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				}
+				mock.ExpectCommit()
+			}
+
+			m, err := db.NewMigratorFromFS(mock, testMigrations)
+			if err != nil {
+				t.Fatalf("failed to create migrator: %v", err)
+			}
+			applied, err := m.Migrate(context.Background())
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if len(applied) != len(tt.wantApplied) {
+					t.Errorf("expected %d applied migrations, got %d", len(tt.wantApplied), len(applied))
+				}
+			}
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestMigrate_ApplyFailureRollsBack(t *testing.T) {
+	t.Parallel()
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("failed to create mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+	mock.ExpectExec("SELECT pg_advisory_xact_lock").
+		WithArgs(pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS flyway_schema_history").
+		WillReturnResult(pgxmock.NewResult("CREATE TABLE", 0))
+	mock.ExpectQuery("FROM flyway_schema_history").WillReturnRows(pgxmock.NewRows(historyColumns))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE things")).
+		WillReturnError(pgx.ErrTxClosed)
+	mock.ExpectRollback()
+
+	m, err := db.NewMigratorFromFS(mock, testMigrations)
+	if err != nil {
+		t.Fatalf("failed to create migrator: %v", err)
+	}
+	if _, err := m.Migrate(context.Background()); err == nil || !strings.Contains(err.Error(), "V1__create_things.sql") {
+		t.Errorf("expected error naming the failed script, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet mock expectations: %v", err)
+	}
+}
+
+func TestStatus_ReportsAppliedAndPending(t *testing.T) {
+	t.Parallel()
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("failed to create mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	now := time.Now()
+	mock.ExpectBeginTx(pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	mock.ExpectQuery("SELECT to_regclass").
+		WithArgs("flyway_schema_history").
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery("FROM flyway_schema_history").
+		WillReturnRows(pgxmock.NewRows(historyColumns).
+			AddRow(1, strPtr("1"), "V1__create_things.sql", "SQL", i32Ptr(checksumOf("migration/V1__create_things.sql")), true, now))
+	mock.ExpectCommit()
+
+	m, err := db.NewMigratorFromFS(mock, testMigrations)
+	if err != nil {
+		t.Fatalf("failed to create migrator: %v", err)
+	}
+	states, err := m.Status(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]bool{"1": true, "2": false, "10": false}
+	for _, st := range states {
+		if st.Applied != want[st.Version] {
+			t.Errorf("version %s: expected applied=%v, got %v", st.Version, want[st.Version], st.Applied)
+		}
+	}
+	if states[0].AppliedAt == nil {
+		t.Error("expected applied migration to carry its install time")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet mock expectations: %v", err)
+	}
+}
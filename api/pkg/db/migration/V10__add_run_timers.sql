@@ -0,0 +1,18 @@
+-- V10: Durable timers
+-- A run suspended at a delay or wait_until node keeps its state in
+-- workflow_runs.state (V9) and the time it should continue in resume_at.
+-- The scheduler resumes due runs, so timers survive an API restart and no
+-- request or goroutine is held open while a run waits. Also adds delay and
+-- wait_until blueprints to the node library.
+
+ALTER TABLE workflow_runs ADD COLUMN resume_at TIMESTAMPTZ;
+
+CREATE INDEX idx_workflow_runs_resume_at ON workflow_runs (resume_at) WHERE resume_at IS NOT NULL;
+
+INSERT INTO node_library (id, node_type, base_label, base_description, metadata)
+VALUES
+    ('a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a23', 'delay', 'Delay', 'Pause the run for a fixed duration',
+     '{"hasHandles": {"source": true, "target": true}, "duration": "15m"}'),
+
+    ('a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a24', 'wait_until', 'Wait Until', 'Pause the run until a point in time',
+     '{"hasHandles": {"source": true, "target": true}, "until": "{{resumeAt}}", "inputVariables": ["resumeAt"]}');
@@ -0,0 +1,10 @@
+-- V11: Sub-workflows
+-- A subworkflow node runs another workflow with an explicit input and
+-- output mapping. Like every node, its configuration lives in its library
+-- entry, so each reusable sub-workflow gets a blueprint; this one wraps the
+-- seeded Weather Check System (V2).
+
+INSERT INTO node_library (id, node_type, base_label, base_description, metadata)
+VALUES
+    ('a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a25', 'subworkflow', 'Weather Check', 'Run the Weather Check System as a step',
+     '{"hasHandles": {"source": true, "target": true}, "workflowId": "550e8400-e29b-41d4-a716-446655440000", "inputMapping": {"name": "name", "email": "email", "city": "city", "operator": "operator", "threshold": "threshold"}, "outputMapping": {"temperature": "temperature", "conditionMet": "conditionMet"}}');
@@ -0,0 +1,8 @@
+-- V12: For-each loops
+-- A foreach node runs the subgraph on its "body" branch once per item of a
+-- list variable, then follows its "done" branch with the collected results.
+
+INSERT INTO node_library (id, node_type, base_label, base_description, metadata)
+VALUES
+    ('a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a26', 'foreach', 'For Each', 'Run the body branch once per item of a list',
+     '{"hasHandles": {"source": ["body", "done"], "target": true}, "items": "cities", "itemVariable": "city", "concurrency": 1, "resultVariable": "results"}');
@@ -0,0 +1,8 @@
+-- V13: Workflow settings
+-- Per-workflow options that change how the engine runs the graph, e.g.
+-- scopedOutputsOnly, which keeps node outputs under nodes.<id> instead of
+-- also merging them into flat variables. Publishing copies the settings into
+-- the snapshot's dag_data, so a published version keeps the behaviour it was
+-- published with.
+
+ALTER TABLE workflows ADD COLUMN settings JSONB NOT NULL DEFAULT '{}'::jsonb;
@@ -0,0 +1,20 @@
+-- V14: Idempotency keys
+-- An execute request sent with an Idempotency-Key header claims the key
+-- while it runs and stores its response when it finishes, so a retried
+-- request returns the original response instead of sending every email
+-- and SMS again. Keys are scoped to a workflow and deleted once they expire.
+
+CREATE TABLE idempotency_keys (
+    workflow_id   UUID NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+    key           VARCHAR(255) NOT NULL,
+    request_hash  VARCHAR(64) NOT NULL,
+    status        VARCHAR(20) NOT NULL DEFAULT 'in_progress'
+                  CHECK (status IN ('in_progress', 'completed')),
+    status_code   INT,
+    response      JSONB,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at    TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (workflow_id, key)
+);
+
+CREATE INDEX idx_idempotency_keys_expiry ON idempotency_keys (expires_at);
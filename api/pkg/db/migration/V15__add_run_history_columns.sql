@@ -0,0 +1,25 @@
+-- V15: Run history
+-- Runs are listed per workflow and aggregated over a time window, so the
+-- node a run failed at and how long its steps took are kept in columns
+-- rather than read out of the result JSON. duration_ms is the time spent
+-- executing steps, not the time a run waited on a task or timer.
+-- Listing pages by (created_at, id), newest first; inputs are matched by
+-- containment.
+
+ALTER TABLE workflow_runs
+    ADD COLUMN failed_node  VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN duration_ms  BIGINT NOT NULL DEFAULT 0;
+
+UPDATE workflow_runs
+SET failed_node = COALESCE(result->>'failedNode', ''),
+    duration_ms = COALESCE((
+        SELECT SUM((step->>'durationMs')::BIGINT)
+        FROM jsonb_array_elements(result->'steps') AS step
+    ), 0)
+WHERE jsonb_typeof(result->'steps') = 'array';
+
+DROP INDEX idx_workflow_runs_workflow;
+CREATE INDEX idx_workflow_runs_workflow ON workflow_runs (workflow_id, created_at DESC, id DESC);
+CREATE INDEX idx_workflow_runs_status ON workflow_runs (workflow_id, status, created_at DESC, id DESC);
+CREATE INDEX idx_workflow_runs_failed_node ON workflow_runs (workflow_id, failed_node) WHERE failed_node <> '';
+CREATE INDEX idx_workflow_runs_inputs ON workflow_runs USING GIN (inputs jsonb_path_ops);
@@ -0,0 +1,17 @@
+-- V16: API keys
+-- Keys authenticate machine clients of the API. The secret is shown once
+-- when a key is created; only its SHA-256 hash is kept, next to the
+-- public prefix the key is looked up by. Revoked keys are kept so their
+-- names still resolve in logs and audit records.
+
+CREATE TABLE api_keys (
+    id            UUID PRIMARY KEY,
+    name          VARCHAR(255) NOT NULL,
+    prefix        VARCHAR(32) NOT NULL UNIQUE,
+    key_hash      VARCHAR(64) NOT NULL,
+    role          VARCHAR(20) NOT NULL
+                  CHECK (role IN ('viewer', 'editor', 'publisher', 'admin')),
+    created_by    VARCHAR(255) NOT NULL DEFAULT '',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    revoked_at    TIMESTAMPTZ
+);
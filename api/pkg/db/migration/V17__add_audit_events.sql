@@ -0,0 +1,35 @@
+-- V17: Audit log
+-- Every change to a workflow, publish and node_library edit appends an
+-- event in the same transaction as the change, naming who made it, in
+-- which request, and the fields it changed as {"<path>": {"before": …,
+-- "after": …}}. Events are never updated or deleted; the trigger below
+-- rejects both, and TRUNCATE.
+
+CREATE TABLE audit_events (
+    id           BIGSERIAL PRIMARY KEY,
+    occurred_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    actor        VARCHAR(255) NOT NULL DEFAULT '',
+    action       VARCHAR(50) NOT NULL,
+    target_type  VARCHAR(50) NOT NULL,
+    target_id    VARCHAR(255) NOT NULL,
+    request_id   VARCHAR(255) NOT NULL DEFAULT '',
+    diff         JSONB NOT NULL DEFAULT '{}'::jsonb
+);
+
+CREATE INDEX idx_audit_events_target ON audit_events (target_type, target_id, id DESC);
+CREATE INDEX idx_audit_events_actor ON audit_events (actor, id DESC);
+CREATE INDEX idx_audit_events_occurred ON audit_events (occurred_at);
+
+CREATE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_no_update_delete
+    BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+CREATE TRIGGER audit_events_no_truncate
+    BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
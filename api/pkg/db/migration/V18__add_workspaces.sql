@@ -0,0 +1,53 @@
+-- V18: Workspaces
+-- A workspace is a tenant of the deployment: every workflow belongs to
+-- exactly one, and its snapshots, runs, tasks and audit events are kept in
+-- the same workspace so queries can be scoped without joining back to the
+-- workflow. Existing data moves to the 'default' workspace, which the
+-- unprefixed API routes use.
+--
+-- node_library entries with a NULL workspace_id form the shared global
+-- library: every workspace can use them but none can change them. API keys
+-- with a NULL workspace_id may act in any workspace.
+--
+-- max_workflows and max_runs_per_hour are the workspace's quotas; NULL
+-- means unlimited.
+
+CREATE TABLE workspaces (
+    id                 VARCHAR(63) PRIMARY KEY CHECK (id ~ '^[a-z0-9][a-z0-9-]*$'),
+    name               VARCHAR(255) NOT NULL,
+    max_workflows      INTEGER CHECK (max_workflows >= 0),
+    max_runs_per_hour  INTEGER CHECK (max_runs_per_hour >= 0),
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+INSERT INTO workspaces (id, name) VALUES ('default', 'Default');
+
+ALTER TABLE workflows
+    ADD COLUMN workspace_id VARCHAR(63) NOT NULL DEFAULT 'default' REFERENCES workspaces(id);
+ALTER TABLE workflows ALTER COLUMN workspace_id DROP DEFAULT;
+
+ALTER TABLE workflow_snapshots
+    ADD COLUMN workspace_id VARCHAR(63) NOT NULL DEFAULT 'default' REFERENCES workspaces(id);
+ALTER TABLE workflow_snapshots ALTER COLUMN workspace_id DROP DEFAULT;
+
+ALTER TABLE workflow_runs
+    ADD COLUMN workspace_id VARCHAR(63) NOT NULL DEFAULT 'default' REFERENCES workspaces(id);
+ALTER TABLE workflow_runs ALTER COLUMN workspace_id DROP DEFAULT;
+
+ALTER TABLE workflow_tasks
+    ADD COLUMN workspace_id VARCHAR(63) NOT NULL DEFAULT 'default' REFERENCES workspaces(id);
+ALTER TABLE workflow_tasks ALTER COLUMN workspace_id DROP DEFAULT;
+
+ALTER TABLE audit_events
+    ADD COLUMN workspace_id VARCHAR(63) NOT NULL DEFAULT 'default' REFERENCES workspaces(id);
+ALTER TABLE audit_events ALTER COLUMN workspace_id DROP DEFAULT;
+
+ALTER TABLE node_library ADD COLUMN workspace_id VARCHAR(63) REFERENCES workspaces(id);
+
+ALTER TABLE api_keys ADD COLUMN workspace_id VARCHAR(63) REFERENCES workspaces(id);
+
+CREATE INDEX idx_workflows_workspace ON workflows (workspace_id) WHERE deleted_at IS NULL;
+CREATE INDEX idx_workflow_runs_workspace ON workflow_runs (workspace_id, created_at);
+CREATE INDEX idx_workflow_tasks_workspace ON workflow_tasks (workspace_id, created_at);
+CREATE INDEX idx_node_library_workspace ON node_library (workspace_id);
+CREATE INDEX idx_audit_events_workspace ON audit_events (workspace_id, id DESC);
@@ -0,0 +1,19 @@
+-- V19: Encrypted secrets
+-- Values node metadata refers to as {{secret:NAME}}, such as provider API
+-- keys, so they are not stored in node_library.metadata or frozen into
+-- snapshots in plain text. The API encrypts each value with AES-256-GCM
+-- under the key in SECRETS_KEY before storing it; the database never sees
+-- the plain text. Secrets belong to a workspace, and names are unique in
+-- it.
+
+CREATE TABLE secrets (
+    workspace_id  VARCHAR(63) NOT NULL REFERENCES workspaces(id),
+    name          VARCHAR(128) NOT NULL CHECK (name ~ '^[A-Za-z_][A-Za-z0-9_]*$'),
+    ciphertext    BYTEA NOT NULL,
+    updated_by    VARCHAR(255) NOT NULL DEFAULT '',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    modified_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (workspace_id, name)
+);
+
+CREATE TRIGGER update_secrets_modtime BEFORE UPDATE ON secrets FOR EACH ROW EXECUTE FUNCTION update_modified_column();
@@ -0,0 +1,29 @@
+-- V20: Execution limits
+-- Token-bucket rate limits and concurrency caps for the endpoints that
+-- execute workflows, so a client calling them in a loop cannot drive
+-- unlimited calls to the weather, flood and notification providers. The
+-- API reloads this table periodically, so changes apply without a restart.
+--
+-- scope is 'global' (the whole deployment), 'api_key' (each caller, by its
+-- principal subject such as api-key:ci) or 'workflow' (each workflow, by
+-- ID). A row with an empty subject is the default for every caller or
+-- workflow; a row naming one replaces the default for it. A rate of
+-- rate_per_minute refills a bucket of burst requests; 0 disables a limit.
+
+CREATE TABLE execution_limits (
+    scope            VARCHAR(16) NOT NULL CHECK (scope IN ('global', 'api_key', 'workflow')),
+    subject          VARCHAR(255) NOT NULL DEFAULT '',
+    rate_per_minute  INTEGER NOT NULL DEFAULT 0 CHECK (rate_per_minute >= 0),
+    burst            INTEGER NOT NULL DEFAULT 0 CHECK (burst >= 0),
+    max_concurrent   INTEGER NOT NULL DEFAULT 0 CHECK (max_concurrent >= 0),
+    modified_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (scope, subject),
+    CHECK (scope <> 'global' OR subject = '')
+);
+
+CREATE TRIGGER update_execution_limits_modtime BEFORE UPDATE ON execution_limits FOR EACH ROW EXECUTE FUNCTION update_modified_column();
+
+INSERT INTO execution_limits (scope, subject, rate_per_minute, burst, max_concurrent) VALUES
+    ('global', '', 0, 0, 50),
+    ('api_key', '', 60, 20, 0),
+    ('workflow', '', 120, 30, 10);
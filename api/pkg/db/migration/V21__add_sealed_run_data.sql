@@ -0,0 +1,9 @@
+-- V21: Sealed run data
+-- Runs are stored with their sensitive values masked. What a run still
+-- needs in the clear is encrypted with SECRETS_KEY, like secrets, into
+-- sealed: the inputs as they were before masking, so a replay runs on the
+-- same values as the original, and the sensitive variables of a suspended
+-- run, which are left out of state and restored when it resumes. The API
+-- never returns the column.
+
+ALTER TABLE workflow_runs ADD COLUMN sealed BYTEA;
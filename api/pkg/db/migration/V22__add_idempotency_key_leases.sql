@@ -0,0 +1,9 @@
+-- V22: Idempotency key leases
+-- A request holds its in-progress key only until locked_until. A request
+-- that crashed, or whose response could not be stored, leaves its key in
+-- progress; once the lease has run out a retry takes the key over instead
+-- of getting 409 until the key expires.
+
+ALTER TABLE idempotency_keys ADD COLUMN locked_until TIMESTAMPTZ;
+UPDATE idempotency_keys SET locked_until = created_at + INTERVAL '2 minutes';
+ALTER TABLE idempotency_keys ALTER COLUMN locked_until SET NOT NULL;
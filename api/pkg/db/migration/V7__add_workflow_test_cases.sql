@@ -0,0 +1,14 @@
+-- V7: Workflow test cases
+-- Regression tests attached to a workflow. The definition (inputs,
+-- integration mocks, assertions) is owned by the API and stored as JSON;
+-- position keeps cases in the order they were saved.
+
+CREATE TABLE workflow_test_cases (
+    workflow_id  UUID NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+    position     INT NOT NULL,
+    name         VARCHAR(255) NOT NULL,
+    definition   JSONB NOT NULL,
+    modified_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (workflow_id, position),
+    UNIQUE (workflow_id, name)
+);
@@ -0,0 +1,19 @@
+-- V8: Workflow runs
+-- One row per execution, recorded so past runs can be inspected and
+-- replayed. version_number is the snapshot the run executed (0 for the
+-- draft). inputs, result and the recorded integration calls are owned by
+-- the API and stored as JSON.
+
+CREATE TABLE workflow_runs (
+    id              UUID PRIMARY KEY,
+    workflow_id     UUID NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+    version_number  INT NOT NULL DEFAULT 0,
+    mode            VARCHAR(20) NOT NULL DEFAULT 'live',
+    status          VARCHAR(20) NOT NULL,
+    inputs          JSONB NOT NULL DEFAULT '{}',
+    result          JSONB NOT NULL,
+    calls           JSONB NOT NULL DEFAULT '[]',
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_workflow_runs_workflow ON workflow_runs (workflow_id, created_at DESC);
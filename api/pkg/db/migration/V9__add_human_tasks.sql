@@ -0,0 +1,36 @@
+-- V9: Human tasks
+-- A run that reaches an approval or input node is suspended: the engine
+-- state needed to resume it is kept in workflow_runs.state until a person
+-- responds to its task in workflow_tasks or the task expires. Also adds
+-- generic approval and input blueprints to the node library.
+
+ALTER TABLE workflow_runs ADD COLUMN state JSONB;
+
+CREATE TABLE workflow_tasks (
+    id            UUID PRIMARY KEY,
+    workflow_id   UUID NOT NULL REFERENCES workflows(id) ON DELETE CASCADE,
+    run_id        UUID NOT NULL REFERENCES workflow_runs(id) ON DELETE CASCADE,
+    node_id       VARCHAR(100) NOT NULL,
+    kind          VARCHAR(20) NOT NULL CHECK (kind IN ('approval', 'input')),
+    assignee      VARCHAR(255) NOT NULL DEFAULT '',
+    title         TEXT NOT NULL,
+    fields        TEXT[] NOT NULL DEFAULT '{}',
+    status        VARCHAR(20) NOT NULL DEFAULT 'pending'
+                  CHECK (status IN ('pending', 'approved', 'rejected', 'submitted', 'expired')),
+    response      JSONB,
+    responded_by  VARCHAR(255) NOT NULL DEFAULT '',
+    expires_at    TIMESTAMPTZ,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    completed_at  TIMESTAMPTZ
+);
+
+CREATE INDEX idx_workflow_tasks_pending ON workflow_tasks (assignee, created_at) WHERE status = 'pending';
+CREATE INDEX idx_workflow_tasks_expiry ON workflow_tasks (expires_at) WHERE status = 'pending' AND expires_at IS NOT NULL;
+
+INSERT INTO node_library (id, node_type, base_label, base_description, metadata)
+VALUES
+    ('a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a21', 'approval', 'Approval', 'Wait for a person to approve or reject',
+     '{"hasHandles": {"source": ["approved", "rejected", "timeout"], "target": true}, "assignee": "{{approver}}", "title": "Approve alert for {{city}}", "timeout": "24h", "fields": ["comment"], "inputVariables": ["approver", "city"], "outputVariables": ["approved", "approvalStatus", "respondedBy", "comment"]}'),
+
+    ('a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a22', 'input', 'Wait for Input', 'Wait for a person to submit additional fields',
+     '{"hasHandles": {"source": ["submitted", "timeout"], "target": true}, "assignee": "{{approver}}", "title": "Provide a phone number for {{name}}", "timeout": "24h", "fields": ["phone"], "inputVariables": ["approver", "name"], "outputVariables": ["phone", "respondedBy"]}');
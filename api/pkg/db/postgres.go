@@ -31,7 +31,8 @@ func DefaultConfig(uri string) Config {
 }
 
 // Connect creates a PostgreSQL connection pool using the provided config
-// and verifies connectivity with a ping.
+// and verifies connectivity with a ping. Every query is traced with the
+// global tracer provider.
 func Connect(ctx context.Context, cfg Config) (*pgxpool.Pool, error) {
 	poolCfg, err := pgxpool.ParseConfig(cfg.URI)
 	if err != nil {
@@ -42,6 +43,7 @@ func Connect(ctx context.Context, cfg Config) (*pgxpool.Pool, error) {
 	poolCfg.MinConns = cfg.MinConns
 	poolCfg.MaxConnLifetime = cfg.ConnMaxLifetime
 	poolCfg.MaxConnIdleTime = cfg.ConnMaxIdleTime
+	poolCfg.ConnConfig.Tracer = NewQueryTracer(nil)
 
 	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
 	if err != nil {
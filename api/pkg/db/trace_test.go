@@ -0,0 +1,48 @@
+package db_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"workflow-code-test/api/pkg/db"
+)
+
+func TestQueryTracer(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		sql        string
+		err        error
+		wantName   string
+		wantStatus codes.Code
+	}{
+		{name: "query", sql: "\n        SELECT id FROM workflows WHERE id = $1", wantName: "SELECT", wantStatus: codes.Unset},
+		{name: "no rows is not an error", sql: "select 1", err: pgx.ErrNoRows, wantName: "SELECT", wantStatus: codes.Unset},
+		{name: "failed query", sql: "INSERT INTO runs VALUES ($1)", err: errors.New("duplicate key"), wantName: "INSERT", wantStatus: codes.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			rec := tracetest.NewSpanRecorder()
+			tracer := db.NewQueryTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+
+			ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: tt.sql})
+			tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: tt.err})
+
+			spans := rec.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("expected 1 span, got %d", len(spans))
+			}
+			if spans[0].Name() != tt.wantName || spans[0].Status().Code != tt.wantStatus {
+				t.Errorf("expected span %q with status %v, got %q with %v", tt.wantName, tt.wantStatus, spans[0].Name(), spans[0].Status().Code)
+			}
+		})
+	}
+}
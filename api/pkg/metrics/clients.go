@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"workflow-code-test/api/pkg/clients/email"
+	"workflow-code-test/api/pkg/clients/flood"
+	"workflow-code-test/api/pkg/clients/sms"
+	"workflow-code-test/api/pkg/clients/weather"
+)
+
+// Weather wraps c so each call is recorded under client="weather". A nil
+// *Metrics returns c unchanged.
+func (m *Metrics) Weather(c weather.Client) weather.Client {
+	if m == nil || c == nil {
+		return c
+	}
+	return timedWeather{c, m}
+}
+
+// Flood wraps c so each call is recorded under client="flood".
+func (m *Metrics) Flood(c flood.Client) flood.Client {
+	if m == nil || c == nil {
+		return c
+	}
+	return timedFlood{c, m}
+}
+
+// Email wraps c so each call is recorded under client="email".
+func (m *Metrics) Email(c email.Client) email.Client {
+	if m == nil || c == nil {
+		return c
+	}
+	return timedEmail{c, m}
+}
+
+// SMS wraps c so each call is recorded under client="sms".
+func (m *Metrics) SMS(c sms.Client) sms.Client {
+	if m == nil || c == nil {
+		return c
+	}
+	return timedSMS{c, m}
+}
+
+type timedWeather struct {
+	next weather.Client
+	m    *Metrics
+}
+
+func (c timedWeather) GetTemperature(ctx context.Context, lat, lon float64) (float64, error) {
+	start := time.Now()
+	t, err := c.next.GetTemperature(ctx, lat, lon)
+	c.m.ObserveClient("weather", err, time.Since(start))
+	return t, err
+}
+
+type timedFlood struct {
+	next flood.Client
+	m    *Metrics
+}
+
+func (c timedFlood) GetFloodRisk(ctx context.Context, lat, lon float64) (*flood.Result, error) {
+	start := time.Now()
+	res, err := c.next.GetFloodRisk(ctx, lat, lon)
+	c.m.ObserveClient("flood", err, time.Since(start))
+	return res, err
+}
+
+type timedEmail struct {
+	next email.Client
+	m    *Metrics
+}
+
+func (c timedEmail) Send(ctx context.Context, msg email.Message) (*email.Result, error) {
+	start := time.Now()
+	res, err := c.next.Send(ctx, msg)
+	c.m.ObserveClient("email", err, time.Since(start))
+	return res, err
+}
+
+type timedSMS struct {
+	next sms.Client
+	m    *Metrics
+}
+
+func (c timedSMS) Send(ctx context.Context, msg sms.Message) (*sms.Result, error) {
+	start := time.Now()
+	res, err := c.next.Send(ctx, msg)
+	c.m.ObserveClient("sms", err, time.Since(start))
+	return res, err
+}
@@ -0,0 +1,276 @@
+// Package metrics exports Prometheus metrics for workflow runs, node
+// executions, outbound clients, HTTP handlers, execution limits and the run
+// retention job.
+//
+// Every label has a bounded set of values: statuses, node types and client
+// names come from the code, routes are mux path templates rather than
+// paths, and workflow IDs are capped at maxWorkflowLabels distinct values.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "workflow"
+
+	// maxWorkflowLabels caps how many workflow IDs get their own series.
+	// Runs of further workflows are counted under OtherWorkflow.
+	maxWorkflowLabels = 200
+
+	// OtherWorkflow is the workflow_id label of runs past the cap.
+	OtherWorkflow = "other"
+)
+
+// Metrics holds the collectors served on /metrics. A nil *Metrics is valid
+// and records nothing, so callers do not need to check for one.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	runs           *prometheus.CounterVec
+	runDuration    *prometheus.HistogramVec
+	nodeDuration   *prometheus.HistogramVec
+	nodeErrors     *prometheus.CounterVec
+	clientDuration *prometheus.HistogramVec
+	httpDuration   *prometheus.HistogramVec
+	limited        *prometheus.CounterVec
+
+	prunedRuns        prometheus.Counter
+	archivedRuns      prometheus.Counter
+	retentionPasses   *prometheus.CounterVec
+	retentionDuration prometheus.Histogram
+	retentionLastOK   prometheus.Gauge
+
+	mu        sync.Mutex
+	workflows map[string]bool // workflow IDs with their own series
+}
+
+// New creates a Metrics with its own registry, which also exports the Go
+// runtime and process collectors.
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "runs_total",
+			Help:      "Workflow runs by workflow, final status and mode. A run that waits on a task or timer counts once per resumption.",
+		}, []string{"workflow_id", "status", "mode"}),
+		runDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "run_duration_seconds",
+			Help:      "Time spent executing a workflow run, by final status.",
+			Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"status"}),
+		nodeDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "node_duration_seconds",
+			Help:      "Time spent executing a node, by node type and step status.",
+			Buckets:   []float64{.001, .005, .01, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, []string{"node_type", "status"}),
+		nodeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "node_errors_total",
+			Help:      "Nodes that failed, by node type.",
+		}, []string{"node_type"}),
+		clientDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "client_request_duration_seconds",
+			Help:      "Latency of outbound client calls, by client and outcome (ok or error).",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"client", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests, by route template, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "code"}),
+		limited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "executions_limited_total",
+			Help:      "Executions refused with 429, by the scope of the limit (global, api_key or workflow) and its kind (rate or concurrency).",
+		}, []string{"scope", "limit"}),
+		prunedRuns: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "retention_runs_pruned_total",
+			Help:      "Runs deleted by the retention job.",
+		}),
+		archivedRuns: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "retention_runs_archived_total",
+			Help:      "Runs written to the archive by the retention job before deletion.",
+		}),
+		retentionPasses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "retention_passes_total",
+			Help:      "Passes of the retention job over every workflow, by outcome (ok or error).",
+		}, []string{"status"}),
+		retentionDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "retention_pass_duration_seconds",
+			Help:      "Time a pass of the retention job took.",
+			Buckets:   []float64{.01, .1, .5, 1, 5, 10, 30, 60, 300, 900},
+		}),
+		retentionLastOK: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "retention_last_success_timestamp_seconds",
+			Help:      "Unix time the last retention pass finished without errors.",
+		}),
+		workflows: make(map[string]bool),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.runs, m.runDuration, m.nodeDuration, m.nodeErrors, m.clientDuration, m.httpDuration, m.limited,
+		m.prunedRuns, m.archivedRuns, m.retentionPasses, m.retentionDuration, m.retentionLastOK,
+	)
+	return m
+}
+
+// Register adds further collectors, e.g. the database pool's, to the
+// registry served by Handler.
+func (m *Metrics) Register(cs ...prometheus.Collector) error {
+	for _, c := range cs {
+		if err := m.registry.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler serves the registry in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// ObserveRun records a finished or suspended run. mode is "live" or
+// "dry-run".
+func (m *Metrics) ObserveRun(workflowID, status, mode string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.runs.WithLabelValues(m.workflowLabel(workflowID), status, mode).Inc()
+	m.runDuration.WithLabelValues(status).Observe(d.Seconds())
+}
+
+// ObserveNode records one executed node. A node with status "error" is
+// also counted in node_errors_total.
+func (m *Metrics) ObserveNode(nodeType, status string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.nodeDuration.WithLabelValues(nodeType, status).Observe(d.Seconds())
+	if status == "error" {
+		m.nodeErrors.WithLabelValues(nodeType).Inc()
+	}
+}
+
+// ObserveClient records one outbound client call.
+func (m *Metrics) ObserveClient(client string, err error, d time.Duration) {
+	if m == nil {
+		return
+	}
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	m.clientDuration.WithLabelValues(client, status).Observe(d.Seconds())
+}
+
+// ObserveLimited records an execution refused by a limit of scope; limit
+// is "rate" or "concurrency".
+func (m *Metrics) ObserveLimited(scope, limit string) {
+	if m == nil {
+		return
+	}
+	m.limited.WithLabelValues(scope, limit).Inc()
+}
+
+// ObservePruned records a batch of runs deleted by the retention job, of
+// which archived were archived first.
+func (m *Metrics) ObservePruned(pruned, archived int) {
+	if m == nil {
+		return
+	}
+	m.prunedRuns.Add(float64(pruned))
+	m.archivedRuns.Add(float64(archived))
+}
+
+// ObserveRetentionPass records a pass of the retention job that finished
+// at end after d, failing with err if not nil.
+func (m *Metrics) ObserveRetentionPass(err error, end time.Time, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.retentionDuration.Observe(d.Seconds())
+	if err != nil {
+		m.retentionPasses.WithLabelValues("error").Inc()
+		return
+	}
+	m.retentionPasses.WithLabelValues("ok").Inc()
+	m.retentionLastOK.Set(float64(end.Unix()))
+}
+
+// workflowLabel returns id until maxWorkflowLabels workflows have their
+// own series, and OtherWorkflow for workflows seen after that.
+func (m *Metrics) workflowLabel(id string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.workflows[id] {
+		return id
+	}
+	if len(m.workflows) >= maxWorkflowLabels {
+		return OtherWorkflow
+	}
+	m.workflows[id] = true
+	return id
+}
+
+// Middleware records the latency of every request a mux router matched,
+// labelled with the route's path template rather than the path, so IDs in
+// URLs do not create new series.
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		route := "unknown"
+		if cur := mux.CurrentRoute(r); cur != nil {
+			if tpl, err := cur.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		m.httpDuration.WithLabelValues(route, r.Method, strconv.Itoa(sw.code)).Observe(time.Since(start).Seconds())
+	})
+}
+
+// statusWriter remembers the status code a handler wrote.
+type statusWriter struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.code, w.wroteHeader = code, true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
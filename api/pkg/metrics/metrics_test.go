@@ -0,0 +1,193 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"workflow-code-test/api/pkg/clients/email"
+	"workflow-code-test/api/pkg/clients/weather"
+	"workflow-code-test/api/pkg/metrics"
+)
+
+// scrape returns the /metrics page of m.
+func scrape(t *testing.T, m *metrics.Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	return rec.Body.String()
+}
+
+func TestMetrics_RunsAndNodes(t *testing.T) {
+	t.Parallel()
+	m := metrics.New()
+
+	m.ObserveRun("wf-1", "completed", "live", 120*time.Millisecond)
+	m.ObserveRun("wf-1", "failed", "dry-run", time.Second)
+	m.ObserveNode("integration", "completed", 40*time.Millisecond)
+	m.ObserveNode("integration", "error", 10*time.Millisecond)
+
+	page := scrape(t, m)
+	for _, want := range []string{
+		`workflow_runs_total{mode="live",status="completed",workflow_id="wf-1"} 1`,
+		`workflow_runs_total{mode="dry-run",status="failed",workflow_id="wf-1"} 1`,
+		`workflow_run_duration_seconds_count{status="completed"} 1`,
+		`workflow_node_duration_seconds_count{node_type="integration",status="completed"} 1`,
+		`workflow_node_errors_total{node_type="integration"} 1`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("expected %s in:\n%s", want, page)
+		}
+	}
+}
+
+func TestMetrics_Retention(t *testing.T) {
+	t.Parallel()
+	m := metrics.New()
+
+	end := time.Unix(1767258000, 0)
+	m.ObservePruned(500, 500)
+	m.ObservePruned(20, 0)
+	m.ObserveRetentionPass(nil, end, 3*time.Second)
+	m.ObserveRetentionPass(errors.New("disk full"), end.Add(time.Hour), time.Second)
+
+	page := scrape(t, m)
+	for _, want := range []string{
+		`workflow_retention_runs_pruned_total 520`,
+		`workflow_retention_runs_archived_total 500`,
+		`workflow_retention_passes_total{status="ok"} 1`,
+		`workflow_retention_passes_total{status="error"} 1`,
+		`workflow_retention_pass_duration_seconds_count 2`,
+		`workflow_retention_last_success_timestamp_seconds 1.767258e+09`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("expected %s in:\n%s", want, page)
+		}
+	}
+}
+
+func TestMetrics_Limited(t *testing.T) {
+	t.Parallel()
+	m := metrics.New()
+
+	m.ObserveLimited("api_key", "rate")
+	m.ObserveLimited("api_key", "rate")
+	m.ObserveLimited("global", "concurrency")
+
+	page := scrape(t, m)
+	for _, want := range []string{
+		`workflow_executions_limited_total{limit="rate",scope="api_key"} 2`,
+		`workflow_executions_limited_total{limit="concurrency",scope="global"} 1`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("expected %s in:\n%s", want, page)
+		}
+	}
+}
+
+func TestMetrics_WorkflowLabelsAreCapped(t *testing.T) {
+	t.Parallel()
+	m := metrics.New()
+
+	for i := range 250 {
+		m.ObserveRun(fmt.Sprintf("wf-%d", i), "completed", "live", time.Millisecond)
+	}
+	m.ObserveRun("wf-0", "completed", "live", time.Millisecond)
+
+	page := scrape(t, m)
+	if n := strings.Count(page, "workflow_runs_total{"); n != 201 {
+		t.Errorf("expected 200 workflows plus %q, got %d series", metrics.OtherWorkflow, n)
+	}
+	if !strings.Contains(page, `workflow_id="other"} 50`) {
+		t.Errorf("expected the 50 workflows past the cap under %q", metrics.OtherWorkflow)
+	}
+	if !strings.Contains(page, `workflow_id="wf-0"} 2`) {
+		t.Error("expected a workflow seen before the cap to keep its series")
+	}
+}
+
+func TestMetrics_Middleware(t *testing.T) {
+	t.Parallel()
+	m := metrics.New()
+	router := mux.NewRouter()
+	router.Use(m.Middleware)
+	router.HandleFunc("/workflows/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["id"] == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("{}"))
+	}).Methods("GET")
+
+	for _, path := range []string{"/workflows/a", "/workflows/b", "/workflows/missing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	page := scrape(t, m)
+	for _, want := range []string{
+		`workflow_http_request_duration_seconds_count{code="200",method="GET",route="/workflows/{id}"} 2`,
+		`workflow_http_request_duration_seconds_count{code="404",method="GET",route="/workflows/{id}"} 1`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("expected %s in:\n%s", want, page)
+		}
+	}
+}
+
+type failingEmail struct{}
+
+func (failingEmail) Send(context.Context, email.Message) (*email.Result, error) {
+	return nil, errors.New("smtp down")
+}
+
+func TestMetrics_Clients(t *testing.T) {
+	t.Parallel()
+	m := metrics.New()
+	ctx := context.Background()
+
+	if _, err := m.Weather(weather.NewStubClient(20)).GetTemperature(ctx, 1, 2); err != nil {
+		t.Fatalf("GetTemperature: %v", err)
+	}
+	if _, err := m.Email(failingEmail{}).Send(ctx, email.Message{}); err == nil {
+		t.Fatal("expected the wrapped client's error")
+	}
+
+	page := scrape(t, m)
+	for _, want := range []string{
+		`workflow_client_request_duration_seconds_count{client="weather",status="ok"} 1`,
+		`workflow_client_request_duration_seconds_count{client="email",status="error"} 1`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("expected %s in:\n%s", want, page)
+		}
+	}
+}
+
+func TestMetrics_Nil(t *testing.T) {
+	t.Parallel()
+	var m *metrics.Metrics
+
+	m.ObserveRun("wf-1", "completed", "live", time.Second)
+	m.ObserveNode("form", "completed", time.Second)
+	m.ObserveLimited("workflow", "rate")
+	client := weather.NewStubClient(20)
+	if got := m.Weather(client); got != client {
+		t.Error("expected a nil Metrics to return the client unchanged")
+	}
+	rec := httptest.NewRecorder()
+	m.Middleware(http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected the handler to run, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,206 @@
+// Package redact masks personal data in what leaves the process through
+// API responses, stored runs and logs: email addresses and phone numbers
+// wherever they appear, and the values a workflow marks as sensitive.
+// Masking is idempotent, so masked text can be masked again unchanged.
+package redact
+
+import (
+	"encoding/json"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Mask replaces a sensitive value.
+const Mask = "***"
+
+// minValue is the shortest sensitive value masked inside text; shorter
+// ones would mangle unrelated words. Values under a sensitive key are
+// masked whatever their length.
+const minValue = 3
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	// phonePattern matches international numbers (+61412345678), local
+	// mobile numbers (0412345678) and numbers grouped by spaces, dots or
+	// dashes ((02) 9876 5432, 555-123-4567). Ungrouped digit runs, dates
+	// and decimals are left alone.
+	phonePattern = regexp.MustCompile(`\+\d{8,15}\b|\b0\d{9}\b|(?:\+\d{1,3}[\s.-]?)?(?:\(\d{2,4}\)|\b\d{2,4})[\s.-]\d{3,4}[\s.-]?\d{3,4}\b`)
+)
+
+// Email masks an email address, keeping its first character and domain:
+// a***@example.com.
+func Email(addr string) string {
+	local, domain, ok := strings.Cut(addr, "@")
+	if !ok || local == "" {
+		return Mask
+	}
+	return local[:1] + Mask + "@" + domain
+}
+
+// Phone masks a phone number, keeping its last four digits: ***5678.
+func Phone(number string) string {
+	var digits []byte
+	for i := 0; i < len(number); i++ {
+		if number[i] >= '0' && number[i] <= '9' {
+			digits = append(digits, number[i])
+		}
+	}
+	if len(digits) <= 4 {
+		return Mask
+	}
+	return Mask + string(digits[len(digits)-4:])
+}
+
+// Text masks every email address and phone number in s. Digit groups
+// joined to a longer token by a dash, such as the segments of a UUID, are
+// not taken for phone numbers.
+func Text(s string) string {
+	s = emailPattern.ReplaceAllStringFunc(s, Email)
+	matches := phonePattern.FindAllStringIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if (start > 0 && s[start-1] == '-') || (end < len(s) && s[end] == '-') {
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(Phone(s[start:end]))
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// ReplaceAttr masks the email addresses and phone numbers in string and
+// error attributes, for slog.HandlerOptions.
+func ReplaceAttr(_ []string, a slog.Attr) slog.Attr {
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(Text(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			a.Value = slog.StringValue(Text(err.Error()))
+		}
+	}
+	return a
+}
+
+// Masker masks the sensitive variables of a run: values under their names
+// become Mask, their values are masked wherever else they appear, and so
+// are email addresses and phone numbers. A nil Masker only masks email
+// addresses and phone numbers.
+type Masker struct {
+	names  map[string]bool
+	values *strings.Replacer
+}
+
+// NewMasker returns a Masker for the variables names and the values they
+// held.
+func NewMasker(names, values []string) *Masker {
+	m := &Masker{names: make(map[string]bool, len(names))}
+	for _, n := range names {
+		m.names[n] = true
+	}
+	var olds []string
+	seen := make(map[string]bool)
+	for _, v := range values {
+		if len(v) >= minValue && !seen[v] {
+			seen[v] = true
+			olds = append(olds, v)
+		}
+	}
+	// strings.Replacer tries the values in order, so a value containing
+	// another is masked whole.
+	sort.Slice(olds, func(i, j int) bool { return len(olds[i]) > len(olds[j]) })
+	if len(olds) > 0 {
+		args := make([]string, 0, 2*len(olds))
+		for _, v := range olds {
+			args = append(args, v, Mask)
+		}
+		m.values = strings.NewReplacer(args...)
+	}
+	return m
+}
+
+// Sensitive reports whether name is one of the masked variables.
+func (m *Masker) Sensitive(name string) bool {
+	return m != nil && m.names[name]
+}
+
+// String masks the sensitive values, email addresses and phone numbers in s.
+func (m *Masker) String(s string) string {
+	if m != nil && m.values != nil {
+		s = m.values.Replace(s)
+	}
+	return Text(s)
+}
+
+// Value returns a masked copy of a decoded JSON value: strings are masked,
+// and entries of maps whose key is a sensitive name are replaced by Mask.
+func (m *Masker) Value(v any) any {
+	switch v := v.(type) {
+	case string:
+		return m.String(v)
+	case map[string]any:
+		return m.Map(v)
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = m.Value(e)
+		}
+		return out
+	case []string:
+		out := make([]string, len(v))
+		for i, e := range v {
+			out[i] = m.String(e)
+		}
+		return out
+	case []map[string]any:
+		out := make([]map[string]any, len(v))
+		for i, e := range v {
+			out[i] = m.Map(e)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// Map returns a masked copy of vars, or nil for nil.
+func (m *Masker) Map(vars map[string]any) map[string]any {
+	if vars == nil {
+		return nil
+	}
+	out := make(map[string]any, len(vars))
+	for k, v := range vars {
+		if m.Sensitive(k) && v != nil {
+			out[k] = Mask
+			continue
+		}
+		out[k] = m.Value(v)
+	}
+	return out
+}
+
+// JSON masks a JSON document. Text that is not valid JSON is masked as a
+// string.
+func (m *Masker) JSON(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 {
+		return raw
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return json.RawMessage(m.String(string(raw)))
+	}
+	out, err := json.Marshal(m.Value(v))
+	if err != nil {
+		return raw
+	}
+	return out
+}
@@ -0,0 +1,102 @@
+package redact_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+
+	"workflow-code-test/api/pkg/redact"
+)
+
+func TestText(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"email", "send to alice@example.com now", "send to a***@example.com now"},
+		{"international phone", "call +61412345678", "call ***5678"},
+		{"local mobile", "call 0412345678.", "call ***5678."},
+		{"grouped phone", "call (02) 9876 5432 or 555-123-4567", "call ***5432 or ***4567"},
+		{"already masked", "a***@example.com and ***5678", "a***@example.com and ***5678"},
+		{"date", "on 2026-10-18T12:30:45Z", "on 2026-10-18T12:30:45Z"},
+		{"uuid", "run 12345678-1234-5678-1234-567812345678", "run 12345678-1234-5678-1234-567812345678"},
+		{"decimal", "temperature 31.5, threshold 25", "temperature 31.5, threshold 25"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := redact.Text(tt.in); got != tt.want {
+				t.Errorf("Text(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMasker(t *testing.T) {
+	t.Parallel()
+	m := redact.NewMasker([]string{"name", "phone"}, []string{"Alice Smith", "Al", "+61400000000"})
+
+	got := m.Map(map[string]any{
+		"name":    "Alice Smith",
+		"phone":   12,
+		"message": "Hello Alice Smith, we will call +61400000000",
+		"contact": map[string]any{"name": "Al", "email": "al@example.com"},
+		"tags":    []any{"Alice Smith", "Al"},
+		"count":   3.0,
+	})
+	want := map[string]any{
+		"name":    redact.Mask,
+		"phone":   redact.Mask,
+		"message": "Hello ***, we will call ***",
+		"contact": map[string]any{"name": redact.Mask, "email": "a***@example.com"},
+		"tags":    []any{redact.Mask, "Al"},
+		"count":   3.0,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	raw := m.JSON(json.RawMessage(`{"to":"al@example.com","body":"Hi Alice Smith"}`))
+	if string(raw) != `{"body":"Hi ***","to":"a***@example.com"}` {
+		t.Errorf("unexpected masked JSON %s", raw)
+	}
+	if got := m.JSON(json.RawMessage("not json Alice Smith")); string(got) != "not json ***" {
+		t.Errorf("expected text that is not JSON to be masked as a string, got %s", got)
+	}
+}
+
+func TestMasker_Nil(t *testing.T) {
+	t.Parallel()
+	var m *redact.Masker
+	if m.Sensitive("name") {
+		t.Error("expected a nil Masker to mark nothing sensitive")
+	}
+	got := m.Map(map[string]any{"name": "Alice", "email": "alice@example.com"})
+	if got["name"] != "Alice" || got["email"] != "a***@example.com" {
+		t.Errorf("expected only the email masked, got %v", got)
+	}
+}
+
+func TestReplaceAttr(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{ReplaceAttr: redact.ReplaceAttr}))
+
+	logger.Info("sending", "to", "alice@example.com", "error", errors.New("no route to +61412345678"), "count", 12345678901)
+
+	out := buf.String()
+	for _, leaked := range []string{"alice@example.com", "+61412345678"} {
+		if strings.Contains(out, leaked) {
+			t.Errorf("expected %q masked, got %s", leaked, out)
+		}
+	}
+	if !strings.Contains(out, `"to":"a***@example.com"`) || !strings.Contains(out, `"error":"no route to ***5678"`) || !strings.Contains(out, `"count":12345678901`) {
+		t.Errorf("unexpected log line %s", out)
+	}
+}
@@ -0,0 +1,104 @@
+// Package tracing sets up OpenTelemetry tracing: the global tracer
+// provider and W3C trace context propagation, server spans for HTTP
+// handlers and client spans for outbound HTTP calls.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultServiceName is the service.name of exported spans unless
+// OTEL_SERVICE_NAME or OTEL_RESOURCE_ATTRIBUTES sets one.
+const DefaultServiceName = "workflow-api"
+
+// Setup installs the W3C trace context and baggage propagators and, when an
+// OTLP endpoint is configured, a tracer provider that exports spans over
+// OTLP/HTTP. The exporter reads the standard variables
+// (OTEL_EXPORTER_OTLP_ENDPOINT, OTEL_EXPORTER_OTLP_TRACES_ENDPOINT,
+// OTEL_EXPORTER_OTLP_HEADERS, ...) and the sampler OTEL_TRACES_SAMPLER.
+//
+// Without an endpoint, or with OTEL_SDK_DISABLED=true or
+// OTEL_TRACES_EXPORTER=none, the global provider stays a no-op. The
+// returned function flushes pending spans and stops the exporter.
+func Setup(ctx context.Context, getenv func(string) string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	noop := func(context.Context) error { return nil }
+	if !enabled(getenv) {
+		return noop, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return noop, fmt.Errorf("create OTLP trace exporter: %w", err)
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", DefaultServiceName)),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return noop, fmt.Errorf("create trace resource: %w", err)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// enabled reports whether the environment asks for spans to be exported.
+func enabled(getenv func(string) string) bool {
+	if strings.EqualFold(getenv("OTEL_SDK_DISABLED"), "true") || getenv("OTEL_TRACES_EXPORTER") == "none" {
+		return false
+	}
+	return getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// Middleware starts a server span for every request a mux router matched,
+// continuing the trace of an incoming traceparent header. Spans are named
+// after the route template, e.g. "POST /api/v1/workflows/{id}/execute".
+func Middleware(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route := routeTemplate(r); route != "" {
+			trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("http.route", route))
+		}
+		next.ServeHTTP(w, r)
+	}), "http.server", otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		if route := routeTemplate(r); route != "" {
+			return r.Method + " " + route
+		}
+		return r.Method
+	}))
+}
+
+func routeTemplate(r *http.Request) string {
+	if cur := mux.CurrentRoute(r); cur != nil {
+		if tpl, err := cur.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	return ""
+}
+
+// Transport wraps base (http.DefaultTransport if nil) so every outbound
+// request gets a client span and carries the W3C traceparent header.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return otelhttp.NewTransport(base)
+}
@@ -0,0 +1,131 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"workflow-code-test/api/pkg/tracing"
+)
+
+// These tests replace the global tracer provider, so they do not run in
+// parallel.
+
+func env(vars map[string]string) func(string) string {
+	return func(k string) string { return vars[k] }
+}
+
+func TestSetup(t *testing.T) {
+	t.Cleanup(restoreProvider(otel.GetTracerProvider()))
+
+	tests := []struct {
+		name       string
+		env        map[string]string
+		wantExport bool
+	}{
+		{name: "no-op without an endpoint", env: nil},
+		{name: "endpoint exports spans", env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://127.0.0.1:4318"}, wantExport: true},
+		{name: "traces endpoint exports spans", env: map[string]string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://127.0.0.1:4318/v1/traces"}, wantExport: true},
+		{name: "exporter none", env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://127.0.0.1:4318", "OTEL_TRACES_EXPORTER": "none"}},
+		{name: "sdk disabled", env: map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://127.0.0.1:4318", "OTEL_SDK_DISABLED": "true"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := otel.GetTracerProvider()
+			shutdown, err := tracing.Setup(context.Background(), env(tt.env))
+			if err != nil {
+				t.Fatalf("Setup: %v", err)
+			}
+			defer shutdown(context.Background())
+
+			if installed := otel.GetTracerProvider() != before; installed != tt.wantExport {
+				t.Errorf("expected an exporting provider to be installed: %v, got %v", tt.wantExport, installed)
+			}
+			if fields := otel.GetTextMapPropagator().Fields(); !slices.Contains(fields, "traceparent") {
+				t.Errorf("expected the W3C propagator, got fields %v", fields)
+			}
+		})
+	}
+}
+
+func TestMiddlewareAndTransport(t *testing.T) {
+	t.Cleanup(restoreProvider(otel.GetTracerProvider()))
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	if _, err := tracing.Setup(context.Background(), env(nil)); err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+
+	var gotParent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotParent = r.Header.Get("traceparent")
+	}))
+	defer upstream.Close()
+	client := &http.Client{Transport: tracing.Transport(nil)}
+
+	router := mux.NewRouter()
+	router.Use(tracing.Middleware)
+	router.HandleFunc("/things/{id}", func(w http.ResponseWriter, r *http.Request) {
+		req, _ := http.NewRequestWithContext(r.Context(), http.MethodGet, upstream.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Errorf("upstream call: %v", err)
+			return
+		}
+		resp.Body.Close()
+	}).Methods("GET")
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/things/42", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := rec.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected a server and a client span, got %d", len(spans))
+	}
+	client1, server := spans[0], spans[1]
+	if server.Name() != "GET /things/{id}" || server.SpanKind() != trace.SpanKindServer {
+		t.Errorf("expected server span %q, got %q (%v)", "GET /things/{id}", server.Name(), server.SpanKind())
+	}
+	if !hasAttr(server.Attributes(), attribute.String("http.route", "/things/{id}")) {
+		t.Errorf("expected the http.route attribute, got %v", server.Attributes())
+	}
+	if server.SpanContext().TraceID().String() != traceID {
+		t.Errorf("expected the incoming trace to continue, got %s", server.SpanContext().TraceID())
+	}
+	if client1.SpanKind() != trace.SpanKindClient || client1.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("expected a client span under the server span, got %v under %v", client1.SpanKind(), client1.Parent().SpanID())
+	}
+	if want := "00-" + traceID + "-" + client1.SpanContext().SpanID().String() + "-01"; gotParent != want {
+		t.Errorf("expected traceparent %q upstream, got %q", want, gotParent)
+	}
+}
+
+// restoreProvider returns a cleanup that puts prev back as the global
+// tracer provider if a test replaced it.
+func restoreProvider(prev trace.TracerProvider) func() {
+	return func() {
+		if otel.GetTracerProvider() != prev {
+			otel.SetTracerProvider(prev)
+		}
+	}
+}
+
+func hasAttr(attrs []attribute.KeyValue, want attribute.KeyValue) bool {
+	for _, a := range attrs {
+		if a == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// APIKeyPrefix starts every API key, telling keys apart from JWTs.
+const APIKeyPrefix = "wfk_"
+
+// GenerateAPIKey returns a new API key and its prefix. Keys have the form
+// wfk_<12 hex chars>_<secret>; the part before the second underscore is
+// the prefix keys are stored and looked up by.
+func GenerateAPIKey() (key, prefix string, err error) {
+	id := make([]byte, 6)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", fmt.Errorf("generate api key: %w", err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", fmt.Errorf("generate api key: %w", err)
+	}
+	prefix = APIKeyPrefix + hex.EncodeToString(id)
+	return prefix + "_" + base64.RawURLEncoding.EncodeToString(secret), prefix, nil
+}
+
+// HashAPIKey returns the hex SHA-256 hash of key, as stored. Keys carry 256
+// random bits, so a fast unsalted hash is enough.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// MatchAPIKey reports whether key hashes to hash, in constant time.
+func MatchAPIKey(key, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashAPIKey(key)), []byte(hash)) == 1
+}
+
+// ParseAPIKey returns the prefix of key, or false if key is not of the
+// form wfk_<12 hex>_<secret>.
+func ParseAPIKey(key string) (string, bool) {
+	rest, found := strings.CutPrefix(key, APIKeyPrefix)
+	prefix, secret, ok := strings.Cut(rest, "_")
+	if !found || !ok || len(prefix) != 12 || secret == "" {
+		return "", false
+	}
+	if _, err := hex.DecodeString(prefix); err != nil {
+		return "", false
+	}
+	return APIKeyPrefix + prefix, true
+}
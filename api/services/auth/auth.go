@@ -0,0 +1,159 @@
+// Package auth authenticates API callers by API key or JWT and orders the
+// roles routes are authorized by. It is independent of HTTP routing: the
+// workflow service decides which role each route needs.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"workflow-code-test/api/services/storage"
+)
+
+// Role grants access to a set of routes. Each role includes the ones
+// before it: viewers read, editors also change and run workflows,
+// publishers also publish them and admins also manage API keys.
+type Role string
+
+const (
+	RoleViewer    Role = "viewer"
+	RoleEditor    Role = "editor"
+	RolePublisher Role = "publisher"
+	RoleAdmin     Role = "admin"
+)
+
+var roleRank = map[Role]int{RoleViewer: 1, RoleEditor: 2, RolePublisher: 3, RoleAdmin: 4}
+
+// ParseRole returns the role named s.
+func ParseRole(s string) (Role, bool) {
+	r := Role(s)
+	_, ok := roleRank[r]
+	return r, ok
+}
+
+// Allows reports whether r includes required.
+func (r Role) Allows(required Role) bool {
+	return roleRank[r] > 0 && roleRank[r] >= roleRank[required]
+}
+
+// Authentication methods a Principal can come from.
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Subject string `json:"subject"` // api-key:<name> or the JWT's sub claim
+	Role    Role   `json:"role"`
+	Method  string `json:"method"`
+	// Workspace is the only workspace the principal may act in, or "" for
+	// every workspace.
+	Workspace string `json:"workspace,omitempty"`
+}
+
+// CanAccess reports whether p may act in workspace.
+func (p *Principal) CanAccess(workspace string) bool {
+	return p.Workspace == "" || p.Workspace == workspace
+}
+
+type contextKey struct{}
+
+// WithPrincipal returns ctx carrying p.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// PrincipalFrom returns the principal in ctx, or nil if the request was not
+// authenticated.
+func PrincipalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+	return p
+}
+
+var (
+	// ErrNoCredentials is returned by Authenticate when the request has no
+	// bearer token.
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials is returned by Authenticate for an unknown,
+	// revoked, expired or malformed token.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// KeyStore loads API keys by their public prefix.
+type KeyStore interface {
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*storage.APIKey, error)
+}
+
+// Authenticator verifies bearer tokens: API keys against a KeyStore and
+// JWTs against an HS256 secret or RS256 keys from a JWKS file.
+type Authenticator struct {
+	keys KeyStore
+	jwt  *jwtVerifier // nil rejects every JWT
+}
+
+// NewAuthenticator creates an Authenticator checking API keys in keys and
+// JWTs as configured by cfg. JWTs are rejected when cfg configures neither
+// a secret nor a JWKS file.
+func NewAuthenticator(keys KeyStore, cfg JWTConfig) (*Authenticator, error) {
+	if keys == nil {
+		return nil, fmt.Errorf("auth: key store cannot be nil")
+	}
+	v, err := newJWTVerifier(cfg, time.Now)
+	if err != nil {
+		return nil, err
+	}
+	return &Authenticator{keys: keys, jwt: v}, nil
+}
+
+// Authenticate returns the principal of an Authorization header value.
+// Tokens starting with APIKeyPrefix are API keys; any other bearer token is
+// verified as a JWT. Failures wrap ErrNoCredentials or
+// ErrInvalidCredentials.
+func (a *Authenticator) Authenticate(ctx context.Context, authorization string) (*Principal, error) {
+	scheme, token, ok := strings.Cut(strings.TrimSpace(authorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		if authorization == "" {
+			return nil, ErrNoCredentials
+		}
+		return nil, fmt.Errorf("%w: expected a bearer token", ErrInvalidCredentials)
+	}
+	token = strings.TrimSpace(token)
+	if strings.HasPrefix(token, APIKeyPrefix) {
+		return a.authenticateAPIKey(ctx, token)
+	}
+	if a.jwt == nil {
+		return nil, fmt.Errorf("%w: JWTs are not accepted", ErrInvalidCredentials)
+	}
+	return a.jwt.verify(token)
+}
+
+func (a *Authenticator) authenticateAPIKey(ctx context.Context, token string) (*Principal, error) {
+	prefix, ok := ParseAPIKey(token)
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed API key", ErrInvalidCredentials)
+	}
+	key, err := a.keys.GetAPIKeyByPrefix(ctx, prefix)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w: unknown API key", ErrInvalidCredentials)
+		}
+		return nil, fmt.Errorf("load api key: %w", err)
+	}
+	if !MatchAPIKey(token, key.KeyHash) {
+		return nil, fmt.Errorf("%w: unknown API key", ErrInvalidCredentials)
+	}
+	if key.RevokedAt != nil {
+		return nil, fmt.Errorf("%w: API key %s is revoked", ErrInvalidCredentials, key.Prefix)
+	}
+	role, ok := ParseRole(key.Role)
+	if !ok {
+		return nil, fmt.Errorf("%w: API key %s has unknown role %q", ErrInvalidCredentials, key.Prefix, key.Role)
+	}
+	return &Principal{Subject: "api-key:" + key.Name, Role: role, Method: MethodAPIKey, Workspace: key.WorkspaceID}, nil
+}
@@ -0,0 +1,167 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/services/auth"
+	"workflow-code-test/api/services/storage"
+)
+
+func TestRole_Allows(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		role, required auth.Role
+		want           bool
+	}{
+		{auth.RoleViewer, auth.RoleViewer, true},
+		{auth.RoleViewer, auth.RoleEditor, false},
+		{auth.RolePublisher, auth.RoleEditor, true},
+		{auth.RoleEditor, auth.RolePublisher, false},
+		{auth.RoleAdmin, auth.RolePublisher, true},
+		{auth.Role("owner"), auth.RoleViewer, false},
+	}
+	for _, tt := range tests {
+		if got := tt.role.Allows(tt.required); got != tt.want {
+			t.Errorf("%s.Allows(%s): expected %v, got %v", tt.role, tt.required, tt.want, got)
+		}
+	}
+}
+
+func TestParseAPIKey(t *testing.T) {
+	t.Parallel()
+	key, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("GenerateAPIKey: %v", err)
+	}
+	if got, ok := auth.ParseAPIKey(key); !ok || got != prefix {
+		t.Errorf("ParseAPIKey(%q): expected %q, got %q, %v", key, prefix, got, ok)
+	}
+	for _, key := range []string{"", "wfk_0123456789ab", "wfk_0123456789ab_", "wfk_0123_secret", "wfk_0123456789zz_secret", "xyz_0123456789ab_secret"} {
+		if got, ok := auth.ParseAPIKey(key); ok {
+			t.Errorf("ParseAPIKey(%q): expected malformed, got %q", key, got)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	store, err := storage.NewMemoryInstance(storage.Fixtures{})
+	if err != nil {
+		t.Fatalf("NewMemoryInstance: %v", err)
+	}
+	newKey := func(name, role string) string {
+		t.Helper()
+		key, prefix, err := auth.GenerateAPIKey()
+		if err != nil {
+			t.Fatalf("GenerateAPIKey: %v", err)
+		}
+		stored := &storage.APIKey{ID: uuid.New(), Name: name, Prefix: prefix, KeyHash: auth.HashAPIKey(key), Role: role}
+		if name == "team" {
+			stored.WorkspaceID = storage.DefaultWorkspaceID
+		}
+		if err := store.CreateAPIKey(ctx, stored); err != nil {
+			t.Fatalf("CreateAPIKey: %v", err)
+		}
+		if name == "revoked" {
+			store.RevokeAPIKey(ctx, stored.ID, time.Now())
+		}
+		return key
+	}
+	editorKey := newKey("ci", "editor")
+	revokedKey := newKey("revoked", "admin")
+	teamKey := newKey("team", "viewer")
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	jwks, _ := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "RSA", "kid": "k1", "use": "sig",
+		"n": base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+	}}})
+	if err := os.WriteFile(jwksFile, jwks, 0o600); err != nil {
+		t.Fatalf("write jwks: %v", err)
+	}
+
+	secret := []byte("test-secret")
+	a, err := auth.NewAuthenticator(store, auth.JWTConfig{HS256Secret: secret, JWKSFile: jwksFile, Issuer: "https://idp.example.com"})
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %v", err)
+	}
+
+	exp := jwt.NewNumericDate(time.Now().Add(time.Hour))
+	sign := func(method jwt.SigningMethod, key any, kid string, claims jwt.MapClaims) string {
+		t.Helper()
+		tok := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			tok.Header["kid"] = kid
+		}
+		s, err := tok.SignedString(key)
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return s
+	}
+	claims := func(extra jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{"sub": "alice", "iss": "https://idp.example.com", "exp": exp}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name      string
+		header    string
+		wantErr   error
+		wantPrinc auth.Principal
+	}{
+		{"api key", "Bearer " + editorKey, nil, auth.Principal{Subject: "api-key:ci", Role: auth.RoleEditor, Method: auth.MethodAPIKey}},
+		{"workspace api key", "Bearer " + teamKey, nil, auth.Principal{Subject: "api-key:team", Role: auth.RoleViewer, Method: auth.MethodAPIKey, Workspace: storage.DefaultWorkspaceID}},
+		{"revoked api key", "Bearer " + revokedKey, auth.ErrInvalidCredentials, auth.Principal{}},
+		{"wrong api key secret", "Bearer " + editorKey[:len(editorKey)-2] + "xx", auth.ErrInvalidCredentials, auth.Principal{}},
+		{"malformed api key", "Bearer wfk_nope", auth.ErrInvalidCredentials, auth.Principal{}},
+		{"no header", "", auth.ErrNoCredentials, auth.Principal{}},
+		{"basic auth", "Basic YWxpY2U6cHc=", auth.ErrInvalidCredentials, auth.Principal{}},
+		{"hs256", "Bearer " + sign(jwt.SigningMethodHS256, secret, "", claims(jwt.MapClaims{"role": "publisher"})), nil, auth.Principal{Subject: "alice", Role: auth.RolePublisher, Method: auth.MethodJWT}},
+		{"highest of roles", "Bearer " + sign(jwt.SigningMethodHS256, secret, "", claims(jwt.MapClaims{"roles": []string{"viewer", "admin", "unknown"}})), nil, auth.Principal{Subject: "alice", Role: auth.RoleAdmin, Method: auth.MethodJWT}},
+		{"workspace claim", "Bearer " + sign(jwt.SigningMethodHS256, secret, "", claims(jwt.MapClaims{"role": "editor", "workspace": "team-a"})), nil, auth.Principal{Subject: "alice", Role: auth.RoleEditor, Method: auth.MethodJWT, Workspace: "team-a"}},
+		{"invalid workspace claim", "Bearer " + sign(jwt.SigningMethodHS256, secret, "", claims(jwt.MapClaims{"role": "editor", "workspace": "Team A"})), auth.ErrInvalidCredentials, auth.Principal{}},
+		{"rs256 from jwks", "Bearer " + sign(jwt.SigningMethodRS256, rsaKey, "k1", claims(jwt.MapClaims{"role": "viewer"})), nil, auth.Principal{Subject: "alice", Role: auth.RoleViewer, Method: auth.MethodJWT}},
+		{"unknown kid", "Bearer " + sign(jwt.SigningMethodRS256, rsaKey, "k2", claims(jwt.MapClaims{"role": "viewer"})), auth.ErrInvalidCredentials, auth.Principal{}},
+		{"wrong secret", "Bearer " + sign(jwt.SigningMethodHS256, []byte("other"), "", claims(jwt.MapClaims{"role": "viewer"})), auth.ErrInvalidCredentials, auth.Principal{}},
+		{"expired", "Bearer " + sign(jwt.SigningMethodHS256, secret, "", claims(jwt.MapClaims{"role": "viewer", "exp": time.Now().Add(-time.Hour).Unix()})), auth.ErrInvalidCredentials, auth.Principal{}},
+		{"no expiry", "Bearer " + sign(jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"sub": "alice", "iss": "https://idp.example.com", "role": "viewer"}), auth.ErrInvalidCredentials, auth.Principal{}},
+		{"wrong issuer", "Bearer " + sign(jwt.SigningMethodHS256, secret, "", claims(jwt.MapClaims{"role": "viewer", "iss": "https://evil.example.com"})), auth.ErrInvalidCredentials, auth.Principal{}},
+		{"unknown role", "Bearer " + sign(jwt.SigningMethodHS256, secret, "", claims(jwt.MapClaims{"role": "owner"})), auth.ErrInvalidCredentials, auth.Principal{}},
+		{"alg none", "Bearer " + sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", claims(jwt.MapClaims{"role": "admin"})), auth.ErrInvalidCredentials, auth.Principal{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := a.Authenticate(ctx, tt.header)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && *got != tt.wantPrinc {
+				t.Errorf("expected %+v, got %+v", tt.wantPrinc, *got)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"workflow-code-test/api/services/storage"
+)
+
+// JWTConfig configures which JWTs are accepted. HS256 tokens are verified
+// with HS256Secret and RS256 tokens with the RSA keys of JWKSFile, matched
+// by the token's kid header. Issuer and Audience, when set, must match the
+// iss and aud claims.
+type JWTConfig struct {
+	HS256Secret []byte
+	JWKSFile    string
+	Issuer      string
+	Audience    string
+}
+
+// clockSkew is how far exp and nbf may be off from the local clock.
+const clockSkew = 30 * time.Second
+
+type jwtVerifier struct {
+	secret []byte
+	keys   map[string]*rsa.PublicKey // by kid
+	parser *jwt.Parser
+}
+
+// tokenClaims are the claims read from a JWT. The role is taken from role,
+// or else the highest known role in roles. A workspace claim binds the
+// token to one workspace.
+type tokenClaims struct {
+	Role      string   `json:"role"`
+	Roles     []string `json:"roles"`
+	Workspace string   `json:"workspace"`
+	jwt.RegisteredClaims
+}
+
+// newJWTVerifier returns nil when cfg accepts no tokens.
+func newJWTVerifier(cfg JWTConfig, now func() time.Time) (*jwtVerifier, error) {
+	v := &jwtVerifier{secret: cfg.HS256Secret}
+	var methods []string
+	if len(cfg.HS256Secret) > 0 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if cfg.JWKSFile != "" {
+		keys, err := LoadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = keys
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+	if len(methods) == 0 {
+		return nil, nil
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(clockSkew),
+		jwt.WithTimeFunc(now),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	v.parser = jwt.NewParser(opts...)
+	return v, nil
+}
+
+func (v *jwtVerifier) verify(token string) (*Principal, error) {
+	var claims tokenClaims
+	if _, err := v.parser.ParseWithClaims(token, &claims, v.key); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: token has no sub claim", ErrInvalidCredentials)
+	}
+	role, ok := claimedRole(claims)
+	if !ok {
+		return nil, fmt.Errorf("%w: token has no known role", ErrInvalidCredentials)
+	}
+	if claims.Workspace != "" && !storage.ValidWorkspaceID(claims.Workspace) {
+		return nil, fmt.Errorf("%w: token has an invalid workspace claim", ErrInvalidCredentials)
+	}
+	return &Principal{Subject: claims.Subject, Role: role, Method: MethodJWT, Workspace: claims.Workspace}, nil
+}
+
+// key returns the key a token's signature is checked with. The parser has
+// already restricted the algorithm to the configured ones.
+func (v *jwtVerifier) key(t *jwt.Token) (any, error) {
+	if _, ok := t.Method.(*jwt.SigningMethodHMAC); ok {
+		return v.secret, nil
+	}
+	kid, _ := t.Header["kid"].(string)
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key id %q", kid)
+}
+
+func claimedRole(c tokenClaims) (Role, bool) {
+	if c.Role != "" {
+		return ParseRole(c.Role)
+	}
+	var best Role
+	for _, name := range c.Roles {
+		if r, ok := ParseRole(name); ok && !best.Allows(r) {
+			best = r
+		}
+	}
+	return best, best != ""
+}
+
+// jwks is a JSON Web Key Set; only the fields of RSA keys are read.
+type jwks struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// LoadJWKS reads the RSA signing keys of a JWKS file, by kid. Keys of other
+// types or for encryption are skipped.
+func LoadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read jwks: %w", err)
+	}
+	var set jwks
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parse jwks %s: %w", path, err)
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for i, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("jwks %s: key %d: invalid n: %w", path, i, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("jwks %s: key %d: invalid e: %w", path, i, err)
+		}
+		exp := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("jwks %s: key %d: invalid modulus or exponent", path, i)
+		}
+		if _, dup := keys[k.Kid]; dup {
+			return nil, fmt.Errorf("jwks %s: duplicate key id %q", path, k.Kid)
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("jwks %s: no RSA signing keys", path)
+	}
+	return keys, nil
+}
@@ -0,0 +1,437 @@
+// Package bundle converts workflows to and from portable, self-contained
+// bundles that can be moved between environments. A bundle carries the
+// workflow graph together with every node library blueprint it uses, so it
+// can be imported into a database that has never seen those blueprints.
+package bundle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/services/storage"
+)
+
+const (
+	// APIVersion identifies the bundle schema. Bump it on breaking changes.
+	APIVersion = "workflow.bundle/v1"
+	// Kind is the only bundle kind currently supported.
+	Kind = "WorkflowBundle"
+)
+
+// Bundle is the portable representation of a workflow. Nodes reference
+// blueprints by key rather than embedding label, description and metadata,
+// so shared blueprints appear once.
+type Bundle struct {
+	APIVersion string      `json:"apiVersion" yaml:"apiVersion"`
+	Kind       string      `json:"kind" yaml:"kind"`
+	Source     *Source     `json:"source,omitempty" yaml:"source,omitempty"`
+	Workflow   Workflow    `json:"workflow" yaml:"workflow"`
+	Blueprints []Blueprint `json:"blueprints" yaml:"blueprints"`
+}
+
+// Source records where a bundle was exported from. It is informational and
+// ignored on import.
+type Source struct {
+	ExportedAt      time.Time `json:"exportedAt" yaml:"exportedAt"`
+	SnapshotVersion int       `json:"snapshotVersion,omitempty" yaml:"snapshotVersion,omitempty"`
+}
+
+// Workflow is the portable part of storage.Workflow. Status, timestamps and
+// the active snapshot are environment-specific and are not exported.
+type Workflow struct {
+	ID       uuid.UUID `json:"id" yaml:"id"`
+	Name     string    `json:"name" yaml:"name"`
+	Settings *Settings `json:"settings,omitempty" yaml:"settings,omitempty"` // nil when every setting is at its default
+	Nodes    []Node    `json:"nodes" yaml:"nodes"`
+	Edges    []Edge    `json:"edges" yaml:"edges"`
+}
+
+// Settings mirrors storage.WorkflowSettings.
+type Settings struct {
+	ScopedOutputsOnly  bool       `json:"scopedOutputsOnly,omitempty" yaml:"scopedOutputsOnly,omitempty"`
+	Retention          *Retention `json:"retention,omitempty" yaml:"retention,omitempty"`
+	SensitiveVariables []string   `json:"sensitiveVariables,omitempty" yaml:"sensitiveVariables,omitempty"`
+}
+
+// Retention mirrors storage.RetentionPolicy.
+type Retention struct {
+	Days       int `json:"days,omitempty" yaml:"days,omitempty"`
+	Runs       int `json:"runs,omitempty" yaml:"runs,omitempty"`
+	FailedDays int `json:"failedDays,omitempty" yaml:"failedDays,omitempty"`
+}
+
+// Node is a canvas instance pointing at a blueprint by its key.
+type Node struct {
+	ID        string   `json:"id" yaml:"id"`
+	Type      string   `json:"type" yaml:"type"`
+	Blueprint string   `json:"blueprint" yaml:"blueprint"`
+	Position  Position `json:"position" yaml:"position"`
+}
+
+type Position struct {
+	X float64 `json:"x" yaml:"x"`
+	Y float64 `json:"y" yaml:"y"`
+}
+
+// Edge mirrors storage.Edge.
+type Edge struct {
+	ID           string  `json:"id" yaml:"id"`
+	Source       string  `json:"source" yaml:"source"`
+	Target       string  `json:"target" yaml:"target"`
+	SourceHandle *string `json:"sourceHandle,omitempty" yaml:"sourceHandle,omitempty"`
+	Type         string  `json:"type" yaml:"type"`
+	Animated     bool    `json:"animated" yaml:"animated"`
+	Label        *string `json:"label,omitempty" yaml:"label,omitempty"`
+	Style        RawJSON `json:"style,omitempty" yaml:"style,omitempty"`
+	LabelStyle   RawJSON `json:"labelStyle,omitempty" yaml:"labelStyle,omitempty"`
+}
+
+// Blueprint is a node library entry. ID is the library ID in the source
+// environment; it is empty for nodes that were never pinned to one (e.g.
+// snapshots published before library IDs were recorded). Hash is the
+// content hash used to deduplicate blueprints on import.
+type Blueprint struct {
+	ID          string  `json:"id,omitempty" yaml:"id,omitempty"`
+	Hash        string  `json:"hash" yaml:"hash"`
+	NodeType    string  `json:"nodeType" yaml:"nodeType"`
+	Label       string  `json:"label" yaml:"label"`
+	Description string  `json:"description" yaml:"description"`
+	Metadata    RawJSON `json:"metadata" yaml:"metadata"`
+}
+
+// Key is how nodes refer to the blueprint: its library ID, or its hash when
+// it has no ID.
+func (bp *Blueprint) Key() string {
+	if bp.ID != "" {
+		return bp.ID
+	}
+	return bp.Hash
+}
+
+// FromWorkflow builds a bundle from a hydrated workflow. Nodes sharing a
+// library ID share one blueprint; nodes without a library ID are grouped by
+// content hash.
+func FromWorkflow(wf *storage.Workflow) (*Bundle, error) {
+	b := &Bundle{
+		APIVersion: APIVersion,
+		Kind:       Kind,
+		Workflow: Workflow{
+			ID:    wf.ID,
+			Name:  wf.Name,
+			Nodes: make([]Node, 0, len(wf.Nodes)),
+			Edges: make([]Edge, 0, len(wf.Edges)),
+		},
+		Blueprints: []Blueprint{},
+	}
+	if !wf.Settings.IsZero() {
+		b.Workflow.Settings = &Settings{ScopedOutputsOnly: wf.Settings.ScopedOutputsOnly, SensitiveVariables: wf.Settings.SensitiveVariables}
+		if r := wf.Settings.Retention; r != (storage.RetentionPolicy{}) {
+			b.Workflow.Settings.Retention = &Retention{Days: r.Days, Runs: r.Runs, FailedDays: r.FailedDays}
+		}
+	}
+
+	byKey := make(map[string]int)
+	for _, n := range wf.Nodes {
+		bp := Blueprint{
+			ID:          n.LibraryID,
+			NodeType:    n.Type,
+			Label:       n.Data.Label,
+			Description: n.Data.Description,
+		}
+		metadata, err := compactJSON(n.Data.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("node %s: invalid metadata: %w", n.ID, err)
+		}
+		bp.Metadata = metadata
+		if bp.Hash, err = bp.ContentHash(); err != nil {
+			return nil, fmt.Errorf("node %s: %w", n.ID, err)
+		}
+
+		key := bp.Key()
+		if i, ok := byKey[key]; ok {
+			if b.Blueprints[i].Hash != bp.Hash {
+				return nil, fmt.Errorf("node %s: library entry %s has differing content across nodes", n.ID, key)
+			}
+		} else {
+			byKey[key] = len(b.Blueprints)
+			b.Blueprints = append(b.Blueprints, bp)
+		}
+
+		b.Workflow.Nodes = append(b.Workflow.Nodes, Node{
+			ID:        n.ID,
+			Type:      n.Type,
+			Blueprint: key,
+			Position:  Position{X: n.Position.X, Y: n.Position.Y},
+		})
+	}
+
+	for _, e := range wf.Edges {
+		style, err := compactJSON(e.Style)
+		if err != nil {
+			return nil, fmt.Errorf("edge %s: invalid style: %w", e.ID, err)
+		}
+		labelStyle, err := compactJSON(e.LabelStyle)
+		if err != nil {
+			return nil, fmt.Errorf("edge %s: invalid label style: %w", e.ID, err)
+		}
+		b.Workflow.Edges = append(b.Workflow.Edges, Edge{
+			ID:           e.ID,
+			Source:       e.Source,
+			Target:       e.Target,
+			SourceHandle: cloneStr(e.SourceHandle),
+			Type:         e.Type,
+			Animated:     e.Animated,
+			Label:        cloneStr(e.Label),
+			Style:        style,
+			LabelStyle:   labelStyle,
+		})
+	}
+
+	return b, nil
+}
+
+// Validate checks that the bundle is self-consistent: supported version,
+// unique IDs, nodes referencing known blueprints of the same type, edges
+// referencing known nodes, and blueprint hashes matching their content.
+// An empty hash is allowed (e.g. a hand-written bundle) and is computed on import.
+func (b *Bundle) Validate() error {
+	if b.APIVersion != APIVersion {
+		return fmt.Errorf("unsupported apiVersion %q (expected %q)", b.APIVersion, APIVersion)
+	}
+	if b.Kind != Kind {
+		return fmt.Errorf("unsupported kind %q (expected %q)", b.Kind, Kind)
+	}
+	if b.Workflow.ID == uuid.Nil {
+		return fmt.Errorf("workflow id is required")
+	}
+	if b.Workflow.Name == "" {
+		return fmt.Errorf("workflow name is required")
+	}
+	if s := b.Workflow.Settings; s != nil && s.Retention != nil {
+		if r := s.Retention; r.Days < 0 || r.Runs < 0 || r.FailedDays < 0 {
+			return fmt.Errorf("retention days, runs and failedDays must not be negative")
+		}
+	}
+	if s := b.Workflow.Settings; s != nil {
+		for i, name := range s.SensitiveVariables {
+			if name == "" {
+				return fmt.Errorf("sensitive variable %d: name is required", i)
+			}
+		}
+	}
+
+	blueprints := make(map[string]*Blueprint, len(b.Blueprints))
+	for i := range b.Blueprints {
+		bp := &b.Blueprints[i]
+		if bp.NodeType == "" {
+			return fmt.Errorf("blueprint %d: nodeType is required", i)
+		}
+		if bp.ID != "" {
+			if _, err := uuid.Parse(bp.ID); err != nil {
+				return fmt.Errorf("blueprint %s: id must be a UUID", bp.ID)
+			}
+		}
+		hash, err := bp.ContentHash()
+		if err != nil {
+			return fmt.Errorf("blueprint %s: %w", bp.Key(), err)
+		}
+		if bp.Hash != "" && bp.Hash != hash {
+			return fmt.Errorf("blueprint %s: hash %s does not match content (%s)", bp.Key(), bp.Hash, hash)
+		}
+		if bp.ID == "" && bp.Hash == "" {
+			return fmt.Errorf("blueprint %d: id or hash is required", i)
+		}
+		if _, dup := blueprints[bp.Key()]; dup {
+			return fmt.Errorf("duplicate blueprint %s", bp.Key())
+		}
+		blueprints[bp.Key()] = bp
+	}
+
+	nodeIDs := make(map[string]bool, len(b.Workflow.Nodes))
+	for _, n := range b.Workflow.Nodes {
+		if n.ID == "" {
+			return fmt.Errorf("node id is required")
+		}
+		if nodeIDs[n.ID] {
+			return fmt.Errorf("duplicate node id %s", n.ID)
+		}
+		nodeIDs[n.ID] = true
+		bp, ok := blueprints[n.Blueprint]
+		if !ok {
+			return fmt.Errorf("node %s: unknown blueprint %q", n.ID, n.Blueprint)
+		}
+		if bp.NodeType != n.Type {
+			return fmt.Errorf("node %s: type %s does not match blueprint type %s", n.ID, n.Type, bp.NodeType)
+		}
+	}
+
+	edgeIDs := make(map[string]bool, len(b.Workflow.Edges))
+	for _, e := range b.Workflow.Edges {
+		if e.ID == "" {
+			return fmt.Errorf("edge id is required")
+		}
+		if edgeIDs[e.ID] {
+			return fmt.Errorf("duplicate edge id %s", e.ID)
+		}
+		edgeIDs[e.ID] = true
+		if !nodeIDs[e.Source] || !nodeIDs[e.Target] {
+			return fmt.Errorf("edge %s: references unknown node", e.ID)
+		}
+		if len(e.Style) > 0 && !json.Valid(e.Style) {
+			return fmt.Errorf("edge %s: invalid style", e.ID)
+		}
+		if len(e.LabelStyle) > 0 && !json.Valid(e.LabelStyle) {
+			return fmt.Errorf("edge %s: invalid label style", e.ID)
+		}
+	}
+
+	return nil
+}
+
+// ToWorkflow validates the bundle and hydrates it back into a
+// storage.Workflow. Nodes are pinned to their blueprint's library ID.
+func (b *Bundle) ToWorkflow() (*storage.Workflow, error) {
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+
+	blueprints := make(map[string]*Blueprint, len(b.Blueprints))
+	for i := range b.Blueprints {
+		blueprints[b.Blueprints[i].Key()] = &b.Blueprints[i]
+	}
+
+	wf := &storage.Workflow{
+		ID:    b.Workflow.ID,
+		Name:  b.Workflow.Name,
+		Nodes: make([]storage.Node, 0, len(b.Workflow.Nodes)),
+		Edges: make([]storage.Edge, 0, len(b.Workflow.Edges)),
+	}
+	if s := b.Workflow.Settings; s != nil {
+		wf.Settings = storage.WorkflowSettings{ScopedOutputsOnly: s.ScopedOutputsOnly, SensitiveVariables: s.SensitiveVariables}
+		if r := s.Retention; r != nil {
+			wf.Settings.Retention = storage.RetentionPolicy{Days: r.Days, Runs: r.Runs, FailedDays: r.FailedDays}
+		}
+	}
+	for _, n := range b.Workflow.Nodes {
+		bp := blueprints[n.Blueprint]
+		wf.Nodes = append(wf.Nodes, storage.Node{
+			ID:        n.ID,
+			Type:      n.Type,
+			LibraryID: bp.ID,
+			Position:  storage.NodePosition{X: n.Position.X, Y: n.Position.Y},
+			Data: storage.NodeData{
+				Label:       bp.Label,
+				Description: bp.Description,
+				Metadata:    cloneRaw(bp.Metadata),
+			},
+		})
+	}
+	for _, e := range b.Workflow.Edges {
+		wf.Edges = append(wf.Edges, storage.Edge{
+			ID:           e.ID,
+			Source:       e.Source,
+			Target:       e.Target,
+			SourceHandle: cloneStr(e.SourceHandle),
+			Type:         e.Type,
+			Animated:     e.Animated,
+			Label:        cloneStr(e.Label),
+			Style:        cloneRaw(e.Style),
+			LabelStyle:   cloneRaw(e.LabelStyle),
+		})
+	}
+	return wf, nil
+}
+
+// ContentHash returns the blueprint's content hash ("sha256:<hex>") over its
+// node type, label, description and canonicalised metadata. The library ID is
+// deliberately excluded so identical blueprints hash the same in every
+// environment.
+func (bp *Blueprint) ContentHash() (string, error) {
+	metadata, err := canonicalJSON(bp.Metadata)
+	if err != nil {
+		return "", fmt.Errorf("invalid metadata: %w", err)
+	}
+	return hashContent(bp.NodeType, bp.Label, bp.Description, metadata)
+}
+
+// LibraryEntryHash returns the content hash of an existing library entry,
+// comparable with Blueprint.ContentHash.
+func LibraryEntryHash(e storage.NodeLibraryEntry) (string, error) {
+	metadata, err := canonicalJSON(e.Metadata)
+	if err != nil {
+		return "", fmt.Errorf("library entry %s: invalid metadata: %w", e.ID, err)
+	}
+	return hashContent(e.NodeType, e.Label, e.Description, metadata)
+}
+
+func hashContent(nodeType, label, description string, metadata json.RawMessage) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(struct {
+		NodeType    string          `json:"nodeType"`
+		Label       string          `json:"label"`
+		Description string          `json:"description"`
+		Metadata    json.RawMessage `json:"metadata"`
+	}{nodeType, label, description, metadata})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(bytes.TrimSpace(buf.Bytes()))
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// canonicalJSON re-encodes a JSON document with sorted object keys and no
+// insignificant whitespace. Numbers keep their original text. Empty input is
+// treated as an empty object, matching the node_library column default.
+func canonicalJSON(raw []byte) (json.RawMessage, error) {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return json.RawMessage(`{}`), nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(buf.Bytes()), nil
+}
+
+// compactJSON strips insignificant whitespace while keeping key order.
+func compactJSON(raw []byte) (RawJSON, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return nil, err
+	}
+	return RawJSON(buf.Bytes()), nil
+}
+
+func cloneRaw(raw RawJSON) json.RawMessage {
+	if raw == nil {
+		return nil
+	}
+	return append(json.RawMessage(nil), raw...)
+}
+
+func cloneStr(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	v := *s
+	return &v
+}
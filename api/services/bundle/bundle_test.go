@@ -0,0 +1,544 @@
+package bundle_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/services/bundle"
+	"workflow-code-test/api/services/storage"
+)
+
+var seededWorkflows = []uuid.UUID{
+	storage.SeedWeatherWorkflowID,
+	storage.SeedFloodWorkflowID,
+	storage.SeedLoopWorkflowID,
+}
+
+func newSeededStore(t *testing.T) storage.Storage {
+	t.Helper()
+	store, err := storage.NewMemoryInstance(storage.SeedFixtures())
+	if err != nil {
+		t.Fatalf("failed to create memory store: %v", err)
+	}
+	return store
+}
+
+// portable strips the environment-specific fields a bundle does not carry
+// and compacts JSON blobs, so workflows can be compared with reflect.DeepEqual.
+func portable(t *testing.T, wf *storage.Workflow) *storage.Workflow {
+	t.Helper()
+	out := &storage.Workflow{ID: wf.ID, Name: wf.Name, Settings: wf.Settings, Nodes: []storage.Node{}, Edges: []storage.Edge{}}
+	for _, n := range wf.Nodes {
+		n.Data.Metadata = compact(t, n.Data.Metadata)
+		out.Nodes = append(out.Nodes, n)
+	}
+	for _, e := range wf.Edges {
+		e.Style = compact(t, e.Style)
+		e.LabelStyle = compact(t, e.LabelStyle)
+		out.Edges = append(out.Edges, e)
+	}
+	return out
+}
+
+func compact(t *testing.T, raw json.RawMessage) json.RawMessage {
+	t.Helper()
+	if raw == nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		t.Fatalf("invalid JSON %s: %v", raw, err)
+	}
+	return buf.Bytes()
+}
+
+func TestBundle_RoundTrip(t *testing.T) {
+	t.Parallel()
+	store := newSeededStore(t)
+
+	for _, id := range seededWorkflows {
+		wf, err := store.GetWorkflow(context.Background(), id)
+		if err != nil {
+			t.Fatalf("GetWorkflow %s: %v", id, err)
+		}
+		want := portable(t, wf)
+
+		for _, format := range []bundle.Format{bundle.FormatJSON, bundle.FormatYAML} {
+			t.Run(wf.Name+"/"+string(format), func(t *testing.T) {
+				t.Parallel()
+
+				b, err := bundle.FromWorkflow(wf)
+				if err != nil {
+					t.Fatalf("FromWorkflow: %v", err)
+				}
+				var first bytes.Buffer
+				if err := bundle.Encode(&first, b, format); err != nil {
+					t.Fatalf("Encode: %v", err)
+				}
+
+				decoded, err := bundle.Decode(bytes.NewReader(first.Bytes()), format)
+				if err != nil {
+					t.Fatalf("Decode: %v", err)
+				}
+				got, err := decoded.ToWorkflow()
+				if err != nil {
+					t.Fatalf("ToWorkflow: %v", err)
+				}
+				if !reflect.DeepEqual(portable(t, got), want) {
+					t.Errorf("workflow changed across round trip\nwant %+v\ngot  %+v", want, got)
+				}
+
+				var second bytes.Buffer
+				if err := bundle.Encode(&second, decoded, format); err != nil {
+					t.Fatalf("re-Encode: %v", err)
+				}
+				if first.String() != second.String() {
+					t.Errorf("re-encoded bundle differs\nfirst:\n%s\nsecond:\n%s", first.String(), second.String())
+				}
+			})
+		}
+	}
+}
+
+func TestBundle_KeepsSettings(t *testing.T) {
+	t.Parallel()
+	wf := &storage.Workflow{ID: uuid.New(), Name: "scoped", Settings: storage.WorkflowSettings{
+		ScopedOutputsOnly:  true,
+		Retention:          storage.RetentionPolicy{Days: 30, Runs: 1000, FailedDays: 90},
+		SensitiveVariables: []string{"name", "email"},
+	}}
+
+	for _, format := range []bundle.Format{bundle.FormatJSON, bundle.FormatYAML} {
+		b, err := bundle.FromWorkflow(wf)
+		if err != nil {
+			t.Fatalf("FromWorkflow: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := bundle.Encode(&buf, b, format); err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		if !strings.Contains(buf.String(), "scopedOutputsOnly") || !strings.Contains(buf.String(), "failedDays") || !strings.Contains(buf.String(), "sensitiveVariables") {
+			t.Errorf("%s: expected the settings in the bundle, got:\n%s", format, buf.String())
+		}
+		decoded, err := bundle.Decode(&buf, format)
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		got, err := decoded.ToWorkflow()
+		if err != nil {
+			t.Fatalf("ToWorkflow: %v", err)
+		}
+		if !reflect.DeepEqual(got.Settings, wf.Settings) {
+			t.Errorf("%s: expected settings %+v, got %+v", format, wf.Settings, got.Settings)
+		}
+	}
+}
+
+func TestFromWorkflow_SharesBlueprints(t *testing.T) {
+	t.Parallel()
+
+	libID := uuid.NewString()
+	meta := json.RawMessage(`{"a": 1}`)
+	wf := &storage.Workflow{
+		ID:   uuid.New(),
+		Name: "shared",
+		Nodes: []storage.Node{
+			{ID: "a", Type: "email", LibraryID: libID, Data: storage.NodeData{Label: "Email", Metadata: meta}},
+			{ID: "b", Type: "email", LibraryID: libID, Data: storage.NodeData{Label: "Email", Metadata: meta}},
+			// Unpinned nodes with identical content share a hash-keyed blueprint.
+			{ID: "c", Type: "sms", Data: storage.NodeData{Label: "SMS", Metadata: meta}},
+			{ID: "d", Type: "sms", Data: storage.NodeData{Label: "SMS", Metadata: meta}},
+		},
+	}
+
+	b, err := bundle.FromWorkflow(wf)
+	if err != nil {
+		t.Fatalf("FromWorkflow: %v", err)
+	}
+	if len(b.Blueprints) != 2 {
+		t.Fatalf("expected 2 blueprints, got %d", len(b.Blueprints))
+	}
+	if b.Blueprints[0].ID != libID || b.Blueprints[0].Key() != libID {
+		t.Errorf("expected first blueprint keyed by library ID, got %+v", b.Blueprints[0])
+	}
+	if b.Blueprints[1].ID != "" || !strings.HasPrefix(b.Blueprints[1].Key(), "sha256:") {
+		t.Errorf("expected second blueprint keyed by hash, got %+v", b.Blueprints[1])
+	}
+	if string(b.Blueprints[0].Metadata) != `{"a":1}` {
+		t.Errorf("expected compacted metadata, got %s", b.Blueprints[0].Metadata)
+	}
+
+	wf.Nodes[1].Data.Label = "Different"
+	if _, err := bundle.FromWorkflow(wf); err == nil {
+		t.Error("expected error when one library ID carries two different contents")
+	}
+}
+
+func TestContentHash_IgnoresIDAndKeyOrder(t *testing.T) {
+	t.Parallel()
+
+	a := bundle.Blueprint{ID: uuid.NewString(), NodeType: "form", Label: "Form", Metadata: bundle.RawJSON(`{"x":1,"y":[1,2]}`)}
+	b := bundle.Blueprint{NodeType: "form", Label: "Form", Metadata: bundle.RawJSON(`{"y": [1, 2], "x": 1}`)}
+	c := bundle.Blueprint{NodeType: "form", Label: "Form", Metadata: bundle.RawJSON(`{"x":2,"y":[1,2]}`)}
+
+	ha, _ := a.ContentHash()
+	hb, _ := b.ContentHash()
+	hc, _ := c.ContentHash()
+	if ha != hb {
+		t.Errorf("expected equal hashes, got %s and %s", ha, hb)
+	}
+	if ha == hc {
+		t.Error("expected different metadata to change the hash")
+	}
+
+	entryHash, err := bundle.LibraryEntryHash(storage.NodeLibraryEntry{
+		ID: uuid.NewString(), NodeType: "form", Label: "Form", Metadata: json.RawMessage(`{"x": 1, "y": [1, 2]}`),
+	})
+	if err != nil {
+		t.Fatalf("LibraryEntryHash: %v", err)
+	}
+	if entryHash != ha {
+		t.Errorf("expected library entry hash %s to match blueprint hash %s", entryHash, ha)
+	}
+}
+
+func validBundle(t *testing.T) *bundle.Bundle {
+	t.Helper()
+	wf, err := newSeededStore(t).GetWorkflow(context.Background(), storage.SeedWeatherWorkflowID)
+	if err != nil {
+		t.Fatalf("GetWorkflow: %v", err)
+	}
+	b, err := bundle.FromWorkflow(wf)
+	if err != nil {
+		t.Fatalf("FromWorkflow: %v", err)
+	}
+	return b
+}
+
+func TestBundle_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		mutate  func(b *bundle.Bundle)
+		wantErr string
+	}{
+		{name: "valid bundle", mutate: func(*bundle.Bundle) {}},
+		{
+			name:    "unsupported api version",
+			mutate:  func(b *bundle.Bundle) { b.APIVersion = "workflow.bundle/v0" },
+			wantErr: "unsupported apiVersion",
+		},
+		{
+			name:    "missing workflow id",
+			mutate:  func(b *bundle.Bundle) { b.Workflow.ID = uuid.Nil },
+			wantErr: "workflow id is required",
+		},
+		{
+			name: "negative retention",
+			mutate: func(b *bundle.Bundle) {
+				b.Workflow.Settings = &bundle.Settings{Retention: &bundle.Retention{Days: -1}}
+			},
+			wantErr: "must not be negative",
+		},
+		{
+			name: "empty sensitive variable",
+			mutate: func(b *bundle.Bundle) {
+				b.Workflow.Settings = &bundle.Settings{SensitiveVariables: []string{"name", ""}}
+			},
+			wantErr: "sensitive variable 1: name is required",
+		},
+		{
+			name:    "node references unknown blueprint",
+			mutate:  func(b *bundle.Bundle) { b.Workflow.Nodes[0].Blueprint = uuid.NewString() },
+			wantErr: "unknown blueprint",
+		},
+		{
+			name:    "node type differs from blueprint",
+			mutate:  func(b *bundle.Bundle) { b.Workflow.Nodes[0].Type = "sms" },
+			wantErr: "does not match blueprint type",
+		},
+		{
+			name:    "duplicate node id",
+			mutate:  func(b *bundle.Bundle) { b.Workflow.Nodes[1].ID = b.Workflow.Nodes[0].ID },
+			wantErr: "duplicate node id",
+		},
+		{
+			name:    "edge references unknown node",
+			mutate:  func(b *bundle.Bundle) { b.Workflow.Edges[0].Target = "nowhere" },
+			wantErr: "references unknown node",
+		},
+		{
+			name:    "edited blueprint with stale hash",
+			mutate:  func(b *bundle.Bundle) { b.Blueprints[0].Label = "Edited" },
+			wantErr: "does not match content",
+		},
+		{
+			name: "edited blueprint with hash removed",
+			mutate: func(b *bundle.Bundle) {
+				b.Blueprints[0].Label = "Edited"
+				b.Blueprints[0].Hash = ""
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			b := validBundle(t)
+			tt.mutate(b)
+			err := b.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPlanImport(t *testing.T) {
+	t.Parallel()
+
+	seeded := storage.SeedFixtures().Library
+
+	tests := []struct {
+		name          string
+		library       func(b *bundle.Bundle) []storage.NodeLibraryEntry
+		mutate        func(b *bundle.Bundle)
+		wantActions   map[bundle.BlueprintAction]int
+		wantConflicts int
+		check         func(t *testing.T, b *bundle.Bundle, plan *bundle.ImportPlan)
+	}{
+		{
+			name:        "same environment reuses every blueprint",
+			library:     func(*bundle.Bundle) []storage.NodeLibraryEntry { return seeded },
+			wantActions: map[bundle.BlueprintAction]int{bundle.BlueprintReused: 6},
+			check: func(t *testing.T, b *bundle.Bundle, plan *bundle.ImportPlan) {
+				for i, n := range plan.Workflow.Nodes {
+					if n.LibraryID != b.Blueprints[indexOf(b, b.Workflow.Nodes[i].Blueprint)].ID {
+						t.Errorf("node %s: expected original library ID, got %s", n.ID, n.LibraryID)
+					}
+				}
+			},
+		},
+		{
+			name:        "empty library creates blueprints under their original IDs",
+			library:     func(*bundle.Bundle) []storage.NodeLibraryEntry { return nil },
+			wantActions: map[bundle.BlueprintAction]int{bundle.BlueprintCreated: 6},
+			check: func(t *testing.T, b *bundle.Bundle, plan *bundle.ImportPlan) {
+				for i, e := range plan.Create {
+					if e.ID != b.Blueprints[i].ID {
+						t.Errorf("expected entry %d to keep ID %s, got %s", i, b.Blueprints[i].ID, e.ID)
+					}
+				}
+			},
+		},
+		{
+			name: "identical content under another ID is reused",
+			library: func(b *bundle.Bundle) []storage.NodeLibraryEntry {
+				bp := b.Blueprints[0]
+				return []storage.NodeLibraryEntry{{
+					ID: "11111111-1111-1111-1111-111111111111", NodeType: bp.NodeType, Label: bp.Label,
+					Description: bp.Description, Metadata: json.RawMessage(`{}`),
+				}}
+			},
+			mutate: func(b *bundle.Bundle) {
+				b.Blueprints[0].Metadata = bundle.RawJSON(`{}`)
+				b.Blueprints[0].Hash = ""
+			},
+			wantActions: map[bundle.BlueprintAction]int{bundle.BlueprintReused: 1, bundle.BlueprintCreated: 5},
+			check: func(t *testing.T, b *bundle.Bundle, plan *bundle.ImportPlan) {
+				if got := plan.Blueprints[0].LibraryID; got != "11111111-1111-1111-1111-111111111111" {
+					t.Errorf("expected existing entry to be reused, got %s", got)
+				}
+			},
+		},
+		{
+			name: "ID taken by different content is copied and reported",
+			library: func(b *bundle.Bundle) []storage.NodeLibraryEntry {
+				return []storage.NodeLibraryEntry{{
+					ID: b.Blueprints[0].ID, NodeType: b.Blueprints[0].NodeType, Label: "Changed in target",
+					Metadata: json.RawMessage(`{}`),
+				}}
+			},
+			wantActions:   map[bundle.BlueprintAction]int{bundle.BlueprintCopied: 1, bundle.BlueprintCreated: 5},
+			wantConflicts: 1,
+			check: func(t *testing.T, b *bundle.Bundle, plan *bundle.ImportPlan) {
+				c := plan.Conflicts[0]
+				if c.LibraryID != b.Blueprints[0].ID || c.BundleHash == c.ExistingHash {
+					t.Errorf("unexpected conflict %+v", c)
+				}
+				if plan.Blueprints[0].LibraryID == b.Blueprints[0].ID {
+					t.Error("expected the copy to get a new library ID")
+				}
+			},
+		},
+		{
+			name:    "identical blueprints within a bundle are stored once",
+			library: func(*bundle.Bundle) []storage.NodeLibraryEntry { return nil },
+			mutate: func(b *bundle.Bundle) {
+				dup := b.Blueprints[0]
+				dup.ID = uuid.NewString()
+				b.Blueprints = append(b.Blueprints, dup)
+				b.Workflow.Nodes = append(b.Workflow.Nodes, bundle.Node{ID: "dup", Type: dup.NodeType, Blueprint: dup.ID})
+			},
+			wantActions: map[bundle.BlueprintAction]int{bundle.BlueprintCreated: 6, bundle.BlueprintReused: 1},
+			check: func(t *testing.T, b *bundle.Bundle, plan *bundle.ImportPlan) {
+				last := plan.Workflow.Nodes[len(plan.Workflow.Nodes)-1]
+				if last.LibraryID != b.Blueprints[0].ID {
+					t.Errorf("expected duplicate to reuse %s, got %s", b.Blueprints[0].ID, last.LibraryID)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			b := validBundle(t)
+			if tt.mutate != nil {
+				tt.mutate(b)
+			}
+
+			plan, err := bundle.PlanImport(b, tt.library(b))
+			if err != nil {
+				t.Fatalf("PlanImport: %v", err)
+			}
+
+			actions := make(map[bundle.BlueprintAction]int)
+			for _, r := range plan.Blueprints {
+				actions[r.Action]++
+			}
+			if !reflect.DeepEqual(actions, tt.wantActions) {
+				t.Errorf("expected actions %v, got %v", tt.wantActions, actions)
+			}
+			if len(plan.Conflicts) != tt.wantConflicts {
+				t.Errorf("expected %d conflicts, got %+v", tt.wantConflicts, plan.Conflicts)
+			}
+			if len(plan.Create) != actions[bundle.BlueprintCreated]+actions[bundle.BlueprintCopied] {
+				t.Errorf("expected %d entries to create, got %d", actions[bundle.BlueprintCreated]+actions[bundle.BlueprintCopied], len(plan.Create))
+			}
+			for _, n := range plan.Workflow.Nodes {
+				if n.LibraryID == "" {
+					t.Errorf("node %s was not pinned to a library entry", n.ID)
+				}
+			}
+			if tt.check != nil {
+				tt.check(t, b, plan)
+			}
+		})
+	}
+}
+
+// TestPlanImport_AppliesToFreshStore imports every seeded workflow into a store
+// with an empty library and checks the stored result matches the source.
+func TestPlanImport_AppliesToFreshStore(t *testing.T) {
+	t.Parallel()
+	source := newSeededStore(t)
+	target, err := storage.NewMemoryInstance(storage.Fixtures{})
+	if err != nil {
+		t.Fatalf("NewMemoryInstance: %v", err)
+	}
+	ctx := context.Background()
+
+	for _, id := range seededWorkflows {
+		wf, err := source.GetWorkflow(ctx, id)
+		if err != nil {
+			t.Fatalf("GetWorkflow: %v", err)
+		}
+		b, err := bundle.FromWorkflow(wf)
+		if err != nil {
+			t.Fatalf("FromWorkflow: %v", err)
+		}
+
+		library, err := target.ListNodeLibrary(ctx)
+		if err != nil {
+			t.Fatalf("ListNodeLibrary: %v", err)
+		}
+		plan, err := bundle.PlanImport(b, library)
+		if err != nil {
+			t.Fatalf("PlanImport: %v", err)
+		}
+		for i := range plan.Create {
+			if err := target.CreateNodeLibraryEntry(ctx, &plan.Create[i]); err != nil {
+				t.Fatalf("CreateNodeLibraryEntry: %v", err)
+			}
+		}
+		if err := target.UpsertWorkflow(ctx, plan.Workflow); err != nil {
+			t.Fatalf("UpsertWorkflow: %v", err)
+		}
+
+		got, err := target.GetWorkflow(ctx, id)
+		if err != nil {
+			t.Fatalf("GetWorkflow on target: %v", err)
+		}
+		if !reflect.DeepEqual(portable(t, got), portable(t, wf)) {
+			t.Errorf("imported %s differs from source\nwant %+v\ngot  %+v", wf.Name, portable(t, wf), portable(t, got))
+		}
+	}
+
+	library, err := target.ListNodeLibrary(ctx)
+	if err != nil {
+		t.Fatalf("ListNodeLibrary: %v", err)
+	}
+	if want := len(storage.SeedFixtures().Library); len(library) > want {
+		t.Errorf("expected at most %d library entries after importing all seeds, got %d", want, len(library))
+	}
+}
+
+func TestImportPlan_Reassign(t *testing.T) {
+	t.Parallel()
+	wf, err := newSeededStore(t).GetWorkflow(context.Background(), seededWorkflows[0])
+	if err != nil {
+		t.Fatalf("GetWorkflow: %v", err)
+	}
+	b, err := bundle.FromWorkflow(wf)
+	if err != nil {
+		t.Fatalf("FromWorkflow: %v", err)
+	}
+	plan, err := bundle.PlanImport(b, nil)
+	if err != nil {
+		t.Fatalf("PlanImport: %v", err)
+	}
+
+	oldID := plan.Create[0].ID
+	newID := plan.Reassign(0)
+	if newID == oldID || plan.Create[0].ID != newID {
+		t.Fatalf("expected entry 0 to move from %s to a new ID, got %s", oldID, plan.Create[0].ID)
+	}
+	if plan.Blueprints[0].LibraryID != newID || plan.Blueprints[0].Action != bundle.BlueprintCopied {
+		t.Errorf("expected the resolution to be copied to %s, got %+v", newID, plan.Blueprints[0])
+	}
+	moved := 0
+	for _, n := range plan.Workflow.Nodes {
+		if n.LibraryID == oldID {
+			t.Errorf("node %s still points at %s", n.ID, oldID)
+		}
+		if n.LibraryID == newID {
+			moved++
+		}
+	}
+	if moved == 0 {
+		t.Errorf("expected nodes to point at %s", newID)
+	}
+}
+
+func indexOf(b *bundle.Bundle, key string) int {
+	for i := range b.Blueprints {
+		if b.Blueprints[i].Key() == key {
+			return i
+		}
+	}
+	return -1
+}
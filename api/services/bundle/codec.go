@@ -0,0 +1,295 @@
+package bundle
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format is a bundle serialisation format.
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+)
+
+// ParseFormat maps a format name (as used in query strings and CLI flags)
+// to a Format. "yml" is accepted as an alias for YAML.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "json":
+		return FormatJSON, nil
+	case "yaml", "yml":
+		return FormatYAML, nil
+	default:
+		return "", fmt.Errorf("unsupported bundle format %q", name)
+	}
+}
+
+// ContentType returns the MIME type used when serving a bundle.
+func (f Format) ContentType() string {
+	if f == FormatYAML {
+		return "application/yaml"
+	}
+	return "application/json"
+}
+
+// DetectFormat guesses the format of an encoded bundle: JSON documents start
+// with '{', anything else is treated as YAML.
+func DetectFormat(data []byte) Format {
+	if trimmed := bytes.TrimLeft(data, " \t\r\n\ufeff"); len(trimmed) > 0 && trimmed[0] == '{' {
+		return FormatJSON
+	}
+	return FormatYAML
+}
+
+// Encode writes the bundle in the given format.
+func Encode(w io.Writer, b *Bundle, f Format) error {
+	switch f {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(b)
+	case FormatYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(b); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		return fmt.Errorf("unsupported bundle format %q", f)
+	}
+}
+
+// Decode reads a bundle in the given format. Unknown fields are rejected so
+// typos in hand-edited bundles surface as errors instead of being dropped.
+// The result is not validated; call Validate or ToWorkflow.
+func Decode(r io.Reader, f Format) (*Bundle, error) {
+	var b Bundle
+	switch f {
+	case FormatJSON:
+		dec := json.NewDecoder(r)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&b); err != nil {
+			return nil, fmt.Errorf("decode json bundle: %w", err)
+		}
+	case FormatYAML:
+		dec := yaml.NewDecoder(r)
+		dec.KnownFields(true)
+		if err := dec.Decode(&b); err != nil {
+			return nil, fmt.Errorf("decode yaml bundle: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported bundle format %q", f)
+	}
+	return &b, nil
+}
+
+// RawJSON holds an embedded JSON document (node metadata, edge styles).
+// In JSON bundles it is written verbatim; in YAML bundles it is converted to
+// native YAML and back, preserving key order and number literals so that a
+// bundle survives a JSON → YAML → JSON trip byte for byte.
+type RawJSON []byte
+
+func (r RawJSON) MarshalJSON() ([]byte, error) {
+	if len(r) == 0 {
+		return []byte("null"), nil
+	}
+	return r, nil
+}
+
+func (r *RawJSON) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*r = nil
+		return nil
+	}
+	compacted, err := compactJSON(data)
+	if err != nil {
+		return err
+	}
+	*r = compacted
+	return nil
+}
+
+func (r RawJSON) MarshalYAML() (any, error) {
+	if len(r) == 0 {
+		return nil, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(r))
+	dec.UseNumber()
+	return jsonToYAML(dec)
+}
+
+func (r *RawJSON) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode && n.ShortTag() == "!!null" {
+		*r = nil
+		return nil
+	}
+	var buf bytes.Buffer
+	if err := yamlToJSON(&buf, n); err != nil {
+		return err
+	}
+	*r = buf.Bytes()
+	return nil
+}
+
+// jsonToYAML converts the next JSON value from dec into a YAML node.
+func jsonToYAML(dec *json.Decoder) (*yaml.Node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		switch v {
+		case '{':
+			n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: keyTok.(string)}
+				val, err := jsonToYAML(dec)
+				if err != nil {
+					return nil, err
+				}
+				n.Content = append(n.Content, key, val)
+			}
+			if _, err := dec.Token(); err != nil { // closing '}'
+				return nil, err
+			}
+			if len(n.Content) == 0 {
+				n.Style = yaml.FlowStyle
+			}
+			return n, nil
+		case '[':
+			n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+			for dec.More() {
+				val, err := jsonToYAML(dec)
+				if err != nil {
+					return nil, err
+				}
+				n.Content = append(n.Content, val)
+			}
+			if _, err := dec.Token(); err != nil { // closing ']'
+				return nil, err
+			}
+			if len(n.Content) == 0 {
+				n.Style = yaml.FlowStyle
+			}
+			return n, nil
+		}
+		return nil, fmt.Errorf("unexpected delimiter %v", v)
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}, nil
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(v.String(), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: v.String()}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(v)}, nil
+	case nil:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	}
+	return nil, fmt.Errorf("unexpected JSON token %v", tok)
+}
+
+// yamlToJSON writes the YAML node as compact JSON.
+func yamlToJSON(buf *bytes.Buffer, n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			buf.WriteString("null")
+			return nil
+		}
+		return yamlToJSON(buf, n.Content[0])
+	case yaml.AliasNode:
+		return yamlToJSON(buf, n.Alias)
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key := n.Content[i]
+			if key.Kind != yaml.ScalarNode {
+				return fmt.Errorf("line %d: mapping keys must be scalars", key.Line)
+			}
+			writeJSONString(buf, key.Value)
+			buf.WriteByte(':')
+			if err := yamlToJSON(buf, n.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, item := range n.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := yamlToJSON(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	case yaml.ScalarNode:
+		return scalarToJSON(buf, n)
+	}
+	return fmt.Errorf("line %d: unsupported YAML node", n.Line)
+}
+
+func scalarToJSON(buf *bytes.Buffer, n *yaml.Node) error {
+	switch n.ShortTag() {
+	case "!!null":
+		buf.WriteString("null")
+	case "!!bool":
+		var b bool
+		if err := n.Decode(&b); err != nil {
+			return err
+		}
+		buf.WriteString(strconv.FormatBool(b))
+	case "!!int", "!!float":
+		// Keep the literal when it is already a valid JSON number so values
+		// like 1.50 or 1e3 round-trip unchanged.
+		if json.Valid([]byte(n.Value)) {
+			buf.WriteString(n.Value)
+			return nil
+		}
+		var f float64
+		if err := n.Decode(&f); err != nil {
+			return err
+		}
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return fmt.Errorf("line %d: %s cannot be represented in JSON", n.Line, n.Value)
+		}
+		buf.WriteString(strconv.FormatFloat(f, 'g', -1, 64))
+	default:
+		// Strings, and timestamps or other tags that JSON has no type for.
+		writeJSONString(buf, n.Value)
+	}
+	return nil
+}
+
+// writeJSONString writes s as a JSON string without HTML escaping.
+func writeJSONString(buf *bytes.Buffer, s string) {
+	var tmp bytes.Buffer
+	enc := json.NewEncoder(&tmp)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s) // encoding a string cannot fail
+	buf.Write(bytes.TrimSuffix(tmp.Bytes(), []byte("\n")))
+}
@@ -0,0 +1,125 @@
+package bundle_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"workflow-code-test/api/services/bundle"
+)
+
+func TestRawJSON_YAMLRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		json string
+	}{
+		{name: "key order is preserved", json: `{"zeta":1,"alpha":2,"mid":{"b":true,"a":false}}`},
+		{name: "number literals are preserved", json: `{"int":25,"neg":-3,"float":1.50,"exp":1e3,"big":12345678901234567890}`},
+		{name: "strings that look like other types stay strings", json: `{"a":"true","b":"25","c":"null","d":"","e":"2024-01-01","f":"#10b981"}`},
+		{name: "html and unicode are not escaped", json: `{"html":"<b>&</b>","label":"✓ Condition Met","nl":"a\nb"}`},
+		{name: "arrays and nulls", json: `{"list":[1,"two",null,{"k":[]}],"empty":{}}`},
+		{name: "top-level array", json: `[{"id":"a"},{"id":"b"}]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			b := &bundle.Bundle{
+				APIVersion: bundle.APIVersion,
+				Kind:       bundle.Kind,
+				Blueprints: []bundle.Blueprint{{NodeType: "form", Metadata: bundle.RawJSON(tt.json)}},
+			}
+			var buf bytes.Buffer
+			if err := bundle.Encode(&buf, b, bundle.FormatYAML); err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			got, err := bundle.Decode(&buf, bundle.FormatYAML)
+			if err != nil {
+				t.Fatalf("Decode: %v\n%s", err, buf.String())
+			}
+			if s := string(got.Blueprints[0].Metadata); s != tt.json {
+				t.Errorf("expected %s, got %s", tt.json, s)
+			}
+		})
+	}
+}
+
+func TestDecode_HandWrittenYAML(t *testing.T) {
+	t.Parallel()
+
+	src := `
+# Hand-written bundle: comments, anchors and unquoted values are fine.
+apiVersion: workflow.bundle/v1
+kind: WorkflowBundle
+workflow:
+  id: 3f1c9a0e-6c1d-4c3e-9d1a-9a3f0f6d2b11
+  name: Hand written
+  nodes:
+    - {id: start, type: start, blueprint: start-bp, position: {x: 0, y: 0}}
+  edges: []
+blueprints:
+  - hash: start-bp
+    nodeType: start
+    label: Start
+    description: ""
+    metadata:
+      hasHandles: &handles {source: yes, target: false}
+      copy: *handles
+      retries: 0x0A
+`
+	b, err := bundle.Decode(strings.NewReader(src), bundle.FormatYAML)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	want := `{"hasHandles":{"source":"yes","target":false},"copy":{"source":"yes","target":false},"retries":10}`
+	if got := string(b.Blueprints[0].Metadata); got != want {
+		t.Errorf("expected metadata %s, got %s", want, got)
+	}
+	// The hash is a placeholder key here, which Validate rejects as stale.
+	if err := b.Validate(); err == nil || !strings.Contains(err.Error(), "does not match content") {
+		t.Errorf("expected placeholder hash to be rejected, got %v", err)
+	}
+}
+
+func TestDecode_RejectsUnknownFields(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		format bundle.Format
+		src    string
+	}{
+		{bundle.FormatJSON, `{"apiVersion":"workflow.bundle/v1","kind":"WorkflowBundle","workflwo":{}}`},
+		{bundle.FormatYAML, "apiVersion: workflow.bundle/v1\nkind: WorkflowBundle\nworkflwo: {}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			t.Parallel()
+			if _, err := bundle.Decode(strings.NewReader(tt.src), tt.format); err == nil {
+				t.Error("expected unknown field to be rejected")
+			}
+		})
+	}
+}
+
+func TestParseAndDetectFormat(t *testing.T) {
+	t.Parallel()
+
+	for name, want := range map[string]bundle.Format{"json": bundle.FormatJSON, "YAML": bundle.FormatYAML, "yml": bundle.FormatYAML} {
+		if got, err := bundle.ParseFormat(name); err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := bundle.ParseFormat("xml"); err == nil {
+		t.Error("expected xml to be rejected")
+	}
+
+	if got := bundle.DetectFormat([]byte("\n  {\"apiVersion\":\"x\"}")); got != bundle.FormatJSON {
+		t.Errorf("expected JSON, got %s", got)
+	}
+	if got := bundle.DetectFormat([]byte("apiVersion: x\n")); got != bundle.FormatYAML {
+		t.Errorf("expected YAML, got %s", got)
+	}
+}
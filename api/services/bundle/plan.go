@@ -0,0 +1,151 @@
+package bundle
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/services/storage"
+)
+
+// BlueprintAction describes what importing a blueprint does to the target
+// node library.
+type BlueprintAction string
+
+const (
+	// BlueprintReused means an entry with identical content already exists
+	// (or is created earlier in the same import) and is referenced as-is.
+	BlueprintReused BlueprintAction = "reused"
+	// BlueprintCreated means a new library entry is created, keeping the
+	// bundle's library ID when it has one.
+	BlueprintCreated BlueprintAction = "created"
+	// BlueprintCopied means the bundle's library ID is already taken by an
+	// entry with different content, so the blueprint is created under a new
+	// ID instead of overwriting an entry other workflows may depend on.
+	BlueprintCopied BlueprintAction = "copied"
+)
+
+// BlueprintResolution records how one bundle blueprint maps onto the target library.
+type BlueprintResolution struct {
+	Blueprint string          `json:"blueprint"` // key in the bundle
+	Hash      string          `json:"hash"`
+	LibraryID string          `json:"libraryId"` // entry the imported nodes point at
+	Action    BlueprintAction `json:"action"`
+}
+
+// Conflict reports a bundle blueprint whose library ID exists in the target
+// with different content.
+type Conflict struct {
+	Blueprint    string `json:"blueprint"`
+	LibraryID    string `json:"libraryId"`
+	BundleHash   string `json:"bundleHash"`
+	ExistingHash string `json:"existingHash"`
+}
+
+// ImportPlan is the result of matching a bundle against a node library.
+// Applying it means creating every entry in Create and then upserting Workflow.
+type ImportPlan struct {
+	Workflow   *storage.Workflow
+	Create     []storage.NodeLibraryEntry
+	Blueprints []BlueprintResolution
+	Conflicts  []Conflict
+}
+
+// PlanImport decides, for every blueprint in the bundle, which library entry
+// its nodes should point at. Blueprints are matched by content hash, so an
+// identical blueprint is never stored twice:
+//  1. an existing entry with the bundle's ID and the same content is reused;
+//  2. otherwise any existing entry with the same content is reused;
+//  3. otherwise a new entry is created under the bundle's ID, or under a new
+//     ID (reported as a Conflict) if that ID holds different content.
+//
+// Because matching is content-addressed, importing a bundle again reuses the
+// entries the first import created.
+func PlanImport(b *Bundle, library []storage.NodeLibraryEntry) (*ImportPlan, error) {
+	wf, err := b.ToWorkflow()
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]string, len(library))   // library ID → hash
+	byHash := make(map[string]string, len(library)) // hash → first library ID
+	for _, e := range library {
+		hash, err := LibraryEntryHash(e)
+		if err != nil {
+			return nil, err
+		}
+		byID[e.ID] = hash
+		if _, ok := byHash[hash]; !ok {
+			byHash[hash] = e.ID
+		}
+	}
+
+	plan := &ImportPlan{Workflow: wf}
+	resolved := make(map[string]string, len(b.Blueprints)) // bundle key → library ID
+	for i := range b.Blueprints {
+		bp := &b.Blueprints[i]
+		hash, err := bp.ContentHash()
+		if err != nil {
+			return nil, fmt.Errorf("blueprint %s: %w", bp.Key(), err)
+		}
+		res := BlueprintResolution{Blueprint: bp.Key(), Hash: hash}
+
+		existingHash, idTaken := byID[bp.ID]
+		switch {
+		case bp.ID != "" && idTaken && existingHash == hash:
+			res.LibraryID, res.Action = bp.ID, BlueprintReused
+		case byHash[hash] != "":
+			res.LibraryID, res.Action = byHash[hash], BlueprintReused
+		default:
+			res.LibraryID, res.Action = bp.ID, BlueprintCreated
+			if bp.ID == "" {
+				res.LibraryID = uuid.NewString()
+			} else if idTaken {
+				res.LibraryID, res.Action = uuid.NewString(), BlueprintCopied
+				plan.Conflicts = append(plan.Conflicts, Conflict{
+					Blueprint:    bp.Key(),
+					LibraryID:    bp.ID,
+					BundleHash:   hash,
+					ExistingHash: existingHash,
+				})
+			}
+			plan.Create = append(plan.Create, storage.NodeLibraryEntry{
+				ID:          res.LibraryID,
+				NodeType:    bp.NodeType,
+				Label:       bp.Label,
+				Description: bp.Description,
+				Metadata:    cloneRaw(bp.Metadata),
+			})
+			byID[res.LibraryID] = hash
+			byHash[hash] = res.LibraryID
+		}
+
+		resolved[bp.Key()] = res.LibraryID
+		plan.Blueprints = append(plan.Blueprints, res)
+	}
+
+	for i, n := range b.Workflow.Nodes {
+		wf.Nodes[i].LibraryID = resolved[n.Blueprint]
+	}
+	return plan, nil
+}
+
+// Reassign moves Create[i] to a new library ID and re-points the nodes that
+// used it. It is for an ID that turns out to be taken by an entry the
+// planning library did not include, such as one in another workspace, and
+// returns the new ID.
+func (p *ImportPlan) Reassign(i int) string {
+	oldID, newID := p.Create[i].ID, uuid.NewString()
+	p.Create[i].ID = newID
+	for j := range p.Blueprints {
+		if p.Blueprints[j].LibraryID == oldID {
+			p.Blueprints[j].LibraryID, p.Blueprints[j].Action = newID, BlueprintCopied
+		}
+	}
+	for j := range p.Workflow.Nodes {
+		if p.Workflow.Nodes[j].LibraryID == oldID {
+			p.Workflow.Nodes[j].LibraryID = newID
+		}
+	}
+	return newID
+}
@@ -4,6 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
 
 	"workflow-code-test/api/pkg/clients/email"
 	"workflow-code-test/api/pkg/clients/flood"
@@ -16,13 +20,55 @@ type NodeContext struct {
 	Variables map[string]any
 }
 
+// NodesVariable holds every node's output keyed by node ID, so templates
+// and conditions can name an output as nodes.<id>.<key> even when another
+// node wrote the same flat variable.
+const NodesVariable = "nodes"
+
+// Lookup returns a variable by its flat name, or a node's output by its
+// scoped name nodes.<id>.<key>.
+func (c *NodeContext) Lookup(name string) (any, bool) {
+	if v, ok := c.Variables[name]; ok {
+		return v, true
+	}
+	rest, ok := strings.CutPrefix(name, NodesVariable+".")
+	if !ok {
+		return nil, false
+	}
+	// Node IDs may contain dots; output keys do not.
+	i := strings.LastIndex(rest, ".")
+	if i <= 0 {
+		return nil, false
+	}
+	scoped, _ := c.Variables[NodesVariable].(map[string]any)
+	output, _ := scoped[rest[:i]].(map[string]any)
+	v, ok := output[rest[i+1:]]
+	return v, ok
+}
+
+// SetOutput records output as the scoped output of nodeID. The nodes map
+// is replaced rather than updated in place, so contexts copied from this
+// one (e.g. foreach iterations) never see each other's outputs.
+func (c *NodeContext) SetOutput(nodeID string, output map[string]any) {
+	prev, _ := c.Variables[NodesVariable].(map[string]any)
+	scoped := make(map[string]any, len(prev)+1)
+	for id, out := range prev {
+		scoped[id] = out
+	}
+	scoped[nodeID] = output
+	c.Variables[NodesVariable] = scoped
+}
+
 // ExecutionResult holds the output of a single node's execution.
 // Branch is used by condition nodes to signal which edge to follow
 // (matches the sourceHandle on outgoing edges, e.g. "true"/"false").
+// Suspend is set by nodes that wait on a person: the engine pauses the run
+// at the node and resumes it later through Resumer.
 type ExecutionResult struct {
-	Status string         `json:"status"`
-	Output map[string]any `json:"output,omitempty"`
-	Branch string         `json:"branch,omitempty"`
+	Status  string         `json:"status"`
+	Output  map[string]any `json:"output,omitempty"`
+	Branch  string         `json:"branch,omitempty"`
+	Suspend *Suspension    `json:"-"`
 }
 
 // Position represents a node's canvas coordinates.
@@ -73,6 +119,12 @@ func (b *BaseFields) ToJSON() NodeJSON {
 	}
 }
 
+// SideEffects reports whether the node changes the outside world.
+// Node types that send messages or write to external systems override it.
+func (b *BaseFields) SideEffects() bool {
+	return false
+}
+
 // Node is implemented by each node type. A node constructs itself from
 // database metadata, can serialize to JSON for the frontend, and can
 // execute its own logic during workflow runs.
@@ -86,6 +138,74 @@ type Node interface {
 	// (e.g. required metadata fields are present). Called at build time,
 	// not during execution.
 	Validate() error
+	// SideEffects reports whether Execute changes the outside world
+	// (sends a message, writes to an external system). Dry runs skip
+	// such nodes; reads like weather lookups are not side effects.
+	SideEffects() bool
+}
+
+// Previewer is implemented by side-effecting nodes that can render what
+// Execute would do without doing it. Dry runs call Preview instead of
+// Execute so the full payload still shows up in the step output.
+type Previewer interface {
+	Preview(ctx context.Context, nCtx *NodeContext) (*ExecutionResult, error)
+}
+
+// Suspension describes the task or timer a suspended run waits on.
+type Suspension struct {
+	Kind     string        // "approval", "input" or SuspendTimer
+	Assignee string        // who may respond; empty means anyone
+	Title    string        // shown in the task list
+	Fields   []string      // fields the responder must (input) or may (approval) submit
+	Timeout  time.Duration // 0 means the task never expires
+	Until    time.Time     // when a timer fires
+}
+
+// SuspendTimer is the Suspension kind of delay and wait_until nodes. A
+// timer has no task; the run resumes with OutcomeElapsed once Until passes.
+const SuspendTimer = "timer"
+
+// Task outcomes passed to Resume. They double as the branch names
+// (sourceHandle) the node follows.
+const (
+	OutcomeApproved  = "approved"
+	OutcomeRejected  = "rejected"
+	OutcomeSubmitted = "submitted"
+	OutcomeTimeout   = "timeout"
+	OutcomeElapsed   = "elapsed" // a timer fired; timer nodes follow their default edge
+)
+
+// Resolution is the response to a suspended node's task.
+type Resolution struct {
+	Outcome string         `json:"outcome"`
+	Fields  map[string]any `json:"fields,omitempty"`
+	By      string         `json:"by,omitempty"`
+}
+
+// Resumer is implemented by nodes that suspend. Resume turns the response
+// to their task into the node's result, including the branch to follow.
+type Resumer interface {
+	Resume(nCtx *NodeContext, res Resolution) (*ExecutionResult, error)
+}
+
+// Invoker is implemented by nodes that call another workflow. The engine
+// loads and runs the target with the inputs from ChildInputs, then turns
+// the child's final variables into the node's result with Complete.
+type Invoker interface {
+	Target() (workflowID uuid.UUID, version int)
+	ChildInputs(nCtx *NodeContext) (map[string]any, error)
+	Complete(childVars map[string]any) (*ExecutionResult, error)
+}
+
+// Iterator is implemented by nodes that run their BranchBody subgraph once
+// per item of a list. The engine runs each iteration in the variable scope
+// from Scope, at most MaxConcurrency at a time, and hands the outputs of
+// every iteration's steps to Gather.
+type Iterator interface {
+	ListItems(nCtx *NodeContext) ([]any, error)
+	Scope(nCtx *NodeContext, index int, item any) *NodeContext
+	MaxConcurrency() int
+	Gather(outputs []map[string]any) *ExecutionResult
 }
 
 // Deps holds external clients that nodes may need during execution.
@@ -116,6 +236,18 @@ func New(base BaseFields, deps Deps) (Node, error) {
 		return NewSmsNode(base, deps.SMS)
 	case "flood":
 		return NewFloodNode(base, deps.Flood)
+	case "approval":
+		return NewApprovalNode(base)
+	case "input":
+		return NewInputNode(base)
+	case "delay":
+		return NewDelayNode(base)
+	case "wait_until":
+		return NewWaitUntilNode(base)
+	case "subworkflow":
+		return NewSubworkflowNode(base)
+	case "foreach":
+		return NewForeachNode(base)
 	default:
 		return nil, fmt.Errorf("unknown node type: %s", base.NodeType)
 	}
@@ -0,0 +1,121 @@
+package nodes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// taskConfig is the metadata shared by nodes that wait on a person.
+// Placeholders like {{approver}} in the assignee and title are resolved
+// from the runtime context when the task is created.
+type taskConfig struct {
+	Assignee        string   `json:"assignee"`
+	Title           string   `json:"title"`
+	Timeout         string   `json:"timeout"` // Go duration, e.g. "24h"; empty never expires
+	Fields          []string `json:"fields"`
+	InputVariables  []string `json:"inputVariables"`
+	OutputVariables []string `json:"outputVariables"`
+}
+
+func (c *taskConfig) validate(kind, id string) error {
+	if strings.TrimSpace(c.Title) == "" {
+		return fmt.Errorf("%s node %q: missing title", kind, id)
+	}
+	if c.Timeout != "" {
+		d, err := time.ParseDuration(c.Timeout)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("%s node %q: timeout must be a positive duration like \"24h\", got %q", kind, id, c.Timeout)
+		}
+	}
+	for i, f := range c.Fields {
+		if strings.TrimSpace(f) == "" {
+			return fmt.Errorf("%s node %q: field [%d] is blank", kind, id, i)
+		}
+	}
+	inputSet := make(map[string]bool, len(c.InputVariables))
+	for _, v := range c.InputVariables {
+		inputSet[v] = true
+	}
+	for _, placeholder := range extractPlaceholders(c.Assignee + " " + c.Title) {
+		if !inputSet[placeholder] {
+			return fmt.Errorf("%s node %q: template references {{%s}} not in input variables", kind, id, placeholder)
+		}
+	}
+	return nil
+}
+
+// suspend resolves the task from the runtime context.
+func (c *taskConfig) suspend(kind string, nCtx *NodeContext) (*ExecutionResult, error) {
+	for _, v := range c.InputVariables {
+		if _, ok := nCtx.Lookup(v); !ok {
+			return nil, fmt.Errorf("missing required variable: %s", v)
+		}
+	}
+	var timeout time.Duration
+	if c.Timeout != "" {
+		timeout, _ = time.ParseDuration(c.Timeout) // checked by validate
+	}
+	return &ExecutionResult{
+		Status: "waiting",
+		Suspend: &Suspension{
+			Kind:     kind,
+			Assignee: resolveTemplate(c.Assignee, nCtx),
+			Title:    resolveTemplate(c.Title, nCtx),
+			Fields:   append([]string(nil), c.Fields...),
+			Timeout:  timeout,
+		},
+	}, nil
+}
+
+// ApprovalNode pauses the run until a person approves or rejects it, or
+// the task times out. It follows the "approved", "rejected" or "timeout"
+// branch and outputs approved (bool), approvalStatus and respondedBy, plus
+// any of the optional fields (e.g. a comment) the responder submitted.
+type ApprovalNode struct {
+	BaseFields
+	taskConfig
+}
+
+func NewApprovalNode(base BaseFields) (*ApprovalNode, error) {
+	n := &ApprovalNode{BaseFields: base}
+	if err := json.Unmarshal(base.Metadata, n); err != nil {
+		return nil, fmt.Errorf("invalid approval metadata: %w", err)
+	}
+	return n, nil
+}
+
+func (n *ApprovalNode) Validate() error {
+	return n.validate("approval", n.ID)
+}
+
+// Execute suspends the run with an approval task.
+func (n *ApprovalNode) Execute(_ context.Context, nCtx *NodeContext) (*ExecutionResult, error) {
+	return n.suspend("approval", nCtx)
+}
+
+// Resume records the decision and follows the branch named after it.
+func (n *ApprovalNode) Resume(_ *NodeContext, res Resolution) (*ExecutionResult, error) {
+	status := "completed"
+	switch res.Outcome {
+	case OutcomeApproved, OutcomeRejected:
+	case OutcomeTimeout:
+		status = "timed_out"
+	default:
+		return nil, fmt.Errorf("approval node %q: unsupported outcome %q", n.ID, res.Outcome)
+	}
+
+	output := map[string]any{
+		"approved":       res.Outcome == OutcomeApproved,
+		"approvalStatus": res.Outcome,
+		"respondedBy":    res.By,
+	}
+	for _, f := range n.Fields {
+		if v, ok := res.Fields[f]; ok {
+			output[f] = v
+		}
+	}
+	return &ExecutionResult{Status: status, Output: output, Branch: res.Outcome}, nil
+}
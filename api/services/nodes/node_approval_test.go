@@ -0,0 +1,121 @@
+package nodes_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"workflow-code-test/api/services/nodes"
+)
+
+const approvalMeta = `{"assignee":"{{approver}}","title":"Send alert for {{city}}?","timeout":"2h","fields":["comment"],"inputVariables":["approver","city"]}`
+
+func TestApprovalNode_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		meta    string
+		wantErr string
+	}{
+		{name: "valid", meta: approvalMeta},
+		{name: "no timeout", meta: `{"title":"Approve?"}`},
+		{name: "missing title", meta: `{"assignee":"ops"}`, wantErr: "missing title"},
+		{name: "invalid timeout", meta: `{"title":"Approve?","timeout":"soon"}`, wantErr: "timeout must be a positive duration"},
+		{name: "negative timeout", meta: `{"title":"Approve?","timeout":"-1h"}`, wantErr: "timeout must be a positive duration"},
+		{name: "blank field", meta: `{"title":"Approve?","fields":[""]}`, wantErr: "field [0] is blank"},
+		{name: "undeclared placeholder", meta: `{"assignee":"{{approver}}","title":"Approve?"}`, wantErr: "template references {{approver}} not in input variables"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			node, err := nodes.NewApprovalNode(nodes.BaseFields{ID: "approve", NodeType: "approval", Metadata: json.RawMessage(tt.meta)})
+			if err != nil {
+				t.Fatalf("failed to create approval node: %v", err)
+			}
+			err = node.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestApprovalNode_Execute(t *testing.T) {
+	t.Parallel()
+	node, err := nodes.NewApprovalNode(nodes.BaseFields{ID: "approve", NodeType: "approval", Metadata: json.RawMessage(approvalMeta)})
+	if err != nil {
+		t.Fatalf("NewApprovalNode: %v", err)
+	}
+
+	result, err := node.Execute(context.Background(), &nodes.NodeContext{Variables: map[string]any{"approver": "alice", "city": "Sydney"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s := result.Suspend
+	if result.Status != "waiting" || s == nil {
+		t.Fatalf("expected the node to suspend, got %+v", result)
+	}
+	if s.Kind != "approval" || s.Assignee != "alice" || s.Title != "Send alert for Sydney?" || s.Timeout != 2*time.Hour {
+		t.Errorf("unexpected suspension %+v", s)
+	}
+
+	_, err = node.Execute(context.Background(), &nodes.NodeContext{Variables: map[string]any{"city": "Sydney"}})
+	if err == nil || !strings.Contains(err.Error(), "missing required variable: approver") {
+		t.Errorf("expected missing variable error, got %v", err)
+	}
+}
+
+func TestApprovalNode_Resume(t *testing.T) {
+	t.Parallel()
+	node, err := nodes.NewApprovalNode(nodes.BaseFields{ID: "approve", NodeType: "approval", Metadata: json.RawMessage(approvalMeta)})
+	if err != nil {
+		t.Fatalf("NewApprovalNode: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		res          nodes.Resolution
+		wantStatus   string
+		wantApproved bool
+		wantErr      string
+	}{
+		{name: "approved", res: nodes.Resolution{Outcome: "approved", By: "alice", Fields: map[string]any{"comment": "ok"}}, wantStatus: "completed", wantApproved: true},
+		{name: "rejected", res: nodes.Resolution{Outcome: "rejected", By: "alice"}, wantStatus: "completed"},
+		{name: "timeout", res: nodes.Resolution{Outcome: "timeout"}, wantStatus: "timed_out"},
+		{name: "unknown outcome", res: nodes.Resolution{Outcome: "submitted"}, wantErr: `unsupported outcome "submitted"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			result, err := node.Resume(&nodes.NodeContext{Variables: map[string]any{}}, tt.res)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.Status != tt.wantStatus || result.Branch != tt.res.Outcome {
+				t.Errorf("expected status %s and branch %s, got %+v", tt.wantStatus, tt.res.Outcome, result)
+			}
+			if result.Output["approved"] != tt.wantApproved || result.Output["approvalStatus"] != tt.res.Outcome {
+				t.Errorf("unexpected output %v", result.Output)
+			}
+			if tt.res.Fields["comment"] != nil && result.Output["comment"] != tt.res.Fields["comment"] {
+				t.Errorf("expected the comment to be passed through, got %v", result.Output)
+			}
+		})
+	}
+}
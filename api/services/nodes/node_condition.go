@@ -49,13 +49,14 @@ func (n *ConditionNode) Execute(_ context.Context, nCtx *NodeContext) (*Executio
 		varName = "temperature"
 	}
 
-	value, ok := toFloat64(nCtx.Variables[varName])
+	raw, _ := nCtx.Lookup(varName)
+	value, ok := toFloat64(raw)
 	if !ok {
 		return nil, fmt.Errorf("missing or invalid variable: %s", varName)
 	}
 
-	raw, _ := nCtx.Variables["operator"].(string)
-	operator := Operator(raw)
+	op, _ := nCtx.Variables["operator"].(string)
+	operator := Operator(op)
 	if operator == "" {
 		operator = OpGreaterThan
 	}
@@ -91,6 +92,21 @@ func (n *ConditionNode) Execute(_ context.Context, nCtx *NodeContext) (*Executio
 	}, nil
 }
 
+// Compare evaluates value <op> threshold for numeric operands of any type
+// the condition node accepts. It is used outside the graph, e.g. for
+// conditional breakpoints.
+func Compare(value any, op Operator, threshold any) (bool, error) {
+	v, ok := toFloat64(value)
+	if !ok {
+		return false, fmt.Errorf("value %v is not a number", value)
+	}
+	t, ok := toFloat64(threshold)
+	if !ok {
+		return false, fmt.Errorf("threshold %v is not a number", threshold)
+	}
+	return evaluate(v, op, t)
+}
+
 func evaluate(value float64, op Operator, threshold float64) (bool, error) {
 	switch op {
 	case OpGreaterThan:
@@ -169,3 +169,35 @@ func TestConditionNode_Execute(t *testing.T) {
 		})
 	}
 }
+
+func TestCompare(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		value     any
+		op        nodes.Operator
+		threshold any
+		want      bool
+		wantErr   bool
+	}{
+		{name: "float above", value: 31.5, op: nodes.OpGreaterThan, threshold: 25.0, want: true},
+		{name: "int equal to float", value: 25, op: nodes.OpEqualTo, threshold: 25.0, want: true},
+		{name: "json number", value: json.Number("12"), op: nodes.OpLessThanOrEqual, threshold: 12, want: true},
+		{name: "non-numeric value", value: "hot", op: nodes.OpGreaterThan, threshold: 25.0, wantErr: true},
+		{name: "non-numeric threshold", value: 1.0, op: nodes.OpGreaterThan, threshold: nil, wantErr: true},
+		{name: "unknown operator", value: 1.0, op: "between", threshold: 2.0, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := nodes.Compare(tt.value, tt.op, tt.threshold)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error=%v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -83,22 +83,17 @@ func extractPlaceholders(tmpl string) []string {
 	return result
 }
 
+// SideEffects reports true: executing the node sends an email.
+func (n *EmailNode) SideEffects() bool {
+	return true
+}
+
 // Execute resolves template placeholders from context variables and
 // sends the email via the client. Returns the composed email as output.
 func (n *EmailNode) Execute(ctx context.Context, nCtx *NodeContext) (*ExecutionResult, error) {
-	to, ok := nCtx.Variables["email"].(string)
-	if !ok || to == "" {
-		return nil, fmt.Errorf("missing or invalid variable: email")
-	}
-
-	subject := resolveTemplate(n.EmailTemplate.Subject, nCtx.Variables)
-	body := resolveTemplate(n.EmailTemplate.Body, nCtx.Variables)
-
-	msg := email.Message{
-		To:      to,
-		From:    "weather-alerts@example.com",
-		Subject: subject,
-		Body:    body,
+	msg, err := n.compose(nCtx)
+	if err != nil {
+		return nil, err
 	}
 
 	result, err := n.email.Send(ctx, msg)
@@ -106,8 +101,36 @@ func (n *EmailNode) Execute(ctx context.Context, nCtx *NodeContext) (*ExecutionR
 		return nil, fmt.Errorf("failed to send email: %w", err)
 	}
 
+	return emailResult("completed", msg, result.DeliveryStatus, result.Sent), nil
+}
+
+// Preview composes the email exactly like Execute but does not send it.
+func (n *EmailNode) Preview(_ context.Context, nCtx *NodeContext) (*ExecutionResult, error) {
+	msg, err := n.compose(nCtx)
+	if err != nil {
+		return nil, err
+	}
+	return emailResult("skipped", msg, "dry_run", false), nil
+}
+
+// compose builds the email from the template and context variables.
+func (n *EmailNode) compose(nCtx *NodeContext) (email.Message, error) {
+	to, ok := nCtx.Variables["email"].(string)
+	if !ok || to == "" {
+		return email.Message{}, fmt.Errorf("missing or invalid variable: email")
+	}
+
+	return email.Message{
+		To:      to,
+		From:    "weather-alerts@example.com",
+		Subject: resolveTemplate(n.EmailTemplate.Subject, nCtx),
+		Body:    resolveTemplate(n.EmailTemplate.Body, nCtx),
+	}, nil
+}
+
+func emailResult(status string, msg email.Message, deliveryStatus string, sent bool) *ExecutionResult {
 	return &ExecutionResult{
-		Status: "completed",
+		Status: status,
 		Output: map[string]any{
 			"emailDraft": map[string]any{
 				"to":      msg.To,
@@ -115,18 +138,21 @@ func (n *EmailNode) Execute(ctx context.Context, nCtx *NodeContext) (*ExecutionR
 				"subject": msg.Subject,
 				"body":    msg.Body,
 			},
-			"deliveryStatus": result.DeliveryStatus,
-			"emailSent":      result.Sent,
+			"deliveryStatus": deliveryStatus,
+			"emailSent":      sent,
 		},
-	}, nil
+	}
 }
 
 // resolveTemplate replaces {{key}} placeholders with values from variables.
-func resolveTemplate(tmpl string, vars map[string]any) string {
+// Placeholders may use flat or scoped (nodes.<id>.<key>) names; unknown
+// ones are left as they are.
+func resolveTemplate(tmpl string, nCtx *NodeContext) string {
 	result := tmpl
-	for key, val := range vars {
-		placeholder := "{{" + key + "}}"
-		result = strings.ReplaceAll(result, placeholder, fmt.Sprintf("%v", val))
+	for _, name := range extractPlaceholders(tmpl) {
+		if val, ok := nCtx.Lookup(name); ok {
+			result = strings.ReplaceAll(result, "{{"+name+"}}", fmt.Sprintf("%v", val))
+		}
 	}
 	return result
 }
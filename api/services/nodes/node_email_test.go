@@ -191,3 +191,34 @@ func TestEmailNode_Execute(t *testing.T) {
 		})
 	}
 }
+
+func TestEmailNode_Preview(t *testing.T) {
+	t.Parallel()
+	meta := `{"inputVariables":["email","city"],"outputVariables":["emailSent"],"emailTemplate":{"subject":"Weather in {{city}}","body":"Hello from {{city}}"}}`
+	base := nodes.BaseFields{ID: "email", NodeType: "email", Metadata: json.RawMessage(meta)}
+
+	// A failing client proves Preview never sends.
+	node, err := nodes.NewEmailNode(base, &mockEmailClient{err: fmt.Errorf("must not send")})
+	if err != nil {
+		t.Fatalf("failed to create email node: %v", err)
+	}
+	if !node.SideEffects() {
+		t.Error("expected email node to report side effects")
+	}
+
+	result, err := node.Preview(context.Background(), &nodes.NodeContext{Variables: map[string]any{"email": "alice@example.com", "city": "Sydney"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Status != "skipped" || result.Output["emailSent"] != false || result.Output["deliveryStatus"] != "dry_run" {
+		t.Errorf("expected a skipped, unsent result, got %+v", result)
+	}
+	draft, _ := result.Output["emailDraft"].(map[string]any)
+	if draft["subject"] != "Weather in Sydney" || draft["body"] != "Hello from Sydney" {
+		t.Errorf("expected rendered draft, got %v", draft)
+	}
+
+	if _, err := node.Preview(context.Background(), &nodes.NodeContext{Variables: map[string]any{}}); err == nil {
+		t.Error("expected missing email variable to fail the preview")
+	}
+}
@@ -0,0 +1,142 @@
+package nodes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Branches of a foreach node: "body" leads into the subgraph run for each
+// item, "done" is followed once every iteration has finished.
+const (
+	BranchBody = "body"
+	BranchDone = "done"
+)
+
+const (
+	// maxForeachItems bounds the list a foreach node iterates, the way
+	// maxExecutionSteps bounds a back-edge loop.
+	maxForeachItems = 100
+	// maxForeachConcurrency bounds how many iterations run at once.
+	maxForeachConcurrency = 10
+)
+
+// ForeachNode runs its body once per item of a list variable. Each
+// iteration sees the workflow's variables plus the item and its index (and,
+// for an object item, its fields); what the body sets stays in the
+// iteration. The outputs of each iteration's body steps are collected, in
+// item order, into a list under ResultVariable.
+type ForeachNode struct {
+	BaseFields
+	Items          string   `json:"items"`                   // the list variable
+	ItemVariable   string   `json:"itemVariable,omitempty"`  // default "item"
+	IndexVariable  string   `json:"indexVariable,omitempty"` // default "index"
+	Concurrency    int      `json:"concurrency,omitempty"`   // iterations run at once; default 1
+	Collect        []string `json:"collect,omitempty"`       // outputs kept per iteration; empty keeps all
+	ResultVariable string   `json:"resultVariable,omitempty"`
+}
+
+func NewForeachNode(base BaseFields) (*ForeachNode, error) {
+	n := &ForeachNode{BaseFields: base}
+	if err := json.Unmarshal(base.Metadata, n); err != nil {
+		return nil, fmt.Errorf("invalid foreach metadata: %w", err)
+	}
+	if n.ItemVariable == "" {
+		n.ItemVariable = "item"
+	}
+	if n.IndexVariable == "" {
+		n.IndexVariable = "index"
+	}
+	if n.Concurrency == 0 {
+		n.Concurrency = 1
+	}
+	if n.ResultVariable == "" {
+		n.ResultVariable = "results"
+	}
+	return n, nil
+}
+
+func (n *ForeachNode) Validate() error {
+	if strings.TrimSpace(n.Items) == "" {
+		return fmt.Errorf("foreach node %q: missing items variable", n.ID)
+	}
+	if n.ItemVariable == n.IndexVariable {
+		return fmt.Errorf("foreach node %q: item and index variables must differ", n.ID)
+	}
+	if n.Concurrency < 1 || n.Concurrency > maxForeachConcurrency {
+		return fmt.Errorf("foreach node %q: concurrency must be between 1 and %d, got %d", n.ID, maxForeachConcurrency, n.Concurrency)
+	}
+	for i, v := range n.Collect {
+		if strings.TrimSpace(v) == "" {
+			return fmt.Errorf("foreach node %q: collect [%d] is blank", n.ID, i)
+		}
+	}
+	return nil
+}
+
+// Execute fails: the body is part of the workflow graph, so only the
+// engine, which checks for Iterator before executing a node, can run it.
+func (n *ForeachNode) Execute(_ context.Context, _ *NodeContext) (*ExecutionResult, error) {
+	return nil, fmt.Errorf("foreach node %q must be run by the workflow engine", n.ID)
+}
+
+// ListItems returns the list to iterate.
+func (n *ForeachNode) ListItems(nCtx *NodeContext) ([]any, error) {
+	v, ok := nCtx.Lookup(n.Items)
+	if !ok {
+		return nil, fmt.Errorf("missing required variable: %s", n.Items)
+	}
+	items, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("variable %q is not a list", n.Items)
+	}
+	if len(items) > maxForeachItems {
+		return nil, fmt.Errorf("variable %q has %d items, more than the %d a foreach node iterates", n.Items, len(items), maxForeachItems)
+	}
+	return items, nil
+}
+
+// Scope returns the variables of one iteration. The item and index are
+// set last so they win over a field or workflow variable of the same name.
+func (n *ForeachNode) Scope(nCtx *NodeContext, index int, item any) *NodeContext {
+	vars := make(map[string]any, len(nCtx.Variables)+2)
+	for k, v := range nCtx.Variables {
+		vars[k] = v
+	}
+	if fields, ok := item.(map[string]any); ok {
+		for k, v := range fields {
+			vars[k] = v
+		}
+	}
+	vars[n.ItemVariable] = item
+	vars[n.IndexVariable] = index
+	return &NodeContext{Variables: vars}
+}
+
+func (n *ForeachNode) MaxConcurrency() int {
+	return n.Concurrency
+}
+
+// Gather builds the node's result from the outputs of each iteration and
+// continues down the "done" branch.
+func (n *ForeachNode) Gather(outputs []map[string]any) *ExecutionResult {
+	results := make([]any, len(outputs))
+	for i, out := range outputs {
+		kept := out
+		if len(n.Collect) > 0 {
+			kept = make(map[string]any, len(n.Collect))
+			for _, k := range n.Collect {
+				if v, ok := out[k]; ok {
+					kept[k] = v
+				}
+			}
+		}
+		results[i] = kept
+	}
+	return &ExecutionResult{
+		Status: "completed",
+		Output: map[string]any{n.ResultVariable: results},
+		Branch: BranchDone,
+	}
+}
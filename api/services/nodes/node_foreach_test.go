@@ -0,0 +1,104 @@
+package nodes_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"workflow-code-test/api/services/nodes"
+)
+
+func newForeachNode(t *testing.T, meta string) *nodes.ForeachNode {
+	t.Helper()
+	node, err := nodes.NewForeachNode(nodes.BaseFields{ID: "each", NodeType: "foreach", Metadata: json.RawMessage(meta)})
+	if err != nil {
+		t.Fatalf("NewForeachNode: %v", err)
+	}
+	return node
+}
+
+func TestForeachNode_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		meta    string
+		wantErr string
+	}{
+		{name: "defaults", meta: `{"items":"cities"}`},
+		{name: "all fields", meta: `{"items":"subscribers","itemVariable":"subscriber","indexVariable":"n","concurrency":4,"collect":["deliveryStatus"],"resultVariable":"deliveries"}`},
+		{name: "missing items", meta: `{}`, wantErr: "missing items variable"},
+		{name: "same item and index", meta: `{"items":"cities","itemVariable":"i","indexVariable":"i"}`, wantErr: "must differ"},
+		{name: "concurrency too high", meta: `{"items":"cities","concurrency":11}`, wantErr: "concurrency must be between 1 and 10"},
+		{name: "negative concurrency", meta: `{"items":"cities","concurrency":-1}`, wantErr: "concurrency must be between 1 and 10"},
+		{name: "blank collect", meta: `{"items":"cities","collect":[""]}`, wantErr: "collect [0] is blank"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := newForeachNode(t, tt.meta).Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestForeachNode_ListItems(t *testing.T) {
+	t.Parallel()
+	node := newForeachNode(t, `{"items":"cities"}`)
+
+	items, err := node.ListItems(&nodes.NodeContext{Variables: map[string]any{"cities": []any{"Sydney", "Perth"}}})
+	if err != nil || len(items) != 2 {
+		t.Fatalf("ListItems() = %v, %v", items, err)
+	}
+
+	tests := []struct {
+		name    string
+		vars    map[string]any
+		wantErr string
+	}{
+		{name: "missing", vars: map[string]any{}, wantErr: "missing required variable: cities"},
+		{name: "not a list", vars: map[string]any{"cities": "Sydney"}, wantErr: "is not a list"},
+		{name: "too long", vars: map[string]any{"cities": make([]any, 101)}, wantErr: "more than the 100"},
+	}
+	for _, tt := range tests {
+		if _, err := node.ListItems(&nodes.NodeContext{Variables: tt.vars}); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+func TestForeachNode_ScopeAndGather(t *testing.T) {
+	t.Parallel()
+	node := newForeachNode(t, `{"items":"subscribers","itemVariable":"subscriber","collect":["deliveryStatus"]}`)
+
+	parent := &nodes.NodeContext{Variables: map[string]any{"city": "Sydney", "name": "workflow"}}
+	item := map[string]any{"name": "Alice", "email": "alice@example.com"}
+	scope := node.Scope(parent, 2, item)
+	want := map[string]any{"city": "Sydney", "name": "Alice", "email": "alice@example.com", "subscriber": item, "index": 2}
+	if !reflect.DeepEqual(scope.Variables, want) {
+		t.Errorf("Scope() = %v, want %v", scope.Variables, want)
+	}
+	scope.Variables["city"] = "Perth"
+	if parent.Variables["city"] != "Sydney" {
+		t.Error("expected the iteration scope not to write through to the parent")
+	}
+
+	result := node.Gather([]map[string]any{
+		{"deliveryStatus": "sent", "emailSent": true},
+		{"emailSent": false},
+	})
+	wantResults := []any{map[string]any{"deliveryStatus": "sent"}, map[string]any{}}
+	if result.Branch != nodes.BranchDone || !reflect.DeepEqual(result.Output["results"], wantResults) {
+		t.Errorf("Gather() = %+v, want results %v on the done branch", result, wantResults)
+	}
+}
@@ -4,18 +4,44 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
+	"regexp"
+	"slices"
 	"strings"
 )
 
 // FormNode collects user input. The metadata defines which fields to
 // collect (inputFields) and which variables they produce (outputVariables).
 // During execution, it reads the expected fields from the runtime context
-// (pre-populated from the execute request payload).
+// (pre-populated from the execute request payload). Fields optionally
+// declares the type and constraints of input fields; see Schema.
 type FormNode struct {
 	BaseFields
 
-	InputFields     []string `json:"inputFields"`
-	OutputVariables []string `json:"outputVariables"`
+	InputFields     []string      `json:"inputFields"`
+	OutputVariables []string      `json:"outputVariables"`
+	Fields          []FieldSchema `json:"fields,omitempty"`
+}
+
+// Field types of a form's input schema. An empty type accepts any value.
+const (
+	FieldString  = "string"
+	FieldNumber  = "number"
+	FieldInteger = "integer"
+	FieldBoolean = "boolean"
+)
+
+// FieldSchema declares one form input field. Min and Max bound a number's
+// value and a string's length; Pattern applies to strings only.
+type FieldSchema struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type,omitempty"`
+	Required bool     `json:"required"`
+	Enum     []any    `json:"enum,omitempty"`
+	Pattern  string   `json:"pattern,omitempty"`
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+	Default  any      `json:"default,omitempty"`
 }
 
 func NewFormNode(base BaseFields) (*FormNode, error) {
@@ -53,20 +79,170 @@ func (n *FormNode) Validate() error {
 			return fmt.Errorf("form node %q: input field %q not listed in output variables", n.ID, f)
 		}
 	}
+	seen := make(map[string]bool, len(n.Fields))
+	for _, f := range n.Fields {
+		if !slices.Contains(n.InputFields, f.Name) {
+			return fmt.Errorf("form node %q: field %q is not an input field", n.ID, f.Name)
+		}
+		if seen[f.Name] {
+			return fmt.Errorf("form node %q: field %q is declared twice", n.ID, f.Name)
+		}
+		seen[f.Name] = true
+		if err := f.validate(); err != nil {
+			return fmt.Errorf("form node %q: field %q: %w", n.ID, f.Name, err)
+		}
+	}
+	return nil
+}
+
+func (f FieldSchema) validate() error {
+	switch f.Type {
+	case "", FieldString, FieldNumber, FieldInteger, FieldBoolean:
+	default:
+		return fmt.Errorf("unsupported type %q", f.Type)
+	}
+	if f.Pattern != "" {
+		if f.Type != FieldString {
+			return fmt.Errorf("pattern needs type %s", FieldString)
+		}
+		if _, err := regexp.Compile(f.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+	if f.Min != nil || f.Max != nil {
+		if f.Type != FieldString && f.Type != FieldNumber && f.Type != FieldInteger {
+			return fmt.Errorf("min and max need a string, number or integer type")
+		}
+		if f.Min != nil && f.Max != nil && *f.Min > *f.Max {
+			return fmt.Errorf("min %v is greater than max %v", *f.Min, *f.Max)
+		}
+	}
+	for i, v := range f.Enum {
+		if err := f.checkType(v); err != nil {
+			return fmt.Errorf("enum [%d] %w", i, err)
+		}
+	}
+	if f.Default != nil {
+		if err := f.Check(f.Default); err != nil {
+			return fmt.Errorf("default %w", err)
+		}
+	}
+	return nil
+}
+
+// Check reports why v is not a valid value for the field, or nil if it is.
+// The error reads as the end of a sentence naming the field, e.g.
+// "must be a number".
+func (f FieldSchema) Check(v any) error {
+	if err := f.checkType(v); err != nil {
+		return err
+	}
+	if len(f.Enum) > 0 && !slices.ContainsFunc(f.Enum, func(e any) bool { return sameValue(e, v) }) {
+		return fmt.Errorf("must be one of %s", formatEnum(f.Enum))
+	}
+	size, ok := toFloat64(v)
+	if s, isString := v.(string); isString {
+		size, ok = float64(len([]rune(s))), true
+		if f.Pattern != "" {
+			if re, err := regexp.Compile(f.Pattern); err == nil && !re.MatchString(s) {
+				return fmt.Errorf("must match %s", f.Pattern)
+			}
+		}
+	}
+	if !ok {
+		return nil
+	}
+	unit := ""
+	if f.Type == FieldString {
+		unit = " characters"
+	}
+	if f.Min != nil && size < *f.Min {
+		return fmt.Errorf("must be at least %v%s", *f.Min, unit)
+	}
+	if f.Max != nil && size > *f.Max {
+		return fmt.Errorf("must be at most %v%s", *f.Max, unit)
+	}
+	return nil
+}
+
+func (f FieldSchema) checkType(v any) error {
+	switch f.Type {
+	case FieldString:
+		if _, ok := v.(string); !ok {
+			return fmt.Errorf("must be a string")
+		}
+	case FieldNumber:
+		if _, ok := toFloat64(v); !ok {
+			return fmt.Errorf("must be a number")
+		}
+	case FieldInteger:
+		if n, ok := toFloat64(v); !ok || n != math.Trunc(n) {
+			return fmt.Errorf("must be an integer")
+		}
+	case FieldBoolean:
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("must be a boolean")
+		}
+	}
 	return nil
 }
 
+// sameValue compares enum values, treating numbers of any Go type alike.
+func sameValue(a, b any) bool {
+	if x, ok := toFloat64(a); ok {
+		y, ok := toFloat64(b)
+		return ok && x == y
+	}
+	return a == b
+}
+
+func formatEnum(values []any) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		b, _ := json.Marshal(v)
+		parts[i] = string(b)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Schema returns a field per input field, in order. Input fields without a
+// declaration accept any value and are required, as before fields could be
+// declared.
+func (n *FormNode) Schema() []FieldSchema {
+	declared := make(map[string]FieldSchema, len(n.Fields))
+	for _, f := range n.Fields {
+		declared[f.Name] = f
+	}
+	schema := make([]FieldSchema, len(n.InputFields))
+	for i, name := range n.InputFields {
+		f, ok := declared[name]
+		if !ok {
+			f = FieldSchema{Name: name, Required: true}
+		}
+		schema[i] = f
+	}
+	return schema
+}
+
 // Execute extracts the declared input fields from the runtime context
-// and passes them through as output variables for downstream nodes.
+// and passes them through as output variables for downstream nodes. A
+// missing field takes its default; an optional one without a default is
+// left out.
 func (n *FormNode) Execute(_ context.Context, nCtx *NodeContext) (*ExecutionResult, error) {
 	output := make(map[string]any)
 
-	for _, field := range n.InputFields {
-		val, ok := nCtx.Variables[field]
+	for _, field := range n.Schema() {
+		val, ok := nCtx.Variables[field.Name]
+		if !ok && field.Default != nil {
+			val, ok = field.Default, true
+		}
 		if !ok {
-			return nil, fmt.Errorf("missing required form field: %s", field)
+			if field.Required {
+				return nil, fmt.Errorf("missing required form field: %s", field.Name)
+			}
+			continue
 		}
-		output[field] = val
+		output[field.Name] = val
 	}
 
 	return &ExecutionResult{
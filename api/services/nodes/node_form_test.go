@@ -46,6 +46,52 @@ func TestFormNode_Validate(t *testing.T) {
 			meta:    `{"inputFields":["name","email"],"outputVariables":["name"]}`,
 			wantErr: `input field "email" not listed in output variables`,
 		},
+		{
+			name: "valid field declarations",
+			meta: `{"inputFields":["email","age"],"outputVariables":["email","age"],"fields":[
+				{"name":"email","type":"string","required":true,"pattern":"^[^@]+@[^@]+$","max":254},
+				{"name":"age","type":"integer","min":0,"max":150,"default":30}]}`,
+		},
+		{
+			name:    "field is not an input field",
+			meta:    `{"inputFields":["name"],"outputVariables":["name"],"fields":[{"name":"email"}]}`,
+			wantErr: `field "email" is not an input field`,
+		},
+		{
+			name:    "field declared twice",
+			meta:    `{"inputFields":["name"],"outputVariables":["name"],"fields":[{"name":"name"},{"name":"name"}]}`,
+			wantErr: `field "name" is declared twice`,
+		},
+		{
+			name:    "unsupported type",
+			meta:    `{"inputFields":["name"],"outputVariables":["name"],"fields":[{"name":"name","type":"date"}]}`,
+			wantErr: `unsupported type "date"`,
+		},
+		{
+			name:    "invalid pattern",
+			meta:    `{"inputFields":["name"],"outputVariables":["name"],"fields":[{"name":"name","type":"string","pattern":"("}]}`,
+			wantErr: "invalid pattern",
+		},
+		{
+			name:    "pattern on a number",
+			meta:    `{"inputFields":["age"],"outputVariables":["age"],"fields":[{"name":"age","type":"number","pattern":"^1"}]}`,
+			wantErr: "pattern needs type string",
+		},
+		{
+			name:    "min above max",
+			meta:    `{"inputFields":["age"],"outputVariables":["age"],"fields":[{"name":"age","type":"number","min":5,"max":1}]}`,
+			wantErr: "min 5 is greater than max 1",
+		},
+		{
+			name:    "enum value of the wrong type",
+			meta:    `{"inputFields":["city"],"outputVariables":["city"],"fields":[{"name":"city","type":"string","enum":["Sydney",2]}]}`,
+			wantErr: "enum [1] must be a string",
+		},
+		{
+			name:    "default outside the enum",
+			meta:    `{"inputFields":["city"],"outputVariables":["city"],"fields":[{"name":"city","type":"string","enum":["Sydney"],"default":"Perth"}]}`,
+			wantErr: `default must be one of "Sydney"`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -144,3 +190,76 @@ func TestFormNode_Execute(t *testing.T) {
 		})
 	}
 }
+
+func TestFormNode_ExecuteOptionalFields(t *testing.T) {
+	t.Parallel()
+	base := nodes.BaseFields{
+		ID:       "form",
+		NodeType: "form",
+		Metadata: json.RawMessage(`{"inputFields":["name","city","nickname"],"outputVariables":["name","city","nickname"],"fields":[
+			{"name":"city","type":"string","default":"Sydney"},
+			{"name":"nickname","type":"string"}]}`),
+	}
+	node, err := nodes.NewFormNode(base)
+	if err != nil {
+		t.Fatalf("failed to create form node: %v", err)
+	}
+	if err := node.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+
+	result, err := node.Execute(context.Background(), &nodes.NodeContext{Variables: map[string]any{"name": "Alice"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Output["city"] != "Sydney" {
+		t.Errorf("expected the default city, got %v", result.Output["city"])
+	}
+	if _, ok := result.Output["nickname"]; ok || len(result.Output) != 2 {
+		t.Errorf("expected the optional nickname to be left out, got %v", result.Output)
+	}
+}
+
+func TestFieldSchema_Check(t *testing.T) {
+	t.Parallel()
+	num := func(f float64) *float64 { return &f }
+
+	tests := []struct {
+		name    string
+		field   nodes.FieldSchema
+		value   any
+		wantErr string
+	}{
+		{name: "untyped accepts anything", field: nodes.FieldSchema{}, value: []any{1}},
+		{name: "string", field: nodes.FieldSchema{Type: nodes.FieldString}, value: "Sydney"},
+		{name: "not a string", field: nodes.FieldSchema{Type: nodes.FieldString}, value: 3.0, wantErr: "must be a string"},
+		{name: "number", field: nodes.FieldSchema{Type: nodes.FieldNumber}, value: 25.5},
+		{name: "number as a string", field: nodes.FieldSchema{Type: nodes.FieldNumber}, value: "25", wantErr: "must be a number"},
+		{name: "integer", field: nodes.FieldSchema{Type: nodes.FieldInteger}, value: 25.0},
+		{name: "fractional integer", field: nodes.FieldSchema{Type: nodes.FieldInteger}, value: 2.5, wantErr: "must be an integer"},
+		{name: "boolean", field: nodes.FieldSchema{Type: nodes.FieldBoolean}, value: "true", wantErr: "must be a boolean"},
+		{name: "null", field: nodes.FieldSchema{Type: nodes.FieldString}, value: nil, wantErr: "must be a string"},
+		{name: "enum", field: nodes.FieldSchema{Type: nodes.FieldNumber, Enum: []any{1.0, 2.0}}, value: 2},
+		{name: "outside enum", field: nodes.FieldSchema{Type: nodes.FieldString, Enum: []any{"a", "b"}}, value: "c", wantErr: `must be one of "a", "b"`},
+		{name: "pattern", field: nodes.FieldSchema{Type: nodes.FieldString, Pattern: "^[^@]+@[^@]+$"}, value: "not-an-email", wantErr: "must match ^[^@]+@[^@]+$"},
+		{name: "below min", field: nodes.FieldSchema{Type: nodes.FieldNumber, Min: num(0)}, value: -1.0, wantErr: "must be at least 0"},
+		{name: "above max", field: nodes.FieldSchema{Type: nodes.FieldInteger, Max: num(10)}, value: 11.0, wantErr: "must be at most 10"},
+		{name: "string too short", field: nodes.FieldSchema{Type: nodes.FieldString, Min: num(2)}, value: "é", wantErr: "must be at least 2 characters"},
+		{name: "string length in characters", field: nodes.FieldSchema{Type: nodes.FieldString, Max: num(2)}, value: "éé"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := tt.field.Check(tt.value)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
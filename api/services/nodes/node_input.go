@@ -0,0 +1,56 @@
+package nodes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// InputNode pauses the run until a person submits the listed fields, which
+// become variables for downstream nodes, or the task times out. Unlike the
+// form node it collects values that were not in the execute request. It
+// follows the "submitted" or "timeout" branch.
+type InputNode struct {
+	BaseFields
+	taskConfig
+}
+
+func NewInputNode(base BaseFields) (*InputNode, error) {
+	n := &InputNode{BaseFields: base}
+	if err := json.Unmarshal(base.Metadata, n); err != nil {
+		return nil, fmt.Errorf("invalid input metadata: %w", err)
+	}
+	return n, nil
+}
+
+func (n *InputNode) Validate() error {
+	if len(n.Fields) == 0 {
+		return fmt.Errorf("input node %q: no fields", n.ID)
+	}
+	return n.validate("input", n.ID)
+}
+
+// Execute suspends the run with an input task.
+func (n *InputNode) Execute(_ context.Context, nCtx *NodeContext) (*ExecutionResult, error) {
+	return n.suspend("input", nCtx)
+}
+
+// Resume outputs the submitted fields, all of which are required.
+func (n *InputNode) Resume(_ *NodeContext, res Resolution) (*ExecutionResult, error) {
+	switch res.Outcome {
+	case OutcomeSubmitted:
+		output := map[string]any{"respondedBy": res.By}
+		for _, f := range n.Fields {
+			v, ok := res.Fields[f]
+			if !ok {
+				return nil, fmt.Errorf("missing required field: %s", f)
+			}
+			output[f] = v
+		}
+		return &ExecutionResult{Status: "completed", Output: output, Branch: OutcomeSubmitted}, nil
+	case OutcomeTimeout:
+		return &ExecutionResult{Status: "timed_out", Output: map[string]any{}, Branch: OutcomeTimeout}, nil
+	default:
+		return nil, fmt.Errorf("input node %q: unsupported outcome %q", n.ID, res.Outcome)
+	}
+}
@@ -0,0 +1,81 @@
+package nodes_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"workflow-code-test/api/services/nodes"
+)
+
+func TestInputNode_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		meta    string
+		wantErr string
+	}{
+		{name: "valid", meta: `{"title":"Phone number?","fields":["phone"]}`},
+		{name: "no fields", meta: `{"title":"Phone number?"}`, wantErr: "no fields"},
+		{name: "missing title", meta: `{"fields":["phone"]}`, wantErr: "missing title"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			node, err := nodes.NewInputNode(nodes.BaseFields{ID: "ask", NodeType: "input", Metadata: json.RawMessage(tt.meta)})
+			if err != nil {
+				t.Fatalf("failed to create input node: %v", err)
+			}
+			err = node.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestInputNode_SuspendAndResume(t *testing.T) {
+	t.Parallel()
+	node, err := nodes.NewInputNode(nodes.BaseFields{ID: "ask", NodeType: "input", Metadata: json.RawMessage(`{"assignee":"ops","title":"Phone number?","fields":["phone"]}`)})
+	if err != nil {
+		t.Fatalf("NewInputNode: %v", err)
+	}
+	nCtx := &nodes.NodeContext{Variables: map[string]any{}}
+
+	result, err := node.Execute(context.Background(), nCtx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if s := result.Suspend; s == nil || s.Kind != "input" || s.Assignee != "ops" || len(s.Fields) != 1 || s.Timeout != 0 {
+		t.Fatalf("unexpected suspension %+v", result.Suspend)
+	}
+
+	result, err = node.Resume(nCtx, nodes.Resolution{Outcome: "submitted", By: "ops", Fields: map[string]any{"phone": "+61400000000", "extra": 1}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Branch != "submitted" || result.Output["phone"] != "+61400000000" || result.Output["respondedBy"] != "ops" {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if _, ok := result.Output["extra"]; ok {
+		t.Error("expected undeclared fields to be dropped")
+	}
+
+	if _, err := node.Resume(nCtx, nodes.Resolution{Outcome: "submitted"}); err == nil || !strings.Contains(err.Error(), "missing required field: phone") {
+		t.Errorf("expected missing field error, got %v", err)
+	}
+
+	result, err = node.Resume(nCtx, nodes.Resolution{Outcome: "timeout"})
+	if err != nil || result.Branch != "timeout" || result.Status != "timed_out" {
+		t.Errorf("expected the timeout branch, got %+v, %v", result, err)
+	}
+}
@@ -46,27 +46,55 @@ func (n *SmsNode) Validate() error {
 	return nil
 }
 
+// SideEffects reports true: executing the node sends an SMS.
+func (n *SmsNode) SideEffects() bool {
+	return true
+}
+
 func (n *SmsNode) Execute(ctx context.Context, nCtx *NodeContext) (*ExecutionResult, error) {
-	phone, ok := nCtx.Variables["phone"].(string)
-	if !ok || phone == "" {
-		return nil, fmt.Errorf("missing or invalid variable: phone")
+	msg, err := n.compose(nCtx)
+	if err != nil {
+		return nil, err
 	}
 
-	message, _ := nCtx.Variables["message"].(string)
-
-	result, err := n.sms.Send(ctx, sms.Message{
-		To:   phone,
-		Body: message,
-	})
+	result, err := n.sms.Send(ctx, msg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send sms: %w", err)
 	}
 
+	return smsResult("completed", msg, result.DeliveryStatus, result.Sent), nil
+}
+
+// Preview composes the SMS exactly like Execute but does not send it.
+func (n *SmsNode) Preview(_ context.Context, nCtx *NodeContext) (*ExecutionResult, error) {
+	msg, err := n.compose(nCtx)
+	if err != nil {
+		return nil, err
+	}
+	return smsResult("skipped", msg, "dry_run", false), nil
+}
+
+// compose builds the SMS from context variables.
+func (n *SmsNode) compose(nCtx *NodeContext) (sms.Message, error) {
+	phone, ok := nCtx.Variables["phone"].(string)
+	if !ok || phone == "" {
+		return sms.Message{}, fmt.Errorf("missing or invalid variable: phone")
+	}
+
+	message, _ := nCtx.Variables["message"].(string)
+	return sms.Message{To: phone, Body: message}, nil
+}
+
+func smsResult(status string, msg sms.Message, deliveryStatus string, sent bool) *ExecutionResult {
 	return &ExecutionResult{
-		Status: "completed",
+		Status: status,
 		Output: map[string]any{
-			"deliveryStatus": result.DeliveryStatus,
-			"smsSent":        result.Sent,
+			"smsDraft": map[string]any{
+				"to":   msg.To,
+				"body": msg.Body,
+			},
+			"deliveryStatus": deliveryStatus,
+			"smsSent":        sent,
 		},
-	}, nil
+	}
 }
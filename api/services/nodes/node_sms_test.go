@@ -137,3 +137,29 @@ func TestSmsNode_Execute(t *testing.T) {
 		})
 	}
 }
+
+func TestSmsNode_Preview(t *testing.T) {
+	t.Parallel()
+	meta := `{"inputVariables":["phone","message"],"outputVariables":["smsSent"]}`
+	base := nodes.BaseFields{ID: "sms", NodeType: "sms", Metadata: json.RawMessage(meta)}
+
+	node, err := nodes.NewSmsNode(base, &mockSmsClient{err: fmt.Errorf("must not send")})
+	if err != nil {
+		t.Fatalf("failed to create sms node: %v", err)
+	}
+	if !node.SideEffects() {
+		t.Error("expected sms node to report side effects")
+	}
+
+	result, err := node.Preview(context.Background(), &nodes.NodeContext{Variables: map[string]any{"phone": "+61400000000", "message": "flood alert"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Status != "skipped" || result.Output["smsSent"] != false {
+		t.Errorf("expected a skipped, unsent result, got %+v", result)
+	}
+	draft, _ := result.Output["smsDraft"].(map[string]any)
+	if draft["to"] != "+61400000000" || draft["body"] != "flood alert" {
+		t.Errorf("expected rendered draft, got %v", draft)
+	}
+}
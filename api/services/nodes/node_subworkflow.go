@@ -0,0 +1,88 @@
+package nodes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// SubworkflowNode calls another workflow. The child starts with only the
+// variables named in InputMapping and hands back only those named in
+// OutputMapping, so parent and child do not see each other's variables.
+// The engine runs the child (see Invoker); Execute is never called.
+type SubworkflowNode struct {
+	BaseFields
+	WorkflowID    string            `json:"workflowId"`
+	Version       int               `json:"version,omitempty"` // pinned snapshot; 0 runs what the child would run on its own
+	InputMapping  map[string]string `json:"inputMapping"`      // child variable -> parent variable
+	OutputMapping map[string]string `json:"outputMapping"`     // parent variable -> child variable
+}
+
+func NewSubworkflowNode(base BaseFields) (*SubworkflowNode, error) {
+	n := &SubworkflowNode{BaseFields: base}
+	if err := json.Unmarshal(base.Metadata, n); err != nil {
+		return nil, fmt.Errorf("invalid subworkflow metadata: %w", err)
+	}
+	return n, nil
+}
+
+func (n *SubworkflowNode) Validate() error {
+	if _, err := uuid.Parse(n.WorkflowID); err != nil {
+		return fmt.Errorf("subworkflow node %q: workflowId must be a workflow UUID, got %q", n.ID, n.WorkflowID)
+	}
+	if n.Version < 0 {
+		return fmt.Errorf("subworkflow node %q: version must not be negative", n.ID)
+	}
+	for child, parent := range n.InputMapping {
+		if strings.TrimSpace(child) == "" || strings.TrimSpace(parent) == "" {
+			return fmt.Errorf("subworkflow node %q: input mapping %q -> %q has a blank variable", n.ID, parent, child)
+		}
+	}
+	for parent, child := range n.OutputMapping {
+		if strings.TrimSpace(child) == "" || strings.TrimSpace(parent) == "" {
+			return fmt.Errorf("subworkflow node %q: output mapping %q -> %q has a blank variable", n.ID, child, parent)
+		}
+	}
+	return nil
+}
+
+// Execute fails: the child workflow can only be loaded and run by the
+// engine, which checks for Invoker before executing a node.
+func (n *SubworkflowNode) Execute(_ context.Context, _ *NodeContext) (*ExecutionResult, error) {
+	return nil, fmt.Errorf("subworkflow node %q must be run by the workflow engine", n.ID)
+}
+
+func (n *SubworkflowNode) Target() (uuid.UUID, int) {
+	id, _ := uuid.Parse(n.WorkflowID) // checked by Validate
+	return id, n.Version
+}
+
+// ChildInputs copies the mapped parent variables under their child names.
+func (n *SubworkflowNode) ChildInputs(nCtx *NodeContext) (map[string]any, error) {
+	inputs := make(map[string]any, len(n.InputMapping))
+	for child, parent := range n.InputMapping {
+		v, ok := nCtx.Lookup(parent)
+		if !ok {
+			return nil, fmt.Errorf("missing required variable: %s", parent)
+		}
+		inputs[child] = v
+	}
+	return inputs, nil
+}
+
+// Complete copies the mapped child variables back under their parent names.
+func (n *SubworkflowNode) Complete(childVars map[string]any) (*ExecutionResult, error) {
+	child := &NodeContext{Variables: childVars}
+	output := make(map[string]any, len(n.OutputMapping))
+	for parent, name := range n.OutputMapping {
+		v, ok := child.Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("sub-workflow did not set variable %q", name)
+		}
+		output[parent] = v
+	}
+	return &ExecutionResult{Status: "completed", Output: output}, nil
+}
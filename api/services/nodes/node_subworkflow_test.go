@@ -0,0 +1,93 @@
+package nodes_test
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/services/nodes"
+)
+
+const childWorkflowID = "550e8400-e29b-41d4-a716-446655440000"
+
+func newSubworkflowNode(t *testing.T, meta string) *nodes.SubworkflowNode {
+	t.Helper()
+	node, err := nodes.NewSubworkflowNode(nodes.BaseFields{ID: "lookup", NodeType: "subworkflow", Metadata: json.RawMessage(meta)})
+	if err != nil {
+		t.Fatalf("NewSubworkflowNode: %v", err)
+	}
+	return node
+}
+
+func TestSubworkflowNode_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		meta    string
+		wantErr string
+	}{
+		{name: "valid", meta: `{"workflowId":"` + childWorkflowID + `","version":2,"inputMapping":{"city":"town"},"outputMapping":{"temp":"temperature"}}`},
+		{name: "missing workflow", meta: `{}`, wantErr: "workflowId must be a workflow UUID"},
+		{name: "invalid workflow", meta: `{"workflowId":"weather"}`, wantErr: "workflowId must be a workflow UUID"},
+		{name: "negative version", meta: `{"workflowId":"` + childWorkflowID + `","version":-1}`, wantErr: "version must not be negative"},
+		{name: "blank input", meta: `{"workflowId":"` + childWorkflowID + `","inputMapping":{"city":""}}`, wantErr: "input mapping"},
+		{name: "blank output", meta: `{"workflowId":"` + childWorkflowID + `","outputMapping":{"":"temperature"}}`, wantErr: "output mapping"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := newSubworkflowNode(t, tt.meta).Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSubworkflowNode_Mapping(t *testing.T) {
+	t.Parallel()
+	node := newSubworkflowNode(t, `{"workflowId":"`+childWorkflowID+`","version":3,"inputMapping":{"city":"town"},"outputMapping":{"temp":"temperature"}}`)
+
+	id, version := node.Target()
+	if id != uuid.MustParse(childWorkflowID) || version != 3 {
+		t.Errorf("Target() = %s, %d", id, version)
+	}
+
+	inputs, err := node.ChildInputs(&nodes.NodeContext{Variables: map[string]any{"town": "Sydney", "name": "Alice"}})
+	if err != nil {
+		t.Fatalf("ChildInputs: %v", err)
+	}
+	if want := map[string]any{"city": "Sydney"}; !reflect.DeepEqual(inputs, want) {
+		t.Errorf("ChildInputs() = %v, want %v", inputs, want)
+	}
+	if _, err := node.ChildInputs(&nodes.NodeContext{Variables: map[string]any{}}); err == nil || !strings.Contains(err.Error(), "missing required variable: town") {
+		t.Errorf("expected missing variable error, got %v", err)
+	}
+
+	result, err := node.Complete(map[string]any{"temperature": 31.5, "city": "Sydney"})
+	if err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if want := map[string]any{"temp": 31.5}; !reflect.DeepEqual(result.Output, want) {
+		t.Errorf("Complete() output = %v, want %v", result.Output, want)
+	}
+	if _, err := node.Complete(map[string]any{}); err == nil || !strings.Contains(err.Error(), `did not set variable "temperature"`) {
+		t.Errorf("expected unset variable error, got %v", err)
+	}
+
+	if _, err := node.Execute(context.Background(), &nodes.NodeContext{}); err == nil {
+		t.Error("expected Execute to fail outside the engine")
+	}
+}
@@ -197,6 +197,12 @@ func TestNodeFactory(t *testing.T) {
 		{name: "end", nodeType: "end", metadata: `{}`},
 		{name: "form", nodeType: "form", metadata: `{"inputFields":["name"]}`},
 		{name: "condition", nodeType: "condition", metadata: `{"conditionVariable":"temp"}`},
+		{name: "approval", nodeType: "approval", metadata: `{"title":"Approve?"}`},
+		{name: "input", nodeType: "input", metadata: `{"title":"Phone?","fields":["phone"]}`},
+		{name: "delay", nodeType: "delay", metadata: `{"duration":"15m"}`},
+		{name: "wait_until", nodeType: "wait_until", metadata: `{"until":"2030-01-01T00:00:00Z"}`},
+		{name: "foreach", nodeType: "foreach", metadata: `{"items":"cities"}`},
+		{name: "subworkflow", nodeType: "subworkflow", metadata: `{"workflowId":"550e8400-e29b-41d4-a716-446655440000"}`},
 		{name: "unknown type", nodeType: "foobar", metadata: `{}`, wantErr: true},
 	}
 
@@ -219,3 +225,38 @@ func TestNodeFactory(t *testing.T) {
 		})
 	}
 }
+
+func TestNodeContext_Lookup(t *testing.T) {
+	t.Parallel()
+
+	nCtx := &nodes.NodeContext{Variables: map[string]any{"temperature": 10.0}}
+	nCtx.SetOutput("weather-api", map[string]any{"temperature": 30.0})
+	nCtx.SetOutput("v1.2", map[string]any{"ok": true})
+	iteration := &nodes.NodeContext{Variables: map[string]any{nodes.NodesVariable: nCtx.Variables[nodes.NodesVariable]}}
+	iteration.SetOutput("weather-api", map[string]any{"temperature": 5.0})
+
+	tests := []struct {
+		name   string
+		nCtx   *nodes.NodeContext
+		lookup string
+		want   any
+		wantOK bool
+	}{
+		{name: "flat name", nCtx: nCtx, lookup: "temperature", want: 10.0, wantOK: true},
+		{name: "scoped name", nCtx: nCtx, lookup: "nodes.weather-api.temperature", want: 30.0, wantOK: true},
+		{name: "node ID with dots", nCtx: nCtx, lookup: "nodes.v1.2.ok", want: true, wantOK: true},
+		{name: "unknown node", nCtx: nCtx, lookup: "nodes.email.temperature", wantOK: false},
+		{name: "unknown key", nCtx: nCtx, lookup: "nodes.weather-api.humidity", wantOK: false},
+		{name: "no key", nCtx: nCtx, lookup: "nodes.weather-api", wantOK: false},
+		{name: "copied context keeps its own outputs", nCtx: iteration, lookup: "nodes.weather-api.temperature", want: 5.0, wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, ok := tt.nCtx.Lookup(tt.lookup)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("Lookup(%q) = %v, %v; want %v, %v", tt.lookup, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
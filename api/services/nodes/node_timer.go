@@ -0,0 +1,122 @@
+package nodes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// timerResult suspends the run until until, or completes the node straight
+// away when that time has already passed.
+func timerResult(until time.Time) *ExecutionResult {
+	if !until.After(time.Now()) {
+		return &ExecutionResult{Status: "completed", Output: map[string]any{}}
+	}
+	return &ExecutionResult{
+		Status:  "waiting",
+		Suspend: &Suspension{Kind: SuspendTimer, Until: until.UTC()},
+	}
+}
+
+// resumeTimer completes a timer node once its timer has fired.
+func resumeTimer(nodeType, id string, res Resolution) (*ExecutionResult, error) {
+	if res.Outcome != OutcomeElapsed {
+		return nil, fmt.Errorf("%s node %q: unsupported outcome %q", nodeType, id, res.Outcome)
+	}
+	return &ExecutionResult{Status: "completed", Output: map[string]any{}}, nil
+}
+
+// DelayNode pauses the run for a fixed duration. The timer is stored with
+// the run rather than held in a goroutine, so a long delay survives a
+// restart and does not keep the execute request open.
+type DelayNode struct {
+	BaseFields
+	Duration string `json:"duration"` // Go duration, e.g. "15m"
+}
+
+func NewDelayNode(base BaseFields) (*DelayNode, error) {
+	n := &DelayNode{BaseFields: base}
+	if err := json.Unmarshal(base.Metadata, n); err != nil {
+		return nil, fmt.Errorf("invalid delay metadata: %w", err)
+	}
+	return n, nil
+}
+
+func (n *DelayNode) Validate() error {
+	d, err := time.ParseDuration(n.Duration)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("delay node %q: duration must be a positive duration like \"15m\", got %q", n.ID, n.Duration)
+	}
+	return nil
+}
+
+// Execute suspends the run until the delay has passed.
+func (n *DelayNode) Execute(_ context.Context, _ *NodeContext) (*ExecutionResult, error) {
+	d, _ := time.ParseDuration(n.Duration) // checked by Validate
+	return timerResult(time.Now().Add(d)), nil
+}
+
+func (n *DelayNode) Resume(_ *NodeContext, res Resolution) (*ExecutionResult, error) {
+	return resumeTimer("delay", n.ID, res)
+}
+
+// WaitUntilNode pauses the run until a point in time: an RFC 3339
+// timestamp, or a {{variable}} holding one. A time in the past lets the run
+// continue immediately.
+type WaitUntilNode struct {
+	BaseFields
+	Until          string   `json:"until"`
+	InputVariables []string `json:"inputVariables"`
+}
+
+func NewWaitUntilNode(base BaseFields) (*WaitUntilNode, error) {
+	n := &WaitUntilNode{BaseFields: base}
+	if err := json.Unmarshal(base.Metadata, n); err != nil {
+		return nil, fmt.Errorf("invalid wait_until metadata: %w", err)
+	}
+	return n, nil
+}
+
+func (n *WaitUntilNode) Validate() error {
+	if strings.TrimSpace(n.Until) == "" {
+		return fmt.Errorf("wait_until node %q: missing until", n.ID)
+	}
+	placeholders := extractPlaceholders(n.Until)
+	if len(placeholders) == 0 {
+		if _, err := time.Parse(time.RFC3339, n.Until); err != nil {
+			return fmt.Errorf("wait_until node %q: until must be an RFC 3339 time or a {{variable}}, got %q", n.ID, n.Until)
+		}
+		return nil
+	}
+	inputSet := make(map[string]bool, len(n.InputVariables))
+	for _, v := range n.InputVariables {
+		inputSet[v] = true
+	}
+	for _, placeholder := range placeholders {
+		if !inputSet[placeholder] {
+			return fmt.Errorf("wait_until node %q: template references {{%s}} not in input variables", n.ID, placeholder)
+		}
+	}
+	return nil
+}
+
+// Execute resolves the time and suspends the run until it.
+func (n *WaitUntilNode) Execute(_ context.Context, nCtx *NodeContext) (*ExecutionResult, error) {
+	for _, v := range n.InputVariables {
+		if _, ok := nCtx.Lookup(v); !ok {
+			return nil, fmt.Errorf("missing required variable: %s", v)
+		}
+	}
+	raw := resolveTemplate(n.Until, nCtx)
+	until, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid until time %q: expected RFC 3339", raw)
+	}
+	return timerResult(until), nil
+}
+
+func (n *WaitUntilNode) Resume(_ *NodeContext, res Resolution) (*ExecutionResult, error) {
+	return resumeTimer("wait_until", n.ID, res)
+}
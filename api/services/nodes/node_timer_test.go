@@ -0,0 +1,114 @@
+package nodes_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"workflow-code-test/api/services/nodes"
+)
+
+func TestTimerNodes_Validate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		nodeType string
+		meta     string
+		wantErr  string
+	}{
+		{name: "delay", nodeType: "delay", meta: `{"duration":"15m"}`},
+		{name: "delay without duration", nodeType: "delay", meta: `{}`, wantErr: "duration must be a positive duration"},
+		{name: "negative delay", nodeType: "delay", meta: `{"duration":"-1m"}`, wantErr: "duration must be a positive duration"},
+		{name: "wait_until timestamp", nodeType: "wait_until", meta: `{"until":"2030-01-01T09:00:00+10:00"}`},
+		{name: "wait_until variable", nodeType: "wait_until", meta: `{"until":"{{checkAt}}","inputVariables":["checkAt"]}`},
+		{name: "wait_until missing until", nodeType: "wait_until", meta: `{}`, wantErr: "missing until"},
+		{name: "wait_until invalid timestamp", nodeType: "wait_until", meta: `{"until":"tomorrow"}`, wantErr: "RFC 3339"},
+		{name: "wait_until undeclared variable", nodeType: "wait_until", meta: `{"until":"{{checkAt}}"}`, wantErr: "template references {{checkAt}} not in input variables"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			node, err := nodes.New(nodes.BaseFields{ID: "wait", NodeType: tt.nodeType, Metadata: json.RawMessage(tt.meta)}, nodes.Deps{})
+			if err != nil {
+				t.Fatalf("failed to create %s node: %v", tt.nodeType, err)
+			}
+			err = node.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestDelayNode_SuspendAndResume(t *testing.T) {
+	t.Parallel()
+	node, err := nodes.NewDelayNode(nodes.BaseFields{ID: "pause", NodeType: "delay", Metadata: json.RawMessage(`{"duration":"15m"}`)})
+	if err != nil {
+		t.Fatalf("NewDelayNode: %v", err)
+	}
+	nCtx := &nodes.NodeContext{Variables: map[string]any{}}
+
+	before := time.Now()
+	result, err := node.Execute(context.Background(), nCtx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s := result.Suspend
+	if result.Status != "waiting" || s == nil || s.Kind != nodes.SuspendTimer {
+		t.Fatalf("expected a timer suspension, got %+v", result)
+	}
+	if s.Until.Before(before.Add(15*time.Minute)) || s.Until.After(time.Now().Add(15*time.Minute)) {
+		t.Errorf("expected the timer to fire in 15m, got %v", s.Until)
+	}
+
+	result, err = node.Resume(nCtx, nodes.Resolution{Outcome: nodes.OutcomeElapsed})
+	if err != nil || result.Status != "completed" || result.Branch != "" {
+		t.Errorf("expected the node to complete, got %+v, %v", result, err)
+	}
+	if _, err := node.Resume(nCtx, nodes.Resolution{Outcome: nodes.OutcomeApproved}); err == nil {
+		t.Error("expected an error for a non-timer outcome")
+	}
+}
+
+func TestWaitUntilNode_Execute(t *testing.T) {
+	t.Parallel()
+	node, err := nodes.NewWaitUntilNode(nodes.BaseFields{ID: "wait", NodeType: "wait_until",
+		Metadata: json.RawMessage(`{"until":"{{checkAt}}","inputVariables":["checkAt"]}`)})
+	if err != nil {
+		t.Fatalf("NewWaitUntilNode: %v", err)
+	}
+
+	future := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+	result, err := node.Execute(context.Background(), &nodes.NodeContext{Variables: map[string]any{"checkAt": future.Format(time.RFC3339)}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Suspend == nil || !result.Suspend.Until.Equal(future) {
+		t.Fatalf("expected a timer until %v, got %+v", future, result)
+	}
+
+	// A time that has already passed does not suspend the run.
+	result, err = node.Execute(context.Background(), &nodes.NodeContext{Variables: map[string]any{"checkAt": "2020-01-01T00:00:00Z"}})
+	if err != nil || result.Suspend != nil || result.Status != "completed" {
+		t.Errorf("expected the node to complete immediately, got %+v, %v", result, err)
+	}
+
+	_, err = node.Execute(context.Background(), &nodes.NodeContext{Variables: map[string]any{"checkAt": "soon"}})
+	if err == nil || !strings.Contains(err.Error(), `invalid until time "soon"`) {
+		t.Errorf("expected an invalid time error, got %v", err)
+	}
+	_, err = node.Execute(context.Background(), &nodes.NodeContext{Variables: map[string]any{}})
+	if err == nil || !strings.Contains(err.Error(), "missing required variable: checkAt") {
+		t.Errorf("expected a missing variable error, got %v", err)
+	}
+}
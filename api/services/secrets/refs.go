@@ -0,0 +1,89 @@
+package secrets
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// refPattern matches a reference to a secret in node metadata.
+var refPattern = regexp.MustCompile(`\{\{secret:([A-Za-z_][A-Za-z0-9_]*)\}\}`)
+
+// Refs returns the names of the secrets raw refers to, sorted and without
+// duplicates.
+func Refs(raw []byte) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, m := range refPattern.FindAllSubmatch(raw, -1) {
+		if name := string(m[1]); !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Expand replaces every reference in the JSON document raw with the value
+// of the secret, escaped for the JSON string it appears in. References are
+// only meaningful inside strings; values[name] must hold every name Refs
+// returns.
+func Expand(raw json.RawMessage, values map[string]string) json.RawMessage {
+	return refPattern.ReplaceAllFunc(raw, func(ref []byte) []byte {
+		name := string(refPattern.FindSubmatch(ref)[1])
+		return []byte(escape(values[name]))
+	})
+}
+
+// minRedacted is the shortest value Redactor hides; shorter ones would
+// mangle unrelated text.
+const minRedacted = 4
+
+// Redactor replaces the values of secrets with "[secret:NAME]" in text
+// produced while they were in use.
+type Redactor struct {
+	r *strings.Replacer
+}
+
+// NewRedactor returns a Redactor for values, keyed by secret name. It
+// matches each value both as is and as escaped in a JSON string.
+func NewRedactor(values map[string]string) *Redactor {
+	type pair struct{ old, new string }
+	var pairs []pair
+	for name, v := range values {
+		if len(v) < minRedacted {
+			continue
+		}
+		mask := "[secret:" + name + "]"
+		pairs = append(pairs, pair{v, mask})
+		if e := escape(v); e != v {
+			pairs = append(pairs, pair{e, mask})
+		}
+	}
+	// strings.Replacer tries the pairs in order, so a value containing
+	// another is replaced whole.
+	sort.Slice(pairs, func(i, j int) bool { return len(pairs[i].old) > len(pairs[j].old) })
+	if len(pairs) == 0 {
+		return &Redactor{}
+	}
+	args := make([]string, 0, 2*len(pairs))
+	for _, p := range pairs {
+		args = append(args, p.old, p.new)
+	}
+	return &Redactor{r: strings.NewReplacer(args...)}
+}
+
+// Redact returns s with the values replaced.
+func (r *Redactor) Redact(s string) string {
+	if r == nil || r.r == nil {
+		return s
+	}
+	return r.r.Replace(s)
+}
+
+// escape returns v as the body of a JSON string, without the quotes.
+func escape(v string) string {
+	b, _ := json.Marshal(v)
+	return string(b[1 : len(b)-1])
+}
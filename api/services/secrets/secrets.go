@@ -0,0 +1,95 @@
+// Package secrets encrypts the values node metadata refers to as
+// {{secret:NAME}} and expands those references when a workflow runs.
+// Values are sealed with AES-256-GCM under a key from the environment, so
+// the database only ever holds ciphertext.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// KeySize is the length of a secrets key: AES-256.
+const KeySize = 32
+
+// maxName is the length of secrets.name.
+const maxName = 128
+
+var namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidName reports whether name can name a secret, as the secrets table
+// checks it: letters, digits and underscores, not starting with a digit.
+func ValidName(name string) bool {
+	return len(name) <= maxName && namePattern.MatchString(name)
+}
+
+// ParseKey decodes a base64 secrets key, as set in SECRETS_KEY.
+func ParseKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("secrets key is not base64: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("secrets key must be %d bytes, got %d", KeySize, len(key))
+	}
+	return key, nil
+}
+
+// Box seals and opens secret values. The workspace and name of a secret
+// are bound to its ciphertext, so a value copied to another row does not
+// open.
+type Box struct {
+	aead cipher.AEAD
+}
+
+// NewBox returns a Box for a KeySize key.
+func NewBox(key []byte) (*Box, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("secrets key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("secrets cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("secrets cipher: %w", err)
+	}
+	return &Box{aead: aead}, nil
+}
+
+// Seal encrypts the value of a secret. The ciphertext starts with its
+// random nonce.
+func (b *Box) Seal(workspace, name, value string) ([]byte, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("seal secret %s: %w", name, err)
+	}
+	return b.aead.Seal(nonce, nonce, []byte(value), additionalData(workspace, name)), nil
+}
+
+// ErrUnreadable is returned by Open when a ciphertext was not sealed with
+// this key for this workspace and name, or has been tampered with.
+var ErrUnreadable = errors.New("secret cannot be decrypted")
+
+// Open decrypts a value sealed by Seal.
+func (b *Box) Open(workspace, name string, ciphertext []byte) (string, error) {
+	n := b.aead.NonceSize()
+	if len(ciphertext) < n {
+		return "", fmt.Errorf("secret %s: %w", name, ErrUnreadable)
+	}
+	plain, err := b.aead.Open(nil, ciphertext[:n], ciphertext[n:], additionalData(workspace, name))
+	if err != nil {
+		return "", fmt.Errorf("secret %s: %w", name, ErrUnreadable)
+	}
+	return string(plain), nil
+}
+
+func additionalData(workspace, name string) []byte {
+	return []byte(workspace + "/" + name)
+}
@@ -0,0 +1,111 @@
+package secrets_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"workflow-code-test/api/services/secrets"
+)
+
+var testKey = bytes.Repeat([]byte{7}, secrets.KeySize)
+
+func TestParseKey(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		in      string
+		wantErr bool
+	}{
+		{"32 bytes", base64.StdEncoding.EncodeToString(testKey), false},
+		{"too short", base64.StdEncoding.EncodeToString(testKey[:16]), true},
+		{"not base64", "not base64!", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := secrets.ParseKey(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && !bytes.Equal(key, testKey) {
+				t.Errorf("expected the decoded key, got %x", key)
+			}
+		})
+	}
+}
+
+func TestBox_SealOpen(t *testing.T) {
+	t.Parallel()
+	box, err := secrets.NewBox(testKey)
+	if err != nil {
+		t.Fatalf("NewBox: %v", err)
+	}
+	sealed, err := box.Seal("default", "API_KEY", "s3cr3t-value")
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if bytes.Contains(sealed, []byte("s3cr3t-value")) {
+		t.Fatal("expected the ciphertext not to contain the value")
+	}
+	again, _ := box.Seal("default", "API_KEY", "s3cr3t-value")
+	if bytes.Equal(sealed, again) {
+		t.Error("expected a fresh nonce per seal")
+	}
+	if got, err := box.Open("default", "API_KEY", sealed); err != nil || got != "s3cr3t-value" {
+		t.Errorf("Open: expected the value, got %q, %v", got, err)
+	}
+
+	other, _ := secrets.NewBox(bytes.Repeat([]byte{8}, secrets.KeySize))
+	for name, open := range map[string]func() (string, error){
+		"other workspace": func() (string, error) { return box.Open("team-a", "API_KEY", sealed) },
+		"other name":      func() (string, error) { return box.Open("default", "OTHER", sealed) },
+		"other key":       func() (string, error) { return other.Open("default", "API_KEY", sealed) },
+		"truncated":       func() (string, error) { return box.Open("default", "API_KEY", sealed[:4]) },
+	} {
+		if _, err := open(); !errors.Is(err, secrets.ErrUnreadable) {
+			t.Errorf("%s: expected ErrUnreadable, got %v", name, err)
+		}
+	}
+}
+
+func TestRefsAndExpand(t *testing.T) {
+	t.Parallel()
+	raw := json.RawMessage(`{"token":"{{secret:API_KEY}}","auth":"Bearer {{secret:API_KEY}}","from":"{{secret:SENDER}}","other":"{{secret:not valid}}"}`)
+	if got, want := secrets.Refs(raw), []string{"API_KEY", "SENDER"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Refs: expected %v, got %v", want, got)
+	}
+
+	expanded := secrets.Expand(raw, map[string]string{"API_KEY": `a"b\c`, "SENDER": "ops@example.com"})
+	var got map[string]string
+	if err := json.Unmarshal(expanded, &got); err != nil {
+		t.Fatalf("expected valid JSON, got %s: %v", expanded, err)
+	}
+	want := map[string]string{"token": `a"b\c`, "auth": `Bearer a"b\c`, "from": "ops@example.com", "other": "{{secret:not valid}}"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expand: expected %v, got %v", want, got)
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	t.Parallel()
+	r := secrets.NewRedactor(map[string]string{"API_KEY": `tok"en-123`, "LONG": "tok\"en-123-extended", "PIN": "42"})
+	tests := []struct {
+		name, in, want string
+	}{
+		{"plain value", `call failed: tok"en-123`, `call failed: [secret:API_KEY]`},
+		{"json escaped value", `{"auth":"tok\"en-123"}`, `{"auth":"[secret:API_KEY]"}`},
+		{"longer value first", `tok"en-123-extended`, `[secret:LONG]`},
+		{"short values kept", `pin 42`, `pin 42`},
+	}
+	for _, tt := range tests {
+		if got := r.Redact(tt.in); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+	if got := secrets.NewRedactor(nil).Redact("unchanged"); got != "unchanged" {
+		t.Errorf("expected an empty redactor to keep text, got %q", got)
+	}
+}
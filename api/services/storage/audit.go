@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// AuditInfo says who makes the changes of a request, for the audit events
+// storage writes with them.
+type AuditInfo struct {
+	Actor     string
+	RequestID string
+}
+
+type auditInfoKey struct{}
+
+// WithAuditInfo returns ctx carrying info. Changes made with ctx record it
+// in their audit events; without it, events have an empty actor and
+// request ID.
+func WithAuditInfo(ctx context.Context, info AuditInfo) context.Context {
+	return context.WithValue(ctx, auditInfoKey{}, info)
+}
+
+func auditInfoFrom(ctx context.Context) AuditInfo {
+	info, _ := ctx.Value(auditInfoKey{}).(AuditInfo)
+	return info
+}
+
+// auditWorkflow is the state of a workflow that audit events diff: what
+// UpsertWorkflow writes. Node labels and metadata belong to the library.
+type auditWorkflow struct {
+	Name     string           `json:"name"`
+	Settings WorkflowSettings `json:"settings"`
+	Nodes    []auditNode      `json:"nodes"`
+	Edges    []Edge           `json:"edges"`
+}
+
+type auditNode struct {
+	ID        string       `json:"id"`
+	Type      string       `json:"type"`
+	LibraryID string       `json:"libraryId"`
+	Position  NodePosition `json:"position"`
+}
+
+// auditLibraryEntry is the state of a node_library entry that audit
+// events diff.
+type auditLibraryEntry struct {
+	NodeType    string          `json:"nodeType"`
+	Label       string          `json:"baseLabel"`
+	Description string          `json:"baseDescription"`
+	Metadata    json.RawMessage `json:"metadata"`
+}
+
+// auditPublish is the part of a workflow a publish changes.
+type auditPublish struct {
+	Version    int    `json:"version,omitempty"`
+	SnapshotID string `json:"snapshotId,omitempty"`
+}
+
+// auditChange is a changed field in an audit diff.
+type auditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// auditDiff returns the fields that differ between two states, by path.
+// A nil state, as before a create or after a delete, has no fields. Arrays
+// of objects with unique string ids are compared by id, so moving one node
+// is one change rather than one per node after it.
+func auditDiff(before, after any) (json.RawMessage, error) {
+	a, err := auditValue(before)
+	if err != nil {
+		return nil, err
+	}
+	b, err := auditValue(after)
+	if err != nil {
+		return nil, err
+	}
+	changes := make(map[string]auditChange)
+	diffValues("", a, b, changes)
+	diff, err := json.Marshal(changes)
+	if err != nil {
+		return nil, fmt.Errorf("encode audit diff: %w", err)
+	}
+	return diff, nil
+}
+
+// auditValue decodes v's JSON into maps and slices, an empty object for nil.
+func auditValue(v any) (any, error) {
+	if v == nil || (reflect.ValueOf(v).Kind() == reflect.Pointer && reflect.ValueOf(v).IsNil()) {
+		return map[string]any{}, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("encode audit state: %w", err)
+	}
+	var out any
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("decode audit state: %w", err)
+	}
+	return out, nil
+}
+
+func diffValues(path string, a, b any, changes map[string]auditChange) {
+	am, aIsMap := a.(map[string]any)
+	bm, bIsMap := b.(map[string]any)
+	if aIsMap && bIsMap {
+		keys := make(map[string]bool, len(am)+len(bm))
+		for k := range am {
+			keys[k] = true
+		}
+		for k := range bm {
+			keys[k] = true
+		}
+		for k := range keys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			diffValues(p, am[k], bm[k], changes)
+		}
+		return
+	}
+	if ak, ok := byID(a); ok {
+		if bk, ok := byID(b); ok {
+			ids := make([]string, 0, len(ak)+len(bk))
+			for id := range ak {
+				ids = append(ids, id)
+			}
+			for id := range bk {
+				if _, seen := ak[id]; !seen {
+					ids = append(ids, id)
+				}
+			}
+			sort.Strings(ids)
+			for _, id := range ids {
+				diffValues(path+"["+id+"]", ak[id], bk[id], changes)
+			}
+			return
+		}
+	}
+	if !reflect.DeepEqual(a, b) {
+		changes[path] = auditChange{Before: a, After: b}
+	}
+}
+
+// byID indexes an array of objects by their id field. It reports false
+// when v is not such an array; nil counts as an empty one.
+func byID(v any) (map[string]any, bool) {
+	if v == nil {
+		return map[string]any{}, true
+	}
+	items, ok := v.([]any)
+	if !ok {
+		return nil, false
+	}
+	out := make(map[string]any, len(items))
+	for _, item := range items {
+		obj, ok := item.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		id, ok := obj["id"].(string)
+		if !ok || id == "" {
+			return nil, false
+		}
+		if _, dup := out[id]; dup {
+			return nil, false
+		}
+		out[id] = obj
+	}
+	return out, true
+}
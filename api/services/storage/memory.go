@@ -0,0 +1,1493 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// memLibraryEntry wraps a library blueprint with its soft-delete marker,
+// mirroring node_library.deleted_at.
+type memLibraryEntry struct {
+	NodeLibraryEntry
+	deletedAt *time.Time
+}
+
+// memInstance mirrors a workflow_node_instances row.
+type memInstance struct {
+	instanceID string
+	libraryID  string
+	position   NodePosition
+}
+
+// memWorkflow mirrors a workflows row plus its child instances and edges.
+type memWorkflow struct {
+	header    Workflow // Nodes and Edges are unused; children live below
+	workspace string
+	instances []memInstance
+	edges     []Edge
+	testCases []TestCase
+}
+
+// memStorage implements the Storage interface entirely in process memory.
+// It follows the same semantics as pgStorage — soft deletes, node type to
+// library mapping on save, immutable snapshots on publish — so it can stand
+// in for Postgres during local development and tests.
+type memStorage struct {
+	mu sync.RWMutex
+
+	library      map[string]*memLibraryEntry
+	libraryOrder []string // insertion order, used to resolve node types like a table scan
+	workflows    map[uuid.UUID]*memWorkflow
+	snapshots    map[uuid.UUID][]WorkflowSnapshot // workflow ID → snapshots by version
+	runs         map[uuid.UUID]*Run
+	tasks        map[uuid.UUID]*Task
+	idempotency  map[idempotencyID]*IdempotencyKey
+	apiKeys      map[uuid.UUID]*APIKey
+	audit        []AuditEvent // append-only, oldest first
+	workspaces   map[string]*Workspace
+	secrets      map[secretID]*Secret
+	limits       []ExecutionLimit
+}
+
+// secretID identifies a secret; names are scoped to a workspace.
+type secretID struct {
+	workspace string
+	name      string
+}
+
+// idempotencyID identifies an idempotency key; keys are scoped to a workflow.
+type idempotencyID struct {
+	workflowID uuid.UUID
+	key        string
+}
+
+// NewMemoryInstance creates a concurrency-safe in-memory Storage implementation
+// populated with the given fixtures. Pass SeedFixtures() to get the same data
+// the Flyway seed migrations load into Postgres.
+func NewMemoryInstance(fixtures Fixtures) (Storage, error) {
+	m := &memStorage{
+		library:   make(map[string]*memLibraryEntry),
+		workflows: make(map[uuid.UUID]*memWorkflow),
+		snapshots: make(map[uuid.UUID][]WorkflowSnapshot),
+		runs:      make(map[uuid.UUID]*Run),
+		tasks:     make(map[uuid.UUID]*Task),
+
+		idempotency: make(map[idempotencyID]*IdempotencyKey),
+		apiKeys:     make(map[uuid.UUID]*APIKey),
+		secrets:     make(map[secretID]*Secret),
+	}
+
+	now := time.Now()
+	m.workspaces = map[string]*Workspace{
+		DefaultWorkspaceID: {ID: DefaultWorkspaceID, Name: "Default", CreatedAt: now},
+	}
+	for _, entry := range fixtures.Library {
+		if _, err := uuid.Parse(entry.ID); err != nil {
+			return nil, fmt.Errorf("memory: invalid library entry id %q: %w", entry.ID, err)
+		}
+		if _, exists := m.library[entry.ID]; exists {
+			return nil, fmt.Errorf("memory: duplicate library entry %s", entry.ID)
+		}
+		e := entry
+		e.Metadata = cloneRaw(entry.Metadata)
+		if e.ModifiedAt.IsZero() {
+			e.ModifiedAt = now
+		}
+		m.library[e.ID] = &memLibraryEntry{NodeLibraryEntry: e}
+		m.libraryOrder = append(m.libraryOrder, e.ID)
+	}
+
+	for _, fw := range fixtures.Workflows {
+		if _, exists := m.workflows[fw.ID]; exists {
+			return nil, fmt.Errorf("memory: duplicate workflow %s", fw.ID)
+		}
+		mw := &memWorkflow{
+			header: Workflow{
+				ID:         fw.ID,
+				Name:       fw.Name,
+				Status:     "draft",
+				CreatedAt:  now,
+				ModifiedAt: now,
+			},
+			workspace: DefaultWorkspaceID,
+		}
+		for _, fi := range fw.Instances {
+			if _, ok := m.library[fi.LibraryID.String()]; !ok {
+				return nil, fmt.Errorf("memory: workflow %s instance %s references unknown library entry %s",
+					fw.ID, fi.InstanceID, fi.LibraryID)
+			}
+			mw.instances = append(mw.instances, memInstance{
+				instanceID: fi.InstanceID,
+				libraryID:  fi.LibraryID.String(),
+				position:   fi.Position,
+			})
+		}
+		mw.edges = cloneEdges(fw.Edges)
+		m.workflows[fw.ID] = mw
+	}
+	m.limits = append([]ExecutionLimit(nil), fixtures.Limits...)
+
+	return m, nil
+}
+
+// workflowIn returns the workflow with the given ID, deleted or not, if it
+// belongs to the workspace of ctx. Callers must hold m.mu.
+func (m *memStorage) workflowIn(ctx context.Context, id uuid.UUID) (*memWorkflow, bool) {
+	mw, ok := m.workflows[id]
+	if !ok || mw.workspace != WorkspaceFrom(ctx) {
+		return nil, false
+	}
+	return mw, true
+}
+
+// libraryVisible reports whether a library entry can be used in a
+// workspace: it is global or the workspace's own.
+func libraryVisible(entry *memLibraryEntry, workspaceID string) bool {
+	return entry.WorkspaceID == "" || entry.WorkspaceID == workspaceID
+}
+
+// GetWorkflow returns a hydrated copy of the workflow, skipping nodes whose
+// library blueprint has been soft-deleted (matching the Postgres join).
+func (m *memStorage) GetWorkflow(ctx context.Context, id uuid.UUID) (*Workflow, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	mw, ok := m.workflowIn(ctx, id)
+	if !ok || mw.header.DeletedAt != nil {
+		return nil, pgx.ErrNoRows
+	}
+
+	wf := mw.header
+	wf.ActiveSnapshotID = cloneUUIDPtr(mw.header.ActiveSnapshotID)
+	wf.Nodes = m.hydrateNodes(mw)
+	wf.Edges = cloneEdges(mw.edges)
+	if wf.Edges == nil {
+		wf.Edges = []Edge{}
+	}
+	return &wf, nil
+}
+
+// UpsertWorkflow replaces the workflow header, instances and edges atomically.
+// Library IDs are resolved the same way pgStorage does, among the entries
+// visible to the workspace: a pinned LibraryID must exist and match the node
+// type, otherwise the last library entry of a given type wins. Returns
+// ErrOtherWorkspace if the ID belongs to another workspace's workflow and
+// ErrQuotaExceeded if a new workflow would exceed the workspace's quota.
+func (m *memStorage) UpsertWorkflow(ctx context.Context, wf *Workflow) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.upsertWorkflow(ctx, wf)
+}
+
+// ImportWorkflow creates the library entries, then saves wf like
+// UpsertWorkflow. If any step fails, the entries and their audit events are
+// removed again. An entry whose ID is taken returns a *LibraryIDTakenError.
+func (m *memStorage) ImportWorkflow(ctx context.Context, wf *Workflow, entries []NodeLibraryEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	libraryLen, auditLen := len(m.libraryOrder), len(m.audit)
+	err := func() error {
+		for i := range entries {
+			if err := m.createLibraryEntry(ctx, &entries[i]); err != nil {
+				if errors.Is(err, ErrLibraryIDTaken) {
+					return &LibraryIDTakenError{ID: entries[i].ID}
+				}
+				return err
+			}
+		}
+		return m.upsertWorkflow(ctx, wf)
+	}()
+	if err != nil {
+		for _, id := range m.libraryOrder[libraryLen:] {
+			delete(m.library, id)
+		}
+		m.libraryOrder = m.libraryOrder[:libraryLen]
+		m.audit = m.audit[:auditLen]
+	}
+	return err
+}
+
+// upsertWorkflow implements UpsertWorkflow. Callers must hold m.mu.
+func (m *memStorage) upsertWorkflow(ctx context.Context, wf *Workflow) error {
+	workspaceID := WorkspaceFrom(ctx)
+	if mw, ok := m.workflows[wf.ID]; ok && mw.workspace != workspaceID {
+		return fmt.Errorf("workflow %s: %w", wf.ID, ErrOtherWorkspace)
+	}
+
+	// A type with several entries maps to the oldest global one, else the
+	// workspace's oldest, as in Postgres.
+	nodeLibraryIDs := make(map[string]uuid.UUID, len(m.libraryOrder))
+	nodeLibraryTypes := make(map[uuid.UUID]string, len(m.libraryOrder))
+	for _, id := range m.libraryOrder {
+		e := m.library[id]
+		if !libraryVisible(e, workspaceID) {
+			continue
+		}
+		libID := uuid.MustParse(id)
+		if prev, ok := nodeLibraryIDs[e.NodeType]; !ok || (e.WorkspaceID == "" && m.library[prev.String()].WorkspaceID != "") {
+			nodeLibraryIDs[e.NodeType] = libID
+		}
+		nodeLibraryTypes[libID] = e.NodeType
+	}
+
+	// Resolve everything before mutating so a failure leaves the store untouched.
+	// The checks below stand in for the primary and composite foreign keys
+	// on workflow_node_instances and workflow_edges.
+	instances := make([]memInstance, 0, len(wf.Nodes))
+	instanceIDs := make(map[string]bool, len(wf.Nodes))
+	for _, node := range wf.Nodes {
+		nodeLibraryID, err := resolveLibraryID(node, nodeLibraryIDs, nodeLibraryTypes)
+		if err != nil {
+			return err
+		}
+		if instanceIDs[node.ID] {
+			return fmt.Errorf("insert workflow node instance %s: duplicate instance id", node.ID)
+		}
+		instanceIDs[node.ID] = true
+		instances = append(instances, memInstance{
+			instanceID: node.ID,
+			libraryID:  nodeLibraryID.String(),
+			position:   node.Position,
+		})
+	}
+
+	edgeIDs := make(map[string]bool, len(wf.Edges))
+	for _, edge := range wf.Edges {
+		if edgeIDs[edge.ID] {
+			return fmt.Errorf("insert workflow edge %s: duplicate edge id", edge.ID)
+		}
+		edgeIDs[edge.ID] = true
+		if !instanceIDs[edge.Source] || !instanceIDs[edge.Target] {
+			return fmt.Errorf("insert workflow edge %s: references unknown node instance", edge.ID)
+		}
+	}
+
+	var before *auditWorkflow
+	action := AuditWorkflowCreate
+	if mw, ok := m.workflows[wf.ID]; ok && mw.header.DeletedAt == nil {
+		before = m.auditState(mw)
+		action = AuditWorkflowUpdate
+	}
+	if before == nil {
+		if err := m.checkWorkflowQuota(workspaceID); err != nil {
+			return err
+		}
+	}
+	after := &auditWorkflow{Name: wf.Name, Settings: wf.Settings, Nodes: make([]auditNode, 0, len(instances)), Edges: wf.Edges}
+	for i, inst := range instances {
+		after.Nodes = append(after.Nodes, auditNode{ID: inst.instanceID, Type: wf.Nodes[i].Type, LibraryID: inst.libraryID, Position: inst.position})
+	}
+	event, err := newAuditEvent(ctx, action, AuditTargetWorkflow, wf.ID.String(), before, after)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if wf.CreatedAt.IsZero() {
+		wf.CreatedAt = now
+	}
+	wf.ModifiedAt = now
+
+	mw, exists := m.workflows[wf.ID]
+	if !exists {
+		mw = &memWorkflow{
+			header: Workflow{
+				ID:        wf.ID,
+				Status:    "draft",
+				CreatedAt: wf.CreatedAt,
+			},
+			workspace: workspaceID,
+		}
+		m.workflows[wf.ID] = mw
+	}
+	mw.header.Name = wf.Name
+	mw.header.Settings = wf.Settings
+	mw.header.ModifiedAt = wf.ModifiedAt
+	mw.header.DeletedAt = nil
+	mw.instances = instances
+	mw.edges = cloneEdges(wf.Edges)
+	m.appendAudit(event)
+
+	return nil
+}
+
+// checkWorkflowQuota returns ErrQuotaExceeded if the workspace has no room
+// for another workflow. Callers must hold m.mu.
+func (m *memStorage) checkWorkflowQuota(workspaceID string) error {
+	ws, ok := m.workspaces[workspaceID]
+	if !ok {
+		return fmt.Errorf("lock workspace %s: %w", workspaceID, pgx.ErrNoRows)
+	}
+	if ws.MaxWorkflows == nil {
+		return nil
+	}
+	count := 0
+	for _, mw := range m.workflows {
+		if mw.workspace == workspaceID && mw.header.DeletedAt == nil {
+			count++
+		}
+	}
+	if count >= *ws.MaxWorkflows {
+		return fmt.Errorf("workspace %s allows %d workflows: %w", workspaceID, *ws.MaxWorkflows, ErrQuotaExceeded)
+	}
+	return nil
+}
+
+// DeleteWorkflow drops the workflow's instances and edges and soft-deletes
+// the header. Returns pgx.ErrNoRows if the workflow does not exist.
+func (m *memStorage) DeleteWorkflow(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mw, ok := m.workflowIn(ctx, id)
+	if !ok {
+		return pgx.ErrNoRows
+	}
+	if mw.header.DeletedAt == nil {
+		event, err := newAuditEvent(ctx, AuditWorkflowDelete, AuditTargetWorkflow, id.String(), m.auditState(mw), nil)
+		if err != nil {
+			return err
+		}
+		m.appendAudit(event)
+	}
+
+	now := time.Now()
+	mw.instances = nil
+	mw.edges = nil
+	mw.header.DeletedAt = &now
+	mw.header.ModifiedAt = now
+	return nil
+}
+
+// PublishWorkflow freezes the workflow's current DAG into a new snapshot
+// and points the workflow at it.
+func (m *memStorage) PublishWorkflow(ctx context.Context, id uuid.UUID) (*WorkflowSnapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mw, ok := m.workflowIn(ctx, id)
+	if !ok || mw.header.DeletedAt != nil {
+		return nil, pgx.ErrNoRows
+	}
+
+	dagData := DagData{Nodes: m.hydrateNodes(mw), Edges: cloneEdges(mw.edges), Settings: mw.header.Settings}
+	if dagData.Edges == nil {
+		dagData.Edges = []Edge{}
+	}
+
+	nextVersion := 1
+	if existing := m.snapshots[id]; len(existing) > 0 {
+		nextVersion = existing[len(existing)-1].VersionNumber + 1
+	}
+
+	snap := WorkflowSnapshot{
+		ID:            uuid.New(),
+		WorkflowID:    id,
+		VersionNumber: nextVersion,
+		DagData:       dagData,
+		PublishedAt:   time.Now(),
+	}
+	event, err := newAuditEvent(ctx, AuditWorkflowPublish, AuditTargetWorkflow, id.String(),
+		&auditPublish{Version: nextVersion - 1}, &auditPublish{Version: nextVersion, SnapshotID: snap.ID.String()})
+	if err != nil {
+		return nil, err
+	}
+	m.snapshots[id] = append(m.snapshots[id], snap)
+	m.appendAudit(event)
+
+	snapID := snap.ID
+	mw.header.Status = "published"
+	mw.header.ActiveSnapshotID = &snapID
+
+	return cloneSnapshot(snap), nil
+}
+
+// GetActiveSnapshot returns the snapshot the workflow currently points at.
+// Returns pgx.ErrNoRows for drafts and deleted workflows.
+func (m *memStorage) GetActiveSnapshot(ctx context.Context, workflowID uuid.UUID) (*WorkflowSnapshot, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	mw, ok := m.workflowIn(ctx, workflowID)
+	if !ok || mw.header.DeletedAt != nil || mw.header.ActiveSnapshotID == nil {
+		return nil, pgx.ErrNoRows
+	}
+
+	for _, snap := range m.snapshots[workflowID] {
+		if snap.ID == *mw.header.ActiveSnapshotID {
+			return cloneSnapshot(snap), nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+// GetSnapshot returns a specific published version of the workflow.
+// Returns pgx.ErrNoRows if the workflow is deleted or the version does not exist.
+func (m *memStorage) GetSnapshot(ctx context.Context, workflowID uuid.UUID, version int) (*WorkflowSnapshot, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	mw, ok := m.workflowIn(ctx, workflowID)
+	if !ok || mw.header.DeletedAt != nil {
+		return nil, pgx.ErrNoRows
+	}
+
+	for _, snap := range m.snapshots[workflowID] {
+		if snap.VersionNumber == version {
+			return cloneSnapshot(snap), nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+// ListNodeLibrary returns copies of every non-deleted blueprint visible to
+// the workspace in insertion order.
+func (m *memStorage) ListNodeLibrary(ctx context.Context) ([]NodeLibraryEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	workspaceID := WorkspaceFrom(ctx)
+	entries := make([]NodeLibraryEntry, 0, len(m.libraryOrder))
+	for _, id := range m.libraryOrder {
+		entry := m.library[id]
+		if entry.deletedAt != nil || !libraryVisible(entry, workspaceID) {
+			continue
+		}
+		e := entry.NodeLibraryEntry
+		e.Metadata = cloneRaw(entry.Metadata)
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// CreateNodeLibraryEntry adds a blueprint to the workspace, generating an ID
+// if entry.ID is empty. Like the node_library primary key, an existing ID in
+// any workspace is rejected with ErrLibraryIDTaken.
+func (m *memStorage) CreateNodeLibraryEntry(ctx context.Context, entry *NodeLibraryEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.createLibraryEntry(ctx, entry)
+}
+
+// createLibraryEntry implements CreateNodeLibraryEntry. Callers must hold
+// m.mu.
+func (m *memStorage) createLibraryEntry(ctx context.Context, entry *NodeLibraryEntry) error {
+	if entry.ID == "" {
+		entry.ID = uuid.NewString()
+	}
+	id, err := uuid.Parse(entry.ID)
+	if err != nil {
+		return fmt.Errorf("invalid library id %q: %w", entry.ID, err)
+	}
+	entry.ID = id.String()
+	if _, exists := m.library[entry.ID]; exists {
+		return fmt.Errorf("node_library entry %s: %w", entry.ID, ErrLibraryIDTaken)
+	}
+
+	entry.WorkspaceID = WorkspaceFrom(ctx)
+	e := *entry
+	e.Metadata = cloneRaw(entry.Metadata)
+	if e.Metadata == nil {
+		e.Metadata = json.RawMessage(`{}`)
+	}
+	after := &auditLibraryEntry{NodeType: e.NodeType, Label: e.Label, Description: e.Description, Metadata: e.Metadata}
+	event, err := newAuditEvent(ctx, AuditLibraryCreate, AuditTargetNodeLibrary, e.ID, nil, after)
+	if err != nil {
+		return err
+	}
+
+	entry.ModifiedAt = time.Now()
+	e.ModifiedAt = entry.ModifiedAt
+	m.library[e.ID] = &memLibraryEntry{NodeLibraryEntry: e}
+	m.libraryOrder = append(m.libraryOrder, e.ID)
+	m.appendAudit(event)
+	return nil
+}
+
+// ListTestCases returns copies of the workflow's test cases in saved order.
+// Returns pgx.ErrNoRows if the workflow does not exist.
+func (m *memStorage) ListTestCases(ctx context.Context, workflowID uuid.UUID) ([]TestCase, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	mw, ok := m.workflowIn(ctx, workflowID)
+	if !ok || mw.header.DeletedAt != nil {
+		return nil, pgx.ErrNoRows
+	}
+	return cloneTestCases(mw.testCases), nil
+}
+
+// ReplaceTestCases swaps the workflow's test cases for the given list.
+// Like the table's unique constraint, duplicate names are rejected.
+func (m *memStorage) ReplaceTestCases(ctx context.Context, workflowID uuid.UUID, cases []TestCase) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mw, ok := m.workflowIn(ctx, workflowID)
+	if !ok || mw.header.DeletedAt != nil {
+		return pgx.ErrNoRows
+	}
+
+	seen := make(map[string]bool, len(cases))
+	for _, tc := range cases {
+		if seen[tc.Name] {
+			return fmt.Errorf("insert test case %q: duplicate name", tc.Name)
+		}
+		seen[tc.Name] = true
+	}
+
+	now := time.Now()
+	for i := range cases {
+		cases[i].ModifiedAt = now
+	}
+	mw.testCases = cloneTestCases(cases)
+	return nil
+}
+
+// CreateRun records a workflow execution and fills in WorkspaceID and
+// CreatedAt. Returns pgx.ErrNoRows if the workflow does not exist and
+// ErrQuotaExceeded if the workspace has recorded as many runs in the last
+// hour as it allows.
+func (m *memStorage) CreateRun(ctx context.Context, run *Run) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mw, ok := m.workflowIn(ctx, run.WorkflowID)
+	if !ok || mw.header.DeletedAt != nil {
+		return pgx.ErrNoRows
+	}
+	if _, ok := m.runs[run.ID]; ok {
+		return fmt.Errorf("insert run %s: duplicate id", run.ID)
+	}
+	now := time.Now()
+	if err := m.checkRunQuota(mw.workspace, now); err != nil {
+		return err
+	}
+
+	run.WorkspaceID = mw.workspace
+	run.CreatedAt = now
+	m.runs[run.ID] = cloneRun(*run)
+	return nil
+}
+
+// GetRun returns a copy of a recorded execution of the workflow.
+// Returns pgx.ErrNoRows if the run does not exist or belongs to another workflow.
+func (m *memStorage) GetRun(ctx context.Context, workflowID, runID uuid.UUID) (*Run, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	run, ok := m.runs[runID]
+	if !ok || run.WorkflowID != workflowID || run.WorkspaceID != WorkspaceFrom(ctx) {
+		return nil, pgx.ErrNoRows
+	}
+	return cloneRun(*run), nil
+}
+
+// UpdateRun saves the status, failed node, duration, result, calls, state
+// and resume time of a run that was resumed. Returns pgx.ErrNoRows if the
+// run does not exist.
+func (m *memStorage) UpdateRun(ctx context.Context, run *Run) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.runs[run.ID]
+	if !ok || stored.WorkspaceID != WorkspaceFrom(ctx) {
+		return pgx.ErrNoRows
+	}
+	stored.Inputs = cloneRaw(run.Inputs)
+	stored.Status = run.Status
+	stored.FailedNode = run.FailedNode
+	stored.DurationMs = run.DurationMs
+	stored.Result = cloneRaw(run.Result)
+	stored.Calls = cloneRaw(run.Calls)
+	stored.State = cloneRaw(run.State)
+	stored.Sealed = append([]byte(nil), run.Sealed...)
+	stored.ResumeAt = cloneTime(run.ResumeAt)
+	return nil
+}
+
+// ClaimDueRuns returns up to limit runs whose timer is due at now, oldest
+// first, and moves their resume time to retryAt.
+func (m *memStorage) ClaimDueRuns(_ context.Context, now, retryAt time.Time, limit int) ([]Run, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var due []*Run
+	for _, run := range m.runs {
+		if run.ResumeAt != nil && !run.ResumeAt.After(now) {
+			due = append(due, run)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].ResumeAt.Equal(*due[j].ResumeAt) {
+			return due[i].ResumeAt.Before(*due[j].ResumeAt)
+		}
+		return due[i].ID.String() < due[j].ID.String()
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	runs := make([]Run, 0, len(due))
+	for _, run := range due {
+		run.ResumeAt = cloneTime(&retryAt)
+		runs = append(runs, *cloneRun(*run))
+	}
+	return runs, nil
+}
+
+// ListRuns returns copies of the runs matching filter, newest first.
+// Result, Calls and State are not loaded; GetRun returns a whole run.
+func (m *memStorage) ListRuns(ctx context.Context, filter RunFilter) ([]Run, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	matched, err := m.matchRuns(WorkspaceFrom(ctx), filter)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(matched, func(i, j int) bool { return runBefore(matched[j], matched[i]) })
+
+	runs := []Run{}
+	for _, run := range matched {
+		if c := filter.Cursor; c != nil && !runBefore(run, &Run{ID: c.ID, CreatedAt: c.CreatedAt}) {
+			continue
+		}
+		if filter.Limit > 0 && len(runs) == filter.Limit {
+			break
+		}
+		summary := *cloneRun(*run)
+		summary.Result, summary.Calls, summary.State = nil, nil, nil
+		runs = append(runs, summary)
+	}
+	return runs, nil
+}
+
+// RunStats aggregates the runs matching filter. Percentiles interpolate
+// between durations like percentile_cont; runs still running or waiting
+// are left out of them, and only failed runs count towards FailingNodes.
+func (m *memStorage) RunStats(ctx context.Context, filter RunFilter) (*RunStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	matched, err := m.matchRuns(WorkspaceFrom(ctx), filter)
+	if err != nil {
+		return nil, err
+	}
+	stats := &RunStats{ByStatus: map[string]int{}, FailingNodes: []NodeFailures{}}
+	var durations []float64
+	failures := make(map[string]int)
+	for _, run := range matched {
+		stats.Total++
+		stats.ByStatus[run.Status]++
+		if run.Status != "running" && run.Status != "waiting" {
+			durations = append(durations, float64(run.DurationMs))
+		}
+		if run.Status == "failed" && run.FailedNode != "" {
+			failures[run.FailedNode]++
+		}
+	}
+	sort.Float64s(durations)
+	stats.P50DurationMs = percentile(durations, 0.5)
+	stats.P95DurationMs = percentile(durations, 0.95)
+
+	for node, n := range failures {
+		stats.FailingNodes = append(stats.FailingNodes, NodeFailures{NodeID: node, Failures: n})
+	}
+	sort.Slice(stats.FailingNodes, func(i, j int) bool {
+		a, b := stats.FailingNodes[i], stats.FailingNodes[j]
+		if a.Failures != b.Failures {
+			return a.Failures > b.Failures
+		}
+		return a.NodeID < b.NodeID
+	})
+	if len(stats.FailingNodes) > failingNodesLimit {
+		stats.FailingNodes = stats.FailingNodes[:failingNodesLimit]
+	}
+	return stats, nil
+}
+
+// checkRunQuota returns ErrQuotaExceeded if the workspace has recorded as
+// many runs in the hour before now as it allows. Callers must hold m.mu.
+func (m *memStorage) checkRunQuota(workspaceID string, now time.Time) error {
+	ws, ok := m.workspaces[workspaceID]
+	if !ok {
+		return fmt.Errorf("lock workspace %s: %w", workspaceID, pgx.ErrNoRows)
+	}
+	if ws.MaxRunsPerHour == nil {
+		return nil
+	}
+	since := now.Add(-time.Hour)
+	count := 0
+	for _, run := range m.runs {
+		if run.WorkspaceID == workspaceID && !run.CreatedAt.Before(since) {
+			count++
+		}
+	}
+	if count >= *ws.MaxRunsPerHour {
+		return fmt.Errorf("workspace %s allows %d runs per hour: %w", workspaceID, *ws.MaxRunsPerHour, ErrQuotaExceeded)
+	}
+	return nil
+}
+
+// ListRetentionPolicies returns the workflows of every workspace, deleted
+// ones included, whose settings have a retention policy.
+func (m *memStorage) ListRetentionPolicies(_ context.Context) ([]WorkflowRetention, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	policies := []WorkflowRetention{}
+	for id, mw := range m.workflows {
+		if mw.header.Settings.Retention != (RetentionPolicy{}) {
+			policies = append(policies, WorkflowRetention{WorkflowID: id, WorkspaceID: mw.workspace, Policy: mw.header.Settings.Retention})
+		}
+	}
+	sort.Slice(policies, func(i, j int) bool {
+		return policies[i].WorkflowID.String() < policies[j].WorkflowID.String()
+	})
+	return policies, nil
+}
+
+// PruneRuns deletes up to limit of the runs that filter selects, oldest
+// first, along with their tasks, and returns how many it deleted. The runs
+// are passed to archive, if not nil, first; if archive fails nothing is
+// deleted.
+func (m *memStorage) PruneRuns(ctx context.Context, filter RunPruneFilter, limit int, archive func([]Run) error) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	workspaceID := WorkspaceFrom(ctx)
+	var eligible, failed []*Run
+	for _, run := range m.runs {
+		switch {
+		case run.WorkflowID != filter.WorkflowID || run.WorkspaceID != workspaceID || run.Status == "running" || run.Status == "waiting":
+		case filter.FailedBefore != nil && run.Status == "failed":
+			failed = append(failed, run)
+		default:
+			eligible = append(eligible, run)
+		}
+	}
+	// Newest first, so the runs past KeepNewest are the tail.
+	sort.Slice(eligible, func(i, j int) bool { return runBefore(eligible[j], eligible[i]) })
+
+	var doomed []*Run
+	for i, run := range eligible {
+		if filter.Before != nil && run.CreatedAt.Before(*filter.Before) ||
+			filter.KeepNewest > 0 && i >= filter.KeepNewest {
+			doomed = append(doomed, run)
+		}
+	}
+	for _, run := range failed {
+		if run.CreatedAt.Before(*filter.FailedBefore) {
+			doomed = append(doomed, run)
+		}
+	}
+	sort.Slice(doomed, func(i, j int) bool { return runBefore(doomed[i], doomed[j]) })
+	if len(doomed) > limit {
+		doomed = doomed[:limit]
+	}
+	if len(doomed) == 0 {
+		return 0, nil
+	}
+
+	if archive != nil {
+		runs := make([]Run, len(doomed))
+		for i, run := range doomed {
+			runs[i] = *cloneRun(*run)
+		}
+		if err := archive(runs); err != nil {
+			return 0, fmt.Errorf("archive runs: %w", err)
+		}
+	}
+	for _, run := range doomed {
+		delete(m.runs, run.ID)
+		// Mirrors ON DELETE CASCADE from workflow_tasks.run_id.
+		for id, task := range m.tasks {
+			if task.RunID == run.ID {
+				delete(m.tasks, id)
+			}
+		}
+	}
+	return len(doomed), nil
+}
+
+// matchRuns returns the stored runs of the workspace matching filter,
+// ignoring its cursor and limit. The caller holds the lock.
+func (m *memStorage) matchRuns(workspaceID string, filter RunFilter) ([]*Run, error) {
+	// Round-trip the input filter so values compare like decoded JSON.
+	var wantInputs map[string]any
+	if len(filter.Inputs) > 0 {
+		raw, err := json.Marshal(filter.Inputs)
+		if err != nil {
+			return nil, fmt.Errorf("encode input filter: %w", err)
+		}
+		if err := json.Unmarshal(raw, &wantInputs); err != nil {
+			return nil, fmt.Errorf("decode input filter: %w", err)
+		}
+	}
+
+	var runs []*Run
+	for _, run := range m.runs {
+		if run.WorkflowID != filter.WorkflowID || run.WorkspaceID != workspaceID ||
+			filter.Status != "" && run.Status != filter.Status ||
+			filter.Mode != "" && run.Mode != filter.Mode ||
+			filter.Since != nil && run.CreatedAt.Before(*filter.Since) ||
+			filter.Until != nil && !run.CreatedAt.Before(*filter.Until) ||
+			filter.FailedNode != "" && run.FailedNode != filter.FailedNode ||
+			filter.Version != nil && run.Version != *filter.Version {
+			continue
+		}
+		if len(wantInputs) > 0 {
+			var inputs map[string]any
+			if err := json.Unmarshal(run.Inputs, &inputs); err != nil {
+				continue
+			}
+			if !containsInputs(inputs, wantInputs) {
+				continue
+			}
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// containsInputs reports whether inputs holds every value of want.
+func containsInputs(inputs, want map[string]any) bool {
+	for k, v := range want {
+		got, ok := inputs[k]
+		if !ok || !reflect.DeepEqual(got, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// runBefore reports whether a comes before b in (created_at, id) order.
+func runBefore(a, b *Run) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ID.String() < b.ID.String()
+}
+
+// percentile returns the p-th percentile of sorted values, interpolating
+// between the closest two like Postgres percentile_cont, or 0 if there
+// are none.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	pos := p * float64(len(sorted)-1)
+	lo, hi := int(math.Floor(pos)), int(math.Ceil(pos))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(pos-float64(lo))
+}
+
+// CreateTask records a pending task for a suspended run and fills in
+// Status, WorkspaceID and CreatedAt. Like the foreign key, the run must
+// exist.
+func (m *memStorage) CreateTask(ctx context.Context, task *Task) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task.WorkspaceID = WorkspaceFrom(ctx)
+	if run, ok := m.runs[task.RunID]; !ok || run.WorkflowID != task.WorkflowID {
+		return fmt.Errorf("insert task %s: unknown run %s", task.ID, task.RunID)
+	}
+	if _, ok := m.tasks[task.ID]; ok {
+		return fmt.Errorf("insert task %s: duplicate id", task.ID)
+	}
+
+	task.Status = TaskPending
+	if task.Fields == nil {
+		task.Fields = []string{}
+	}
+	task.CreatedAt = time.Now()
+	m.tasks[task.ID] = cloneTask(*task)
+	return nil
+}
+
+// GetTask returns a copy of a task. Returns pgx.ErrNoRows if it does not exist.
+func (m *memStorage) GetTask(ctx context.Context, id uuid.UUID) (*Task, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	task, ok := m.tasks[id]
+	if !ok || task.WorkspaceID != WorkspaceFrom(ctx) {
+		return nil, pgx.ErrNoRows
+	}
+	return cloneTask(*task), nil
+}
+
+// ListTasks returns copies of the tasks matching filter, oldest first.
+func (m *memStorage) ListTasks(ctx context.Context, filter TaskFilter) ([]Task, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	workspaceID := WorkspaceFrom(ctx)
+	tasks := []Task{}
+	for _, t := range m.tasks {
+		if !filter.AllWorkspaces && t.WorkspaceID != workspaceID {
+			continue
+		}
+		if filter.Assignee != "" && t.Assignee != filter.Assignee {
+			continue
+		}
+		if filter.Status != "" && t.Status != filter.Status {
+			continue
+		}
+		if filter.ExpiresBefore != nil && (t.ExpiresAt == nil || !t.ExpiresAt.Before(*filter.ExpiresBefore)) {
+			continue
+		}
+		tasks = append(tasks, *cloneTask(*t))
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		if !tasks[i].CreatedAt.Equal(tasks[j].CreatedAt) {
+			return tasks[i].CreatedAt.Before(tasks[j].CreatedAt)
+		}
+		return tasks[i].ID.String() < tasks[j].ID.String()
+	})
+	return tasks, nil
+}
+
+// CompleteTask moves a pending task to status, records the response and
+// schedules the task's run to resume at retryAt. Returns pgx.ErrNoRows if
+// the task does not exist and ErrTaskNotPending if it was already completed.
+func (m *memStorage) CompleteTask(ctx context.Context, id uuid.UUID, status string, response json.RawMessage, by string, retryAt time.Time) (*Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	task, ok := m.tasks[id]
+	if !ok || task.WorkspaceID != WorkspaceFrom(ctx) {
+		return nil, pgx.ErrNoRows
+	}
+	if task.Status != TaskPending {
+		return nil, fmt.Errorf("task %s is %s: %w", id, task.Status, ErrTaskNotPending)
+	}
+
+	now := time.Now()
+	task.Status = status
+	task.Response = cloneRaw(response)
+	task.RespondedBy = by
+	task.CompletedAt = &now
+	if run, ok := m.runs[task.RunID]; ok {
+		run.ResumeAt = cloneTime(&retryAt)
+	}
+	return cloneTask(*task), nil
+}
+
+// ClaimIdempotencyKey stores key as in progress at key.CreatedAt, taking
+// over a record of the same key that had expired by then, or that was
+// still in progress after its LockedUntil. Otherwise the existing record is
+// returned with ErrIdempotencyKeyTaken.
+func (m *memStorage) ClaimIdempotencyKey(_ context.Context, key *IdempotencyKey) (*IdempotencyKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := idempotencyID{key.WorkflowID, key.Key}
+	if existing, ok := m.idempotency[id]; ok && existing.ExpiresAt.After(key.CreatedAt) &&
+		(existing.Status == IdempotencyCompleted || existing.LockedUntil.After(key.CreatedAt)) {
+		return cloneIdempotencyKey(*existing), ErrIdempotencyKeyTaken
+	}
+	key.Status = IdempotencyInProgress
+	key.StatusCode = 0
+	key.Response = nil
+	m.idempotency[id] = cloneIdempotencyKey(*key)
+	return key, nil
+}
+
+// CompleteIdempotencyKey stores the response of a claimed key. It returns
+// pgx.ErrNoRows if the claim was taken over, keyed by its CreatedAt.
+func (m *memStorage) CompleteIdempotencyKey(_ context.Context, key *IdempotencyKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.idempotency[idempotencyID{key.WorkflowID, key.Key}]
+	if !ok || !holdsIdempotencyKey(stored, key) {
+		return pgx.ErrNoRows
+	}
+	stored.Status = IdempotencyCompleted
+	stored.StatusCode = key.StatusCode
+	stored.Response = cloneRaw(key.Response)
+	key.Status = IdempotencyCompleted
+	return nil
+}
+
+// ReleaseIdempotencyKey deletes a claimed key, so a request that could
+// not be completed can be retried with it. A claim that was taken over is
+// left to the request that took it.
+func (m *memStorage) ReleaseIdempotencyKey(_ context.Context, key *IdempotencyKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := idempotencyID{key.WorkflowID, key.Key}
+	if stored, ok := m.idempotency[id]; ok && holdsIdempotencyKey(stored, key) {
+		delete(m.idempotency, id)
+	}
+	return nil
+}
+
+// holdsIdempotencyKey reports whether stored is still the in-progress
+// claim key made.
+func holdsIdempotencyKey(stored, key *IdempotencyKey) bool {
+	return stored.Status == IdempotencyInProgress && stored.CreatedAt.Equal(key.CreatedAt)
+}
+
+// DeleteExpiredIdempotencyKeys deletes every key that expired by now and
+// returns how many were deleted.
+func (m *memStorage) DeleteExpiredIdempotencyKeys(_ context.Context, now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := 0
+	for id, k := range m.idempotency {
+		if !k.ExpiresAt.After(now) {
+			delete(m.idempotency, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// CreateAPIKey stores a new API key. CreatedAt is set on key.
+func (m *memStorage) CreateAPIKey(_ context.Context, key *APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.apiKeys {
+		if existing.ID == key.ID || existing.Prefix == key.Prefix {
+			return fmt.Errorf("create api key %q: duplicate id or prefix", key.Name)
+		}
+	}
+	key.CreatedAt = time.Now()
+	key.RevokedAt = nil
+	m.apiKeys[key.ID] = cloneAPIKey(*key)
+	return nil
+}
+
+// GetAPIKeyByPrefix loads the key with the given prefix, revoked or not.
+func (m *memStorage) GetAPIKeyByPrefix(_ context.Context, prefix string) (*APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, key := range m.apiKeys {
+		if key.Prefix == prefix {
+			return cloneAPIKey(*key), nil
+		}
+	}
+	return nil, pgx.ErrNoRows
+}
+
+// ListAPIKeys returns every key, revoked ones included, oldest first.
+func (m *memStorage) ListAPIKeys(_ context.Context) ([]APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]APIKey, 0, len(m.apiKeys))
+	for _, key := range m.apiKeys {
+		keys = append(keys, *cloneAPIKey(*key))
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID.String() < keys[j].ID.String()
+	})
+	return keys, nil
+}
+
+// RevokeAPIKey marks a key revoked at the given time and returns it. A key
+// that was already revoked keeps its original revocation time.
+func (m *memStorage) RevokeAPIKey(_ context.Context, id uuid.UUID, at time.Time) (*APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := m.apiKeys[id]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	if key.RevokedAt == nil {
+		key.RevokedAt = &at
+	}
+	return cloneAPIKey(*key), nil
+}
+
+// ListAuditEvents returns the workspace's events matching filter, newest
+// first.
+func (m *memStorage) ListAuditEvents(ctx context.Context, filter AuditFilter) ([]AuditEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	workspaceID := WorkspaceFrom(ctx)
+	events := []AuditEvent{}
+	for i := len(m.audit) - 1; i >= 0; i-- {
+		e := m.audit[i]
+		switch {
+		case e.WorkspaceID != workspaceID,
+			filter.TargetType != "" && e.TargetType != filter.TargetType,
+			filter.TargetID != "" && e.TargetID != filter.TargetID,
+			filter.Actor != "" && e.Actor != filter.Actor,
+			filter.Since != nil && e.OccurredAt.Before(*filter.Since),
+			filter.Until != nil && !e.OccurredAt.Before(*filter.Until),
+			filter.BeforeID > 0 && e.ID >= filter.BeforeID:
+			continue
+		}
+		e.Diff = cloneRaw(e.Diff)
+		events = append(events, e)
+		if filter.Limit > 0 && len(events) == filter.Limit {
+			break
+		}
+	}
+	return events, nil
+}
+
+// GetWorkspace returns a copy of a workspace. Returns pgx.ErrNoRows if it
+// does not exist.
+func (m *memStorage) GetWorkspace(_ context.Context, id string) (*Workspace, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ws, ok := m.workspaces[id]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	return cloneWorkspace(*ws), nil
+}
+
+// ListWorkspaces returns copies of every workspace, ordered by ID.
+func (m *memStorage) ListWorkspaces(_ context.Context) ([]Workspace, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	workspaces := make([]Workspace, 0, len(m.workspaces))
+	for _, ws := range m.workspaces {
+		workspaces = append(workspaces, *cloneWorkspace(*ws))
+	}
+	sort.Slice(workspaces, func(i, j int) bool { return workspaces[i].ID < workspaces[j].ID })
+	return workspaces, nil
+}
+
+// CreateWorkspace stores a new workspace and fills in CreatedAt. Returns
+// ErrWorkspaceExists if the ID is taken.
+func (m *memStorage) CreateWorkspace(_ context.Context, ws *Workspace) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !ValidWorkspaceID(ws.ID) {
+		return fmt.Errorf("create workspace %s: invalid id", ws.ID)
+	}
+	if _, ok := m.workspaces[ws.ID]; ok {
+		return fmt.Errorf("workspace %s: %w", ws.ID, ErrWorkspaceExists)
+	}
+	ws.CreatedAt = time.Now()
+	m.workspaces[ws.ID] = cloneWorkspace(*ws)
+	return nil
+}
+
+// UpdateWorkspace saves the name and quotas of a workspace and fills in
+// CreatedAt. Returns pgx.ErrNoRows if the workspace does not exist.
+func (m *memStorage) UpdateWorkspace(_ context.Context, ws *Workspace) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.workspaces[ws.ID]
+	if !ok {
+		return pgx.ErrNoRows
+	}
+	ws.CreatedAt = stored.CreatedAt
+	m.workspaces[ws.ID] = cloneWorkspace(*ws)
+	return nil
+}
+
+// PutSecret creates or replaces a secret in the workspace and fills in its
+// times, reporting whether it was created.
+func (m *memStorage) PutSecret(ctx context.Context, secret *Secret) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := secretID{workspace: WorkspaceFrom(ctx), name: secret.Name}
+	now := time.Now()
+	stored, exists := m.secrets[id]
+	secret.CreatedAt, secret.ModifiedAt = now, now
+	action := AuditSecretCreate
+	if exists {
+		secret.CreatedAt = stored.CreatedAt
+		action = AuditSecretUpdate
+	}
+	event, err := newAuditEvent(ctx, action, AuditTargetSecret, secret.Name, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	m.secrets[id] = cloneSecret(*secret)
+	m.appendAudit(event)
+	return !exists, nil
+}
+
+// GetSecret returns a copy of a secret of the workspace. Returns
+// pgx.ErrNoRows if it does not exist.
+func (m *memStorage) GetSecret(ctx context.Context, name string) (*Secret, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sec, ok := m.secrets[secretID{workspace: WorkspaceFrom(ctx), name: name}]
+	if !ok {
+		return nil, pgx.ErrNoRows
+	}
+	return cloneSecret(*sec), nil
+}
+
+// ListSecrets returns the workspace's secrets, ordered by name, without
+// their ciphertext.
+func (m *memStorage) ListSecrets(ctx context.Context) ([]Secret, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	workspaceID := WorkspaceFrom(ctx)
+	secrets := []Secret{}
+	for id, sec := range m.secrets {
+		if id.workspace == workspaceID {
+			s := *sec
+			s.Ciphertext = nil
+			secrets = append(secrets, s)
+		}
+	}
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].Name < secrets[j].Name })
+	return secrets, nil
+}
+
+// DeleteSecret removes a secret of the workspace. Returns pgx.ErrNoRows if
+// it does not exist.
+func (m *memStorage) DeleteSecret(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := secretID{workspace: WorkspaceFrom(ctx), name: name}
+	if _, ok := m.secrets[id]; !ok {
+		return pgx.ErrNoRows
+	}
+	event, err := newAuditEvent(ctx, AuditSecretDelete, AuditTargetSecret, name, nil, nil)
+	if err != nil {
+		return err
+	}
+	delete(m.secrets, id)
+	m.appendAudit(event)
+	return nil
+}
+
+// newAuditEvent builds the audit event of a change made with ctx; it is
+// stored by appendAudit once the change is.
+func newAuditEvent(ctx context.Context, action, targetType, targetID string, before, after any) (AuditEvent, error) {
+	diff, err := auditDiff(before, after)
+	if err != nil {
+		return AuditEvent{}, err
+	}
+	info := auditInfoFrom(ctx)
+	return AuditEvent{
+		WorkspaceID: WorkspaceFrom(ctx),
+		Actor:       info.Actor,
+		Action:      action,
+		TargetType:  targetType,
+		TargetID:    targetID,
+		RequestID:   info.RequestID,
+		Diff:        diff,
+	}, nil
+}
+
+// appendAudit stores event with the next ID, like the BIGSERIAL of
+// audit_events. Callers must hold m.mu for writing.
+func (m *memStorage) appendAudit(event AuditEvent) {
+	event.ID = int64(len(m.audit)) + 1
+	event.OccurredAt = time.Now()
+	m.audit = append(m.audit, event)
+}
+
+// auditState returns the workflow's state for an audit diff. Callers must
+// hold m.mu.
+func (m *memStorage) auditState(mw *memWorkflow) *auditWorkflow {
+	wf := &auditWorkflow{Name: mw.header.Name, Settings: mw.header.Settings, Nodes: make([]auditNode, 0, len(mw.instances)), Edges: cloneEdges(mw.edges)}
+	for _, inst := range mw.instances {
+		if entry, ok := m.library[inst.libraryID]; ok {
+			wf.Nodes = append(wf.Nodes, auditNode{ID: inst.instanceID, Type: entry.NodeType, LibraryID: inst.libraryID, Position: inst.position})
+		}
+	}
+	return wf
+}
+
+// hydrateNodes joins a workflow's instances with their library blueprints.
+// Callers must hold m.mu.
+func (m *memStorage) hydrateNodes(mw *memWorkflow) []Node {
+	nodes := make([]Node, 0, len(mw.instances))
+	for _, inst := range mw.instances {
+		entry, ok := m.library[inst.libraryID]
+		if !ok || entry.deletedAt != nil {
+			continue
+		}
+		nodes = append(nodes, Node{
+			ID:        inst.instanceID,
+			Type:      entry.NodeType,
+			LibraryID: inst.libraryID,
+			Position:  inst.position,
+			Data: NodeData{
+				Label:       entry.Label,
+				Description: entry.Description,
+				Metadata:    cloneRaw(entry.Metadata),
+			},
+		})
+	}
+	return nodes
+}
+
+// cloneRaw copies a JSON blob so callers cannot mutate stored bytes.
+func cloneRaw(raw json.RawMessage) json.RawMessage {
+	if raw == nil {
+		return nil
+	}
+	return append(json.RawMessage(nil), raw...)
+}
+
+func cloneStrPtr(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	v := *s
+	return &v
+}
+
+func cloneUUIDPtr(id *uuid.UUID) *uuid.UUID {
+	if id == nil {
+		return nil
+	}
+	v := *id
+	return &v
+}
+
+func cloneNodes(nodes []Node) []Node {
+	if nodes == nil {
+		return nil
+	}
+	out := make([]Node, len(nodes))
+	for i, n := range nodes {
+		out[i] = n
+		out[i].Data.Metadata = cloneRaw(n.Data.Metadata)
+	}
+	return out
+}
+
+func cloneEdges(edges []Edge) []Edge {
+	if edges == nil {
+		return nil
+	}
+	out := make([]Edge, len(edges))
+	for i, e := range edges {
+		out[i] = e
+		out[i].SourceHandle = cloneStrPtr(e.SourceHandle)
+		out[i].Label = cloneStrPtr(e.Label)
+		out[i].Style = cloneRaw(e.Style)
+		out[i].LabelStyle = cloneRaw(e.LabelStyle)
+	}
+	return out
+}
+
+func cloneSnapshot(snap WorkflowSnapshot) *WorkflowSnapshot {
+	out := snap
+	out.DagData = DagData{
+		Nodes:    cloneNodes(snap.DagData.Nodes),
+		Edges:    cloneEdges(snap.DagData.Edges),
+		Settings: snap.DagData.Settings,
+	}
+	return &out
+}
+
+func cloneTestCases(cases []TestCase) []TestCase {
+	out := make([]TestCase, len(cases))
+	for i, tc := range cases {
+		out[i] = tc
+		out[i].Definition = cloneRaw(tc.Definition)
+	}
+	return out
+}
+
+func cloneRun(run Run) *Run {
+	run.Inputs = cloneRaw(run.Inputs)
+	run.Result = cloneRaw(run.Result)
+	run.Calls = cloneRaw(run.Calls)
+	run.State = cloneRaw(run.State)
+	run.Sealed = append([]byte(nil), run.Sealed...)
+	run.ResumeAt = cloneTime(run.ResumeAt)
+	return &run
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	v := *t
+	return &v
+}
+
+func cloneTask(task Task) *Task {
+	task.Fields = append([]string{}, task.Fields...)
+	task.Response = cloneRaw(task.Response)
+	if task.ExpiresAt != nil {
+		v := *task.ExpiresAt
+		task.ExpiresAt = &v
+	}
+	if task.CompletedAt != nil {
+		v := *task.CompletedAt
+		task.CompletedAt = &v
+	}
+	return &task
+}
+
+func cloneIdempotencyKey(key IdempotencyKey) *IdempotencyKey {
+	key.Response = cloneRaw(key.Response)
+	return &key
+}
+
+// ListExecutionLimits returns the limits the store was created with,
+// ordered by scope and subject.
+func (m *memStorage) ListExecutionLimits(_ context.Context) ([]ExecutionLimit, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	limits := append([]ExecutionLimit{}, m.limits...)
+	sort.Slice(limits, func(i, j int) bool {
+		if limits[i].Scope != limits[j].Scope {
+			return limits[i].Scope < limits[j].Scope
+		}
+		return limits[i].Subject < limits[j].Subject
+	})
+	return limits, nil
+}
+
+func cloneAPIKey(key APIKey) *APIKey {
+	key.RevokedAt = cloneTime(key.RevokedAt)
+	return &key
+}
+
+func cloneWorkspace(ws Workspace) *Workspace {
+	if ws.MaxWorkflows != nil {
+		v := *ws.MaxWorkflows
+		ws.MaxWorkflows = &v
+	}
+	if ws.MaxRunsPerHour != nil {
+		v := *ws.MaxRunsPerHour
+		ws.MaxRunsPerHour = &v
+	}
+	return &ws
+}
+
+func cloneSecret(sec Secret) *Secret {
+	sec.Ciphertext = append([]byte(nil), sec.Ciphertext...)
+	return &sec
+}
@@ -0,0 +1,147 @@
+package storage_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/pkg/db"
+	"workflow-code-test/api/services/storage"
+	"workflow-code-test/api/services/storage/storagetest"
+)
+
+func newMemoryStore(t *testing.T) storage.Storage {
+	t.Helper()
+	store, err := storage.NewMemoryInstance(storage.SeedFixtures())
+	if err != nil {
+		t.Fatalf("failed to create memory store: %v", err)
+	}
+	return store
+}
+
+func TestMemoryStorage_Conformance(t *testing.T) {
+	t.Parallel()
+	storagetest.Run(t, newMemoryStore)
+}
+
+// TestPostgresStorage_Conformance runs the same suite against a real database.
+// It needs a migrated database (schema plus V2–V6 seeds) in TEST_DATABASE_URL.
+func TestPostgresStorage_Conformance(t *testing.T) {
+	t.Parallel()
+	dbURL := os.Getenv("TEST_DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DATABASE_URL not set; skipping Postgres conformance suite")
+	}
+
+	pool, err := db.Connect(context.Background(), db.DefaultConfig(dbURL))
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	store, err := storage.NewInstance(pool)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	storagetest.Run(t, func(t *testing.T) storage.Storage { return store })
+}
+
+func TestNewMemoryInstance_InvalidFixtures(t *testing.T) {
+	t.Parallel()
+
+	libID := uuid.New()
+	tests := []struct {
+		name     string
+		fixtures storage.Fixtures
+	}{
+		{
+			name: "duplicate library entry",
+			fixtures: storage.Fixtures{Library: []storage.NodeLibraryEntry{
+				{ID: libID.String(), NodeType: "start"},
+				{ID: libID.String(), NodeType: "end"},
+			}},
+		},
+		{
+			name: "instance references unknown library entry",
+			fixtures: storage.Fixtures{Workflows: []storage.FixtureWorkflow{{
+				ID:        uuid.New(),
+				Name:      "broken",
+				Instances: []storage.FixtureInstance{{InstanceID: "start", LibraryID: libID}},
+			}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := storage.NewMemoryInstance(tt.fixtures); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestMemoryStorage_ReturnsCopies(t *testing.T) {
+	t.Parallel()
+	store := newMemoryStore(t)
+	ctx := context.Background()
+
+	wf, err := store.GetWorkflow(ctx, storage.SeedWeatherWorkflowID)
+	if err != nil {
+		t.Fatalf("GetWorkflow: %v", err)
+	}
+	wf.Nodes[0].Data.Metadata[0] = 'X'
+	*wf.Edges[0].Label = "mutated"
+
+	again, err := store.GetWorkflow(ctx, storage.SeedWeatherWorkflowID)
+	if err != nil {
+		t.Fatalf("GetWorkflow: %v", err)
+	}
+	if again.Nodes[0].Data.Metadata[0] != '{' {
+		t.Error("mutating returned metadata changed the stored blueprint")
+	}
+	if *again.Edges[0].Label == "mutated" {
+		t.Error("mutating returned edge label changed the stored edge")
+	}
+}
+
+func TestMemoryStorage_ConcurrentAccess(t *testing.T) {
+	t.Parallel()
+	store := newMemoryStore(t)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if _, err := store.PublishWorkflow(ctx, storage.SeedLoopWorkflowID); err != nil {
+				errs <- fmt.Errorf("publish: %w", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := store.GetWorkflow(ctx, storage.SeedLoopWorkflowID); err != nil {
+				errs <- fmt.Errorf("get: %w", err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	snap, err := store.GetActiveSnapshot(ctx, storage.SeedLoopWorkflowID)
+	if err != nil {
+		t.Fatalf("GetActiveSnapshot: %v", err)
+	}
+	if snap.VersionNumber != 20 {
+		t.Errorf("expected 20 sequential versions, got %d", snap.VersionNumber)
+	}
+}
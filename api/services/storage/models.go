@@ -11,21 +11,64 @@ import (
 // It aggregates hydrated nodes and edges after the storage layer
 // joins instance data with the shared node library.
 type Workflow struct {
-	ID               uuid.UUID  `json:"id" db:"id"`
-	Name             string     `json:"name" db:"name"`
-	Status           string     `json:"status" db:"status"`
-	ActiveSnapshotID *uuid.UUID `json:"activeSnapshotId,omitempty" db:"active_snapshot_id"`
-	Nodes            []Node     `json:"nodes" db:"-"`
-	Edges            []Edge     `json:"edges" db:"-"`
-	CreatedAt        time.Time  `json:"createdAt" db:"created_at"`
-	ModifiedAt       time.Time  `json:"modifiedAt" db:"modified_at"`
-	DeletedAt        *time.Time `json:"deletedAt,omitempty" db:"deleted_at"`
-}
-
-// DagData holds the frozen state of a workflow's nodes and edges at publish time.
+	ID               uuid.UUID        `json:"id" db:"id"`
+	Name             string           `json:"name" db:"name"`
+	Status           string           `json:"status" db:"status"`
+	ActiveSnapshotID *uuid.UUID       `json:"activeSnapshotId,omitempty" db:"active_snapshot_id"`
+	Settings         WorkflowSettings `json:"settings" db:"settings"`
+	Nodes            []Node           `json:"nodes" db:"-"`
+	Edges            []Edge           `json:"edges" db:"-"`
+	CreatedAt        time.Time        `json:"createdAt" db:"created_at"`
+	ModifiedAt       time.Time        `json:"modifiedAt" db:"modified_at"`
+	DeletedAt        *time.Time       `json:"deletedAt,omitempty" db:"deleted_at"`
+}
+
+// WorkflowSettings changes how a workflow executes. The zero value keeps
+// the original behaviour.
+type WorkflowSettings struct {
+	// ScopedOutputsOnly stops node outputs from being merged into the flat
+	// variables; they are then only addressable as nodes.<id>.<key>.
+	ScopedOutputsOnly bool `json:"scopedOutputsOnly,omitempty"`
+
+	// Retention says how long the workflow's runs are kept. The zero value
+	// keeps them forever.
+	Retention RetentionPolicy `json:"retention,omitzero"`
+
+	// SensitiveVariables names the variables whose values are masked in
+	// execution responses, stored runs and logs. Email addresses and phone
+	// numbers are masked wherever they appear regardless.
+	SensitiveVariables []string `json:"sensitiveVariables,omitempty"`
+}
+
+// IsZero reports whether every setting is at its default.
+func (s WorkflowSettings) IsZero() bool {
+	return !s.ScopedOutputsOnly && s.Retention == (RetentionPolicy{}) && len(s.SensitiveVariables) == 0
+}
+
+// RetentionPolicy limits how long a workflow's finished runs are kept. Runs
+// older than Days, or past the newest Runs, are deleted; zero disables a
+// limit. When FailedDays is set, failed runs are exempt from both limits
+// and are deleted once older than FailedDays instead, so failures can be
+// kept longer. Runs still waiting on a task or timer are never deleted.
+type RetentionPolicy struct {
+	Days       int `json:"days,omitempty"`
+	Runs       int `json:"runs,omitempty"`
+	FailedDays int `json:"failedDays,omitempty"`
+}
+
+// WorkflowRetention is the retention policy of one workflow.
+type WorkflowRetention struct {
+	WorkflowID  uuid.UUID
+	WorkspaceID string
+	Policy      RetentionPolicy
+}
+
+// DagData holds the frozen state of a workflow's nodes, edges and settings
+// at publish time.
 type DagData struct {
-	Nodes []Node `json:"nodes"`
-	Edges []Edge `json:"edges"`
+	Nodes    []Node           `json:"nodes"`
+	Edges    []Edge           `json:"edges"`
+	Settings WorkflowSettings `json:"settings"`
 }
 
 // WorkflowSnapshot is an immutable, versioned capture of a workflow's DAG.
@@ -50,11 +93,16 @@ func (w *Workflow) ToFrontend() map[string]interface{} {
 
 // Node is the hydrated view combining a library blueprint (type, label,
 // description, metadata) with a canvas instance (position).
+//
+// LibraryID pins the instance to a specific node_library entry. It is filled
+// in on reads; on writes it is optional and, when empty, the node type is
+// resolved to a library entry instead.
 type Node struct {
-	ID       string       `json:"id"`   // instance_id from workflow_node_instances
-	Type     string       `json:"type"` // node_type from node_library
-	Position NodePosition `json:"position"`
-	Data     NodeData     `json:"data"`
+	ID        string       `json:"id"`   // instance_id from workflow_node_instances
+	Type      string       `json:"type"` // node_type from node_library
+	LibraryID string       `json:"libraryId,omitempty"`
+	Position  NodePosition `json:"position"`
+	Data      NodeData     `json:"data"`
 }
 
 type NodePosition struct {
@@ -88,12 +136,268 @@ type Edge struct {
 
 // NodeLibraryEntry represents a reusable node blueprint in the shared library.
 // Workflows reference these via workflow_node_instances, allowing multiple
-// workflows to share the same underlying node definitions.
+// workflows to share the same underlying node definitions. WorkspaceID is
+// empty for entries of the global library, which every workspace can use.
 type NodeLibraryEntry struct {
 	ID          string          `json:"id" db:"id"`
+	WorkspaceID string          `json:"workspaceId,omitempty" db:"workspace_id"`
 	NodeType    string          `json:"nodeType" db:"node_type"`
 	Label       string          `json:"baseLabel" db:"base_label"`
 	Description string          `json:"baseDescription" db:"base_description"`
 	Metadata    json.RawMessage `json:"metadata" db:"metadata"`
 	ModifiedAt  time.Time       `json:"modifiedAt" db:"modified_at"`
 }
+
+// TestCase is a named regression test attached to a workflow. Definition
+// holds the inputs, integration mocks and assertions as raw JSON; its schema
+// belongs to the workflow service, so storage only keeps it in order.
+type TestCase struct {
+	Name       string          `json:"name" db:"name"`
+	Definition json.RawMessage `json:"definition" db:"definition"`
+	ModifiedAt time.Time       `json:"modifiedAt" db:"modified_at"`
+}
+
+// Run is a recorded workflow execution. Version is the snapshot it ran
+// against, 0 for the draft. Inputs, Result and Calls are owned by the
+// workflow service and stored as raw JSON. State is only set while the run
+// is suspended and holds what the engine needs to resume it. Sealed is the
+// encrypted part of the inputs and state that the workflow service masks,
+// and is never serialized. FailedNode and DurationMs repeat what the result
+// holds so runs can be filtered and aggregated without decoding it.
+type Run struct {
+	ID          uuid.UUID       `json:"id" db:"id"`
+	WorkflowID  uuid.UUID       `json:"workflowId" db:"workflow_id"`
+	WorkspaceID string          `json:"workspaceId" db:"workspace_id"`
+	Version     int             `json:"version" db:"version_number"`
+	Mode        string          `json:"mode" db:"mode"`
+	Status      string          `json:"status" db:"status"`
+	FailedNode  string          `json:"failedNode,omitempty" db:"failed_node"`
+	DurationMs  int64           `json:"durationMs" db:"duration_ms"` // time spent executing steps
+	Inputs      json.RawMessage `json:"inputs" db:"inputs"`
+	Result      json.RawMessage `json:"result" db:"result"`
+	Calls       json.RawMessage `json:"calls" db:"calls"`
+	State       json.RawMessage `json:"state,omitempty" db:"state"`
+	Sealed      []byte          `json:"-" db:"sealed"`
+	ResumeAt    *time.Time      `json:"resumeAt,omitempty" db:"resume_at"` // when a run waiting on a timer continues
+	CreatedAt   time.Time       `json:"createdAt" db:"created_at"`
+}
+
+// RunFilter selects the runs of a workflow in ListRuns and RunStats. Zero
+// fields match everything. Inputs matches runs whose inputs hold each of
+// the given values. ListRuns returns runs newest first, starting after
+// Cursor and at most Limit of them (all if 0).
+type RunFilter struct {
+	WorkflowID uuid.UUID
+	Status     string
+	Mode       string
+	Since      *time.Time // created at or after
+	Until      *time.Time // created before
+	FailedNode string
+	Version    *int
+	Inputs     map[string]any
+	Cursor     *RunCursor
+	Limit      int
+}
+
+// RunCursor is the position of a run in the newest-first order of
+// ListRuns: the next page starts with the run created before it.
+type RunCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+// RunStats aggregates the runs matching a RunFilter. Durations are over
+// finished runs only; FailingNodes are the nodes runs failed at most,
+// most failures first.
+type RunStats struct {
+	Total         int            `json:"total"`
+	ByStatus      map[string]int `json:"byStatus"`
+	P50DurationMs float64        `json:"p50DurationMs"`
+	P95DurationMs float64        `json:"p95DurationMs"`
+	FailingNodes  []NodeFailures `json:"failingNodes"`
+}
+
+// RunPruneFilter selects the runs of a workflow that PruneRuns deletes: any
+// finished run created before Before or older than the newest KeepNewest.
+// When FailedBefore is set, failed runs are instead deleted only if created
+// before it, and do not count towards KeepNewest. Running and waiting runs
+// are never selected.
+type RunPruneFilter struct {
+	WorkflowID   uuid.UUID
+	Before       *time.Time
+	KeepNewest   int
+	FailedBefore *time.Time
+}
+
+// NodeFailures counts the runs that failed at a node.
+type NodeFailures struct {
+	NodeID   string `json:"nodeId"`
+	Failures int    `json:"failures"`
+}
+
+// Task statuses. A task starts pending and is completed exactly once.
+const (
+	TaskPending   = "pending"
+	TaskApproved  = "approved"
+	TaskRejected  = "rejected"
+	TaskSubmitted = "submitted"
+	TaskExpired   = "expired"
+)
+
+// Task is a request for a person to act on a suspended run: approve or
+// reject it, or submit fields. Response holds the submitted fields.
+type Task struct {
+	ID          uuid.UUID       `json:"id" db:"id"`
+	WorkflowID  uuid.UUID       `json:"workflowId" db:"workflow_id"`
+	WorkspaceID string          `json:"workspaceId" db:"workspace_id"`
+	RunID       uuid.UUID       `json:"runId" db:"run_id"`
+	NodeID      string          `json:"nodeId" db:"node_id"`
+	Kind        string          `json:"kind" db:"kind"`
+	Assignee    string          `json:"assignee" db:"assignee"`
+	Title       string          `json:"title" db:"title"`
+	Fields      []string        `json:"fields" db:"fields"`
+	Status      string          `json:"status" db:"status"`
+	Response    json.RawMessage `json:"response,omitempty" db:"response"`
+	RespondedBy string          `json:"respondedBy,omitempty" db:"responded_by"`
+	ExpiresAt   *time.Time      `json:"expiresAt,omitempty" db:"expires_at"`
+	CreatedAt   time.Time       `json:"createdAt" db:"created_at"`
+	CompletedAt *time.Time      `json:"completedAt,omitempty" db:"completed_at"`
+}
+
+// TaskFilter selects tasks in ListTasks. Zero fields match everything.
+// Tasks are listed from the context's workspace unless AllWorkspaces is
+// set, for maintenance jobs that act on every workspace.
+type TaskFilter struct {
+	Assignee      string
+	Status        string
+	ExpiresBefore *time.Time // only tasks with an expiry before this time
+	AllWorkspaces bool
+}
+
+// Idempotency key statuses. A key is in progress while its request runs
+// and completed once the response is stored.
+const (
+	IdempotencyInProgress = "in_progress"
+	IdempotencyCompleted  = "completed"
+)
+
+// IdempotencyKey records an execute request sent with an Idempotency-Key
+// header, so a retry of it gets the stored response instead of running the
+// workflow again. RequestHash tells a retry apart from a different request
+// that reuses the key. An in-progress key is held until LockedUntil; after
+// that a retry may take it over.
+type IdempotencyKey struct {
+	WorkflowID  uuid.UUID       `json:"workflowId" db:"workflow_id"`
+	Key         string          `json:"key" db:"key"`
+	RequestHash string          `json:"requestHash" db:"request_hash"`
+	Status      string          `json:"status" db:"status"`
+	StatusCode  int             `json:"statusCode,omitempty" db:"status_code"`
+	Response    json.RawMessage `json:"response,omitempty" db:"response"`
+	CreatedAt   time.Time       `json:"createdAt" db:"created_at"`
+	LockedUntil time.Time       `json:"lockedUntil" db:"locked_until"`
+	ExpiresAt   time.Time       `json:"expiresAt" db:"expires_at"`
+}
+
+// APIKey is a credential for the API. Only a SHA-256 hash of the secret is
+// stored; Prefix is the public part of the key it is looked up by. A key
+// with a WorkspaceID may only act in that workspace.
+type APIKey struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	Name        string     `json:"name" db:"name"`
+	Prefix      string     `json:"prefix" db:"prefix"`
+	KeyHash     string     `json:"-" db:"key_hash"`
+	Role        string     `json:"role" db:"role"`
+	WorkspaceID string     `json:"workspaceId,omitempty" db:"workspace_id"`
+	CreatedBy   string     `json:"createdBy" db:"created_by"`
+	CreatedAt   time.Time  `json:"createdAt" db:"created_at"`
+	RevokedAt   *time.Time `json:"revokedAt,omitempty" db:"revoked_at"`
+}
+
+// Secret is a named value encrypted with the deployment's secrets key.
+// Ciphertext is never serialized; listings show only names and times.
+type Secret struct {
+	Name       string    `json:"name" db:"name"`
+	Ciphertext []byte    `json:"-" db:"ciphertext"`
+	UpdatedBy  string    `json:"updatedBy" db:"updated_by"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
+	ModifiedAt time.Time `json:"modifiedAt" db:"modified_at"`
+}
+
+// Scopes of an ExecutionLimit.
+const (
+	LimitScopeGlobal   = "global"
+	LimitScopeAPIKey   = "api_key"
+	LimitScopeWorkflow = "workflow"
+)
+
+// ExecutionLimit limits the executions of a scope: the whole deployment,
+// an API key or JWT subject, or a workflow. An empty Subject makes it the
+// default for every subject of the scope. RatePerMinute refills a token
+// bucket holding Burst requests; MaxConcurrent caps executions running at
+// once. Zero disables a limit.
+type ExecutionLimit struct {
+	Scope         string `json:"scope" db:"scope"`
+	Subject       string `json:"subject" db:"subject"`
+	RatePerMinute int    `json:"ratePerMinute" db:"rate_per_minute"`
+	Burst         int    `json:"burst" db:"burst"`
+	MaxConcurrent int    `json:"maxConcurrent" db:"max_concurrent"`
+}
+
+// Workspace is a tenant of the deployment. Its workflows, runs, tasks and
+// audit events are invisible to other workspaces. MaxWorkflows and
+// MaxRunsPerHour are its quotas; nil means unlimited.
+type Workspace struct {
+	ID             string    `json:"id" db:"id"`
+	Name           string    `json:"name" db:"name"`
+	MaxWorkflows   *int      `json:"maxWorkflows,omitempty" db:"max_workflows"`
+	MaxRunsPerHour *int      `json:"maxRunsPerHour,omitempty" db:"max_runs_per_hour"`
+	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
+}
+
+// Audit actions, the changes audit events record.
+const (
+	AuditWorkflowCreate  = "workflow.create"
+	AuditWorkflowUpdate  = "workflow.update"
+	AuditWorkflowDelete  = "workflow.delete"
+	AuditWorkflowPublish = "workflow.publish"
+	AuditLibraryCreate   = "library.create"
+	AuditSecretCreate    = "secret.create"
+	AuditSecretUpdate    = "secret.update"
+	AuditSecretDelete    = "secret.delete"
+)
+
+// Audit target types, the kinds of record audit events are about.
+const (
+	AuditTargetWorkflow    = "workflow"
+	AuditTargetNodeLibrary = "node_library"
+	AuditTargetSecret      = "secret"
+)
+
+// AuditEvent records one change: who made it, in which request, and what
+// it changed. Diff maps the path of each changed field (name,
+// nodes[<id>].position.x) to its value before and after; a field that was
+// added or removed is null on the other side.
+type AuditEvent struct {
+	ID          int64           `json:"id" db:"id"`
+	WorkspaceID string          `json:"workspaceId" db:"workspace_id"`
+	OccurredAt  time.Time       `json:"occurredAt" db:"occurred_at"`
+	Actor       string          `json:"actor" db:"actor"`
+	Action      string          `json:"action" db:"action"`
+	TargetType  string          `json:"targetType" db:"target_type"`
+	TargetID    string          `json:"targetId" db:"target_id"`
+	RequestID   string          `json:"requestId" db:"request_id"`
+	Diff        json.RawMessage `json:"diff" db:"diff"`
+}
+
+// AuditFilter selects events in ListAuditEvents, newest first. Zero fields
+// match everything. BeforeID continues a listing after the event with
+// that ID; Limit caps the number of events (all if 0).
+type AuditFilter struct {
+	TargetType string
+	TargetID   string
+	Actor      string
+	Since      *time.Time
+	Until      *time.Time
+	BeforeID   int64
+	Limit      int
+}
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+// Fixtures is the data used to populate an in-memory store. It mirrors the
+// rows the Flyway seed migrations insert: library blueprints, workflow
+// headers, canvas instances and edges, and execution limits.
+type Fixtures struct {
+	Library   []NodeLibraryEntry
+	Workflows []FixtureWorkflow
+	Limits    []ExecutionLimit
+}
+
+// FixtureWorkflow is a workflow header plus its instance and edge rows.
+type FixtureWorkflow struct {
+	ID        uuid.UUID
+	Name      string
+	Instances []FixtureInstance
+	Edges     []Edge
+}
+
+// FixtureInstance places a library blueprint on a workflow canvas.
+type FixtureInstance struct {
+	InstanceID string
+	LibraryID  uuid.UUID
+	Position   NodePosition
+}
+
+// Library blueprint IDs seeded by V2, V3, V4 and V9–V12.
+var (
+	seedStartID          = uuid.MustParse("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11")
+	seedWeatherFormID    = uuid.MustParse("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a12")
+	seedWeatherAPIID     = uuid.MustParse("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a13")
+	seedTempConditionID  = uuid.MustParse("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a14")
+	seedEmailID          = uuid.MustParse("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a15")
+	seedEndID            = uuid.MustParse("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a16")
+	seedSmsID            = uuid.MustParse("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a17")
+	seedFloodAPIID       = uuid.MustParse("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a18")
+	seedFloodFormID      = uuid.MustParse("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a19")
+	seedFloodConditionID = uuid.MustParse("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a20")
+	seedApprovalID       = uuid.MustParse("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a21")
+	seedInputID          = uuid.MustParse("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a22")
+	seedDelayID          = uuid.MustParse("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a23")
+	seedWaitUntilID      = uuid.MustParse("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a24")
+	seedWeatherCheckID   = uuid.MustParse("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a25")
+	seedForeachID        = uuid.MustParse("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a26")
+)
+
+// Workflow IDs seeded by V2, V4 and V6.
+var (
+	SeedWeatherWorkflowID = uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	SeedFloodWorkflowID   = uuid.MustParse("b7a1c3d0-5f2e-4a89-9c01-def456789abc")
+	SeedLoopWorkflowID    = uuid.MustParse("d4e5f6a7-8b9c-0d1e-2f3a-456789abcdef")
+)
+
+// SeedFixtures returns the data loaded by the V2–V6, V9–V12 and V20 Flyway migrations.
+// storage tests check these against the SQL files so the two cannot drift.
+func SeedFixtures() Fixtures {
+	return Fixtures{
+		Library: []NodeLibraryEntry{
+			// V2: weather workflow blueprints
+			{ID: seedStartID.String(), NodeType: "start", Label: "Start", Description: "Begin weather check workflow",
+				Metadata: json.RawMessage(`{"hasHandles": {"source": true, "target": false}}`)},
+			{ID: seedWeatherFormID.String(), NodeType: "form", Label: "User Input", Description: "Process collected data - name, email, location",
+				Metadata: json.RawMessage(`{"hasHandles": {"source": true, "target": true}, "inputFields": ["name", "email", "city"], "outputVariables": ["name", "email", "city"]}`)},
+			{ID: seedWeatherAPIID.String(), NodeType: "integration", Label: "Weather API", Description: "Fetch current temperature for {{city}}",
+				Metadata: json.RawMessage(`{"hasHandles": {"source": true, "target": true}, "inputVariables": ["city"], "apiEndpoint": "https://api.open-meteo.com/v1/forecast?latitude={lat}&longitude={lon}&current_weather=true", "options": [{"city": "Sydney", "lat": -33.8688, "lon": 151.2093}, {"city": "Melbourne", "lat": -37.8136, "lon": 144.9631}, {"city": "Brisbane", "lat": -27.4698, "lon": 153.0251}, {"city": "Perth", "lat": -31.9505, "lon": 115.8605}, {"city": "Adelaide", "lat": -34.9285, "lon": 138.6007}], "outputVariables": ["temperature"]}`)},
+			{ID: seedTempConditionID.String(), NodeType: "condition", Label: "Check Condition", Description: "Evaluate temperature threshold",
+				Metadata: json.RawMessage(`{"hasHandles": {"source": ["true", "false"], "target": true}, "conditionExpression": "temperature {{operator}} {{threshold}}", "outputVariables": ["conditionMet"]}`)},
+			{ID: seedEmailID.String(), NodeType: "email", Label: "Send Alert", Description: "Email weather alert notification",
+				Metadata: json.RawMessage(`{"hasHandles": {"source": true, "target": true}, "inputVariables": ["name", "city", "temperature"], "emailTemplate": {"subject": "Weather Alert", "body": "Weather alert for {{city}}! Temperature is {{temperature}}°C!"}, "outputVariables": ["emailSent"]}`)},
+			{ID: seedEndID.String(), NodeType: "end", Label: "Complete", Description: "Workflow execution finished",
+				Metadata: json.RawMessage(`{"hasHandles": {"source": false, "target": true}}`)},
+
+			// V3: SMS and flood blueprints
+			{ID: seedSmsID.String(), NodeType: "sms", Label: "Send SMS", Description: "Send an SMS notification",
+				Metadata: json.RawMessage(`{"hasHandles": {"source": true, "target": true}, "inputVariables": ["name", "phone", "message"], "outputVariables": ["deliveryStatus", "smsSent"]}`)},
+			{ID: seedFloodAPIID.String(), NodeType: "flood", Label: "Flood Risk API", Description: "Check flood risk for a given location",
+				Metadata: json.RawMessage(`{"hasHandles": {"source": true, "target": true}, "inputVariables": ["city"], "apiEndpoint": "https://flood-api.open-meteo.com/v1/flood", "options": [{"city": "Sydney", "lat": -33.8688, "lon": 151.2093}, {"city": "Melbourne", "lat": -37.8136, "lon": 144.9631}, {"city": "Brisbane", "lat": -27.4698, "lon": 153.0251}], "outputVariables": ["floodRisk", "discharge"]}`)},
+
+			// V4: flood alert variants
+			{ID: seedFloodFormID.String(), NodeType: "form", Label: "User Input", Description: "Collect name, phone, and city for flood alerts",
+				Metadata: json.RawMessage(`{"hasHandles": {"source": true, "target": true}, "inputFields": ["name", "phone", "city"], "outputVariables": ["name", "phone", "city"]}`)},
+			{ID: seedFloodConditionID.String(), NodeType: "condition", Label: "Check Flood Level", Description: "Evaluate river discharge threshold",
+				Metadata: json.RawMessage(`{"hasHandles": {"source": ["true", "false"], "target": true}, "conditionVariable": "discharge", "conditionExpression": "discharge {{operator}} {{threshold}}", "outputVariables": ["conditionMet"]}`)},
+
+			// V9: human task blueprints
+			{ID: seedApprovalID.String(), NodeType: "approval", Label: "Approval", Description: "Wait for a person to approve or reject",
+				Metadata: json.RawMessage(`{"hasHandles": {"source": ["approved", "rejected", "timeout"], "target": true}, "assignee": "{{approver}}", "title": "Approve alert for {{city}}", "timeout": "24h", "fields": ["comment"], "inputVariables": ["approver", "city"], "outputVariables": ["approved", "approvalStatus", "respondedBy", "comment"]}`)},
+			{ID: seedInputID.String(), NodeType: "input", Label: "Wait for Input", Description: "Wait for a person to submit additional fields",
+				Metadata: json.RawMessage(`{"hasHandles": {"source": ["submitted", "timeout"], "target": true}, "assignee": "{{approver}}", "title": "Provide a phone number for {{name}}", "timeout": "24h", "fields": ["phone"], "inputVariables": ["approver", "name"], "outputVariables": ["phone", "respondedBy"]}`)},
+			// V10: timer blueprints
+			{ID: seedDelayID.String(), NodeType: "delay", Label: "Delay", Description: "Pause the run for a fixed duration",
+				Metadata: json.RawMessage(`{"hasHandles": {"source": true, "target": true}, "duration": "15m"}`)},
+			{ID: seedWaitUntilID.String(), NodeType: "wait_until", Label: "Wait Until", Description: "Pause the run until a point in time",
+				Metadata: json.RawMessage(`{"hasHandles": {"source": true, "target": true}, "until": "{{resumeAt}}", "inputVariables": ["resumeAt"]}`)},
+			// V11: sub-workflow blueprints
+			{ID: seedWeatherCheckID.String(), NodeType: "subworkflow", Label: "Weather Check", Description: "Run the Weather Check System as a step",
+				Metadata: json.RawMessage(`{"hasHandles": {"source": true, "target": true}, "workflowId": "550e8400-e29b-41d4-a716-446655440000", "inputMapping": {"name": "name", "email": "email", "city": "city", "operator": "operator", "threshold": "threshold"}, "outputMapping": {"temperature": "temperature", "conditionMet": "conditionMet"}}`)},
+			// V12: loop blueprints
+			{ID: seedForeachID.String(), NodeType: "foreach", Label: "For Each", Description: "Run the body branch once per item of a list",
+				Metadata: json.RawMessage(`{"hasHandles": {"source": ["body", "done"], "target": true}, "items": "cities", "itemVariable": "city", "concurrency": 1, "resultVariable": "results"}`)},
+		},
+		Workflows: []FixtureWorkflow{
+			{
+				ID:   SeedWeatherWorkflowID,
+				Name: "Weather Check System",
+				Instances: []FixtureInstance{
+					{InstanceID: "start", LibraryID: seedStartID, Position: NodePosition{X: -160, Y: 300}},
+					{InstanceID: "form", LibraryID: seedWeatherFormID, Position: NodePosition{X: 152, Y: 304}},
+					{InstanceID: "weather-api", LibraryID: seedWeatherAPIID, Position: NodePosition{X: 460, Y: 304}},
+					{InstanceID: "condition", LibraryID: seedTempConditionID, Position: NodePosition{X: 794, Y: 304}},
+					{InstanceID: "email", LibraryID: seedEmailID, Position: NodePosition{X: 1096, Y: 88}},
+					{InstanceID: "end", LibraryID: seedEndID, Position: NodePosition{X: 1360, Y: 302}},
+				},
+				Edges: []Edge{
+					seedEdge("e1", "start", "form", "", "Initialize", `{"stroke": "#10b981", "strokeWidth": 3}`, ""),
+					seedEdge("e2", "form", "weather-api", "", "Submit Data", `{"stroke": "#3b82f6", "strokeWidth": 3}`, ""),
+					seedEdge("e3", "weather-api", "condition", "", "Temperature Data", `{"stroke": "#f97316", "strokeWidth": 3}`, ""),
+					seedEdge("e4", "condition", "email", "true", "✓ Condition Met", `{"stroke": "#10b981", "strokeWidth": 3}`, `{"fill": "#10b981", "fontWeight": "bold"}`),
+					seedEdge("e5", "condition", "end", "false", "✗ No Alert Needed", `{"stroke": "#6b7280", "strokeWidth": 3}`, `{"fill": "#6b7280", "fontWeight": "bold"}`),
+					seedEdge("e6", "email", "end", "", "Alert Sent", `{"stroke": "#ef4444", "strokeWidth": 2}`, `{"fill": "#ef4444", "fontWeight": "bold"}`),
+				},
+			},
+			{
+				ID:   SeedFloodWorkflowID,
+				Name: "Flood Alert System",
+				Instances: []FixtureInstance{
+					{InstanceID: "start", LibraryID: seedStartID, Position: NodePosition{X: -160, Y: 300}},
+					{InstanceID: "form", LibraryID: seedFloodFormID, Position: NodePosition{X: 152, Y: 300}},
+					{InstanceID: "flood-api", LibraryID: seedFloodAPIID, Position: NodePosition{X: 460, Y: 300}},
+					{InstanceID: "condition", LibraryID: seedFloodConditionID, Position: NodePosition{X: 770, Y: 300}},
+					{InstanceID: "sms", LibraryID: seedSmsID, Position: NodePosition{X: 1080, Y: 88}},
+					{InstanceID: "end", LibraryID: seedEndID, Position: NodePosition{X: 1340, Y: 300}},
+				},
+				Edges: []Edge{
+					seedEdge("e1", "start", "form", "", "Initialize", `{"stroke": "#10b981", "strokeWidth": 3}`, ""),
+					seedEdge("e2", "form", "flood-api", "", "Submit Data", `{"stroke": "#3b82f6", "strokeWidth": 3}`, ""),
+					seedEdge("e3", "flood-api", "condition", "", "Flood Risk Data", `{"stroke": "#f97316", "strokeWidth": 3}`, ""),
+					seedEdge("e4", "condition", "sms", "true", "✓ High Risk", `{"stroke": "#ef4444", "strokeWidth": 3}`, `{"fill": "#ef4444", "fontWeight": "bold"}`),
+					seedEdge("e5", "condition", "end", "false", "✗ Low Risk", `{"stroke": "#6b7280", "strokeWidth": 3}`, `{"fill": "#6b7280", "fontWeight": "bold"}`),
+					seedEdge("e6", "sms", "end", "", "Alert Sent", `{"stroke": "#ef4444", "strokeWidth": 2}`, `{"fill": "#ef4444", "fontWeight": "bold"}`),
+				},
+			},
+			{
+				ID:   SeedLoopWorkflowID,
+				Name: "Weather Monitor Loop",
+				Instances: []FixtureInstance{
+					{InstanceID: "start", LibraryID: seedStartID, Position: NodePosition{X: -160, Y: 300}},
+					{InstanceID: "form", LibraryID: seedWeatherFormID, Position: NodePosition{X: 150, Y: 300}},
+					{InstanceID: "weather-api", LibraryID: seedWeatherAPIID, Position: NodePosition{X: 460, Y: 300}},
+					{InstanceID: "condition", LibraryID: seedTempConditionID, Position: NodePosition{X: 770, Y: 300}},
+					{InstanceID: "email", LibraryID: seedEmailID, Position: NodePosition{X: 1080, Y: 88}},
+					{InstanceID: "end", LibraryID: seedEndID, Position: NodePosition{X: 1080, Y: 512}},
+				},
+				Edges: []Edge{
+					seedEdge("e1", "start", "form", "", "Initialize", `{"stroke": "#10b981", "strokeWidth": 3}`, ""),
+					seedEdge("e2", "form", "weather-api", "", "Submit Data", `{"stroke": "#3b82f6", "strokeWidth": 3}`, ""),
+					seedEdge("e3", "weather-api", "condition", "", "Temperature Data", `{"stroke": "#f97316", "strokeWidth": 3}`, ""),
+					seedEdge("e4", "condition", "email", "true", "✓ Too Hot", `{"stroke": "#ef4444", "strokeWidth": 3}`, `{"fill": "#ef4444", "fontWeight": "bold"}`),
+					seedEdge("e5", "condition", "end", "false", "✗ All Clear", `{"stroke": "#6b7280", "strokeWidth": 3}`, `{"fill": "#6b7280", "fontWeight": "bold"}`),
+					seedEdge("e6", "email", "weather-api", "", "↻ Re-check", `{"stroke": "#a855f7", "strokeWidth": 2, "strokeDasharray": "5,5"}`, `{"fill": "#a855f7", "fontWeight": "bold"}`),
+				},
+			},
+		},
+
+		// V20: default execution limits
+		Limits: []ExecutionLimit{
+			{Scope: LimitScopeGlobal, MaxConcurrent: 50},
+			{Scope: LimitScopeAPIKey, RatePerMinute: 60, Burst: 20},
+			{Scope: LimitScopeWorkflow, RatePerMinute: 120, Burst: 30, MaxConcurrent: 10},
+		},
+	}
+}
+
+// seedEdge builds an edge row the way the seed migrations insert it:
+// smoothstep, animated, with optional handle, label and styles.
+func seedEdge(id, source, target, handle, label, style, labelStyle string) Edge {
+	e := Edge{
+		ID:       id,
+		Source:   source,
+		Target:   target,
+		Type:     "smoothstep",
+		Animated: true,
+		Style:    json.RawMessage(style),
+	}
+	if handle != "" {
+		e.SourceHandle = &handle
+	}
+	if label != "" {
+		e.Label = &label
+	}
+	if labelStyle != "" {
+		e.LabelStyle = json.RawMessage(labelStyle)
+	}
+	return e
+}
@@ -0,0 +1,211 @@
+package storage_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/services/storage"
+)
+
+// migrationDir holds the Flyway seeds that SeedFixtures must mirror.
+const migrationDir = "../../pkg/db/migration"
+
+var (
+	seedLibraryRow = regexp.MustCompile(
+		`\('([0-9a-f-]{36})', '(\w+)', '([^']*)', '([^']*)',\s*'(\{[^']*\})'\)`)
+	seedWorkflowRow = regexp.MustCompile(
+		`INSERT INTO workflows \(id, name\)\s*VALUES \('([0-9a-f-]{36})', '([^']+)'\)`)
+	seedInstanceRow = regexp.MustCompile(
+		`\('([0-9a-f-]{36})',\s*'([\w-]+)',\s*'([0-9a-f-]{36})',\s*(-?\d+),\s*(-?\d+)\)`)
+	seedEdgeRow = regexp.MustCompile(
+		`\('([0-9a-f-]{36})', '(\w+)', '([\w-]+)', '([\w-]+)', (null|'\w+'),\s*true, (E?'[^']*'), '(\{[^']*\})', (null|'\{[^']*\}')\)`)
+	seedLimitRow = regexp.MustCompile(
+		`\('(global|api_key|workflow)', '([^']*)', (\d+), (\d+), (\d+)\)`)
+)
+
+func migrationVersion(path string) int {
+	name := strings.TrimPrefix(filepath.Base(path), "V")
+	v, _ := strconv.Atoi(name[:strings.Index(name, "__")])
+	return v
+}
+
+// TestSeedFixtures_MatchMigrations parses the seed SQL and checks that
+// SeedFixtures contains exactly the same rows, so the memory store and a
+// freshly migrated Postgres database always start from identical data.
+func TestSeedFixtures_MatchMigrations(t *testing.T) {
+	t.Parallel()
+
+	files, err := filepath.Glob(filepath.Join(migrationDir, "V*.sql"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("failed to find migrations in %s: %v", migrationDir, err)
+	}
+	// Apply them in version order like the migrator, not name order (V10 < V2).
+	sort.Slice(files, func(i, j int) bool { return migrationVersion(files[i]) < migrationVersion(files[j]) })
+	var sql strings.Builder
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatalf("read %s: %v", f, err)
+		}
+		sql.Write(b)
+		sql.WriteString("\n")
+	}
+	src := sql.String()
+
+	fixtures := storage.SeedFixtures()
+
+	// Library blueprints
+	var wantLibrary []storage.NodeLibraryEntry
+	for _, m := range seedLibraryRow.FindAllStringSubmatch(src, -1) {
+		wantLibrary = append(wantLibrary, storage.NodeLibraryEntry{
+			ID: m[1], NodeType: m[2], Label: m[3], Description: m[4], Metadata: json.RawMessage(m[5]),
+		})
+	}
+	if len(wantLibrary) != len(fixtures.Library) {
+		t.Fatalf("expected %d library entries, fixtures have %d", len(wantLibrary), len(fixtures.Library))
+	}
+	for i, want := range wantLibrary {
+		got := fixtures.Library[i]
+		if got.ID != want.ID || got.NodeType != want.NodeType || got.Label != want.Label || got.Description != want.Description {
+			t.Errorf("library entry %d: expected %+v, got %+v", i, want, got)
+		}
+		if !sameJSON(t, got.Metadata, want.Metadata) {
+			t.Errorf("library entry %s: metadata mismatch\nwant %s\ngot  %s", want.ID, want.Metadata, got.Metadata)
+		}
+	}
+
+	// Workflow headers
+	fixtureByID := make(map[uuid.UUID]storage.FixtureWorkflow)
+	for _, fw := range fixtures.Workflows {
+		fixtureByID[fw.ID] = fw
+	}
+	headers := seedWorkflowRow.FindAllStringSubmatch(src, -1)
+	if len(headers) != len(fixtures.Workflows) {
+		t.Fatalf("expected %d workflows, fixtures have %d", len(headers), len(fixtures.Workflows))
+	}
+	for _, m := range headers {
+		fw, ok := fixtureByID[uuid.MustParse(m[1])]
+		if !ok {
+			t.Errorf("workflow %s missing from fixtures", m[1])
+			continue
+		}
+		if fw.Name != m[2] {
+			t.Errorf("workflow %s: expected name %q, got %q", m[1], m[2], fw.Name)
+		}
+	}
+
+	// Canvas instances
+	wantInstances := make(map[uuid.UUID][]storage.FixtureInstance)
+	for _, m := range seedInstanceRow.FindAllStringSubmatch(src, -1) {
+		x, _ := strconv.ParseFloat(m[4], 64)
+		y, _ := strconv.ParseFloat(m[5], 64)
+		wfID := uuid.MustParse(m[1])
+		wantInstances[wfID] = append(wantInstances[wfID], storage.FixtureInstance{
+			InstanceID: m[2],
+			LibraryID:  uuid.MustParse(m[3]),
+			Position:   storage.NodePosition{X: x, Y: y},
+		})
+	}
+	for wfID, want := range wantInstances {
+		if got := fixtureByID[wfID].Instances; !reflect.DeepEqual(got, want) {
+			t.Errorf("workflow %s instances:\nwant %+v\ngot  %+v", wfID, want, got)
+		}
+	}
+
+	// Edges
+	wantEdges := make(map[uuid.UUID][]storage.Edge)
+	for _, m := range seedEdgeRow.FindAllStringSubmatch(src, -1) {
+		e := storage.Edge{
+			ID:       m[2],
+			Source:   m[3],
+			Target:   m[4],
+			Type:     "smoothstep",
+			Animated: true,
+			Style:    json.RawMessage(m[7]),
+		}
+		if m[5] != "null" {
+			h := strings.Trim(m[5], "'")
+			e.SourceHandle = &h
+		}
+		label := sqlString(t, m[6])
+		e.Label = &label
+		if m[8] != "null" {
+			e.LabelStyle = json.RawMessage(strings.Trim(m[8], "'"))
+		}
+		wfID := uuid.MustParse(m[1])
+		wantEdges[wfID] = append(wantEdges[wfID], e)
+	}
+	for wfID, want := range wantEdges {
+		got := fixtureByID[wfID].Edges
+		if len(got) != len(want) {
+			t.Errorf("workflow %s: expected %d edges, got %d", wfID, len(want), len(got))
+			continue
+		}
+		for i := range want {
+			w, g := want[i], got[i]
+			if w.ID != g.ID || w.Source != g.Source || w.Target != g.Target || w.Type != g.Type || w.Animated != g.Animated ||
+				!reflect.DeepEqual(w.SourceHandle, g.SourceHandle) || !reflect.DeepEqual(w.Label, g.Label) {
+				t.Errorf("workflow %s edge %s: expected %+v, got %+v", wfID, w.ID, w, g)
+			}
+			if !sameJSON(t, g.Style, w.Style) || !sameJSON(t, g.LabelStyle, w.LabelStyle) {
+				t.Errorf("workflow %s edge %s: style mismatch", wfID, w.ID)
+			}
+		}
+	}
+
+	if len(wantInstances) != len(fixtures.Workflows) || len(wantEdges) != len(fixtures.Workflows) {
+		t.Errorf("expected instances and edges for all %d workflows, SQL has %d and %d",
+			len(fixtures.Workflows), len(wantInstances), len(wantEdges))
+	}
+
+	// Execution limits
+	var wantLimits []storage.ExecutionLimit
+	for _, m := range seedLimitRow.FindAllStringSubmatch(src, -1) {
+		rate, _ := strconv.Atoi(m[3])
+		burst, _ := strconv.Atoi(m[4])
+		concurrent, _ := strconv.Atoi(m[5])
+		wantLimits = append(wantLimits, storage.ExecutionLimit{
+			Scope: m[1], Subject: m[2], RatePerMinute: rate, Burst: burst, MaxConcurrent: concurrent,
+		})
+	}
+	if !reflect.DeepEqual(fixtures.Limits, wantLimits) {
+		t.Errorf("execution limits:\nwant %+v\ngot  %+v", wantLimits, fixtures.Limits)
+	}
+}
+
+// sqlString decodes a quoted SQL literal, including E'\uXXXX' escapes.
+func sqlString(t *testing.T, lit string) string {
+	t.Helper()
+	if strings.HasPrefix(lit, "E'") {
+		s, err := strconv.Unquote(`"` + strings.TrimSuffix(strings.TrimPrefix(lit, "E'"), "'") + `"`)
+		if err != nil {
+			t.Fatalf("decode %s: %v", lit, err)
+		}
+		return s
+	}
+	return strings.Trim(lit, "'")
+}
+
+func sameJSON(t *testing.T, a, b json.RawMessage) bool {
+	t.Helper()
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	var av, bv any
+	if err := json.Unmarshal(a, &av); err != nil {
+		t.Fatalf("invalid JSON %s: %v", a, err)
+	}
+	if err := json.Unmarshal(b, &bv); err != nil {
+		t.Fatalf("invalid JSON %s: %v", b, err)
+	}
+	return reflect.DeepEqual(av, bv)
+}
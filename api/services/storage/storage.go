@@ -3,11 +3,14 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -34,14 +37,75 @@ type pgStorage struct {
 // Storage defines the interface for workflow data access.
 // This abstraction allows the workflow service to remain decoupled from
 // the persistence layer, making it testable and swappable.
+//
+// Methods only see the data of the workspace their context is scoped to
+// (see WithWorkspace), plus the global node library. ClaimDueRuns,
+// ListRetentionPolicies and DeleteExpiredIdempotencyKeys are maintenance
+// methods that span every workspace, as are the API key, workspace and
+// execution limit methods.
 type Storage interface {
 	GetWorkflow(ctx context.Context, id uuid.UUID) (*Workflow, error)
 	UpsertWorkflow(ctx context.Context, wf *Workflow) error
+	ImportWorkflow(ctx context.Context, wf *Workflow, entries []NodeLibraryEntry) error
 	DeleteWorkflow(ctx context.Context, id uuid.UUID) error
 	PublishWorkflow(ctx context.Context, id uuid.UUID) (*WorkflowSnapshot, error)
 	GetActiveSnapshot(ctx context.Context, workflowID uuid.UUID) (*WorkflowSnapshot, error)
+	GetSnapshot(ctx context.Context, workflowID uuid.UUID, version int) (*WorkflowSnapshot, error)
+
+	ListNodeLibrary(ctx context.Context) ([]NodeLibraryEntry, error)
+	CreateNodeLibraryEntry(ctx context.Context, entry *NodeLibraryEntry) error
+
+	ListTestCases(ctx context.Context, workflowID uuid.UUID) ([]TestCase, error)
+	ReplaceTestCases(ctx context.Context, workflowID uuid.UUID, cases []TestCase) error
+
+	CreateRun(ctx context.Context, run *Run) error
+	GetRun(ctx context.Context, workflowID, runID uuid.UUID) (*Run, error)
+	UpdateRun(ctx context.Context, run *Run) error
+	ClaimDueRuns(ctx context.Context, now, retryAt time.Time, limit int) ([]Run, error)
+	ListRuns(ctx context.Context, filter RunFilter) ([]Run, error)
+	RunStats(ctx context.Context, filter RunFilter) (*RunStats, error)
+	ListRetentionPolicies(ctx context.Context) ([]WorkflowRetention, error)
+	PruneRuns(ctx context.Context, filter RunPruneFilter, limit int, archive func([]Run) error) (int, error)
+
+	CreateTask(ctx context.Context, task *Task) error
+	GetTask(ctx context.Context, id uuid.UUID) (*Task, error)
+	ListTasks(ctx context.Context, filter TaskFilter) ([]Task, error)
+	CompleteTask(ctx context.Context, id uuid.UUID, status string, response json.RawMessage, by string, retryAt time.Time) (*Task, error)
+
+	ClaimIdempotencyKey(ctx context.Context, key *IdempotencyKey) (*IdempotencyKey, error)
+	CompleteIdempotencyKey(ctx context.Context, key *IdempotencyKey) error
+	ReleaseIdempotencyKey(ctx context.Context, key *IdempotencyKey) error
+	DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int, error)
+
+	CreateAPIKey(ctx context.Context, key *APIKey) error
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]APIKey, error)
+	RevokeAPIKey(ctx context.Context, id uuid.UUID, at time.Time) (*APIKey, error)
+
+	ListAuditEvents(ctx context.Context, filter AuditFilter) ([]AuditEvent, error)
+
+	GetWorkspace(ctx context.Context, id string) (*Workspace, error)
+	ListWorkspaces(ctx context.Context) ([]Workspace, error)
+	CreateWorkspace(ctx context.Context, ws *Workspace) error
+	UpdateWorkspace(ctx context.Context, ws *Workspace) error
+
+	PutSecret(ctx context.Context, secret *Secret) (created bool, err error)
+	GetSecret(ctx context.Context, name string) (*Secret, error)
+	ListSecrets(ctx context.Context) ([]Secret, error)
+	DeleteSecret(ctx context.Context, name string) error
+
+	ListExecutionLimits(ctx context.Context) ([]ExecutionLimit, error)
 }
 
+// ErrTaskNotPending is returned by CompleteTask when the task has already
+// been completed, so only one response (or expiry) resumes the run.
+var ErrTaskNotPending = errors.New("task is not pending")
+
+// ErrIdempotencyKeyTaken is returned, along with the existing record, by
+// ClaimIdempotencyKey when the key is completed and unexpired, or held by a
+// request whose lease has not run out.
+var ErrIdempotencyKeyTaken = errors.New("idempotency key is taken")
+
 // NewInstance creates a new PostgreSQL-backed Storage implementation.
 func NewInstance(db *pgxpool.Pool) (Storage, error) {
 	if db == nil {
@@ -56,6 +120,7 @@ func hydrateNodes(ctx context.Context, q querier, workflowID uuid.UUID) ([]Node,
         SELECT
             i.instance_id,
             l.node_type,
+            i.node_library_id,
             i.x_pos, i.y_pos,
             l.base_label as label,
             l.base_description,
@@ -75,6 +140,7 @@ func hydrateNodes(ctx context.Context, q querier, workflowID uuid.UUID) ([]Node,
 		err := rows.Scan(
 			&n.ID,
 			&n.Type,
+			&n.LibraryID,
 			&n.Position.X, &n.Position.Y,
 			&n.Data.Label,
 			&n.Data.Description,
@@ -158,15 +224,19 @@ func (r *pgStorage) GetWorkflow(ctx context.Context, id uuid.UUID) (*Workflow, e
 	}
 
 	// 1. Fetch workflow header, respecting soft-deletion.
+	var settings []byte
 	err = tx.QueryRow(timeoutCtx, `
-        SELECT name, status, active_snapshot_id, created_at, modified_at
+        SELECT name, status, active_snapshot_id, settings, created_at, modified_at
         FROM workflows
-        WHERE id = $1 AND deleted_at IS NULL`,
-		id).Scan(&wf.Name, &wf.Status, &wf.ActiveSnapshotID, &wf.CreatedAt, &wf.ModifiedAt)
+        WHERE id = $1 AND workspace_id = $2 AND deleted_at IS NULL`,
+		id, WorkspaceFrom(ctx)).Scan(&wf.Name, &wf.Status, &wf.ActiveSnapshotID, &settings, &wf.CreatedAt, &wf.ModifiedAt)
 
 	if err != nil {
 		return nil, err // pgx.ErrNoRows if not found
 	}
+	if err := json.Unmarshal(settings, &wf.Settings); err != nil {
+		return nil, fmt.Errorf("decode settings of workflow %s: %w", id, err)
+	}
 
 	// 2. Hydrate nodes by joining instance positions with library blueprints.
 	nodes, err := hydrateNodes(timeoutCtx, tx, id)
@@ -189,13 +259,21 @@ func (r *pgStorage) GetWorkflow(ctx context.Context, id uuid.UUID) (*Workflow, e
 	return wf, tx.Commit(timeoutCtx)
 }
 
-// UpsertWorkflow saves a workflow in a single READ COMMITTED transaction:
+// UpsertWorkflow saves a workflow in a single READ COMMITTED transaction.
+// After locking and reading the current workflow for the audit diff, it:
 //  1. Upserts the workflow header (INSERT … ON CONFLICT DO UPDATE), clearing deleted_at on re-save
-//  2. Deletes then re-inserts all workflow_node_instances (maps node types to node_library IDs)
-//  3. Deletes then re-inserts all workflow_edges with their visual properties
+//  2. Checks the workspace's workflow quota, if the workflow is new
+//  3. Deletes all workflow_edges (they reference the instances)
+//  4. Deletes all workflow_node_instances
+//  5. Re-inserts the workflow_node_instances (pinned LibraryID, or node type mapped to a node_library
+//     ID visible to the workspace)
+//  6. Re-inserts the workflow_edges with their visual properties
+//  7. Appends a workflow.create or workflow.update audit event
 //
 // The delete-and-reinsert strategy keeps the write path simple at the cost of
-// replacing every child row on each save.
+// replacing every child row on each save. Returns ErrOtherWorkspace if the ID
+// belongs to another workspace's workflow and ErrQuotaExceeded if a new
+// workflow would exceed the workspace's quota.
 func (r *pgStorage) UpsertWorkflow(ctx context.Context, wf *Workflow) error {
 	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Second) // Increased timeout for multiple operations
 	defer cancel()
@@ -208,27 +286,107 @@ func (r *pgStorage) UpsertWorkflow(ctx context.Context, wf *Workflow) error {
 	}
 	defer tx.Rollback(timeoutCtx) // Rollback on error or if not committed
 
+	if err := upsertWorkflow(timeoutCtx, tx, wf); err != nil {
+		return err
+	}
+	return tx.Commit(timeoutCtx)
+}
+
+// ImportWorkflow creates the library entries, then saves wf like
+// UpsertWorkflow, all in one transaction: if any step fails, nothing is
+// written. Nodes may pin the new entries. An entry whose ID is taken in any
+// workspace or the global library returns a *LibraryIDTakenError.
+func (r *pgStorage) ImportWorkflow(ctx context.Context, wf *Workflow, entries []NodeLibraryEntry) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	ids := make([]uuid.UUID, len(entries))
+	for i := range entries {
+		id, err := prepareLibraryEntry(&entries[i])
+		if err != nil {
+			return err
+		}
+		ids[i] = id
+	}
+
+	tx, err := r.DB.BeginTx(timeoutCtx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+	if err != nil {
+		return fmt.Errorf("begin transaction for import: %w", err)
+	}
+	defer tx.Rollback(timeoutCtx)
+
+	for i := range entries {
+		if err := insertLibraryEntry(timeoutCtx, tx, &entries[i], ids[i]); err != nil {
+			if errors.Is(err, ErrLibraryIDTaken) {
+				return &LibraryIDTakenError{ID: entries[i].ID}
+			}
+			return err
+		}
+	}
+	if err := upsertWorkflow(timeoutCtx, tx, wf); err != nil {
+		return err
+	}
+	return tx.Commit(timeoutCtx)
+}
+
+// upsertWorkflow runs the steps of UpsertWorkflow in tx.
+func upsertWorkflow(ctx context.Context, tx pgx.Tx, wf *Workflow) error {
+	// Lock and read the current state for the audit diff.
+	before, err := loadAuditWorkflow(ctx, tx, wf.ID)
+	if err != nil {
+		return fmt.Errorf("load workflow for audit: %w", err)
+	}
+
 	now := time.Now()
 	if wf.CreatedAt.IsZero() {
 		wf.CreatedAt = now
 	}
 	wf.ModifiedAt = now
 
-	// 1. Upsert the main workflow entry
-	_, err = tx.Exec(timeoutCtx, `
-        INSERT INTO workflows (id, name, created_at, modified_at)
-        VALUES ($1, $2, $3, $4)
+	settings, err := json.Marshal(wf.Settings)
+	if err != nil {
+		return fmt.Errorf("encode workflow settings: %w", err)
+	}
+
+	// 1. Upsert the main workflow entry. The update only matches a workflow
+	// of the same workspace, so an ID cannot be taken over from another.
+	workspaceID := WorkspaceFrom(ctx)
+	result, err := tx.Exec(ctx, `
+        INSERT INTO workflows (id, workspace_id, name, settings, created_at, modified_at)
+        VALUES ($1, $2, $3, $4, $5, $6)
         ON CONFLICT (id) DO UPDATE SET
             name = EXCLUDED.name,
+            settings = EXCLUDED.settings,
             modified_at = EXCLUDED.modified_at,
-            deleted_at = NULL;`, // Ensure workflow is 'undeleted' if upserted
-		wf.ID, wf.Name, wf.CreatedAt, wf.ModifiedAt)
+            deleted_at = NULL -- Ensure workflow is 'undeleted' if upserted
+        WHERE workflows.workspace_id = EXCLUDED.workspace_id;`,
+		wf.ID, workspaceID, wf.Name, settings, wf.CreatedAt, wf.ModifiedAt)
 	if err != nil {
 		return fmt.Errorf("upsert workflow header: %w", err)
 	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("workflow %s: %w", wf.ID, ErrOtherWorkspace)
+	}
 
-	// 2. Delete existing workflow_node_instances for this workflow
-	_, err = tx.Exec(timeoutCtx, `
+	// 2. A new (or undeleted) workflow counts towards the quota.
+	if before == nil {
+		if err := checkWorkflowQuota(ctx, tx, workspaceID); err != nil {
+			return err
+		}
+	}
+
+	// 3. Delete existing workflow_edges first: their composite foreign keys
+	// reference the instances removed in the next step.
+	_, err = tx.Exec(ctx, `
+        DELETE FROM workflow_edges
+        WHERE workflow_id = $1;`,
+		wf.ID)
+	if err != nil {
+		return fmt.Errorf("delete old workflow edges: %w", err)
+	}
+
+	// 4. Delete existing workflow_node_instances for this workflow
+	_, err = tx.Exec(ctx, `
         DELETE FROM workflow_node_instances
         WHERE workflow_id = $1;`,
 		wf.ID)
@@ -236,13 +394,22 @@ func (r *pgStorage) UpsertWorkflow(ctx context.Context, wf *Workflow) error {
 		return fmt.Errorf("delete old workflow node instances: %w", err)
 	}
 
-	// 3. Insert new workflow_node_instances
+	// 5. Insert new workflow_node_instances
 	// To correctly insert workflow_node_instances, we need the node_library_id for each node.
 	// This requires querying the node_library table to map node_type (from wf.Nodes) to node_library.id.
 
-	// Let's create a map to store `node_type` to `node_library_id` mappings.
+	// Let's create a map to store `node_type` to `node_library_id` mappings,
+	// plus the type of every entry so pinned library IDs can be checked.
+	// Only the global library and the workspace's own entries are visible.
+	// A type with several entries maps to the oldest global one, else the
+	// workspace's oldest, so an unpinned node always resolves the same way.
 	nodeLibraryIDs := make(map[string]uuid.UUID)
-	nodeLibraryRows, err := tx.Query(timeoutCtx, `SELECT id, node_type FROM node_library;`)
+	nodeLibraryTypes := make(map[uuid.UUID]string)
+	nodeLibraryRows, err := tx.Query(ctx, `
+        SELECT id, node_type FROM node_library
+        WHERE workspace_id IS NULL OR workspace_id = $1
+        ORDER BY workspace_id NULLS FIRST, created_at, id;`,
+		workspaceID)
 	if err != nil {
 		return fmt.Errorf("query node_library for IDs: %w", err)
 	}
@@ -254,19 +421,24 @@ func (r *pgStorage) UpsertWorkflow(ctx context.Context, wf *Workflow) error {
 		if err := nodeLibraryRows.Scan(&id, &nodeType); err != nil {
 			return fmt.Errorf("scan node_library row: %w", err)
 		}
-		nodeLibraryIDs[nodeType] = id
+		if _, ok := nodeLibraryIDs[nodeType]; !ok {
+			nodeLibraryIDs[nodeType] = id
+		}
+		nodeLibraryTypes[id] = nodeType
 	}
 	if err := nodeLibraryRows.Err(); err != nil {
 		return fmt.Errorf("node_library rows error: %w", err)
 	}
 
+	after := &auditWorkflow{Name: wf.Name, Settings: wf.Settings, Nodes: make([]auditNode, 0, len(wf.Nodes)), Edges: wf.Edges}
 	for _, node := range wf.Nodes {
-		nodeLibraryID, ok := nodeLibraryIDs[node.Type]
-		if !ok {
-			return fmt.Errorf("node type %s not found in node_library", node.Type)
+		nodeLibraryID, err := resolveLibraryID(node, nodeLibraryIDs, nodeLibraryTypes)
+		if err != nil {
+			return err
 		}
+		after.Nodes = append(after.Nodes, auditNode{ID: node.ID, Type: node.Type, LibraryID: nodeLibraryID.String(), Position: node.Position})
 
-		_, err = tx.Exec(timeoutCtx, `
+		_, err = tx.Exec(ctx, `
             INSERT INTO workflow_node_instances (workflow_id, instance_id, node_library_id, x_pos, y_pos)
             VALUES ($1, $2, $3, $4, $5);`,
 			wf.ID, node.ID, nodeLibraryID, node.Position.X, node.Position.Y)
@@ -275,18 +447,9 @@ func (r *pgStorage) UpsertWorkflow(ctx context.Context, wf *Workflow) error {
 		}
 	}
 
-	// 4. Delete existing workflow_edges for this workflow
-	_, err = tx.Exec(timeoutCtx, `
-        DELETE FROM workflow_edges
-        WHERE workflow_id = $1;`,
-		wf.ID)
-	if err != nil {
-		return fmt.Errorf("delete old workflow edges: %w", err)
-	}
-
-	// 5. Insert new workflow_edges
+	// 6. Insert new workflow_edges
 	for _, edge := range wf.Edges {
-		_, err = tx.Exec(timeoutCtx, `
+		_, err = tx.Exec(ctx, `
             INSERT INTO workflow_edges (
                 workflow_id, edge_id, source_instance_id, target_instance_id, source_handle,
                 edge_type, animated, label, style_props, label_style
@@ -298,13 +461,78 @@ func (r *pgStorage) UpsertWorkflow(ctx context.Context, wf *Workflow) error {
 		}
 	}
 
-	return tx.Commit(timeoutCtx)
+	// 7. Record the change.
+	action := AuditWorkflowUpdate
+	if before == nil {
+		action = AuditWorkflowCreate
+	}
+	return insertAuditEvent(ctx, tx, action, AuditTargetWorkflow, wf.ID.String(), before, after)
+}
+
+// resolveLibraryID returns the node_library entry a node instance should point
+// at: its pinned LibraryID if set (which must exist and match the node type),
+// otherwise the library entry registered for its node type.
+func resolveLibraryID(node Node, byType map[string]uuid.UUID, types map[uuid.UUID]string) (uuid.UUID, error) {
+	if node.LibraryID == "" {
+		id, ok := byType[node.Type]
+		if !ok {
+			return uuid.Nil, fmt.Errorf("node type %s not found in node_library", node.Type)
+		}
+		return id, nil
+	}
+
+	id, err := uuid.Parse(node.LibraryID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("node %s: invalid library id %q", node.ID, node.LibraryID)
+	}
+	nodeType, ok := types[id]
+	if !ok {
+		return uuid.Nil, fmt.Errorf("node %s: library entry %s not found in node_library", node.ID, id)
+	}
+	if nodeType != node.Type {
+		return uuid.Nil, fmt.Errorf("node %s: library entry %s has type %s, not %s", node.ID, id, nodeType, node.Type)
+	}
+	return id, nil
+}
+
+// checkWorkflowQuota returns ErrQuotaExceeded if the workspace has more
+// workflows than it allows, counting those written in tx. Only a workspace
+// with a quota is locked, so concurrent creates are counted one after
+// another.
+func checkWorkflowQuota(ctx context.Context, tx pgx.Tx, workspaceID string) error {
+	var limit *int
+	err := tx.QueryRow(ctx, `
+        SELECT max_workflows FROM workspaces
+        WHERE id = $1`,
+		workspaceID).Scan(&limit)
+	if err != nil {
+		return fmt.Errorf("get workspace %s: %w", workspaceID, err)
+	}
+	if limit == nil {
+		return nil
+	}
+	if err := lockQuota(ctx, tx, "workflows", workspaceID); err != nil {
+		return err
+	}
+	var count int
+	err = tx.QueryRow(ctx, `
+        SELECT COUNT(*) FROM workflows
+        WHERE workspace_id = $1 AND deleted_at IS NULL`,
+		workspaceID).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("count workflows: %w", err)
+	}
+	if count > *limit {
+		return fmt.Errorf("workspace %s allows %d workflows: %w", workspaceID, *limit, ErrQuotaExceeded)
+	}
+	return nil
 }
 
 // DeleteWorkflow removes a workflow in a single READ COMMITTED transaction:
 //  1. Hard-deletes all workflow_edges for the workflow
 //  2. Hard-deletes all workflow_node_instances for the workflow
 //  3. Soft-deletes the workflow header (sets deleted_at and modified_at)
+//  4. Appends a workflow.delete audit event, unless it was already deleted
 //
 // Returns pgx.ErrNoRows if the workflow does not exist.
 func (r *pgStorage) DeleteWorkflow(ctx context.Context, id uuid.UUID) error {
@@ -319,6 +547,11 @@ func (r *pgStorage) DeleteWorkflow(ctx context.Context, id uuid.UUID) error {
 	}
 	defer tx.Rollback(timeoutCtx)
 
+	before, err := loadAuditWorkflow(timeoutCtx, tx, id)
+	if err != nil {
+		return fmt.Errorf("load workflow for audit: %w", err)
+	}
+
 	// 1. Hard delete workflow_edges for this workflow
 	_, err = tx.Exec(timeoutCtx, `
         DELETE FROM workflow_edges
@@ -337,12 +570,13 @@ func (r *pgStorage) DeleteWorkflow(ctx context.Context, id uuid.UUID) error {
 		return fmt.Errorf("delete workflow node instances: %w", err)
 	}
 
-	// 3. Soft delete the main workflow entry
+	// 3. Soft delete the main workflow entry. A workflow of another
+	// workspace is not found, which rolls back the deletes above.
 	result, err := tx.Exec(timeoutCtx, `
         UPDATE workflows
         SET deleted_at = $1, modified_at = $1
-        WHERE id = $2;`,
-		time.Now(), id)
+        WHERE id = $2 AND workspace_id = $3;`,
+		time.Now(), id, WorkspaceFrom(ctx))
 	if err != nil {
 		return fmt.Errorf("soft delete workflow header: %w", err)
 	}
@@ -351,12 +585,20 @@ func (r *pgStorage) DeleteWorkflow(ctx context.Context, id uuid.UUID) error {
 		return pgx.ErrNoRows // Indicate workflow not found
 	}
 
+	// 4. Record the change.
+	if before != nil {
+		if err := insertAuditEvent(timeoutCtx, tx, AuditWorkflowDelete, AuditTargetWorkflow, id.String(), before, nil); err != nil {
+			return err
+		}
+	}
+
 	return tx.Commit(timeoutCtx)
 }
 
 // PublishWorkflow creates an immutable snapshot of the workflow's current DAG
 // within a REPEATABLE READ transaction. The snapshot freezes nodes and edges
-// so that future execution is decoupled from live node_library changes.
+// so that future execution is decoupled from live node_library changes. A
+// workflow.publish audit event is appended in the same transaction.
 func (r *pgStorage) PublishWorkflow(ctx context.Context, id uuid.UUID) (*WorkflowSnapshot, error) {
 	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
@@ -369,12 +611,14 @@ func (r *pgStorage) PublishWorkflow(ctx context.Context, id uuid.UUID) (*Workflo
 	}
 	defer tx.Rollback(timeoutCtx)
 
-	// 1. Verify workflow exists and is not deleted.
-	var name string
+	// 1. Verify workflow exists and is not deleted; its settings are frozen
+	// with the graph.
+	workspaceID := WorkspaceFrom(ctx)
+	var settings []byte
 	err = tx.QueryRow(timeoutCtx, `
-        SELECT name FROM workflows
-        WHERE id = $1 AND deleted_at IS NULL`,
-		id).Scan(&name)
+        SELECT settings FROM workflows
+        WHERE id = $1 AND workspace_id = $2 AND deleted_at IS NULL`,
+		id, workspaceID).Scan(&settings)
 	if err != nil {
 		return nil, err
 	}
@@ -392,6 +636,9 @@ func (r *pgStorage) PublishWorkflow(ctx context.Context, id uuid.UUID) (*Workflo
 
 	// 3. Marshal the DAG into JSON.
 	dagData := DagData{Nodes: nodes, Edges: edges}
+	if err := json.Unmarshal(settings, &dagData.Settings); err != nil {
+		return nil, fmt.Errorf("decode settings of workflow %s: %w", id, err)
+	}
 	if dagData.Nodes == nil {
 		dagData.Nodes = []Node{}
 	}
@@ -421,10 +668,10 @@ func (r *pgStorage) PublishWorkflow(ctx context.Context, id uuid.UUID) (*Workflo
 		DagData:       dagData,
 	}
 	err = tx.QueryRow(timeoutCtx, `
-        INSERT INTO workflow_snapshots (workflow_id, version_number, dag_data)
-        VALUES ($1, $2, $3)
+        INSERT INTO workflow_snapshots (workflow_id, workspace_id, version_number, dag_data)
+        VALUES ($1, $2, $3, $4)
         RETURNING id, published_at`,
-		id, nextVersion, dagJSON).Scan(&snap.ID, &snap.PublishedAt)
+		id, workspaceID, nextVersion, dagJSON).Scan(&snap.ID, &snap.PublishedAt)
 	if err != nil {
 		return nil, fmt.Errorf("insert snapshot: %w", err)
 	}
@@ -439,6 +686,13 @@ func (r *pgStorage) PublishWorkflow(ctx context.Context, id uuid.UUID) (*Workflo
 		return nil, fmt.Errorf("update workflow status: %w", err)
 	}
 
+	// 7. Record the publish.
+	err = insertAuditEvent(timeoutCtx, tx, AuditWorkflowPublish, AuditTargetWorkflow, id.String(),
+		&auditPublish{Version: nextVersion - 1}, &auditPublish{Version: nextVersion, SnapshotID: snap.ID.String()})
+	if err != nil {
+		return nil, err
+	}
+
 	if err := tx.Commit(timeoutCtx); err != nil {
 		return nil, fmt.Errorf("commit publish: %w", err)
 	}
@@ -459,8 +713,34 @@ func (r *pgStorage) GetActiveSnapshot(ctx context.Context, workflowID uuid.UUID)
         SELECT s.id, s.workflow_id, s.version_number, s.dag_data, s.published_at
         FROM workflow_snapshots s
         JOIN workflows w ON w.active_snapshot_id = s.id
-        WHERE w.id = $1 AND w.deleted_at IS NULL`,
-		workflowID).Scan(&snap.ID, &snap.WorkflowID, &snap.VersionNumber, &dagJSON, &snap.PublishedAt)
+        WHERE w.id = $1 AND s.workspace_id = $2 AND w.deleted_at IS NULL`,
+		workflowID, WorkspaceFrom(ctx)).Scan(&snap.ID, &snap.WorkflowID, &snap.VersionNumber, &dagJSON, &snap.PublishedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(dagJSON, &snap.DagData); err != nil {
+		return nil, fmt.Errorf("unmarshal snapshot dag_data: %w", err)
+	}
+
+	return snap, nil
+}
+
+// GetSnapshot retrieves a specific published version of a workflow.
+// Returns pgx.ErrNoRows if the workflow or version does not exist.
+func (r *pgStorage) GetSnapshot(ctx context.Context, workflowID uuid.UUID, version int) (*WorkflowSnapshot, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	snap := &WorkflowSnapshot{}
+	var dagJSON []byte
+
+	err := r.DB.QueryRow(timeoutCtx, `
+        SELECT s.id, s.workflow_id, s.version_number, s.dag_data, s.published_at
+        FROM workflow_snapshots s
+        JOIN workflows w ON w.id = s.workflow_id
+        WHERE s.workflow_id = $1 AND s.version_number = $2 AND s.workspace_id = $3 AND w.deleted_at IS NULL`,
+		workflowID, version, WorkspaceFrom(ctx)).Scan(&snap.ID, &snap.WorkflowID, &snap.VersionNumber, &dagJSON, &snap.PublishedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -471,3 +751,1436 @@ func (r *pgStorage) GetActiveSnapshot(ctx context.Context, workflowID uuid.UUID)
 
 	return snap, nil
 }
+
+// ListNodeLibrary returns every non-deleted node_library blueprint visible
+// to the workspace, global and its own, in creation order.
+func (r *pgStorage) ListNodeLibrary(ctx context.Context) ([]NodeLibraryEntry, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.Query(timeoutCtx, `
+        SELECT id, COALESCE(workspace_id, ''), node_type, COALESCE(base_label, ''),
+               COALESCE(base_description, ''), metadata, modified_at
+        FROM node_library
+        WHERE deleted_at IS NULL AND (workspace_id IS NULL OR workspace_id = $1)
+        ORDER BY created_at, id`,
+		WorkspaceFrom(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("query node_library: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []NodeLibraryEntry{}
+	for rows.Next() {
+		var e NodeLibraryEntry
+		if err := rows.Scan(&e.ID, &e.WorkspaceID, &e.NodeType, &e.Label, &e.Description, &e.Metadata, &e.ModifiedAt); err != nil {
+			return nil, fmt.Errorf("scan node_library row: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("node_library rows error: %w", err)
+	}
+	return entries, nil
+}
+
+// CreateNodeLibraryEntry inserts a new blueprint into the workspace's part of
+// node_library, with a library.create audit event in the same transaction.
+// If entry.ID is empty a new UUID is generated. The entry's ID, WorkspaceID
+// and ModifiedAt are filled in on success. Returns ErrLibraryIDTaken if an
+// entry with the ID exists in any workspace or the global library.
+func (r *pgStorage) CreateNodeLibraryEntry(ctx context.Context, entry *NodeLibraryEntry) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	id, err := prepareLibraryEntry(entry)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.DB.BeginTx(timeoutCtx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+	if err != nil {
+		return fmt.Errorf("begin transaction for library entry: %w", err)
+	}
+	defer tx.Rollback(timeoutCtx)
+
+	if err := insertLibraryEntry(timeoutCtx, tx, entry, id); err != nil {
+		return err
+	}
+	return tx.Commit(timeoutCtx)
+}
+
+// prepareLibraryEntry generates the entry's ID if it is empty and parses it.
+func prepareLibraryEntry(entry *NodeLibraryEntry) (uuid.UUID, error) {
+	if entry.ID == "" {
+		entry.ID = uuid.NewString()
+	}
+	id, err := uuid.Parse(entry.ID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("invalid library id %q: %w", entry.ID, err)
+	}
+	return id, nil
+}
+
+// insertLibraryEntry inserts the entry and its library.create audit event in
+// tx. Returns ErrLibraryIDTaken if the ID exists.
+func insertLibraryEntry(ctx context.Context, tx pgx.Tx, entry *NodeLibraryEntry, id uuid.UUID) error {
+	metadata := entry.Metadata
+	if metadata == nil {
+		metadata = json.RawMessage(`{}`)
+	}
+
+	workspaceID := WorkspaceFrom(ctx)
+	err := tx.QueryRow(ctx, `
+        INSERT INTO node_library (id, workspace_id, node_type, base_label, base_description, metadata)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING modified_at`,
+		id, workspaceID, entry.NodeType, entry.Label, entry.Description, metadata).Scan(&entry.ModifiedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("node_library entry %s: %w", entry.ID, ErrLibraryIDTaken)
+		}
+		return fmt.Errorf("insert node_library entry %s: %w", entry.ID, err)
+	}
+	entry.WorkspaceID = workspaceID
+
+	after := &auditLibraryEntry{NodeType: entry.NodeType, Label: entry.Label, Description: entry.Description, Metadata: metadata}
+	return insertAuditEvent(ctx, tx, AuditLibraryCreate, AuditTargetNodeLibrary, id.String(), nil, after)
+}
+
+// ListTestCases returns the workflow's test cases in saved order.
+// Returns pgx.ErrNoRows if the workflow does not exist.
+func (r *pgStorage) ListTestCases(ctx context.Context, workflowID uuid.UUID) ([]TestCase, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var exists bool
+	err := r.DB.QueryRow(timeoutCtx, `
+        SELECT true FROM workflows
+        WHERE id = $1 AND workspace_id = $2 AND deleted_at IS NULL`,
+		workflowID, WorkspaceFrom(ctx)).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.DB.Query(timeoutCtx, `
+        SELECT name, definition, modified_at
+        FROM workflow_test_cases
+        WHERE workflow_id = $1
+        ORDER BY position`,
+		workflowID)
+	if err != nil {
+		return nil, fmt.Errorf("query test cases: %w", err)
+	}
+	defer rows.Close()
+
+	cases := []TestCase{}
+	for rows.Next() {
+		var tc TestCase
+		if err := rows.Scan(&tc.Name, &tc.Definition, &tc.ModifiedAt); err != nil {
+			return nil, fmt.Errorf("scan test case row: %w", err)
+		}
+		cases = append(cases, tc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("test case rows error: %w", err)
+	}
+	return cases, nil
+}
+
+// ReplaceTestCases swaps the workflow's test cases for the given list in a
+// single READ COMMITTED transaction. The workflow row is locked so
+// concurrent replacements cannot interleave. ModifiedAt is filled in on each
+// case. Returns pgx.ErrNoRows if the workflow does not exist.
+func (r *pgStorage) ReplaceTestCases(ctx context.Context, workflowID uuid.UUID, cases []TestCase) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(timeoutCtx, pgx.TxOptions{
+		IsoLevel: pgx.ReadCommitted,
+	})
+	if err != nil {
+		return fmt.Errorf("begin transaction for test cases: %w", err)
+	}
+	defer tx.Rollback(timeoutCtx)
+
+	// 1. Lock the workflow header.
+	var exists bool
+	err = tx.QueryRow(timeoutCtx, `
+        SELECT true FROM workflows
+        WHERE id = $1 AND workspace_id = $2 AND deleted_at IS NULL
+        FOR UPDATE`,
+		workflowID, WorkspaceFrom(ctx)).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	// 2. Drop the previous cases.
+	_, err = tx.Exec(timeoutCtx, `
+        DELETE FROM workflow_test_cases
+        WHERE workflow_id = $1`,
+		workflowID)
+	if err != nil {
+		return fmt.Errorf("delete test cases: %w", err)
+	}
+
+	// 3. Insert the new cases in order.
+	for i := range cases {
+		err = tx.QueryRow(timeoutCtx, `
+            INSERT INTO workflow_test_cases (workflow_id, position, name, definition)
+            VALUES ($1, $2, $3, $4)
+            RETURNING modified_at`,
+			workflowID, i, cases[i].Name, cases[i].Definition).Scan(&cases[i].ModifiedAt)
+		if err != nil {
+			return fmt.Errorf("insert test case %q: %w", cases[i].Name, err)
+		}
+	}
+
+	if err := tx.Commit(timeoutCtx); err != nil {
+		return fmt.Errorf("commit test cases: %w", err)
+	}
+	return nil
+}
+
+// CreateRun records a workflow execution and fills in WorkspaceID and
+// CreatedAt. Returns pgx.ErrNoRows if the workflow does not exist and
+// ErrQuotaExceeded if the workspace has recorded as many runs in the last
+// hour as it allows. The count and the insert share one READ COMMITTED
+// transaction:
+//  1. Checks the workflow exists
+//  2. Locks the workspace row and counts its runs of the last hour
+//  3. Inserts the run
+func (r *pgStorage) CreateRun(ctx context.Context, run *Run) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(timeoutCtx, pgx.TxOptions{
+		IsoLevel: pgx.ReadCommitted,
+	})
+	if err != nil {
+		return fmt.Errorf("begin transaction for run %s: %w", run.ID, err)
+	}
+	defer tx.Rollback(timeoutCtx)
+
+	// 1. Check the workflow exists.
+	workspaceID := WorkspaceFrom(ctx)
+	var exists bool
+	err = tx.QueryRow(timeoutCtx, `
+        SELECT true FROM workflows
+        WHERE id = $1 AND workspace_id = $2 AND deleted_at IS NULL`,
+		run.WorkflowID, workspaceID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	// 2. Count the runs of the last hour.
+	if err := checkRunQuota(timeoutCtx, tx, workspaceID); err != nil {
+		return err
+	}
+
+	// 3. Insert the run.
+	err = tx.QueryRow(timeoutCtx, `
+        INSERT INTO workflow_runs (id, workflow_id, workspace_id, version_number, mode, status, failed_node,
+                                   duration_ms, inputs, result, calls, state, sealed, resume_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+        RETURNING created_at`,
+		run.ID, run.WorkflowID, workspaceID, run.Version, run.Mode, run.Status, run.FailedNode, run.DurationMs,
+		run.Inputs, run.Result, run.Calls, run.State, run.Sealed, run.ResumeAt).Scan(&run.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert run %s: %w", run.ID, err)
+	}
+
+	if err := tx.Commit(timeoutCtx); err != nil {
+		return fmt.Errorf("commit run %s: %w", run.ID, err)
+	}
+	run.WorkspaceID = workspaceID
+	return nil
+}
+
+// checkRunQuota returns ErrQuotaExceeded if the workspace has recorded as
+// many runs in the last hour as it allows. Only a workspace with a quota
+// is locked, so concurrent runs are counted one after another.
+func checkRunQuota(ctx context.Context, tx pgx.Tx, workspaceID string) error {
+	var limit *int
+	err := tx.QueryRow(ctx, `
+        SELECT max_runs_per_hour FROM workspaces
+        WHERE id = $1`,
+		workspaceID).Scan(&limit)
+	if err != nil {
+		return fmt.Errorf("get workspace %s: %w", workspaceID, err)
+	}
+	if limit == nil {
+		return nil
+	}
+	if err := lockQuota(ctx, tx, "runs", workspaceID); err != nil {
+		return err
+	}
+	var count int
+	err = tx.QueryRow(ctx, `
+        SELECT COUNT(*) FROM workflow_runs
+        WHERE workspace_id = $1 AND created_at >= now() - interval '1 hour'`,
+		workspaceID).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("count runs: %w", err)
+	}
+	if count >= *limit {
+		return fmt.Errorf("workspace %s allows %d runs per hour: %w", workspaceID, *limit, ErrQuotaExceeded)
+	}
+	return nil
+}
+
+// lockQuota holds a transaction-level advisory lock on the quota of a
+// workspace until tx ends. Unlike a lock on the workspace row, it does not
+// block updates to the workspace, the foreign keys of rows inserted into
+// it, or checks of its other quota.
+func lockQuota(ctx context.Context, tx pgx.Tx, quota, workspaceID string) error {
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1, 0))`, quota+"/"+workspaceID); err != nil {
+		return fmt.Errorf("lock %s quota of workspace %s: %w", quota, workspaceID, err)
+	}
+	return nil
+}
+
+// GetRun loads a recorded execution of the workflow.
+// Returns pgx.ErrNoRows if the run does not exist or belongs to another workflow.
+func (r *pgStorage) GetRun(ctx context.Context, workflowID, runID uuid.UUID) (*Run, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return scanRun(r.DB.QueryRow(timeoutCtx, `
+        SELECT `+runColumns+`
+        FROM workflow_runs
+        WHERE id = $1 AND workflow_id = $2 AND workspace_id = $3`,
+		runID, workflowID, WorkspaceFrom(ctx)))
+}
+
+// runColumns is the column list scanned by scanRun.
+const runColumns = `id, workflow_id, workspace_id, version_number, mode, status, failed_node, duration_ms,
+        inputs, result, calls, state, sealed, resume_at, created_at`
+
+func scanRun(row pgx.Row) (*Run, error) {
+	var run Run
+	err := row.Scan(&run.ID, &run.WorkflowID, &run.WorkspaceID, &run.Version, &run.Mode, &run.Status, &run.FailedNode, &run.DurationMs,
+		&run.Inputs, &run.Result, &run.Calls, &run.State, &run.Sealed, &run.ResumeAt, &run.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// UpdateRun saves the inputs, status, failed node, duration, result,
+// calls, state, sealed data and resume time of a run that finished or was
+// resumed. Returns pgx.ErrNoRows if the run does not exist.
+func (r *pgStorage) UpdateRun(ctx context.Context, run *Run) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var id uuid.UUID
+	err := r.DB.QueryRow(timeoutCtx, `
+        UPDATE workflow_runs
+        SET inputs = $2, status = $3, failed_node = $4, duration_ms = $5, result = $6, calls = $7, state = $8,
+            sealed = $9, resume_at = $10
+        WHERE id = $1 AND workspace_id = $11
+        RETURNING id`,
+		run.ID, run.Inputs, run.Status, run.FailedNode, run.DurationMs, run.Result, run.Calls, run.State, run.Sealed,
+		run.ResumeAt, WorkspaceFrom(ctx)).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		return fmt.Errorf("update run %s: %w", run.ID, err)
+	}
+	return nil
+}
+
+// ClaimDueRuns returns up to limit runs whose timer is due at now, oldest
+// first, and moves their resume time to retryAt. Concurrent callers never
+// claim the same run, and a run whose resume is lost (e.g. to a crash) is
+// claimed again at retryAt. Resuming the run clears or replaces the time.
+func (r *pgStorage) ClaimDueRuns(ctx context.Context, now, retryAt time.Time, limit int) ([]Run, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.Query(timeoutCtx, `
+        UPDATE workflow_runs
+        SET resume_at = $2
+        WHERE id IN (
+            SELECT id FROM workflow_runs
+            WHERE resume_at <= $1
+            ORDER BY resume_at, id
+            LIMIT $3
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING `+runColumns,
+		now, retryAt, limit)
+	if err != nil {
+		return nil, fmt.Errorf("claim due runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []Run{}
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan run: %w", err)
+		}
+		runs = append(runs, *run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate runs: %w", err)
+	}
+	return runs, nil
+}
+
+// runSummaryColumns is the column list scanned by scanRunSummary: a run
+// without its result, calls and state, which ListRuns leaves out.
+const runSummaryColumns = `id, workflow_id, workspace_id, version_number, mode, status, failed_node, duration_ms,
+        inputs, resume_at, created_at`
+
+func scanRunSummary(row pgx.Row) (*Run, error) {
+	var run Run
+	err := row.Scan(&run.ID, &run.WorkflowID, &run.WorkspaceID, &run.Version, &run.Mode, &run.Status, &run.FailedNode, &run.DurationMs,
+		&run.Inputs, &run.ResumeAt, &run.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// runFilterWhere returns the conditions and arguments selecting the runs
+// of the workspace that match filter, ignoring its cursor and limit.
+func runFilterWhere(workspaceID string, filter RunFilter) ([]string, []any, error) {
+	where := []string{"workflow_id = $1", "workspace_id = $2"}
+	args := []any{filter.WorkflowID, workspaceID}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		where = append(where, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if filter.Mode != "" {
+		args = append(args, filter.Mode)
+		where = append(where, fmt.Sprintf("mode = $%d", len(args)))
+	}
+	if filter.Since != nil {
+		args = append(args, *filter.Since)
+		where = append(where, fmt.Sprintf("created_at >= $%d", len(args)))
+	}
+	if filter.Until != nil {
+		args = append(args, *filter.Until)
+		where = append(where, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+	if filter.FailedNode != "" {
+		args = append(args, filter.FailedNode)
+		where = append(where, fmt.Sprintf("failed_node = $%d", len(args)))
+	}
+	if filter.Version != nil {
+		args = append(args, *filter.Version)
+		where = append(where, fmt.Sprintf("version_number = $%d", len(args)))
+	}
+	if len(filter.Inputs) > 0 {
+		inputs, err := json.Marshal(filter.Inputs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("encode input filter: %w", err)
+		}
+		args = append(args, string(inputs))
+		where = append(where, fmt.Sprintf("inputs @> $%d::jsonb", len(args)))
+	}
+	return where, args, nil
+}
+
+// ListRuns returns the runs matching filter, newest first. Result, Calls
+// and State are not loaded; GetRun returns a whole run.
+func (r *pgStorage) ListRuns(ctx context.Context, filter RunFilter) ([]Run, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	where, args, err := runFilterWhere(WorkspaceFrom(ctx), filter)
+	if err != nil {
+		return nil, err
+	}
+	if filter.Cursor != nil {
+		args = append(args, filter.Cursor.CreatedAt, filter.Cursor.ID)
+		where = append(where, fmt.Sprintf("(created_at, id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+	sql := `
+        SELECT ` + runSummaryColumns + `
+        FROM workflow_runs
+        WHERE ` + strings.Join(where, " AND ") + `
+        ORDER BY created_at DESC, id DESC`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		sql += fmt.Sprintf(`
+        LIMIT $%d`, len(args))
+	}
+
+	rows, err := r.DB.Query(timeoutCtx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []Run{}
+	for rows.Next() {
+		run, err := scanRunSummary(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan run row: %w", err)
+		}
+		runs = append(runs, *run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("run rows error: %w", err)
+	}
+	return runs, nil
+}
+
+// failingNodesLimit is how many nodes RunStats reports in FailingNodes.
+const failingNodesLimit = 10
+
+// RunStats aggregates the runs matching filter. Percentiles interpolate
+// between durations like percentile_cont; runs still running or waiting
+// are left out of them, and only failed runs count towards FailingNodes.
+func (r *pgStorage) RunStats(ctx context.Context, filter RunFilter) (*RunStats, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	where, args, err := runFilterWhere(WorkspaceFrom(ctx), filter)
+	if err != nil {
+		return nil, err
+	}
+	cond := strings.Join(where, " AND ")
+
+	stats := &RunStats{ByStatus: map[string]int{}, FailingNodes: []NodeFailures{}}
+	rows, err := r.DB.Query(timeoutCtx, `
+        SELECT status, COUNT(*)
+        FROM workflow_runs
+        WHERE `+cond+`
+        GROUP BY status`,
+		args...)
+	if err != nil {
+		return nil, fmt.Errorf("count runs: %w", err)
+	}
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan run count: %w", err)
+		}
+		stats.ByStatus[status] = n
+		stats.Total += n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("run count rows error: %w", err)
+	}
+
+	err = r.DB.QueryRow(timeoutCtx, `
+        SELECT COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY duration_ms), 0),
+               COALESCE(percentile_cont(0.95) WITHIN GROUP (ORDER BY duration_ms), 0)
+        FROM workflow_runs
+        WHERE `+cond+` AND status NOT IN ('running', 'waiting')`,
+		args...).Scan(&stats.P50DurationMs, &stats.P95DurationMs)
+	if err != nil {
+		return nil, fmt.Errorf("run duration percentiles: %w", err)
+	}
+
+	rows, err = r.DB.Query(timeoutCtx, fmt.Sprintf(`
+        SELECT failed_node, COUNT(*)
+        FROM workflow_runs
+        WHERE %s AND status = 'failed' AND failed_node <> ''
+        GROUP BY failed_node
+        ORDER BY COUNT(*) DESC, failed_node
+        LIMIT %d`, cond, failingNodesLimit),
+		args...)
+	if err != nil {
+		return nil, fmt.Errorf("count failing nodes: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var nf NodeFailures
+		if err := rows.Scan(&nf.NodeID, &nf.Failures); err != nil {
+			return nil, fmt.Errorf("scan failing node: %w", err)
+		}
+		stats.FailingNodes = append(stats.FailingNodes, nf)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failing node rows error: %w", err)
+	}
+	return stats, nil
+}
+
+// ListRetentionPolicies returns the workflows of every workspace, deleted
+// ones included, whose settings have a retention policy.
+func (r *pgStorage) ListRetentionPolicies(ctx context.Context) ([]WorkflowRetention, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.Query(timeoutCtx, `
+        SELECT id, workspace_id, settings->'retention'
+        FROM workflows
+        WHERE settings->'retention' IS NOT NULL
+        ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("query retention policies: %w", err)
+	}
+	defer rows.Close()
+
+	policies := []WorkflowRetention{}
+	for rows.Next() {
+		var wr WorkflowRetention
+		var policy []byte
+		if err := rows.Scan(&wr.WorkflowID, &wr.WorkspaceID, &policy); err != nil {
+			return nil, fmt.Errorf("scan retention policy: %w", err)
+		}
+		if err := json.Unmarshal(policy, &wr.Policy); err != nil {
+			return nil, fmt.Errorf("decode retention policy of %s: %w", wr.WorkflowID, err)
+		}
+		policies = append(policies, wr)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("retention policy rows error: %w", err)
+	}
+	return policies, nil
+}
+
+// pruneWhere returns the condition and arguments selecting the runs that
+// filter prunes, or "" if it prunes none. $1 is the workflow ID and $2 the
+// workspace ID.
+func pruneWhere(workspaceID string, filter RunPruneFilter) (string, []any) {
+	args := []any{filter.WorkflowID, workspaceID}
+	eligible := "status NOT IN ('running', 'waiting')"
+	if filter.FailedBefore != nil {
+		eligible += " AND status <> 'failed'"
+	}
+
+	var limits []string
+	if filter.Before != nil {
+		args = append(args, *filter.Before)
+		limits = append(limits, fmt.Sprintf("created_at < $%d", len(args)))
+	}
+	if filter.KeepNewest > 0 {
+		// Everything from the first run past the newest KeepNewest on.
+		args = append(args, filter.KeepNewest)
+		limits = append(limits, fmt.Sprintf(`(created_at, id) <= (
+            SELECT created_at, id FROM workflow_runs
+            WHERE workflow_id = $1 AND %s
+            ORDER BY created_at DESC, id DESC
+            OFFSET $%d LIMIT 1)`, eligible, len(args)))
+	}
+
+	var conds []string
+	if len(limits) > 0 {
+		conds = append(conds, "("+eligible+" AND ("+strings.Join(limits, " OR ")+"))")
+	}
+	if filter.FailedBefore != nil {
+		args = append(args, *filter.FailedBefore)
+		conds = append(conds, fmt.Sprintf("(status = 'failed' AND created_at < $%d)", len(args)))
+	}
+	return strings.Join(conds, " OR "), args
+}
+
+// PruneRuns deletes up to limit of the runs that filter selects, oldest
+// first, and returns how many it deleted. The runs are locked and passed to
+// archive, if not nil, before they are deleted; if archive fails nothing is
+// deleted. Each call is one short transaction, so callers prune a large
+// backlog in batches without holding locks for long.
+func (r *pgStorage) PruneRuns(ctx context.Context, filter RunPruneFilter, limit int, archive func([]Run) error) (int, error) {
+	where, args := pruneWhere(WorkspaceFrom(ctx), filter)
+	if where == "" {
+		return 0, nil
+	}
+
+	// Longer than other queries: archive writes the batch to disk.
+	timeoutCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(timeoutCtx, pgx.TxOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("begin transaction for prune: %w", err)
+	}
+	defer tx.Rollback(timeoutCtx)
+
+	args = append(args, limit)
+	rows, err := tx.Query(timeoutCtx, `
+        SELECT `+runColumns+`
+        FROM workflow_runs
+        WHERE workflow_id = $1 AND workspace_id = $2 AND (`+where+`)
+        ORDER BY created_at, id
+        LIMIT $`+fmt.Sprint(len(args))+`
+        FOR UPDATE SKIP LOCKED`,
+		args...)
+	if err != nil {
+		return 0, fmt.Errorf("select runs to prune: %w", err)
+	}
+	var runs []Run
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan run: %w", err)
+		}
+		runs = append(runs, *run)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("iterate runs to prune: %w", err)
+	}
+	if len(runs) == 0 {
+		return 0, nil
+	}
+
+	if archive != nil {
+		if err := archive(runs); err != nil {
+			return 0, fmt.Errorf("archive runs: %w", err)
+		}
+	}
+	ids := make([]uuid.UUID, len(runs))
+	for i := range runs {
+		ids[i] = runs[i].ID
+	}
+	tag, err := tx.Exec(timeoutCtx, `DELETE FROM workflow_runs WHERE id = ANY($1)`, ids)
+	if err != nil {
+		return 0, fmt.Errorf("delete runs: %w", err)
+	}
+	if err := tx.Commit(timeoutCtx); err != nil {
+		return 0, fmt.Errorf("commit prune: %w", err)
+	}
+	return int(tag.RowsAffected()), nil
+}
+
+// taskColumns is the column list scanned by scanTask.
+const taskColumns = `id, workflow_id, workspace_id, run_id, node_id, kind, assignee, title, fields, status,
+        response, responded_by, expires_at, created_at, completed_at`
+
+func scanTask(row pgx.Row) (*Task, error) {
+	var t Task
+	err := row.Scan(&t.ID, &t.WorkflowID, &t.WorkspaceID, &t.RunID, &t.NodeID, &t.Kind, &t.Assignee, &t.Title, &t.Fields, &t.Status,
+		&t.Response, &t.RespondedBy, &t.ExpiresAt, &t.CreatedAt, &t.CompletedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// CreateTask records a pending task for a suspended run and fills in
+// Status, WorkspaceID and CreatedAt. The run must exist.
+func (r *pgStorage) CreateTask(ctx context.Context, task *Task) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	task.Status = TaskPending
+	if task.Fields == nil {
+		task.Fields = []string{}
+	}
+	task.WorkspaceID = WorkspaceFrom(ctx)
+	err := r.DB.QueryRow(timeoutCtx, `
+        INSERT INTO workflow_tasks (id, workflow_id, workspace_id, run_id, node_id, kind, assignee, title, fields,
+                                    status, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+        RETURNING created_at`,
+		task.ID, task.WorkflowID, task.WorkspaceID, task.RunID, task.NodeID, task.Kind, task.Assignee, task.Title,
+		task.Fields, task.Status, task.ExpiresAt).Scan(&task.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert task %s: %w", task.ID, err)
+	}
+	return nil
+}
+
+// GetTask loads a task. Returns pgx.ErrNoRows if it does not exist.
+func (r *pgStorage) GetTask(ctx context.Context, id uuid.UUID) (*Task, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return scanTask(r.DB.QueryRow(timeoutCtx, `
+        SELECT `+taskColumns+`
+        FROM workflow_tasks
+        WHERE id = $1 AND workspace_id = $2`,
+		id, WorkspaceFrom(ctx)))
+}
+
+// ListTasks returns the tasks matching filter, oldest first.
+func (r *pgStorage) ListTasks(ctx context.Context, filter TaskFilter) ([]Task, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var where []string
+	var args []any
+	if !filter.AllWorkspaces {
+		args = append(args, WorkspaceFrom(ctx))
+		where = append(where, fmt.Sprintf("workspace_id = $%d", len(args)))
+	}
+	if filter.Assignee != "" {
+		args = append(args, filter.Assignee)
+		where = append(where, fmt.Sprintf("assignee = $%d", len(args)))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		where = append(where, fmt.Sprintf("status = $%d", len(args)))
+	}
+	if filter.ExpiresBefore != nil {
+		args = append(args, *filter.ExpiresBefore)
+		where = append(where, fmt.Sprintf("expires_at < $%d", len(args)))
+	}
+	sql := `
+        SELECT ` + taskColumns + `
+        FROM workflow_tasks`
+	if len(where) > 0 {
+		sql += `
+        WHERE ` + strings.Join(where, " AND ")
+	}
+	sql += `
+        ORDER BY created_at, id`
+
+	rows, err := r.DB.Query(timeoutCtx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query tasks: %w", err)
+	}
+	defer rows.Close()
+
+	tasks := []Task{}
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan task row: %w", err)
+		}
+		tasks = append(tasks, *t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("task rows error: %w", err)
+	}
+	return tasks, nil
+}
+
+// CompleteTask moves a pending task to status and records the response.
+// The update only matches a pending task, so concurrent responses cannot
+// both succeed. In the same statement the task's run is scheduled to resume
+// at retryAt, so ClaimDueRuns picks it up if resuming it with the response
+// fails or is interrupted; resuming the run clears the time. Returns
+// pgx.ErrNoRows if the task does not exist and ErrTaskNotPending if it was
+// already completed.
+func (r *pgStorage) CompleteTask(ctx context.Context, id uuid.UUID, status string, response json.RawMessage, by string, retryAt time.Time) (*Task, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	task, err := scanTask(r.DB.QueryRow(timeoutCtx, `
+        WITH task AS (
+            UPDATE workflow_tasks
+            SET status = $2, response = $3, responded_by = $4, completed_at = NOW()
+            WHERE id = $1 AND workspace_id = $5 AND status = 'pending'
+            RETURNING `+taskColumns+`
+        ), run AS (
+            UPDATE workflow_runs
+            SET resume_at = $6
+            WHERE id = (SELECT run_id FROM task)
+        )
+        SELECT `+taskColumns+` FROM task`,
+		id, status, response, by, WorkspaceFrom(ctx), retryAt))
+	if err == nil {
+		return task, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("complete task %s: %w", id, err)
+	}
+
+	// Tell a missing task apart from one that is no longer pending.
+	var current string
+	if err := r.DB.QueryRow(timeoutCtx, `
+        SELECT status FROM workflow_tasks
+        WHERE id = $1 AND workspace_id = $2`,
+		id, WorkspaceFrom(ctx)).Scan(&current); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("task %s is %s: %w", id, current, ErrTaskNotPending)
+}
+
+const idempotencyColumns = `workflow_id, key, request_hash, status, status_code, response, created_at, locked_until, expires_at`
+
+func scanIdempotencyKey(row pgx.Row) (*IdempotencyKey, error) {
+	var k IdempotencyKey
+	var statusCode *int
+	if err := row.Scan(&k.WorkflowID, &k.Key, &k.RequestHash, &k.Status, &statusCode, &k.Response, &k.CreatedAt, &k.LockedUntil, &k.ExpiresAt); err != nil {
+		return nil, err
+	}
+	if statusCode != nil {
+		k.StatusCode = *statusCode
+	}
+	return &k, nil
+}
+
+// ClaimIdempotencyKey stores key as in progress at key.CreatedAt, taking
+// over a record of the same key that had expired by then, or that was
+// still in progress after its LockedUntil. Otherwise the existing record is
+// returned with ErrIdempotencyKeyTaken. Status is set on key.
+func (r *pgStorage) ClaimIdempotencyKey(ctx context.Context, key *IdempotencyKey) (*IdempotencyKey, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	err := r.DB.QueryRow(timeoutCtx, `
+        INSERT INTO idempotency_keys (workflow_id, key, request_hash, status, created_at, locked_until, expires_at)
+        VALUES ($1, $2, $3, 'in_progress', $4, $5, $6)
+        ON CONFLICT (workflow_id, key) DO UPDATE SET
+            request_hash = EXCLUDED.request_hash,
+            status = EXCLUDED.status,
+            status_code = NULL,
+            response = NULL,
+            created_at = EXCLUDED.created_at,
+            locked_until = EXCLUDED.locked_until,
+            expires_at = EXCLUDED.expires_at
+        WHERE idempotency_keys.expires_at <= EXCLUDED.created_at
+           OR (idempotency_keys.status = 'in_progress' AND idempotency_keys.locked_until <= EXCLUDED.created_at)
+        RETURNING status`,
+		key.WorkflowID, key.Key, key.RequestHash, key.CreatedAt, key.LockedUntil, key.ExpiresAt).Scan(&key.Status)
+	if err == nil {
+		return key, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("claim idempotency key %q: %w", key.Key, err)
+	}
+
+	// The conflicting record is completed or still held.
+	existing, err := scanIdempotencyKey(r.DB.QueryRow(timeoutCtx, `
+        SELECT `+idempotencyColumns+`
+        FROM idempotency_keys
+        WHERE workflow_id = $1 AND key = $2`,
+		key.WorkflowID, key.Key))
+	if err != nil {
+		return nil, fmt.Errorf("load idempotency key %q: %w", key.Key, err)
+	}
+	return existing, ErrIdempotencyKeyTaken
+}
+
+// CompleteIdempotencyKey stores the response of a claimed key. It returns
+// pgx.ErrNoRows if the claim was taken over, keyed by its CreatedAt.
+func (r *pgStorage) CompleteIdempotencyKey(ctx context.Context, key *IdempotencyKey) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	err := r.DB.QueryRow(timeoutCtx, `
+        UPDATE idempotency_keys
+        SET status = 'completed', status_code = $4, response = $5
+        WHERE workflow_id = $1 AND key = $2 AND created_at = $3 AND status = 'in_progress'
+        RETURNING status`,
+		key.WorkflowID, key.Key, key.CreatedAt, key.StatusCode, key.Response).Scan(&key.Status)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		return fmt.Errorf("complete idempotency key %q: %w", key.Key, err)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey deletes a claimed key, so a request that could
+// not be completed can be retried with it. A claim that was taken over is
+// left to the request that took it.
+func (r *pgStorage) ReleaseIdempotencyKey(ctx context.Context, key *IdempotencyKey) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var deleted int
+	if err := r.DB.QueryRow(timeoutCtx, `
+        WITH deleted AS (
+            DELETE FROM idempotency_keys
+            WHERE workflow_id = $1 AND key = $2 AND created_at = $3 AND status = 'in_progress'
+            RETURNING 1
+        )
+        SELECT COUNT(*) FROM deleted`,
+		key.WorkflowID, key.Key, key.CreatedAt).Scan(&deleted); err != nil {
+		return fmt.Errorf("release idempotency key %q: %w", key.Key, err)
+	}
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys deletes every key that expired by now and
+// returns how many were deleted.
+func (r *pgStorage) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var deleted int
+	if err := r.DB.QueryRow(timeoutCtx, `
+        WITH deleted AS (
+            DELETE FROM idempotency_keys
+            WHERE expires_at <= $1
+            RETURNING 1
+        )
+        SELECT COUNT(*) FROM deleted`,
+		now).Scan(&deleted); err != nil {
+		return 0, fmt.Errorf("delete expired idempotency keys: %w", err)
+	}
+	return deleted, nil
+}
+
+const apiKeyColumns = `id, name, prefix, key_hash, role, COALESCE(workspace_id, ''), created_by, created_at, revoked_at`
+
+func scanAPIKey(row pgx.Row) (*APIKey, error) {
+	var k APIKey
+	if err := row.Scan(&k.ID, &k.Name, &k.Prefix, &k.KeyHash, &k.Role, &k.WorkspaceID, &k.CreatedBy, &k.CreatedAt, &k.RevokedAt); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// CreateAPIKey stores a new API key. CreatedAt is set on key.
+func (r *pgStorage) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if err := r.DB.QueryRow(timeoutCtx, `
+        INSERT INTO api_keys (id, name, prefix, key_hash, role, workspace_id, created_by)
+        VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7)
+        RETURNING created_at`,
+		key.ID, key.Name, key.Prefix, key.KeyHash, key.Role, key.WorkspaceID, key.CreatedBy).Scan(&key.CreatedAt); err != nil {
+		return fmt.Errorf("create api key %q: %w", key.Name, err)
+	}
+	return nil
+}
+
+// GetAPIKeyByPrefix loads the key with the given prefix, revoked or not.
+func (r *pgStorage) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*APIKey, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	key, err := scanAPIKey(r.DB.QueryRow(timeoutCtx, `
+        SELECT `+apiKeyColumns+`
+        FROM api_keys
+        WHERE prefix = $1`,
+		prefix))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("get api key: %w", err)
+	}
+	return key, nil
+}
+
+// ListAPIKeys returns every key, revoked ones included, oldest first.
+func (r *pgStorage) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.Query(timeoutCtx, `
+        SELECT `+apiKeyColumns+`
+        FROM api_keys
+        ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("list api keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan api key: %w", err)
+		}
+		keys = append(keys, *key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list api keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey marks a key revoked at the given time and returns it. A key
+// that was already revoked keeps its original revocation time.
+func (r *pgStorage) RevokeAPIKey(ctx context.Context, id uuid.UUID, at time.Time) (*APIKey, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	key, err := scanAPIKey(r.DB.QueryRow(timeoutCtx, `
+        UPDATE api_keys
+        SET revoked_at = COALESCE(revoked_at, $2)
+        WHERE id = $1
+        RETURNING `+apiKeyColumns,
+		id, at))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("revoke api key %s: %w", id, err)
+	}
+	return key, nil
+}
+
+// loadAuditWorkflow locks a workflow's header row and returns its state for
+// an audit diff, or nil if it does not exist in the workspace of ctx or is
+// deleted.
+func loadAuditWorkflow(ctx context.Context, tx pgx.Tx, id uuid.UUID) (*auditWorkflow, error) {
+	var wf auditWorkflow
+	var settings, nodes, edges []byte
+	err := tx.QueryRow(ctx, `
+        SELECT w.name, w.settings,
+            COALESCE((
+                SELECT jsonb_agg(jsonb_build_object(
+                    'id', i.instance_id, 'type', l.node_type, 'libraryId', i.node_library_id,
+                    'position', jsonb_build_object('x', i.x_pos, 'y', i.y_pos)) ORDER BY i.instance_id)
+                FROM workflow_node_instances i
+                JOIN node_library l ON l.id = i.node_library_id
+                WHERE i.workflow_id = w.id), '[]'),
+            COALESCE((
+                SELECT jsonb_agg(jsonb_build_object(
+                    'id', e.edge_id, 'source', e.source_instance_id, 'target', e.target_instance_id,
+                    'sourceHandle', e.source_handle, 'type', e.edge_type, 'animated', e.animated,
+                    'label', e.label, 'style', e.style_props, 'labelStyle', e.label_style) ORDER BY e.edge_id)
+                FROM workflow_edges e
+                WHERE e.workflow_id = w.id), '[]')
+        FROM workflows w
+        WHERE w.id = $1 AND w.workspace_id = $2 AND w.deleted_at IS NULL
+        FOR UPDATE OF w`,
+		id, WorkspaceFrom(ctx)).Scan(&wf.Name, &settings, &nodes, &edges)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(settings, &wf.Settings); err != nil {
+		return nil, fmt.Errorf("decode settings of workflow %s: %w", id, err)
+	}
+	if err := json.Unmarshal(nodes, &wf.Nodes); err != nil {
+		return nil, fmt.Errorf("decode nodes of workflow %s: %w", id, err)
+	}
+	if err := json.Unmarshal(edges, &wf.Edges); err != nil {
+		return nil, fmt.Errorf("decode edges of workflow %s: %w", id, err)
+	}
+	return &wf, nil
+}
+
+// insertAuditEvent appends an audit event for a change made in tx, with
+// the workspace, actor and request ID of ctx.
+func insertAuditEvent(ctx context.Context, tx pgx.Tx, action, targetType, targetID string, before, after any) error {
+	diff, err := auditDiff(before, after)
+	if err != nil {
+		return err
+	}
+	info := auditInfoFrom(ctx)
+	_, err = tx.Exec(ctx, `
+        INSERT INTO audit_events (workspace_id, actor, action, target_type, target_id, request_id, diff)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		WorkspaceFrom(ctx), info.Actor, action, targetType, targetID, info.RequestID, diff)
+	if err != nil {
+		return fmt.Errorf("insert audit event %s %s: %w", action, targetID, err)
+	}
+	return nil
+}
+
+// ListAuditEvents returns the workspace's events matching filter, newest
+// first.
+func (r *pgStorage) ListAuditEvents(ctx context.Context, filter AuditFilter) ([]AuditEvent, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	where := []string{"workspace_id = $1"}
+	args := []any{WorkspaceFrom(ctx)}
+	for _, f := range []struct {
+		cond string
+		set  bool
+		arg  any
+	}{
+		{"target_type = $%d", filter.TargetType != "", filter.TargetType},
+		{"target_id = $%d", filter.TargetID != "", filter.TargetID},
+		{"actor = $%d", filter.Actor != "", filter.Actor},
+		{"occurred_at >= $%d", filter.Since != nil, filter.Since},
+		{"occurred_at < $%d", filter.Until != nil, filter.Until},
+		{"id < $%d", filter.BeforeID > 0, filter.BeforeID},
+	} {
+		if f.set {
+			args = append(args, f.arg)
+			where = append(where, fmt.Sprintf(f.cond, len(args)))
+		}
+	}
+	sql := `
+        SELECT id, workspace_id, occurred_at, actor, action, target_type, target_id, request_id, diff
+        FROM audit_events
+        WHERE ` + strings.Join(where, " AND ") + `
+        ORDER BY id DESC`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		sql += fmt.Sprintf(`
+        LIMIT $%d`, len(args))
+	}
+
+	rows, err := r.DB.Query(timeoutCtx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list audit events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []AuditEvent{}
+	for rows.Next() {
+		var e AuditEvent
+		if err := rows.Scan(&e.ID, &e.WorkspaceID, &e.OccurredAt, &e.Actor, &e.Action, &e.TargetType, &e.TargetID, &e.RequestID, &e.Diff); err != nil {
+			return nil, fmt.Errorf("scan audit event: %w", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list audit events: %w", err)
+	}
+	return events, nil
+}
+
+// isUniqueViolation reports whether err is a Postgres unique_violation.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+const workspaceColumns = `id, name, max_workflows, max_runs_per_hour, created_at`
+
+func scanWorkspace(row pgx.Row) (*Workspace, error) {
+	var ws Workspace
+	if err := row.Scan(&ws.ID, &ws.Name, &ws.MaxWorkflows, &ws.MaxRunsPerHour, &ws.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &ws, nil
+}
+
+// GetWorkspace loads a workspace. Returns pgx.ErrNoRows if it does not exist.
+func (r *pgStorage) GetWorkspace(ctx context.Context, id string) (*Workspace, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	ws, err := scanWorkspace(r.DB.QueryRow(timeoutCtx, `
+        SELECT `+workspaceColumns+`
+        FROM workspaces
+        WHERE id = $1`,
+		id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("get workspace %s: %w", id, err)
+	}
+	return ws, nil
+}
+
+// ListWorkspaces returns every workspace, ordered by ID.
+func (r *pgStorage) ListWorkspaces(ctx context.Context) ([]Workspace, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.Query(timeoutCtx, `
+        SELECT `+workspaceColumns+`
+        FROM workspaces
+        ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("list workspaces: %w", err)
+	}
+	defer rows.Close()
+
+	workspaces := []Workspace{}
+	for rows.Next() {
+		ws, err := scanWorkspace(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan workspace: %w", err)
+		}
+		workspaces = append(workspaces, *ws)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list workspaces: %w", err)
+	}
+	return workspaces, nil
+}
+
+// CreateWorkspace stores a new workspace and fills in CreatedAt. Returns
+// ErrWorkspaceExists if the ID is taken.
+func (r *pgStorage) CreateWorkspace(ctx context.Context, ws *Workspace) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	err := r.DB.QueryRow(timeoutCtx, `
+        INSERT INTO workspaces (id, name, max_workflows, max_runs_per_hour)
+        VALUES ($1, $2, $3, $4)
+        RETURNING created_at`,
+		ws.ID, ws.Name, ws.MaxWorkflows, ws.MaxRunsPerHour).Scan(&ws.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return fmt.Errorf("workspace %s: %w", ws.ID, ErrWorkspaceExists)
+		}
+		return fmt.Errorf("create workspace %s: %w", ws.ID, err)
+	}
+	return nil
+}
+
+// UpdateWorkspace saves the name and quotas of a workspace and fills in
+// CreatedAt. Lowering a quota does not remove anything already over it.
+// Returns pgx.ErrNoRows if the workspace does not exist.
+func (r *pgStorage) UpdateWorkspace(ctx context.Context, ws *Workspace) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	err := r.DB.QueryRow(timeoutCtx, `
+        UPDATE workspaces
+        SET name = $2, max_workflows = $3, max_runs_per_hour = $4
+        WHERE id = $1
+        RETURNING created_at`,
+		ws.ID, ws.Name, ws.MaxWorkflows, ws.MaxRunsPerHour).Scan(&ws.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		return fmt.Errorf("update workspace %s: %w", ws.ID, err)
+	}
+	return nil
+}
+
+const secretColumns = `name, ciphertext, updated_by, created_at, modified_at`
+
+func scanSecret(row pgx.Row) (*Secret, error) {
+	var sec Secret
+	if err := row.Scan(&sec.Name, &sec.Ciphertext, &sec.UpdatedBy, &sec.CreatedAt, &sec.ModifiedAt); err != nil {
+		return nil, err
+	}
+	return &sec, nil
+}
+
+// PutSecret creates or replaces a secret in the workspace and fills in its
+// times, reporting whether it was created. The audit event records only
+// the name; the value never leaves the secrets table.
+func (r *pgStorage) PutSecret(ctx context.Context, secret *Secret) (bool, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(timeoutCtx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+	if err != nil {
+		return false, fmt.Errorf("begin transaction for secret: %w", err)
+	}
+	defer tx.Rollback(timeoutCtx)
+
+	var created bool
+	err = tx.QueryRow(timeoutCtx, `
+        INSERT INTO secrets (workspace_id, name, ciphertext, updated_by)
+        VALUES ($1, $2, $3, $4)
+        ON CONFLICT (workspace_id, name) DO UPDATE
+        SET ciphertext = EXCLUDED.ciphertext, updated_by = EXCLUDED.updated_by
+        RETURNING created_at, modified_at, xmax = 0`,
+		WorkspaceFrom(ctx), secret.Name, secret.Ciphertext, secret.UpdatedBy).Scan(&secret.CreatedAt, &secret.ModifiedAt, &created)
+	if err != nil {
+		return false, fmt.Errorf("put secret %s: %w", secret.Name, err)
+	}
+
+	action := AuditSecretUpdate
+	if created {
+		action = AuditSecretCreate
+	}
+	if err := insertAuditEvent(timeoutCtx, tx, action, AuditTargetSecret, secret.Name, nil, nil); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(timeoutCtx); err != nil {
+		return false, fmt.Errorf("commit secret %s: %w", secret.Name, err)
+	}
+	return created, nil
+}
+
+// GetSecret loads a secret of the workspace. Returns pgx.ErrNoRows if it
+// does not exist.
+func (r *pgStorage) GetSecret(ctx context.Context, name string) (*Secret, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	sec, err := scanSecret(r.DB.QueryRow(timeoutCtx, `
+        SELECT `+secretColumns+`
+        FROM secrets
+        WHERE workspace_id = $1 AND name = $2`,
+		WorkspaceFrom(ctx), name))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("get secret %s: %w", name, err)
+	}
+	return sec, nil
+}
+
+// ListSecrets returns the workspace's secrets, ordered by name, without
+// their ciphertext.
+func (r *pgStorage) ListSecrets(ctx context.Context) ([]Secret, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.Query(timeoutCtx, `
+        SELECT name, updated_by, created_at, modified_at
+        FROM secrets
+        WHERE workspace_id = $1
+        ORDER BY name`,
+		WorkspaceFrom(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("list secrets: %w", err)
+	}
+	defer rows.Close()
+
+	secrets := []Secret{}
+	for rows.Next() {
+		var sec Secret
+		if err := rows.Scan(&sec.Name, &sec.UpdatedBy, &sec.CreatedAt, &sec.ModifiedAt); err != nil {
+			return nil, fmt.Errorf("scan secret: %w", err)
+		}
+		secrets = append(secrets, sec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list secrets: %w", err)
+	}
+	return secrets, nil
+}
+
+// DeleteSecret removes a secret of the workspace. Workflows that still
+// refer to it fail to run until it is set again. Returns pgx.ErrNoRows if
+// it does not exist.
+func (r *pgStorage) DeleteSecret(ctx context.Context, name string) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(timeoutCtx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+	if err != nil {
+		return fmt.Errorf("begin transaction for secret: %w", err)
+	}
+	defer tx.Rollback(timeoutCtx)
+
+	tag, err := tx.Exec(timeoutCtx, `
+        DELETE FROM secrets
+        WHERE workspace_id = $1 AND name = $2`,
+		WorkspaceFrom(ctx), name)
+	if err != nil {
+		return fmt.Errorf("delete secret %s: %w", name, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return pgx.ErrNoRows
+	}
+	if err := insertAuditEvent(timeoutCtx, tx, AuditSecretDelete, AuditTargetSecret, name, nil, nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(timeoutCtx); err != nil {
+		return fmt.Errorf("commit secret %s: %w", name, err)
+	}
+	return nil
+}
+
+// ListExecutionLimits returns every execution limit, ordered by scope and
+// subject.
+func (r *pgStorage) ListExecutionLimits(ctx context.Context) ([]ExecutionLimit, error) {
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.Query(timeoutCtx, `
+        SELECT scope, subject, rate_per_minute, burst, max_concurrent
+        FROM execution_limits
+        ORDER BY scope, subject`)
+	if err != nil {
+		return nil, fmt.Errorf("query execution limits: %w", err)
+	}
+	defer rows.Close()
+
+	limits := []ExecutionLimit{}
+	for rows.Next() {
+		var l ExecutionLimit
+		if err := rows.Scan(&l.Scope, &l.Subject, &l.RatePerMinute, &l.Burst, &l.MaxConcurrent); err != nil {
+			return nil, fmt.Errorf("scan execution limit: %w", err)
+		}
+		limits = append(limits, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("execution limit rows error: %w", err)
+	}
+	return limits, nil
+}
@@ -4,18 +4,22 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 	"workflow-code-test/api/services/storage"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/pashagolub/pgxmock/v4"
 )
 
 var (
-	testWfID = uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
-	testNow  = time.Now()
+	testWfID           = uuid.MustParse("550e8400-e29b-41d4-a716-446655440000")
+	testNow            = time.Now()
+	testStartLibraryID = "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"
 )
 
 // setupSuccessMock configures the transaction and all three queries (header,
@@ -26,11 +30,11 @@ func setupSuccessMock(mock pgxmock.PgxPoolIface) {
 		AccessMode: pgx.ReadOnly,
 	})
 
-	mock.ExpectQuery("SELECT name, status, active_snapshot_id, created_at, modified_at").
-		WithArgs(testWfID).
+	mock.ExpectQuery("SELECT name, status, active_snapshot_id, settings, created_at, modified_at").
+		WithArgs(testWfID, storage.DefaultWorkspaceID).
 		WillReturnRows(
-			pgxmock.NewRows([]string{"name", "status", "active_snapshot_id", "created_at", "modified_at"}).
-				AddRow("Weather Check System", "draft", nil, testNow, testNow),
+			pgxmock.NewRows([]string{"name", "status", "active_snapshot_id", "settings", "created_at", "modified_at"}).
+				AddRow("Weather Check System", "draft", nil, []byte(`{}`), testNow, testNow),
 		)
 
 	nodeMetadata := json.RawMessage(`{"hasHandles":{"source":true,"target":false}}`)
@@ -38,9 +42,9 @@ func setupSuccessMock(mock pgxmock.PgxPoolIface) {
 		WithArgs(testWfID).
 		WillReturnRows(
 			pgxmock.NewRows([]string{
-				"instance_id", "node_type", "x_pos", "y_pos",
+				"instance_id", "node_type", "node_library_id", "x_pos", "y_pos",
 				"label", "base_description", "metadata",
-			}).AddRow("start", "start", -160.0, 300.0, "Start", "Begin weather check workflow", nodeMetadata),
+			}).AddRow("start", "start", testStartLibraryID, -160.0, 300.0, "Start", "Begin weather check workflow", nodeMetadata),
 		)
 
 	edgeStyle := json.RawMessage(`{"stroke":"#10b981","strokeWidth":3}`)
@@ -57,6 +61,38 @@ func setupSuccessMock(mock pgxmock.PgxPoolIface) {
 	mock.ExpectCommit()
 }
 
+// expectWorkflowQuota expects the quota check of a new workflow in the
+// default workspace: the limit and, if there is one, the lock and the count.
+func expectWorkflowQuota(mock pgxmock.PgxPoolIface, limit *int, count int) {
+	mock.ExpectQuery(`SELECT max_workflows FROM workspaces\s+WHERE id = \$1$`).
+		WithArgs(storage.DefaultWorkspaceID).
+		WillReturnRows(pgxmock.NewRows([]string{"max_workflows"}).AddRow(limit))
+	if limit != nil {
+		mock.ExpectExec(`SELECT pg_advisory_xact_lock\(hashtextextended\(\$1, 0\)\)`).
+			WithArgs("workflows/" + storage.DefaultWorkspaceID).
+			WillReturnResult(pgxmock.NewResult("SELECT", 1))
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM workflows`).
+			WithArgs(storage.DefaultWorkspaceID).
+			WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(count))
+	}
+}
+
+// expectRunQuota expects the quota check of a new run in the default
+// workspace: the limit and, if there is one, the lock and the count.
+func expectRunQuota(mock pgxmock.PgxPoolIface, limit *int, count int) {
+	mock.ExpectQuery(`SELECT max_runs_per_hour FROM workspaces\s+WHERE id = \$1$`).
+		WithArgs(storage.DefaultWorkspaceID).
+		WillReturnRows(pgxmock.NewRows([]string{"max_runs_per_hour"}).AddRow(limit))
+	if limit != nil {
+		mock.ExpectExec(`SELECT pg_advisory_xact_lock\(hashtextextended\(\$1, 0\)\)`).
+			WithArgs("runs/" + storage.DefaultWorkspaceID).
+			WillReturnResult(pgxmock.NewResult("SELECT", 1))
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM workflow_runs\s+WHERE workspace_id = \$1 AND created_at >= now\(\) - interval '1 hour'`).
+			WithArgs(storage.DefaultWorkspaceID).
+			WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(count))
+	}
+}
+
 func TestGetWorkflow(t *testing.T) {
 	t.Parallel()
 	tests := []struct {
@@ -94,6 +130,9 @@ func TestGetWorkflow(t *testing.T) {
 				if node.Type != "start" {
 					t.Errorf("expected node type 'start', got %q", node.Type)
 				}
+				if node.LibraryID != testStartLibraryID {
+					t.Errorf("expected library ID %s, got %q", testStartLibraryID, node.LibraryID)
+				}
 				if node.Position.X != -160 || node.Position.Y != 300 {
 					t.Errorf("expected position (-160, 300), got (%v, %v)", node.Position.X, node.Position.Y)
 				}
@@ -127,8 +166,8 @@ func TestGetWorkflow(t *testing.T) {
 					IsoLevel:   pgx.RepeatableRead,
 					AccessMode: pgx.ReadOnly,
 				})
-				mock.ExpectQuery("SELECT name, status, active_snapshot_id, created_at, modified_at").
-					WithArgs(testWfID).
+				mock.ExpectQuery("SELECT name, status, active_snapshot_id, settings, created_at, modified_at").
+					WithArgs(testWfID, storage.DefaultWorkspaceID).
 					WillReturnError(pgx.ErrNoRows)
 				mock.ExpectRollback()
 			},
@@ -142,11 +181,11 @@ func TestGetWorkflow(t *testing.T) {
 					AccessMode: pgx.ReadOnly,
 				})
 				// Header succeeds
-				mock.ExpectQuery("SELECT name, status, active_snapshot_id, created_at, modified_at").
-					WithArgs(testWfID).
+				mock.ExpectQuery("SELECT name, status, active_snapshot_id, settings, created_at, modified_at").
+					WithArgs(testWfID, storage.DefaultWorkspaceID).
 					WillReturnRows(
-						pgxmock.NewRows([]string{"name", "status", "active_snapshot_id", "created_at", "modified_at"}).
-							AddRow("Test", "draft", nil, testNow, testNow),
+						pgxmock.NewRows([]string{"name", "status", "active_snapshot_id", "settings", "created_at", "modified_at"}).
+							AddRow("Test", "draft", nil, []byte(`{}`), testNow, testNow),
 					)
 				// Node query fails
 				mock.ExpectQuery("SELECT").
@@ -164,18 +203,18 @@ func TestGetWorkflow(t *testing.T) {
 					AccessMode: pgx.ReadOnly,
 				})
 				// Header succeeds
-				mock.ExpectQuery("SELECT name, status, active_snapshot_id, created_at, modified_at").
-					WithArgs(testWfID).
+				mock.ExpectQuery("SELECT name, status, active_snapshot_id, settings, created_at, modified_at").
+					WithArgs(testWfID, storage.DefaultWorkspaceID).
 					WillReturnRows(
-						pgxmock.NewRows([]string{"name", "status", "active_snapshot_id", "created_at", "modified_at"}).
-							AddRow("Test", "draft", nil, testNow, testNow),
+						pgxmock.NewRows([]string{"name", "status", "active_snapshot_id", "settings", "created_at", "modified_at"}).
+							AddRow("Test", "draft", nil, []byte(`{}`), testNow, testNow),
 					)
 				// Node query succeeds with empty results
 				mock.ExpectQuery("SELECT").
 					WithArgs(testWfID).
 					WillReturnRows(
 						pgxmock.NewRows([]string{
-							"instance_id", "node_type", "x_pos", "y_pos",
+							"instance_id", "node_type", "node_library_id", "x_pos", "y_pos",
 							"label", "base_description", "metadata",
 						}),
 					)
@@ -265,11 +304,21 @@ func TestUpsertWorkflow(t *testing.T) {
 				mock.ExpectBeginTx(pgx.TxOptions{
 					IsoLevel: pgx.ReadCommitted,
 				})
+				// Expect the previous state to be locked for the audit diff (none yet)
+				mock.ExpectQuery(`SELECT w.name, w.settings`).
+					WithArgs(wf.ID, storage.DefaultWorkspaceID).
+					WillReturnError(pgx.ErrNoRows)
 
 				// Expect upsert for workflow header (insert case)
 				mock.ExpectExec(`INSERT INTO workflows`).
-					WithArgs(wf.ID, wf.Name, pgxmock.AnyArg(), pgxmock.AnyArg()).
+					WithArgs(wf.ID, storage.DefaultWorkspaceID, wf.Name, []byte(`{}`), pgxmock.AnyArg(), pgxmock.AnyArg()).
 					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				expectWorkflowQuota(mock, nil, 0)
+
+				// Expect delete old edges (no-op for new workflow)
+				mock.ExpectExec(`DELETE FROM workflow_edges`).
+					WithArgs(wf.ID).
+					WillReturnResult(pgxmock.NewResult("DELETE", 0))
 
 				// Expect delete old nodes (no-op for new workflow)
 				mock.ExpectExec(`DELETE FROM workflow_node_instances`).
@@ -278,6 +327,7 @@ func TestUpsertWorkflow(t *testing.T) {
 
 				// Expect query for node_library_ids
 				mock.ExpectQuery(`SELECT id, node_type FROM node_library`).
+					WithArgs(storage.DefaultWorkspaceID).
 					WillReturnRows(pgxmock.NewRows([]string{"id", "node_type"}).
 						AddRow(uuid.MustParse(startNodeLibraryID), "start").
 						AddRow(uuid.MustParse(formNodeLibraryID), "form").
@@ -288,17 +338,17 @@ func TestUpsertWorkflow(t *testing.T) {
 					WithArgs(wf.ID, wf.Nodes[0].ID, uuid.MustParse(startNodeLibraryID), wf.Nodes[0].Position.X, wf.Nodes[0].Position.Y).
 					WillReturnResult(pgxmock.NewResult("INSERT", 1))
 
-				// Expect delete old edges (no-op for new workflow)
-				mock.ExpectExec(`DELETE FROM workflow_edges`).
-					WithArgs(wf.ID).
-					WillReturnResult(pgxmock.NewResult("DELETE", 0))
-
 				// Expect insert new edges
 				mock.ExpectExec(`INSERT INTO workflow_edges`).
 					WithArgs(wf.ID, wf.Edges[0].ID, wf.Edges[0].Source, wf.Edges[0].Target, pgxmock.AnyArg(),
 						pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
 					WillReturnResult(pgxmock.NewResult("INSERT", 1))
 
+				// Expect the audit event
+				mock.ExpectExec(`INSERT INTO audit_events`).
+					WithArgs(storage.DefaultWorkspaceID, "", storage.AuditWorkflowCreate, storage.AuditTargetWorkflow, wf.ID.String(), "", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
 				mock.ExpectCommit()
 			},
 			wantErr: nil,
@@ -337,12 +387,24 @@ func TestUpsertWorkflow(t *testing.T) {
 				mock.ExpectBeginTx(pgx.TxOptions{
 					IsoLevel: pgx.ReadCommitted,
 				})
+				// Expect the previous state to be locked for the audit diff
+				mock.ExpectQuery(`SELECT w.name, w.settings`).
+					WithArgs(wf.ID, storage.DefaultWorkspaceID).
+					WillReturnRows(pgxmock.NewRows([]string{"name", "settings", "nodes", "edges"}).
+						AddRow("Weather Check System", []byte(`{}`),
+							[]byte(`[{"id":"start","type":"start","libraryId":"`+startNodeLibraryID+`","position":{"x":0,"y":0}}]`),
+							[]byte(`[]`)))
 
 				// Expect upsert for workflow header (update case)
 				mock.ExpectExec(`INSERT INTO workflows`).
-					WithArgs(wf.ID, wf.Name, pgxmock.AnyArg(), pgxmock.AnyArg()).
+					WithArgs(wf.ID, storage.DefaultWorkspaceID, wf.Name, []byte(`{}`), pgxmock.AnyArg(), pgxmock.AnyArg()).
 					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
 
+				// Expect delete old edges
+				mock.ExpectExec(`DELETE FROM workflow_edges`).
+					WithArgs(wf.ID).
+					WillReturnResult(pgxmock.NewResult("DELETE", 1)) // Assuming 1 old edge
+
 				// Expect delete old nodes
 				mock.ExpectExec(`DELETE FROM workflow_node_instances`).
 					WithArgs(wf.ID).
@@ -350,6 +412,7 @@ func TestUpsertWorkflow(t *testing.T) {
 
 				// Expect query for node_library_ids
 				mock.ExpectQuery(`SELECT id, node_type FROM node_library`).
+					WithArgs(storage.DefaultWorkspaceID).
 					WillReturnRows(pgxmock.NewRows([]string{"id", "node_type"}).
 						AddRow(uuid.MustParse(startNodeLibraryID), "start").
 						AddRow(uuid.MustParse(formNodeLibraryID), "form"))
@@ -362,11 +425,6 @@ func TestUpsertWorkflow(t *testing.T) {
 					WithArgs(wf.ID, wf.Nodes[1].ID, uuid.MustParse(formNodeLibraryID), wf.Nodes[1].Position.X, wf.Nodes[1].Position.Y).
 					WillReturnResult(pgxmock.NewResult("INSERT", 1))
 
-				// Expect delete old edges
-				mock.ExpectExec(`DELETE FROM workflow_edges`).
-					WithArgs(wf.ID).
-					WillReturnResult(pgxmock.NewResult("DELETE", 1)) // Assuming 1 old edge
-
 				// Expect insert new edges
 				mock.ExpectExec(`INSERT INTO workflow_edges`).
 					WithArgs(wf.ID, wf.Edges[0].ID, wf.Edges[0].Source, wf.Edges[0].Target, pgxmock.AnyArg(),
@@ -377,10 +435,135 @@ func TestUpsertWorkflow(t *testing.T) {
 						pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
 					WillReturnResult(pgxmock.NewResult("INSERT", 1))
 
+				// Expect the audit event
+				mock.ExpectExec(`INSERT INTO audit_events`).
+					WithArgs(storage.DefaultWorkspaceID, "", storage.AuditWorkflowUpdate, storage.AuditTargetWorkflow, wf.ID.String(), "", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
 				mock.ExpectCommit()
 			},
 			wantErr: nil,
 		},
+		{
+			name: "pinned library ID is used instead of the node type mapping",
+			wf: &storage.Workflow{
+				ID:   uuid.MustParse("550e8400-e29b-41d4-a716-446655440003"),
+				Name: "Pinned Blueprint",
+				Nodes: []storage.Node{
+					{
+						ID:        "form",
+						Type:      "form",
+						LibraryID: newNodeLibraryID,
+						Position:  storage.NodePosition{X: 5, Y: 5},
+					},
+				},
+				Edges: []storage.Edge{},
+			},
+			setupMock: func(mock pgxmock.PgxPoolIface, wf *storage.Workflow) {
+				mock.ExpectBeginTx(pgx.TxOptions{
+					IsoLevel: pgx.ReadCommitted,
+				})
+				mock.ExpectQuery(`SELECT w.name, w.settings`).
+					WithArgs(wf.ID, storage.DefaultWorkspaceID).
+					WillReturnError(pgx.ErrNoRows)
+				mock.ExpectExec(`INSERT INTO workflows`).
+					WithArgs(wf.ID, storage.DefaultWorkspaceID, wf.Name, []byte(`{}`), pgxmock.AnyArg(), pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				expectWorkflowQuota(mock, nil, 0)
+				mock.ExpectExec(`DELETE FROM workflow_edges`).
+					WithArgs(wf.ID).
+					WillReturnResult(pgxmock.NewResult("DELETE", 0))
+				mock.ExpectExec(`DELETE FROM workflow_node_instances`).
+					WithArgs(wf.ID).
+					WillReturnResult(pgxmock.NewResult("DELETE", 0))
+				// Two form blueprints: the type mapping alone would pick the last one.
+				mock.ExpectQuery(`SELECT id, node_type FROM node_library`).
+					WithArgs(storage.DefaultWorkspaceID).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "node_type"}).
+						AddRow(uuid.MustParse(newNodeLibraryID), "form").
+						AddRow(uuid.MustParse(formNodeLibraryID), "form"))
+				mock.ExpectExec(`INSERT INTO workflow_node_instances`).
+					WithArgs(wf.ID, "form", uuid.MustParse(newNodeLibraryID), 5.0, 5.0).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				mock.ExpectExec(`INSERT INTO audit_events`).
+					WithArgs(storage.DefaultWorkspaceID, "", storage.AuditWorkflowCreate, storage.AuditTargetWorkflow, wf.ID.String(), "", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "returns error if pinned library entry has a different type",
+			wf: &storage.Workflow{
+				ID:   uuid.MustParse("550e8400-e29b-41d4-a716-446655440004"),
+				Name: "Mismatched Blueprint",
+				Nodes: []storage.Node{
+					{ID: "start", Type: "start", LibraryID: formNodeLibraryID},
+				},
+				Edges: []storage.Edge{},
+			},
+			setupMock: func(mock pgxmock.PgxPoolIface, wf *storage.Workflow) {
+				mock.ExpectBeginTx(pgx.TxOptions{
+					IsoLevel: pgx.ReadCommitted,
+				})
+				mock.ExpectQuery(`SELECT w.name, w.settings`).
+					WithArgs(wf.ID, storage.DefaultWorkspaceID).
+					WillReturnError(pgx.ErrNoRows)
+				mock.ExpectExec(`INSERT INTO workflows`).
+					WithArgs(wf.ID, storage.DefaultWorkspaceID, wf.Name, []byte(`{}`), pgxmock.AnyArg(), pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				expectWorkflowQuota(mock, nil, 0)
+				mock.ExpectExec(`DELETE FROM workflow_edges`).
+					WithArgs(wf.ID).
+					WillReturnResult(pgxmock.NewResult("DELETE", 0))
+				mock.ExpectExec(`DELETE FROM workflow_node_instances`).
+					WithArgs(wf.ID).
+					WillReturnResult(pgxmock.NewResult("DELETE", 0))
+				mock.ExpectQuery(`SELECT id, node_type FROM node_library`).
+					WithArgs(storage.DefaultWorkspaceID).
+					WillReturnRows(pgxmock.NewRows([]string{"id", "node_type"}).
+						AddRow(uuid.MustParse(startNodeLibraryID), "start").
+						AddRow(uuid.MustParse(formNodeLibraryID), "form"))
+				mock.ExpectRollback()
+			},
+			wantErr: errors.New("node start: library entry " + formNodeLibraryID + " has type form, not start"),
+		},
+		{
+			name: "returns ErrOtherWorkspace if the ID belongs to another workspace",
+			wf:   &storage.Workflow{ID: uuid.MustParse("550e8400-e29b-41d4-a716-446655440005"), Name: "Taken"},
+			setupMock: func(mock pgxmock.PgxPoolIface, wf *storage.Workflow) {
+				mock.ExpectBeginTx(pgx.TxOptions{
+					IsoLevel: pgx.ReadCommitted,
+				})
+				mock.ExpectQuery(`SELECT w.name, w.settings`).
+					WithArgs(wf.ID, storage.DefaultWorkspaceID).
+					WillReturnError(pgx.ErrNoRows)
+				// The conflicting row is in another workspace, so nothing is updated.
+				mock.ExpectExec(`INSERT INTO workflows`).
+					WithArgs(wf.ID, storage.DefaultWorkspaceID, wf.Name, []byte(`{}`), pgxmock.AnyArg(), pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("INSERT", 0))
+				mock.ExpectRollback()
+			},
+			wantErr: errors.New("workflow 550e8400-e29b-41d4-a716-446655440005: " + storage.ErrOtherWorkspace.Error()),
+		},
+		{
+			name: "returns ErrQuotaExceeded if a new workflow is over the quota",
+			wf:   &storage.Workflow{ID: uuid.MustParse("550e8400-e29b-41d4-a716-446655440006"), Name: "One Too Many"},
+			setupMock: func(mock pgxmock.PgxPoolIface, wf *storage.Workflow) {
+				mock.ExpectBeginTx(pgx.TxOptions{
+					IsoLevel: pgx.ReadCommitted,
+				})
+				mock.ExpectQuery(`SELECT w.name, w.settings`).
+					WithArgs(wf.ID, storage.DefaultWorkspaceID).
+					WillReturnError(pgx.ErrNoRows)
+				mock.ExpectExec(`INSERT INTO workflows`).
+					WithArgs(wf.ID, storage.DefaultWorkspaceID, wf.Name, []byte(`{}`), pgxmock.AnyArg(), pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				limit := 2
+				expectWorkflowQuota(mock, &limit, 3) // counts the row just inserted
+				mock.ExpectRollback()
+			},
+			wantErr: errors.New("workspace default allows 2 workflows: " + storage.ErrQuotaExceeded.Error()),
+		},
 		{
 			name: "returns error if node type not in node_library",
 			wf: &storage.Workflow{
@@ -399,16 +582,25 @@ func TestUpsertWorkflow(t *testing.T) {
 				mock.ExpectBeginTx(pgx.TxOptions{
 					IsoLevel: pgx.ReadCommitted,
 				})
+				mock.ExpectQuery(`SELECT w.name, w.settings`).
+					WithArgs(wf.ID, storage.DefaultWorkspaceID).
+					WillReturnError(pgx.ErrNoRows)
 
 				mock.ExpectExec(`INSERT INTO workflows`).
-					WithArgs(wf.ID, wf.Name, pgxmock.AnyArg(), pgxmock.AnyArg()).
+					WithArgs(wf.ID, storage.DefaultWorkspaceID, wf.Name, []byte(`{}`), pgxmock.AnyArg(), pgxmock.AnyArg()).
 					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				expectWorkflowQuota(mock, nil, 0)
+
+				mock.ExpectExec(`DELETE FROM workflow_edges`).
+					WithArgs(wf.ID).
+					WillReturnResult(pgxmock.NewResult("DELETE", 0))
 
 				mock.ExpectExec(`DELETE FROM workflow_node_instances`).
 					WithArgs(wf.ID).
 					WillReturnResult(pgxmock.NewResult("DELETE", 0))
 
 				mock.ExpectQuery(`SELECT id, node_type FROM node_library`).
+					WithArgs(storage.DefaultWorkspaceID).
 					WillReturnRows(pgxmock.NewRows([]string{"id", "node_type"}).
 						AddRow(uuid.MustParse(startNodeLibraryID), "start")) // "mystery" not here
 
@@ -468,6 +660,10 @@ func TestDeleteWorkflow(t *testing.T) {
 				mock.ExpectBeginTx(pgx.TxOptions{
 					IsoLevel: pgx.ReadCommitted,
 				})
+				mock.ExpectQuery(`SELECT w.name, w.settings`).
+					WithArgs(id, storage.DefaultWorkspaceID).
+					WillReturnRows(pgxmock.NewRows([]string{"name", "settings", "nodes", "edges"}).
+						AddRow("Weather Check System", []byte(`{}`), []byte(`[]`), []byte(`[]`)))
 
 				// Expect hard delete of edges
 				mock.ExpectExec(`DELETE FROM workflow_edges`).
@@ -481,9 +677,14 @@ func TestDeleteWorkflow(t *testing.T) {
 
 				// Expect soft delete of workflow header
 				mock.ExpectExec(`UPDATE workflows`).
-					WithArgs(pgxmock.AnyArg(), id).
+					WithArgs(pgxmock.AnyArg(), id, storage.DefaultWorkspaceID).
 					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
 
+				// Expect the audit event with the deleted state
+				mock.ExpectExec(`INSERT INTO audit_events`).
+					WithArgs(storage.DefaultWorkspaceID, "", storage.AuditWorkflowDelete, storage.AuditTargetWorkflow, id.String(), "", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
 				mock.ExpectCommit()
 			},
 			wantErr: nil,
@@ -495,6 +696,9 @@ func TestDeleteWorkflow(t *testing.T) {
 				mock.ExpectBeginTx(pgx.TxOptions{
 					IsoLevel: pgx.ReadCommitted,
 				})
+				mock.ExpectQuery(`SELECT w.name, w.settings`).
+					WithArgs(id, storage.DefaultWorkspaceID).
+					WillReturnError(pgx.ErrNoRows)
 
 				// Edges and nodes might be deleted (or not exist)
 				mock.ExpectExec(`DELETE FROM workflow_edges`).
@@ -506,7 +710,7 @@ func TestDeleteWorkflow(t *testing.T) {
 
 				// Expect soft delete of workflow header, but no rows affected
 				mock.ExpectExec(`UPDATE workflows`).
-					WithArgs(pgxmock.AnyArg(), id).
+					WithArgs(pgxmock.AnyArg(), id, storage.DefaultWorkspaceID).
 					WillReturnResult(pgxmock.NewResult("UPDATE", 0))
 
 				mock.ExpectRollback() // Expect rollback due to RowsAffected == 0 resulting in error
@@ -520,6 +724,10 @@ func TestDeleteWorkflow(t *testing.T) {
 				mock.ExpectBeginTx(pgx.TxOptions{
 					IsoLevel: pgx.ReadCommitted,
 				})
+				mock.ExpectQuery(`SELECT w.name, w.settings`).
+					WithArgs(id, storage.DefaultWorkspaceID).
+					WillReturnRows(pgxmock.NewRows([]string{"name", "settings", "nodes", "edges"}).
+						AddRow("Weather Check System", []byte(`{}`), []byte(`[]`), []byte(`[]`)))
 
 				// Expect delete edges to fail
 				mock.ExpectExec(`DELETE FROM workflow_edges`).
@@ -587,11 +795,11 @@ func TestPublishWorkflow(t *testing.T) {
 				})
 
 				// 1. Verify workflow exists
-				mock.ExpectQuery("SELECT name FROM workflows").
-					WithArgs(testWfID).
+				mock.ExpectQuery("SELECT settings FROM workflows").
+					WithArgs(testWfID, storage.DefaultWorkspaceID).
 					WillReturnRows(
-						pgxmock.NewRows([]string{"name"}).
-							AddRow("Weather Check System"),
+						pgxmock.NewRows([]string{"settings"}).
+							AddRow([]byte(`{"scopedOutputsOnly":true}`)),
 					)
 
 				// 2. Hydrate nodes
@@ -599,9 +807,9 @@ func TestPublishWorkflow(t *testing.T) {
 					WithArgs(testWfID).
 					WillReturnRows(
 						pgxmock.NewRows([]string{
-							"instance_id", "node_type", "x_pos", "y_pos",
+							"instance_id", "node_type", "node_library_id", "x_pos", "y_pos",
 							"label", "base_description", "metadata",
-						}).AddRow("start", "start", -160.0, 300.0, "Start", "Begin workflow", nodeMetadata),
+						}).AddRow("start", "start", testStartLibraryID, -160.0, 300.0, "Start", "Begin workflow", nodeMetadata),
 					)
 
 				// 3. Hydrate edges
@@ -623,7 +831,7 @@ func TestPublishWorkflow(t *testing.T) {
 
 				// 5. Insert snapshot
 				mock.ExpectQuery("INSERT INTO workflow_snapshots").
-					WithArgs(testWfID, 1, pgxmock.AnyArg()).
+					WithArgs(testWfID, storage.DefaultWorkspaceID, 1, pgxmock.AnyArg()).
 					WillReturnRows(
 						pgxmock.NewRows([]string{"id", "published_at"}).
 							AddRow(snapID, testNow),
@@ -634,6 +842,12 @@ func TestPublishWorkflow(t *testing.T) {
 					WithArgs(snapID, testWfID).
 					WillReturnResult(pgxmock.NewResult("UPDATE", 1))
 
+				// 7. Audit event
+				mock.ExpectExec("INSERT INTO audit_events").
+					WithArgs(storage.DefaultWorkspaceID, "", storage.AuditWorkflowPublish, storage.AuditTargetWorkflow, testWfID.String(), "",
+						json.RawMessage(`{"snapshotId":{"before":null,"after":"`+snapID.String()+`"},"version":{"before":null,"after":1}}`)).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
 				mock.ExpectCommit()
 			},
 			checkSnap: func(t *testing.T, snap *storage.WorkflowSnapshot) {
@@ -650,6 +864,9 @@ func TestPublishWorkflow(t *testing.T) {
 				if len(snap.DagData.Nodes) != 1 {
 					t.Errorf("expected 1 node in snapshot, got %d", len(snap.DagData.Nodes))
 				}
+				if !snap.DagData.Settings.ScopedOutputsOnly {
+					t.Error("expected the workflow settings to be frozen in the snapshot")
+				}
 			},
 		},
 		{
@@ -658,8 +875,8 @@ func TestPublishWorkflow(t *testing.T) {
 				mock.ExpectBeginTx(pgx.TxOptions{
 					IsoLevel: pgx.RepeatableRead,
 				})
-				mock.ExpectQuery("SELECT name FROM workflows").
-					WithArgs(testWfID).
+				mock.ExpectQuery("SELECT settings FROM workflows").
+					WithArgs(testWfID, storage.DefaultWorkspaceID).
 					WillReturnError(pgx.ErrNoRows)
 				mock.ExpectRollback()
 			},
@@ -671,10 +888,10 @@ func TestPublishWorkflow(t *testing.T) {
 				mock.ExpectBeginTx(pgx.TxOptions{
 					IsoLevel: pgx.RepeatableRead,
 				})
-				mock.ExpectQuery("SELECT name FROM workflows").
-					WithArgs(testWfID).
+				mock.ExpectQuery("SELECT settings FROM workflows").
+					WithArgs(testWfID, storage.DefaultWorkspaceID).
 					WillReturnRows(
-						pgxmock.NewRows([]string{"name"}).AddRow("Test"),
+						pgxmock.NewRows([]string{"settings"}).AddRow([]byte(`{}`)),
 					)
 				mock.ExpectQuery("SELECT").
 					WithArgs(testWfID).
@@ -722,3 +939,1304 @@ func TestPublishWorkflow(t *testing.T) {
 		})
 	}
 }
+
+func TestGetSnapshot(t *testing.T) {
+	t.Parallel()
+
+	snapID := uuid.MustParse("660e8400-e29b-41d4-a716-446655440001")
+	dag := []byte(`{"nodes":[{"id":"start","type":"start","libraryId":"` + testStartLibraryID +
+		`","position":{"x":0,"y":0},"data":{"label":"Start","description":"","metadata":{}}}],"edges":[]}`)
+
+	tests := []struct {
+		name      string
+		setupMock func(mock pgxmock.PgxPoolIface)
+		wantErr   error
+	}{
+		{
+			name: "returns requested version",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery("SELECT s.id, s.workflow_id, s.version_number, s.dag_data, s.published_at").
+					WithArgs(testWfID, 2, storage.DefaultWorkspaceID).
+					WillReturnRows(
+						pgxmock.NewRows([]string{"id", "workflow_id", "version_number", "dag_data", "published_at"}).
+							AddRow(snapID, testWfID, 2, dag, testNow),
+					)
+			},
+		},
+		{
+			name: "unknown version returns ErrNoRows",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery("SELECT s.id").
+					WithArgs(testWfID, 2, storage.DefaultWorkspaceID).
+					WillReturnError(pgx.ErrNoRows)
+			},
+			wantErr: pgx.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("failed to create mock pool: %v", err)
+			}
+			defer mock.Close()
+
+			tt.setupMock(mock)
+
+			store := &storage.PgStorage{DB: mock}
+			snap, err := store.GetSnapshot(context.Background(), testWfID, 2)
+
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if snap.ID != snapID || snap.VersionNumber != 2 {
+				t.Errorf("unexpected snapshot %+v", snap)
+			}
+			if len(snap.DagData.Nodes) != 1 || snap.DagData.Nodes[0].LibraryID != testStartLibraryID {
+				t.Errorf("expected one node pinned to %s, got %+v", testStartLibraryID, snap.DagData.Nodes)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestListNodeLibrary(t *testing.T) {
+	t.Parallel()
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("failed to create mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectQuery("SELECT id, COALESCE\\(workspace_id, ''\\), node_type").
+		WithArgs(storage.DefaultWorkspaceID).
+		WillReturnRows(
+			pgxmock.NewRows([]string{"id", "workspace_id", "node_type", "base_label", "base_description", "metadata", "modified_at"}).
+				AddRow(testStartLibraryID, "", "start", "Start", "Begin", json.RawMessage(`{}`), testNow),
+		)
+
+	store := &storage.PgStorage{DB: mock}
+	entries, err := store.ListNodeLibrary(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].ID != testStartLibraryID || entries[0].NodeType != "start" {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet mock expectations: %v", err)
+	}
+}
+
+func TestCreateNodeLibraryEntry(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		entry   storage.NodeLibraryEntry
+		wantErr bool
+	}{
+		{
+			name:  "keeps the given ID",
+			entry: storage.NodeLibraryEntry{ID: testStartLibraryID, NodeType: "start", Label: "Start"},
+		},
+		{
+			name:  "generates an ID when empty",
+			entry: storage.NodeLibraryEntry{NodeType: "end", Label: "End", Metadata: json.RawMessage(`{"a":1}`)},
+		},
+		{
+			name:    "rejects a malformed ID",
+			entry:   storage.NodeLibraryEntry{ID: "not-a-uuid", NodeType: "end"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("failed to create mock pool: %v", err)
+			}
+			defer mock.Close()
+
+			if !tt.wantErr {
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+				mock.ExpectQuery("INSERT INTO node_library").
+					WithArgs(pgxmock.AnyArg(), storage.DefaultWorkspaceID, tt.entry.NodeType, tt.entry.Label, tt.entry.Description, pgxmock.AnyArg()).
+					WillReturnRows(pgxmock.NewRows([]string{"modified_at"}).AddRow(testNow))
+				mock.ExpectExec("INSERT INTO audit_events").
+					WithArgs(storage.DefaultWorkspaceID, "admin@example.com", storage.AuditLibraryCreate, storage.AuditTargetNodeLibrary,
+						pgxmock.AnyArg(), "req-1", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				mock.ExpectCommit()
+			}
+
+			entry := tt.entry
+			store := &storage.PgStorage{DB: mock}
+			ctx := storage.WithAuditInfo(context.Background(), storage.AuditInfo{Actor: "admin@example.com", RequestID: "req-1"})
+			err = store.CreateNodeLibraryEntry(ctx, &entry)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if _, err := uuid.Parse(entry.ID); err != nil {
+				t.Errorf("expected a UUID library ID, got %q", entry.ID)
+			}
+			if tt.entry.ID != "" && entry.ID != tt.entry.ID {
+				t.Errorf("expected ID %s to be kept, got %s", tt.entry.ID, entry.ID)
+			}
+			if !entry.ModifiedAt.Equal(testNow) {
+				t.Errorf("expected ModifiedAt from RETURNING, got %v", entry.ModifiedAt)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestImportWorkflow_LibraryIDTaken(t *testing.T) {
+	t.Parallel()
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("failed to create mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	// The taken ID fails the insert; the transaction is rolled back before
+	// the workflow is touched.
+	mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+	mock.ExpectQuery("INSERT INTO node_library").
+		WithArgs(uuid.MustParse(testStartLibraryID), storage.DefaultWorkspaceID, "start", "Start", "", pgxmock.AnyArg()).
+		WillReturnError(&pgconn.PgError{Code: "23505"})
+	mock.ExpectRollback()
+
+	store := &storage.PgStorage{DB: mock}
+	entries := []storage.NodeLibraryEntry{{ID: testStartLibraryID, NodeType: "start", Label: "Start"}}
+	err = store.ImportWorkflow(context.Background(), &storage.Workflow{ID: testWfID, Name: "Imported"}, entries)
+	var taken *storage.LibraryIDTakenError
+	if !errors.As(err, &taken) || taken.ID != testStartLibraryID || !errors.Is(err, storage.ErrLibraryIDTaken) {
+		t.Fatalf("expected a LibraryIDTakenError for %s, got %v", testStartLibraryID, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet mock expectations: %v", err)
+	}
+}
+
+func TestListTestCases(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		setupMock func(mock pgxmock.PgxPoolIface)
+		wantNames []string
+		wantErr   error
+	}{
+		{
+			name: "returns cases in saved order",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`SELECT true FROM workflows`).
+					WithArgs(testWfID, storage.DefaultWorkspaceID).
+					WillReturnRows(pgxmock.NewRows([]string{"bool"}).AddRow(true))
+				mock.ExpectQuery(`FROM workflow_test_cases`).
+					WithArgs(testWfID).
+					WillReturnRows(pgxmock.NewRows([]string{"name", "definition", "modified_at"}).
+						AddRow("hot day", []byte(`{"inputs":{}}`), testNow).
+						AddRow("cool day", []byte(`{}`), testNow))
+			},
+			wantNames: []string{"hot day", "cool day"},
+		},
+		{
+			name: "workflow not found",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`SELECT true FROM workflows`).
+					WithArgs(testWfID, storage.DefaultWorkspaceID).
+					WillReturnError(pgx.ErrNoRows)
+			},
+			wantErr: pgx.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("failed to create mock pool: %v", err)
+			}
+			defer mock.Close()
+			tt.setupMock(mock)
+
+			store := &storage.PgStorage{DB: mock}
+			cases, err := store.ListTestCases(context.Background(), testWfID)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("expected %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var names []string
+			for _, tc := range cases {
+				names = append(names, tc.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.wantNames, ",") {
+				t.Errorf("expected %v, got %v", tt.wantNames, names)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestReplaceTestCases(t *testing.T) {
+	t.Parallel()
+
+	cases := []storage.TestCase{
+		{Name: "hot day", Definition: json.RawMessage(`{"inputs":{"city":"Sydney"}}`)},
+		{Name: "cool day", Definition: json.RawMessage(`{}`)},
+	}
+
+	tests := []struct {
+		name      string
+		setupMock func(mock pgxmock.PgxPoolIface)
+		wantErr   error
+	}{
+		{
+			name: "replaces cases in order",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+				mock.ExpectQuery(`SELECT true FROM workflows`).
+					WithArgs(testWfID, storage.DefaultWorkspaceID).
+					WillReturnRows(pgxmock.NewRows([]string{"bool"}).AddRow(true))
+				mock.ExpectExec(`DELETE FROM workflow_test_cases`).
+					WithArgs(testWfID).
+					WillReturnResult(pgxmock.NewResult("DELETE", 3))
+				for i, tc := range cases {
+					mock.ExpectQuery(`INSERT INTO workflow_test_cases`).
+						WithArgs(testWfID, i, tc.Name, tc.Definition).
+						WillReturnRows(pgxmock.NewRows([]string{"modified_at"}).AddRow(testNow))
+				}
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "workflow not found",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+				mock.ExpectQuery(`SELECT true FROM workflows`).
+					WithArgs(testWfID, storage.DefaultWorkspaceID).
+					WillReturnError(pgx.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			wantErr: pgx.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("failed to create mock pool: %v", err)
+			}
+			defer mock.Close()
+			tt.setupMock(mock)
+
+			in := append([]storage.TestCase(nil), cases...)
+			store := &storage.PgStorage{DB: mock}
+			err = store.ReplaceTestCases(context.Background(), testWfID, in)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr == nil && !in[1].ModifiedAt.Equal(testNow) {
+				t.Errorf("expected ModifiedAt from RETURNING, got %v", in[1].ModifiedAt)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestCreateRun(t *testing.T) {
+	t.Parallel()
+	runID := uuid.New()
+
+	tests := []struct {
+		name      string
+		setupMock func(mock pgxmock.PgxPoolIface)
+		wantErr   error
+	}{
+		{
+			name: "inserts the run",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+				mock.ExpectQuery(`SELECT true FROM workflows`).
+					WithArgs(testWfID, storage.DefaultWorkspaceID).
+					WillReturnRows(pgxmock.NewRows([]string{"bool"}).AddRow(true))
+				expectRunQuota(mock, nil, 0)
+				mock.ExpectQuery(`INSERT INTO workflow_runs`).
+					WithArgs(runID, testWfID, storage.DefaultWorkspaceID, 3, "live", "completed", "", int64(0),
+						pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
+					WillReturnRows(pgxmock.NewRows([]string{"created_at"}).AddRow(testNow))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "inserts the run under the quota",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				limit := 5
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+				mock.ExpectQuery(`SELECT true FROM workflows`).
+					WithArgs(testWfID, storage.DefaultWorkspaceID).
+					WillReturnRows(pgxmock.NewRows([]string{"bool"}).AddRow(true))
+				expectRunQuota(mock, &limit, 4)
+				mock.ExpectQuery(`INSERT INTO workflow_runs`).
+					WithArgs(runID, testWfID, storage.DefaultWorkspaceID, 3, "live", "completed", "", int64(0),
+						pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg(), pgxmock.AnyArg()).
+					WillReturnRows(pgxmock.NewRows([]string{"created_at"}).AddRow(testNow))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "returns ErrQuotaExceeded without inserting at the quota",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				limit := 5
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+				mock.ExpectQuery(`SELECT true FROM workflows`).
+					WithArgs(testWfID, storage.DefaultWorkspaceID).
+					WillReturnRows(pgxmock.NewRows([]string{"bool"}).AddRow(true))
+				expectRunQuota(mock, &limit, 5)
+				mock.ExpectRollback()
+			},
+			wantErr: storage.ErrQuotaExceeded,
+		},
+		{
+			name: "workflow not found",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+				mock.ExpectQuery(`SELECT true FROM workflows`).
+					WithArgs(testWfID, storage.DefaultWorkspaceID).
+					WillReturnError(pgx.ErrNoRows)
+				mock.ExpectRollback()
+			},
+			wantErr: pgx.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("failed to create mock pool: %v", err)
+			}
+			defer mock.Close()
+			tt.setupMock(mock)
+
+			run := &storage.Run{
+				ID: runID, WorkflowID: testWfID, Version: 3, Mode: "live", Status: "completed",
+				Inputs: json.RawMessage(`{}`), Result: json.RawMessage(`{}`), Calls: json.RawMessage(`[]`),
+			}
+			store := &storage.PgStorage{DB: mock}
+			err = store.CreateRun(context.Background(), run)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr == nil && (!run.CreatedAt.Equal(testNow) || run.WorkspaceID != storage.DefaultWorkspaceID) {
+				t.Errorf("expected CreatedAt from RETURNING in the default workspace, got %+v", run)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestGetRun(t *testing.T) {
+	t.Parallel()
+	runID := uuid.New()
+
+	tests := []struct {
+		name      string
+		setupMock func(mock pgxmock.PgxPoolIface)
+		wantErr   error
+	}{
+		{
+			name: "returns the run",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`FROM workflow_runs`).
+					WithArgs(runID, testWfID, storage.DefaultWorkspaceID).
+					WillReturnRows(pgxmock.NewRows(runRowColumns).
+						AddRow(runID, testWfID, storage.DefaultWorkspaceID, 0, "dry-run", "failed", "send-email", int64(120), []byte(`{}`), []byte(`{"status":"failed"}`), []byte(`[]`), []byte(nil), []byte(nil), (*time.Time)(nil), testNow))
+			},
+		},
+		{
+			name: "run not found",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`FROM workflow_runs`).
+					WithArgs(runID, testWfID, storage.DefaultWorkspaceID).
+					WillReturnError(pgx.ErrNoRows)
+			},
+			wantErr: pgx.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("failed to create mock pool: %v", err)
+			}
+			defer mock.Close()
+			tt.setupMock(mock)
+
+			store := &storage.PgStorage{DB: mock}
+			run, err := store.GetRun(context.Background(), testWfID, runID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr == nil && (run.Mode != "dry-run" || run.Status != "failed" || run.FailedNode != "send-email" ||
+				run.DurationMs != 120 || string(run.Result) != `{"status":"failed"}`) {
+				t.Errorf("unexpected run %+v", run)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+var taskRowColumns = []string{"id", "workflow_id", "workspace_id", "run_id", "node_id", "kind", "assignee", "title", "fields", "status",
+	"response", "responded_by", "expires_at", "created_at", "completed_at"}
+
+var runRowColumns = []string{"id", "workflow_id", "workspace_id", "version_number", "mode", "status", "failed_node", "duration_ms",
+	"inputs", "result", "calls", "state", "sealed", "resume_at", "created_at"}
+
+var runSummaryColumns = []string{"id", "workflow_id", "workspace_id", "version_number", "mode", "status", "failed_node", "duration_ms",
+	"inputs", "resume_at", "created_at"}
+
+func TestListRuns(t *testing.T) {
+	t.Parallel()
+	runID := uuid.New()
+	since := testNow.Add(-time.Hour)
+	version := 2
+
+	tests := []struct {
+		name      string
+		filter    storage.RunFilter
+		setupMock func(mock pgxmock.PgxPoolIface)
+		wantLen   int
+		wantErr   bool
+	}{
+		{
+			name:   "workflow only",
+			filter: storage.RunFilter{WorkflowID: testWfID},
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`WHERE workflow_id = \$1 AND workspace_id = \$2\s+ORDER BY created_at DESC, id DESC$`).
+					WithArgs(testWfID, storage.DefaultWorkspaceID).
+					WillReturnRows(pgxmock.NewRows(runSummaryColumns).
+						AddRow(runID, testWfID, storage.DefaultWorkspaceID, 0, "live", "completed", "", int64(40), []byte(`{}`), (*time.Time)(nil), testNow))
+			},
+			wantLen: 1,
+		},
+		{
+			name: "every filter, cursor and limit",
+			filter: storage.RunFilter{
+				WorkflowID: testWfID, Status: "failed", Mode: "live", Since: &since, Until: &testNow,
+				FailedNode: "send-email", Version: &version, Inputs: map[string]any{"city": "Sydney"},
+				Cursor: &storage.RunCursor{CreatedAt: testNow, ID: runID}, Limit: 51,
+			},
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`WHERE workflow_id = \$1 AND workspace_id = \$2 AND status = \$3 AND mode = \$4 AND created_at >= \$5 `+
+					`AND created_at < \$6 AND failed_node = \$7 AND version_number = \$8 AND inputs @> \$9::jsonb `+
+					`AND \(created_at, id\) < \(\$10, \$11\)\s+ORDER BY created_at DESC, id DESC\s+LIMIT \$12`).
+					WithArgs(testWfID, storage.DefaultWorkspaceID, "failed", "live", since, testNow, "send-email", 2, `{"city":"Sydney"}`, testNow, runID, 51).
+					WillReturnRows(pgxmock.NewRows(runSummaryColumns))
+			},
+			wantLen: 0,
+		},
+		{
+			name:   "query error",
+			filter: storage.RunFilter{WorkflowID: testWfID},
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`FROM workflow_runs`).
+					WithArgs(testWfID, storage.DefaultWorkspaceID).
+					WillReturnError(errors.New("connection refused"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("failed to create mock pool: %v", err)
+			}
+			defer mock.Close()
+			tt.setupMock(mock)
+
+			store := &storage.PgStorage{DB: mock}
+			runs, err := store.ListRuns(context.Background(), tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if len(runs) != tt.wantLen {
+				t.Fatalf("expected %d runs, got %d", tt.wantLen, len(runs))
+			}
+			if tt.wantLen > 0 && (runs[0].ID != runID || runs[0].DurationMs != 40 || runs[0].Result != nil) {
+				t.Errorf("unexpected run %+v", runs[0])
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestRunStats(t *testing.T) {
+	t.Parallel()
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("failed to create mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectQuery(`SELECT status, COUNT\(\*\)\s+FROM workflow_runs\s+WHERE workflow_id = \$1 AND workspace_id = \$2 AND created_at >= \$3\s+GROUP BY status`).
+		WithArgs(testWfID, "team-a", testNow).
+		WillReturnRows(pgxmock.NewRows([]string{"status", "count"}).
+			AddRow("completed", 8).AddRow("failed", 3).AddRow("waiting", 1))
+	mock.ExpectQuery(`percentile_cont\(0.5\).*percentile_cont\(0.95\).*AND status NOT IN \('running', 'waiting'\)`).
+		WithArgs(testWfID, "team-a", testNow).
+		WillReturnRows(pgxmock.NewRows([]string{"p50", "p95"}).AddRow(120.0, 480.5))
+	mock.ExpectQuery(`SELECT failed_node, COUNT\(\*\).*status = 'failed'.*LIMIT 10`).
+		WithArgs(testWfID, "team-a", testNow).
+		WillReturnRows(pgxmock.NewRows([]string{"failed_node", "count"}).AddRow("send-email", 2).AddRow("weather-api", 1))
+
+	store := &storage.PgStorage{DB: mock}
+	ctx := storage.WithWorkspace(context.Background(), "team-a")
+	stats, err := store.RunStats(ctx, storage.RunFilter{WorkflowID: testWfID, Since: &testNow})
+	if err != nil {
+		t.Fatalf("RunStats: %v", err)
+	}
+	if stats.Total != 12 || stats.ByStatus["failed"] != 3 || stats.P50DurationMs != 120 || stats.P95DurationMs != 480.5 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	want := []storage.NodeFailures{{NodeID: "send-email", Failures: 2}, {NodeID: "weather-api", Failures: 1}}
+	if !reflect.DeepEqual(stats.FailingNodes, want) {
+		t.Errorf("expected failing nodes %v, got %v", want, stats.FailingNodes)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet mock expectations: %v", err)
+	}
+}
+
+func TestListRetentionPolicies(t *testing.T) {
+	t.Parallel()
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("failed to create mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectQuery(`SELECT id, workspace_id, settings->'retention'\s+FROM workflows\s+WHERE settings->'retention' IS NOT NULL`).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "workspace_id", "retention"}).
+			AddRow(testWfID, "team-a", []byte(`{"days":30,"failedDays":90}`)))
+
+	store := &storage.PgStorage{DB: mock}
+	policies, err := store.ListRetentionPolicies(context.Background())
+	if err != nil {
+		t.Fatalf("ListRetentionPolicies: %v", err)
+	}
+	want := []storage.WorkflowRetention{{WorkflowID: testWfID, WorkspaceID: "team-a", Policy: storage.RetentionPolicy{Days: 30, FailedDays: 90}}}
+	if !reflect.DeepEqual(policies, want) {
+		t.Errorf("expected %+v, got %+v", want, policies)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet mock expectations: %v", err)
+	}
+}
+
+func TestListExecutionLimits(t *testing.T) {
+	t.Parallel()
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatalf("failed to create mock pool: %v", err)
+	}
+	defer mock.Close()
+
+	mock.ExpectQuery(`SELECT scope, subject, rate_per_minute, burst, max_concurrent\s+FROM execution_limits\s+ORDER BY scope, subject`).
+		WillReturnRows(pgxmock.NewRows([]string{"scope", "subject", "rate_per_minute", "burst", "max_concurrent"}).
+			AddRow("api_key", "", 60, 20, 0).
+			AddRow("workflow", testWfID.String(), 10, 5, 2))
+
+	store := &storage.PgStorage{DB: mock}
+	limits, err := store.ListExecutionLimits(context.Background())
+	if err != nil {
+		t.Fatalf("ListExecutionLimits: %v", err)
+	}
+	want := []storage.ExecutionLimit{
+		{Scope: storage.LimitScopeAPIKey, RatePerMinute: 60, Burst: 20},
+		{Scope: storage.LimitScopeWorkflow, Subject: testWfID.String(), RatePerMinute: 10, Burst: 5, MaxConcurrent: 2},
+	}
+	if !reflect.DeepEqual(limits, want) {
+		t.Errorf("expected %+v, got %+v", want, limits)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet mock expectations: %v", err)
+	}
+}
+
+func TestPruneRuns(t *testing.T) {
+	t.Parallel()
+	runID := uuid.New()
+	before, failedBefore := testNow.Add(-24*time.Hour), testNow.Add(-72*time.Hour)
+	filter := storage.RunPruneFilter{WorkflowID: testWfID, Before: &before, KeepNewest: 100, FailedBefore: &failedBefore}
+	selectRuns := `SELECT .+ FROM workflow_runs\s+WHERE workflow_id = \$1 AND workspace_id = \$2 AND \(\(status NOT IN \('running', 'waiting'\) AND ` +
+		`status <> 'failed' AND \(created_at < \$3 OR \(created_at, id\) <= \(.+OFFSET \$4 LIMIT 1\)\)\) OR ` +
+		`\(status = 'failed' AND created_at < \$5\)\)\s+ORDER BY created_at, id\s+LIMIT \$6\s+FOR UPDATE SKIP LOCKED`
+	runRow := func() *pgxmock.Rows {
+		return pgxmock.NewRows(runRowColumns).
+			AddRow(runID, testWfID, storage.DefaultWorkspaceID, 1, "live", "completed", "", int64(10), []byte(`{}`), []byte(`{"status":"completed"}`), []byte(`[]`), []byte(nil), []byte(nil), (*time.Time)(nil), testNow)
+	}
+
+	tests := []struct {
+		name       string
+		archiveErr error
+		setupMock  func(mock pgxmock.PgxPoolIface)
+		want       int
+		wantErr    bool
+	}{
+		{
+			name: "archives then deletes the batch",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectBeginTx(pgx.TxOptions{})
+				mock.ExpectQuery(selectRuns).
+					WithArgs(testWfID, storage.DefaultWorkspaceID, before, 100, failedBefore, 500).
+					WillReturnRows(runRow())
+				mock.ExpectExec(`DELETE FROM workflow_runs WHERE id = ANY\(\$1\)`).
+					WithArgs([]uuid.UUID{runID}).
+					WillReturnResult(pgxmock.NewResult("DELETE", 1))
+				mock.ExpectCommit()
+			},
+			want: 1,
+		},
+		{
+			name:       "archive failure deletes nothing",
+			archiveErr: errors.New("disk full"),
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectBeginTx(pgx.TxOptions{})
+				mock.ExpectQuery(selectRuns).
+					WithArgs(testWfID, storage.DefaultWorkspaceID, before, 100, failedBefore, 500).
+					WillReturnRows(runRow())
+				mock.ExpectRollback()
+			},
+			wantErr: true,
+		},
+		{
+			name: "nothing to prune",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectBeginTx(pgx.TxOptions{})
+				mock.ExpectQuery(selectRuns).
+					WithArgs(testWfID, storage.DefaultWorkspaceID, before, 100, failedBefore, 500).
+					WillReturnRows(pgxmock.NewRows(runRowColumns))
+				mock.ExpectRollback()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("failed to create mock pool: %v", err)
+			}
+			defer mock.Close()
+			tt.setupMock(mock)
+
+			var archived []storage.Run
+			store := &storage.PgStorage{DB: mock}
+			n, err := store.PruneRuns(context.Background(), filter, 500, func(runs []storage.Run) error {
+				archived = runs
+				return tt.archiveErr
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if n != tt.want {
+				t.Errorf("expected %d pruned, got %d", tt.want, n)
+			}
+			if tt.want > 0 && (len(archived) != 1 || string(archived[0].Result) != `{"status":"completed"}`) {
+				t.Errorf("expected the whole run to be archived, got %+v", archived)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+
+	t.Run("no limits", func(t *testing.T) {
+		t.Parallel()
+		store := &storage.PgStorage{DB: nil}
+		if n, err := store.PruneRuns(context.Background(), storage.RunPruneFilter{WorkflowID: testWfID}, 500, nil); n != 0 || err != nil {
+			t.Errorf("expected an empty policy to prune nothing without a query, got %d, %v", n, err)
+		}
+	})
+}
+
+func TestClaimDueRuns(t *testing.T) {
+	t.Parallel()
+	runID := uuid.New()
+	now := testNow
+	retryAt := testNow.Add(5 * time.Minute)
+
+	tests := []struct {
+		name      string
+		setupMock func(mock pgxmock.PgxPoolIface)
+		wantRuns  int
+		wantErr   bool
+	}{
+		{
+			name: "claims due runs",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`UPDATE workflow_runs\s+SET resume_at = \$2.*FOR UPDATE SKIP LOCKED`).
+					WithArgs(now, retryAt, 10).
+					WillReturnRows(pgxmock.NewRows(runRowColumns).
+						AddRow(runID, testWfID, storage.DefaultWorkspaceID, 0, "live", "waiting", "", int64(0), []byte(`{}`), []byte(`{}`), []byte(`[]`), []byte(`{}`), []byte(nil), &retryAt, testNow))
+			},
+			wantRuns: 1,
+		},
+		{
+			name: "query error",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`UPDATE workflow_runs`).
+					WithArgs(now, retryAt, 10).
+					WillReturnError(errors.New("connection refused"))
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("failed to create mock pool: %v", err)
+			}
+			defer mock.Close()
+			tt.setupMock(mock)
+
+			store := &storage.PgStorage{DB: mock}
+			runs, err := store.ClaimDueRuns(context.Background(), now, retryAt, 10)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if len(runs) != tt.wantRuns {
+				t.Fatalf("expected %d runs, got %d", tt.wantRuns, len(runs))
+			}
+			if tt.wantRuns > 0 && (runs[0].ID != runID || runs[0].ResumeAt == nil || !runs[0].ResumeAt.Equal(retryAt)) {
+				t.Errorf("unexpected run %+v", runs[0])
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestListTasks(t *testing.T) {
+	t.Parallel()
+	taskID, runID := uuid.New(), uuid.New()
+	before := testNow.Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		filter    storage.TaskFilter
+		setupMock func(mock pgxmock.PgxPoolIface)
+		wantLen   int
+	}{
+		{
+			name: "no filter",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`FROM workflow_tasks\s+WHERE workspace_id = \$1\s+ORDER BY created_at, id`).
+					WithArgs(storage.DefaultWorkspaceID).
+					WillReturnRows(pgxmock.NewRows(taskRowColumns))
+			},
+		},
+		{
+			name:   "all filters",
+			filter: storage.TaskFilter{Assignee: "alice", Status: storage.TaskPending, ExpiresBefore: &before, AllWorkspaces: true},
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`FROM workflow_tasks\s+WHERE assignee = \$1 AND status = \$2 AND expires_at < \$3`).
+					WithArgs("alice", storage.TaskPending, before).
+					WillReturnRows(pgxmock.NewRows(taskRowColumns).
+						AddRow(taskID, testWfID, storage.DefaultWorkspaceID, runID, "approve", "approval", "alice", "Approve?", []string{}, "pending",
+							[]byte(nil), "", &testNow, testNow, (*time.Time)(nil)))
+			},
+			wantLen: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("failed to create mock pool: %v", err)
+			}
+			defer mock.Close()
+			tt.setupMock(mock)
+
+			store := &storage.PgStorage{DB: mock}
+			tasks, err := store.ListTasks(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(tasks) != tt.wantLen {
+				t.Errorf("expected %d tasks, got %d", tt.wantLen, len(tasks))
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestCompleteTask(t *testing.T) {
+	t.Parallel()
+	taskID, runID := uuid.New(), uuid.New()
+	retryAt := testNow.Add(5 * time.Minute)
+
+	tests := []struct {
+		name      string
+		setupMock func(mock pgxmock.PgxPoolIface)
+		wantErr   error
+	}{
+		{
+			name: "completes a pending task",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`UPDATE workflow_tasks(.|\n)*UPDATE workflow_runs`).
+					WithArgs(taskID, storage.TaskApproved, pgxmock.AnyArg(), "alice", storage.DefaultWorkspaceID, retryAt).
+					WillReturnRows(pgxmock.NewRows(taskRowColumns).
+						AddRow(taskID, testWfID, storage.DefaultWorkspaceID, runID, "approve", "approval", "alice", "Approve?", []string{}, "approved",
+							[]byte(`{}`), "alice", (*time.Time)(nil), testNow, &testNow))
+			},
+		},
+		{
+			name: "already completed",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`UPDATE workflow_tasks(.|\n)*UPDATE workflow_runs`).
+					WithArgs(taskID, storage.TaskApproved, pgxmock.AnyArg(), "alice", storage.DefaultWorkspaceID, retryAt).
+					WillReturnError(pgx.ErrNoRows)
+				mock.ExpectQuery(`SELECT status FROM workflow_tasks`).
+					WithArgs(taskID, storage.DefaultWorkspaceID).
+					WillReturnRows(pgxmock.NewRows([]string{"status"}).AddRow("expired"))
+			},
+			wantErr: storage.ErrTaskNotPending,
+		},
+		{
+			name: "task not found",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`UPDATE workflow_tasks(.|\n)*UPDATE workflow_runs`).
+					WithArgs(taskID, storage.TaskApproved, pgxmock.AnyArg(), "alice", storage.DefaultWorkspaceID, retryAt).
+					WillReturnError(pgx.ErrNoRows)
+				mock.ExpectQuery(`SELECT status FROM workflow_tasks`).
+					WithArgs(taskID, storage.DefaultWorkspaceID).
+					WillReturnError(pgx.ErrNoRows)
+			},
+			wantErr: pgx.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("failed to create mock pool: %v", err)
+			}
+			defer mock.Close()
+			tt.setupMock(mock)
+
+			store := &storage.PgStorage{DB: mock}
+			task, err := store.CompleteTask(context.Background(), taskID, storage.TaskApproved, json.RawMessage(`{}`), "alice", retryAt)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr == nil && (task.Status != storage.TaskApproved || task.CompletedAt == nil) {
+				t.Errorf("unexpected task %+v", task)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestClaimIdempotencyKey(t *testing.T) {
+	t.Parallel()
+	lockedUntil := testNow.Add(2 * time.Minute)
+	expiresAt := testNow.Add(24 * time.Hour)
+
+	tests := []struct {
+		name       string
+		setupMock  func(mock pgxmock.PgxPoolIface)
+		wantErr    error
+		wantStatus string
+	}{
+		{
+			name: "claims a new, expired or stale key",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`INSERT INTO idempotency_keys`).
+					WithArgs(testWfID, "retry-1", "hash", testNow, lockedUntil, expiresAt).
+					WillReturnRows(pgxmock.NewRows([]string{"status"}).AddRow(storage.IdempotencyInProgress))
+			},
+			wantStatus: storage.IdempotencyInProgress,
+		},
+		{
+			name: "returns the unexpired record",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`INSERT INTO idempotency_keys`).
+					WithArgs(testWfID, "retry-1", "hash", testNow, lockedUntil, expiresAt).
+					WillReturnError(pgx.ErrNoRows)
+				status := 200
+				mock.ExpectQuery(`SELECT workflow_id, key, request_hash`).
+					WithArgs(testWfID, "retry-1").
+					WillReturnRows(pgxmock.NewRows([]string{
+						"workflow_id", "key", "request_hash", "status", "status_code", "response", "created_at", "locked_until", "expires_at",
+					}).AddRow(testWfID, "retry-1", "hash", storage.IdempotencyCompleted, &status, []byte(`{"status":"completed"}`), testNow, lockedUntil, expiresAt))
+			},
+			wantErr:    storage.ErrIdempotencyKeyTaken,
+			wantStatus: storage.IdempotencyCompleted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("failed to create mock pool: %v", err)
+			}
+			defer mock.Close()
+			tt.setupMock(mock)
+
+			store := &storage.PgStorage{DB: mock}
+			key := &storage.IdempotencyKey{WorkflowID: testWfID, Key: "retry-1", RequestHash: "hash", CreatedAt: testNow, LockedUntil: lockedUntil, ExpiresAt: expiresAt}
+			got, err := store.ClaimIdempotencyKey(context.Background(), key)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if got.Status != tt.wantStatus {
+				t.Errorf("expected status %q, got %+v", tt.wantStatus, got)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	t.Parallel()
+	keyID := uuid.MustParse("8f0f3e0e-6f0a-4a55-9a3e-2b8f1d4c2a10")
+	columns := []string{"id", "name", "prefix", "key_hash", "role", "workspace_id", "created_by", "created_at", "revoked_at"}
+
+	tests := []struct {
+		name      string
+		setupMock func(mock pgxmock.PgxPoolIface)
+		wantErr   error
+	}{
+		{
+			name: "revokes the key",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				revokedAt := testNow
+				mock.ExpectQuery(`UPDATE api_keys\s+SET revoked_at = COALESCE\(revoked_at, \$2\)`).
+					WithArgs(keyID, testNow).
+					WillReturnRows(pgxmock.NewRows(columns).AddRow(keyID, "ci", "wfk_0123abcd", "hash", "editor", "", "admin", testNow, &revokedAt))
+			},
+		},
+		{
+			name: "unknown key",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`UPDATE api_keys`).
+					WithArgs(keyID, testNow).
+					WillReturnError(pgx.ErrNoRows)
+			},
+			wantErr: pgx.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("failed to create mock pool: %v", err)
+			}
+			defer mock.Close()
+			tt.setupMock(mock)
+
+			store := &storage.PgStorage{DB: mock}
+			got, err := store.RevokeAPIKey(context.Background(), keyID, testNow)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && (got.RevokedAt == nil || got.Prefix != "wfk_0123abcd") {
+				t.Errorf("expected the revoked key, got %+v", got)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestListAuditEvents(t *testing.T) {
+	t.Parallel()
+	since := testNow.Add(-time.Hour)
+	columns := []string{"id", "workspace_id", "occurred_at", "actor", "action", "target_type", "target_id", "request_id", "diff"}
+
+	tests := []struct {
+		name      string
+		filter    storage.AuditFilter
+		setupMock func(mock pgxmock.PgxPoolIface)
+		wantCount int
+	}{
+		{
+			name: "without filters lists every event",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`FROM audit_events\s+WHERE workspace_id = \$1\s+ORDER BY id DESC$`).
+					WithArgs("team-a").
+					WillReturnRows(pgxmock.NewRows(columns).
+						AddRow(int64(2), "team-a", testNow, "alice", storage.AuditWorkflowUpdate, storage.AuditTargetWorkflow, testWfID.String(), "req-2", json.RawMessage(`{}`)).
+						AddRow(int64(1), "team-a", testNow, "alice", storage.AuditWorkflowCreate, storage.AuditTargetWorkflow, testWfID.String(), "req-1", json.RawMessage(`{}`)))
+			},
+			wantCount: 2,
+		},
+		{
+			name: "filters are numbered in order",
+			filter: storage.AuditFilter{
+				TargetType: storage.AuditTargetWorkflow,
+				TargetID:   testWfID.String(),
+				Actor:      "alice",
+				Since:      &since,
+				BeforeID:   10,
+				Limit:      5,
+			},
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`WHERE workspace_id = \$1 AND target_type = \$2 AND target_id = \$3 AND actor = \$4 AND occurred_at >= \$5 `+
+					`AND id < \$6\s+ORDER BY id DESC\s+LIMIT \$7`).
+					WithArgs("team-a", storage.AuditTargetWorkflow, testWfID.String(), "alice", &since, int64(10), 5).
+					WillReturnRows(pgxmock.NewRows(columns).
+						AddRow(int64(9), "team-a", testNow, "alice", storage.AuditWorkflowPublish, storage.AuditTargetWorkflow, testWfID.String(), "req-9", json.RawMessage(`{}`)))
+			},
+			wantCount: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("failed to create mock pool: %v", err)
+			}
+			defer mock.Close()
+			tt.setupMock(mock)
+
+			store := &storage.PgStorage{DB: mock}
+			events, err := store.ListAuditEvents(storage.WithWorkspace(context.Background(), "team-a"), tt.filter)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(events) != tt.wantCount {
+				t.Errorf("expected %d events, got %d", tt.wantCount, len(events))
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestCreateWorkspace(t *testing.T) {
+	t.Parallel()
+
+	limit := 10
+	tests := []struct {
+		name      string
+		setupMock func(mock pgxmock.PgxPoolIface)
+		wantErr   error
+	}{
+		{
+			name: "stores the workspace and fills in CreatedAt",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`INSERT INTO workspaces \(id, name, max_workflows, max_runs_per_hour\)`).
+					WithArgs("team-a", "Team A", &limit, (*int)(nil)).
+					WillReturnRows(pgxmock.NewRows([]string{"created_at"}).AddRow(testNow))
+			},
+		},
+		{
+			name: "returns ErrWorkspaceExists when the id is taken",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectQuery(`INSERT INTO workspaces`).
+					WithArgs("team-a", "Team A", &limit, (*int)(nil)).
+					WillReturnError(&pgconn.PgError{Code: "23505"})
+			},
+			wantErr: storage.ErrWorkspaceExists,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("failed to create mock pool: %v", err)
+			}
+			defer mock.Close()
+			tt.setupMock(mock)
+
+			store := &storage.PgStorage{DB: mock}
+			ws := &storage.Workspace{ID: "team-a", Name: "Team A", MaxWorkflows: &limit}
+			err = store.CreateWorkspace(context.Background(), ws)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr == nil && !ws.CreatedAt.Equal(testNow) {
+				t.Errorf("expected CreatedAt from RETURNING, got %v", ws.CreatedAt)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestPutSecret(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		inserted    bool
+		wantCreated bool
+		wantAction  string
+	}{
+		{name: "records a create for a new name", inserted: true, wantCreated: true, wantAction: storage.AuditSecretCreate},
+		{name: "records an update for an existing name", inserted: false, wantCreated: false, wantAction: storage.AuditSecretUpdate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("failed to create mock pool: %v", err)
+			}
+			defer mock.Close()
+
+			mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+			mock.ExpectQuery(`INSERT INTO secrets \(workspace_id, name, ciphertext, updated_by\)`).
+				WithArgs(storage.DefaultWorkspaceID, "API_KEY", []byte("sealed"), "alice").
+				WillReturnRows(pgxmock.NewRows([]string{"created_at", "modified_at", "inserted"}).AddRow(testNow, testNow, tt.inserted))
+			mock.ExpectExec(`INSERT INTO audit_events`).
+				WithArgs(storage.DefaultWorkspaceID, "", tt.wantAction, storage.AuditTargetSecret, "API_KEY", "", pgxmock.AnyArg()).
+				WillReturnResult(pgxmock.NewResult("INSERT", 1))
+			mock.ExpectCommit()
+
+			store := &storage.PgStorage{DB: mock}
+			sec := &storage.Secret{Name: "API_KEY", Ciphertext: []byte("sealed"), UpdatedBy: "alice"}
+			created, err := store.PutSecret(context.Background(), sec)
+			if err != nil {
+				t.Fatalf("PutSecret: %v", err)
+			}
+			if created != tt.wantCreated || !sec.ModifiedAt.Equal(testNow) {
+				t.Errorf("expected created=%v with times from RETURNING, got %v, %+v", tt.wantCreated, created, sec)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestDeleteSecret(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		setupMock func(mock pgxmock.PgxPoolIface)
+		wantErr   error
+	}{
+		{
+			name: "deletes the secret and records it",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+				mock.ExpectExec(`DELETE FROM secrets`).
+					WithArgs(storage.DefaultWorkspaceID, "API_KEY").
+					WillReturnResult(pgxmock.NewResult("DELETE", 1))
+				mock.ExpectExec(`INSERT INTO audit_events`).
+					WithArgs(storage.DefaultWorkspaceID, "", storage.AuditSecretDelete, storage.AuditTargetSecret, "API_KEY", "", pgxmock.AnyArg()).
+					WillReturnResult(pgxmock.NewResult("INSERT", 1))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name: "returns ErrNoRows when the secret does not exist",
+			setupMock: func(mock pgxmock.PgxPoolIface) {
+				mock.ExpectBeginTx(pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+				mock.ExpectExec(`DELETE FROM secrets`).
+					WithArgs(storage.DefaultWorkspaceID, "API_KEY").
+					WillReturnResult(pgxmock.NewResult("DELETE", 0))
+				mock.ExpectRollback()
+			},
+			wantErr: pgx.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatalf("failed to create mock pool: %v", err)
+			}
+			defer mock.Close()
+			tt.setupMock(mock)
+
+			store := &storage.PgStorage{DB: mock}
+			if err := store.DeleteSecret(context.Background(), "API_KEY"); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet mock expectations: %v", err)
+			}
+		})
+	}
+}
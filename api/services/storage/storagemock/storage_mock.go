@@ -11,11 +11,59 @@ import (
 )
 
 type StorageMock struct {
-	GetWorkflowMock      func(ctx context.Context, id uuid.UUID) (*storage.Workflow, error)
-	UpsertWorkflowMock   func(ctx context.Context, wf *storage.Workflow) error
-	DeleteWorkflowMock   func(ctx context.Context, id uuid.UUID) error
-	PublishWorkflowMock  func(ctx context.Context, id uuid.UUID) (*storage.WorkflowSnapshot, error)
+	GetWorkflowMock       func(ctx context.Context, id uuid.UUID) (*storage.Workflow, error)
+	UpsertWorkflowMock    func(ctx context.Context, wf *storage.Workflow) error
+	ImportWorkflowMock    func(ctx context.Context, wf *storage.Workflow, entries []storage.NodeLibraryEntry) error
+	DeleteWorkflowMock    func(ctx context.Context, id uuid.UUID) error
+	PublishWorkflowMock   func(ctx context.Context, id uuid.UUID) (*storage.WorkflowSnapshot, error)
 	GetActiveSnapshotMock func(ctx context.Context, workflowID uuid.UUID) (*storage.WorkflowSnapshot, error)
+	GetSnapshotMock       func(ctx context.Context, workflowID uuid.UUID, version int) (*storage.WorkflowSnapshot, error)
+
+	ListNodeLibraryMock        func(ctx context.Context) ([]storage.NodeLibraryEntry, error)
+	CreateNodeLibraryEntryMock func(ctx context.Context, entry *storage.NodeLibraryEntry) error
+
+	ListTestCasesMock    func(ctx context.Context, workflowID uuid.UUID) ([]storage.TestCase, error)
+	ReplaceTestCasesMock func(ctx context.Context, workflowID uuid.UUID, cases []storage.TestCase) error
+
+	CreateRunMock func(ctx context.Context, run *storage.Run) error
+	GetRunMock    func(ctx context.Context, workflowID, runID uuid.UUID) (*storage.Run, error)
+	UpdateRunMock func(ctx context.Context, run *storage.Run) error
+
+	ClaimDueRunsMock func(ctx context.Context, now, retryAt time.Time, limit int) ([]storage.Run, error)
+	ListRunsMock     func(ctx context.Context, filter storage.RunFilter) ([]storage.Run, error)
+	RunStatsMock     func(ctx context.Context, filter storage.RunFilter) (*storage.RunStats, error)
+
+	ListRetentionPoliciesMock func(ctx context.Context) ([]storage.WorkflowRetention, error)
+	PruneRunsMock             func(ctx context.Context, filter storage.RunPruneFilter, limit int, archive func([]storage.Run) error) (int, error)
+
+	CreateTaskMock   func(ctx context.Context, task *storage.Task) error
+	GetTaskMock      func(ctx context.Context, id uuid.UUID) (*storage.Task, error)
+	ListTasksMock    func(ctx context.Context, filter storage.TaskFilter) ([]storage.Task, error)
+	CompleteTaskMock func(ctx context.Context, id uuid.UUID, status string, response json.RawMessage, by string, retryAt time.Time) (*storage.Task, error)
+
+	ClaimIdempotencyKeyMock          func(ctx context.Context, key *storage.IdempotencyKey) (*storage.IdempotencyKey, error)
+	CompleteIdempotencyKeyMock       func(ctx context.Context, key *storage.IdempotencyKey) error
+	ReleaseIdempotencyKeyMock        func(ctx context.Context, key *storage.IdempotencyKey) error
+	DeleteExpiredIdempotencyKeysMock func(ctx context.Context, now time.Time) (int, error)
+
+	CreateAPIKeyMock      func(ctx context.Context, key *storage.APIKey) error
+	GetAPIKeyByPrefixMock func(ctx context.Context, prefix string) (*storage.APIKey, error)
+	ListAPIKeysMock       func(ctx context.Context) ([]storage.APIKey, error)
+	RevokeAPIKeyMock      func(ctx context.Context, id uuid.UUID, at time.Time) (*storage.APIKey, error)
+
+	ListAuditEventsMock func(ctx context.Context, filter storage.AuditFilter) ([]storage.AuditEvent, error)
+
+	GetWorkspaceMock    func(ctx context.Context, id string) (*storage.Workspace, error)
+	ListWorkspacesMock  func(ctx context.Context) ([]storage.Workspace, error)
+	CreateWorkspaceMock func(ctx context.Context, ws *storage.Workspace) error
+	UpdateWorkspaceMock func(ctx context.Context, ws *storage.Workspace) error
+
+	PutSecretMock    func(ctx context.Context, secret *storage.Secret) (bool, error)
+	GetSecretMock    func(ctx context.Context, name string) (*storage.Secret, error)
+	ListSecretsMock  func(ctx context.Context) ([]storage.Secret, error)
+	DeleteSecretMock func(ctx context.Context, name string) error
+
+	ListExecutionLimitsMock func(ctx context.Context) ([]storage.ExecutionLimit, error)
 }
 
 func (m *StorageMock) GetWorkflow(ctx context.Context, wfUUID uuid.UUID) (*storage.Workflow, error) {
@@ -49,6 +97,13 @@ func (m *StorageMock) UpsertWorkflow(ctx context.Context, wf *storage.Workflow)
 	return nil
 }
 
+func (m *StorageMock) ImportWorkflow(ctx context.Context, wf *storage.Workflow, entries []storage.NodeLibraryEntry) error {
+	if m != nil && m.ImportWorkflowMock != nil {
+		return m.ImportWorkflowMock(ctx, wf, entries)
+	}
+	return nil
+}
+
 func (m *StorageMock) DeleteWorkflow(ctx context.Context, wfUUID uuid.UUID) error {
 	if m != nil && m.DeleteWorkflowMock != nil {
 		return m.DeleteWorkflowMock(ctx, wfUUID)
@@ -77,3 +132,264 @@ func (m *StorageMock) GetActiveSnapshot(ctx context.Context, workflowID uuid.UUI
 	// Default: no snapshot (draft workflow) — existing execute tests fall through to GetWorkflow
 	return nil, pgx.ErrNoRows
 }
+
+func (m *StorageMock) GetSnapshot(ctx context.Context, workflowID uuid.UUID, version int) (*storage.WorkflowSnapshot, error) {
+	if m != nil && m.GetSnapshotMock != nil {
+		return m.GetSnapshotMock(ctx, workflowID, version)
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (m *StorageMock) ListNodeLibrary(ctx context.Context) ([]storage.NodeLibraryEntry, error) {
+	if m != nil && m.ListNodeLibraryMock != nil {
+		return m.ListNodeLibraryMock(ctx)
+	}
+	return []storage.NodeLibraryEntry{}, nil
+}
+
+func (m *StorageMock) CreateNodeLibraryEntry(ctx context.Context, entry *storage.NodeLibraryEntry) error {
+	if m != nil && m.CreateNodeLibraryEntryMock != nil {
+		return m.CreateNodeLibraryEntryMock(ctx, entry)
+	}
+	if entry.ID == "" {
+		entry.ID = uuid.NewString()
+	}
+	entry.ModifiedAt = time.Now()
+	return nil
+}
+
+func (m *StorageMock) ListTestCases(ctx context.Context, workflowID uuid.UUID) ([]storage.TestCase, error) {
+	if m != nil && m.ListTestCasesMock != nil {
+		return m.ListTestCasesMock(ctx, workflowID)
+	}
+	return []storage.TestCase{}, nil
+}
+
+func (m *StorageMock) ReplaceTestCases(ctx context.Context, workflowID uuid.UUID, cases []storage.TestCase) error {
+	if m != nil && m.ReplaceTestCasesMock != nil {
+		return m.ReplaceTestCasesMock(ctx, workflowID, cases)
+	}
+	now := time.Now()
+	for i := range cases {
+		cases[i].ModifiedAt = now
+	}
+	return nil
+}
+
+func (m *StorageMock) CreateRun(ctx context.Context, run *storage.Run) error {
+	if m != nil && m.CreateRunMock != nil {
+		return m.CreateRunMock(ctx, run)
+	}
+	run.CreatedAt = time.Now()
+	return nil
+}
+
+func (m *StorageMock) GetRun(ctx context.Context, workflowID, runID uuid.UUID) (*storage.Run, error) {
+	if m != nil && m.GetRunMock != nil {
+		return m.GetRunMock(ctx, workflowID, runID)
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (m *StorageMock) UpdateRun(ctx context.Context, run *storage.Run) error {
+	if m != nil && m.UpdateRunMock != nil {
+		return m.UpdateRunMock(ctx, run)
+	}
+	return nil
+}
+
+func (m *StorageMock) ClaimDueRuns(ctx context.Context, now, retryAt time.Time, limit int) ([]storage.Run, error) {
+	if m != nil && m.ClaimDueRunsMock != nil {
+		return m.ClaimDueRunsMock(ctx, now, retryAt, limit)
+	}
+	return []storage.Run{}, nil
+}
+
+func (m *StorageMock) ListRuns(ctx context.Context, filter storage.RunFilter) ([]storage.Run, error) {
+	if m != nil && m.ListRunsMock != nil {
+		return m.ListRunsMock(ctx, filter)
+	}
+	return []storage.Run{}, nil
+}
+
+func (m *StorageMock) RunStats(ctx context.Context, filter storage.RunFilter) (*storage.RunStats, error) {
+	if m != nil && m.RunStatsMock != nil {
+		return m.RunStatsMock(ctx, filter)
+	}
+	return &storage.RunStats{ByStatus: map[string]int{}, FailingNodes: []storage.NodeFailures{}}, nil
+}
+
+func (m *StorageMock) ListRetentionPolicies(ctx context.Context) ([]storage.WorkflowRetention, error) {
+	if m != nil && m.ListRetentionPoliciesMock != nil {
+		return m.ListRetentionPoliciesMock(ctx)
+	}
+	return []storage.WorkflowRetention{}, nil
+}
+
+func (m *StorageMock) PruneRuns(ctx context.Context, filter storage.RunPruneFilter, limit int, archive func([]storage.Run) error) (int, error) {
+	if m != nil && m.PruneRunsMock != nil {
+		return m.PruneRunsMock(ctx, filter, limit, archive)
+	}
+	return 0, nil
+}
+
+func (m *StorageMock) CreateTask(ctx context.Context, task *storage.Task) error {
+	if m != nil && m.CreateTaskMock != nil {
+		return m.CreateTaskMock(ctx, task)
+	}
+	task.Status = storage.TaskPending
+	task.CreatedAt = time.Now()
+	return nil
+}
+
+func (m *StorageMock) GetTask(ctx context.Context, id uuid.UUID) (*storage.Task, error) {
+	if m != nil && m.GetTaskMock != nil {
+		return m.GetTaskMock(ctx, id)
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (m *StorageMock) ListTasks(ctx context.Context, filter storage.TaskFilter) ([]storage.Task, error) {
+	if m != nil && m.ListTasksMock != nil {
+		return m.ListTasksMock(ctx, filter)
+	}
+	return []storage.Task{}, nil
+}
+
+func (m *StorageMock) CompleteTask(ctx context.Context, id uuid.UUID, status string, response json.RawMessage, by string, retryAt time.Time) (*storage.Task, error) {
+	if m != nil && m.CompleteTaskMock != nil {
+		return m.CompleteTaskMock(ctx, id, status, response, by, retryAt)
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (m *StorageMock) ClaimIdempotencyKey(ctx context.Context, key *storage.IdempotencyKey) (*storage.IdempotencyKey, error) {
+	if m != nil && m.ClaimIdempotencyKeyMock != nil {
+		return m.ClaimIdempotencyKeyMock(ctx, key)
+	}
+	key.Status = storage.IdempotencyInProgress
+	return key, nil
+}
+
+func (m *StorageMock) CompleteIdempotencyKey(ctx context.Context, key *storage.IdempotencyKey) error {
+	if m != nil && m.CompleteIdempotencyKeyMock != nil {
+		return m.CompleteIdempotencyKeyMock(ctx, key)
+	}
+	key.Status = storage.IdempotencyCompleted
+	return nil
+}
+
+func (m *StorageMock) ReleaseIdempotencyKey(ctx context.Context, key *storage.IdempotencyKey) error {
+	if m != nil && m.ReleaseIdempotencyKeyMock != nil {
+		return m.ReleaseIdempotencyKeyMock(ctx, key)
+	}
+	return nil
+}
+
+func (m *StorageMock) DeleteExpiredIdempotencyKeys(ctx context.Context, now time.Time) (int, error) {
+	if m != nil && m.DeleteExpiredIdempotencyKeysMock != nil {
+		return m.DeleteExpiredIdempotencyKeysMock(ctx, now)
+	}
+	return 0, nil
+}
+
+func (m *StorageMock) CreateAPIKey(ctx context.Context, key *storage.APIKey) error {
+	if m != nil && m.CreateAPIKeyMock != nil {
+		return m.CreateAPIKeyMock(ctx, key)
+	}
+	key.CreatedAt = time.Now()
+	return nil
+}
+
+func (m *StorageMock) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*storage.APIKey, error) {
+	if m != nil && m.GetAPIKeyByPrefixMock != nil {
+		return m.GetAPIKeyByPrefixMock(ctx, prefix)
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (m *StorageMock) ListAPIKeys(ctx context.Context) ([]storage.APIKey, error) {
+	if m != nil && m.ListAPIKeysMock != nil {
+		return m.ListAPIKeysMock(ctx)
+	}
+	return []storage.APIKey{}, nil
+}
+
+func (m *StorageMock) RevokeAPIKey(ctx context.Context, id uuid.UUID, at time.Time) (*storage.APIKey, error) {
+	if m != nil && m.RevokeAPIKeyMock != nil {
+		return m.RevokeAPIKeyMock(ctx, id, at)
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (m *StorageMock) ListAuditEvents(ctx context.Context, filter storage.AuditFilter) ([]storage.AuditEvent, error) {
+	if m != nil && m.ListAuditEventsMock != nil {
+		return m.ListAuditEventsMock(ctx, filter)
+	}
+	return []storage.AuditEvent{}, nil
+}
+
+func (m *StorageMock) GetWorkspace(ctx context.Context, id string) (*storage.Workspace, error) {
+	if m != nil && m.GetWorkspaceMock != nil {
+		return m.GetWorkspaceMock(ctx, id)
+	}
+	return &storage.Workspace{ID: id, Name: id, CreatedAt: time.Now()}, nil
+}
+
+func (m *StorageMock) ListWorkspaces(ctx context.Context) ([]storage.Workspace, error) {
+	if m != nil && m.ListWorkspacesMock != nil {
+		return m.ListWorkspacesMock(ctx)
+	}
+	return []storage.Workspace{{ID: storage.DefaultWorkspaceID, Name: "Default"}}, nil
+}
+
+func (m *StorageMock) CreateWorkspace(ctx context.Context, ws *storage.Workspace) error {
+	if m != nil && m.CreateWorkspaceMock != nil {
+		return m.CreateWorkspaceMock(ctx, ws)
+	}
+	ws.CreatedAt = time.Now()
+	return nil
+}
+
+func (m *StorageMock) UpdateWorkspace(ctx context.Context, ws *storage.Workspace) error {
+	if m != nil && m.UpdateWorkspaceMock != nil {
+		return m.UpdateWorkspaceMock(ctx, ws)
+	}
+	return nil
+}
+
+func (m *StorageMock) PutSecret(ctx context.Context, secret *storage.Secret) (bool, error) {
+	if m != nil && m.PutSecretMock != nil {
+		return m.PutSecretMock(ctx, secret)
+	}
+	secret.CreatedAt, secret.ModifiedAt = time.Now(), time.Now()
+	return true, nil
+}
+
+func (m *StorageMock) GetSecret(ctx context.Context, name string) (*storage.Secret, error) {
+	if m != nil && m.GetSecretMock != nil {
+		return m.GetSecretMock(ctx, name)
+	}
+	return nil, pgx.ErrNoRows
+}
+
+func (m *StorageMock) ListSecrets(ctx context.Context) ([]storage.Secret, error) {
+	if m != nil && m.ListSecretsMock != nil {
+		return m.ListSecretsMock(ctx)
+	}
+	return []storage.Secret{}, nil
+}
+
+func (m *StorageMock) DeleteSecret(ctx context.Context, name string) error {
+	if m != nil && m.DeleteSecretMock != nil {
+		return m.DeleteSecretMock(ctx, name)
+	}
+	return nil
+}
+
+func (m *StorageMock) ListExecutionLimits(ctx context.Context) ([]storage.ExecutionLimit, error) {
+	if m != nil && m.ListExecutionLimitsMock != nil {
+		return m.ListExecutionLimitsMock(ctx)
+	}
+	return []storage.ExecutionLimit{}, nil
+}
@@ -0,0 +1,1531 @@
+// Package storagetest provides a conformance suite that every storage.Storage
+// implementation must pass. Implementation tests call Run with a factory that
+// returns a store containing the seed fixtures (storage.SeedFixtures for the
+// memory store, the Flyway migrations for Postgres).
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"workflow-code-test/api/services/storage"
+)
+
+// Factory returns a seeded store. It is called once per subtest; stores may
+// be shared between calls since every subtest works on fresh workflow IDs.
+type Factory func(t *testing.T) storage.Storage
+
+// Run exercises the storage.Storage contract against the store returned by newStore.
+func Run(t *testing.T, newStore Factory) {
+	t.Helper()
+
+	t.Run("GetWorkflow returns seeded workflow", func(t *testing.T) {
+		store := newStore(t)
+		wf, err := store.GetWorkflow(context.Background(), storage.SeedWeatherWorkflowID)
+		if err != nil {
+			t.Fatalf("GetWorkflow: %v", err)
+		}
+		if wf.Name != "Weather Check System" {
+			t.Errorf("expected name 'Weather Check System', got %q", wf.Name)
+		}
+		if got := nodeIDs(wf.Nodes); !equalStrings(got, []string{"condition", "email", "end", "form", "start", "weather-api"}) {
+			t.Errorf("unexpected node IDs %v", got)
+		}
+		if len(wf.Edges) != 6 {
+			t.Errorf("expected 6 edges, got %d", len(wf.Edges))
+		}
+		for _, n := range wf.Nodes {
+			if n.ID == "weather-api" && n.Type != "integration" {
+				t.Errorf("expected weather-api to hydrate as integration, got %q", n.Type)
+			}
+		}
+	})
+
+	t.Run("GetWorkflow unknown ID returns ErrNoRows", func(t *testing.T) {
+		store := newStore(t)
+		_, err := store.GetWorkflow(context.Background(), uuid.New())
+		if !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected pgx.ErrNoRows, got %v", err)
+		}
+	})
+
+	t.Run("UpsertWorkflow round-trips nodes and edges", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		wf := sampleWorkflow(uuid.New())
+
+		if err := store.UpsertWorkflow(ctx, wf); err != nil {
+			t.Fatalf("UpsertWorkflow: %v", err)
+		}
+		if wf.CreatedAt.IsZero() || wf.ModifiedAt.IsZero() {
+			t.Error("expected UpsertWorkflow to set timestamps")
+		}
+
+		got, err := store.GetWorkflow(ctx, wf.ID)
+		if err != nil {
+			t.Fatalf("GetWorkflow: %v", err)
+		}
+		if got.Name != wf.Name {
+			t.Errorf("expected name %q, got %q", wf.Name, got.Name)
+		}
+		if got.Status != "draft" {
+			t.Errorf("expected status draft, got %q", got.Status)
+		}
+		if gotIDs := nodeIDs(got.Nodes); !equalStrings(gotIDs, []string{"end", "start"}) {
+			t.Errorf("unexpected node IDs %v", gotIDs)
+		}
+		for _, n := range got.Nodes {
+			if n.ID == "end" && (n.Position.X != 300 || n.Position.Y != 40) {
+				t.Errorf("expected end at (300, 40), got (%v, %v)", n.Position.X, n.Position.Y)
+			}
+		}
+		if len(got.Edges) != 1 {
+			t.Fatalf("expected 1 edge, got %d", len(got.Edges))
+		}
+		e := got.Edges[0]
+		if e.Source != "start" || e.Target != "end" || !e.Animated {
+			t.Errorf("unexpected edge %+v", e)
+		}
+		if e.Label == nil || *e.Label != "Go" {
+			t.Errorf("expected label 'Go', got %v", e.Label)
+		}
+		if !jsonEqual(e.Style, json.RawMessage(`{"stroke":"#10b981"}`)) {
+			t.Errorf("unexpected edge style %s", e.Style)
+		}
+	})
+
+	t.Run("UpsertWorkflow replaces children on re-save", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		wf := sampleWorkflow(uuid.New())
+		if err := store.UpsertWorkflow(ctx, wf); err != nil {
+			t.Fatalf("UpsertWorkflow: %v", err)
+		}
+		createdAt := wf.CreatedAt
+
+		wf.Name = "Renamed"
+		wf.Nodes = wf.Nodes[:1]
+		wf.Edges = nil
+		if err := store.UpsertWorkflow(ctx, wf); err != nil {
+			t.Fatalf("second UpsertWorkflow: %v", err)
+		}
+
+		got, err := store.GetWorkflow(ctx, wf.ID)
+		if err != nil {
+			t.Fatalf("GetWorkflow: %v", err)
+		}
+		if got.Name != "Renamed" {
+			t.Errorf("expected name 'Renamed', got %q", got.Name)
+		}
+		if len(got.Nodes) != 1 || len(got.Edges) != 0 {
+			t.Errorf("expected 1 node and 0 edges, got %d and %d", len(got.Nodes), len(got.Edges))
+		}
+		// Postgres stores microseconds, so allow for rounding.
+		if d := got.CreatedAt.Sub(createdAt); d > time.Millisecond || d < -time.Millisecond {
+			t.Errorf("expected created_at %v to be preserved, got %v", createdAt, got.CreatedAt)
+		}
+	})
+
+	t.Run("UpsertWorkflow rejects unknown node type", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		wf := sampleWorkflow(uuid.New())
+		wf.Nodes = append(wf.Nodes, storage.Node{ID: "mystery", Type: "mystery"})
+
+		if err := store.UpsertWorkflow(ctx, wf); err == nil {
+			t.Fatal("expected error for unknown node type, got nil")
+		}
+		if _, err := store.GetWorkflow(ctx, wf.ID); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected failed upsert to leave no workflow, got %v", err)
+		}
+	})
+
+	t.Run("DeleteWorkflow soft-deletes and re-save restores", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		wf := sampleWorkflow(uuid.New())
+		if err := store.UpsertWorkflow(ctx, wf); err != nil {
+			t.Fatalf("UpsertWorkflow: %v", err)
+		}
+
+		if err := store.DeleteWorkflow(ctx, wf.ID); err != nil {
+			t.Fatalf("DeleteWorkflow: %v", err)
+		}
+		if _, err := store.GetWorkflow(ctx, wf.ID); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected deleted workflow to be hidden, got %v", err)
+		}
+		if _, err := store.PublishWorkflow(ctx, wf.ID); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected publish of deleted workflow to return ErrNoRows, got %v", err)
+		}
+
+		if err := store.UpsertWorkflow(ctx, wf); err != nil {
+			t.Fatalf("re-save UpsertWorkflow: %v", err)
+		}
+		got, err := store.GetWorkflow(ctx, wf.ID)
+		if err != nil {
+			t.Fatalf("expected re-saved workflow to be visible: %v", err)
+		}
+		if len(got.Nodes) != 2 {
+			t.Errorf("expected 2 nodes after re-save, got %d", len(got.Nodes))
+		}
+	})
+
+	t.Run("DeleteWorkflow unknown ID returns ErrNoRows", func(t *testing.T) {
+		store := newStore(t)
+		if err := store.DeleteWorkflow(context.Background(), uuid.New()); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected pgx.ErrNoRows, got %v", err)
+		}
+	})
+
+	t.Run("PublishWorkflow versions snapshots and freezes the DAG", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		wf := sampleWorkflow(uuid.New())
+		if err := store.UpsertWorkflow(ctx, wf); err != nil {
+			t.Fatalf("UpsertWorkflow: %v", err)
+		}
+
+		if _, err := store.GetActiveSnapshot(ctx, wf.ID); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected draft to have no active snapshot, got %v", err)
+		}
+
+		first, err := store.PublishWorkflow(ctx, wf.ID)
+		if err != nil {
+			t.Fatalf("PublishWorkflow: %v", err)
+		}
+		if first.VersionNumber != 1 {
+			t.Errorf("expected version 1, got %d", first.VersionNumber)
+		}
+		if first.PublishedAt.IsZero() {
+			t.Error("expected published_at to be set")
+		}
+
+		// Editing the draft must not change the published snapshot.
+		wf.Nodes = wf.Nodes[:1]
+		wf.Edges = nil
+		if err := store.UpsertWorkflow(ctx, wf); err != nil {
+			t.Fatalf("UpsertWorkflow after publish: %v", err)
+		}
+		active, err := store.GetActiveSnapshot(ctx, wf.ID)
+		if err != nil {
+			t.Fatalf("GetActiveSnapshot: %v", err)
+		}
+		if active.ID != first.ID || len(active.DagData.Nodes) != 2 || len(active.DagData.Edges) != 1 {
+			t.Errorf("expected snapshot v1 with 2 nodes and 1 edge, got v%d with %d nodes and %d edges",
+				active.VersionNumber, len(active.DagData.Nodes), len(active.DagData.Edges))
+		}
+
+		second, err := store.PublishWorkflow(ctx, wf.ID)
+		if err != nil {
+			t.Fatalf("second PublishWorkflow: %v", err)
+		}
+		if second.VersionNumber != 2 {
+			t.Errorf("expected version 2, got %d", second.VersionNumber)
+		}
+
+		got, err := store.GetWorkflow(ctx, wf.ID)
+		if err != nil {
+			t.Fatalf("GetWorkflow: %v", err)
+		}
+		if got.Status != "published" {
+			t.Errorf("expected status published, got %q", got.Status)
+		}
+		if got.ActiveSnapshotID == nil || *got.ActiveSnapshotID != second.ID {
+			t.Errorf("expected active snapshot %s, got %v", second.ID, got.ActiveSnapshotID)
+		}
+	})
+
+	t.Run("workflow settings are saved and frozen on publish", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		wf := sampleWorkflow(uuid.New())
+		wf.Settings.ScopedOutputsOnly = true
+		if err := store.UpsertWorkflow(ctx, wf); err != nil {
+			t.Fatalf("UpsertWorkflow: %v", err)
+		}
+		got, err := store.GetWorkflow(ctx, wf.ID)
+		if err != nil {
+			t.Fatalf("GetWorkflow: %v", err)
+		}
+		if !got.Settings.ScopedOutputsOnly {
+			t.Error("expected scopedOutputsOnly to round-trip")
+		}
+
+		snap, err := store.PublishWorkflow(ctx, wf.ID)
+		if err != nil {
+			t.Fatalf("PublishWorkflow: %v", err)
+		}
+		wf.Settings.ScopedOutputsOnly = false
+		if err := store.UpsertWorkflow(ctx, wf); err != nil {
+			t.Fatalf("UpsertWorkflow after publish: %v", err)
+		}
+		frozen, err := store.GetSnapshot(ctx, wf.ID, snap.VersionNumber)
+		if err != nil {
+			t.Fatalf("GetSnapshot: %v", err)
+		}
+		if !frozen.DagData.Settings.ScopedOutputsOnly {
+			t.Error("expected the snapshot to keep the settings it was published with")
+		}
+	})
+
+	t.Run("PublishWorkflow unknown ID returns ErrNoRows", func(t *testing.T) {
+		store := newStore(t)
+		if _, err := store.PublishWorkflow(context.Background(), uuid.New()); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected pgx.ErrNoRows, got %v", err)
+		}
+	})
+
+	t.Run("GetSnapshot returns a specific version", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		wf := sampleWorkflow(uuid.New())
+		if err := store.UpsertWorkflow(ctx, wf); err != nil {
+			t.Fatalf("UpsertWorkflow: %v", err)
+		}
+		if _, err := store.PublishWorkflow(ctx, wf.ID); err != nil {
+			t.Fatalf("PublishWorkflow: %v", err)
+		}
+		wf.Nodes = wf.Nodes[:1]
+		wf.Edges = nil
+		if err := store.UpsertWorkflow(ctx, wf); err != nil {
+			t.Fatalf("UpsertWorkflow: %v", err)
+		}
+		if _, err := store.PublishWorkflow(ctx, wf.ID); err != nil {
+			t.Fatalf("PublishWorkflow: %v", err)
+		}
+
+		v1, err := store.GetSnapshot(ctx, wf.ID, 1)
+		if err != nil {
+			t.Fatalf("GetSnapshot(1): %v", err)
+		}
+		if v1.VersionNumber != 1 || len(v1.DagData.Nodes) != 2 {
+			t.Errorf("expected v1 with 2 nodes, got v%d with %d nodes", v1.VersionNumber, len(v1.DagData.Nodes))
+		}
+		for _, n := range v1.DagData.Nodes {
+			if n.LibraryID == "" {
+				t.Errorf("expected snapshot node %s to record its library ID", n.ID)
+			}
+		}
+		v2, err := store.GetSnapshot(ctx, wf.ID, 2)
+		if err != nil {
+			t.Fatalf("GetSnapshot(2): %v", err)
+		}
+		if len(v2.DagData.Nodes) != 1 {
+			t.Errorf("expected v2 with 1 node, got %d", len(v2.DagData.Nodes))
+		}
+
+		if _, err := store.GetSnapshot(ctx, wf.ID, 3); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected unknown version to return ErrNoRows, got %v", err)
+		}
+		if _, err := store.GetSnapshot(ctx, uuid.New(), 1); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected unknown workflow to return ErrNoRows, got %v", err)
+		}
+	})
+
+	t.Run("node library entries can be created, listed and pinned", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+
+		// A dedicated node type keeps the new entry from shadowing the seeded
+		// blueprints that unpinned nodes resolve to.
+		entry := &storage.NodeLibraryEntry{
+			NodeType:    "conformance",
+			Label:       "Conformance",
+			Description: "Created by the conformance suite",
+			Metadata:    json.RawMessage(`{"threshold":25,"tags":["a","b"]}`),
+		}
+		if err := store.CreateNodeLibraryEntry(ctx, entry); err != nil {
+			t.Fatalf("CreateNodeLibraryEntry: %v", err)
+		}
+		if _, err := uuid.Parse(entry.ID); err != nil {
+			t.Fatalf("expected generated UUID, got %q", entry.ID)
+		}
+		if err := store.CreateNodeLibraryEntry(ctx, &storage.NodeLibraryEntry{ID: entry.ID, NodeType: "conformance"}); err == nil {
+			t.Error("expected duplicate library ID to be rejected")
+		}
+
+		entries, err := store.ListNodeLibrary(ctx)
+		if err != nil {
+			t.Fatalf("ListNodeLibrary: %v", err)
+		}
+		var found *storage.NodeLibraryEntry
+		for i := range entries {
+			if entries[i].ID == entry.ID {
+				found = &entries[i]
+			}
+		}
+		if found == nil {
+			t.Fatalf("created entry %s not listed", entry.ID)
+		}
+		if found.Label != entry.Label || found.Description != entry.Description || !jsonEqual(found.Metadata, entry.Metadata) {
+			t.Errorf("expected listed entry %+v, got %+v", entry, found)
+		}
+		if len(entries) < len(storage.SeedFixtures().Library) {
+			t.Errorf("expected seeded library entries to be listed, got %d", len(entries))
+		}
+
+		wf := sampleWorkflow(uuid.New())
+		wf.Nodes = append(wf.Nodes, storage.Node{ID: "pinned", Type: "conformance", LibraryID: entry.ID})
+		if err := store.UpsertWorkflow(ctx, wf); err != nil {
+			t.Fatalf("UpsertWorkflow: %v", err)
+		}
+		got, err := store.GetWorkflow(ctx, wf.ID)
+		if err != nil {
+			t.Fatalf("GetWorkflow: %v", err)
+		}
+		for _, n := range got.Nodes {
+			if n.LibraryID == "" {
+				t.Errorf("expected node %s to report its library ID", n.ID)
+			}
+			if n.ID == "pinned" && (n.LibraryID != entry.ID || n.Data.Label != "Conformance") {
+				t.Errorf("expected pinned node hydrated from %s, got %+v", entry.ID, n)
+			}
+		}
+
+		mismatched := sampleWorkflow(uuid.New())
+		mismatched.Nodes[0].LibraryID = entry.ID
+		if err := store.UpsertWorkflow(ctx, mismatched); err == nil {
+			t.Error("expected pinning a start node to a conformance blueprint to fail")
+		}
+	})
+
+	t.Run("unpinned nodes resolve to the global entry of their type, else the oldest", func(t *testing.T) {
+		store := newStore(t)
+		ws := &storage.Workspace{ID: "ws-" + uuid.NewString()[:8], Name: "Conformance"}
+		if err := store.CreateWorkspace(context.Background(), ws); err != nil {
+			t.Fatalf("CreateWorkspace: %v", err)
+		}
+		ctx := storage.WithWorkspace(context.Background(), ws.ID)
+		resolve := func(nodeType string) string {
+			t.Helper()
+			wf := sampleWorkflow(uuid.New())
+			wf.Nodes = append(wf.Nodes, storage.Node{ID: "unpinned", Type: nodeType})
+			if err := store.UpsertWorkflow(ctx, wf); err != nil {
+				t.Fatalf("UpsertWorkflow: %v", err)
+			}
+			got, err := store.GetWorkflow(ctx, wf.ID)
+			if err != nil {
+				t.Fatalf("GetWorkflow: %v", err)
+			}
+			for _, n := range got.Nodes {
+				if n.ID == "unpinned" {
+					return n.LibraryID
+				}
+			}
+			t.Fatalf("node not saved: %+v", got.Nodes)
+			return ""
+		}
+
+		// The workspace's own email blueprint does not replace the global one.
+		var global string
+		for _, e := range storage.SeedFixtures().Library {
+			if e.NodeType == "email" {
+				global = e.ID
+			}
+		}
+		if err := store.CreateNodeLibraryEntry(ctx, &storage.NodeLibraryEntry{NodeType: "email", Label: "Workspace Email"}); err != nil {
+			t.Fatalf("CreateNodeLibraryEntry: %v", err)
+		}
+		for range 3 {
+			if got := resolve("email"); got != global {
+				t.Fatalf("expected the global entry %s, got %s", global, got)
+			}
+		}
+
+		nodeType := "resolve-" + uuid.NewString()[:8]
+		first := &storage.NodeLibraryEntry{NodeType: nodeType, Label: "First"}
+		second := &storage.NodeLibraryEntry{NodeType: nodeType, Label: "Second"}
+		for _, e := range []*storage.NodeLibraryEntry{first, second} {
+			if err := store.CreateNodeLibraryEntry(ctx, e); err != nil {
+				t.Fatalf("CreateNodeLibraryEntry: %v", err)
+			}
+		}
+		for range 3 {
+			if got := resolve(nodeType); got != first.ID {
+				t.Fatalf("expected the oldest entry %s, got %s", first.ID, got)
+			}
+		}
+	})
+
+	t.Run("ImportWorkflow saves entries and workflow together", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+
+		entries := []storage.NodeLibraryEntry{{ID: uuid.NewString(), NodeType: "conformance", Label: "Imported"}}
+		wf := sampleWorkflow(uuid.New())
+		wf.Nodes = append(wf.Nodes, storage.Node{ID: "pinned", Type: "conformance", LibraryID: entries[0].ID})
+		if err := store.ImportWorkflow(ctx, wf, entries); err != nil {
+			t.Fatalf("ImportWorkflow: %v", err)
+		}
+		got, err := store.GetWorkflow(ctx, wf.ID)
+		if err != nil || len(got.Nodes) != 3 {
+			t.Fatalf("expected the imported workflow with its pinned node, got %+v, %v", got, err)
+		}
+
+		// A taken ID, and a workflow that fails to save, write nothing.
+		again := sampleWorkflow(uuid.New())
+		var taken *storage.LibraryIDTakenError
+		err = store.ImportWorkflow(ctx, again, []storage.NodeLibraryEntry{{ID: entries[0].ID, NodeType: "conformance"}})
+		if !errors.As(err, &taken) || taken.ID != entries[0].ID || !errors.Is(err, storage.ErrLibraryIDTaken) {
+			t.Errorf("expected a LibraryIDTakenError for %s, got %v", entries[0].ID, err)
+		}
+		invalid := sampleWorkflow(uuid.New())
+		invalid.Nodes = append(invalid.Nodes, storage.Node{ID: "unknown", Type: "does-not-exist"})
+		orphan := []storage.NodeLibraryEntry{{NodeType: "conformance", Label: "Orphan"}}
+		if err := store.ImportWorkflow(ctx, invalid, orphan); err == nil {
+			t.Error("expected a workflow with an unknown node type to fail")
+		}
+		lib, _ := store.ListNodeLibrary(ctx)
+		if hasLibraryEntry(lib, orphan[0].ID) {
+			t.Errorf("expected the failed import to leave no library entry %s", orphan[0].ID)
+		}
+		for _, id := range []uuid.UUID{again.ID, invalid.ID} {
+			if _, err := store.GetWorkflow(ctx, id); !errors.Is(err, pgx.ErrNoRows) {
+				t.Errorf("expected workflow %s not to be saved, got %v", id, err)
+			}
+		}
+	})
+
+	t.Run("test cases are replaced and listed in order", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		wf := sampleWorkflow(uuid.New())
+		if err := store.UpsertWorkflow(ctx, wf); err != nil {
+			t.Fatalf("UpsertWorkflow: %v", err)
+		}
+
+		cases, err := store.ListTestCases(ctx, wf.ID)
+		if err != nil {
+			t.Fatalf("ListTestCases: %v", err)
+		}
+		if cases == nil || len(cases) != 0 {
+			t.Errorf("expected empty non-nil list, got %#v", cases)
+		}
+
+		first := []storage.TestCase{
+			{Name: "zeta", Definition: json.RawMessage(`{"inputs":{"city":"Sydney"}}`)},
+			{Name: "alpha", Definition: json.RawMessage(`{"expect":{"path":["start","end"]}}`)},
+		}
+		if err := store.ReplaceTestCases(ctx, wf.ID, first); err != nil {
+			t.Fatalf("ReplaceTestCases: %v", err)
+		}
+		if first[0].ModifiedAt.IsZero() {
+			t.Error("expected ModifiedAt to be filled in")
+		}
+		cases, err = store.ListTestCases(ctx, wf.ID)
+		if err != nil {
+			t.Fatalf("ListTestCases: %v", err)
+		}
+		if len(cases) != 2 || cases[0].Name != "zeta" || cases[1].Name != "alpha" {
+			t.Fatalf("expected cases in saved order, got %+v", cases)
+		}
+		if !jsonEqual(cases[0].Definition, first[0].Definition) {
+			t.Errorf("expected definition %s, got %s", first[0].Definition, cases[0].Definition)
+		}
+
+		if err := store.ReplaceTestCases(ctx, wf.ID, []storage.TestCase{{Name: "only", Definition: json.RawMessage(`{}`)}}); err != nil {
+			t.Fatalf("ReplaceTestCases: %v", err)
+		}
+		if cases, _ = store.ListTestCases(ctx, wf.ID); len(cases) != 1 || cases[0].Name != "only" {
+			t.Errorf("expected cases to be replaced, got %+v", cases)
+		}
+
+		dup := []storage.TestCase{{Name: "a", Definition: json.RawMessage(`{}`)}, {Name: "a", Definition: json.RawMessage(`{}`)}}
+		if err := store.ReplaceTestCases(ctx, wf.ID, dup); err == nil {
+			t.Error("expected duplicate test case names to be rejected")
+		}
+		if cases, _ = store.ListTestCases(ctx, wf.ID); len(cases) != 1 || cases[0].Name != "only" {
+			t.Errorf("expected failed replace to keep previous cases, got %+v", cases)
+		}
+
+		if _, err := store.ListTestCases(ctx, uuid.New()); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected unknown workflow to return ErrNoRows, got %v", err)
+		}
+		if err := store.ReplaceTestCases(ctx, uuid.New(), first); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected unknown workflow to return ErrNoRows, got %v", err)
+		}
+	})
+
+	t.Run("runs are recorded and loaded per workflow", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		wf := sampleWorkflow(uuid.New())
+		if err := store.UpsertWorkflow(ctx, wf); err != nil {
+			t.Fatalf("UpsertWorkflow: %v", err)
+		}
+
+		run := &storage.Run{
+			ID:         uuid.New(),
+			WorkflowID: wf.ID,
+			Version:    2,
+			Mode:       "live",
+			Status:     "completed",
+			Inputs:     json.RawMessage(`{"city":"Sydney"}`),
+			Result:     json.RawMessage(`{"status":"completed","steps":[]}`),
+			Calls:      json.RawMessage(`[{"nodeId":"weather-api","client":"weather"}]`),
+		}
+		if err := store.CreateRun(ctx, run); err != nil {
+			t.Fatalf("CreateRun: %v", err)
+		}
+		if run.CreatedAt.IsZero() {
+			t.Error("expected CreatedAt to be filled in")
+		}
+
+		got, err := store.GetRun(ctx, wf.ID, run.ID)
+		if err != nil {
+			t.Fatalf("GetRun: %v", err)
+		}
+		if got.Version != 2 || got.Mode != "live" || got.Status != "completed" {
+			t.Errorf("unexpected run %+v", got)
+		}
+		if !jsonEqual(got.Inputs, run.Inputs) || !jsonEqual(got.Result, run.Result) || !jsonEqual(got.Calls, run.Calls) {
+			t.Errorf("expected JSON columns to round-trip, got %s %s %s", got.Inputs, got.Result, got.Calls)
+		}
+
+		if _, err := store.GetRun(ctx, uuid.New(), run.ID); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected run of another workflow to return ErrNoRows, got %v", err)
+		}
+		if _, err := store.GetRun(ctx, wf.ID, uuid.New()); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected unknown run to return ErrNoRows, got %v", err)
+		}
+		orphan := *run
+		orphan.ID, orphan.WorkflowID = uuid.New(), uuid.New()
+		if err := store.CreateRun(ctx, &orphan); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected unknown workflow to return ErrNoRows, got %v", err)
+		}
+
+		run.Status = "waiting"
+		run.Inputs = json.RawMessage(`{"city":"***"}`)
+		run.State = json.RawMessage(`{"nodeId":"approve"}`)
+		run.Sealed = []byte{0x01, 0x02, 0x03}
+		if err := store.UpdateRun(ctx, run); err != nil {
+			t.Fatalf("UpdateRun: %v", err)
+		}
+		if got, _ := store.GetRun(ctx, wf.ID, run.ID); got == nil || got.Status != "waiting" || !jsonEqual(got.Inputs, run.Inputs) ||
+			!jsonEqual(got.State, run.State) || !bytes.Equal(got.Sealed, run.Sealed) {
+			t.Errorf("expected the update to be saved, got %+v", got)
+		}
+		if err := store.UpdateRun(ctx, &orphan); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected unknown run to return ErrNoRows, got %v", err)
+		}
+	})
+
+	t.Run("runs are listed newest first, paged and aggregated", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		wf := sampleWorkflow(uuid.New())
+		if err := store.UpsertWorkflow(ctx, wf); err != nil {
+			t.Fatalf("UpsertWorkflow: %v", err)
+		}
+
+		newRun := func(status, failedNode string, version int, durationMs int64, inputs string) *storage.Run {
+			run := &storage.Run{
+				ID: uuid.New(), WorkflowID: wf.ID, Version: version, Mode: "live", Status: status,
+				FailedNode: failedNode, DurationMs: durationMs, Inputs: json.RawMessage(inputs),
+				Result: json.RawMessage(`{"steps":[]}`), Calls: json.RawMessage(`[]`),
+			}
+			if err := store.CreateRun(ctx, run); err != nil {
+				t.Fatalf("CreateRun: %v", err)
+			}
+			return run
+		}
+		newRun("completed", "", 1, 100, `{"city":"Sydney","threshold":25}`)
+		newRun("failed", "send-email", 1, 200, `{"city":"Sydney","threshold":30}`)
+		newRun("failed", "send-email", 2, 300, `{"city":"Melbourne","threshold":25}`)
+		newRun("failed", "weather-api", 2, 400, `{"city":"Perth"}`)
+		newRun("waiting", "", 2, 5000, `{"city":"Sydney"}`)
+
+		all, err := store.ListRuns(ctx, storage.RunFilter{WorkflowID: wf.ID})
+		if err != nil {
+			t.Fatalf("ListRuns: %v", err)
+		}
+		if len(all) != 5 {
+			t.Fatalf("expected 5 runs, got %d", len(all))
+		}
+		for i := 1; i < len(all); i++ {
+			if all[i].CreatedAt.After(all[i-1].CreatedAt) {
+				t.Errorf("expected newest first, got %v before %v", all[i-1].CreatedAt, all[i].CreatedAt)
+			}
+		}
+		if all[0].Result != nil || all[0].Calls != nil {
+			t.Errorf("expected listed runs without result and calls, got %+v", all[0])
+		}
+
+		var paged []uuid.UUID
+		filter := storage.RunFilter{WorkflowID: wf.ID, Limit: 2}
+		for range 4 {
+			page, err := store.ListRuns(ctx, filter)
+			if err != nil {
+				t.Fatalf("ListRuns page: %v", err)
+			}
+			for _, run := range page {
+				paged = append(paged, run.ID)
+			}
+			if len(page) < filter.Limit {
+				break
+			}
+			last := page[len(page)-1]
+			filter.Cursor = &storage.RunCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+		}
+		if len(paged) != len(all) {
+			t.Fatalf("expected pages to cover %d runs, got %d", len(all), len(paged))
+		}
+		for i := range all {
+			if paged[i] != all[i].ID {
+				t.Errorf("expected page order to match the list at %d", i)
+			}
+		}
+
+		version := 2
+		count := func(f storage.RunFilter) int {
+			t.Helper()
+			f.WorkflowID = wf.ID
+			runs, err := store.ListRuns(ctx, f)
+			if err != nil {
+				t.Fatalf("ListRuns: %v", err)
+			}
+			return len(runs)
+		}
+		if n := count(storage.RunFilter{Status: "failed"}); n != 3 {
+			t.Errorf("expected 3 failed runs, got %d", n)
+		}
+		if n := count(storage.RunFilter{FailedNode: "send-email"}); n != 2 {
+			t.Errorf("expected 2 runs failed at send-email, got %d", n)
+		}
+		if n := count(storage.RunFilter{Version: &version}); n != 3 {
+			t.Errorf("expected 3 runs of version 2, got %d", n)
+		}
+		if n := count(storage.RunFilter{Inputs: map[string]any{"city": "Sydney"}}); n != 3 {
+			t.Errorf("expected 3 runs for Sydney, got %d", n)
+		}
+		if n := count(storage.RunFilter{Inputs: map[string]any{"city": "Sydney", "threshold": 25}}); n != 1 {
+			t.Errorf("expected 1 run for Sydney at 25, got %d", n)
+		}
+		newest, oldest := all[0].CreatedAt, all[len(all)-1].CreatedAt
+		if n := count(storage.RunFilter{Since: &newest}); n < 1 {
+			t.Errorf("expected since to include runs created at that time, got %d", n)
+		}
+		if n := count(storage.RunFilter{Until: &oldest}); n != 0 {
+			t.Errorf("expected until to exclude runs created at that time, got %d", n)
+		}
+
+		stats, err := store.RunStats(ctx, storage.RunFilter{WorkflowID: wf.ID})
+		if err != nil {
+			t.Fatalf("RunStats: %v", err)
+		}
+		if stats.Total != 5 || stats.ByStatus["completed"] != 1 || stats.ByStatus["failed"] != 3 || stats.ByStatus["waiting"] != 1 {
+			t.Errorf("unexpected counts %+v", stats)
+		}
+		// Durations of the four finished runs: 100, 200, 300, 400.
+		if stats.P50DurationMs != 250 || stats.P95DurationMs != 385 {
+			t.Errorf("expected p50 250 and p95 385, got %v and %v", stats.P50DurationMs, stats.P95DurationMs)
+		}
+		wantNodes := []storage.NodeFailures{{NodeID: "send-email", Failures: 2}, {NodeID: "weather-api", Failures: 1}}
+		if len(stats.FailingNodes) != 2 || stats.FailingNodes[0] != wantNodes[0] || stats.FailingNodes[1] != wantNodes[1] {
+			t.Errorf("expected failing nodes %v, got %v", wantNodes, stats.FailingNodes)
+		}
+
+		empty, err := store.RunStats(ctx, storage.RunFilter{WorkflowID: uuid.New()})
+		if err != nil {
+			t.Fatalf("RunStats: %v", err)
+		}
+		if empty.Total != 0 || empty.P95DurationMs != 0 || len(empty.FailingNodes) != 0 {
+			t.Errorf("expected empty stats for a workflow without runs, got %+v", empty)
+		}
+	})
+
+	t.Run("runs are pruned by retention policy", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+
+		// newWorkflow stores a workflow with runs of the given statuses,
+		// oldest first, and returns them.
+		newWorkflow := func(policy storage.RetentionPolicy, statuses ...string) (*storage.Workflow, []*storage.Run) {
+			t.Helper()
+			wf := sampleWorkflow(uuid.New())
+			wf.Settings.Retention = policy
+			if err := store.UpsertWorkflow(ctx, wf); err != nil {
+				t.Fatalf("UpsertWorkflow: %v", err)
+			}
+			var runs []*storage.Run
+			for _, status := range statuses {
+				run := &storage.Run{
+					ID: uuid.New(), WorkflowID: wf.ID, Mode: "live", Status: status,
+					Inputs: json.RawMessage(`{}`), Result: json.RawMessage(`{"status":"` + status + `"}`), Calls: json.RawMessage(`[]`),
+				}
+				if err := store.CreateRun(ctx, run); err != nil {
+					t.Fatalf("CreateRun: %v", err)
+				}
+				runs = append(runs, run)
+			}
+			return wf, runs
+		}
+		remaining := func(wf *storage.Workflow) []uuid.UUID {
+			t.Helper()
+			runs, err := store.ListRuns(ctx, storage.RunFilter{WorkflowID: wf.ID})
+			if err != nil {
+				t.Fatalf("ListRuns: %v", err)
+			}
+			ids := make([]uuid.UUID, len(runs))
+			for i, run := range runs {
+				ids[len(runs)-1-i] = run.ID // oldest first, like the statuses
+			}
+			return ids
+		}
+
+		kept, _ := newWorkflow(storage.RetentionPolicy{Days: 30, FailedDays: 90}, "completed")
+		policies, err := store.ListRetentionPolicies(ctx)
+		if err != nil {
+			t.Fatalf("ListRetentionPolicies: %v", err)
+		}
+		found := false
+		for _, p := range policies {
+			if p.WorkflowID == kept.ID {
+				found = p.Policy == storage.RetentionPolicy{Days: 30, FailedDays: 90}
+			}
+		}
+		if !found {
+			t.Errorf("expected the workflow's policy to be listed, got %+v", policies)
+		}
+
+		// Keep the newest two runs, a batch of two at a time. The waiting
+		// run is never pruned and does not count.
+		wf, runs := newWorkflow(storage.RetentionPolicy{}, "completed", "failed", "completed", "waiting", "completed", "failed")
+		var archived []uuid.UUID
+		archive := func(batch []storage.Run) error {
+			for _, run := range batch {
+				if len(run.Result) == 0 {
+					t.Errorf("expected archived runs to be whole, got %+v", run)
+				}
+				archived = append(archived, run.ID)
+			}
+			return nil
+		}
+		filter := storage.RunPruneFilter{WorkflowID: wf.ID, KeepNewest: 2}
+		for _, want := range []int{2, 1, 0} {
+			n, err := store.PruneRuns(ctx, filter, 2, archive)
+			if err != nil {
+				t.Fatalf("PruneRuns: %v", err)
+			}
+			if n != want {
+				t.Fatalf("expected batches of 2, 1 and 0, got %d for %d", n, want)
+			}
+		}
+		if want := []uuid.UUID{runs[0].ID, runs[1].ID, runs[2].ID}; !equalUUIDs(archived, want) {
+			t.Errorf("expected the oldest three runs archived oldest first, got %v", archived)
+		}
+		if want := []uuid.UUID{runs[3].ID, runs[4].ID, runs[5].ID}; !equalUUIDs(remaining(wf), want) {
+			t.Errorf("expected the waiting run and the newest two to remain, got %v", remaining(wf))
+		}
+
+		// With a separate limit for failures, failed runs outlive the others.
+		wf, runs = newWorkflow(storage.RetentionPolicy{}, "failed", "completed", "cancelled", "completed")
+		before := runs[3].CreatedAt
+		failedBefore := runs[0].CreatedAt
+		filter = storage.RunPruneFilter{WorkflowID: wf.ID, Before: &before, FailedBefore: &failedBefore}
+		if _, err := store.PruneRuns(ctx, filter, 10, errorArchive); err == nil {
+			t.Error("expected an archive failure to fail the prune")
+		}
+		if got := remaining(wf); len(got) != 4 {
+			t.Fatalf("expected an archive failure to delete nothing, got %v", got)
+		}
+		if n, err := store.PruneRuns(ctx, filter, 10, nil); err != nil || n != 2 {
+			t.Fatalf("expected 2 runs pruned, got %d, %v", n, err)
+		}
+		if want := []uuid.UUID{runs[0].ID, runs[3].ID}; !equalUUIDs(remaining(wf), want) {
+			t.Errorf("expected the failed run and the newest run to remain, got %v", remaining(wf))
+		}
+
+		if n, err := store.PruneRuns(ctx, storage.RunPruneFilter{WorkflowID: kept.ID}, 10, nil); err != nil || n != 0 {
+			t.Errorf("expected a filter without limits to prune nothing, got %d, %v", n, err)
+		}
+	})
+
+	t.Run("due runs are claimed once", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		wf := sampleWorkflow(uuid.New())
+		if err := store.UpsertWorkflow(ctx, wf); err != nil {
+			t.Fatalf("UpsertWorkflow: %v", err)
+		}
+
+		now := time.Now().UTC().Truncate(time.Second)
+		newRun := func(resumeAt *time.Time) *storage.Run {
+			run := &storage.Run{
+				ID: uuid.New(), WorkflowID: wf.ID, Mode: "live", Status: "waiting",
+				Inputs: json.RawMessage(`{}`), Result: json.RawMessage(`{}`), Calls: json.RawMessage(`[]`),
+				State: json.RawMessage(`{"nodeId":"pause"}`), ResumeAt: resumeAt,
+			}
+			if err := store.CreateRun(ctx, run); err != nil {
+				t.Fatalf("CreateRun: %v", err)
+			}
+			return run
+		}
+		earlier, later := now.Add(-2*time.Minute), now.Add(time.Hour)
+		due := newRun(&earlier)
+		newRun(&later)
+		newRun(nil)
+
+		retryAt := now.Add(5 * time.Minute)
+		runs, err := store.ClaimDueRuns(ctx, now, retryAt, 10)
+		if err != nil {
+			t.Fatalf("ClaimDueRuns: %v", err)
+		}
+		if len(runs) != 1 || runs[0].ID != due.ID || runs[0].ResumeAt == nil || !runs[0].ResumeAt.Equal(retryAt) {
+			t.Fatalf("expected only the due run, moved to the retry time, got %+v", runs)
+		}
+		if runs, _ := store.ClaimDueRuns(ctx, now, retryAt, 10); len(runs) != 0 {
+			t.Errorf("expected a claimed run not to be claimed again before its retry time, got %+v", runs)
+		}
+		if runs, _ := store.ClaimDueRuns(ctx, retryAt, retryAt.Add(time.Minute), 10); len(runs) != 1 {
+			t.Errorf("expected an unfinished claim to be retried, got %+v", runs)
+		}
+
+		due.ResumeAt = nil
+		if err := store.UpdateRun(ctx, due); err != nil {
+			t.Fatalf("UpdateRun: %v", err)
+		}
+		if runs, _ := store.ClaimDueRuns(ctx, later, later, 10); len(runs) != 1 || runs[0].ResumeAt == nil {
+			t.Errorf("expected only the later run once its timer is cleared, got %+v", runs)
+		}
+	})
+
+	t.Run("tasks are listed per assignee and completed once", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		wf := sampleWorkflow(uuid.New())
+		if err := store.UpsertWorkflow(ctx, wf); err != nil {
+			t.Fatalf("UpsertWorkflow: %v", err)
+		}
+		run := &storage.Run{ID: uuid.New(), WorkflowID: wf.ID, Mode: "live", Status: "waiting",
+			Inputs: json.RawMessage(`{}`), Result: json.RawMessage(`{}`), Calls: json.RawMessage(`[]`)}
+		if err := store.CreateRun(ctx, run); err != nil {
+			t.Fatalf("CreateRun: %v", err)
+		}
+
+		// A unique assignee keeps the listing independent of other subtests.
+		assignee := "user-" + uuid.NewString()
+		expired := time.Now().Add(-time.Minute).UTC().Truncate(time.Microsecond)
+		first := &storage.Task{ID: uuid.New(), WorkflowID: wf.ID, RunID: run.ID, NodeID: "approve", Kind: "approval",
+			Assignee: assignee, Title: "Approve?", ExpiresAt: &expired}
+		second := &storage.Task{ID: uuid.New(), WorkflowID: wf.ID, RunID: run.ID, NodeID: "ask", Kind: "input",
+			Assignee: assignee, Title: "Phone?", Fields: []string{"phone"}}
+		for _, task := range []*storage.Task{first, second} {
+			if err := store.CreateTask(ctx, task); err != nil {
+				t.Fatalf("CreateTask: %v", err)
+			}
+			if task.Status != storage.TaskPending || task.CreatedAt.IsZero() {
+				t.Errorf("expected Status and CreatedAt to be filled in, got %+v", task)
+			}
+		}
+
+		got, err := store.GetTask(ctx, second.ID)
+		if err != nil {
+			t.Fatalf("GetTask: %v", err)
+		}
+		if got.Kind != "input" || got.Title != "Phone?" || len(got.Fields) != 1 || got.Fields[0] != "phone" || got.ExpiresAt != nil {
+			t.Errorf("unexpected task %+v", got)
+		}
+
+		tasks, err := store.ListTasks(ctx, storage.TaskFilter{Assignee: assignee, Status: storage.TaskPending})
+		if err != nil {
+			t.Fatalf("ListTasks: %v", err)
+		}
+		if len(tasks) != 2 || tasks[0].ID != first.ID || tasks[1].ID != second.ID {
+			t.Errorf("expected both tasks oldest first, got %+v", tasks)
+		}
+		now := time.Now()
+		tasks, _ = store.ListTasks(ctx, storage.TaskFilter{Assignee: assignee, ExpiresBefore: &now})
+		if len(tasks) != 1 || tasks[0].ID != first.ID || !tasks[0].ExpiresAt.Equal(expired) {
+			t.Errorf("expected only the expired task, got %+v", tasks)
+		}
+
+		retryAt := time.Now().Add(5 * time.Minute).UTC().Truncate(time.Microsecond)
+		done, err := store.CompleteTask(ctx, second.ID, storage.TaskSubmitted, json.RawMessage(`{"phone":"+61400000000"}`), assignee, retryAt)
+		if err != nil {
+			t.Fatalf("CompleteTask: %v", err)
+		}
+		if done.Status != storage.TaskSubmitted || done.RespondedBy != assignee || done.CompletedAt == nil || !jsonEqual(done.Response, json.RawMessage(`{"phone":"+61400000000"}`)) {
+			t.Errorf("unexpected completed task %+v", done)
+		}
+		if got, err := store.GetRun(ctx, wf.ID, run.ID); err != nil || got.ResumeAt == nil || !got.ResumeAt.Equal(retryAt) {
+			t.Errorf("expected the run scheduled to resume at the retry time, got %+v, %v", got, err)
+		}
+		if _, err := store.CompleteTask(ctx, second.ID, storage.TaskExpired, nil, "", retryAt); !errors.Is(err, storage.ErrTaskNotPending) {
+			t.Errorf("expected a second completion to return ErrTaskNotPending, got %v", err)
+		}
+		if _, err := store.CompleteTask(ctx, uuid.New(), storage.TaskExpired, nil, "", retryAt); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected unknown task to return ErrNoRows, got %v", err)
+		}
+		if _, err := store.GetTask(ctx, uuid.New()); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected unknown task to return ErrNoRows, got %v", err)
+		}
+		tasks, _ = store.ListTasks(ctx, storage.TaskFilter{Assignee: assignee, Status: storage.TaskPending})
+		if len(tasks) != 1 || tasks[0].ID != first.ID {
+			t.Errorf("expected only the first task to be pending, got %+v", tasks)
+		}
+	})
+	t.Run("idempotency keys are claimed once until they expire", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		wf := sampleWorkflow(uuid.New())
+		if err := store.UpsertWorkflow(ctx, wf); err != nil {
+			t.Fatalf("UpsertWorkflow: %v", err)
+		}
+
+		now := time.Now().UTC().Truncate(time.Microsecond)
+		key := &storage.IdempotencyKey{WorkflowID: wf.ID, Key: "retry-1", RequestHash: "a", CreatedAt: now, LockedUntil: now.Add(time.Minute), ExpiresAt: now.Add(time.Hour)}
+		if _, err := store.ClaimIdempotencyKey(ctx, key); err != nil {
+			t.Fatalf("ClaimIdempotencyKey: %v", err)
+		}
+		if key.Status != storage.IdempotencyInProgress {
+			t.Errorf("expected Status to be filled in, got %+v", key)
+		}
+
+		retry := &storage.IdempotencyKey{WorkflowID: wf.ID, Key: "retry-1", RequestHash: "b", CreatedAt: now, LockedUntil: now.Add(time.Minute), ExpiresAt: now.Add(time.Hour)}
+		existing, err := store.ClaimIdempotencyKey(ctx, retry)
+		if !errors.Is(err, storage.ErrIdempotencyKeyTaken) || existing.RequestHash != "a" || existing.Status != storage.IdempotencyInProgress {
+			t.Fatalf("expected the in-progress record with ErrIdempotencyKeyTaken, got %+v, %v", existing, err)
+		}
+
+		key.StatusCode = 200
+		key.Response = json.RawMessage(`{"status":"completed"}`)
+		if err := store.CompleteIdempotencyKey(ctx, key); err != nil {
+			t.Fatalf("CompleteIdempotencyKey: %v", err)
+		}
+		existing, err = store.ClaimIdempotencyKey(ctx, retry)
+		if !errors.Is(err, storage.ErrIdempotencyKeyTaken) || existing.Status != storage.IdempotencyCompleted ||
+			existing.StatusCode != 200 || !jsonEqual(existing.Response, key.Response) {
+			t.Errorf("expected the completed record, got %+v, %v", existing, err)
+		}
+
+		// The same key on another workflow is a different key.
+		other := sampleWorkflow(uuid.New())
+		if err := store.UpsertWorkflow(ctx, other); err != nil {
+			t.Fatalf("UpsertWorkflow: %v", err)
+		}
+		otherKey := &storage.IdempotencyKey{WorkflowID: other.ID, Key: "retry-1", RequestHash: "c", CreatedAt: now, LockedUntil: now.Add(time.Minute), ExpiresAt: now.Add(time.Hour)}
+		if _, err := store.ClaimIdempotencyKey(ctx, otherKey); err != nil {
+			t.Errorf("expected the key to be free on another workflow, got %v", err)
+		}
+
+		// A released key can be claimed again.
+		if err := store.ReleaseIdempotencyKey(ctx, otherKey); err != nil {
+			t.Fatalf("ReleaseIdempotencyKey: %v", err)
+		}
+		if _, err := store.ClaimIdempotencyKey(ctx, &storage.IdempotencyKey{WorkflowID: other.ID, Key: "retry-1", RequestHash: "d", CreatedAt: now, ExpiresAt: now.Add(-time.Second)}); err != nil {
+			t.Errorf("expected a released key to be claimable, got %v", err)
+		}
+
+		// An expired key can be taken over, and is deleted by the sweep.
+		taken, err := store.ClaimIdempotencyKey(ctx, &storage.IdempotencyKey{WorkflowID: other.ID, Key: "retry-1", RequestHash: "e", CreatedAt: now, ExpiresAt: now.Add(-time.Second)})
+		if err != nil || taken.RequestHash != "e" {
+			t.Errorf("expected an expired key to be taken over, got %+v, %v", taken, err)
+		}
+		if n, err := store.DeleteExpiredIdempotencyKeys(ctx, now); err != nil || n < 1 {
+			t.Errorf("expected the expired key to be deleted, got %d, %v", n, err)
+		}
+		if n, _ := store.DeleteExpiredIdempotencyKeys(ctx, now.Add(2*time.Hour)); n < 1 {
+			t.Errorf("expected the completed key to expire, got %d", n)
+		}
+		if _, err := store.ClaimIdempotencyKey(ctx, retry); err != nil {
+			t.Errorf("expected the deleted key to be claimable, got %v", err)
+		}
+	})
+	t.Run("stale idempotency claims are taken over", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		wf := sampleWorkflow(uuid.New())
+		if err := store.UpsertWorkflow(ctx, wf); err != nil {
+			t.Fatalf("UpsertWorkflow: %v", err)
+		}
+
+		now := time.Now().UTC().Truncate(time.Microsecond)
+		stale := &storage.IdempotencyKey{WorkflowID: wf.ID, Key: "retry-1", RequestHash: "a", CreatedAt: now, LockedUntil: now.Add(time.Minute), ExpiresAt: now.Add(24 * time.Hour)}
+		if _, err := store.ClaimIdempotencyKey(ctx, stale); err != nil {
+			t.Fatalf("ClaimIdempotencyKey: %v", err)
+		}
+
+		// After its lease the in-progress claim is taken over, though the
+		// key has not expired.
+		later := now.Add(2 * time.Minute)
+		retry := &storage.IdempotencyKey{WorkflowID: wf.ID, Key: "retry-1", RequestHash: "a", CreatedAt: later, LockedUntil: later.Add(time.Minute), ExpiresAt: later.Add(24 * time.Hour)}
+		if _, err := store.ClaimIdempotencyKey(ctx, retry); err != nil {
+			t.Fatalf("expected the stale claim to be taken over, got %v", err)
+		}
+
+		// The request that lost its claim can neither complete nor release it.
+		stale.StatusCode = 500
+		stale.Response = json.RawMessage(`{"code":"INTERNAL_ERROR"}`)
+		if err := store.CompleteIdempotencyKey(ctx, stale); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected the stale claim not to complete, got %v", err)
+		}
+		if err := store.ReleaseIdempotencyKey(ctx, stale); err != nil {
+			t.Fatalf("ReleaseIdempotencyKey: %v", err)
+		}
+		existing, err := store.ClaimIdempotencyKey(ctx, &storage.IdempotencyKey{WorkflowID: wf.ID, Key: "retry-1", RequestHash: "a", CreatedAt: later, LockedUntil: later.Add(time.Minute), ExpiresAt: later.Add(24 * time.Hour)})
+		if !errors.Is(err, storage.ErrIdempotencyKeyTaken) || !existing.CreatedAt.Equal(later) || existing.Status != storage.IdempotencyInProgress {
+			t.Fatalf("expected the new claim to hold the key, got %+v, %v", existing, err)
+		}
+
+		// A completed key is kept until it expires, whatever its lease.
+		retry.StatusCode = 200
+		retry.Response = json.RawMessage(`{"status":"completed"}`)
+		if err := store.CompleteIdempotencyKey(ctx, retry); err != nil {
+			t.Fatalf("CompleteIdempotencyKey: %v", err)
+		}
+		muchLater := later.Add(time.Hour)
+		existing, err = store.ClaimIdempotencyKey(ctx, &storage.IdempotencyKey{WorkflowID: wf.ID, Key: "retry-1", RequestHash: "a", CreatedAt: muchLater, LockedUntil: muchLater.Add(time.Minute), ExpiresAt: muchLater.Add(24 * time.Hour)})
+		if !errors.Is(err, storage.ErrIdempotencyKeyTaken) || existing.Status != storage.IdempotencyCompleted {
+			t.Errorf("expected the completed record, got %+v, %v", existing, err)
+		}
+	})
+	t.Run("api keys are looked up by prefix and revoked once", func(t *testing.T) {
+		store := newStore(t)
+		ctx := context.Background()
+		key := &storage.APIKey{ID: uuid.New(), Name: "ci", Prefix: "wfk_" + uuid.NewString()[:8], KeyHash: "hash", Role: "editor", CreatedBy: "admin"}
+		if err := store.CreateAPIKey(ctx, key); err != nil {
+			t.Fatalf("CreateAPIKey: %v", err)
+		}
+		if key.CreatedAt.IsZero() {
+			t.Errorf("expected CreatedAt to be filled in, got %+v", key)
+		}
+		dup := *key
+		dup.ID = uuid.New()
+		if err := store.CreateAPIKey(ctx, &dup); err == nil {
+			t.Errorf("expected a duplicate prefix to be rejected")
+		}
+
+		got, err := store.GetAPIKeyByPrefix(ctx, key.Prefix)
+		if err != nil || got.ID != key.ID || got.KeyHash != "hash" || got.Role != "editor" || got.RevokedAt != nil {
+			t.Fatalf("expected the stored key, got %+v, %v", got, err)
+		}
+		if _, err := store.GetAPIKeyByPrefix(ctx, "wfk_missing"); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected ErrNoRows for an unknown prefix, got %v", err)
+		}
+
+		at := time.Now().UTC().Truncate(time.Microsecond)
+		revoked, err := store.RevokeAPIKey(ctx, key.ID, at)
+		if err != nil || revoked.RevokedAt == nil || !revoked.RevokedAt.Equal(at) {
+			t.Fatalf("expected the key revoked at %v, got %+v, %v", at, revoked, err)
+		}
+		again, err := store.RevokeAPIKey(ctx, key.ID, at.Add(time.Hour))
+		if err != nil || !again.RevokedAt.Equal(at) {
+			t.Errorf("expected the first revocation time to be kept, got %+v, %v", again, err)
+		}
+		if _, err := store.RevokeAPIKey(ctx, uuid.New(), at); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected ErrNoRows for an unknown key, got %v", err)
+		}
+
+		keys, err := store.ListAPIKeys(ctx)
+		if err != nil {
+			t.Fatalf("ListAPIKeys: %v", err)
+		}
+		found := false
+		for _, k := range keys {
+			if k.ID == key.ID {
+				found = k.RevokedAt != nil
+			}
+		}
+		if !found {
+			t.Errorf("expected the revoked key to be listed, got %+v", keys)
+		}
+	})
+
+	t.Run("changes are recorded as audit events", func(t *testing.T) {
+		store := newStore(t)
+		actor := "auditor-" + uuid.NewString()[:8]
+		audited := func(requestID string) context.Context {
+			return storage.WithAuditInfo(context.Background(), storage.AuditInfo{Actor: actor, RequestID: requestID})
+		}
+
+		wf := sampleWorkflow(uuid.New())
+		if err := store.UpsertWorkflow(audited("req-create"), wf); err != nil {
+			t.Fatalf("UpsertWorkflow: %v", err)
+		}
+		wf.Name += " (renamed)"
+		wf.Nodes[1].Position.X = 500
+		if err := store.UpsertWorkflow(audited("req-update"), wf); err != nil {
+			t.Fatalf("UpsertWorkflow: %v", err)
+		}
+		if _, err := store.PublishWorkflow(audited("req-publish"), wf.ID); err != nil {
+			t.Fatalf("PublishWorkflow: %v", err)
+		}
+		if err := store.DeleteWorkflow(audited("req-delete"), wf.ID); err != nil {
+			t.Fatalf("DeleteWorkflow: %v", err)
+		}
+		entry := &storage.NodeLibraryEntry{NodeType: "conformance", Label: "Audited"}
+		if err := store.CreateNodeLibraryEntry(audited("req-library"), entry); err != nil {
+			t.Fatalf("CreateNodeLibraryEntry: %v", err)
+		}
+
+		ctx := context.Background()
+		events, err := store.ListAuditEvents(ctx, storage.AuditFilter{TargetType: storage.AuditTargetWorkflow, TargetID: wf.ID.String()})
+		if err != nil {
+			t.Fatalf("ListAuditEvents: %v", err)
+		}
+		wantActions := []string{storage.AuditWorkflowDelete, storage.AuditWorkflowPublish, storage.AuditWorkflowUpdate, storage.AuditWorkflowCreate}
+		wantRequests := []string{"req-delete", "req-publish", "req-update", "req-create"}
+		if len(events) != len(wantActions) {
+			t.Fatalf("expected %d workflow events, got %+v", len(wantActions), events)
+		}
+		for i, e := range events {
+			if e.Action != wantActions[i] || e.RequestID != wantRequests[i] || e.Actor != actor || e.OccurredAt.IsZero() {
+				t.Errorf("event %d: expected %s by %s in %s, got %+v", i, wantActions[i], actor, wantRequests[i], e)
+			}
+		}
+
+		var update map[string]struct {
+			Before any `json:"before"`
+			After  any `json:"after"`
+		}
+		if err := json.Unmarshal(events[2].Diff, &update); err != nil {
+			t.Fatalf("decode update diff: %v", err)
+		}
+		if len(update) != 2 || update["name"].After != wf.Name || update["nodes[end].position.x"].After != 500.0 {
+			t.Errorf("expected the rename and the moved node in the update diff, got %s", events[2].Diff)
+		}
+		var create map[string]json.RawMessage
+		if err := json.Unmarshal(events[3].Diff, &create); err != nil {
+			t.Fatalf("decode create diff: %v", err)
+		}
+		if _, ok := create["nodes[start]"]; !ok {
+			t.Errorf("expected the created nodes in the create diff, got %s", events[3].Diff)
+		}
+
+		mine, err := store.ListAuditEvents(ctx, storage.AuditFilter{Actor: actor})
+		if err != nil {
+			t.Fatalf("ListAuditEvents: %v", err)
+		}
+		if len(mine) != 5 || mine[0].TargetType != storage.AuditTargetNodeLibrary || mine[0].TargetID != entry.ID {
+			t.Fatalf("expected the library event first of 5, got %+v", mine)
+		}
+		page, err := store.ListAuditEvents(ctx, storage.AuditFilter{Actor: actor, BeforeID: mine[1].ID, Limit: 2})
+		if err != nil {
+			t.Fatalf("ListAuditEvents: %v", err)
+		}
+		if len(page) != 2 || page[0].ID != mine[2].ID || page[1].ID != mine[3].ID {
+			t.Errorf("expected events %d and %d after the cursor, got %+v", mine[2].ID, mine[3].ID, page)
+		}
+		future := time.Now().Add(time.Hour)
+		if later, err := store.ListAuditEvents(ctx, storage.AuditFilter{Actor: actor, Since: &future}); err != nil || len(later) != 0 {
+			t.Errorf("expected no events since %v, got %+v, %v", future, later, err)
+		}
+		if earlier, err := store.ListAuditEvents(ctx, storage.AuditFilter{Actor: actor, Until: &future}); err != nil || len(earlier) != 5 {
+			t.Errorf("expected every event until %v, got %d, %v", future, len(earlier), err)
+		}
+	})
+
+	t.Run("workspaces isolate their data", func(t *testing.T) {
+		store := newStore(t)
+		ws := &storage.Workspace{ID: "ws-" + uuid.NewString()[:8], Name: "Conformance"}
+		if err := store.CreateWorkspace(context.Background(), ws); err != nil {
+			t.Fatalf("CreateWorkspace: %v", err)
+		}
+		if ws.CreatedAt.IsZero() {
+			t.Error("expected CreatedAt to be filled in")
+		}
+		if err := store.CreateWorkspace(context.Background(), &storage.Workspace{ID: ws.ID, Name: "Again"}); !errors.Is(err, storage.ErrWorkspaceExists) {
+			t.Errorf("expected a duplicate workspace to return ErrWorkspaceExists, got %v", err)
+		}
+		if _, err := store.GetWorkspace(context.Background(), "ws-missing-"+uuid.NewString()[:8]); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected unknown workspace to return ErrNoRows, got %v", err)
+		}
+		all, err := store.ListWorkspaces(context.Background())
+		if err != nil {
+			t.Fatalf("ListWorkspaces: %v", err)
+		}
+		var listed bool
+		for _, w := range all {
+			listed = listed || w.ID == ws.ID
+		}
+		if !listed || !sort.SliceIsSorted(all, func(i, j int) bool { return all[i].ID < all[j].ID }) {
+			t.Errorf("expected %s among workspaces ordered by ID, got %+v", ws.ID, all)
+		}
+
+		ctx := storage.WithWorkspace(context.Background(), ws.ID)
+		if _, err := store.GetWorkflow(ctx, storage.SeedWeatherWorkflowID); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected the default workspace's workflow to be hidden, got %v", err)
+		}
+		if err := store.UpsertWorkflow(ctx, sampleWorkflow(storage.SeedWeatherWorkflowID)); !errors.Is(err, storage.ErrOtherWorkspace) {
+			t.Errorf("expected saving over another workspace's workflow to return ErrOtherWorkspace, got %v", err)
+		}
+
+		entry := &storage.NodeLibraryEntry{NodeType: "conformance", Label: "Private"}
+		if err := store.CreateNodeLibraryEntry(ctx, entry); err != nil {
+			t.Fatalf("CreateNodeLibraryEntry: %v", err)
+		}
+		if entry.WorkspaceID != ws.ID {
+			t.Errorf("expected the entry to belong to %s, got %q", ws.ID, entry.WorkspaceID)
+		}
+		if err := store.CreateNodeLibraryEntry(context.Background(), &storage.NodeLibraryEntry{ID: entry.ID, NodeType: "conformance"}); !errors.Is(err, storage.ErrLibraryIDTaken) {
+			t.Errorf("expected the ID to be taken across workspaces, got %v", err)
+		}
+		inWorkspace, _ := store.ListNodeLibrary(ctx)
+		inDefault, _ := store.ListNodeLibrary(context.Background())
+		if !hasLibraryEntry(inWorkspace, entry.ID) || hasLibraryEntry(inDefault, entry.ID) {
+			t.Errorf("expected %s to be listed only in %s", entry.ID, ws.ID)
+		}
+		if len(inWorkspace) < len(storage.SeedFixtures().Library) {
+			t.Errorf("expected the global library to be shared, got %d entries", len(inWorkspace))
+		}
+		leaked := sampleWorkflow(uuid.New())
+		leaked.Nodes = append(leaked.Nodes, storage.Node{ID: "private", Type: "conformance", LibraryID: entry.ID})
+		if err := store.UpsertWorkflow(context.Background(), leaked); err == nil {
+			t.Error("expected another workspace's library entry to be unusable")
+		}
+
+		wf := sampleWorkflow(uuid.New())
+		if err := store.UpsertWorkflow(ctx, wf); err != nil {
+			t.Fatalf("UpsertWorkflow: %v", err)
+		}
+		if _, err := store.GetWorkflow(context.Background(), wf.ID); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected the workflow to be hidden from the default workspace, got %v", err)
+		}
+		if _, err := store.PublishWorkflow(context.Background(), wf.ID); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected publishing from the default workspace to return ErrNoRows, got %v", err)
+		}
+		if err := store.DeleteWorkflow(context.Background(), wf.ID); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected deleting from the default workspace to return ErrNoRows, got %v", err)
+		}
+
+		run := &storage.Run{ID: uuid.New(), WorkflowID: wf.ID, Mode: "live", Status: "waiting",
+			Inputs: json.RawMessage(`{}`), Result: json.RawMessage(`{}`), Calls: json.RawMessage(`[]`)}
+		if err := store.CreateRun(ctx, run); err != nil {
+			t.Fatalf("CreateRun: %v", err)
+		}
+		if _, err := store.GetRun(context.Background(), wf.ID, run.ID); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected the run to be hidden from the default workspace, got %v", err)
+		}
+
+		assignee := "user-" + uuid.NewString()
+		task := &storage.Task{ID: uuid.New(), WorkflowID: wf.ID, RunID: run.ID, NodeID: "approve", Kind: "approval",
+			Assignee: assignee, Title: "Approve?"}
+		if err := store.CreateTask(ctx, task); err != nil {
+			t.Fatalf("CreateTask: %v", err)
+		}
+		if tasks, _ := store.ListTasks(context.Background(), storage.TaskFilter{Assignee: assignee}); len(tasks) != 0 {
+			t.Errorf("expected no tasks in the default workspace, got %+v", tasks)
+		}
+		tasks, _ := store.ListTasks(context.Background(), storage.TaskFilter{Assignee: assignee, AllWorkspaces: true})
+		if len(tasks) != 1 || tasks[0].WorkspaceID != ws.ID {
+			t.Errorf("expected the task across workspaces, got %+v", tasks)
+		}
+		if _, err := store.CompleteTask(context.Background(), task.ID, storage.TaskApproved, nil, assignee, time.Now()); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected completing from the default workspace to return ErrNoRows, got %v", err)
+		}
+
+		events, err := store.ListAuditEvents(ctx, storage.AuditFilter{TargetID: wf.ID.String()})
+		if err != nil || len(events) != 1 || events[0].WorkspaceID != ws.ID {
+			t.Errorf("expected the create event in %s, got %+v, %v", ws.ID, events, err)
+		}
+		if events, _ := store.ListAuditEvents(context.Background(), storage.AuditFilter{TargetID: wf.ID.String()}); len(events) != 0 {
+			t.Errorf("expected no events in the default workspace, got %+v", events)
+		}
+
+		limit := 1
+		ws.MaxWorkflows = &limit
+		ws.MaxRunsPerHour = &limit
+		if err := store.UpdateWorkspace(context.Background(), ws); err != nil {
+			t.Fatalf("UpdateWorkspace: %v", err)
+		}
+		if got, err := store.GetWorkspace(context.Background(), ws.ID); err != nil || got.MaxWorkflows == nil || *got.MaxWorkflows != 1 {
+			t.Errorf("expected the quota to be saved, got %+v, %v", got, err)
+		}
+		if err := store.UpsertWorkflow(ctx, sampleWorkflow(uuid.New())); !errors.Is(err, storage.ErrQuotaExceeded) {
+			t.Errorf("expected a second workflow to return ErrQuotaExceeded, got %v", err)
+		}
+		rejected := []storage.NodeLibraryEntry{{NodeType: "conformance", Label: "Rejected"}}
+		if err := store.ImportWorkflow(ctx, sampleWorkflow(uuid.New()), rejected); !errors.Is(err, storage.ErrQuotaExceeded) {
+			t.Errorf("expected importing a second workflow to return ErrQuotaExceeded, got %v", err)
+		}
+		if lib, _ := store.ListNodeLibrary(ctx); rejected[0].ID == "" || hasLibraryEntry(lib, rejected[0].ID) {
+			t.Errorf("expected the rejected import to leave no library entry, got %s", rejected[0].ID)
+		}
+		if err := store.UpsertWorkflow(ctx, wf); err != nil {
+			t.Errorf("expected re-saving an existing workflow to ignore the quota, got %v", err)
+		}
+		second := &storage.Run{ID: uuid.New(), WorkflowID: wf.ID, Mode: "live", Status: "completed",
+			Inputs: json.RawMessage(`{}`), Result: json.RawMessage(`{}`), Calls: json.RawMessage(`[]`)}
+		if err := store.CreateRun(ctx, second); !errors.Is(err, storage.ErrQuotaExceeded) {
+			t.Errorf("expected a second run in the hour to return ErrQuotaExceeded, got %v", err)
+		}
+		if _, err := store.GetRun(ctx, wf.ID, second.ID); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected the rejected run not to be stored, got %v", err)
+		}
+		if err := store.UpdateWorkspace(context.Background(), &storage.Workspace{ID: "ws-missing-" + uuid.NewString()[:8], Name: "x"}); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected updating an unknown workspace to return ErrNoRows, got %v", err)
+		}
+	})
+
+	t.Run("secrets are replaced, listed without values and deleted", func(t *testing.T) {
+		store := newStore(t)
+		ws := &storage.Workspace{ID: "ws-" + uuid.NewString()[:8], Name: "Secrets"}
+		if err := store.CreateWorkspace(context.Background(), ws); err != nil {
+			t.Fatalf("CreateWorkspace: %v", err)
+		}
+		ctx := storage.WithWorkspace(context.Background(), ws.ID)
+		name := "API_KEY_" + strings.ToUpper(uuid.NewString()[:8])
+
+		sec := &storage.Secret{Name: name, Ciphertext: []byte("first"), UpdatedBy: "alice"}
+		created, err := store.PutSecret(ctx, sec)
+		if err != nil || !created {
+			t.Fatalf("PutSecret: expected created, got %v, %v", created, err)
+		}
+		if sec.CreatedAt.IsZero() || sec.ModifiedAt.IsZero() {
+			t.Errorf("expected times to be filled in, got %+v", sec)
+		}
+		created, err = store.PutSecret(ctx, &storage.Secret{Name: name, Ciphertext: []byte("second"), UpdatedBy: "bob"})
+		if err != nil || created {
+			t.Fatalf("PutSecret: expected replaced, got %v, %v", created, err)
+		}
+		got, err := store.GetSecret(ctx, name)
+		if err != nil {
+			t.Fatalf("GetSecret: %v", err)
+		}
+		if string(got.Ciphertext) != "second" || got.UpdatedBy != "bob" {
+			t.Errorf("expected the replaced secret, got %+v", got)
+		}
+		if _, err := store.GetSecret(context.Background(), name); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected the secret to be hidden from the default workspace, got %v", err)
+		}
+
+		list, err := store.ListSecrets(ctx)
+		if err != nil {
+			t.Fatalf("ListSecrets: %v", err)
+		}
+		if len(list) != 1 || list[0].Name != name || list[0].Ciphertext != nil {
+			t.Errorf("expected only %s, without its value, got %+v", name, list)
+		}
+
+		if err := store.DeleteSecret(ctx, name); err != nil {
+			t.Fatalf("DeleteSecret: %v", err)
+		}
+		if err := store.DeleteSecret(ctx, name); !errors.Is(err, pgx.ErrNoRows) {
+			t.Errorf("expected a second delete to return ErrNoRows, got %v", err)
+		}
+		events, err := store.ListAuditEvents(ctx, storage.AuditFilter{TargetType: storage.AuditTargetSecret, TargetID: name})
+		if err != nil {
+			t.Fatalf("ListAuditEvents: %v", err)
+		}
+		var actions []string
+		for _, e := range events {
+			actions = append(actions, e.Action)
+		}
+		if want := []string{storage.AuditSecretDelete, storage.AuditSecretUpdate, storage.AuditSecretCreate}; !reflect.DeepEqual(actions, want) {
+			t.Errorf("expected events %v, got %v", want, actions)
+		}
+	})
+
+	t.Run("seeded execution limits are listed in order", func(t *testing.T) {
+		store := newStore(t)
+		limits, err := store.ListExecutionLimits(context.Background())
+		if err != nil {
+			t.Fatalf("ListExecutionLimits: %v", err)
+		}
+		var scopes []string
+		for _, l := range limits {
+			if l.Subject == "" {
+				scopes = append(scopes, l.Scope)
+			}
+		}
+		if !equalStrings(scopes, []string{storage.LimitScopeAPIKey, storage.LimitScopeGlobal, storage.LimitScopeWorkflow}) {
+			t.Errorf("expected the api_key, global and workflow defaults, got %+v", limits)
+		}
+	})
+}
+
+func hasLibraryEntry(entries []storage.NodeLibraryEntry, id string) bool {
+	for _, e := range entries {
+		if e.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// sampleWorkflow is a minimal start → end graph using seeded node types.
+func sampleWorkflow(id uuid.UUID) *storage.Workflow {
+	label := "Go"
+	return &storage.Workflow{
+		ID:   id,
+		Name: "Conformance " + id.String()[:8],
+		Nodes: []storage.Node{
+			{ID: "start", Type: "start", Position: storage.NodePosition{X: 0, Y: 40}},
+			{ID: "end", Type: "end", Position: storage.NodePosition{X: 300, Y: 40}},
+		},
+		Edges: []storage.Edge{
+			{
+				ID:       "e1",
+				Source:   "start",
+				Target:   "end",
+				Type:     "smoothstep",
+				Animated: true,
+				Label:    &label,
+				Style:    json.RawMessage(`{"stroke":"#10b981"}`),
+			},
+		},
+	}
+}
+
+func nodeIDs(ns []storage.Node) []string {
+	ids := make([]string, 0, len(ns))
+	for _, n := range ns {
+		ids = append(ids, n.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func equalUUIDs(a, b []uuid.UUID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func errorArchive([]storage.Run) error {
+	return errors.New("archive unavailable")
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// jsonEqual compares two JSON documents semantically, since JSONB does not
+// preserve whitespace or key order.
+func jsonEqual(a, b json.RawMessage) bool {
+	var av, bv any
+	if err := json.Unmarshal(a, &av); err != nil {
+		return false
+	}
+	if err := json.Unmarshal(b, &bv); err != nil {
+		return false
+	}
+	ab, _ := json.Marshal(av)
+	bb, _ := json.Marshal(bv)
+	return string(ab) == string(bb)
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// DefaultWorkspaceID is the workspace that existing data was moved to and
+// that a context without a workspace uses.
+const DefaultWorkspaceID = "default"
+
+// workspaceIDPattern is the form of a workspace ID, as the workspaces table
+// checks it: a lowercase slug, usable in a URL path.
+var workspaceIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// ValidWorkspaceID reports whether id can name a workspace.
+func ValidWorkspaceID(id string) bool {
+	return workspaceIDPattern.MatchString(id)
+}
+
+// ErrQuotaExceeded is returned, wrapped with the limit, when a change would
+// take a workspace over one of its quotas.
+var ErrQuotaExceeded = errors.New("workspace quota exceeded")
+
+// ErrOtherWorkspace is returned by UpsertWorkflow and ImportWorkflow when the workflow ID is
+// taken by a workflow in another workspace.
+var ErrOtherWorkspace = errors.New("workflow belongs to another workspace")
+
+// ErrLibraryIDTaken is returned by CreateNodeLibraryEntry when an entry
+// with the ID already exists, in any workspace.
+var ErrLibraryIDTaken = errors.New("library id is taken")
+
+// LibraryIDTakenError is returned by ImportWorkflow when the ID of one of
+// the entries already exists. It matches ErrLibraryIDTaken.
+type LibraryIDTakenError struct {
+	ID string
+}
+
+func (e *LibraryIDTakenError) Error() string {
+	return fmt.Sprintf("node_library entry %s: %v", e.ID, ErrLibraryIDTaken)
+}
+
+func (e *LibraryIDTakenError) Unwrap() error { return ErrLibraryIDTaken }
+
+// ErrWorkspaceExists is returned by CreateWorkspace when the ID is taken.
+var ErrWorkspaceExists = errors.New("workspace already exists")
+
+type workspaceKey struct{}
+
+// WithWorkspace returns ctx scoped to a workspace. Every storage method
+// called with ctx only reads and writes that workspace's data, plus the
+// shared global node library.
+func WithWorkspace(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, workspaceKey{}, id)
+}
+
+// WorkspaceFrom returns the workspace ctx is scoped to, DefaultWorkspaceID
+// if none.
+func WorkspaceFrom(ctx context.Context) string {
+	if id, ok := ctx.Value(workspaceKey{}).(string); ok && id != "" {
+		return id
+	}
+	return DefaultWorkspaceID
+}
@@ -0,0 +1,138 @@
+package workflow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+
+	"workflow-code-test/api/services/auth"
+	"workflow-code-test/api/services/storage"
+)
+
+// maxAPIKeyName is the length of api_keys.name.
+const maxAPIKeyName = 255
+
+type apiKeysBody struct {
+	APIKeys []storage.APIKey `json:"apiKeys"`
+}
+
+// createAPIKeyBody is the body of a create API key request. A key with a
+// workspace may only act in it.
+type createAPIKeyBody struct {
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	Workspace string `json:"workspace"`
+}
+
+// CreateAPIKeyResponse returns a new key. Key is the secret itself, which
+// is not stored and cannot be shown again.
+type CreateAPIKeyResponse struct {
+	APIKey storage.APIKey `json:"apiKey"`
+	Key    string         `json:"key"`
+}
+
+// HandleListAPIKeys lists every API key, revoked ones included, without
+// their secrets.
+func (s *Service) HandleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	rid := reqID(r)
+	keys, err := s.storage.ListAPIKeys(r.Context())
+	if err != nil {
+		slog.Error("failed to list api keys", "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiKeysBody{APIKeys: keys}, uuid.Nil, rid)
+}
+
+// HandleCreateAPIKey creates an API key with a name, role and optional
+// workspace and returns its secret, once.
+func (s *Service) HandleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	rid := reqID(r)
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+	var body createAPIKeyBody
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil {
+		slog.Warn("failed to decode api key", "requestId", rid, "error", err)
+		writeErrorJSON(w, "INVALID_BODY", "invalid request body", http.StatusBadRequest)
+		return
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" || len(body.Name) > maxAPIKeyName {
+		writeErrorJSON(w, "INVALID_NAME", fmt.Sprintf("name must be 1 to %d characters", maxAPIKeyName), http.StatusBadRequest)
+		return
+	}
+	role, ok := auth.ParseRole(body.Role)
+	if !ok {
+		writeErrorJSON(w, "INVALID_ROLE", fmt.Sprintf("unknown role %q", body.Role), http.StatusBadRequest)
+		return
+	}
+	if body.Workspace != "" {
+		if _, err := s.storage.GetWorkspace(r.Context(), body.Workspace); err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				writeErrorJSON(w, "INVALID_WORKSPACE", fmt.Sprintf("unknown workspace %q", body.Workspace), http.StatusBadRequest)
+				return
+			}
+			slog.Error("failed to get workspace", "workspace", body.Workspace, "requestId", rid, "error", err)
+			writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	secret, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		slog.Error("failed to generate api key", "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+	key := &storage.APIKey{
+		ID:          uuid.New(),
+		Name:        body.Name,
+		Prefix:      prefix,
+		KeyHash:     auth.HashAPIKey(secret),
+		Role:        string(role),
+		WorkspaceID: body.Workspace,
+		CreatedBy:   principal(r),
+	}
+	if err := s.storage.CreateAPIKey(r.Context(), key); err != nil {
+		slog.Error("failed to create api key", "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("created api key", "key", key.ID, "prefix", key.Prefix, "role", key.Role, "workspace", key.WorkspaceID, "principal", key.CreatedBy, "requestId", rid)
+	writeJSON(w, http.StatusCreated, CreateAPIKeyResponse{APIKey: *key, Key: secret}, uuid.Nil, rid)
+}
+
+// HandleRevokeAPIKey revokes a key. Requests with it are rejected from
+// then on; the key stays listed with its revocation time.
+func (s *Service) HandleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	rid := reqID(r)
+	raw := mux.Vars(r)["keyId"]
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		slog.Warn("invalid api key id", "key", raw, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INVALID_ID", "invalid api key id", http.StatusBadRequest)
+		return
+	}
+	key, err := s.storage.RevokeAPIKey(r.Context(), id, s.now())
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			writeErrorJSON(w, "NOT_FOUND", "api key not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to revoke api key", "key", id, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("revoked api key", "key", key.ID, "prefix", key.Prefix, "principal", principal(r), "requestId", rid)
+	writeJSON(w, http.StatusOK, key, uuid.Nil, rid)
+}
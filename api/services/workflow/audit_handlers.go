@@ -0,0 +1,101 @@
+package workflow
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/services/storage"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+)
+
+// auditTargetTypes are the target types audit events can be filtered by.
+var auditTargetTypes = map[string]bool{storage.AuditTargetWorkflow: true, storage.AuditTargetNodeLibrary: true, storage.AuditTargetSecret: true}
+
+// auditEventsBody is the response of the audit events endpoint. NextCursor
+// is set when there are older events; pass it as ?cursor= to get them.
+type auditEventsBody struct {
+	Events     []storage.AuditEvent `json:"events"`
+	NextCursor string               `json:"nextCursor,omitempty"`
+}
+
+// auditMiddleware makes the changes a request stores record its principal
+// and request ID in their audit events. It runs after s.authenticate.
+func auditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := storage.WithAuditInfo(r.Context(), storage.AuditInfo{Actor: principal(r), RequestID: reqID(r)})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// HandleListAuditEvents lists audit events, newest first. ?targetType=,
+// ?targetId=, ?actor=, ?since= and ?until= narrow the list; ?limit= sets the
+// page size and ?cursor= continues from a previous page's nextCursor.
+func (s *Service) HandleListAuditEvents(w http.ResponseWriter, r *http.Request) {
+	rid := reqID(r)
+	q := r.URL.Query()
+	filter := storage.AuditFilter{TargetID: q.Get("targetId"), Actor: q.Get("actor")}
+
+	if targetType := q.Get("targetType"); targetType != "" {
+		if !auditTargetTypes[targetType] {
+			writeErrorJSON(w, "INVALID_TARGET_TYPE", fmt.Sprintf("unknown target type %q", targetType), http.StatusBadRequest)
+			return
+		}
+		filter.TargetType = targetType
+	}
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeErrorJSON(w, "INVALID_TIME", p.name+" must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		*p.dst = &t
+	}
+	limit := defaultAuditPageSize
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxAuditPageSize {
+			writeErrorJSON(w, "INVALID_LIMIT", fmt.Sprintf("limit must be between 1 and %d", maxAuditPageSize), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	if v := q.Get("cursor"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 1 {
+			writeErrorJSON(w, "INVALID_CURSOR", "invalid cursor", http.StatusBadRequest)
+			return
+		}
+		filter.BeforeID = id
+	}
+	// One more than a page tells whether another page follows.
+	filter.Limit = limit + 1
+
+	events, err := s.storage.ListAuditEvents(r.Context(), filter)
+	if err != nil {
+		slog.Error("failed to list audit events", "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+	body := auditEventsBody{Events: events}
+	if len(events) > limit {
+		body.Events = events[:limit]
+		body.NextCursor = strconv.FormatInt(events[limit-1].ID, 10)
+	}
+	writeJSON(w, http.StatusOK, body, uuid.Nil, rid)
+}
@@ -0,0 +1,75 @@
+package workflow_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"workflow-code-test/api/services/auth"
+	"workflow-code-test/api/services/storage"
+)
+
+type auditList struct {
+	Events     []storage.AuditEvent `json:"events"`
+	NextCursor string               `json:"nextCursor"`
+}
+
+func TestAuditEvents_RecordPrincipalAndRequest(t *testing.T) {
+	t.Parallel()
+	router := newAuthTestRouter(t)
+	admin := roleToken(t, auth.RoleAdmin)
+	publisher := roleToken(t, auth.RolePublisher)
+	wfID := storage.SeedWeatherWorkflowID.String()
+
+	for _, rid := range []string{"req-publish-1", "req-publish-2"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/workflows/"+wfID+"/publish", nil)
+		req.Header.Set("Authorization", "Bearer "+publisher)
+		req.Header.Set("X-Request-ID", rid)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("publish: expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	list := func(query string) auditList {
+		t.Helper()
+		rec := authRequest(router, http.MethodGet, "/api/v1/audit-events"+query, admin, "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("list %s: expected 200, got %d: %s", query, rec.Code, rec.Body.String())
+		}
+		var body auditList
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode events: %v", err)
+		}
+		return body
+	}
+
+	first := list("?targetType=workflow&targetId=" + wfID + "&actor=publisher@example.com&limit=1")
+	if len(first.Events) != 1 || first.NextCursor == "" {
+		t.Fatalf("expected one event and a cursor, got %+v", first)
+	}
+	if e := first.Events[0]; e.Action != storage.AuditWorkflowPublish || e.RequestID != "req-publish-2" {
+		t.Errorf("expected the second publish first, got %+v", e)
+	}
+	second := list("?actor=publisher@example.com&limit=1&cursor=" + first.NextCursor)
+	if len(second.Events) != 1 || second.Events[0].RequestID != "req-publish-1" || second.NextCursor != "" {
+		t.Errorf("expected the first publish on the last page, got %+v", second)
+	}
+	if other := list("?actor=editor@example.com"); len(other.Events) != 0 {
+		t.Errorf("expected no events by another actor, got %+v", other.Events)
+	}
+	if later := list("?actor=publisher@example.com&since=2999-01-01T00:00:00Z"); len(later.Events) != 0 {
+		t.Errorf("expected no events in the future, got %+v", later.Events)
+	}
+
+	if rec := authRequest(router, http.MethodGet, "/api/v1/audit-events", publisher, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("publisher reading the audit log: expected 403, got %d", rec.Code)
+	}
+	for _, query := range []string{"?targetType=run", "?since=yesterday", "?limit=0", "?cursor=abc"} {
+		if rec := authRequest(router, http.MethodGet, "/api/v1/audit-events"+query, admin, ""); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"workflow-code-test/api/services/auth"
+)
+
+// SetAuthenticator makes every route require a bearer token accepted by a
+// and a role that allows it. Without one, requests are not authenticated
+// and every route is open, as for local development.
+func (s *Service) SetAuthenticator(a *auth.Authenticator) {
+	s.auth = a
+}
+
+// authenticate puts the principal of the request's bearer token in its
+// context, rejecting requests without valid credentials. It runs after
+// requestIDMiddleware, so failures are logged with the request ID.
+func (s *Service) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.auth == nil || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rid := reqID(r)
+		p, err := s.auth.Authenticate(r.Context(), r.Header.Get("Authorization"))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="workflow-api"`)
+			switch {
+			case errors.Is(err, auth.ErrNoCredentials):
+				writeErrorJSON(w, "UNAUTHENTICATED", "a bearer token is required", http.StatusUnauthorized)
+			case errors.Is(err, auth.ErrInvalidCredentials):
+				slog.Warn("rejected credentials", "requestId", rid, "error", err)
+				writeErrorJSON(w, "INVALID_CREDENTIALS", "invalid, expired or revoked credentials", http.StatusUnauthorized)
+			default:
+				slog.Error("failed to authenticate request", "requestId", rid, "error", err)
+				writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+		trace.SpanFromContext(r.Context()).SetAttributes(
+			attribute.String("enduser.id", p.Subject),
+			attribute.String("enduser.role", string(p.Role)),
+		)
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), p)))
+	})
+}
+
+// require wraps h so only principals whose role allows role may call it.
+func (s *Service) require(role auth.Role, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.auth == nil {
+			h(w, r)
+			return
+		}
+		p := auth.PrincipalFrom(r.Context())
+		if p == nil {
+			writeErrorJSON(w, "UNAUTHENTICATED", "a bearer token is required", http.StatusUnauthorized)
+			return
+		}
+		if !p.Role.Allows(role) {
+			slog.Warn("forbidden", "principal", p.Subject, "role", p.Role, "required", role, "path", r.URL.Path, "requestId", reqID(r))
+			writeErrorJSON(w, "FORBIDDEN", fmt.Sprintf("this requires the %s role", role), http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// principal returns the subject of the request's principal for logs and
+// records, or "" when requests are not authenticated.
+func principal(r *http.Request) string {
+	if p := auth.PrincipalFrom(r.Context()); p != nil {
+		return p.Subject
+	}
+	return ""
+}
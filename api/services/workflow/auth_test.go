@@ -0,0 +1,150 @@
+package workflow_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"workflow-code-test/api/pkg/clients/weather"
+	"workflow-code-test/api/services/auth"
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/storage"
+	"workflow-code-test/api/services/workflow"
+)
+
+var testJWTSecret = []byte("test-secret")
+
+// newAuthTestRouter returns a router whose routes require credentials.
+func newAuthTestRouter(t *testing.T) http.Handler {
+	t.Helper()
+	store := newMemoryStore(t, storage.SeedFixtures())
+	svc, err := workflow.NewService(store, nodes.Deps{Weather: weather.NewStubClient(31), Email: &countingEmail{}})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	a, err := auth.NewAuthenticator(store, auth.JWTConfig{HS256Secret: testJWTSecret})
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %v", err)
+	}
+	svc.SetAuthenticator(a)
+	return newTestRouter(svc)
+}
+
+func roleToken(t *testing.T, role auth.Role) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": string(role) + "@example.com", "role": string(role), "exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString(testJWTSecret)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return token
+}
+
+func authRequest(router http.Handler, method, url, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuth_RolesPerRoute(t *testing.T) {
+	t.Parallel()
+	router := newAuthTestRouter(t)
+	base := "/api/v1/workflows/" + storage.SeedWeatherWorkflowID.String()
+	execute := `{"formData":` + weatherInputsJSON + `}`
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		token      string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"no token", http.MethodGet, base, "", "", http.StatusUnauthorized, "UNAUTHENTICATED"},
+		{"bad token", http.MethodGet, base, "not-a-jwt", "", http.StatusUnauthorized, "INVALID_CREDENTIALS"},
+		{"viewer reads", http.MethodGet, base, roleToken(t, auth.RoleViewer), "", http.StatusOK, ""},
+		{"viewer lists tasks", http.MethodGet, "/api/v1/tasks", roleToken(t, auth.RoleViewer), "", http.StatusOK, ""},
+		{"viewer cannot execute", http.MethodPost, base + "/execute", roleToken(t, auth.RoleViewer), execute, http.StatusForbidden, "FORBIDDEN"},
+		{"editor executes", http.MethodPost, base + "/execute", roleToken(t, auth.RoleEditor), execute, http.StatusOK, ""},
+		{"editor cannot publish", http.MethodPost, base + "/publish", roleToken(t, auth.RoleEditor), "", http.StatusForbidden, "FORBIDDEN"},
+		{"publisher publishes", http.MethodPost, base + "/publish", roleToken(t, auth.RolePublisher), "", http.StatusOK, ""},
+		{"publisher cannot manage keys", http.MethodGet, "/api/v1/api-keys", roleToken(t, auth.RolePublisher), "", http.StatusForbidden, "FORBIDDEN"},
+		{"admin lists keys", http.MethodGet, "/api/v1/api-keys", roleToken(t, auth.RoleAdmin), "", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := authRequest(router, tt.method, tt.url, tt.token, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantCode == "" {
+				return
+			}
+			var body map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["code"] != tt.wantCode {
+				t.Errorf("expected code %s, got %s", tt.wantCode, rec.Body.String())
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("expected a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+func TestAuth_APIKeyLifecycle(t *testing.T) {
+	t.Parallel()
+	router := newAuthTestRouter(t)
+	admin := roleToken(t, auth.RoleAdmin)
+	base := "/api/v1/workflows/" + storage.SeedWeatherWorkflowID.String()
+
+	for _, body := range []string{`{"name":"","role":"editor"}`, `{"name":"ci","role":"owner"}`} {
+		if rec := authRequest(router, http.MethodPost, "/api/v1/api-keys", admin, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, rec.Code)
+		}
+	}
+
+	rec := authRequest(router, http.MethodPost, "/api/v1/api-keys", admin, `{"name":"ci","role":"editor"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create key: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created workflow.CreateAPIKeyResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode key: %v", err)
+	}
+	if !strings.HasPrefix(created.Key, created.APIKey.Prefix+"_") || created.APIKey.CreatedBy != "admin@example.com" {
+		t.Errorf("unexpected key %+v", created)
+	}
+
+	if rec := authRequest(router, http.MethodPost, base+"/execute", created.Key, `{"formData":`+weatherInputsJSON+`}`); rec.Code != http.StatusOK {
+		t.Errorf("execute with key: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := authRequest(router, http.MethodPost, base+"/publish", created.Key, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("publish with editor key: expected 403, got %d", rec.Code)
+	}
+
+	list := authRequest(router, http.MethodGet, "/api/v1/api-keys", admin, "")
+	if !strings.Contains(list.Body.String(), created.APIKey.Prefix) || strings.Contains(list.Body.String(), "Hash") {
+		t.Errorf("expected the key listed without its hash, got %s", list.Body.String())
+	}
+
+	if rec := authRequest(router, http.MethodDelete, "/api/v1/api-keys/"+created.APIKey.ID.String(), admin, ""); rec.Code != http.StatusOK {
+		t.Fatalf("revoke: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := authRequest(router, http.MethodGet, base, created.Key, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("revoked key: expected 401, got %d", rec.Code)
+	}
+	if rec := authRequest(router, http.MethodDelete, "/api/v1/api-keys/00000000-0000-0000-0000-000000000001", admin, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown key: expected 404, got %d", rec.Code)
+	}
+}
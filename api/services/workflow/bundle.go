@@ -0,0 +1,282 @@
+package workflow
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+
+	"workflow-code-test/api/services/bundle"
+	"workflow-code-test/api/services/storage"
+)
+
+// maxBundleBody limits the size of an imported bundle.
+const maxBundleBody = 5 << 20 // 5MB
+
+// HandleExportWorkflow returns the workflow as a portable bundle including
+// the node library blueprints it uses.
+//
+// Query parameters:
+//   - format: "json" (default) or "yaml"
+//   - version: export a published snapshot instead of the current draft
+func (s *Service) HandleExportWorkflow(w http.ResponseWriter, r *http.Request) {
+	rid := reqID(r)
+	id := mux.Vars(r)["id"]
+	slog.Debug("exporting workflow", "id", id, "requestId", rid)
+
+	wfUUID, err := uuid.Parse(id)
+	if err != nil {
+		slog.Warn("invalid workflow id", "id", id, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INVALID_ID", "invalid workflow id", http.StatusBadRequest)
+		return
+	}
+
+	format := bundle.FormatJSON
+	if f := r.URL.Query().Get("format"); f != "" {
+		if format, err = bundle.ParseFormat(f); err != nil {
+			writeErrorJSON(w, "INVALID_FORMAT", "format must be json or yaml", http.StatusBadRequest)
+			return
+		}
+	}
+
+	version := 0
+	if v := r.URL.Query().Get("version"); v != "" {
+		if version, err = strconv.Atoi(v); err != nil || version < 1 {
+			writeErrorJSON(w, "INVALID_VERSION", "version must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	wf, err := s.storage.GetWorkflow(ctx, wfUUID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			slog.Warn("workflow not found for export", "id", wfUUID, "requestId", rid)
+			writeErrorJSON(w, "NOT_FOUND", "workflow not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to get workflow", "id", wfUUID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if version > 0 {
+		snap, err := s.storage.GetSnapshot(ctx, wfUUID, version)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				slog.Warn("snapshot not found for export", "id", wfUUID, "version", version, "requestId", rid)
+				writeErrorJSON(w, "NOT_FOUND", "snapshot version not found", http.StatusNotFound)
+				return
+			}
+			slog.Error("failed to get snapshot", "id", wfUUID, "version", version, "requestId", rid, "error", err)
+			writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+			return
+		}
+		wf = &storage.Workflow{
+			ID:       wfUUID,
+			Name:     wf.Name,
+			Nodes:    snap.DagData.Nodes,
+			Edges:    snap.DagData.Edges,
+			Settings: snap.DagData.Settings,
+		}
+	}
+
+	b, err := bundle.FromWorkflow(wf)
+	if err != nil {
+		slog.Error("failed to build bundle", "id", wfUUID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+	b.Source = &bundle.Source{ExportedAt: time.Now().UTC(), SnapshotVersion: version}
+
+	var buf bytes.Buffer
+	if err := bundle.Encode(&buf, b, format); err != nil {
+		slog.Error("failed to encode bundle", "id", wfUUID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", `attachment; filename="`+wfUUID.String()+`.`+string(format)+`"`)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		slog.Error("failed to write response", "id", wfUUID, "requestId", rid, "error", err)
+	}
+}
+
+// HandleImportWorkflow creates or updates a workflow from a bundle. The body
+// format is taken from the "format" query parameter, then the Content-Type,
+// and is otherwise detected from the content.
+//
+// Blueprints are matched against the node library by content hash (see
+// bundle.PlanImport). A blueprint whose library ID already holds different
+// content is created as a copy and reported in "conflicts"; pass
+// onConflict=fail to reject such imports with 409 instead.
+func (s *Service) HandleImportWorkflow(w http.ResponseWriter, r *http.Request) {
+	rid := reqID(r)
+	slog.Debug("importing workflow bundle", "requestId", rid)
+
+	onConflict := r.URL.Query().Get("onConflict")
+	if onConflict != "" && onConflict != "copy" && onConflict != "fail" {
+		writeErrorJSON(w, "INVALID_ON_CONFLICT", "onConflict must be copy or fail", http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBundleBody)
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.Warn("failed to read bundle", "requestId", rid, "error", err)
+		writeErrorJSON(w, "INVALID_BODY", "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	format, err := requestBundleFormat(r, data)
+	if err != nil {
+		writeErrorJSON(w, "INVALID_FORMAT", "format must be json or yaml", http.StatusBadRequest)
+		return
+	}
+
+	b, err := bundle.Decode(bytes.NewReader(data), format)
+	if err != nil {
+		slog.Warn("failed to decode bundle", "requestId", rid, "error", err)
+		writeErrorJSON(w, "INVALID_BUNDLE", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	library, err := s.storage.ListNodeLibrary(ctx)
+	if err != nil {
+		slog.Error("failed to list node library", "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	plan, err := bundle.PlanImport(b, library)
+	if err != nil {
+		slog.Warn("invalid bundle", "requestId", rid, "error", err)
+		writeErrorJSON(w, "INVALID_BUNDLE", err.Error(), http.StatusBadRequest)
+		return
+	}
+	wfUUID := plan.Workflow.ID
+
+	// Make sure every node can be constructed, so the imported workflow can
+	// always be served by GET and executed.
+	if _, err := buildNodeJSONs(plan.Workflow.Nodes, s.deps); err != nil {
+		slog.Warn("bundle contains invalid nodes", "id", wfUUID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INVALID_BUNDLE", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if len(plan.Conflicts) > 0 {
+		slog.Warn("bundle blueprints conflict with node library",
+			"id", wfUUID, "requestId", rid, "conflicts", len(plan.Conflicts), "onConflict", onConflict)
+		if onConflict == "fail" {
+			writeJSON(w, http.StatusConflict, map[string]any{
+				"code":      "CONFLICT",
+				"message":   "bundle blueprints conflict with existing node library entries",
+				"conflicts": plan.Conflicts,
+			}, wfUUID, rid)
+			return
+		}
+	}
+
+	created := false
+	if _, err := s.storage.GetWorkflow(ctx, wfUUID); err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			slog.Error("failed to get workflow", "id", wfUUID, "requestId", rid, "error", err)
+			writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+			return
+		}
+		created = true
+	}
+
+	// The blueprints and the workflow are saved together, so an import that
+	// fails leaves no blueprints behind. A library ID taken by an entry of
+	// another workspace, which the plan could not see, is moved to a new ID.
+	err = s.storage.ImportWorkflow(ctx, plan.Workflow, plan.Create)
+	for attempt := 0; attempt < len(plan.Create); attempt++ {
+		var taken *storage.LibraryIDTakenError
+		if !errors.As(err, &taken) {
+			break
+		}
+		i := slices.IndexFunc(plan.Create, func(e storage.NodeLibraryEntry) bool { return e.ID == taken.ID })
+		if i < 0 {
+			break
+		}
+		slog.Info("library id taken in another workspace", "id", wfUUID, "libraryId", taken.ID, "newLibraryId", plan.Reassign(i), "requestId", rid)
+		err = s.storage.ImportWorkflow(ctx, plan.Workflow, plan.Create)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrOtherWorkspace):
+			slog.Warn("imported workflow id belongs to another workspace", "id", wfUUID, "requestId", rid)
+			writeErrorJSON(w, "ID_TAKEN", "workflow id is taken in another workspace", http.StatusConflict)
+		case errors.Is(err, storage.ErrQuotaExceeded):
+			slog.Warn("workflow quota exceeded", "id", wfUUID, "requestId", rid, "error", err)
+			writeErrorJSON(w, "QUOTA_EXCEEDED", err.Error(), http.StatusTooManyRequests)
+		default:
+			slog.Error("failed to save imported workflow", "id", wfUUID, "requestId", rid, "error", err)
+			writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	slog.Info("imported workflow bundle",
+		"id", wfUUID, "principal", principal(r), "requestId", rid, "created", created,
+		"blueprintsCreated", len(plan.Create), "conflicts", len(plan.Conflicts))
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	conflicts := plan.Conflicts
+	if conflicts == nil {
+		conflicts = []bundle.Conflict{}
+	}
+	writeJSON(w, status, map[string]any{
+		"workflowId": wfUUID,
+		"name":       plan.Workflow.Name,
+		"created":    created,
+		"blueprints": plan.Blueprints,
+		"conflicts":  conflicts,
+	}, wfUUID, rid)
+}
+
+// requestBundleFormat picks the bundle format for an import request.
+func requestBundleFormat(r *http.Request, body []byte) (bundle.Format, error) {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return bundle.ParseFormat(f)
+	}
+	ct := r.Header.Get("Content-Type")
+	switch {
+	case strings.Contains(ct, "yaml"):
+		return bundle.FormatYAML, nil
+	case strings.Contains(ct, "json"):
+		return bundle.FormatJSON, nil
+	}
+	return bundle.DetectFormat(body), nil
+}
+
+// writeJSON marshals v and writes it with the given status.
+func writeJSON(w http.ResponseWriter, status int, v any, id uuid.UUID, rid string) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("failed to marshal response", "id", id, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(status)
+	if _, err := w.Write(payload); err != nil {
+		slog.Error("failed to write response", "id", id, "requestId", rid, "error", err)
+	}
+}
@@ -0,0 +1,366 @@
+package workflow_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"workflow-code-test/api/services/bundle"
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/storage"
+	"workflow-code-test/api/services/storage/storagemock"
+	"workflow-code-test/api/services/workflow"
+)
+
+func newBundleTestService(t *testing.T, store storage.Storage) http.Handler {
+	t.Helper()
+	svc, err := workflow.NewService(store, nodes.Deps{})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	return newTestRouter(svc)
+}
+
+func newMemoryStore(t *testing.T, fixtures storage.Fixtures) storage.Storage {
+	t.Helper()
+	store, err := storage.NewMemoryInstance(fixtures)
+	if err != nil {
+		t.Fatalf("NewMemoryInstance: %v", err)
+	}
+	return store
+}
+
+func exportBundle(t *testing.T, router http.Handler, url string) []byte {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("export: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	return rec.Body.Bytes()
+}
+
+func TestHandleExportWorkflow(t *testing.T) {
+	t.Parallel()
+
+	wfURL := "/api/v1/workflows/" + storage.SeedWeatherWorkflowID.String()
+	tests := []struct {
+		name       string
+		url        string
+		store      storage.Storage
+		wantStatus int
+		wantType   string
+		checkBody  func(t *testing.T, body []byte)
+	}{
+		{
+			name:       "invalid UUID returns 400",
+			url:        "/api/v1/workflows/not-a-uuid/export",
+			store:      &storagemock.StorageMock{},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unsupported format returns 400",
+			url:        wfURL + "/export?format=xml",
+			store:      &storagemock.StorageMock{},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid version returns 400",
+			url:        wfURL + "/export?version=0",
+			store:      &storagemock.StorageMock{},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "workflow not found returns 404",
+			url:  wfURL + "/export",
+			store: &storagemock.StorageMock{
+				GetWorkflowMock: func(ctx context.Context, id uuid.UUID) (*storage.Workflow, error) {
+					return nil, pgx.ErrNoRows
+				},
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "unknown snapshot version returns 404",
+			url:        wfURL + "/export?version=3",
+			store:      &storagemock.StorageMock{},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "exports JSON bundle by default",
+			url:        wfURL + "/export",
+			store:      newMemoryStore(t, storage.SeedFixtures()),
+			wantStatus: http.StatusOK,
+			wantType:   "application/json",
+			checkBody: func(t *testing.T, body []byte) {
+				b, err := bundle.Decode(bytes.NewReader(body), bundle.FormatJSON)
+				if err != nil {
+					t.Fatalf("Decode: %v", err)
+				}
+				if err := b.Validate(); err != nil {
+					t.Fatalf("exported bundle is invalid: %v", err)
+				}
+				if len(b.Workflow.Nodes) != 6 || len(b.Blueprints) != 6 {
+					t.Errorf("expected 6 nodes and 6 blueprints, got %d and %d", len(b.Workflow.Nodes), len(b.Blueprints))
+				}
+				if b.Source == nil || b.Source.ExportedAt.IsZero() || b.Source.SnapshotVersion != 0 {
+					t.Errorf("unexpected source %+v", b.Source)
+				}
+			},
+		},
+		{
+			name:       "exports YAML bundle",
+			url:        wfURL + "/export?format=yaml",
+			store:      newMemoryStore(t, storage.SeedFixtures()),
+			wantStatus: http.StatusOK,
+			wantType:   "application/yaml",
+			checkBody: func(t *testing.T, body []byte) {
+				if !strings.HasPrefix(string(body), "apiVersion: "+bundle.APIVersion) {
+					t.Errorf("expected YAML document, got %s", body)
+				}
+			},
+		},
+		{
+			name: "exports a published snapshot",
+			url:  wfURL + "/export?version=1",
+			store: &storagemock.StorageMock{
+				GetSnapshotMock: func(ctx context.Context, id uuid.UUID, version int) (*storage.WorkflowSnapshot, error) {
+					return &storage.WorkflowSnapshot{
+						WorkflowID:    id,
+						VersionNumber: version,
+						DagData: storage.DagData{
+							Nodes: []storage.Node{{ID: "only", Type: "end", Data: storage.NodeData{Label: "End"}}},
+							Edges: []storage.Edge{},
+						},
+					}, nil
+				},
+			},
+			wantStatus: http.StatusOK,
+			wantType:   "application/json",
+			checkBody: func(t *testing.T, body []byte) {
+				b, err := bundle.Decode(bytes.NewReader(body), bundle.FormatJSON)
+				if err != nil {
+					t.Fatalf("Decode: %v", err)
+				}
+				if b.Source.SnapshotVersion != 1 || len(b.Workflow.Nodes) != 1 || b.Workflow.Nodes[0].ID != "only" {
+					t.Errorf("expected snapshot v1 contents, got %+v", b)
+				}
+				if b.Workflow.Name != "Weather Check System" {
+					t.Errorf("expected workflow name from header, got %q", b.Workflow.Name)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			router := newBundleTestService(t, tt.store)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.url, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantType != "" && rec.Header().Get("Content-Type") != tt.wantType {
+				t.Errorf("expected Content-Type %s, got %s", tt.wantType, rec.Header().Get("Content-Type"))
+			}
+			if tt.checkBody != nil {
+				tt.checkBody(t, rec.Body.Bytes())
+			}
+		})
+	}
+}
+
+func TestHandleImportWorkflow_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	for _, format := range []string{"json", "yaml"} {
+		t.Run(format, func(t *testing.T) {
+			t.Parallel()
+			source := newMemoryStore(t, storage.SeedFixtures())
+			target := newMemoryStore(t, storage.Fixtures{})
+			exported := exportBundle(t, newBundleTestService(t, source),
+				"/api/v1/workflows/"+storage.SeedLoopWorkflowID.String()+"/export?format="+format)
+
+			targetRouter := newBundleTestService(t, target)
+			importOnce := func(wantStatus int) map[string]any {
+				t.Helper()
+				rec := httptest.NewRecorder()
+				targetRouter.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/workflows/import", bytes.NewReader(exported)))
+				if rec.Code != wantStatus {
+					t.Fatalf("import: expected %d, got %d: %s", wantStatus, rec.Code, rec.Body.String())
+				}
+				var resp map[string]any
+				if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+					t.Fatalf("invalid response: %v", err)
+				}
+				return resp
+			}
+
+			first := importOnce(http.StatusCreated)
+			if first["created"] != true {
+				t.Errorf("expected created=true, got %v", first["created"])
+			}
+
+			// Importing again updates the workflow and reuses every blueprint.
+			second := importOnce(http.StatusOK)
+			for _, bp := range second["blueprints"].([]any) {
+				if action := bp.(map[string]any)["action"]; action != string(bundle.BlueprintReused) {
+					t.Errorf("expected all blueprints reused on re-import, got %v", action)
+				}
+			}
+
+			want, _ := source.GetWorkflow(context.Background(), storage.SeedLoopWorkflowID)
+			got, err := target.GetWorkflow(context.Background(), storage.SeedLoopWorkflowID)
+			if err != nil {
+				t.Fatalf("imported workflow not found: %v", err)
+			}
+			wantBundle, _ := bundle.FromWorkflow(want)
+			gotBundle, _ := bundle.FromWorkflow(got)
+			var wantBuf, gotBuf bytes.Buffer
+			_ = bundle.Encode(&wantBuf, wantBundle, bundle.FormatJSON)
+			_ = bundle.Encode(&gotBuf, gotBundle, bundle.FormatJSON)
+			if wantBuf.String() != gotBuf.String() {
+				t.Errorf("imported workflow differs from source\nwant %s\ngot  %s", wantBuf.String(), gotBuf.String())
+			}
+		})
+	}
+}
+
+func TestHandleImportWorkflow(t *testing.T) {
+	t.Parallel()
+
+	exported := exportBundle(t, newBundleTestService(t, newMemoryStore(t, storage.SeedFixtures())),
+		"/api/v1/workflows/"+storage.SeedWeatherWorkflowID.String()+"/export")
+
+	// A target whose copy of the start blueprint was edited locally.
+	conflicting := storage.SeedFixtures()
+	conflicting.Library[0].Label = "Edited in target"
+
+	unknownType := strings.Replace(string(exported), `"nodeType": "end"`, `"nodeType": "teleport"`, 1)
+	unknownType = strings.Replace(unknownType, `"type": "end"`, `"type": "teleport"`, 1)
+
+	tests := []struct {
+		name       string
+		url        string
+		body       string
+		store      storage.Storage
+		wantStatus int
+		checkBody  func(t *testing.T, resp map[string]any)
+	}{
+		{
+			name:       "malformed body returns 400",
+			url:        "/api/v1/workflows/import",
+			body:       `{"apiVersion":`,
+			store:      newMemoryStore(t, storage.SeedFixtures()),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unsupported apiVersion returns 400",
+			url:        "/api/v1/workflows/import",
+			body:       strings.Replace(string(exported), bundle.APIVersion, "workflow.bundle/v9", 1),
+			store:      newMemoryStore(t, storage.SeedFixtures()),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown node type returns 400",
+			url:        "/api/v1/workflows/import",
+			body:       stripHashes(t, unknownType),
+			store:      newMemoryStore(t, storage.SeedFixtures()),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid onConflict returns 400",
+			url:        "/api/v1/workflows/import?onConflict=overwrite",
+			body:       string(exported),
+			store:      newMemoryStore(t, storage.SeedFixtures()),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "conflicting blueprint is copied and reported",
+			url:        "/api/v1/workflows/import",
+			body:       string(exported),
+			store:      newMemoryStore(t, conflicting),
+			wantStatus: http.StatusOK,
+			checkBody: func(t *testing.T, resp map[string]any) {
+				conflicts := resp["conflicts"].([]any)
+				if len(conflicts) != 1 {
+					t.Fatalf("expected 1 conflict, got %v", conflicts)
+				}
+				if id := conflicts[0].(map[string]any)["libraryId"]; id != conflicting.Library[0].ID {
+					t.Errorf("expected conflict on %s, got %v", conflicting.Library[0].ID, id)
+				}
+			},
+		},
+		{
+			name:       "conflicting blueprint with onConflict=fail returns 409",
+			url:        "/api/v1/workflows/import?onConflict=fail",
+			body:       string(exported),
+			store:      newMemoryStore(t, conflicting),
+			wantStatus: http.StatusConflict,
+			checkBody: func(t *testing.T, resp map[string]any) {
+				if resp["code"] != "CONFLICT" || len(resp["conflicts"].([]any)) != 1 {
+					t.Errorf("unexpected conflict response %v", resp)
+				}
+			},
+		},
+		{
+			name: "storage error returns 500",
+			url:  "/api/v1/workflows/import",
+			body: string(exported),
+			store: &storagemock.StorageMock{
+				ImportWorkflowMock: func(ctx context.Context, wf *storage.Workflow, entries []storage.NodeLibraryEntry) error {
+					return pgx.ErrTxClosed
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			router := newBundleTestService(t, tt.store)
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tt.url, strings.NewReader(tt.body)))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.checkBody != nil {
+				var resp map[string]any
+				if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+					t.Fatalf("invalid response: %v", err)
+				}
+				tt.checkBody(t, resp)
+			}
+		})
+	}
+}
+
+// stripHashes clears blueprint hashes so an edited bundle still validates.
+func stripHashes(t *testing.T, body string) string {
+	t.Helper()
+	b, err := bundle.Decode(strings.NewReader(body), bundle.FormatJSON)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	for i := range b.Blueprints {
+		b.Blueprints[i].Hash = ""
+	}
+	var buf bytes.Buffer
+	if err := bundle.Encode(&buf, b, bundle.FormatJSON); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	return buf.String()
+}
@@ -0,0 +1,279 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/services/nodes"
+)
+
+const (
+	// debugIdleTimeout is how long a debug session survives without requests.
+	debugIdleTimeout = 15 * time.Minute
+
+	// maxDebugSessions bounds the memory held by abandoned sessions that
+	// have not yet expired.
+	maxDebugSessions = 100
+)
+
+// Pause reasons reported by a debug session.
+const (
+	pauseStart      = "start"
+	pauseStep       = "step"
+	pauseBreakpoint = "breakpoint"
+)
+
+// Breakpoint pauses a debug session before a node executes. NodeID limits
+// it to one node; Condition limits it to moments when the variables match.
+// When both are set, both must hold.
+type Breakpoint struct {
+	NodeID    string          `json:"nodeId,omitempty"`
+	Condition *BreakCondition `json:"condition,omitempty"`
+}
+
+// BreakCondition compares a variable against a value with the condition
+// node's operators. equal_to also matches non-numeric values by their JSON
+// form. An unset variable never matches.
+type BreakCondition struct {
+	Variable string         `json:"variable"`
+	Operator nodes.Operator `json:"operator"`
+	Value    any            `json:"value"`
+}
+
+// DebugSession is the state of a debug session returned by every debug
+// endpoint. State is "paused" while the session can still advance,
+// otherwise the final execution status.
+type DebugSession struct {
+	ID            uuid.UUID      `json:"id"`
+	WorkflowID    uuid.UUID      `json:"workflowId"`
+	State         string         `json:"state"`
+	NextNode      string         `json:"nextNode,omitempty"`
+	PauseReason   string         `json:"pauseReason,omitempty"`
+	HitBreakpoint *Breakpoint    `json:"hitBreakpoint,omitempty"`
+	Breakpoints   []Breakpoint   `json:"breakpoints"`
+	Variables     map[string]any `json:"variables"`
+	Steps         []StepResult   `json:"steps"`
+	FailedNode    string         `json:"failedNode,omitempty"`
+	Error         string         `json:"error,omitempty"`
+	ExpiresAt     time.Time      `json:"expiresAt"`
+}
+
+var breakOperators = map[nodes.Operator]bool{
+	nodes.OpGreaterThan:        true,
+	nodes.OpLessThan:           true,
+	nodes.OpEqualTo:            true,
+	nodes.OpGreaterThanOrEqual: true,
+	nodes.OpLessThanOrEqual:    true,
+}
+
+// validateBreakpoints checks breakpoints against the nodes of the graph
+// being debugged.
+func validateBreakpoints(g *compiledWorkflow, bps []Breakpoint) error {
+	for i, bp := range bps {
+		if bp.NodeID == "" && bp.Condition == nil {
+			return fmt.Errorf("breakpoint [%d]: nodeId or condition is required", i)
+		}
+		if bp.NodeID != "" {
+			if _, ok := g.nodes[bp.NodeID]; !ok {
+				return fmt.Errorf("breakpoint [%d]: unknown node %q", i, bp.NodeID)
+			}
+		}
+		if c := bp.Condition; c != nil {
+			if c.Variable == "" {
+				return fmt.Errorf("breakpoint [%d]: condition.variable is required", i)
+			}
+			if !breakOperators[c.Operator] {
+				return fmt.Errorf("breakpoint [%d]: unsupported operator %q", i, c.Operator)
+			}
+			if c.Operator != nodes.OpEqualTo {
+				if _, err := nodes.Compare(0, c.Operator, c.Value); err != nil {
+					return fmt.Errorf("breakpoint [%d]: operator %s needs a numeric value", i, c.Operator)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// matches reports whether bp pauses before nodeID given the variables in
+// nCtx. The condition may name a scoped output (nodes.<id>.<key>).
+func (bp Breakpoint) matches(nodeID string, nCtx *nodes.NodeContext) bool {
+	if bp.NodeID != "" && bp.NodeID != nodeID {
+		return false
+	}
+	c := bp.Condition
+	if c == nil {
+		return true
+	}
+	v, ok := nCtx.Lookup(c.Variable)
+	if !ok {
+		return false
+	}
+	met, err := nodes.Compare(v, c.Operator, c.Value)
+	if err != nil {
+		return c.Operator == nodes.OpEqualTo && jsonEqualValues(c.Value, v)
+	}
+	return met
+}
+
+// debugSession is a paused execution driven by debug requests. mu
+// serialises requests on the same session.
+type debugSession struct {
+	mu          sync.Mutex
+	id          uuid.UUID
+	workspace   string
+	workflowID  uuid.UUID
+	exec        *execution
+	secrets     *runSecrets // redacted from every view
+	mask        *runMask    // masked in every view
+	breakpoints []Breakpoint
+	pauseReason string
+	hit         *Breakpoint
+
+	lastUsed time.Time // guarded by debugSessions.mu
+}
+
+// step executes the next node and pauses again.
+func (sess *debugSession) step(ctx context.Context) {
+	sess.hit = nil
+	sess.pauseReason = pauseStep
+	sess.exec.step(ctx)
+}
+
+// resume executes nodes until a breakpoint matches before the next node or
+// the walk finishes. The current node always runs, so resuming from a
+// breakpoint does not stop on it again.
+func (sess *debugSession) resume(ctx context.Context) {
+	sess.hit = nil
+	sess.pauseReason = pauseStep
+	for !sess.exec.step(ctx) {
+		for i := range sess.breakpoints {
+			if sess.breakpoints[i].matches(sess.exec.currentID, sess.exec.nCtx) {
+				bp := sess.breakpoints[i]
+				sess.hit = &bp
+				sess.pauseReason = pauseBreakpoint
+				return
+			}
+		}
+	}
+}
+
+// setVariables merges vars into the execution's variables; nil values
+// remove a variable.
+func (sess *debugSession) setVariables(vars map[string]any) {
+	for k, v := range vars {
+		if v == nil {
+			delete(sess.exec.nCtx.Variables, k)
+			continue
+		}
+		sess.exec.nCtx.Variables[k] = v
+	}
+}
+
+// view returns a copy of the session state that is safe to encode after mu
+// is released, with the values of secrets redacted and sensitive values
+// masked.
+func (sess *debugSession) view(expiresAt time.Time) *DebugSession {
+	e := sess.exec
+	v := &DebugSession{
+		ID:          sess.id,
+		WorkflowID:  sess.workflowID,
+		State:       "paused",
+		Breakpoints: append([]Breakpoint{}, sess.breakpoints...),
+		Variables:   make(map[string]any, len(e.nCtx.Variables)),
+		Steps:       append([]StepResult{}, e.steps...),
+		ExpiresAt:   expiresAt,
+	}
+	for k, val := range e.nCtx.Variables {
+		v.Variables[k] = val
+	}
+	if e.done() {
+		v.State = e.result.Status
+		v.FailedNode = e.result.FailedNode
+		v.Error = e.result.Error
+	} else {
+		v.NextNode = e.currentID
+		v.PauseReason = sess.pauseReason
+		v.HitBreakpoint = sess.hit
+	}
+	if sess.secrets != nil {
+		if r := sess.secrets.redactor(); r != nil {
+			v.Steps = redactSteps(r, v.Steps)
+			v.Variables = redactMap(r, v.Variables)
+			v.Error = r.Redact(v.Error)
+		}
+	}
+	if sess.mask != nil {
+		mk := sess.mask.masker(e.nCtx, v.Steps)
+		v.Steps = maskSteps(mk, v.Steps)
+		v.Variables = mk.Map(v.Variables)
+		v.Error = mk.String(v.Error)
+	}
+	return v
+}
+
+// debugSessions holds the live debug sessions of a Service. Sessions
+// expire after idle without requests; expired sessions are dropped lazily.
+type debugSessions struct {
+	mu       sync.Mutex
+	sessions map[uuid.UUID]*debugSession
+	idle     time.Duration
+	now      func() time.Time
+}
+
+func newDebugSessions() *debugSessions {
+	return &debugSessions{
+		sessions: make(map[uuid.UUID]*debugSession),
+		idle:     debugIdleTimeout,
+		now:      time.Now,
+	}
+}
+
+// add registers a new session, first dropping expired ones, and returns
+// when it expires.
+func (m *debugSessions) add(sess *debugSession) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	for id, s := range m.sessions {
+		if now.Sub(s.lastUsed) > m.idle {
+			delete(m.sessions, id)
+		}
+	}
+	if len(m.sessions) >= maxDebugSessions {
+		return time.Time{}, fmt.Errorf("too many debug sessions (max %d)", maxDebugSessions)
+	}
+	sess.lastUsed = now
+	m.sessions[sess.id] = sess
+	return now.Add(m.idle), nil
+}
+
+// get returns a live session of workflowID in workspace and extends its
+// lifetime.
+func (m *debugSessions) get(id uuid.UUID, workspace string, workflowID uuid.UUID) (*debugSession, time.Time, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sess, ok := m.sessions[id]
+	if !ok || sess.workspace != workspace || sess.workflowID != workflowID {
+		return nil, time.Time{}, false
+	}
+	now := m.now()
+	if now.Sub(sess.lastUsed) > m.idle {
+		delete(m.sessions, id)
+		return nil, time.Time{}, false
+	}
+	sess.lastUsed = now
+	return sess, now.Add(m.idle), true
+}
+
+func (m *debugSessions) remove(id uuid.UUID) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, id)
+}
@@ -0,0 +1,237 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/storage"
+)
+
+// startDebugBody is the request body of HandleStartDebugSession.
+type startDebugBody struct {
+	Inputs      map[string]any `json:"inputs"`
+	Breakpoints []Breakpoint   `json:"breakpoints"`
+	DryRun      bool           `json:"dryRun"`
+}
+
+// HandleStartDebugSession compiles the graph that the execute endpoint
+// would run and creates a debug session paused before the start node. The
+// session is advanced with the step and continue endpoints.
+func (s *Service) HandleStartDebugSession(w http.ResponseWriter, r *http.Request) {
+	rid := reqID(r)
+	id := mux.Vars(r)["id"]
+	slog.Debug("starting debug session", "id", id, "requestId", rid)
+
+	wfUUID, err := uuid.Parse(id)
+	if err != nil {
+		slog.Warn("invalid workflow id", "id", id, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INVALID_ID", "invalid workflow id", http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+	var body startDebugBody
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		slog.Warn("failed to decode debug session body", "id", wfUUID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INVALID_BODY", "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	wf, _, err := s.loadExecutable(r.Context(), wfUUID, rid)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			slog.Warn("workflow not found for debug session", "id", wfUUID, "requestId", rid)
+			writeErrorJSON(w, "NOT_FOUND", "workflow not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to load workflow for debug session", "id", wfUUID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	sec := newRunSecrets(s.lookupSecret)
+	expanded, err := sec.expand(r.Context(), wf)
+	if err != nil {
+		if errors.Is(err, ErrSecretNotSet) {
+			writeErrorJSON(w, "SECRET_NOT_SET", err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		slog.Error("failed to expand secrets for debug session", "id", wfUUID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+	g, err := compileWorkflow(expanded, sharedDeps(s.deps))
+	if err != nil {
+		slog.Error("failed to compile workflow for debug session", "id", wfUUID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+	// Sessions live in memory and are stepped by hand; waiting out a delay
+	// would only get the session expired.
+	g.resolve = elapseTimers
+	mask := newRunMask(wf)
+	g.load = mask.wrapLoad(sec.wrapLoad(s.loadWorkflow))
+	if err := validateBreakpoints(g, body.Breakpoints); err != nil {
+		writeErrorJSON(w, "INVALID_BREAKPOINTS", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	nCtx := &nodes.NodeContext{Variables: make(map[string]any)}
+	for k, v := range body.Inputs {
+		nCtx.Variables[k] = v
+	}
+	sess := &debugSession{
+		id:          uuid.New(),
+		workspace:   storage.WorkspaceFrom(r.Context()),
+		workflowID:  wfUUID,
+		exec:        g.start(nCtx, body.DryRun),
+		secrets:     sec,
+		mask:        mask,
+		breakpoints: body.Breakpoints,
+		pauseReason: pauseStart,
+	}
+	expiresAt, err := s.debug.add(sess)
+	if err != nil {
+		slog.Warn("debug session limit reached", "id", wfUUID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "TOO_MANY_SESSIONS", err.Error(), http.StatusTooManyRequests)
+		return
+	}
+
+	slog.Info("started debug session", "id", wfUUID, "session", sess.id, "principal", principal(r), "requestId", rid)
+	writeJSON(w, http.StatusCreated, sess.view(expiresAt), wfUUID, rid)
+}
+
+// HandleGetDebugSession returns the state of a debug session.
+func (s *Service) HandleGetDebugSession(w http.ResponseWriter, r *http.Request) {
+	s.withDebugSession(w, r, false, func(*debugSession, string) bool { return true })
+}
+
+// HandleDebugStep executes the next node of a paused session.
+func (s *Service) HandleDebugStep(w http.ResponseWriter, r *http.Request) {
+	s.withDebugSession(w, r, true, func(sess *debugSession, _ string) bool {
+		ctx, cancel := debugContext(r)
+		defer cancel()
+		sess.step(ctx)
+		return true
+	})
+}
+
+// HandleDebugContinue executes nodes until a breakpoint matches or the
+// execution finishes.
+func (s *Service) HandleDebugContinue(w http.ResponseWriter, r *http.Request) {
+	s.withDebugSession(w, r, true, func(sess *debugSession, _ string) bool {
+		ctx, cancel := debugContext(r)
+		defer cancel()
+		sess.resume(ctx)
+		return true
+	})
+}
+
+// HandleSetBreakpoints replaces the breakpoints of a session. Breakpoints
+// can also be changed after the session has finished, which is harmless.
+func (s *Service) HandleSetBreakpoints(w http.ResponseWriter, r *http.Request) {
+	s.withDebugSession(w, r, false, func(sess *debugSession, rid string) bool {
+		var body struct {
+			Breakpoints []Breakpoint `json:"breakpoints"`
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil {
+			slog.Warn("failed to decode breakpoints", "session", sess.id, "requestId", rid, "error", err)
+			writeErrorJSON(w, "INVALID_BODY", "invalid request body", http.StatusBadRequest)
+			return false
+		}
+		if err := validateBreakpoints(sess.exec.g, body.Breakpoints); err != nil {
+			writeErrorJSON(w, "INVALID_BREAKPOINTS", err.Error(), http.StatusBadRequest)
+			return false
+		}
+		sess.breakpoints = body.Breakpoints
+		return true
+	})
+}
+
+// HandlePatchDebugVariables edits the variables of a paused session with
+// JSON merge patch semantics: each key is set, and null removes it.
+func (s *Service) HandlePatchDebugVariables(w http.ResponseWriter, r *http.Request) {
+	s.withDebugSession(w, r, true, func(sess *debugSession, rid string) bool {
+		var vars map[string]any
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+		if err := json.NewDecoder(r.Body).Decode(&vars); err != nil {
+			slog.Warn("failed to decode variables", "session", sess.id, "requestId", rid, "error", err)
+			writeErrorJSON(w, "INVALID_BODY", "invalid request body", http.StatusBadRequest)
+			return false
+		}
+		sess.setVariables(vars)
+		return true
+	})
+}
+
+// HandleDeleteDebugSession ends a debug session.
+func (s *Service) HandleDeleteDebugSession(w http.ResponseWriter, r *http.Request) {
+	s.withDebugSession(w, r, false, func(sess *debugSession, rid string) bool {
+		s.debug.remove(sess.id)
+		slog.Info("ended debug session", "id", sess.workflowID, "session", sess.id, "requestId", rid)
+		w.WriteHeader(http.StatusNoContent)
+		return false
+	})
+}
+
+// withDebugSession resolves the session in the URL, runs fn with the
+// session locked and writes the resulting state when fn returns true. fn
+// writes its own response when it returns false. When paused is set, a
+// finished session is rejected with 409.
+func (s *Service) withDebugSession(w http.ResponseWriter, r *http.Request, paused bool, fn func(sess *debugSession, rid string) bool) {
+	rid := reqID(r)
+	vars := mux.Vars(r)
+
+	wfUUID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		slog.Warn("invalid workflow id", "id", vars["id"], "requestId", rid, "error", err)
+		writeErrorJSON(w, "INVALID_ID", "invalid workflow id", http.StatusBadRequest)
+		return
+	}
+	sessionID, err := uuid.Parse(vars["sessionId"])
+	if err != nil {
+		slog.Warn("invalid debug session id", "session", vars["sessionId"], "requestId", rid, "error", err)
+		writeErrorJSON(w, "INVALID_ID", "invalid debug session id", http.StatusBadRequest)
+		return
+	}
+
+	sess, expiresAt, ok := s.debug.get(sessionID, storage.WorkspaceFrom(r.Context()), wfUUID)
+	if !ok {
+		slog.Warn("debug session not found", "id", wfUUID, "session", sessionID, "requestId", rid)
+		writeErrorJSON(w, "NOT_FOUND", "debug session not found or expired", http.StatusNotFound)
+		return
+	}
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if paused && sess.exec.done() {
+		writeErrorJSON(w, "SESSION_FINISHED", "debug session has finished", http.StatusConflict)
+		return
+	}
+	if !fn(sess, rid) {
+		return
+	}
+	writeJSON(w, http.StatusOK, sess.view(expiresAt), wfUUID, rid)
+}
+
+// debugContext detaches node execution from the request, so a client that
+// disconnects mid-step does not cancel the session's execution, while still
+// bounding each request by workflowTimeout.
+func debugContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(r.Context()), workflowTimeout)
+}
@@ -0,0 +1,214 @@
+package workflow_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/pkg/clients/email"
+	"workflow-code-test/api/pkg/clients/flood"
+	"workflow-code-test/api/pkg/clients/sms"
+	"workflow-code-test/api/pkg/clients/weather"
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/storage"
+	"workflow-code-test/api/services/workflow"
+)
+
+func newDebugTestService(t *testing.T) (*workflow.Service, http.Handler) {
+	t.Helper()
+	svc, err := workflow.NewService(newMemoryStore(t, storage.SeedFixtures()), nodes.Deps{
+		Weather: weather.NewStubClient(31.5),
+		Email:   email.NewStubClient("alerts@example.com"),
+		SMS:     sms.NewStubClient(),
+		Flood:   flood.NewStubClient(50),
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	return svc, newTestRouter(svc)
+}
+
+func debugRequest(t *testing.T, router http.Handler, method, url, body string) (*httptest.ResponseRecorder, workflow.DebugSession) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(method, url, strings.NewReader(body)))
+	var sess workflow.DebugSession
+	if rec.Code == http.StatusOK || rec.Code == http.StatusCreated {
+		if err := json.Unmarshal(rec.Body.Bytes(), &sess); err != nil {
+			t.Fatalf("decode session: %v", err)
+		}
+	}
+	return rec, sess
+}
+
+func stepPath(steps []workflow.StepResult) string {
+	ids := make([]string, 0, len(steps))
+	for _, s := range steps {
+		ids = append(ids, s.NodeID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestDebugSession(t *testing.T) {
+	t.Parallel()
+	_, router := newDebugTestService(t)
+	base := "/api/v1/workflows/" + storage.SeedWeatherWorkflowID.String() + "/debug"
+
+	rec, sess := debugRequest(t, router, http.MethodPost, base, `{
+		"inputs": `+weatherInputsJSON+`,
+		"breakpoints": [{"condition": {"variable": "temperature", "operator": "greater_than", "value": 30}}]
+	}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("start: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if sess.State != "paused" || sess.NextNode != "start" || sess.PauseReason != "start" || len(sess.Steps) != 0 {
+		t.Fatalf("expected a session paused before start, got %+v", sess)
+	}
+	url := base + "/" + sess.ID.String()
+
+	_, sess = debugRequest(t, router, http.MethodPost, url+"/step", "")
+	if sess.NextNode != "form" || stepPath(sess.Steps) != "start" {
+		t.Fatalf("expected one step, got %+v", sess)
+	}
+
+	// The weather node sets temperature to 31.5, which trips the breakpoint
+	// before the condition node runs.
+	_, sess = debugRequest(t, router, http.MethodPost, url+"/continue", "")
+	if sess.PauseReason != "breakpoint" || sess.NextNode != "condition" || sess.HitBreakpoint == nil {
+		t.Fatalf("expected to pause on the breakpoint, got %+v", sess)
+	}
+	if sess.Variables["temperature"] != 31.5 {
+		t.Errorf("expected temperature 31.5, got %v", sess.Variables["temperature"])
+	}
+
+	// Cooling the reading while paused sends the run down the false branch.
+	_, sess = debugRequest(t, router, http.MethodPatch, url+"/variables", `{"temperature": 10, "name": null}`)
+	if sess.Variables["temperature"] != 10.0 {
+		t.Errorf("expected edited temperature, got %v", sess.Variables["temperature"])
+	}
+	if _, ok := sess.Variables["name"]; ok {
+		t.Error("expected null to remove the variable")
+	}
+
+	_, sess = debugRequest(t, router, http.MethodPost, url+"/continue", "")
+	if sess.State != "completed" || sess.NextNode != "" {
+		t.Fatalf("expected the session to finish, got %+v", sess)
+	}
+	if got := stepPath(sess.Steps); got != "start,form,weather-api,condition,end" {
+		t.Errorf("expected the false branch, got %s", got)
+	}
+
+	if rec, _ := debugRequest(t, router, http.MethodPost, url+"/step", ""); rec.Code != http.StatusConflict {
+		t.Errorf("step after finish: expected 409, got %d", rec.Code)
+	}
+	if rec, _ := debugRequest(t, router, http.MethodGet, url, ""); rec.Code != http.StatusOK {
+		t.Errorf("get after finish: expected 200, got %d", rec.Code)
+	}
+	if rec, _ := debugRequest(t, router, http.MethodDelete, url, ""); rec.Code != http.StatusNoContent {
+		t.Errorf("delete: expected 204, got %d", rec.Code)
+	}
+	if rec, _ := debugRequest(t, router, http.MethodGet, url, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("get after delete: expected 404, got %d", rec.Code)
+	}
+}
+
+func TestDebugSession_NodeBreakpoints(t *testing.T) {
+	t.Parallel()
+	_, router := newDebugTestService(t)
+	base := "/api/v1/workflows/" + storage.SeedWeatherWorkflowID.String() + "/debug"
+
+	_, sess := debugRequest(t, router, http.MethodPost, base, `{"inputs": `+weatherInputsJSON+`, "dryRun": true}`)
+	url := base + "/" + sess.ID.String()
+
+	rec, sess := debugRequest(t, router, http.MethodPut, url+"/breakpoints", `{"breakpoints": [{"nodeId": "weather-api"}, {"nodeId": "email"}]}`)
+	if rec.Code != http.StatusOK || len(sess.Breakpoints) != 2 {
+		t.Fatalf("set breakpoints: %d %s", rec.Code, rec.Body.String())
+	}
+
+	for _, want := range []string{"weather-api", "email"} {
+		_, sess = debugRequest(t, router, http.MethodPost, url+"/continue", "")
+		if sess.NextNode != want || sess.HitBreakpoint == nil || sess.HitBreakpoint.NodeID != want {
+			t.Fatalf("expected to pause before %s, got %+v", want, sess)
+		}
+	}
+
+	_, sess = debugRequest(t, router, http.MethodPost, url+"/continue", "")
+	if sess.State != "completed" {
+		t.Fatalf("expected completed, got %+v", sess)
+	}
+	if email := sess.Steps[len(sess.Steps)-2]; email.NodeID != "email" || email.Status != "skipped" {
+		t.Errorf("expected the dry-run email step to be skipped, got %+v", email)
+	}
+}
+
+func TestDebugSession_Expiry(t *testing.T) {
+	t.Parallel()
+	svc, router := newDebugTestService(t)
+	var now atomic.Int64
+	now.Store(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).Unix())
+	workflow.SetDebugClock(svc, func() time.Time { return time.Unix(now.Load(), 0) })
+
+	base := "/api/v1/workflows/" + storage.SeedWeatherWorkflowID.String() + "/debug"
+	_, sess := debugRequest(t, router, http.MethodPost, base, `{}`)
+	url := base + "/" + sess.ID.String()
+
+	// Each request extends the idle timeout.
+	now.Add(int64((10 * time.Minute).Seconds()))
+	if rec, _ := debugRequest(t, router, http.MethodGet, url, ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected session to be alive after 10 minutes, got %d", rec.Code)
+	}
+	now.Add(int64((10 * time.Minute).Seconds()))
+	if rec, _ := debugRequest(t, router, http.MethodGet, url, ""); rec.Code != http.StatusOK {
+		t.Fatalf("expected session to be alive 10 minutes after the last request, got %d", rec.Code)
+	}
+	now.Add(int64((16 * time.Minute).Seconds()))
+	if rec, _ := debugRequest(t, router, http.MethodGet, url, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected idle session to expire, got %d", rec.Code)
+	}
+}
+
+func TestDebugSession_Errors(t *testing.T) {
+	t.Parallel()
+	_, router := newDebugTestService(t)
+	base := "/api/v1/workflows/" + storage.SeedWeatherWorkflowID.String() + "/debug"
+	_, sess := debugRequest(t, router, http.MethodPost, base, `{}`)
+	url := base + "/" + sess.ID.String()
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"invalid workflow id", http.MethodPost, "/api/v1/workflows/nope/debug", `{}`, http.StatusBadRequest, "INVALID_ID"},
+		{"unknown workflow", http.MethodPost, "/api/v1/workflows/" + uuid.NewString() + "/debug", `{}`, http.StatusNotFound, "NOT_FOUND"},
+		{"unknown field", http.MethodPost, base, `{"input": {}}`, http.StatusBadRequest, "INVALID_BODY"},
+		{"breakpoint on unknown node", http.MethodPost, base, `{"breakpoints": [{"nodeId": "nope"}]}`, http.StatusBadRequest, "INVALID_BREAKPOINTS"},
+		{"empty breakpoint", http.MethodPut, url + "/breakpoints", `{"breakpoints": [{}]}`, http.StatusBadRequest, "INVALID_BREAKPOINTS"},
+		{"numeric operator with string", http.MethodPut, url + "/breakpoints", `{"breakpoints": [{"condition": {"variable": "city", "operator": "less_than", "value": "x"}}]}`, http.StatusBadRequest, "INVALID_BREAKPOINTS"},
+		{"invalid session id", http.MethodGet, base + "/nope", "", http.StatusBadRequest, "INVALID_ID"},
+		{"unknown session", http.MethodGet, base + "/" + uuid.NewString(), "", http.StatusNotFound, "NOT_FOUND"},
+		{"session of another workflow", http.MethodGet, "/api/v1/workflows/" + storage.SeedFloodWorkflowID.String() + "/debug/" + sess.ID.String(), "", http.StatusNotFound, "NOT_FOUND"},
+		{"invalid variables", http.MethodPatch, url + "/variables", `[1]`, http.StatusBadRequest, "INVALID_BODY"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, _ := debugRequest(t, router, tt.method, tt.url, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			var body map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["code"] != tt.wantCode {
+				t.Errorf("expected code %s, got %s", tt.wantCode, rec.Body.String())
+			}
+		})
+	}
+}
@@ -2,9 +2,16 @@ package workflow
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"workflow-code-test/api/pkg/redact"
 	"workflow-code-test/api/services/nodes"
 	"workflow-code-test/api/services/storage"
 )
@@ -20,6 +27,10 @@ const (
 	// workflowTimeout bounds the total execution time across all nodes.
 	// Without this, a long chain of nodes could block the HTTP handler indefinitely.
 	workflowTimeout = 60 * time.Second
+
+	// maxSubworkflowDepth bounds how deeply subworkflow nodes may nest.
+	// Cycles are rejected outright; this catches long acyclic chains.
+	maxSubworkflowDepth = 5
 )
 
 // StepResult captures the outcome of executing a single node.
@@ -32,18 +43,58 @@ type StepResult struct {
 	DurationMs  int64          `json:"durationMs"`
 	Output      map[string]any `json:"output,omitempty"`
 	Error       string         `json:"error,omitempty"`
+	Steps       []StepResult   `json:"steps,omitempty"`     // the child's or loop body's steps, for subworkflow and foreach nodes
+	Iteration   *int           `json:"iteration,omitempty"` // the item index, for steps of a foreach body
 }
 
 // ExecutionResponse is the JSON response for the execute endpoint.
 // On failure, Status is "failed", FailedNode identifies which node
 // broke, and Steps contains partial results up to and including the
-// failed node.
+// failed node. A run suspended at an approval, input or timer node has
+// Status "waiting" and WaitingFor describes the task or timer it waits on.
 type ExecutionResponse struct {
 	ExecutedAt string       `json:"executedAt"`
+	Mode       string       `json:"mode,omitempty"` // "dry-run" when side effects were skipped
 	Status     string       `json:"status"`
 	Steps      []StepResult `json:"steps"`
 	FailedNode string       `json:"failedNode,omitempty"`
 	Error      string       `json:"error,omitempty"`
+	RunID      *uuid.UUID   `json:"runId,omitempty"` // set when the run was recorded
+	WaitingFor *Waiting     `json:"waitingFor,omitempty"`
+
+	calls     []RecordedCall // integration calls made during the run
+	suspended *runState      // set while Status is "waiting"
+	mask      *redact.Masker // masks the run's sensitive values wherever else the run is stored
+}
+
+// Waiting describes the task or timer a suspended run waits on. TaskID and
+// ExpiresAt are filled in when a task is stored; a timer (Kind "timer") has
+// only ResumeAt.
+type Waiting struct {
+	NodeID    string     `json:"nodeId"`
+	TaskID    *uuid.UUID `json:"taskId,omitempty"`
+	Kind      string     `json:"kind"`
+	Assignee  string     `json:"assignee,omitempty"`
+	Title     string     `json:"title,omitempty"`
+	Fields    []string   `json:"fields,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	ResumeAt  *time.Time `json:"resumeAt,omitempty"`
+
+	timeout time.Duration // 0 means the task never expires
+}
+
+// runState is what a suspended run persists so it can be resumed later,
+// possibly by another API instance. The graph is kept with the state so
+// edits to the draft do not affect runs already in flight.
+type runState struct {
+	WorkflowID uuid.UUID                `json:"workflowId,omitempty"`
+	NodeID     string                   `json:"nodeId"`
+	Nodes      []storage.Node           `json:"nodes"`
+	Edges      []storage.Edge           `json:"edges"`
+	Settings   storage.WorkflowSettings `json:"settings"`
+	Variables  map[string]any           `json:"variables"`
+	DryRun     bool                     `json:"dryRun,omitempty"`
+	Mocks      map[string]MockResponse  `json:"mocks,omitempty"`
 }
 
 // edgeTarget represents a single outgoing edge from a node.
@@ -53,16 +104,583 @@ type edgeTarget struct {
 	SourceHandle *string
 }
 
+// ModeDryRun is the execution mode that skips side effects.
+const ModeDryRun = "dry-run"
+
+// ExecuteOptions changes how a workflow is executed. The zero value runs
+// every node live.
+type ExecuteOptions struct {
+	// DryRun renders the payloads of nodes with side effects (email, SMS)
+	// into their step output instead of delivering them.
+	DryRun bool
+	// Mocks answers the integration calls of the listed nodes from recorded
+	// responses instead of the live clients. Only used with DryRun.
+	Mocks map[string]MockResponse
+	// Workflows loads the workflows subworkflow nodes call. Without it
+	// those nodes fail.
+	Workflows WorkflowLoader
+	// Secrets looks up the secrets node metadata refers to. Without it
+	// {{secret:NAME}} references reach the nodes as "[secret:NAME]".
+	Secrets SecretLookup
+}
+
+// WorkflowLoader loads the graph a subworkflow node calls: the published
+// snapshot version, or with version 0 what the workflow would execute on
+// its own. A missing workflow is reported as pgx.ErrNoRows.
+type WorkflowLoader func(ctx context.Context, id uuid.UUID, version int) (*storage.Workflow, error)
+
+// Execute runs a workflow outside the HTTP layer, e.g. from the wfctl CLI.
+// It goes through the same construction, validation and graph walk as the
+// execute endpoint and stamps ExecutedAt on the result.
+func Execute(ctx context.Context, wf *storage.Workflow, inputs map[string]any, deps nodes.Deps, opts ExecuteOptions) (*ExecutionResponse, error) {
+	executedAt := time.Now().Format(time.RFC3339)
+	result, err := executeWorkflow(ctx, wf, inputs, deps, opts)
+	if err != nil {
+		return nil, err
+	}
+	result.ExecutedAt = executedAt
+	return result, nil
+}
+
+// Validate constructs and validates every node and checks the graph
+// structure, returning the first problem that would make executeWorkflow
+// fail before running any node. Secrets are not read.
+func Validate(wf *storage.Workflow, deps nodes.Deps) error {
+	expanded, _ := newRunSecrets(nil).expand(context.Background(), wf)
+	_, err := compileWorkflow(expanded, sharedDeps(deps))
+	return err
+}
+
 // executeWorkflow walks the workflow graph from the start node, executing
 // each node in sequence and following edges (including condition branches).
 // Returns partial results on failure so the caller can show which node broke.
-func executeWorkflow(ctx context.Context, wf *storage.Workflow, inputs map[string]any, deps nodes.Deps) (*ExecutionResponse, error) {
+// The result has the workflow's sensitive variables, email addresses and
+// phone numbers masked.
+func executeWorkflow(ctx context.Context, wf *storage.Workflow, inputs map[string]any, deps nodes.Deps, opts ExecuteOptions) (*ExecutionResponse, error) {
+	depsFor := sharedDeps(deps)
+	if opts.DryRun && len(opts.Mocks) > 0 {
+		depsFor = mockedDeps(deps, opts.Mocks)
+	}
+	sec := newRunSecrets(opts.Secrets)
+	expanded, err := sec.expand(ctx, wf)
+	if err != nil {
+		return nil, err
+	}
+	rec := &callRecorder{}
+	g, err := compileWorkflow(expanded, rec.wrap(depsFor))
+	if err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		g.resolve = elapseTimers
+	}
+	mask := newRunMask(wf)
+	g.load = mask.wrapLoad(sec.wrapLoad(opts.Workflows))
+
+	nCtx := &nodes.NodeContext{Variables: make(map[string]any)}
+	for k, v := range inputs {
+		nCtx.Variables[k] = v
+	}
+	result := g.run(ctx, nCtx, opts.DryRun)
+	finishResult(result, wf, opts, rec)
+	sec.redact(result)
+	mask.apply(result, nCtx)
+	return result, nil
+}
+
+// resumeWorkflow continues a suspended run from its persisted state. steps
+// are the steps recorded so far, ending with the waiting node, and res is
+// the response to that node's task. load is passed on to subworkflow nodes;
+// lookup expands the secrets the graph refers to, which the persisted state
+// keeps as references.
+func resumeWorkflow(ctx context.Context, state *runState, steps []StepResult, deps nodes.Deps, res nodes.Resolution, load WorkflowLoader, lookup SecretLookup) (*ExecutionResponse, error) {
+	opts := ExecuteOptions{DryRun: state.DryRun, Mocks: state.Mocks, Workflows: load, Secrets: lookup}
+	depsFor := sharedDeps(deps)
+	if opts.DryRun && len(opts.Mocks) > 0 {
+		depsFor = mockedDeps(deps, opts.Mocks)
+	}
+	sec := newRunSecrets(opts.Secrets)
+	wf := &storage.Workflow{ID: state.WorkflowID, Nodes: state.Nodes, Edges: state.Edges, Settings: state.Settings}
+	expanded, err := sec.expand(ctx, wf)
+	if err != nil {
+		return nil, err
+	}
+	rec := &callRecorder{}
+	g, err := compileWorkflow(expanded, rec.wrap(depsFor))
+	if err != nil {
+		return nil, err
+	}
+	if opts.DryRun {
+		g.resolve = elapseTimers
+	}
+	mask := newRunMask(wf)
+	g.load = mask.wrapLoad(sec.wrapLoad(opts.Workflows))
+	if _, ok := g.nodes[state.NodeID]; !ok || len(steps) == 0 || steps[len(steps)-1].NodeID != state.NodeID {
+		return nil, fmt.Errorf("run state does not match its steps at node %q", state.NodeID)
+	}
+
+	nCtx := &nodes.NodeContext{Variables: make(map[string]any)}
+	for k, v := range state.Variables {
+		nCtx.Variables[k] = v
+	}
+	e := g.start(nCtx, opts.DryRun)
+	e.steps, e.currentID = steps, state.NodeID
+	e.resume(res)
+	result := e.run(ctx)
+	finishResult(result, wf, opts, rec)
+	sec.redact(result)
+	mask.apply(result, nCtx)
+	return result, nil
+}
+
+// elapseTimers is a resolve hook that fires delay and wait_until timers
+// immediately, for executions that are not persisted or resumed later
+// (dry runs, test cases, debug sessions). Tasks still suspend the run.
+func elapseTimers(_ string, s *nodes.Suspension) (nodes.Resolution, bool) {
+	if s.Kind != nodes.SuspendTimer {
+		return nodes.Resolution{}, false
+	}
+	return nodes.Resolution{Outcome: nodes.OutcomeElapsed}, true
+}
+
+// finishResult stamps the mode and recorded calls on a result, and the
+// graph and options a suspended run needs to be resumed.
+func finishResult(result *ExecutionResponse, wf *storage.Workflow, opts ExecuteOptions, rec *callRecorder) {
+	if opts.DryRun {
+		result.Mode = ModeDryRun
+	}
+	result.calls = rec.recorded()
+	if result.suspended != nil {
+		result.suspended.WorkflowID = wf.ID
+		result.suspended.Nodes = wf.Nodes
+		result.suspended.Edges = wf.Edges
+		result.suspended.Settings = wf.Settings
+		result.suspended.DryRun = opts.DryRun
+		result.suspended.Mocks = opts.Mocks
+	}
+}
+
+// run walks the compiled graph from the start node. Node outputs are merged
+// into nCtx, so the caller can inspect the final variables afterwards.
+// With dryRun set, nodes that declare side effects are previewed instead of
+// executed.
+func (g *compiledWorkflow) run(ctx context.Context, nCtx *nodes.NodeContext, dryRun bool) *ExecutionResponse {
+	return g.start(nCtx, dryRun).run(ctx)
+}
+
+// run steps the execution until it finishes or suspends.
+func (e *execution) run(ctx context.Context) *ExecutionResponse {
 	ctx, cancel := context.WithTimeout(ctx, workflowTimeout)
 	defer cancel()
 
+	for !e.step(ctx) {
+	}
+	return e.result
+}
+
+// execution is an in-progress walk of a compiled graph. run drives it to
+// the end in one go; debug sessions advance it one node at a time.
+type execution struct {
+	g         *compiledWorkflow
+	nCtx      *nodes.NodeContext
+	dryRun    bool
+	steps     []StepResult
+	currentID string             // next node to execute
+	result    *ExecutionResponse // set once the walk has finished
+
+	// callers are the workflows on the subworkflow call stack, ending with
+	// this one, for cycle detection.
+	callers []uuid.UUID
+	// loop is the foreach node whose body this walk runs; reaching it again
+	// ends the iteration.
+	loop string
+}
+
+func (g *compiledWorkflow) start(nCtx *nodes.NodeContext, dryRun bool) *execution {
+	return &execution{g: g, nCtx: nCtx, dryRun: dryRun, currentID: g.startID, callers: []uuid.UUID{g.id}}
+}
+
+// done reports whether the walk has finished.
+func (e *execution) done() bool {
+	return e.result != nil
+}
+
+// step executes the current node and follows its outgoing edge. It returns
+// true once the walk has finished, successfully or not, or has suspended.
+func (e *execution) step(ctx context.Context) bool {
+	if e.done() {
+		return true
+	}
+
+	// Check if the request context has been cancelled (client disconnect, timeout)
+	if err := ctx.Err(); err != nil {
+		return e.finish("cancelled", e.currentID, fmt.Sprintf("execution cancelled: %s", err.Error()))
+	}
+
+	// Guard against runaway workflows
+	if len(e.steps) >= maxExecutionSteps {
+		return e.finish("failed", e.currentID, "workflow exceeded maximum execution steps")
+	}
+
+	node, ok := e.g.nodes[e.currentID]
+	if !ok {
+		return e.finish("failed", e.currentID, fmt.Sprintf("node %q not found in workflow", e.currentID))
+	}
+	info := e.g.info[e.currentID]
+
+	ctx, span := startNodeSpan(ctx, e.g.id, info)
+	start := time.Now()
+	var (
+		result   *nodes.ExecutionResult
+		children []StepResult
+		err      error
+	)
+	if inv, ok := node.(nodes.Invoker); ok {
+		// The child's own nodes are bounded by nodeTimeout; the call as a
+		// whole shares the workflow's deadline.
+		result, children, err = e.invoke(ctx, info.ID, inv)
+	} else if it, ok := node.(nodes.Iterator); ok {
+		result, children, err = e.iterate(ctx, info.ID, it)
+	} else {
+		nodeCtx, cancel := context.WithTimeout(ctx, nodeTimeout)
+		result, err = executeNode(nodeCtx, node, e.nCtx, e.dryRun)
+		cancel()
+	}
+	elapsed := time.Since(start).Milliseconds()
+	if err != nil {
+		endNodeSpan(span, "error", "", err)
+	} else {
+		endNodeSpan(span, result.Status, result.Branch, nil)
+	}
+
+	if err != nil {
+		// Append the failed step with error details, then return partial results
+		e.steps = append(e.steps, StepResult{
+			NodeID:      info.ID,
+			Type:        info.Type,
+			Label:       info.Data.Label,
+			Description: info.Data.Description,
+			Status:      "error",
+			DurationMs:  elapsed,
+			Error:       err.Error(),
+			Steps:       children,
+		})
+		return e.finish("failed", info.ID, fmt.Sprintf("node %q failed: %s", info.ID, err.Error()))
+	}
+
+	e.setOutput(info.ID, result.Output)
+
+	e.steps = append(e.steps, StepResult{
+		NodeID:      info.ID,
+		Type:        info.Type,
+		Label:       info.Data.Label,
+		Description: info.Data.Description,
+		Status:      result.Status,
+		DurationMs:  elapsed,
+		Output:      result.Output,
+		Steps:       children,
+	})
+
+	if s := result.Suspend; s != nil {
+		if e.g.resolve != nil {
+			if res, ok := e.g.resolve(info.ID, s); ok {
+				return e.resume(res)
+			}
+		}
+		return e.suspend(info.ID, s)
+	}
+	return e.advance(result.Branch)
+}
+
+// invoke runs the workflow a subworkflow node calls, starting it with the
+// inputs mapped from this execution's variables, and returns the node's
+// result with the child's steps. The child shares the execution's mode and
+// clients; its integration nodes are keyed "<node>/<child node>" so their
+// mocks and recorded calls do not clash with the parent's.
+func (e *execution) invoke(ctx context.Context, nodeID string, inv nodes.Invoker) (*nodes.ExecutionResult, []StepResult, error) {
+	if e.g.load == nil {
+		return nil, nil, fmt.Errorf("sub-workflows are not available in this execution")
+	}
+	id, version := inv.Target()
+	for i, caller := range e.callers {
+		if caller == id {
+			return nil, nil, fmt.Errorf("sub-workflow cycle: %s", callPath(append(e.callers[i:], id)))
+		}
+	}
+	if len(e.callers) > maxSubworkflowDepth {
+		return nil, nil, fmt.Errorf("sub-workflows nested deeper than %d: %s", maxSubworkflowDepth, callPath(append(e.callers, id)))
+	}
+
+	inputs, err := inv.ChildInputs(e.nCtx)
+	if err != nil {
+		return nil, nil, err
+	}
+	wf, err := e.g.load(ctx, id, version)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil, fmt.Errorf("sub-workflow %s not found", describeTarget(id, version))
+		}
+		return nil, nil, fmt.Errorf("load sub-workflow %s: %w", describeTarget(id, version), err)
+	}
+	g, err := compileWorkflow(wf, func(childID string) nodes.Deps {
+		return e.g.depsFor(nodeID + "/" + childID)
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("sub-workflow %s is invalid: %w", describeTarget(id, version), err)
+	}
+	g.id, g.resolve, g.load = id, e.g.resolve, e.g.load
+
+	child := g.start(&nodes.NodeContext{Variables: inputs}, e.dryRun)
+	child.callers = append(append([]uuid.UUID(nil), e.callers...), id)
+	for !child.step(ctx) {
+	}
+	res := child.result
+	switch res.Status {
+	case "completed":
+	case "waiting":
+		return nil, res.Steps, fmt.Errorf("sub-workflow %s waits at node %q; sub-workflows cannot suspend", describeTarget(id, version), res.WaitingFor.NodeID)
+	default:
+		return nil, res.Steps, fmt.Errorf("sub-workflow %s %s: %s", describeTarget(id, version), res.Status, res.Error)
+	}
+	result, err := inv.Complete(child.nCtx.Variables)
+	return result, res.Steps, err
+}
+
+// iterate runs the body of a foreach node once per item, at most the
+// node's concurrency at a time, and returns the node's result with the
+// body steps of every iteration in item order. Each iteration walks the
+// body from the "body" edge until it reaches the foreach node again or a
+// node without outgoing edges. The first failing iteration fails the node
+// and cancels those still running.
+func (e *execution) iterate(ctx context.Context, nodeID string, it nodes.Iterator) (*nodes.ExecutionResult, []StepResult, error) {
+	items, err := it.ListItems(e.nCtx)
+	if err != nil {
+		return nil, nil, err
+	}
+	bodyID := nextNode(e.g.adjacency[nodeID], nodes.BranchBody)
+	if bodyID == "" || bodyID == nodeID {
+		return nil, nil, fmt.Errorf("foreach node has no %q edge", nodes.BranchBody)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make([]*ExecutionResponse, len(items))
+	sem := make(chan struct{}, it.MaxConcurrency())
+	var wg sync.WaitGroup
+	for i, item := range items {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			body := &execution{g: e.g, nCtx: it.Scope(e.nCtx, i, item), dryRun: e.dryRun, currentID: bodyID, callers: e.callers, loop: nodeID}
+			for !body.step(ctx) {
+			}
+			results[i] = body.result
+			if body.result.Status != "completed" {
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	var (
+		steps     []StepResult
+		outputs   = make([]map[string]any, len(items))
+		failure   error
+		cancelled error
+	)
+	for i, res := range results {
+		if res == nil {
+			continue // not started after a failure or cancellation
+		}
+		outputs[i] = make(map[string]any)
+		for _, step := range res.Steps {
+			step.Iteration = &i
+			steps = append(steps, step)
+			for k, v := range step.Output {
+				outputs[i][k] = v
+			}
+		}
+		switch res.Status {
+		case "completed":
+		case "cancelled":
+			// Stopped by a failing iteration, or the whole run was cancelled.
+			if cancelled == nil {
+				cancelled = fmt.Errorf("iteration %d: %s", i, res.Error)
+			}
+		case "waiting":
+			if failure == nil {
+				failure = fmt.Errorf("iteration %d waits at node %q; foreach bodies cannot suspend", i, res.WaitingFor.NodeID)
+			}
+		default:
+			if failure == nil {
+				failure = fmt.Errorf("iteration %d: %s", i, res.Error)
+			}
+		}
+	}
+	if failure == nil {
+		failure = cancelled
+	}
+	if failure != nil {
+		return nil, steps, failure
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, steps, fmt.Errorf("foreach cancelled: %w", err)
+	}
+	return it.Gather(outputs), steps, nil
+}
+
+// describeTarget names a called workflow in errors.
+func describeTarget(id uuid.UUID, version int) string {
+	if version > 0 {
+		return fmt.Sprintf("%s (version %d)", id, version)
+	}
+	return id.String()
+}
+
+// callPath renders a subworkflow call stack as "a -> b -> a".
+func callPath(ids []uuid.UUID) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = id.String()
+	}
+	return strings.Join(parts, " -> ")
+}
+
+// setOutput makes a node's output available to downstream nodes as
+// nodes.<id>.<key> and, unless the workflow opts out, under its flat names.
+func (e *execution) setOutput(nodeID string, output map[string]any) {
+	e.nCtx.SetOutput(nodeID, output)
+	if !e.g.flat {
+		return
+	}
+	for k, v := range output {
+		e.nCtx.Variables[k] = v
+	}
+}
+
+// advance follows the current node's outgoing edge for branch.
+func (e *execution) advance(branch string) bool {
+	e.currentID = nextNode(e.g.adjacency[e.currentID], branch)
+	if e.currentID == "" || e.currentID == e.loop {
+		return e.finish("completed", "", "")
+	}
+	return false
+}
+
+// suspend stops the walk at nodeID until its task is resolved. The node's
+// step stays "waiting" and currentID stays on the node for resume.
+func (e *execution) suspend(nodeID string, s *nodes.Suspension) bool {
+	vars := make(map[string]any, len(e.nCtx.Variables))
+	for k, v := range e.nCtx.Variables {
+		vars[k] = v
+	}
+	e.result = &ExecutionResponse{
+		Status: "waiting",
+		Steps:  e.steps,
+		WaitingFor: &Waiting{
+			NodeID:   nodeID,
+			Kind:     s.Kind,
+			Assignee: s.Assignee,
+			Title:    s.Title,
+			Fields:   s.Fields,
+			timeout:  s.Timeout,
+		},
+		suspended: &runState{NodeID: nodeID, Variables: vars},
+	}
+	if s.Kind == nodes.SuspendTimer {
+		until := s.Until
+		e.result.WaitingFor.ResumeAt = &until
+	}
+	return true
+}
+
+// resume completes the waiting node with the response to its task, fills
+// in its step and follows the branch it picks. It returns true if the walk
+// has finished.
+func (e *execution) resume(res nodes.Resolution) bool {
+	e.result = nil
+	last := &e.steps[len(e.steps)-1]
+
+	r, ok := e.g.nodes[e.currentID].(nodes.Resumer)
+	if !ok {
+		return e.finish("failed", e.currentID, fmt.Sprintf("node %q cannot be resumed", e.currentID))
+	}
+	result, err := r.Resume(e.nCtx, res)
+	if err != nil {
+		last.Status = "error"
+		last.Error = err.Error()
+		return e.finish("failed", e.currentID, fmt.Sprintf("node %q failed: %s", e.currentID, err.Error()))
+	}
+
+	e.setOutput(e.currentID, result.Output)
+	last.Status = result.Status
+	last.Output = result.Output
+	return e.advance(result.Branch)
+}
+
+// finish records the final response. failedNode and errMsg are empty for a
+// completed walk.
+func (e *execution) finish(status, failedNode, errMsg string) bool {
+	e.result = &ExecutionResponse{
+		Status:     status,
+		Steps:      e.steps,
+		FailedNode: failedNode,
+		Error:      errMsg,
+	}
+	e.currentID = ""
+	return true
+}
+
+// executeNode runs a single node, or previews it when dryRun is set and the
+// node has side effects. Nodes with side effects that cannot render a
+// preview are skipped with empty output.
+func executeNode(ctx context.Context, node nodes.Node, nCtx *nodes.NodeContext, dryRun bool) (*nodes.ExecutionResult, error) {
+	if !dryRun || !node.SideEffects() {
+		return node.Execute(ctx, nCtx)
+	}
+	if p, ok := node.(nodes.Previewer); ok {
+		return p.Preview(ctx, nCtx)
+	}
+	return &nodes.ExecutionResult{Status: "skipped", Output: map[string]any{}}, nil
+}
+
+// compiledWorkflow is a workflow whose nodes have been constructed and
+// validated and whose graph structure has been checked.
+type compiledWorkflow struct {
+	id        uuid.UUID // uuid.Nil for workflows that are not stored
+	nodes     map[string]nodes.Node
+	info      map[string]storage.Node // keep storage info for step results
+	adjacency map[string][]edgeTarget
+	startID   string
+
+	// resolve, when set, answers a suspending node's task immediately
+	// instead of suspending the run. Replays use it to apply the responses
+	// recorded with the original run.
+	resolve func(nodeID string, s *nodes.Suspension) (nodes.Resolution, bool)
+
+	// depsFor is what the nodes were constructed with; subworkflow nodes
+	// construct the workflows they call with it too.
+	depsFor func(nodeID string) nodes.Deps
+	// load, when set, loads the workflows subworkflow nodes call.
+	load WorkflowLoader
+	// flat merges node outputs into flat variables as well as nodes.<id>.
+	flat bool
+}
+
+// compileWorkflow runs every check that can be done without executing a node.
+// depsFor returns the clients a node is constructed with; the test runner
+// uses it to give each integration node its own canned responses.
+func compileWorkflow(wf *storage.Workflow, depsFor func(nodeID string) nodes.Deps) (*compiledWorkflow, error) {
 	// 1. Construct typed nodes from storage data
 	nodeMap := make(map[string]nodes.Node)
-	nodeInfo := make(map[string]storage.Node) // keep storage info for step results
+	nodeInfo := make(map[string]storage.Node)
 
 	for _, sn := range wf.Nodes {
 		base := nodes.BaseFields{
@@ -74,7 +692,7 @@ func executeWorkflow(ctx context.Context, wf *storage.Workflow, inputs map[strin
 			Metadata:    sn.Data.Metadata,
 		}
 
-		n, err := nodes.New(base, deps)
+		n, err := nodes.New(base, depsFor(sn.ID))
 		if err != nil {
 			return nil, fmt.Errorf("failed to construct node %q: %w", sn.ID, err)
 		}
@@ -104,95 +722,24 @@ func executeWorkflow(ctx context.Context, wf *storage.Workflow, inputs map[strin
 		return nil, err
 	}
 
-	// 4. Walk the graph, executing each node
-	nCtx := &nodes.NodeContext{Variables: make(map[string]any)}
-	for k, v := range inputs {
-		nCtx.Variables[k] = v
-	}
-
-	var steps []StepResult
-	currentID := startID
-
-	for currentID != "" {
-		// Check if the request context has been cancelled (client disconnect, timeout)
-		if err := ctx.Err(); err != nil {
-			return &ExecutionResponse{
-				Status:     "cancelled",
-				Steps:      steps,
-				FailedNode: currentID,
-				Error:      fmt.Sprintf("execution cancelled: %s", err.Error()),
-			}, nil
-		}
-
-		// Guard against runaway workflows
-		if len(steps) >= maxExecutionSteps {
-			return &ExecutionResponse{
-				Status:     "failed",
-				Steps:      steps,
-				FailedNode: currentID,
-				Error:      "workflow exceeded maximum execution steps",
-			}, nil
-		}
-
-		node, ok := nodeMap[currentID]
-		if !ok {
-			return &ExecutionResponse{
-				Status:     "failed",
-				Steps:      steps,
-				FailedNode: currentID,
-				Error:      fmt.Sprintf("node %q not found in workflow", currentID),
-			}, nil
-		}
-		info := nodeInfo[currentID]
-
-		start := time.Now()
-		nodeCtx, cancel := context.WithTimeout(ctx, nodeTimeout)
-		result, err := node.Execute(nodeCtx, nCtx)
-		cancel()
-		elapsed := time.Since(start).Milliseconds()
+	return &compiledWorkflow{id: wf.ID, nodes: nodeMap, info: nodeInfo, adjacency: adjacency, startID: startID, depsFor: depsFor, flat: !wf.Settings.ScopedOutputsOnly}, nil
+}
 
-		if err != nil {
-			// Append the failed step with error details, then return partial results
-			steps = append(steps, StepResult{
-				NodeID:      info.ID,
-				Type:        info.Type,
-				Label:       info.Data.Label,
-				Description: info.Data.Description,
-				Status:      "error",
-				DurationMs:  elapsed,
-				Error:       err.Error(),
-			})
-			return &ExecutionResponse{
-				Status:     "failed",
-				Steps:      steps,
-				FailedNode: info.ID,
-				Error:      fmt.Sprintf("node %q failed: %s", info.ID, err.Error()),
-			}, nil
-		}
+// sharedDeps constructs every node with the same clients.
+func sharedDeps(deps nodes.Deps) func(string) nodes.Deps {
+	return func(string) nodes.Deps { return deps }
+}
 
-		// Merge output variables into context for downstream nodes
-		for k, v := range result.Output {
-			nCtx.Variables[k] = v
+// mockedDeps constructs nodes listed in mocks with fake clients answering
+// from their recorded response, and every other node with deps.
+func mockedDeps(deps nodes.Deps, mocks map[string]MockResponse) func(string) nodes.Deps {
+	fakes := newFakeIntegrations(mocks)
+	return func(nodeID string) nodes.Deps {
+		if _, ok := mocks[nodeID]; ok {
+			return fakes.depsFor(nodeID)
 		}
-
-		steps = append(steps, StepResult{
-			NodeID:      info.ID,
-			Type:        info.Type,
-			Label:       info.Data.Label,
-			Description: info.Data.Description,
-			Status:      result.Status,
-			DurationMs:  elapsed,
-			Output:      result.Output,
-		})
-
-		// 5. Follow the correct outgoing edge
-		currentID = nextNode(adjacency[currentID], result.Branch)
+		return deps
 	}
-
-	return &ExecutionResponse{
-		Status: "completed",
-		Steps:  steps,
-	}, nil
 }
 
 // validateGraph checks the workflow graph for structural problems before execution.
@@ -2,6 +2,10 @@ package workflow
 
 import (
 	"context"
+	"time"
+
+	"github.com/google/uuid"
+
 	"workflow-code-test/api/services/nodes"
 	"workflow-code-test/api/services/storage"
 )
@@ -9,7 +13,7 @@ import (
 type EdgeTarget = edgeTarget
 
 func ExecuteWorkflow(ctx context.Context, wf *storage.Workflow, inputs map[string]any, deps nodes.Deps) (*ExecutionResponse, error) {
-	return executeWorkflow(ctx, wf, inputs, deps)
+	return executeWorkflow(ctx, wf, inputs, deps, ExecuteOptions{})
 }
 
 func ValidateGraph(storageNodes []storage.Node, adjacency map[string][]edgeTarget) (string, error) {
@@ -19,3 +23,36 @@ func ValidateGraph(storageNodes []storage.Node, adjacency map[string][]edgeTarge
 func NextNode(edges []edgeTarget, branch string) string {
 	return nextNode(edges, branch)
 }
+
+// SetDebugClock replaces the clock used to expire debug sessions.
+func SetDebugClock(s *Service, now func() time.Time) {
+	s.debug.now = now
+}
+
+// SetClock replaces the clock used to set and check task deadlines.
+func SetClock(s *Service, now func() time.Time) {
+	s.now = now
+}
+
+// SetLimitsClock replaces the clock used to refill execution rate limits.
+func SetLimitsClock(s *Service, now func() time.Time) {
+	s.limits.now = now
+}
+
+// SetLimits replaces the execution limits without a reload from storage.
+func SetLimits(s *Service, limits ...storage.ExecutionLimit) {
+	s.limits.set(limits)
+}
+
+// HoldExecution takes the concurrency slots of workflowID and the
+// deployment, as a running execution does, until release is called.
+func HoldExecution(s *Service, workflowID uuid.UUID) (release func()) {
+	release, exceeded := s.limits.acquireSlots([]limitKey{
+		{storage.LimitScopeWorkflow, workflowID.String()},
+		{scope: storage.LimitScopeGlobal},
+	})
+	if exceeded != nil {
+		panic(exceeded.message())
+	}
+	return release
+}
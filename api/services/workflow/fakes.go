@@ -0,0 +1,131 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"workflow-code-test/api/pkg/clients/email"
+	"workflow-code-test/api/pkg/clients/flood"
+	"workflow-code-test/api/pkg/clients/sms"
+	"workflow-code-test/api/pkg/clients/weather"
+	"workflow-code-test/api/services/nodes"
+)
+
+// fakeIntegrations hands every node its own set of fake clients that answer
+// from the test case's mocks and record the messages they are asked to send.
+type fakeIntegrations struct {
+	mocks map[string]MockResponse
+
+	mu   sync.Mutex
+	sent []SentMessage
+}
+
+func newFakeIntegrations(mocks map[string]MockResponse) *fakeIntegrations {
+	return &fakeIntegrations{mocks: mocks}
+}
+
+// depsFor returns the clients node nodeID is constructed with.
+func (f *fakeIntegrations) depsFor(nodeID string) nodes.Deps {
+	c := fakeClient{fakes: f, nodeID: nodeID}
+	return nodes.Deps{
+		Weather: fakeWeather{c},
+		Email:   fakeEmail{c},
+		SMS:     fakeSMS{c},
+		Flood:   fakeFlood{c},
+	}
+}
+
+func (f *fakeIntegrations) messages() []SentMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]SentMessage{}, f.sent...)
+}
+
+func (f *fakeIntegrations) record(msg SentMessage) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, msg)
+}
+
+// fakeClient is the node-scoped state shared by the fake clients.
+type fakeClient struct {
+	fakes  *fakeIntegrations
+	nodeID string
+}
+
+// mock returns the node's canned response, failing when it has none or
+// when it asks for the call to fail.
+func (c fakeClient) mock() (MockResponse, error) {
+	m, ok := c.fakes.mocks[c.nodeID]
+	if !ok {
+		return MockResponse{}, fmt.Errorf("no mock response for node %q", c.nodeID)
+	}
+	if m.Error != "" {
+		return m, errors.New(m.Error)
+	}
+	return m, nil
+}
+
+// failure returns the mocked error for a delivery node, if any. Delivery
+// nodes do not need a mock to succeed.
+func (c fakeClient) failure() error {
+	if m, ok := c.fakes.mocks[c.nodeID]; ok && m.Error != "" {
+		return errors.New(m.Error)
+	}
+	return nil
+}
+
+type fakeWeather struct{ fakeClient }
+
+func (c fakeWeather) GetTemperature(ctx context.Context, lat, lon float64) (float64, error) {
+	m, err := c.mock()
+	if err != nil {
+		return 0, err
+	}
+	if m.Temperature == nil {
+		return 0, fmt.Errorf("mock for node %q has no temperature", c.nodeID)
+	}
+	return weather.NewStubClient(*m.Temperature).GetTemperature(ctx, lat, lon)
+}
+
+type fakeFlood struct{ fakeClient }
+
+func (c fakeFlood) GetFloodRisk(ctx context.Context, lat, lon float64) (*flood.Result, error) {
+	m, err := c.mock()
+	if err != nil {
+		return nil, err
+	}
+	if m.Discharge == nil {
+		return nil, fmt.Errorf("mock for node %q has no discharge", c.nodeID)
+	}
+	result, err := flood.NewStubClient(*m.Discharge).GetFloodRisk(ctx, lat, lon)
+	if err != nil {
+		return nil, err
+	}
+	if m.RiskLevel != "" {
+		result.RiskLevel = m.RiskLevel
+	}
+	return result, nil
+}
+
+type fakeEmail struct{ fakeClient }
+
+func (c fakeEmail) Send(_ context.Context, msg email.Message) (*email.Result, error) {
+	if err := c.failure(); err != nil {
+		return nil, err
+	}
+	c.fakes.record(SentMessage{Node: c.nodeID, Channel: "email", To: msg.To, Subject: msg.Subject, Body: msg.Body})
+	return &email.Result{DeliveryStatus: "sent", Sent: true}, nil
+}
+
+type fakeSMS struct{ fakeClient }
+
+func (c fakeSMS) Send(_ context.Context, msg sms.Message) (*sms.Result, error) {
+	if err := c.failure(); err != nil {
+		return nil, err
+	}
+	c.fakes.record(SentMessage{Node: c.nodeID, Channel: "sms", To: msg.To, Body: msg.Body})
+	return &sms.Result{DeliveryStatus: "sent", Sent: true}, nil
+}
@@ -0,0 +1,150 @@
+package workflow_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/storage"
+	"workflow-code-test/api/services/workflow"
+)
+
+// cityWeather reports each city's latitude as its temperature and tracks
+// how many lookups run at once.
+type cityWeather struct {
+	delay    time.Duration
+	inFlight atomic.Int32
+	peak     atomic.Int32
+}
+
+func (c *cityWeather) GetTemperature(_ context.Context, lat, _ float64) (float64, error) {
+	n := c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+	for p := c.peak.Load(); n > p && !c.peak.CompareAndSwap(p, n); p = c.peak.Load() {
+	}
+	time.Sleep(c.delay)
+	return lat, nil
+}
+
+// buildForeachWorkflow loops a weather lookup over the cities variable:
+//
+//	start -> each -(body)-> lookup -> each -(done)-> end
+func buildForeachWorkflow(concurrency int) *storage.Workflow {
+	withMeta := func(n storage.Node, meta string) storage.Node {
+		n.Data.Metadata = json.RawMessage(meta)
+		return n
+	}
+	return buildWorkflow(
+		[]storage.Node{
+			node("start", "start"),
+			withMeta(node("each", "foreach"), fmt.Sprintf(`{"items":"cities","itemVariable":"city","concurrency":%d,"collect":["temperature"]}`, concurrency)),
+			withMeta(node("lookup", "integration"), `{"apiEndpoint":"https://example.com","inputVariables":["city"],"options":[
+				{"city":"Sydney","lat":-33.8688,"lon":151.2093},
+				{"city":"Melbourne","lat":-37.8136,"lon":144.9631},
+				{"city":"Perth","lat":-31.9505,"lon":115.8605}]}`),
+			node("end", "end"),
+		},
+		[]storage.Edge{
+			edge("e1", "start", "each", nil),
+			edge("e2", "each", "lookup", strPtr(nodes.BranchBody)),
+			edge("e3", "lookup", "each", nil),
+			edge("e4", "each", "end", strPtr(nodes.BranchDone)),
+		},
+	)
+}
+
+func TestForeach_CollectsIterationsInOrder(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		concurrency int
+		wantPeak    int32
+	}{
+		{name: "sequential", concurrency: 1, wantPeak: 1},
+		{name: "concurrent", concurrency: 3, wantPeak: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			client := &cityWeather{delay: 50 * time.Millisecond}
+			inputs := map[string]any{"cities": []any{"Perth", "Sydney", "Melbourne"}}
+			result, err := workflow.ExecuteWorkflow(context.Background(), buildForeachWorkflow(tt.concurrency), inputs, nodes.Deps{Weather: client})
+			if err != nil {
+				t.Fatalf("ExecuteWorkflow: %v", err)
+			}
+			if result.Status != "completed" || stepPath(result.Steps) != "start,each,end" {
+				t.Fatalf("expected the loop to complete, got %s %s: %s", result.Status, stepPath(result.Steps), result.Error)
+			}
+
+			each := result.Steps[1]
+			want := []any{
+				map[string]any{"temperature": -31.9505},
+				map[string]any{"temperature": -33.8688},
+				map[string]any{"temperature": -37.8136},
+			}
+			if !reflect.DeepEqual(each.Output["results"], want) {
+				t.Errorf("expected results in item order, got %v", each.Output["results"])
+			}
+			if len(each.Steps) != 3 {
+				t.Fatalf("expected one body step per item, got %+v", each.Steps)
+			}
+			for i, step := range each.Steps {
+				if step.NodeID != "lookup" || step.Iteration == nil || *step.Iteration != i || step.Output["location"] != inputs["cities"].([]any)[i] {
+					t.Errorf("body step %d: unexpected %+v", i, step)
+				}
+			}
+			if _, leaked := result.Steps[2].Output["temperature"]; leaked {
+				t.Error("expected body outputs to stay in their iteration")
+			}
+			if got := client.peak.Load(); got != tt.wantPeak {
+				t.Errorf("expected %d lookups at once, got %d", tt.wantPeak, got)
+			}
+		})
+	}
+}
+
+func TestForeach_Failures(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cities  any
+		wantErr string
+	}{
+		{name: "failing iteration", cities: []any{"Sydney", "Hobart", "Perth"}, wantErr: `iteration 1: node "lookup" failed: unsupported city: Hobart`},
+		{name: "not a list", cities: "Sydney", wantErr: `variable "cities" is not a list`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			result, err := workflow.ExecuteWorkflow(context.Background(), buildForeachWorkflow(2), map[string]any{"cities": tt.cities}, nodes.Deps{Weather: &cityWeather{}})
+			if err != nil {
+				t.Fatalf("ExecuteWorkflow: %v", err)
+			}
+			if result.Status != "failed" || result.FailedNode != "each" || !strings.Contains(result.Error, tt.wantErr) {
+				t.Errorf("expected the loop to fail with %q, got %s at %q: %s", tt.wantErr, result.Status, result.FailedNode, result.Error)
+			}
+		})
+	}
+}
+
+func TestForeach_EmptyList(t *testing.T) {
+	t.Parallel()
+	result, err := workflow.ExecuteWorkflow(context.Background(), buildForeachWorkflow(1), map[string]any{"cities": []any{}}, nodes.Deps{Weather: &cityWeather{}})
+	if err != nil {
+		t.Fatalf("ExecuteWorkflow: %v", err)
+	}
+	if result.Status != "completed" || len(result.Steps[1].Steps) != 0 {
+		t.Fatalf("expected an empty loop to complete without body steps, got %+v", result)
+	}
+	if got, ok := result.Steps[1].Output["results"].([]any); !ok || len(got) != 0 {
+		t.Errorf("expected an empty result list, got %v", result.Steps[1].Output["results"])
+	}
+}
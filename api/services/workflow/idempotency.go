@@ -0,0 +1,117 @@
+package workflow
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/services/storage"
+)
+
+const (
+	// idempotencyHeader carries the client's key for an execute request.
+	idempotencyHeader = "Idempotency-Key"
+	// maxIdempotencyKeyLength matches the idempotency_keys.key column.
+	maxIdempotencyKeyLength = 255
+	// idempotencyLease is how long a request holds its key in progress.
+	// Executions are cut off after workflowTimeout; the rest leaves time to
+	// store the run and the response. A retry after the lease takes over
+	// the key of a request that crashed or could not store its response.
+	idempotencyLease = 2 * workflowTimeout
+	// DefaultIdempotencyRetention is how long a key and its response are
+	// kept unless SetIdempotencyRetention changes it.
+	DefaultIdempotencyRetention = 24 * time.Hour
+)
+
+// SetIdempotencyRetention sets how long an idempotency key and its stored
+// response are kept. A retry after that runs the workflow again.
+func (s *Service) SetIdempotencyRetention(d time.Duration) {
+	s.idempotencyRetention = d
+}
+
+// requestHash fingerprints an execute request by its mode and decoded body.
+// The body is re-encoded, so whitespace and key order do not matter.
+func requestHash(mode string, body any) (string, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return "", fmt.Errorf("encode request: %w", err)
+	}
+	sum := sha256.Sum256(append([]byte(mode+"\n"), b...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// claimIdempotencyKey claims key for a request with the given hash. If the
+// key is already taken it writes the response this request gets instead
+// and returns nil: the stored response of the original request, or 409
+// while that request is still running or when the bodies differ.
+func (s *Service) claimIdempotencyKey(ctx context.Context, w http.ResponseWriter, wfUUID uuid.UUID, key, hash, rid string) *storage.IdempotencyKey {
+	now := s.now()
+	claim := &storage.IdempotencyKey{
+		WorkflowID:  wfUUID,
+		Key:         key,
+		RequestHash: hash,
+		CreatedAt:   now,
+		LockedUntil: now.Add(idempotencyLease),
+		ExpiresAt:   now.Add(s.idempotencyRetention),
+	}
+	existing, err := s.storage.ClaimIdempotencyKey(ctx, claim)
+	switch {
+	case err == nil:
+		return claim
+	case !errors.Is(err, storage.ErrIdempotencyKeyTaken):
+		slog.Error("failed to claim idempotency key", "id", wfUUID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+	case existing.RequestHash != hash:
+		slog.Warn("idempotency key reused with a different request", "id", wfUUID, "requestId", rid)
+		writeErrorJSON(w, "IDEMPOTENCY_KEY_REUSED", "idempotency key was already used for a different request", http.StatusConflict)
+	case existing.Status != storage.IdempotencyCompleted:
+		w.Header().Set("Retry-After", "1")
+		writeErrorJSON(w, "IDEMPOTENCY_IN_PROGRESS", "a request with this idempotency key is still running", http.StatusConflict)
+	default:
+		slog.Debug("replaying idempotent response", "id", wfUUID, "requestId", rid)
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(existing.StatusCode)
+		if _, err := w.Write(existing.Response); err != nil {
+			slog.Error("failed to write response", "id", wfUUID, "requestId", rid, "error", err)
+		}
+	}
+	return nil
+}
+
+// completeIdempotencyKey stores the response of a claimed key. It is
+// stored even if the client has gone away, so its retry gets it.
+func (s *Service) completeIdempotencyKey(ctx context.Context, claim *storage.IdempotencyKey, status int, payload []byte, rid string) {
+	claim.StatusCode = status
+	claim.Response = payload
+	if err := s.storage.CompleteIdempotencyKey(context.WithoutCancel(ctx), claim); err != nil {
+		slog.Error("failed to store idempotent response", "id", claim.WorkflowID, "requestId", rid, "error", err)
+		return
+	}
+	claim.Status = storage.IdempotencyCompleted
+}
+
+// releaseIdempotencyKey frees a claimed key whose request failed without a
+// response worth keeping, so a retry runs the workflow again.
+func (s *Service) releaseIdempotencyKey(ctx context.Context, claim *storage.IdempotencyKey, rid string) {
+	if err := s.storage.ReleaseIdempotencyKey(context.WithoutCancel(ctx), claim); err != nil {
+		slog.Error("failed to release idempotency key", "id", claim.WorkflowID, "requestId", rid, "error", err)
+	}
+}
+
+// PurgeIdempotencyKeys deletes expired idempotency keys and returns how
+// many were deleted.
+func (s *Service) PurgeIdempotencyKeys(ctx context.Context) int {
+	n, err := s.storage.DeleteExpiredIdempotencyKeys(ctx, s.now())
+	if err != nil {
+		slog.Error("failed to delete expired idempotency keys", "error", err)
+	}
+	return n
+}
@@ -0,0 +1,165 @@
+package workflow_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"workflow-code-test/api/pkg/clients/weather"
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/storage"
+	"workflow-code-test/api/services/workflow"
+)
+
+func executeWithKey(t *testing.T, router http.Handler, key, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/workflows/"+storage.SeedWeatherWorkflowID.String()+"/execute", strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", key)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotencyKey_ReplaysResponse(t *testing.T) {
+	t.Parallel()
+	mailer := &countingEmail{}
+	svc, err := workflow.NewService(newMemoryStore(t, storage.SeedFixtures()), nodes.Deps{Weather: weather.NewStubClient(31), Email: mailer})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	now := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	workflow.SetClock(svc, func() time.Time { return now })
+	svc.SetIdempotencyRetention(time.Hour)
+	router := newTestRouter(svc)
+
+	first := executeWithKey(t, router, "order-1", `{"formData":`+weatherInputsJSON+`}`)
+	if first.Code != http.StatusOK || mailer.sent.Load() != 1 {
+		t.Fatalf("expected a run sending one email, got %d with %d sent: %s", first.Code, mailer.sent.Load(), first.Body.String())
+	}
+
+	// Key order and whitespace do not make a different request.
+	retry := executeWithKey(t, router, "order-1", `{ "formData": {"threshold":25,"operator":"greater_than","city":"Sydney","email":"alice@example.com","name":"Alice"} }`)
+	if retry.Code != http.StatusOK || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("expected a replayed 200, got %d: %s", retry.Code, retry.Body.String())
+	}
+	if retry.Body.String() != first.Body.String() {
+		t.Errorf("expected the original response, got %s", retry.Body.String())
+	}
+	if mailer.sent.Load() != 1 {
+		t.Errorf("expected the retry not to send another email, got %d sent", mailer.sent.Load())
+	}
+
+	changed := executeWithKey(t, router, "order-1", `{"formData":`+weatherInputsJSON+`,"condition":{"threshold":40}}`)
+	if changed.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a different body, got %d: %s", changed.Code, changed.Body.String())
+	}
+	assertErrorCode(t, changed.Body.Bytes(), "IDEMPOTENCY_KEY_REUSED")
+	dryRun := httptest.NewRequest(http.MethodPost, "/api/v1/workflows/"+storage.SeedWeatherWorkflowID.String()+"/execute?mode=dry-run", strings.NewReader(`{"formData":`+weatherInputsJSON+`}`))
+	dryRun.Header.Set("Idempotency-Key", "order-1")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, dryRun)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a different mode, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Once the key expires it is purged and the request runs again.
+	now = now.Add(time.Hour)
+	if n := svc.PurgeIdempotencyKeys(context.Background()); n != 1 {
+		t.Errorf("expected 1 expired key deleted, got %d", n)
+	}
+	if again := executeWithKey(t, router, "order-1", `{"formData":`+weatherInputsJSON+`}`); again.Code != http.StatusOK || again.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("expected a fresh run after expiry, got %d: %s", again.Code, again.Body.String())
+	}
+	if mailer.sent.Load() != 2 {
+		t.Errorf("expected the expired key to run again, got %d sent", mailer.sent.Load())
+	}
+}
+
+// claimedStore reports every idempotency key as claimed by a request that
+// is still running.
+type claimedStore struct {
+	storage.Storage
+}
+
+func (claimedStore) ClaimIdempotencyKey(_ context.Context, key *storage.IdempotencyKey) (*storage.IdempotencyKey, error) {
+	existing := *key
+	existing.Status = storage.IdempotencyInProgress
+	return &existing, storage.ErrIdempotencyKeyTaken
+}
+
+func TestIdempotencyKey_Rejected(t *testing.T) {
+	t.Parallel()
+	mailer := &countingEmail{}
+	deps := nodes.Deps{Weather: weather.NewStubClient(31), Email: mailer}
+	busy, err := workflow.NewService(claimedStore{newMemoryStore(t, storage.SeedFixtures())}, deps)
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	svc, err := workflow.NewService(newMemoryStore(t, storage.SeedFixtures()), deps)
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		svc            *workflow.Service
+		key            string
+		wantStatus     int
+		wantCode       string
+		wantRetryAfter string
+	}{
+		{name: "still running", svc: busy, key: "order-1", wantStatus: http.StatusConflict, wantCode: "IDEMPOTENCY_IN_PROGRESS", wantRetryAfter: "1"},
+		{name: "empty key", svc: svc, key: "", wantStatus: http.StatusBadRequest, wantCode: "INVALID_IDEMPOTENCY_KEY"},
+		{name: "key too long", svc: svc, key: strings.Repeat("k", 256), wantStatus: http.StatusBadRequest, wantCode: "INVALID_IDEMPOTENCY_KEY"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := executeWithKey(t, newTestRouter(tt.svc), tt.key, `{"formData":`+weatherInputsJSON+`}`)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			assertErrorCode(t, rec.Body.Bytes(), tt.wantCode)
+			if got := rec.Header().Get("Retry-After"); got != tt.wantRetryAfter {
+				t.Errorf("expected Retry-After %q, got %q", tt.wantRetryAfter, got)
+			}
+		})
+	}
+	if mailer.sent.Load() != 0 {
+		t.Errorf("expected no run, got %d emails sent", mailer.sent.Load())
+	}
+}
+
+func TestIdempotencyKey_TakesOverStaleClaim(t *testing.T) {
+	t.Parallel()
+	mailer := &countingEmail{}
+	store := newMemoryStore(t, storage.SeedFixtures())
+	svc, err := workflow.NewService(store, nodes.Deps{Weather: weather.NewStubClient(31), Email: mailer})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	now := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	workflow.SetClock(svc, func() time.Time { return now })
+	router := newTestRouter(svc)
+
+	// A request that crashed mid-execution left its key in progress.
+	crashed := &storage.IdempotencyKey{WorkflowID: storage.SeedWeatherWorkflowID, Key: "order-1", RequestHash: "crashed",
+		CreatedAt: now, LockedUntil: now.Add(2 * time.Minute), ExpiresAt: now.Add(24 * time.Hour)}
+	if _, err := store.ClaimIdempotencyKey(context.Background(), crashed); err != nil {
+		t.Fatalf("ClaimIdempotencyKey: %v", err)
+	}
+	body := `{"formData":` + weatherInputsJSON + `}`
+	if rec := executeWithKey(t, router, "order-1", body); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 while the claim is held, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	now = now.Add(3 * time.Minute)
+	if rec := executeWithKey(t, router, "order-1", body); rec.Code != http.StatusOK || mailer.sent.Load() != 1 {
+		t.Fatalf("expected the retry to run once the lease ran out, got %d with %d sent: %s", rec.Code, mailer.sent.Load(), rec.Body.String())
+	}
+	if rec := executeWithKey(t, router, "order-1", body); rec.Header().Get("Idempotent-Replayed") != "true" || mailer.sent.Load() != 1 {
+		t.Errorf("expected the retry's response stored and replayed, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,309 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"workflow-code-test/api/services/auth"
+	"workflow-code-test/api/services/storage"
+)
+
+const (
+	// DefaultLimitsRefreshInterval is how often RunLimitsRefresh reloads
+	// the execution limits from storage.
+	DefaultLimitsRefreshInterval = 30 * time.Second
+
+	// concurrencyRetryAfter is the Retry-After of a request refused by a
+	// concurrency cap; when a running execution finishes is not known.
+	concurrencyRetryAfter = time.Second
+)
+
+// limitKey identifies what an execution is counted against: the deployment
+// (subject ""), an API key or JWT subject, or a workflow ID.
+type limitKey struct {
+	scope   string
+	subject string
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limitExceeded describes the limit that refused an execution.
+type limitExceeded struct {
+	key         limitKey
+	concurrency bool // otherwise the rate limit
+	retryAfter  time.Duration
+}
+
+// message is the error message of the 429 response.
+func (e *limitExceeded) message() string {
+	var what string
+	switch e.key.scope {
+	case storage.LimitScopeAPIKey:
+		what = "these credentials"
+	case storage.LimitScopeWorkflow:
+		what = "this workflow"
+	default:
+		what = "the server"
+	}
+	if e.concurrency {
+		return fmt.Sprintf("too many executions of %s are running", what)
+	}
+	return fmt.Sprintf("execution rate limit of %s exceeded", what)
+}
+
+// executionLimiter applies storage.ExecutionLimit rows: a token bucket and
+// a count of running executions per key. Buckets start full, so a bucket
+// that has refilled can be dropped and recreated later.
+type executionLimiter struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	limits  map[limitKey]storage.ExecutionLimit
+	buckets map[limitKey]*tokenBucket
+	running map[limitKey]int
+}
+
+func newExecutionLimiter() *executionLimiter {
+	return &executionLimiter{
+		now:     time.Now,
+		limits:  make(map[limitKey]storage.ExecutionLimit),
+		buckets: make(map[limitKey]*tokenBucket),
+		running: make(map[limitKey]int),
+	}
+}
+
+// set replaces the limits. Buckets keep their tokens, up to the new burst,
+// and executions already running still count against the new caps.
+func (l *executionLimiter) set(limits []storage.ExecutionLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limits = make(map[limitKey]storage.ExecutionLimit, len(limits))
+	for _, lim := range limits {
+		l.limits[limitKey{lim.Scope, lim.Subject}] = lim
+	}
+	now := l.now()
+	for k, b := range l.buckets {
+		lim, ok := l.limitFor(k)
+		if !ok || lim.RatePerMinute == 0 || l.refill(b, lim, now) >= capacity(lim) {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// limitFor returns the limit of k: its own, else its scope's default.
+func (l *executionLimiter) limitFor(k limitKey) (storage.ExecutionLimit, bool) {
+	if lim, ok := l.limits[k]; ok {
+		return lim, true
+	}
+	lim, ok := l.limits[limitKey{scope: k.scope}]
+	return lim, ok
+}
+
+// acquire admits an execution counted against keys, or reports the first
+// limit it would exceed, in which case nothing is taken. release must be
+// called once the admitted execution has finished.
+func (l *executionLimiter) acquire(keys []limitKey) (release func(), exceeded *limitExceeded) {
+	return l.admit(keys, true)
+}
+
+// acquireSlots is acquire for the concurrency caps alone: it takes no
+// tokens from the buckets of keys.
+func (l *executionLimiter) acquireSlots(keys []limitKey) (release func(), exceeded *limitExceeded) {
+	return l.admit(keys, false)
+}
+
+func (l *executionLimiter) admit(keys []limitKey, rate bool) (release func(), exceeded *limitExceeded) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	var counted []limitKey
+	var rated []*tokenBucket
+	for _, k := range keys {
+		lim, ok := l.limitFor(k)
+		if !ok {
+			continue
+		}
+		if lim.MaxConcurrent > 0 {
+			if l.running[k] >= lim.MaxConcurrent {
+				return nil, &limitExceeded{key: k, concurrency: true, retryAfter: concurrencyRetryAfter}
+			}
+			counted = append(counted, k)
+		}
+		if rate && lim.RatePerMinute > 0 {
+			b := l.buckets[k]
+			if b == nil {
+				b = &tokenBucket{tokens: capacity(lim), last: now}
+				l.buckets[k] = b
+			}
+			if tokens := l.refill(b, lim, now); tokens < 1 {
+				wait := time.Duration((1 - tokens) / perSecond(lim) * float64(time.Second))
+				return nil, &limitExceeded{key: k, retryAfter: wait}
+			}
+			rated = append(rated, b)
+		}
+	}
+
+	for _, b := range rated {
+		b.tokens--
+	}
+	for _, k := range counted {
+		l.running[k]++
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			for _, k := range counted {
+				if l.running[k]--; l.running[k] <= 0 {
+					delete(l.running, k)
+				}
+			}
+		})
+	}, nil
+}
+
+// refill adds the tokens earned since the bucket was last refilled and
+// returns how many it holds, no more than the limit's burst.
+func (l *executionLimiter) refill(b *tokenBucket, lim storage.ExecutionLimit, now time.Time) float64 {
+	elapsed := max(now.Sub(b.last).Seconds(), 0)
+	b.tokens = math.Min(capacity(lim), b.tokens+elapsed*perSecond(lim))
+	b.last = now
+	return b.tokens
+}
+
+// capacity is the size of a limit's bucket; a burst of 0 allows one
+// request at a time.
+func capacity(lim storage.ExecutionLimit) float64 {
+	return float64(max(lim.Burst, 1))
+}
+
+func perSecond(lim storage.ExecutionLimit) float64 {
+	return float64(lim.RatePerMinute) / 60
+}
+
+// RefreshLimits reloads the execution limits from storage. Until the first
+// successful load, executions are not limited.
+func (s *Service) RefreshLimits(ctx context.Context) error {
+	limits, err := s.storage.ListExecutionLimits(ctx)
+	if err != nil {
+		return fmt.Errorf("list execution limits: %w", err)
+	}
+	s.limits.set(limits)
+	return nil
+}
+
+// RunLimitsRefresh reloads the execution limits every interval until ctx
+// is cancelled, so changes to them apply without a restart. The first
+// reload is after one interval; load them before with RefreshLimits. A
+// failed reload keeps the previous limits.
+func (s *Service) RunLimitsRefresh(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.RefreshLimits(ctx); err != nil {
+			slog.Error("failed to refresh execution limits", "error", err)
+		}
+	}
+}
+
+// limitExecutions wraps an endpoint that executes workflow {id}, or
+// resumes the run of task {taskId}, so every request is admitted by
+// admitExecution first.
+func (s *Service) limitExecutions(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		release, ok := s.admitExecution(w, r)
+		if !ok {
+			return
+		}
+		defer release()
+		h(w, r)
+	}
+}
+
+// admitExecution counts the execution r starts against the rate limits
+// and concurrency caps of its principal, the workflow and the deployment.
+// A refused request gets 429 RATE_LIMITED with Retry-After in whole
+// seconds; otherwise release must be called once the execution has
+// finished.
+func (s *Service) admitExecution(w http.ResponseWriter, r *http.Request) (release func(), ok bool) {
+	var keys []limitKey
+	if p := auth.PrincipalFrom(r.Context()); p != nil {
+		keys = append(keys, limitKey{storage.LimitScopeAPIKey, p.Subject})
+	}
+	if id, ok := s.limitedWorkflow(r); ok {
+		keys = append(keys, limitKey{storage.LimitScopeWorkflow, id.String()})
+	}
+	keys = append(keys, limitKey{scope: storage.LimitScopeGlobal})
+
+	release, exceeded := s.limits.acquire(keys)
+	if exceeded != nil {
+		kind := "rate"
+		if exceeded.concurrency {
+			kind = "concurrency"
+		}
+		s.metrics.ObserveLimited(exceeded.key.scope, kind)
+		retryAfter := int(math.Ceil(exceeded.retryAfter.Seconds()))
+		slog.Warn("execution limited", "scope", exceeded.key.scope, "subject", exceeded.key.subject, "limit", kind,
+			"retryAfter", retryAfter, "principal", principal(r), "requestId", reqID(r))
+		w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+		writeErrorJSON(w, "RATE_LIMITED", exceeded.message(), http.StatusTooManyRequests)
+		return nil, false
+	}
+	return release, true
+}
+
+// limitedWorkflow returns the workflow a request to admitExecution
+// executes: {id}, or the workflow of task {taskId}. A task that cannot be
+// loaded is left to the handler to report.
+func (s *Service) limitedWorkflow(r *http.Request) (uuid.UUID, bool) {
+	vars := mux.Vars(r)
+	if id, err := uuid.Parse(vars["id"]); err == nil {
+		return id, true
+	}
+	taskID, err := uuid.Parse(vars["taskId"])
+	if err != nil {
+		return uuid.Nil, false
+	}
+	task, err := s.storage.GetTask(r.Context(), taskID)
+	if err != nil {
+		return uuid.Nil, false
+	}
+	return task.WorkflowID, true
+}
+
+// acquireResume admits a resume the scheduler starts for a run of
+// workflowID against the concurrency caps of the workflow and the
+// deployment. It takes no tokens: the scheduler resumes each run once, so
+// no client can drive it in a loop. A refused resume is observed and
+// logged, and release is nil.
+func (s *Service) acquireResume(workflowID, runID uuid.UUID) (release func(), ok bool) {
+	release, exceeded := s.limits.acquireSlots([]limitKey{
+		{storage.LimitScopeWorkflow, workflowID.String()},
+		{scope: storage.LimitScopeGlobal},
+	})
+	if exceeded != nil {
+		s.metrics.ObserveLimited(exceeded.key.scope, "concurrency")
+		slog.Warn("resume limited", "id", workflowID, "run", runID, "scope", exceeded.key.scope)
+		return nil, false
+	}
+	return release, true
+}
@@ -0,0 +1,258 @@
+package workflow_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/pkg/clients/weather"
+	"workflow-code-test/api/services/auth"
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/storage"
+	"workflow-code-test/api/services/workflow"
+)
+
+// newLimitedService returns a Service over the seed data with limits in
+// place of the seeded ones, already loaded.
+func newLimitedService(t *testing.T, deps nodes.Deps, limits ...storage.ExecutionLimit) *workflow.Service {
+	t.Helper()
+	fixtures := storage.SeedFixtures()
+	fixtures.Limits = limits
+	svc, err := workflow.NewService(newMemoryStore(t, fixtures), deps)
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	if err := svc.RefreshLimits(context.Background()); err != nil {
+		t.Fatalf("RefreshLimits: %v", err)
+	}
+	return svc
+}
+
+func expectLimited(t *testing.T, rec *httptest.ResponseRecorder, message, retryAfter string) {
+	t.Helper()
+	var body struct{ Code, Message string }
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Code != "RATE_LIMITED" || body.Message != message {
+		t.Errorf("expected RATE_LIMITED %q, got %s", message, rec.Body.String())
+	}
+	if got := rec.Header().Get("Retry-After"); got != retryAfter {
+		t.Errorf("expected Retry-After %s, got %q", retryAfter, got)
+	}
+}
+
+func TestLimits_WorkflowRate(t *testing.T) {
+	t.Parallel()
+	svc := newLimitedService(t, nodes.Deps{Weather: weather.NewStubClient(31), Email: &countingEmail{}},
+		storage.ExecutionLimit{Scope: storage.LimitScopeWorkflow, RatePerMinute: 30, Burst: 2})
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	workflow.SetLimitsClock(svc, func() time.Time { return now })
+	router := newTestRouter(svc)
+	execute := "/api/v1/workflows/" + storage.SeedWeatherWorkflowID.String() + "/execute"
+	body := `{"formData":` + weatherInputsJSON + `}`
+
+	for i := range 2 {
+		if rec := doRequest(t, router, http.MethodPost, execute, body, nil); rec.Code != http.StatusOK {
+			t.Fatalf("execution %d: expected 200, got %d: %s", i+1, rec.Code, rec.Body.String())
+		}
+	}
+	expectLimited(t, doRequest(t, router, http.MethodPost, execute, body, nil), "execution rate limit of this workflow exceeded", "2")
+
+	// Another workflow has a bucket of its own.
+	other := "/api/v1/workflows/" + storage.SeedFloodWorkflowID.String() + "/execute"
+	if rec := doRequest(t, router, http.MethodPost, other, `{"formData":{}}`, nil); rec.Code == http.StatusTooManyRequests {
+		t.Errorf("expected the flood workflow not limited, got %s", rec.Body.String())
+	}
+
+	now = now.Add(2 * time.Second)
+	if rec := doRequest(t, router, http.MethodPost, execute, body, nil); rec.Code != http.StatusOK {
+		t.Errorf("expected a token refilled after 2s, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestLimits_PerCredentials(t *testing.T) {
+	t.Parallel()
+	fixtures := storage.SeedFixtures()
+	fixtures.Limits = []storage.ExecutionLimit{
+		{Scope: storage.LimitScopeAPIKey, RatePerMinute: 60, Burst: 1},
+		{Scope: storage.LimitScopeAPIKey, Subject: "admin@example.com"},
+	}
+	store := newMemoryStore(t, fixtures)
+	svc, err := workflow.NewService(store, nodes.Deps{Weather: weather.NewStubClient(31), Email: &countingEmail{}})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	a, err := auth.NewAuthenticator(store, auth.JWTConfig{HS256Secret: testJWTSecret})
+	if err != nil {
+		t.Fatalf("NewAuthenticator: %v", err)
+	}
+	svc.SetAuthenticator(a)
+	if err := svc.RefreshLimits(context.Background()); err != nil {
+		t.Fatalf("RefreshLimits: %v", err)
+	}
+	router := newTestRouter(svc)
+	execute := "/api/v1/workflows/" + storage.SeedWeatherWorkflowID.String() + "/execute"
+	body := `{"formData":` + weatherInputsJSON + `}`
+	editor, admin := roleToken(t, auth.RoleEditor), roleToken(t, auth.RoleAdmin)
+
+	if rec := authRequest(router, http.MethodPost, execute, editor, body); rec.Code != http.StatusOK {
+		t.Fatalf("editor: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	expectLimited(t, authRequest(router, http.MethodPost, execute, editor, body), "execution rate limit of these credentials exceeded", "1")
+
+	// The admin's own row lifts the default.
+	for i := range 3 {
+		if rec := authRequest(router, http.MethodPost, execute, admin, body); rec.Code != http.StatusOK {
+			t.Fatalf("admin execution %d: expected 200, got %d: %s", i+1, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+// blockingWeather holds every lookup until release is closed.
+type blockingWeather struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingWeather) GetTemperature(ctx context.Context, _, _ float64) (float64, error) {
+	b.started <- struct{}{}
+	select {
+	case <-b.release:
+		return 31, nil
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
+
+func TestLimits_Concurrency(t *testing.T) {
+	t.Parallel()
+	wx := &blockingWeather{started: make(chan struct{}, 1), release: make(chan struct{})}
+	svc := newLimitedService(t, nodes.Deps{Weather: wx, Email: &countingEmail{}},
+		storage.ExecutionLimit{Scope: storage.LimitScopeGlobal, MaxConcurrent: 1})
+	router := newTestRouter(svc)
+	execute := "/api/v1/workflows/" + storage.SeedWeatherWorkflowID.String() + "/execute"
+	body := `{"formData":` + weatherInputsJSON + `}`
+
+	done := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, execute, strings.NewReader(body)))
+		done <- rec.Code
+	}()
+	<-wx.started
+
+	expectLimited(t, doRequest(t, router, http.MethodPost, execute, body, nil), "too many executions of the server are running", "1")
+
+	close(wx.release)
+	if code := <-done; code != http.StatusOK {
+		t.Fatalf("first execution: expected 200, got %d", code)
+	}
+	if rec := doRequest(t, router, http.MethodPost, execute, body, nil); rec.Code != http.StatusOK {
+		t.Errorf("expected an execution once the first finished, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestLimits_TaskActions(t *testing.T) {
+	t.Parallel()
+	svc, router, base := newApprovalTestService(t)
+	workflow.SetLimits(svc, storage.ExecutionLimit{Scope: storage.LimitScopeWorkflow, RatePerMinute: 30, Burst: 1})
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	workflow.SetLimitsClock(svc, func() time.Time { return now })
+	executed := startApprovalRun(t, router, base)
+	approve := "/api/v1/tasks/" + executed.WaitingFor.TaskID.String() + "/approve"
+
+	// Approving resumes the run, so it counts against the workflow's bucket.
+	expectLimited(t, doRequest(t, router, http.MethodPost, approve, `{"by":"alice"}`, nil), "execution rate limit of this workflow exceeded", "2")
+
+	now = now.Add(2 * time.Second)
+	if rec := doRequest(t, router, http.MethodPost, approve, `{"by":"alice"}`, nil); rec.Code != http.StatusOK {
+		t.Errorf("expected the task still pending and approved once a token refilled, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestLimits_ExpiryWaitsForConcurrency(t *testing.T) {
+	t.Parallel()
+	svc, router, base := newApprovalTestService(t)
+	executed := startApprovalRun(t, router, base)
+	workflow.SetLimits(svc, storage.ExecutionLimit{Scope: storage.LimitScopeGlobal, MaxConcurrent: 1})
+	later := time.Now().Add(25 * time.Hour)
+	workflow.SetClock(svc, func() time.Time { return later })
+
+	release := workflow.HoldExecution(svc, uuid.New())
+	if n := svc.ExpireTasks(context.Background()); n != 0 {
+		t.Fatalf("expected no task expired while the server is at its cap, got %d", n)
+	}
+	var task storage.Task
+	doRequest(t, router, http.MethodGet, "/api/v1/tasks/"+executed.WaitingFor.TaskID.String(), "", &task)
+	if task.Status != storage.TaskPending {
+		t.Errorf("expected the task left pending, got %s", task.Status)
+	}
+
+	release()
+	if n := svc.ExpireTasks(context.Background()); n != 1 {
+		t.Fatalf("expected the task expired once a slot was free, got %d", n)
+	}
+}
+
+func TestLimits_TimerWaitsForConcurrency(t *testing.T) {
+	t.Parallel()
+	svc, router, base := newPacedLoopService(t, &countingEmail{})
+	var executed workflow.ExecutionResponse
+	if rec := doRequest(t, router, http.MethodPost, base+"/execute", `{"formData": `+weatherInputsJSON+`}`, &executed); rec.Code != http.StatusOK {
+		t.Fatalf("execute: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	workflow.SetLimits(svc, storage.ExecutionLimit{Scope: storage.LimitScopeWorkflow, MaxConcurrent: 1})
+	due := executed.WaitingFor.ResumeAt.Add(time.Second)
+	workflow.SetClock(svc, func() time.Time { return due })
+
+	release := workflow.HoldExecution(svc, storage.SeedLoopWorkflowID)
+	if n := svc.ResumeDueRuns(context.Background()); n != 0 {
+		t.Fatalf("expected no run resumed while the workflow is at its cap, got %d", n)
+	}
+	release()
+
+	// The refused run stays claimed until the claim runs out.
+	if n := svc.ResumeDueRuns(context.Background()); n != 0 {
+		t.Fatalf("expected the refused run still claimed, got %d", n)
+	}
+	retry := due.Add(5*time.Minute + time.Second)
+	workflow.SetClock(svc, func() time.Time { return retry })
+	if n := svc.ResumeDueRuns(context.Background()); n != 1 {
+		t.Fatalf("expected the run resumed after its claim ran out, got %d", n)
+	}
+}
+
+func TestLimits_IdempotentRetry(t *testing.T) {
+	t.Parallel()
+	svc := newLimitedService(t, nodes.Deps{Weather: weather.NewStubClient(31), Email: &countingEmail{}},
+		storage.ExecutionLimit{Scope: storage.LimitScopeWorkflow, RatePerMinute: 30, Burst: 1})
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	workflow.SetLimitsClock(svc, func() time.Time { return now })
+	router := newTestRouter(svc)
+	body := `{"formData":` + weatherInputsJSON + `}`
+
+	first := executeWithKey(t, router, "order-1", body)
+	if first.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", first.Code, first.Body.String())
+	}
+	// The bucket is empty, but a retry is answered from the stored response.
+	retry := executeWithKey(t, router, "order-1", body)
+	if retry.Code != http.StatusOK || retry.Header().Get("Idempotent-Replayed") != "true" || retry.Body.String() != first.Body.String() {
+		t.Fatalf("expected the original response replayed, got %d: %s", retry.Code, retry.Body.String())
+	}
+
+	// A refused request releases its key, so its retry runs once a token
+	// has refilled.
+	expectLimited(t, executeWithKey(t, router, "order-2", body), "execution rate limit of this workflow exceeded", "2")
+	now = now.Add(2 * time.Second)
+	if rec := executeWithKey(t, router, "order-2", body); rec.Code != http.StatusOK || rec.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("expected the refused request to run on retry, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
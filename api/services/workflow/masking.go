@@ -0,0 +1,225 @@
+package workflow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/pkg/redact"
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/storage"
+)
+
+// runMask gathers the sensitive variables of the workflows a run executes,
+// sub-workflows included, and masks them, along with email addresses and
+// phone numbers, in everything the run's result exposes. The nodes
+// themselves, and the clients they call, always see the real values.
+type runMask struct {
+	mu    sync.Mutex
+	names []string
+	seen  map[string]bool
+}
+
+func newRunMask(wf *storage.Workflow) *runMask {
+	m := &runMask{seen: make(map[string]bool)}
+	m.add(wf.Settings.SensitiveVariables)
+	return m
+}
+
+func (m *runMask) add(names []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, n := range names {
+		if !m.seen[n] {
+			m.seen[n] = true
+			m.names = append(m.names, n)
+		}
+	}
+}
+
+// wrapLoad adds the sensitive variables of the workflows load returns.
+func (m *runMask) wrapLoad(load WorkflowLoader) WorkflowLoader {
+	if load == nil {
+		return load
+	}
+	return func(ctx context.Context, id uuid.UUID, version int) (*storage.Workflow, error) {
+		wf, err := load(ctx, id, version)
+		if err != nil {
+			return nil, err
+		}
+		m.add(wf.Settings.SensitiveVariables)
+		return wf, nil
+	}
+}
+
+// masker returns a Masker for the sensitive variables and the values they
+// hold in nCtx or in any step output. nCtx may be nil.
+func (m *runMask) masker(nCtx *nodes.NodeContext, steps []StepResult) *redact.Masker {
+	m.mu.Lock()
+	names := append([]string(nil), m.names...)
+	m.mu.Unlock()
+
+	var values []string
+	if nCtx != nil {
+		for _, name := range names {
+			if v, ok := nCtx.Lookup(name); ok {
+				values = appendStrings(values, v)
+			}
+		}
+	}
+	values = appendStepValues(values, redact.NewMasker(names, nil), steps)
+	return redact.NewMasker(names, values)
+}
+
+// apply masks result's steps, error and recorded calls. The variables of a
+// suspended run are left alone: they are what the run resumes with.
+func (m *runMask) apply(result *ExecutionResponse, nCtx *nodes.NodeContext) {
+	mk := m.masker(nCtx, result.Steps)
+	result.Steps = maskSteps(mk, result.Steps)
+	result.Error = mk.String(result.Error)
+	for i := range result.calls {
+		c := &result.calls[i]
+		c.Request = mk.JSON(c.Request)
+		c.Response = mk.JSON(c.Response)
+		c.Error = mk.String(c.Error)
+	}
+	result.mask = mk
+}
+
+// maskSteps returns a copy of steps with their outputs and errors masked.
+func maskSteps(mk *redact.Masker, steps []StepResult) []StepResult {
+	if steps == nil {
+		return nil
+	}
+	out := make([]StepResult, len(steps))
+	for i, step := range steps {
+		step.Output = mk.Map(step.Output)
+		step.Error = mk.String(step.Error)
+		step.Steps = maskSteps(mk, step.Steps)
+		out[i] = step
+	}
+	return out
+}
+
+// appendStepValues appends the values step outputs hold under the names,
+// so outputs only reachable as nodes.<id>.<key> are masked elsewhere too.
+func appendStepValues(values []string, names *redact.Masker, steps []StepResult) []string {
+	for _, step := range steps {
+		for k, v := range step.Output {
+			if names.Sensitive(k) {
+				values = appendStrings(values, v)
+			}
+		}
+		values = appendStepValues(values, names, step.Steps)
+	}
+	return values
+}
+
+// appendStrings appends the strings and numbers in a decoded JSON value.
+func appendStrings(values []string, v any) []string {
+	switch v := v.(type) {
+	case string:
+		return append(values, v)
+	case float64:
+		return append(values, strconv.FormatFloat(v, 'f', -1, 64))
+	case int:
+		return append(values, strconv.Itoa(v))
+	case map[string]any:
+		for _, e := range v {
+			values = appendStrings(values, e)
+		}
+	case []any:
+		for _, e := range v {
+			values = appendStrings(values, e)
+		}
+	}
+	return values
+}
+
+// sealedRun is what a stored run keeps of the values masking hides: its
+// inputs before they were masked, so a replay runs on the values the
+// original did, and the sensitive variables of a suspended run, which are
+// left out of its state and restored when it resumes.
+type sealedRun struct {
+	Inputs    map[string]any `json:"inputs,omitempty"`
+	Variables map[string]any `json:"variables,omitempty"`
+}
+
+// sealedName binds the sealed data of a run to the run, as a secret's name
+// binds its value.
+func sealedName(run *storage.Run) string {
+	return "run/" + run.ID.String()
+}
+
+// sealRun seals inputs, if masking changed them, and the sensitive
+// variables of state, which it removes from run.State, into run.Sealed.
+// Without a secrets key nothing is sealed: a replay runs on the masked
+// inputs, and the state keeps the variables the run resumes with.
+func (s *Service) sealRun(run *storage.Run, inputs map[string]any, state *runState) error {
+	run.Sealed = nil
+	if s.secrets == nil {
+		return nil
+	}
+	var sealed sealedRun
+	if raw, err := json.Marshal(inputs); err == nil && inputs != nil && !bytes.Equal(raw, run.Inputs) {
+		sealed.Inputs = inputs
+	}
+	if state != nil {
+		names := redact.NewMasker(state.Settings.SensitiveVariables, nil)
+		kept := make(map[string]any, len(state.Variables))
+		for k, v := range state.Variables {
+			if !names.Sensitive(k) {
+				kept[k] = v
+				continue
+			}
+			if sealed.Variables == nil {
+				sealed.Variables = make(map[string]any)
+			}
+			sealed.Variables[k] = v
+		}
+		if sealed.Variables != nil {
+			masked := *state
+			masked.Variables = kept
+			var err error
+			if run.State, err = json.Marshal(&masked); err != nil {
+				return fmt.Errorf("encode state: %w", err)
+			}
+		}
+	}
+	if sealed.Inputs == nil && sealed.Variables == nil {
+		return nil
+	}
+
+	plain, err := json.Marshal(sealed)
+	if err != nil {
+		return fmt.Errorf("encode sealed data: %w", err)
+	}
+	if run.Sealed, err = s.secrets.Seal(run.WorkspaceID, sealedName(run), string(plain)); err != nil {
+		return fmt.Errorf("seal run %s: %w", run.ID, err)
+	}
+	return nil
+}
+
+// openRun returns the sealed data of run, empty if it has none.
+func (s *Service) openRun(run *storage.Run) (*sealedRun, error) {
+	var sealed sealedRun
+	if run.Sealed == nil {
+		return &sealed, nil
+	}
+	if s.secrets == nil {
+		return nil, fmt.Errorf("run %s has sealed data but no secrets key is configured", run.ID)
+	}
+	plain, err := s.secrets.Open(run.WorkspaceID, sealedName(run), run.Sealed)
+	if err != nil {
+		return nil, fmt.Errorf("open run %s: %w", run.ID, err)
+	}
+	if err := json.Unmarshal([]byte(plain), &sealed); err != nil {
+		return nil, fmt.Errorf("decode sealed data of run %s: %w", run.ID, err)
+	}
+	return &sealed, nil
+}
@@ -0,0 +1,142 @@
+package workflow_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"workflow-code-test/api/pkg/clients/weather"
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/secrets"
+	"workflow-code-test/api/services/storage"
+	"workflow-code-test/api/services/workflow"
+)
+
+func TestMasking_SensitiveVariablesAndContactDetails(t *testing.T) {
+	t.Parallel()
+	mailer := &capturingEmail{}
+	svc, err := workflow.NewService(newMemoryStore(t, storage.SeedFixtures()), nodes.Deps{Weather: weather.NewStubClient(31), Email: mailer})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	router := newTestRouter(svc)
+	seed := storage.SeedWeatherWorkflowID.String()
+
+	// Mark the name sensitive by re-importing the seed workflow. The city is
+	// left alone: without a secrets key a replay runs on the masked inputs,
+	// so it could not look up the weather again.
+	var b map[string]any
+	if err := json.Unmarshal(exportBundle(t, router, "/api/v1/workflows/"+seed+"/export"), &b); err != nil {
+		t.Fatalf("decode bundle: %v", err)
+	}
+	b["workflow"].(map[string]any)["settings"] = map[string]any{"sensitiveVariables": []string{"name"}}
+	bundle, _ := json.Marshal(b)
+	if rec := doRequest(t, router, http.MethodPost, "/api/v1/workflows/import", string(bundle), nil); rec.Code != http.StatusOK {
+		t.Fatalf("import: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	leaked := func(body string) []string {
+		var found []string
+		for _, raw := range []string{"Alice", "alice@example.com", "weather-alerts@example.com"} {
+			if strings.Contains(body, raw) {
+				found = append(found, raw)
+			}
+		}
+		return found
+	}
+
+	var result workflow.ExecutionResponse
+	rec := doRequest(t, router, http.MethodPost, "/api/v1/workflows/"+seed+"/execute", `{"formData":`+weatherInputsJSON+`}`, &result)
+	if rec.Code != http.StatusOK || result.Status != "completed" {
+		t.Fatalf("execute: expected a completed run, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(mailer.sent) != 1 || mailer.sent[0].To != "alice@example.com" || mailer.sent[0].From != "weather-alerts@example.com" {
+		t.Errorf("expected the client to receive the real values, got %+v", mailer.sent)
+	}
+	if found := leaked(rec.Body.String()); len(found) > 0 || !strings.Contains(rec.Body.String(), `"to":"a***@example.com"`) || !strings.Contains(rec.Body.String(), `"name":"***"`) {
+		t.Errorf("expected the response masked, leaked %v: %s", found, rec.Body.String())
+	}
+
+	rec = doRequest(t, router, http.MethodGet, "/api/v1/workflows/"+seed+"/runs/"+result.RunID.String(), "", nil)
+	if found := leaked(rec.Body.String()); rec.Code != http.StatusOK || len(found) > 0 || !strings.Contains(rec.Body.String(), `"name":"***"`) {
+		t.Errorf("expected the stored run masked, leaked %v: %d %s", found, rec.Code, rec.Body.String())
+	}
+
+	var report workflow.ReplayReport
+	rec = doRequest(t, router, http.MethodPost, "/api/v1/workflows/"+seed+"/runs/"+result.RunID.String()+"/replay", "", &report)
+	if rec.Code != http.StatusOK || report.Diverged {
+		t.Errorf("expected the masked run to replay without divergence, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, router, http.MethodPost, "/api/v1/workflows/"+seed+"/debug", `{"inputs":`+weatherInputsJSON+`}`, nil)
+	if found := leaked(rec.Body.String()); rec.Code != http.StatusCreated || len(found) > 0 {
+		t.Errorf("expected the debug session variables masked, leaked %v: %d %s", found, rec.Code, rec.Body.String())
+	}
+}
+
+func TestMasking_ReplayRunsOnSealedInputs(t *testing.T) {
+	t.Parallel()
+	store := newMemoryStore(t, storage.SeedFixtures())
+	deps := nodes.Deps{Weather: weather.NewStubClient(31), Email: &capturingEmail{}}
+	svc, err := workflow.NewService(store, deps)
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	box, err := secrets.NewBox(bytes.Repeat([]byte{1}, secrets.KeySize))
+	if err != nil {
+		t.Fatalf("NewBox: %v", err)
+	}
+	svc.SetSecretsBox(box)
+	router := newTestRouter(svc)
+	seed := storage.SeedWeatherWorkflowID.String()
+
+	// The condition compares the temperature with the sensitive threshold,
+	// and the weather lookup reads the sensitive city.
+	var b map[string]any
+	if err := json.Unmarshal(exportBundle(t, router, "/api/v1/workflows/"+seed+"/export"), &b); err != nil {
+		t.Fatalf("decode bundle: %v", err)
+	}
+	b["workflow"].(map[string]any)["settings"] = map[string]any{"sensitiveVariables": []string{"city", "threshold"}}
+	bundle, _ := json.Marshal(b)
+	if rec := doRequest(t, router, http.MethodPost, "/api/v1/workflows/import", string(bundle), nil); rec.Code != http.StatusOK {
+		t.Fatalf("import: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var result workflow.ExecutionResponse
+	rec := doRequest(t, router, http.MethodPost, "/api/v1/workflows/"+seed+"/execute", `{"formData":`+weatherInputsJSON+`}`, &result)
+	if rec.Code != http.StatusOK || result.Status != "completed" {
+		t.Fatalf("execute: expected a completed run, got %d: %s", rec.Code, rec.Body.String())
+	}
+	runURL := "/api/v1/workflows/" + seed + "/runs/" + result.RunID.String()
+	rec = doRequest(t, router, http.MethodGet, runURL, "", nil)
+	if strings.Contains(rec.Body.String(), "Sydney") || !strings.Contains(rec.Body.String(), `"threshold":"***"`) {
+		t.Errorf("expected the stored inputs masked, got %s", rec.Body.String())
+	}
+	run, err := store.GetRun(context.Background(), storage.SeedWeatherWorkflowID, *result.RunID)
+	if err != nil || run.Sealed == nil || bytes.Contains(run.Sealed, []byte("Sydney")) {
+		t.Fatalf("expected the raw inputs sealed, got %+v, %v", run, err)
+	}
+
+	var report workflow.ReplayReport
+	rec = doRequest(t, router, http.MethodPost, runURL+"/replay", "", &report)
+	if rec.Code != http.StatusOK || report.Diverged {
+		t.Errorf("expected the run to replay on its sealed inputs without divergence, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "Sydney") {
+		t.Errorf("expected the replay report masked, got %s", rec.Body.String())
+	}
+
+	// Without the key the replay falls back to the masked inputs, which
+	// cannot reproduce the run.
+	keyless, err := workflow.NewService(store, deps)
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	rec = doRequest(t, newTestRouter(keyless), http.MethodPost, runURL+"/replay", "", &report)
+	if rec.Code != http.StatusOK || !report.Diverged {
+		t.Errorf("expected the masked inputs to diverge, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,355 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"sync"
+
+	"workflow-code-test/api/pkg/clients/email"
+	"workflow-code-test/api/pkg/clients/flood"
+	"workflow-code-test/api/pkg/clients/sms"
+	"workflow-code-test/api/pkg/clients/weather"
+	"workflow-code-test/api/services/nodes"
+)
+
+// Client names used in recorded calls.
+const (
+	clientWeather = "weather"
+	clientFlood   = "flood"
+	clientEmail   = "email"
+	clientSMS     = "sms"
+	clientTask    = "task" // the response to an approval or input task
+)
+
+// RecordedCall is one integration call made by a node during a run, in the
+// order the calls were made.
+type RecordedCall struct {
+	NodeID   string          `json:"nodeId"`
+	Client   string          `json:"client"` // weather, flood, email, sms or task
+	Request  json.RawMessage `json:"request"`
+	Response json.RawMessage `json:"response,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// The request and response shapes stored in RecordedCall.
+type (
+	coordinatesRequest struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+	}
+	weatherResponse struct {
+		Temperature float64 `json:"temperature"`
+	}
+	floodResponse struct {
+		Discharge float64 `json:"discharge"`
+		RiskLevel string  `json:"riskLevel"`
+	}
+	emailRequest struct {
+		To      string `json:"to"`
+		From    string `json:"from,omitempty"`
+		Subject string `json:"subject"`
+		Body    string `json:"body"`
+	}
+	smsRequest struct {
+		To   string `json:"to"`
+		Body string `json:"body"`
+	}
+	taskRequest struct {
+		Kind     string `json:"kind"`
+		Assignee string `json:"assignee,omitempty"`
+		Title    string `json:"title"`
+	}
+	deliveryResponse struct {
+		DeliveryStatus string `json:"deliveryStatus"`
+		Sent           bool   `json:"sent"`
+	}
+)
+
+// callRecorder captures every integration call made while a workflow runs.
+type callRecorder struct {
+	mu    sync.Mutex
+	calls []RecordedCall
+}
+
+func (r *callRecorder) record(nodeID, client string, req, resp any, err error) {
+	call := RecordedCall{NodeID: nodeID, Client: client}
+	call.Request, _ = json.Marshal(req)
+	if err != nil {
+		call.Error = err.Error()
+	} else {
+		call.Response, _ = json.Marshal(resp)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+func (r *callRecorder) recorded() []RecordedCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordedCall{}, r.calls...)
+}
+
+// wrap returns depsFor with every client recording its calls.
+func (r *callRecorder) wrap(depsFor func(string) nodes.Deps) func(string) nodes.Deps {
+	return func(nodeID string) nodes.Deps {
+		d := depsFor(nodeID)
+		if d.Weather != nil {
+			d.Weather = recordingWeather{d.Weather, r, nodeID}
+		}
+		if d.Flood != nil {
+			d.Flood = recordingFlood{d.Flood, r, nodeID}
+		}
+		if d.Email != nil {
+			d.Email = recordingEmail{d.Email, r, nodeID}
+		}
+		if d.SMS != nil {
+			d.SMS = recordingSMS{d.SMS, r, nodeID}
+		}
+		return d
+	}
+}
+
+type recordingWeather struct {
+	next   weather.Client
+	rec    *callRecorder
+	nodeID string
+}
+
+func (c recordingWeather) GetTemperature(ctx context.Context, lat, lon float64) (float64, error) {
+	t, err := c.next.GetTemperature(ctx, lat, lon)
+	c.rec.record(c.nodeID, clientWeather, coordinatesRequest{lat, lon}, weatherResponse{t}, err)
+	return t, err
+}
+
+type recordingFlood struct {
+	next   flood.Client
+	rec    *callRecorder
+	nodeID string
+}
+
+func (c recordingFlood) GetFloodRisk(ctx context.Context, lat, lon float64) (*flood.Result, error) {
+	res, err := c.next.GetFloodRisk(ctx, lat, lon)
+	var resp floodResponse
+	if res != nil {
+		resp = floodResponse{res.Discharge, res.RiskLevel}
+	}
+	c.rec.record(c.nodeID, clientFlood, coordinatesRequest{lat, lon}, resp, err)
+	return res, err
+}
+
+type recordingEmail struct {
+	next   email.Client
+	rec    *callRecorder
+	nodeID string
+}
+
+func (c recordingEmail) Send(ctx context.Context, msg email.Message) (*email.Result, error) {
+	res, err := c.next.Send(ctx, msg)
+	var resp deliveryResponse
+	if res != nil {
+		resp = deliveryResponse{res.DeliveryStatus, res.Sent}
+	}
+	c.rec.record(c.nodeID, clientEmail, emailRequest{msg.To, msg.From, msg.Subject, msg.Body}, resp, err)
+	return res, err
+}
+
+type recordingSMS struct {
+	next   sms.Client
+	rec    *callRecorder
+	nodeID string
+}
+
+func (c recordingSMS) Send(ctx context.Context, msg sms.Message) (*sms.Result, error) {
+	res, err := c.next.Send(ctx, msg)
+	var resp deliveryResponse
+	if res != nil {
+		resp = deliveryResponse{res.DeliveryStatus, res.Sent}
+	}
+	c.rec.record(c.nodeID, clientSMS, smsRequest{msg.To, msg.Body}, resp, err)
+	return res, err
+}
+
+// replayer answers integration calls from a previous run's recording.
+// Calls are matched per node and client in the order they were made, so a
+// node inside a loop gets each of its recorded responses in turn. Nothing
+// reaches a real client: email and SMS without a recording report a
+// synthetic "replayed" delivery. Recorded calls have their sensitive values
+// masked, so requests are compared with both sides masked, the values of
+// the replay's sensitive inputs included.
+type replayer struct {
+	mu         sync.Mutex
+	queues     map[string][]RecordedCall // nodeID + "/" + client
+	mismatches []string
+	mask       *runMask
+	inputs     *nodes.NodeContext
+}
+
+func newReplayer(calls []RecordedCall, mask *runMask, inputs map[string]any) *replayer {
+	p := &replayer{
+		queues: make(map[string][]RecordedCall),
+		mask:   mask,
+		inputs: &nodes.NodeContext{Variables: maps.Clone(inputs)},
+	}
+	for _, c := range calls {
+		key := c.NodeID + "/" + c.Client
+		p.queues[key] = append(p.queues[key], c)
+	}
+	return p
+}
+
+// next pops the next recorded call of the node and notes when the replayed
+// request differs from the recorded one.
+func (p *replayer) next(nodeID, client string, req any) (RecordedCall, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := nodeID + "/" + client
+	queue := p.queues[key]
+	if len(queue) == 0 {
+		return RecordedCall{}, false
+	}
+	call := queue[0]
+	p.queues[key] = queue[1:]
+
+	mk := p.mask.masker(p.inputs, nil)
+	sent, recorded := mk.JSON(json.RawMessage(jsonString(req))), mk.JSON(call.Request)
+	if !jsonEqualValues(sent, recorded) {
+		p.mismatches = append(p.mismatches, fmt.Sprintf("node %q sent %s request %s, recorded %s", nodeID, client, sent, recorded))
+	}
+	return call, true
+}
+
+// unused lists recorded calls the replay never made, in a stable order.
+func (p *replayer) unused() []RecordedCall {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var out []RecordedCall
+	for _, key := range sortedKeys(p.queues) {
+		out = append(out, p.queues[key]...)
+	}
+	return out
+}
+
+// answer pops the next recorded call and decodes its response into resp.
+func (p *replayer) answer(nodeID, client string, req, resp any) error {
+	call, ok := p.next(nodeID, client, req)
+	if !ok {
+		return fmt.Errorf("no recorded %s response left for node %q", client, nodeID)
+	}
+	if call.Error != "" {
+		return errors.New(call.Error)
+	}
+	if err := json.Unmarshal(call.Response, resp); err != nil {
+		return fmt.Errorf("decode recorded %s response for node %q: %w", client, nodeID, err)
+	}
+	return nil
+}
+
+// resolution answers a suspending node with the recorded response to its
+// task, so a replay runs through approvals and input the way the original
+// run did. A task that was never resolved leaves the replay waiting too.
+// Timers always fire immediately.
+func (p *replayer) resolution(nodeID string, s *nodes.Suspension) (nodes.Resolution, bool) {
+	if s.Kind == nodes.SuspendTimer {
+		return elapseTimers(nodeID, s)
+	}
+	call, ok := p.next(nodeID, clientTask, taskRequest{s.Kind, s.Assignee, s.Title})
+	if !ok {
+		return nodes.Resolution{}, false
+	}
+	var res nodes.Resolution
+	if err := json.Unmarshal(call.Response, &res); err != nil {
+		p.mu.Lock()
+		p.mismatches = append(p.mismatches, fmt.Sprintf("node %q has an unreadable task response: %v", nodeID, err))
+		p.mu.Unlock()
+		return nodes.Resolution{}, false
+	}
+	return res, true
+}
+
+func (p *replayer) depsFor(nodeID string) nodes.Deps {
+	return nodes.Deps{
+		Weather: replayWeather{p, nodeID},
+		Flood:   replayFlood{p, nodeID},
+		Email:   replayEmail{p, nodeID},
+		SMS:     replaySMS{p, nodeID},
+	}
+}
+
+type replayWeather struct {
+	p      *replayer
+	nodeID string
+}
+
+func (c replayWeather) GetTemperature(_ context.Context, lat, lon float64) (float64, error) {
+	var resp weatherResponse
+	if err := c.p.answer(c.nodeID, clientWeather, coordinatesRequest{lat, lon}, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Temperature, nil
+}
+
+type replayFlood struct {
+	p      *replayer
+	nodeID string
+}
+
+func (c replayFlood) GetFloodRisk(_ context.Context, lat, lon float64) (*flood.Result, error) {
+	var resp floodResponse
+	if err := c.p.answer(c.nodeID, clientFlood, coordinatesRequest{lat, lon}, &resp); err != nil {
+		return nil, err
+	}
+	return &flood.Result{Discharge: resp.Discharge, RiskLevel: resp.RiskLevel}, nil
+}
+
+type replayEmail struct {
+	p      *replayer
+	nodeID string
+}
+
+func (c replayEmail) Send(_ context.Context, msg email.Message) (*email.Result, error) {
+	resp, err := c.p.delivery(c.nodeID, clientEmail, emailRequest{msg.To, msg.From, msg.Subject, msg.Body})
+	if err != nil {
+		return nil, err
+	}
+	return &email.Result{DeliveryStatus: resp.DeliveryStatus, Sent: resp.Sent}, nil
+}
+
+type replaySMS struct {
+	p      *replayer
+	nodeID string
+}
+
+func (c replaySMS) Send(_ context.Context, msg sms.Message) (*sms.Result, error) {
+	resp, err := c.p.delivery(c.nodeID, clientSMS, smsRequest{msg.To, msg.Body})
+	if err != nil {
+		return nil, err
+	}
+	return &sms.Result{DeliveryStatus: resp.DeliveryStatus, Sent: resp.Sent}, nil
+}
+
+// delivery answers an email or SMS send, falling back to a synthetic
+// success when the original run sent nothing from this node.
+func (p *replayer) delivery(nodeID, client string, req any) (deliveryResponse, error) {
+	if _, ok := p.peek(nodeID, client); !ok {
+		return deliveryResponse{DeliveryStatus: "replayed", Sent: true}, nil
+	}
+	var resp deliveryResponse
+	err := p.answer(nodeID, client, req, &resp)
+	return resp, err
+}
+
+func (p *replayer) peek(nodeID, client string) (RecordedCall, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	queue := p.queues[nodeID+"/"+client]
+	if len(queue) == 0 {
+		return RecordedCall{}, false
+	}
+	return queue[0], true
+}
@@ -0,0 +1,165 @@
+package workflow
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/storage"
+)
+
+// ModeReplay marks an execution re-run from a recorded run.
+const ModeReplay = "replay"
+
+// Divergence kinds reported by a replay.
+const (
+	divergePath    = "path"        // a different node ran at this step
+	divergeStatus  = "status"      // a step or the run ended differently
+	divergeOutput  = "output"      // a step produced different output
+	divergeRequest = "request"     // a node called an integration with different arguments
+	divergeUnused  = "unused_call" // a recorded call was never made
+)
+
+// Divergence is one difference between a recorded run and its replay.
+// Step is the index into the steps when the difference is tied to one.
+type Divergence struct {
+	Kind    string `json:"kind"`
+	Step    *int   `json:"step,omitempty"`
+	NodeID  string `json:"nodeId,omitempty"`
+	Message string `json:"message"`
+}
+
+// ReplayReport compares a recorded run with its replay. Version is the
+// snapshot the replay ran against and OriginalVersion the one the run was
+// recorded on; 0 means the draft.
+type ReplayReport struct {
+	RunID           uuid.UUID          `json:"runId"`
+	WorkflowID      uuid.UUID          `json:"workflowId"`
+	OriginalVersion int                `json:"originalVersion"`
+	Version         int                `json:"version"`
+	Diverged        bool               `json:"diverged"`
+	Divergences     []Divergence       `json:"divergences"`
+	OriginalPath    []string           `json:"originalPath"`
+	ReplayPath      []string           `json:"replayPath"`
+	Original        *ExecutionResponse `json:"original"`
+	Replay          *ExecutionResponse `json:"replay"`
+}
+
+// Replay re-executes wf with a recorded run's inputs, answering every
+// integration call from the run's recorded calls, and reports where the
+// replay diverged from the original. Nothing reaches a real client, so
+// replaying against a newer snapshot is a safe way to verify a fix. load
+// loads the workflows subworkflow nodes call; their calls are answered from
+// the recording too. inputs should be the run's inputs before masking: a
+// condition on a masked value would take another branch.
+func Replay(ctx context.Context, wf *storage.Workflow, inputs map[string]any, calls []RecordedCall, original *ExecutionResponse, dryRun bool, load WorkflowLoader) (*ReplayReport, error) {
+	executedAt := time.Now().Format(time.RFC3339)
+	mask := newRunMask(wf)
+	p := newReplayer(calls, mask, inputs)
+	// Secrets are not read: references run as "[secret:NAME]", which is
+	// what the recorded calls show in place of their values.
+	sec := newRunSecrets(nil)
+	expanded, _ := sec.expand(ctx, wf)
+	g, err := compileWorkflow(expanded, p.depsFor)
+	if err != nil {
+		return nil, err
+	}
+	g.resolve = p.resolution
+	g.load = mask.wrapLoad(sec.wrapLoad(load))
+
+	nCtx := &nodes.NodeContext{Variables: make(map[string]any)}
+	for k, v := range inputs {
+		nCtx.Variables[k] = v
+	}
+	result := g.run(ctx, nCtx, dryRun)
+	result.ExecutedAt = executedAt
+	result.Mode = ModeReplay
+	// Both runs are compared masked: the original was stored that way.
+	mask.apply(result, nCtx)
+	masked := *original
+	masked.Steps = maskSteps(result.mask, original.Steps)
+	original = &masked
+
+	report := &ReplayReport{
+		WorkflowID:   wf.ID,
+		Divergences:  compareRuns(original, result),
+		OriginalPath: stepIDs(original.Steps),
+		ReplayPath:   stepIDs(result.Steps),
+		Original:     original,
+		Replay:       result,
+	}
+	for _, m := range p.mismatches {
+		report.Divergences = append(report.Divergences, Divergence{Kind: divergeRequest, Message: m})
+	}
+	for _, c := range p.unused() {
+		report.Divergences = append(report.Divergences, Divergence{
+			Kind:    divergeUnused,
+			NodeID:  c.NodeID,
+			Message: fmt.Sprintf("recorded %s call of node %q was not made: %s", c.Client, c.NodeID, c.Request),
+		})
+	}
+	report.Diverged = len(report.Divergences) > 0
+	return report, nil
+}
+
+// compareRuns walks both step lists side by side. Once the paths part,
+// later steps are not compared since they no longer line up.
+func compareRuns(original, replay *ExecutionResponse) []Divergence {
+	divergences := []Divergence{}
+	n := max(len(original.Steps), len(replay.Steps))
+	for i := 0; i < n; i++ {
+		step := i
+		orig, repl := "(nothing)", "(nothing)"
+		if i < len(original.Steps) {
+			orig = original.Steps[i].NodeID
+		}
+		if i < len(replay.Steps) {
+			repl = replay.Steps[i].NodeID
+		}
+		if orig != repl {
+			divergences = append(divergences, Divergence{
+				Kind:    divergePath,
+				Step:    &step,
+				Message: fmt.Sprintf("step %d: original ran %s, replay ran %s", i+1, orig, repl),
+			})
+			break
+		}
+
+		o, r := original.Steps[i], replay.Steps[i]
+		switch {
+		case o.Status != r.Status:
+			divergences = append(divergences, Divergence{
+				Kind:    divergeStatus,
+				Step:    &step,
+				NodeID:  o.NodeID,
+				Message: fmt.Sprintf("node %q status changed from %s to %s", o.NodeID, o.Status, r.Status),
+			})
+		case !jsonEqualValues(o.Output, r.Output):
+			divergences = append(divergences, Divergence{
+				Kind:    divergeOutput,
+				Step:    &step,
+				NodeID:  o.NodeID,
+				Message: fmt.Sprintf("node %q output changed from %s to %s", o.NodeID, jsonString(o.Output), jsonString(r.Output)),
+			})
+		}
+	}
+
+	if original.Status != replay.Status {
+		divergences = append(divergences, Divergence{
+			Kind:    divergeStatus,
+			Message: fmt.Sprintf("run status changed from %s to %s", original.Status, replay.Status),
+		})
+	}
+	return divergences
+}
+
+func stepIDs(steps []StepResult) []string {
+	ids := make([]string, 0, len(steps))
+	for _, s := range steps {
+		ids = append(ids, s.NodeID)
+	}
+	return ids
+}
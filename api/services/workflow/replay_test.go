@@ -0,0 +1,159 @@
+package workflow_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/pkg/clients/email"
+	"workflow-code-test/api/pkg/clients/flood"
+	"workflow-code-test/api/pkg/clients/sms"
+	"workflow-code-test/api/pkg/clients/weather"
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/storage"
+	"workflow-code-test/api/services/workflow"
+)
+
+func doRequest(t *testing.T, router http.Handler, method, url, body string, v any) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(method, url, strings.NewReader(body)))
+	if v != nil && rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+	}
+	return rec
+}
+
+func TestReplayRun(t *testing.T) {
+	t.Parallel()
+	store := newMemoryStore(t, storage.SeedFixtures())
+	svc, err := workflow.NewService(store, nodes.Deps{
+		Weather: weather.NewStubClient(31.5),
+		Email:   email.NewStubClient("alerts@example.com"),
+		SMS:     sms.NewStubClient(),
+		Flood:   flood.NewStubClient(50),
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	router := newTestRouter(svc)
+	base := "/api/v1/workflows/" + storage.SeedWeatherWorkflowID.String()
+
+	var executed workflow.ExecutionResponse
+	if rec := doRequest(t, router, http.MethodPost, base+"/execute", `{"formData": `+weatherInputsJSON+`}`, &executed); rec.Code != http.StatusOK {
+		t.Fatalf("execute: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if executed.RunID == nil {
+		t.Fatal("expected the execution to be recorded as a run")
+	}
+	runURL := base + "/runs/" + executed.RunID.String()
+
+	var run workflow.RunRecord
+	if rec := doRequest(t, router, http.MethodGet, runURL, "", &run); rec.Code != http.StatusOK {
+		t.Fatalf("get run: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if run.Mode != "live" || run.Version != 0 || run.Status != "completed" || run.Inputs["city"] != "Sydney" {
+		t.Errorf("unexpected run %+v", run)
+	}
+	if len(run.Calls) != 2 || run.Calls[0].Client != "weather" || run.Calls[1].Client != "email" {
+		t.Fatalf("expected recorded weather and email calls, got %+v", run.Calls)
+	}
+	if !strings.Contains(string(run.Calls[0].Response), "31.5") {
+		t.Errorf("expected the recorded temperature, got %s", run.Calls[0].Response)
+	}
+
+	// Replaying the unchanged draft reproduces the run exactly.
+	var report workflow.ReplayReport
+	if rec := doRequest(t, router, http.MethodPost, runURL+"/replay", "", &report); rec.Code != http.StatusOK {
+		t.Fatalf("replay: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if report.Diverged || len(report.Divergences) != 0 {
+		t.Errorf("expected no divergence, got %+v", report.Divergences)
+	}
+	if report.Replay.Mode != workflow.ModeReplay || stepPath(report.Replay.Steps) != stepPath(executed.Steps) {
+		t.Errorf("expected the original path, got %s", stepPath(report.Replay.Steps))
+	}
+
+	// Publish a version whose true branch skips the alert. Replaying against
+	// it reports where the paths part and the email that is no longer sent.
+	wf, err := store.GetWorkflow(context.Background(), storage.SeedWeatherWorkflowID)
+	if err != nil {
+		t.Fatalf("GetWorkflow: %v", err)
+	}
+	for i, e := range wf.Edges {
+		if e.Source == "condition" && e.SourceHandle != nil && *e.SourceHandle == "true" {
+			wf.Edges[i].Target = "end"
+		}
+	}
+	if err := store.UpsertWorkflow(context.Background(), wf); err != nil {
+		t.Fatalf("UpsertWorkflow: %v", err)
+	}
+	if _, err := store.PublishWorkflow(context.Background(), storage.SeedWeatherWorkflowID); err != nil {
+		t.Fatalf("PublishWorkflow: %v", err)
+	}
+
+	report = workflow.ReplayReport{}
+	if rec := doRequest(t, router, http.MethodPost, runURL+"/replay?version=1", "", &report); rec.Code != http.StatusOK {
+		t.Fatalf("replay v1: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !report.Diverged || report.OriginalVersion != 0 || report.Version != 1 {
+		t.Fatalf("expected a divergence against version 1, got %+v", report)
+	}
+	kinds := make([]string, 0, len(report.Divergences))
+	for _, d := range report.Divergences {
+		kinds = append(kinds, d.Kind)
+	}
+	if got := strings.Join(kinds, ","); got != "path,unused_call" {
+		t.Errorf("expected path and unused_call divergences, got %s: %+v", got, report.Divergences)
+	}
+	if d := report.Divergences[0]; d.Step == nil || *d.Step != 4 {
+		t.Errorf("expected the paths to part at the fifth step, got %+v", d)
+	}
+}
+
+func TestReplayRun_Errors(t *testing.T) {
+	t.Parallel()
+	_, router := newDebugTestService(t)
+	base := "/api/v1/workflows/" + storage.SeedWeatherWorkflowID.String()
+
+	var executed workflow.ExecutionResponse
+	doRequest(t, router, http.MethodPost, base+"/execute", `{"formData": `+weatherInputsJSON+`}`, &executed)
+	if executed.RunID == nil {
+		t.Fatal("expected a recorded run")
+	}
+	runURL := base + "/runs/" + executed.RunID.String()
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		wantStatus int
+		wantCode   string
+	}{
+		{"invalid workflow id", http.MethodGet, "/api/v1/workflows/nope/runs/" + executed.RunID.String(), http.StatusBadRequest, "INVALID_ID"},
+		{"invalid run id", http.MethodGet, base + "/runs/nope", http.StatusBadRequest, "INVALID_ID"},
+		{"unknown run", http.MethodGet, base + "/runs/" + uuid.NewString(), http.StatusNotFound, "NOT_FOUND"},
+		{"run of another workflow", http.MethodGet, "/api/v1/workflows/" + storage.SeedFloodWorkflowID.String() + "/runs/" + executed.RunID.String(), http.StatusNotFound, "NOT_FOUND"},
+		{"invalid version", http.MethodPost, runURL + "/replay?version=0", http.StatusBadRequest, "INVALID_VERSION"},
+		{"unknown version", http.MethodPost, runURL + "/replay?version=9", http.StatusNotFound, "NOT_FOUND"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(t, router, tt.method, tt.url, "", nil)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			var body map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["code"] != tt.wantCode {
+				t.Errorf("expected code %s, got %s", tt.wantCode, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/services/storage"
+)
+
+const (
+	// DefaultRetentionInterval is how often RunRetention prunes runs.
+	DefaultRetentionInterval = time.Hour
+
+	// pruneBatchSize is how many runs one PruneRuns call deletes, which
+	// bounds how long its transaction holds locks.
+	pruneBatchSize = 500
+)
+
+// RunArchiver keeps the runs the retention job is about to delete. If it
+// fails, the runs are not deleted. It runs before the delete commits, so a
+// batch whose delete failed is given to it again on the next pass.
+type RunArchiver interface {
+	ArchiveRuns(workflowID uuid.UUID, runs []storage.Run) error
+}
+
+// SetRunArchiver makes the retention job archive runs with a before
+// deleting them.
+func (s *Service) SetRunArchiver(a RunArchiver) {
+	s.archiver = a
+}
+
+// RunRetention prunes runs past their workflow's retention policy every
+// interval until ctx is cancelled.
+func (s *Service) RunRetention(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// Failures are logged and counted by PruneRuns; the next pass
+		// retries them.
+		_, _ = s.PruneRuns(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PruneRuns makes one pass over every workflow with a retention policy and
+// deletes, archiving them first if an archiver is set, the runs the policy
+// no longer keeps. Runs are deleted in batches so no transaction holds
+// locks for long. A workflow that fails to prune does not stop the others;
+// the pass returns how many runs it deleted and the errors it met.
+func (s *Service) PruneRuns(ctx context.Context) (int, error) {
+	start := time.Now()
+	total, err := s.prunePass(ctx)
+	s.metrics.ObserveRetentionPass(err, s.now(), time.Since(start))
+	if err != nil {
+		slog.Error("retention pass failed", "pruned", total, "duration", time.Since(start), "error", err)
+	} else if total > 0 {
+		slog.Info("retention pass finished", "pruned", total, "duration", time.Since(start))
+	}
+	return total, err
+}
+
+func (s *Service) prunePass(ctx context.Context) (int, error) {
+	policies, err := s.storage.ListRetentionPolicies(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("list retention policies: %w", err)
+	}
+	total := 0
+	var errs []error
+	for _, wr := range policies {
+		n, err := s.pruneWorkflow(storage.WithWorkspace(ctx, wr.WorkspaceID), wr)
+		total += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("prune runs of %s: %w", wr.WorkflowID, err))
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return total, errors.Join(errs...)
+}
+
+// pruneWorkflow deletes the runs of one workflow that its policy no longer
+// keeps, a batch at a time.
+func (s *Service) pruneWorkflow(ctx context.Context, wr storage.WorkflowRetention) (int, error) {
+	filter := retentionFilter(wr, s.now())
+	var archive func([]storage.Run) error
+	if s.archiver != nil {
+		archive = func(runs []storage.Run) error { return s.archiver.ArchiveRuns(wr.WorkflowID, runs) }
+	}
+
+	total := 0
+	for ctx.Err() == nil {
+		n, err := s.storage.PruneRuns(ctx, filter, pruneBatchSize, archive)
+		if err != nil {
+			return total, err
+		}
+		total += n
+		archived := 0
+		if archive != nil {
+			archived = n
+		}
+		s.metrics.ObservePruned(n, archived)
+		if n > 0 {
+			slog.Info("pruned runs", "id", wr.WorkflowID, "count", n, "total", total, "archived", archive != nil)
+		}
+		if n < pruneBatchSize {
+			return total, nil
+		}
+	}
+	return total, ctx.Err()
+}
+
+// retentionFilter selects the runs of a workflow that its policy no
+// longer keeps at now.
+func retentionFilter(wr storage.WorkflowRetention, now time.Time) storage.RunPruneFilter {
+	p := wr.Policy
+	filter := storage.RunPruneFilter{WorkflowID: wr.WorkflowID, KeepNewest: max(p.Runs, 0)}
+	if p.Days > 0 {
+		before := now.AddDate(0, 0, -p.Days)
+		filter.Before = &before
+	}
+	if p.FailedDays > 0 {
+		before := now.AddDate(0, 0, -p.FailedDays)
+		filter.FailedBefore = &before
+	}
+	return filter
+}
@@ -0,0 +1,240 @@
+package workflow_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/pkg/clients/weather"
+	"workflow-code-test/api/pkg/metrics"
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/storage"
+	"workflow-code-test/api/services/workflow"
+)
+
+// failingArchiver refuses every batch.
+type failingArchiver struct{}
+
+func (failingArchiver) ArchiveRuns(uuid.UUID, []storage.Run) error {
+	return errors.New("disk full")
+}
+
+// newRetentionStore returns a store whose weather workflow has policy.
+func newRetentionStore(t *testing.T, policy storage.RetentionPolicy) storage.Storage {
+	t.Helper()
+	store := newMemoryStore(t, storage.SeedFixtures())
+	wf, err := store.GetWorkflow(context.Background(), storage.SeedWeatherWorkflowID)
+	if err != nil {
+		t.Fatalf("GetWorkflow: %v", err)
+	}
+	wf.Settings.Retention = policy
+	if err := store.UpsertWorkflow(context.Background(), wf); err != nil {
+		t.Fatalf("UpsertWorkflow: %v", err)
+	}
+	return store
+}
+
+func TestPruneRuns_KeepsNewestAndArchives(t *testing.T) {
+	t.Parallel()
+	store := newRetentionStore(t, storage.RetentionPolicy{Runs: 2})
+	svc, err := workflow.NewService(store, nodes.Deps{Weather: weather.NewStubClient(31), Email: &countingEmail{}})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	m := metrics.New()
+	svc.SetMetrics(m)
+	dir := t.TempDir()
+	archiver, err := workflow.NewFileArchiver(dir)
+	if err != nil {
+		t.Fatalf("NewFileArchiver: %v", err)
+	}
+	svc.SetRunArchiver(archiver)
+	router := newTestRouter(svc)
+	base := "/api/v1/workflows/" + storage.SeedWeatherWorkflowID.String()
+
+	var runIDs []uuid.UUID
+	for range 4 {
+		var resp workflow.ExecutionResponse
+		if rec := doRequest(t, router, http.MethodPost, base+"/execute", `{"formData":`+weatherInputsJSON+`}`, &resp); rec.Code != http.StatusOK {
+			t.Fatalf("execute: expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		runIDs = append(runIDs, *resp.RunID)
+	}
+
+	n, err := svc.PruneRuns(context.Background())
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 runs pruned, got %d, %v", n, err)
+	}
+	var runs runList
+	doRequest(t, router, http.MethodGet, base+"/runs", "", &runs)
+	if len(runs.Runs) != 2 || runs.Runs[0].ID != runIDs[3] || runs.Runs[1].ID != runIDs[2] {
+		t.Errorf("expected the newest two runs to remain, got %+v", runs.Runs)
+	}
+	if n, err := svc.PruneRuns(context.Background()); err != nil || n != 0 {
+		t.Errorf("expected a second pass to prune nothing, got %d, %v", n, err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, storage.SeedWeatherWorkflowID.String(), "runs-*.ndjson.gz"))
+	if len(files) != 1 {
+		t.Fatalf("expected one archive file, got %v", files)
+	}
+	archived := readArchive(t, files[0])
+	if len(archived) != 2 || archived[0].ID != runIDs[0] || archived[1].ID != runIDs[1] || len(archived[0].Result) == 0 {
+		t.Errorf("expected the oldest two runs archived whole, got %+v", archived)
+	}
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		`workflow_retention_runs_pruned_total 2`,
+		`workflow_retention_runs_archived_total 2`,
+		`workflow_retention_passes_total{status="ok"} 2`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("expected %s in the metrics", want)
+		}
+	}
+}
+
+func TestPruneRuns_KeepsFailuresLonger(t *testing.T) {
+	t.Parallel()
+	store := newRetentionStore(t, storage.RetentionPolicy{Days: 7, FailedDays: 30})
+	newService := func(deps nodes.Deps) *workflow.Service {
+		svc, err := workflow.NewService(store, deps)
+		if err != nil {
+			t.Fatalf("NewService: %v", err)
+		}
+		return svc
+	}
+	ok := newService(nodes.Deps{Weather: weather.NewStubClient(31), Email: &countingEmail{}})
+	failing := newService(nodes.Deps{Weather: weather.NewStubClient(31), Email: failingEmail{}})
+	base := "/api/v1/workflows/" + storage.SeedWeatherWorkflowID.String()
+	for _, svc := range []*workflow.Service{ok, failing} {
+		doRequest(t, newTestRouter(svc), http.MethodPost, base+"/execute", `{"formData":`+weatherInputsJSON+`}`, nil)
+	}
+
+	count := func() (total, failed int) {
+		t.Helper()
+		var runs runList
+		doRequest(t, newTestRouter(ok), http.MethodGet, base+"/runs", "", &runs)
+		for _, run := range runs.Runs {
+			if run.Status == "failed" {
+				failed++
+			}
+		}
+		return len(runs.Runs), failed
+	}
+
+	start := time.Now()
+	tests := []struct {
+		name       string
+		after      time.Duration
+		archiver   workflow.RunArchiver
+		wantErr    bool
+		wantTotal  int
+		wantFailed int
+	}{
+		{"within both limits", 6 * 24 * time.Hour, nil, false, 2, 1},
+		{"archive failure deletes nothing", 8 * 24 * time.Hour, failingArchiver{}, true, 2, 1},
+		{"past days, within failedDays", 8 * 24 * time.Hour, nil, false, 1, 1},
+		{"past failedDays", 31 * 24 * time.Hour, nil, false, 0, 0},
+	}
+	for _, tt := range tests {
+		now := start.Add(tt.after)
+		workflow.SetClock(ok, func() time.Time { return now })
+		ok.SetRunArchiver(tt.archiver)
+		if _, err := ok.PruneRuns(context.Background()); (err != nil) != tt.wantErr {
+			t.Fatalf("%s: expected error %v, got %v", tt.name, tt.wantErr, err)
+		}
+		if total, failed := count(); total != tt.wantTotal || failed != tt.wantFailed {
+			t.Errorf("%s: expected %d runs (%d failed), got %d (%d)", tt.name, tt.wantTotal, tt.wantFailed, total, failed)
+		}
+	}
+}
+
+func TestFileArchiver_SkipsArchivedBatch(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	archiver, err := workflow.NewFileArchiver(dir)
+	if err != nil {
+		t.Fatalf("NewFileArchiver: %v", err)
+	}
+	wfID := uuid.New()
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	runs := make([]storage.Run, 3)
+	for i := range runs {
+		runs[i] = storage.Run{ID: uuid.New(), WorkflowID: wfID, Status: "completed", CreatedAt: created.Add(time.Duration(i) * time.Second)}
+	}
+	files := func() []string {
+		t.Helper()
+		files, _ := filepath.Glob(filepath.Join(dir, wfID.String(), "runs-*.ndjson.gz"))
+		return files
+	}
+
+	// A retry of the same batch, e.g. after its delete failed, leaves the
+	// first file alone instead of writing the runs again.
+	if err := archiver.ArchiveRuns(wfID, runs[:2]); err != nil {
+		t.Fatalf("ArchiveRuns: %v", err)
+	}
+	retried := append([]storage.Run(nil), runs[:2]...)
+	retried[0].Status = "failed"
+	if err := archiver.ArchiveRuns(wfID, retried); err != nil {
+		t.Fatalf("ArchiveRuns again: %v", err)
+	}
+	got := files()
+	if len(got) != 1 {
+		t.Fatalf("expected one archive file, got %v", got)
+	}
+	if archived := readArchive(t, got[0]); len(archived) != 2 || archived[0].Status != "completed" {
+		t.Errorf("expected the first archive kept, got %+v", archived)
+	}
+	if want := "runs-20260102T030405.000000Z-" + runs[0].ID.String() + "-" + runs[1].ID.String() + ".ndjson.gz"; filepath.Base(got[0]) != want {
+		t.Errorf("expected %s, got %s", want, filepath.Base(got[0]))
+	}
+
+	// A batch ending at another run gets its own file.
+	if err := archiver.ArchiveRuns(wfID, runs); err != nil {
+		t.Fatalf("ArchiveRuns: %v", err)
+	}
+	if got := files(); len(got) != 2 {
+		t.Errorf("expected a second archive file, got %v", got)
+	}
+}
+
+func readArchive(t *testing.T, path string) []storage.Run {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open archive: %v", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	var runs []storage.Run
+	sc := bufio.NewScanner(gz)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var run storage.Run
+		if err := json.Unmarshal(sc.Bytes(), &run); err != nil {
+			t.Fatalf("decode archived run: %v", err)
+		}
+		runs = append(runs, run)
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatalf("read archive: %v", err)
+	}
+	return runs
+}
@@ -0,0 +1,322 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+
+	"workflow-code-test/api/services/storage"
+)
+
+// RunRecord is the response of the run endpoint: a recorded execution with
+// its inputs, result and integration calls.
+type RunRecord struct {
+	ID         uuid.UUID          `json:"id"`
+	WorkflowID uuid.UUID          `json:"workflowId"`
+	Version    int                `json:"version"`
+	Mode       string             `json:"mode"`
+	Status     string             `json:"status"`
+	FailedNode string             `json:"failedNode,omitempty"`
+	DurationMs int64              `json:"durationMs"`
+	Inputs     map[string]any     `json:"inputs"`
+	Result     *ExecutionResponse `json:"result"`
+	Calls      []RecordedCall     `json:"calls"`
+	CreatedAt  string             `json:"createdAt"`
+}
+
+// startRun records a run of wf as "running" before it executes and
+// returns it. Writing the run counts it against the workspace's hourly run
+// quota in the same transaction, so concurrent executions cannot exceed
+// it. When the run cannot be started, it writes the error and returns nil.
+func (s *Service) startRun(w http.ResponseWriter, r *http.Request, wf *storage.Workflow, version int, opts ExecuteOptions, inputs map[string]any, rid string) *storage.Run {
+	mode := "live"
+	if opts.DryRun {
+		mode = ModeDryRun
+	}
+	run := &storage.Run{
+		ID:         uuid.New(),
+		WorkflowID: wf.ID,
+		Version:    version,
+		Mode:       mode,
+	}
+	// The inputs are masked again once the run has the values to mask.
+	var err error
+	if run.Inputs, err = json.Marshal(newRunMask(wf).masker(nil, nil).Map(inputs)); err == nil {
+		err = encodeRunResult(run, &ExecutionResponse{Status: "running", Steps: []StepResult{}})
+	}
+	if err == nil {
+		err = s.storage.CreateRun(r.Context(), run)
+	}
+	switch {
+	case err == nil:
+		return run
+	case errors.Is(err, storage.ErrQuotaExceeded):
+		slog.Warn("run quota exceeded", "id", wf.ID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "QUOTA_EXCEEDED", err.Error(), http.StatusTooManyRequests)
+	case errors.Is(err, pgx.ErrNoRows):
+		slog.Warn("workflow not found", "id", wf.ID, "requestId", rid)
+		writeErrorJSON(w, "NOT_FOUND", "workflow not found", http.StatusNotFound)
+	default:
+		slog.Error("failed to start run", "id", wf.ID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+	}
+	return nil
+}
+
+// abortRun records a started run that could not execute as failed with
+// message. Failing to record is logged.
+func (s *Service) abortRun(ctx context.Context, run *storage.Run, message, rid string) {
+	err := encodeRunResult(run, &ExecutionResponse{Status: "failed", Steps: []StepResult{}, Error: message})
+	if err == nil {
+		err = s.storage.UpdateRun(context.WithoutCancel(ctx), run)
+	}
+	if err != nil {
+		slog.Error("failed to record aborted run", "id", run.WorkflowID, "run", run.ID, "requestId", rid, "error", err)
+	}
+}
+
+// recordRun stores the execution of a started run so it can be inspected
+// and replayed, and sets its RunID. A suspended run is stored with its
+// state and the task or timer it waits on; its inputs are masked like the
+// result, and what masking hides is sealed (see sealRun). Failing to
+// record is logged; the caller decides whether that fails the request,
+// since a finished execution has already happened.
+func (s *Service) recordRun(ctx context.Context, run *storage.Run, inputs map[string]any, result *ExecutionResponse, rid string) error {
+	task := s.waitFor(run, result)
+
+	var err error
+	if run.Inputs, err = json.Marshal(result.mask.Map(inputs)); err == nil {
+		err = encodeRunResult(run, result)
+	}
+	if err == nil {
+		err = s.sealRun(run, inputs, result.suspended)
+	}
+	// The client may already have gone; the run should still be kept.
+	ctx = context.WithoutCancel(ctx)
+	if err == nil {
+		err = s.storage.UpdateRun(ctx, run)
+	}
+	if err == nil && task != nil {
+		err = s.storage.CreateTask(ctx, task)
+	}
+	if err != nil {
+		slog.Error("failed to record run", "id", run.WorkflowID, "requestId", rid, "error", err)
+		return err
+	}
+	result.RunID = &run.ID
+	return nil
+}
+
+// observeRun records the metrics of a run and of its steps from index
+// first on. Steps before first were recorded when the run suspended.
+func (s *Service) observeRun(wfUUID uuid.UUID, result *ExecutionResponse, first int, elapsed time.Duration) {
+	if s.metrics == nil {
+		return
+	}
+	mode := result.Mode
+	if mode == "" {
+		mode = "live"
+	}
+	s.metrics.ObserveRun(wfUUID.String(), result.Status, mode, elapsed)
+	s.observeSteps(result.Steps[first:])
+}
+
+// observeSteps records each step, including the steps of sub-workflows and
+// loop bodies.
+func (s *Service) observeSteps(steps []StepResult) {
+	for _, step := range steps {
+		s.metrics.ObserveNode(step.Type, step.Status, time.Duration(step.DurationMs)*time.Millisecond)
+		s.observeSteps(step.Steps)
+	}
+}
+
+// encodeRunResult stores the status, failed node, duration, result, calls
+// and, for a suspended run, the resume state of result in run.
+func encodeRunResult(run *storage.Run, result *ExecutionResponse) error {
+	calls := result.calls
+	if calls == nil {
+		calls = []RecordedCall{}
+	}
+	run.Status = result.Status
+	run.FailedNode = result.FailedNode
+	run.DurationMs = 0
+	for _, step := range result.Steps {
+		run.DurationMs += step.DurationMs
+	}
+	run.State = nil
+
+	var err error
+	if run.Result, err = json.Marshal(result); err != nil {
+		return fmt.Errorf("encode result: %w", err)
+	}
+	if run.Calls, err = json.Marshal(calls); err != nil {
+		return fmt.Errorf("encode calls: %w", err)
+	}
+	if result.suspended != nil {
+		if run.State, err = json.Marshal(result.suspended); err != nil {
+			return fmt.Errorf("encode state: %w", err)
+		}
+	}
+	return nil
+}
+
+// HandleGetRun returns a recorded execution of a workflow.
+func (s *Service) HandleGetRun(w http.ResponseWriter, r *http.Request) {
+	rid := reqID(r)
+	wfUUID, run, ok := s.loadRun(w, r, rid)
+	if !ok {
+		return
+	}
+	record, err := decodeRun(run)
+	if err != nil {
+		slog.Error("failed to decode run", "id", wfUUID, "run", run.ID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, record, wfUUID, rid)
+}
+
+// HandleReplayRun re-executes a recorded run with its recorded integration
+// responses injected instead of calling the clients. By default it replays
+// against the snapshot the run was recorded on (or the current draft for
+// draft runs); ?version=N replays against another snapshot, e.g. one that
+// contains a fix. Divergences from the original run are reported with 200.
+func (s *Service) HandleReplayRun(w http.ResponseWriter, r *http.Request) {
+	rid := reqID(r)
+	wfUUID, run, ok := s.loadRun(w, r, rid)
+	if !ok {
+		return
+	}
+
+	version := run.Version
+	if v := r.URL.Query().Get("version"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeErrorJSON(w, "INVALID_VERSION", "version must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		version = n
+	}
+
+	record, err := decodeRun(run)
+	if err != nil {
+		slog.Error("failed to decode run", "id", wfUUID, "run", run.ID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := r.Context()
+	var wf *storage.Workflow
+	if version > 0 {
+		snap, err := s.storage.GetSnapshot(ctx, wfUUID, version)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				slog.Warn("snapshot not found for replay", "id", wfUUID, "version", version, "requestId", rid)
+				writeErrorJSON(w, "NOT_FOUND", "snapshot version not found", http.StatusNotFound)
+				return
+			}
+			slog.Error("failed to get snapshot", "id", wfUUID, "version", version, "requestId", rid, "error", err)
+			writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+			return
+		}
+		wf = &storage.Workflow{ID: wfUUID, Nodes: snap.DagData.Nodes, Edges: snap.DagData.Edges, Settings: snap.DagData.Settings}
+	} else if wf, err = s.storage.GetWorkflow(ctx, wfUUID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			slog.Warn("workflow not found for replay", "id", wfUUID, "requestId", rid)
+			writeErrorJSON(w, "NOT_FOUND", "workflow not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to get workflow", "id", wfUUID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// The stored inputs are masked; the replay runs on the values they had,
+	// if they were sealed.
+	inputs := record.Inputs
+	if sealed, err := s.openRun(run); err != nil {
+		slog.Warn("replaying run with masked inputs", "id", wfUUID, "run", run.ID, "requestId", rid, "error", err)
+	} else if sealed.Inputs != nil {
+		inputs = sealed.Inputs
+	}
+
+	report, err := Replay(ctx, wf, inputs, record.Calls, record.Result, run.Mode == ModeDryRun, s.loadWorkflow)
+	if err != nil {
+		// The target graph no longer compiles; that is the caller's problem
+		// to fix in the snapshot, not a server failure.
+		writeErrorJSON(w, "INVALID_WORKFLOW", err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	report.RunID = run.ID
+	report.OriginalVersion = run.Version
+	report.Version = version
+
+	slog.Info("replayed run", "id", wfUUID, "run", run.ID, "version", version,
+		"principal", principal(r), "requestId", rid, "diverged", report.Diverged)
+	writeJSON(w, http.StatusOK, report, wfUUID, rid)
+}
+
+// loadRun parses the workflow and run IDs in the URL and loads the run,
+// writing the error response when it cannot.
+func (s *Service) loadRun(w http.ResponseWriter, r *http.Request, rid string) (uuid.UUID, *storage.Run, bool) {
+	vars := mux.Vars(r)
+	wfUUID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		slog.Warn("invalid workflow id", "id", vars["id"], "requestId", rid, "error", err)
+		writeErrorJSON(w, "INVALID_ID", "invalid workflow id", http.StatusBadRequest)
+		return uuid.Nil, nil, false
+	}
+	runID, err := uuid.Parse(vars["runId"])
+	if err != nil {
+		slog.Warn("invalid run id", "run", vars["runId"], "requestId", rid, "error", err)
+		writeErrorJSON(w, "INVALID_ID", "invalid run id", http.StatusBadRequest)
+		return uuid.Nil, nil, false
+	}
+
+	run, err := s.storage.GetRun(r.Context(), wfUUID, runID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			slog.Warn("run not found", "id", wfUUID, "run", runID, "requestId", rid)
+			writeErrorJSON(w, "NOT_FOUND", "run not found", http.StatusNotFound)
+			return uuid.Nil, nil, false
+		}
+		slog.Error("failed to get run", "id", wfUUID, "run", runID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return uuid.Nil, nil, false
+	}
+	return wfUUID, run, true
+}
+
+// decodeRun turns the stored JSON columns of a run back into their types.
+func decodeRun(run *storage.Run) (*RunRecord, error) {
+	record := &RunRecord{
+		ID:         run.ID,
+		WorkflowID: run.WorkflowID,
+		Version:    run.Version,
+		Mode:       run.Mode,
+		Status:     run.Status,
+		FailedNode: run.FailedNode,
+		DurationMs: run.DurationMs,
+		CreatedAt:  run.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if err := json.Unmarshal(run.Inputs, &record.Inputs); err != nil {
+		return nil, fmt.Errorf("decode inputs: %w", err)
+	}
+	if err := json.Unmarshal(run.Result, &record.Result); err != nil {
+		return nil, fmt.Errorf("decode result: %w", err)
+	}
+	if err := json.Unmarshal(run.Calls, &record.Calls); err != nil {
+		return nil, fmt.Errorf("decode calls: %w", err)
+	}
+	record.Result.RunID = &record.ID
+	return record, nil
+}
@@ -0,0 +1,308 @@
+package workflow
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+
+	"workflow-code-test/api/services/storage"
+)
+
+const (
+	defaultRunPageSize = 50
+	maxRunPageSize     = 500
+
+	// DefaultStatsWindow is how far back run statistics look when the
+	// request has no ?since=.
+	DefaultStatsWindow = 24 * time.Hour
+
+	// inputFilterPrefix marks the query parameters that filter runs by an
+	// input variable, e.g. ?input.city=Sydney.
+	inputFilterPrefix = "input."
+)
+
+// runStatuses are the statuses a recorded run can have.
+var runStatuses = map[string]bool{"running": true, "completed": true, "failed": true, "cancelled": true, "waiting": true}
+
+// RunSummary is a run as listed by the runs endpoint: what it ran with and
+// how it ended, without its steps and calls.
+type RunSummary struct {
+	ID         uuid.UUID      `json:"id"`
+	Version    int            `json:"version"`
+	Mode       string         `json:"mode"`
+	Status     string         `json:"status"`
+	FailedNode string         `json:"failedNode,omitempty"`
+	DurationMs int64          `json:"durationMs"`
+	Inputs     map[string]any `json:"inputs"`
+	CreatedAt  string         `json:"createdAt"`
+}
+
+// runsBody is the response of the runs endpoint. NextCursor is set when
+// there are older runs; pass it as ?cursor= to get them.
+type runsBody struct {
+	Runs       []RunSummary `json:"runs"`
+	NextCursor string       `json:"nextCursor,omitempty"`
+}
+
+// RunStatsResponse is the response of the run statistics endpoint.
+// SuccessRate is the share of finished runs that completed, null when no
+// run finished in the window.
+type RunStatsResponse struct {
+	WorkflowID    uuid.UUID              `json:"workflowId"`
+	Since         string                 `json:"since"`
+	Until         string                 `json:"until"`
+	Total         int                    `json:"total"`
+	ByStatus      map[string]int         `json:"byStatus"`
+	SuccessRate   *float64               `json:"successRate"`
+	P50DurationMs float64                `json:"p50DurationMs"`
+	P95DurationMs float64                `json:"p95DurationMs"`
+	FailingNodes  []storage.NodeFailures `json:"failingNodes"`
+}
+
+// HandleListRuns lists the recorded runs of a workflow, newest first.
+// ?status=, ?mode=, ?since=, ?until=, ?failedNode=, ?version= and
+// ?input.<name>= narrow the list; ?limit= sets the page size and ?cursor=
+// continues from a previous page's nextCursor.
+func (s *Service) HandleListRuns(w http.ResponseWriter, r *http.Request) {
+	rid := reqID(r)
+	wf, ok := s.loadRunWorkflow(w, r, rid)
+	if !ok {
+		return
+	}
+	wfUUID := wf.ID
+	q := r.URL.Query()
+	filter, ok := parseRunFilter(w, wf, q)
+	if !ok {
+		return
+	}
+
+	limit := defaultRunPageSize
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxRunPageSize {
+			writeErrorJSON(w, "INVALID_LIMIT", fmt.Sprintf("limit must be between 1 and %d", maxRunPageSize), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	if v := q.Get("cursor"); v != "" {
+		cursor, err := decodeRunCursor(v)
+		if err != nil {
+			slog.Warn("invalid run cursor", "id", wfUUID, "requestId", rid, "error", err)
+			writeErrorJSON(w, "INVALID_CURSOR", "invalid cursor", http.StatusBadRequest)
+			return
+		}
+		filter.Cursor = cursor
+	}
+	// One more than a page tells whether another page follows.
+	filter.Limit = limit + 1
+
+	runs, err := s.storage.ListRuns(r.Context(), filter)
+	if err != nil {
+		slog.Error("failed to list runs", "id", wfUUID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	body := runsBody{Runs: make([]RunSummary, 0, min(len(runs), limit))}
+	if len(runs) > limit {
+		runs = runs[:limit]
+		last := runs[limit-1]
+		body.NextCursor = encodeRunCursor(storage.RunCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	for _, run := range runs {
+		summary := RunSummary{
+			ID:         run.ID,
+			Version:    run.Version,
+			Mode:       run.Mode,
+			Status:     run.Status,
+			FailedNode: run.FailedNode,
+			DurationMs: run.DurationMs,
+			CreatedAt:  run.CreatedAt.Format(time.RFC3339),
+		}
+		if err := json.Unmarshal(run.Inputs, &summary.Inputs); err != nil {
+			slog.Error("failed to decode run inputs", "id", wfUUID, "run", run.ID, "requestId", rid, "error", err)
+			writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+			return
+		}
+		body.Runs = append(body.Runs, summary)
+	}
+	writeJSON(w, http.StatusOK, body, wfUUID, rid)
+}
+
+// HandleRunStats aggregates the runs of a workflow created in a window:
+// counts by status, success rate, median and 95th percentile duration and
+// the nodes runs failed at most. The window is ?since= to ?until=, the last
+// DefaultStatsWindow by default; the other filters of HandleListRuns apply.
+func (s *Service) HandleRunStats(w http.ResponseWriter, r *http.Request) {
+	rid := reqID(r)
+	wf, ok := s.loadRunWorkflow(w, r, rid)
+	if !ok {
+		return
+	}
+	wfUUID := wf.ID
+	filter, ok := parseRunFilter(w, wf, r.URL.Query())
+	if !ok {
+		return
+	}
+	if filter.Until == nil {
+		until := s.now()
+		filter.Until = &until
+	}
+	if filter.Since == nil {
+		since := filter.Until.Add(-DefaultStatsWindow)
+		filter.Since = &since
+	}
+
+	stats, err := s.storage.RunStats(r.Context(), filter)
+	if err != nil {
+		slog.Error("failed to aggregate runs", "id", wfUUID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := RunStatsResponse{
+		WorkflowID:    wfUUID,
+		Since:         filter.Since.Format(time.RFC3339),
+		Until:         filter.Until.Format(time.RFC3339),
+		Total:         stats.Total,
+		ByStatus:      stats.ByStatus,
+		P50DurationMs: stats.P50DurationMs,
+		P95DurationMs: stats.P95DurationMs,
+		FailingNodes:  stats.FailingNodes,
+	}
+	if finished := stats.Total - stats.ByStatus["running"] - stats.ByStatus["waiting"]; finished > 0 {
+		rate := float64(stats.ByStatus["completed"]) / float64(finished)
+		resp.SuccessRate = &rate
+	}
+	writeJSON(w, http.StatusOK, resp, wfUUID, rid)
+}
+
+// loadRunWorkflow parses the workflow ID in the URL and loads the workflow,
+// writing the error response when it does not exist.
+func (s *Service) loadRunWorkflow(w http.ResponseWriter, r *http.Request, rid string) (*storage.Workflow, bool) {
+	id := mux.Vars(r)["id"]
+	wfUUID, err := uuid.Parse(id)
+	if err != nil {
+		slog.Warn("invalid workflow id", "id", id, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INVALID_ID", "invalid workflow id", http.StatusBadRequest)
+		return nil, false
+	}
+	wf, err := s.storage.GetWorkflow(r.Context(), wfUUID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			slog.Warn("workflow not found for runs", "id", wfUUID, "requestId", rid)
+			writeErrorJSON(w, "NOT_FOUND", "workflow not found", http.StatusNotFound)
+			return nil, false
+		}
+		slog.Error("failed to get workflow", "id", wfUUID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return wf, true
+}
+
+// parseRunFilter reads the run filters in q, writing the error response
+// when one is invalid. An input filter value is matched as JSON when it
+// parses as JSON (?input.threshold=25 matches the number) and as a string
+// otherwise. Runs are stored with their inputs masked, so filtering by a
+// sensitive variable, or by a value holding an email address or phone
+// number, is rejected rather than never matching.
+func parseRunFilter(w http.ResponseWriter, wf *storage.Workflow, q url.Values) (storage.RunFilter, bool) {
+	filter := storage.RunFilter{WorkflowID: wf.ID, FailedNode: q.Get("failedNode")}
+
+	if status := q.Get("status"); status != "" {
+		if !runStatuses[status] {
+			writeErrorJSON(w, "INVALID_STATUS", fmt.Sprintf("unknown run status %q", status), http.StatusBadRequest)
+			return filter, false
+		}
+		filter.Status = status
+	}
+	switch mode := q.Get("mode"); mode {
+	case "", "live", ModeDryRun:
+		filter.Mode = mode
+	default:
+		writeErrorJSON(w, "INVALID_MODE", fmt.Sprintf("unknown run mode %q", mode), http.StatusBadRequest)
+		return filter, false
+	}
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeErrorJSON(w, "INVALID_TIME", p.name+" must be an RFC 3339 time", http.StatusBadRequest)
+			return filter, false
+		}
+		*p.dst = &t
+	}
+	if v := q.Get("version"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeErrorJSON(w, "INVALID_VERSION", "version must be a non-negative integer", http.StatusBadRequest)
+			return filter, false
+		}
+		filter.Version = &n
+	}
+	mk := newRunMask(wf).masker(nil, nil)
+	for key, values := range q {
+		name, ok := strings.CutPrefix(key, inputFilterPrefix)
+		if !ok || len(values) == 0 {
+			continue
+		}
+		if filter.Inputs == nil {
+			filter.Inputs = make(map[string]any)
+		}
+		var v any
+		if err := json.Unmarshal([]byte(values[0]), &v); err != nil {
+			v = values[0]
+		}
+		if mk.Sensitive(name) || !reflect.DeepEqual(mk.Value(v), v) {
+			writeErrorJSON(w, "MASKED_INPUT", fmt.Sprintf("input %q is masked in recorded runs and cannot be filtered on", name), http.StatusBadRequest)
+			return filter, false
+		}
+		filter.Inputs[name] = v
+	}
+	return filter, true
+}
+
+// encodeRunCursor returns the opaque ?cursor= value of a position in the
+// run list.
+func encodeRunCursor(c storage.RunCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.CreatedAt.UTC().Format(time.RFC3339Nano) + "_" + c.ID.String()))
+}
+
+func decodeRunCursor(s string) (*storage.RunCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("decode cursor: %w", err)
+	}
+	ts, id, ok := strings.Cut(string(raw), "_")
+	if !ok {
+		return nil, fmt.Errorf("malformed cursor %q", raw)
+	}
+	c := &storage.RunCursor{}
+	if c.CreatedAt, err = time.Parse(time.RFC3339Nano, ts); err != nil {
+		return nil, fmt.Errorf("parse cursor time: %w", err)
+	}
+	if c.ID, err = uuid.Parse(id); err != nil {
+		return nil, fmt.Errorf("parse cursor id: %w", err)
+	}
+	return c, nil
+}
@@ -0,0 +1,209 @@
+package workflow_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"workflow-code-test/api/pkg/clients/email"
+	"workflow-code-test/api/pkg/clients/weather"
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/storage"
+	"workflow-code-test/api/services/workflow"
+)
+
+// failingEmail fails every delivery, so runs fail at the email node.
+type failingEmail struct{}
+
+func (failingEmail) Send(context.Context, email.Message) (*email.Result, error) {
+	return nil, errors.New("smtp unavailable")
+}
+
+type runList struct {
+	Runs       []workflow.RunSummary `json:"runs"`
+	NextCursor string                `json:"nextCursor"`
+}
+
+func TestRunHistory(t *testing.T) {
+	t.Parallel()
+	store := newMemoryStore(t, storage.SeedFixtures())
+	newRouter := func(mailer email.Client) http.Handler {
+		svc, err := workflow.NewService(store, nodes.Deps{Weather: weather.NewStubClient(31), Email: mailer})
+		if err != nil {
+			t.Fatalf("NewService: %v", err)
+		}
+		return newTestRouter(svc)
+	}
+	ok, failing := newRouter(&countingEmail{}), newRouter(failingEmail{})
+	base := "/api/v1/workflows/" + storage.SeedWeatherWorkflowID.String()
+
+	execute := func(router http.Handler, inputs string) workflow.ExecutionResponse {
+		t.Helper()
+		var resp workflow.ExecutionResponse
+		if rec := doRequest(t, router, http.MethodPost, base+"/execute", `{"formData":`+inputs+`}`, &resp); rec.Code != http.StatusOK {
+			t.Fatalf("execute: expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		return resp
+	}
+	execute(ok, weatherInputsJSON)
+	execute(ok, weatherInputsJSON)
+	execute(ok, strings.Replace(weatherInputsJSON, `"threshold":25`, `"threshold":40`, 1))
+	failed := execute(failing, weatherInputsJSON)
+	if failed.Status != "failed" || failed.FailedNode == "" {
+		t.Fatalf("expected a run failing at a node, got %+v", failed)
+	}
+
+	list := func(query string) runList {
+		t.Helper()
+		var runs runList
+		if rec := doRequest(t, ok, http.MethodGet, base+"/runs"+query, "", &runs); rec.Code != http.StatusOK {
+			t.Fatalf("list runs%s: expected 200, got %d: %s", query, rec.Code, rec.Body.String())
+		}
+		return runs
+	}
+
+	all := list("")
+	if len(all.Runs) != 4 || all.NextCursor != "" {
+		t.Fatalf("expected 4 runs on one page, got %d (cursor %q)", len(all.Runs), all.NextCursor)
+	}
+	if all.Runs[0].ID != *failed.RunID || all.Runs[0].FailedNode != failed.FailedNode {
+		t.Errorf("expected the failed run first, got %+v", all.Runs[0])
+	}
+	if all.Runs[1].Status != "completed" || all.Runs[1].Inputs["threshold"] != float64(40) {
+		t.Errorf("expected the completed run with threshold 40 second, got %+v", all.Runs[1])
+	}
+
+	filters := []struct {
+		query string
+		want  int
+	}{
+		{"?status=failed", 1},
+		{"?status=completed", 3},
+		{"?failedNode=" + url.QueryEscape(failed.FailedNode), 1},
+		{"?input.threshold=40", 1},
+		{"?input.city=Sydney&input.threshold=25", 3},
+		{"?input.city=Perth", 0},
+		{"?version=0", 4},
+		{"?version=1", 0},
+		{"?mode=dry-run", 0},
+		{"?until=2000-01-01T00:00:00Z", 0},
+	}
+	for _, f := range filters {
+		if got := list(f.query); len(got.Runs) != f.want {
+			t.Errorf("%s: expected %d runs, got %d", f.query, f.want, len(got.Runs))
+		}
+	}
+
+	first := list("?limit=3")
+	if len(first.Runs) != 3 || first.NextCursor == "" {
+		t.Fatalf("expected a full first page with a cursor, got %d (cursor %q)", len(first.Runs), first.NextCursor)
+	}
+	second := list("?limit=3&cursor=" + first.NextCursor)
+	if len(second.Runs) != 1 || second.NextCursor != "" || second.Runs[0].ID != all.Runs[3].ID {
+		t.Errorf("expected the last run alone on the second page, got %+v", second)
+	}
+
+	var stats workflow.RunStatsResponse
+	if rec := doRequest(t, ok, http.MethodGet, base+"/runs/stats", "", &stats); rec.Code != http.StatusOK {
+		t.Fatalf("stats: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if stats.Total != 4 || stats.ByStatus["completed"] != 3 || stats.ByStatus["failed"] != 1 {
+		t.Errorf("unexpected counts %+v", stats)
+	}
+	if stats.SuccessRate == nil || *stats.SuccessRate != 0.75 {
+		t.Errorf("expected a success rate of 0.75, got %v", stats.SuccessRate)
+	}
+	if len(stats.FailingNodes) != 1 || stats.FailingNodes[0] != (storage.NodeFailures{NodeID: failed.FailedNode, Failures: 1}) {
+		t.Errorf("expected %s as the only failing node, got %+v", failed.FailedNode, stats.FailingNodes)
+	}
+
+	var empty workflow.RunStatsResponse
+	doRequest(t, ok, http.MethodGet, base+"/runs/stats?since=2000-01-01T00:00:00Z&until=2000-01-02T00:00:00Z", "", &empty)
+	if empty.Total != 0 || empty.SuccessRate != nil || empty.Since != "2000-01-01T00:00:00Z" {
+		t.Errorf("expected an empty window without a success rate, got %+v", empty)
+	}
+}
+
+func TestRunHistory_Errors(t *testing.T) {
+	t.Parallel()
+	_, router := newDebugTestService(t)
+	base := "/api/v1/workflows/" + storage.SeedWeatherWorkflowID.String()
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+		wantCode   string
+	}{
+		{"invalid workflow id", "/api/v1/workflows/nope/runs", http.StatusBadRequest, "INVALID_ID"},
+		{"unknown workflow", "/api/v1/workflows/00000000-0000-0000-0000-000000000001/runs", http.StatusNotFound, "NOT_FOUND"},
+		{"unknown workflow stats", "/api/v1/workflows/00000000-0000-0000-0000-000000000001/runs/stats", http.StatusNotFound, "NOT_FOUND"},
+		{"invalid status", base + "/runs?status=done", http.StatusBadRequest, "INVALID_STATUS"},
+		{"invalid mode", base + "/runs?mode=test", http.StatusBadRequest, "INVALID_MODE"},
+		{"invalid since", base + "/runs/stats?since=yesterday", http.StatusBadRequest, "INVALID_TIME"},
+		{"invalid version", base + "/runs?version=-1", http.StatusBadRequest, "INVALID_VERSION"},
+		{"limit too large", base + "/runs?limit=501", http.StatusBadRequest, "INVALID_LIMIT"},
+		{"invalid cursor", base + "/runs?cursor=bm9wZQ", http.StatusBadRequest, "INVALID_CURSOR"},
+		{"masked input", base + "/runs?input.email=alice@example.com", http.StatusBadRequest, "MASKED_INPUT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(t, router, http.MethodGet, tt.url, "", nil)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			var body map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["code"] != tt.wantCode {
+				t.Errorf("expected code %s, got %s", tt.wantCode, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRunHistory_MaskedInputFilters(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	store := newMemoryStore(t, storage.SeedFixtures())
+	wf, err := store.GetWorkflow(ctx, storage.SeedWeatherWorkflowID)
+	if err != nil {
+		t.Fatalf("GetWorkflow: %v", err)
+	}
+	wf.Settings.SensitiveVariables = []string{"city"}
+	if err := store.UpsertWorkflow(ctx, wf); err != nil {
+		t.Fatalf("UpsertWorkflow: %v", err)
+	}
+	svc, err := workflow.NewService(store, nodes.Deps{Weather: weather.NewStubClient(31), Email: &countingEmail{}})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	router := newTestRouter(svc)
+	base := "/api/v1/workflows/" + storage.SeedWeatherWorkflowID.String()
+	if rec := doRequest(t, router, http.MethodPost, base+"/execute", `{"formData":`+weatherInputsJSON+`}`, nil); rec.Code != http.StatusOK {
+		t.Fatalf("execute: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// The run is stored with the city and email masked: filtering on them
+	// is refused, naming the input, instead of silently matching nothing.
+	for _, f := range []struct{ query, input string }{
+		{"/runs?input.city=Sydney", "city"},
+		{"/runs/stats?input.city=Sydney", "city"},
+		{"/runs?input.email=alice@example.com", "email"},
+	} {
+		rec := doRequest(t, router, http.MethodGet, base+f.query, "", nil)
+		var body struct{ Code, Message string }
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || rec.Code != http.StatusBadRequest || body.Code != "MASKED_INPUT" {
+			t.Errorf("%s: expected 400 MASKED_INPUT, got %d: %s", f.query, rec.Code, rec.Body.String())
+		} else if !strings.Contains(body.Message, `"`+f.input+`"`) {
+			t.Errorf("%s: expected the error to name %q, got %q", f.query, f.input, body.Message)
+		}
+	}
+
+	var runs runList
+	if rec := doRequest(t, router, http.MethodGet, base+"/runs?input.name=Alice&input.threshold=25", "", &runs); rec.Code != http.StatusOK || len(runs.Runs) != 1 {
+		t.Errorf("expected the run found by its unmasked inputs, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,137 @@
+package workflow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/storage"
+)
+
+// InputSchema describes the inputs a workflow's execute request must
+// provide. It is derived from the workflow's form nodes.
+type InputSchema struct {
+	WorkflowID uuid.UUID           `json:"workflowId"`
+	Version    int                 `json:"version,omitempty"` // the published snapshot; 0 for the draft
+	Fields     []nodes.FieldSchema `json:"fields"`
+}
+
+// FieldError is a problem with one input field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// inputSchema collects the fields of every form node, in node order. A
+// field several forms collect is declared by the first of them.
+func inputSchema(wf *storage.Workflow) ([]nodes.FieldSchema, error) {
+	fields := []nodes.FieldSchema{}
+	seen := make(map[string]bool)
+	for _, sn := range wf.Nodes {
+		if sn.Type != "form" {
+			continue
+		}
+		form, err := nodes.NewFormNode(nodes.BaseFields{ID: sn.ID, NodeType: sn.Type, Metadata: sn.Data.Metadata})
+		if err != nil {
+			return nil, fmt.Errorf("failed to construct node %q: %w", sn.ID, err)
+		}
+		if err := form.Validate(); err != nil {
+			return nil, fmt.Errorf("node %q failed validation: %w", sn.ID, err)
+		}
+		for _, f := range form.Schema() {
+			if !seen[f.Name] {
+				seen[f.Name] = true
+				fields = append(fields, f)
+			}
+		}
+	}
+	return fields, nil
+}
+
+// applySchema checks inputs against fields and fills in defaults for
+// missing fields. Inputs the schema does not mention are left alone.
+func applySchema(fields []nodes.FieldSchema, inputs map[string]any) []FieldError {
+	var errs []FieldError
+	for _, f := range fields {
+		v, ok := inputs[f.Name]
+		if !ok {
+			switch {
+			case f.Default != nil:
+				inputs[f.Name] = f.Default
+			case f.Required:
+				errs = append(errs, FieldError{Field: f.Name, Message: "is required"})
+			}
+			continue
+		}
+		if err := f.Check(v); err != nil {
+			errs = append(errs, FieldError{Field: f.Name, Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+// writeInputErrors writes a 400 INVALID_INPUT response listing every
+// invalid field.
+func writeInputErrors(w http.ResponseWriter, errs []FieldError) {
+	message := fmt.Sprintf("%d input fields are invalid", len(errs))
+	if len(errs) == 1 {
+		message = fmt.Sprintf("input field %q %s", errs[0].Field, errs[0].Message)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]any{"code": "INVALID_INPUT", "message": message, "fields": errs})
+}
+
+// HandleGetInputSchema returns the input schema of what an execute request
+// would run, so clients can render and check the form before submitting.
+func (s *Service) HandleGetInputSchema(w http.ResponseWriter, r *http.Request) {
+	rid := reqID(r)
+	id := mux.Vars(r)["id"]
+	slog.Debug("returning workflow input schema", "id", id, "requestId", rid)
+
+	wfUUID, err := uuid.Parse(id)
+	if err != nil {
+		slog.Warn("invalid workflow id", "id", id, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INVALID_ID", "invalid workflow id", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	wf, version, err := s.loadExecutable(ctx, wfUUID, rid)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			slog.Warn("workflow not found", "id", wfUUID, "requestId", rid)
+			writeErrorJSON(w, "NOT_FOUND", "workflow not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to load workflow for input schema", "id", wfUUID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	fields, err := inputSchema(wf)
+	if err != nil {
+		slog.Error("failed to build input schema", "id", wfUUID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	payload, err := json.Marshal(InputSchema{WorkflowID: wfUUID, Version: version, Fields: fields})
+	if err != nil {
+		slog.Error("failed to marshal input schema", "id", wfUUID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(payload); err != nil {
+		slog.Error("failed to write response", "id", wfUUID, "requestId", rid, "error", err)
+	}
+}
@@ -0,0 +1,152 @@
+package workflow_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/storage"
+	"workflow-code-test/api/services/workflow"
+)
+
+// saveSignupWorkflow stores start -> signup -> end, where signup is a form
+// declaring typed fields.
+func saveSignupWorkflow(t *testing.T, store storage.Storage) uuid.UUID {
+	t.Helper()
+	ctx := context.Background()
+	entry := &storage.NodeLibraryEntry{NodeType: "form", Label: "Sign Up", Metadata: json.RawMessage(`{
+		"inputFields": ["email", "city", "age"],
+		"outputVariables": ["email", "city", "age"],
+		"fields": [
+			{"name": "email", "type": "string", "required": true, "pattern": "^[^@]+@[^@]+$"},
+			{"name": "city", "type": "string", "enum": ["Sydney", "Perth"], "default": "Sydney"},
+			{"name": "age", "type": "integer", "min": 18}
+		]}`)}
+	if err := store.CreateNodeLibraryEntry(ctx, entry); err != nil {
+		t.Fatalf("CreateNodeLibraryEntry: %v", err)
+	}
+	id := uuid.New()
+	wf := &storage.Workflow{
+		ID:   id,
+		Name: "Sign Up",
+		Nodes: []storage.Node{
+			{ID: "start", Type: "start"},
+			{ID: "signup", Type: "form", LibraryID: entry.ID},
+			{ID: "end", Type: "end"},
+		},
+		Edges: []storage.Edge{
+			{ID: "e1", Source: "start", Target: "signup"},
+			{ID: "e2", Source: "signup", Target: "end"},
+		},
+	}
+	if err := store.UpsertWorkflow(ctx, wf); err != nil {
+		t.Fatalf("UpsertWorkflow: %v", err)
+	}
+	return id
+}
+
+func TestInputSchema_Endpoint(t *testing.T) {
+	t.Parallel()
+	store := newMemoryStore(t, storage.SeedFixtures())
+	svc, err := workflow.NewService(store, nodes.Deps{})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	router := newTestRouter(svc)
+	signupID := saveSignupWorkflow(t, store)
+
+	// Seeded forms declare no fields: every input field is required and
+	// accepts any value.
+	var seeded workflow.InputSchema
+	if rec := doRequest(t, router, http.MethodGet, "/api/v1/workflows/"+storage.SeedWeatherWorkflowID.String()+"/schema", "", &seeded); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	want := []nodes.FieldSchema{{Name: "name", Required: true}, {Name: "email", Required: true}, {Name: "city", Required: true}}
+	if !reflect.DeepEqual(seeded.Fields, want) {
+		t.Errorf("expected %+v, got %+v", want, seeded.Fields)
+	}
+
+	var signup workflow.InputSchema
+	doRequest(t, router, http.MethodGet, "/api/v1/workflows/"+signupID.String()+"/schema", "", &signup)
+	if len(signup.Fields) != 3 || signup.Fields[0].Pattern == "" || signup.Fields[1].Default != "Sydney" || *signup.Fields[2].Min != 18 {
+		t.Errorf("expected the declared fields, got %+v", signup.Fields)
+	}
+
+	if rec := doRequest(t, router, http.MethodGet, "/api/v1/workflows/"+uuid.NewString()+"/schema", "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown workflow, got %d", rec.Code)
+	}
+}
+
+func TestInputSchema_ValidatesExecute(t *testing.T) {
+	t.Parallel()
+	store := newMemoryStore(t, storage.SeedFixtures())
+	svc, err := workflow.NewService(store, nodes.Deps{})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	router := newTestRouter(svc)
+	url := "/api/v1/workflows/" + saveSignupWorkflow(t, store).String() + "/execute"
+
+	tests := []struct {
+		name       string
+		formData   string
+		wantFields []workflow.FieldError
+		wantOutput map[string]any
+	}{
+		{
+			name:       "valid inputs take defaults",
+			formData:   `{"email": "alice@example.com"}`,
+			wantOutput: map[string]any{"email": "a***@example.com", "city": "Sydney"},
+		},
+		{
+			name:     "missing required field",
+			formData: `{}`,
+			wantFields: []workflow.FieldError{
+				{Field: "email", Message: "is required"},
+			},
+		},
+		{
+			name:     "every invalid field is reported",
+			formData: `{"email": "alice", "city": "Darwin", "age": 17.5}`,
+			wantFields: []workflow.FieldError{
+				{Field: "email", Message: "must match ^[^@]+@[^@]+$"},
+				{Field: "city", Message: `must be one of "Sydney", "Perth"`},
+				{Field: "age", Message: "must be an integer"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var body struct {
+				Code   string                `json:"code"`
+				Fields []workflow.FieldError `json:"fields"`
+				workflow.ExecutionResponse
+			}
+			rec := doRequest(t, router, http.MethodPost, url, `{"formData": `+tt.formData+`}`, nil)
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if tt.wantFields != nil {
+				if rec.Code != http.StatusBadRequest || body.Code != "INVALID_INPUT" {
+					t.Fatalf("expected 400 INVALID_INPUT, got %d: %s", rec.Code, rec.Body.String())
+				}
+				if !reflect.DeepEqual(body.Fields, tt.wantFields) {
+					t.Errorf("expected fields %+v, got %+v", tt.wantFields, body.Fields)
+				}
+				return
+			}
+			if rec.Code != http.StatusOK || body.Status != "completed" {
+				t.Fatalf("expected a completed run, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if got := body.Steps[1].Output; !reflect.DeepEqual(got, tt.wantOutput) {
+				t.Errorf("expected form output %v, got %v", tt.wantOutput, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package workflow_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/storage"
+	"workflow-code-test/api/services/workflow"
+)
+
+// buildTwoReadingsWorkflow looks up the temperature twice, so the flat
+// temperature variable holds the second reading while nodes.first and
+// nodes.second keep both:
+//
+//	start -> first -> second -> check -(true)-> alert -> end
+func buildTwoReadingsWorkflow(settings storage.WorkflowSettings) *storage.Workflow {
+	withMeta := func(n storage.Node, meta string) storage.Node {
+		n.Data.Metadata = json.RawMessage(meta)
+		return n
+	}
+	lookup := `{"apiEndpoint":"https://example.com","inputVariables":["city"],"options":[{"city":"Sydney","lat":-33.8688,"lon":151.2093}]}`
+	wf := buildWorkflow(
+		[]storage.Node{
+			node("start", "start"),
+			withMeta(node("first", "integration"), lookup),
+			withMeta(node("second", "integration"), lookup),
+			withMeta(node("check", "condition"), `{"conditionVariable":"nodes.first.temperature"}`),
+			withMeta(node("alert", "email"), `{"inputVariables":["nodes.first.temperature","nodes.second.temperature","temperature"],"emailTemplate":{
+				"subject":"First {{nodes.first.temperature}}",
+				"body":"Second {{nodes.second.temperature}}, latest {{temperature}}"}}`),
+			node("end", "end"),
+		},
+		[]storage.Edge{
+			edge("e1", "start", "first", nil),
+			edge("e2", "first", "second", nil),
+			edge("e3", "second", "check", nil),
+			edge("e4", "check", "alert", strPtr("true")),
+			edge("e5", "check", "end", strPtr("false")),
+			edge("e6", "alert", "end", nil),
+		},
+	)
+	wf.Settings = settings
+	return wf
+}
+
+// sequenceWeather answers each lookup with the next reading.
+type sequenceWeather struct {
+	readings []float64
+}
+
+func (s *sequenceWeather) GetTemperature(context.Context, float64, float64) (float64, error) {
+	r := s.readings[0]
+	s.readings = s.readings[1:]
+	return r, nil
+}
+
+func TestScopedOutputs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		settings storage.WorkflowSettings
+		wantBody string
+	}{
+		{
+			name:     "flat names stay available by default",
+			wantBody: "Second 10, latest 10",
+		},
+		{
+			name:     "scoped outputs only",
+			settings: storage.WorkflowSettings{ScopedOutputsOnly: true},
+			wantBody: "Second 10, latest {{temperature}}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			deps := nodes.Deps{Weather: &sequenceWeather{readings: []float64{30, 10}}, Email: &countingEmail{}}
+			inputs := map[string]any{"city": "Sydney", "email": "alice@example.com", "operator": "greater_than", "threshold": 25}
+			result, err := workflow.Execute(context.Background(), buildTwoReadingsWorkflow(tt.settings), inputs, deps, workflow.ExecuteOptions{DryRun: true})
+			if err != nil {
+				t.Fatalf("Execute: %v", err)
+			}
+			// The condition compares the first reading, not the latest.
+			if result.Status != "completed" || stepPath(result.Steps) != "start,first,second,check,alert,end" {
+				t.Fatalf("expected the alert branch, got %s %s: %s", result.Status, stepPath(result.Steps), result.Error)
+			}
+			draft, _ := result.Steps[4].Output["emailDraft"].(map[string]any)
+			if draft["subject"] != "First 30" || draft["body"] != tt.wantBody {
+				t.Errorf("expected subject %q and body %q, got %q and %q", "First 30", tt.wantBody, draft["subject"], draft["body"])
+			}
+		})
+	}
+}
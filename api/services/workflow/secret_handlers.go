@@ -0,0 +1,151 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+
+	"workflow-code-test/api/services/secrets"
+	"workflow-code-test/api/services/storage"
+)
+
+// maxSecretValue bounds the size of a secret value.
+const maxSecretValue = 8 << 10
+
+type secretsBody struct {
+	Secrets []storage.Secret `json:"secrets"`
+}
+
+// putSecretBody is the body of a set secret request.
+type putSecretBody struct {
+	Value string `json:"value"`
+}
+
+// SetSecretsBox makes the service store secrets sealed with box and
+// expand the references to them when workflows run. Without one the
+// secrets endpoints answer 503 and workflows that refer to a secret fail
+// to start.
+func (s *Service) SetSecretsBox(box *secrets.Box) {
+	s.secrets = box
+}
+
+// lookupSecret is the SecretLookup of live runs: it opens a secret of the
+// workspace ctx is scoped to.
+func (s *Service) lookupSecret(ctx context.Context, name string) (string, error) {
+	if s.secrets == nil {
+		return "", fmt.Errorf("secret %s: no secrets key is configured: %w", name, ErrSecretNotSet)
+	}
+	sec, err := s.storage.GetSecret(ctx, name)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", fmt.Errorf("secret %s: %w", name, ErrSecretNotSet)
+		}
+		return "", fmt.Errorf("get secret %s: %w", name, err)
+	}
+	return s.secrets.Open(storage.WorkspaceFrom(ctx), name, sec.Ciphertext)
+}
+
+// requireSecretsBox writes a 503 and returns false when no secrets key is
+// configured.
+func (s *Service) requireSecretsBox(w http.ResponseWriter) bool {
+	if s.secrets == nil {
+		writeErrorJSON(w, "SECRETS_DISABLED", "secrets are not configured on this server", http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+// HandleListSecrets lists the names of the workspace's secrets. Values are
+// never returned.
+func (s *Service) HandleListSecrets(w http.ResponseWriter, r *http.Request) {
+	rid := reqID(r)
+	if !s.requireSecretsBox(w) {
+		return
+	}
+	list, err := s.storage.ListSecrets(r.Context())
+	if err != nil {
+		slog.Error("failed to list secrets", "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, secretsBody{Secrets: list}, uuid.Nil, rid)
+}
+
+// HandlePutSecret sets the value of a secret, creating it with 201 or
+// replacing it with 200. Runs already in flight keep the value they
+// started with.
+func (s *Service) HandlePutSecret(w http.ResponseWriter, r *http.Request) {
+	rid := reqID(r)
+	if !s.requireSecretsBox(w) {
+		return
+	}
+	name := mux.Vars(r)["name"]
+	if !secrets.ValidName(name) {
+		writeErrorJSON(w, "INVALID_NAME", "name must be 1 to 128 letters, digits or underscores, not starting with a digit", http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+	var body putSecretBody
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil {
+		slog.Warn("failed to decode secret", "secret", name, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INVALID_BODY", "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if body.Value == "" || len(body.Value) > maxSecretValue {
+		writeErrorJSON(w, "INVALID_VALUE", fmt.Sprintf("value must be 1 to %d bytes", maxSecretValue), http.StatusBadRequest)
+		return
+	}
+
+	sealed, err := s.secrets.Seal(storage.WorkspaceFrom(r.Context()), name, body.Value)
+	if err != nil {
+		slog.Error("failed to seal secret", "secret", name, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+	sec := &storage.Secret{Name: name, Ciphertext: sealed, UpdatedBy: principal(r)}
+	created, err := s.storage.PutSecret(r.Context(), sec)
+	if err != nil {
+		slog.Error("failed to store secret", "secret", name, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	slog.Info("set secret", "secret", name, "created", created, "principal", principal(r), "requestId", rid)
+	writeJSON(w, status, sec, uuid.Nil, rid)
+}
+
+// HandleDeleteSecret deletes a secret. Workflows that still refer to it
+// fail to start until it is set again.
+func (s *Service) HandleDeleteSecret(w http.ResponseWriter, r *http.Request) {
+	rid := reqID(r)
+	if !s.requireSecretsBox(w) {
+		return
+	}
+	name := mux.Vars(r)["name"]
+	if err := s.storage.DeleteSecret(r.Context(), name); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			writeErrorJSON(w, "NOT_FOUND", "secret not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to delete secret", "secret", name, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("deleted secret", "secret", name, "principal", principal(r), "requestId", rid)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,179 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/services/secrets"
+	"workflow-code-test/api/services/storage"
+)
+
+// SecretLookup returns the value of a secret of the workspace a run
+// belongs to. A secret that is not set is reported as ErrSecretNotSet.
+type SecretLookup func(ctx context.Context, name string) (string, error)
+
+// ErrSecretNotSet is returned, wrapped with the name, when a workflow
+// refers to a secret that cannot be read.
+var ErrSecretNotSet = errors.New("secret is not set")
+
+// runSecrets expands the {{secret:NAME}} references in the metadata of the
+// workflows a run executes, sub-workflows included, and redacts the values
+// it looked up from the run's result. Without a lookup, as for test cases
+// and replays that run against fakes, references expand to "[secret:NAME]"
+// and no value is ever read.
+type runSecrets struct {
+	lookup SecretLookup
+
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func newRunSecrets(lookup SecretLookup) *runSecrets {
+	return &runSecrets{lookup: lookup, values: make(map[string]string)}
+}
+
+// expand returns wf with its references replaced by the secrets' values,
+// or wf itself when it has none. The stored graph keeps the references.
+func (s *runSecrets) expand(ctx context.Context, wf *storage.Workflow) (*storage.Workflow, error) {
+	var expanded []storage.Node
+	for i, n := range wf.Nodes {
+		names := secrets.Refs(n.Data.Metadata)
+		if len(names) == 0 {
+			continue
+		}
+		values, err := s.resolve(ctx, names)
+		if err != nil {
+			return nil, fmt.Errorf("node %q: %w", n.ID, err)
+		}
+		if expanded == nil {
+			expanded = append([]storage.Node(nil), wf.Nodes...)
+		}
+		expanded[i].Data.Metadata = secrets.Expand(n.Data.Metadata, values)
+	}
+	if expanded == nil {
+		return wf, nil
+	}
+	cp := *wf
+	cp.Nodes = expanded
+	return &cp, nil
+}
+
+// resolve looks up names, once per run each.
+func (s *runSecrets) resolve(ctx context.Context, names []string) (map[string]string, error) {
+	values := make(map[string]string, len(names))
+	if s.lookup == nil {
+		for _, name := range names {
+			values[name] = "[secret:" + name + "]"
+		}
+		return values, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range names {
+		v, ok := s.values[name]
+		if !ok {
+			var err error
+			if v, err = s.lookup(ctx, name); err != nil {
+				return nil, err
+			}
+			s.values[name] = v
+		}
+		values[name] = v
+	}
+	return values, nil
+}
+
+// wrapLoad expands the workflows load returns.
+func (s *runSecrets) wrapLoad(load WorkflowLoader) WorkflowLoader {
+	if load == nil {
+		return load
+	}
+	return func(ctx context.Context, id uuid.UUID, version int) (*storage.Workflow, error) {
+		wf, err := load(ctx, id, version)
+		if err != nil {
+			return nil, err
+		}
+		return s.expand(ctx, wf)
+	}
+}
+
+// redactor returns a Redactor for the values looked up so far, nil if
+// there are none.
+func (s *runSecrets) redactor() *secrets.Redactor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.values) == 0 {
+		return nil
+	}
+	return secrets.NewRedactor(s.values)
+}
+
+// redact removes the values looked up from everything a result exposes
+// or persists: step outputs and errors, recorded calls and the variables
+// of a suspended run.
+func (s *runSecrets) redact(result *ExecutionResponse) {
+	r := s.redactor()
+	if r == nil {
+		return
+	}
+	result.Steps = redactSteps(r, result.Steps)
+	result.Error = r.Redact(result.Error)
+	for i := range result.calls {
+		c := &result.calls[i]
+		c.Request = redactRaw(r, c.Request)
+		c.Response = redactRaw(r, c.Response)
+		c.Error = r.Redact(c.Error)
+	}
+	if result.suspended != nil {
+		result.suspended.Variables = redactMap(r, result.suspended.Variables)
+	}
+}
+
+// redactSteps returns a copy of steps with the values redacted.
+func redactSteps(r *secrets.Redactor, steps []StepResult) []StepResult {
+	if steps == nil {
+		return nil
+	}
+	out := make([]StepResult, len(steps))
+	for i, step := range steps {
+		step.Output = redactMap(r, step.Output)
+		step.Error = r.Redact(step.Error)
+		step.Steps = redactSteps(r, step.Steps)
+		out[i] = step
+	}
+	return out
+}
+
+// redactMap returns m, or a copy with the values redacted when its JSON
+// form contains any.
+func redactMap(r *secrets.Redactor, m map[string]any) map[string]any {
+	if m == nil {
+		return nil
+	}
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return m
+	}
+	redacted := r.Redact(string(raw))
+	if redacted == string(raw) {
+		return m
+	}
+	var out map[string]any
+	if err := json.Unmarshal([]byte(redacted), &out); err != nil {
+		return m
+	}
+	return out
+}
+
+func redactRaw(r *secrets.Redactor, raw json.RawMessage) json.RawMessage {
+	if raw == nil {
+		return nil
+	}
+	return json.RawMessage(r.Redact(string(raw)))
+}
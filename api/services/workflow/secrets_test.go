@@ -0,0 +1,135 @@
+package workflow_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"workflow-code-test/api/pkg/clients/email"
+	"workflow-code-test/api/pkg/clients/weather"
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/secrets"
+	"workflow-code-test/api/services/storage"
+	"workflow-code-test/api/services/workflow"
+)
+
+// capturingEmail records the messages it is asked to send.
+type capturingEmail struct {
+	mu   sync.Mutex
+	sent []email.Message
+}
+
+func (c *capturingEmail) Send(_ context.Context, msg email.Message) (*email.Result, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, msg)
+	return &email.Result{DeliveryStatus: "sent", Sent: true}, nil
+}
+
+// secretFixtures is the seed data with the alert email signed with the
+// ALERT_TOKEN secret.
+func secretFixtures() storage.Fixtures {
+	fixtures := storage.SeedFixtures()
+	for i, entry := range fixtures.Library {
+		if entry.NodeType == "email" {
+			fixtures.Library[i].Metadata = json.RawMessage(strings.Replace(string(entry.Metadata),
+				`Temperature is {{temperature}}°C!`, `Temperature is {{temperature}}°C! Token: {{secret:ALERT_TOKEN}}`, 1))
+		}
+	}
+	return fixtures
+}
+
+func TestSecrets_ExpandedAtExecutionAndRedacted(t *testing.T) {
+	t.Parallel()
+	mailer := &capturingEmail{}
+	svc, err := workflow.NewService(newMemoryStore(t, secretFixtures()), nodes.Deps{Weather: weather.NewStubClient(31), Email: mailer})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	box, err := secrets.NewBox(bytes.Repeat([]byte{1}, secrets.KeySize))
+	if err != nil {
+		t.Fatalf("NewBox: %v", err)
+	}
+	svc.SetSecretsBox(box)
+	router := newTestRouter(svc)
+	seed := storage.SeedWeatherWorkflowID.String()
+	execute := `{"formData":` + weatherInputsJSON + `}`
+
+	rec := doRequest(t, router, http.MethodPost, "/api/v1/workflows/"+seed+"/execute", execute, nil)
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), `"code":"SECRET_NOT_SET"`) {
+		t.Errorf("expected an unset secret to return 422 SECRET_NOT_SET, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	for _, tc := range []struct {
+		name, method, url, body string
+		wantStatus              int
+	}{
+		{"create", http.MethodPut, "/api/v1/secrets/ALERT_TOKEN", `{"value":"first-token"}`, http.StatusCreated},
+		{"replace", http.MethodPut, "/api/v1/secrets/ALERT_TOKEN", `{"value":"tok-3f9a\"c1"}`, http.StatusOK},
+		{"invalid name", http.MethodPut, "/api/v1/secrets/1BAD", `{"value":"x"}`, http.StatusBadRequest},
+		{"empty value", http.MethodPut, "/api/v1/secrets/OTHER", `{"value":""}`, http.StatusBadRequest},
+		{"delete unknown", http.MethodDelete, "/api/v1/secrets/OTHER", "", http.StatusNotFound},
+	} {
+		if rec := doRequest(t, router, tc.method, tc.url, tc.body, nil); rec.Code != tc.wantStatus {
+			t.Errorf("%s: expected %d, got %d: %s", tc.name, tc.wantStatus, rec.Code, rec.Body.String())
+		}
+	}
+	rec = doRequest(t, router, http.MethodGet, "/api/v1/secrets", "", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"name":"ALERT_TOKEN"`) || strings.Contains(rec.Body.String(), "tok-3f9a") {
+		t.Errorf("expected the secret listed without its value, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var result workflow.ExecutionResponse
+	rec = doRequest(t, router, http.MethodPost, "/api/v1/workflows/"+seed+"/execute", execute, &result)
+	if rec.Code != http.StatusOK || result.Status != "completed" {
+		t.Fatalf("execute: expected a completed run, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(mailer.sent) != 1 || !strings.Contains(mailer.sent[0].Body, `Token: tok-3f9a"c1`) {
+		t.Errorf("expected the client to receive the secret's value, got %+v", mailer.sent)
+	}
+	if strings.Contains(rec.Body.String(), "tok-3f9a") || !strings.Contains(rec.Body.String(), "Token: [secret:ALERT_TOKEN]") {
+		t.Errorf("expected the value redacted from the response, got %s", rec.Body.String())
+	}
+	if result.RunID == nil {
+		t.Fatal("expected the run to be recorded")
+	}
+	rec = doRequest(t, router, http.MethodGet, "/api/v1/workflows/"+seed+"/runs/"+result.RunID.String(), "", nil)
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "tok-3f9a") {
+		t.Errorf("expected the value redacted from the stored run, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = doRequest(t, router, http.MethodGet, "/api/v1/workflows/"+seed, "", nil)
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "tok-3f9a") || !strings.Contains(rec.Body.String(), "{{secret:ALERT_TOKEN}}") {
+		t.Errorf("expected the workflow to keep the reference, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := doRequest(t, router, http.MethodDelete, "/api/v1/secrets/ALERT_TOKEN", "", nil); rec.Code != http.StatusNoContent {
+		t.Errorf("delete: expected 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = doRequest(t, router, http.MethodGet, "/api/v1/audit-events?targetType=secret", "", nil)
+	if rec.Code != http.StatusOK || strings.Count(rec.Body.String(), `"targetId":"ALERT_TOKEN"`) != 3 {
+		t.Errorf("expected create, update and delete events, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestSecrets_DisabledWithoutKey(t *testing.T) {
+	t.Parallel()
+	svc, err := workflow.NewService(newMemoryStore(t, secretFixtures()), nodes.Deps{Weather: weather.NewStubClient(31), Email: &countingEmail{}})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	router := newTestRouter(svc)
+
+	rec := doRequest(t, router, http.MethodPut, "/api/v1/secrets/ALERT_TOKEN", `{"value":"token"}`, nil)
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "SECRETS_DISABLED") {
+		t.Errorf("expected 503 SECRETS_DISABLED, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = doRequest(t, router, http.MethodPost, "/api/v1/workflows/"+storage.SeedWeatherWorkflowID.String()+"/execute", `{"formData":`+weatherInputsJSON+`}`, nil)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected a workflow with a secret to fail to start, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -4,11 +4,18 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
+
+	"workflow-code-test/api/pkg/metrics"
+	"workflow-code-test/api/services/auth"
 	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/secrets"
 	"workflow-code-test/api/services/storage"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type contextKey string
@@ -21,6 +28,15 @@ const requestIDKey contextKey = "requestID"
 type Service struct {
 	storage storage.Storage
 	deps    nodes.Deps
+	debug   *debugSessions
+	limits  *executionLimiter
+	now     func() time.Time // decides when tasks expire
+
+	idempotencyRetention time.Duration
+	metrics              *metrics.Metrics    // nil records nothing
+	archiver             RunArchiver         // nil deletes pruned runs without archiving them
+	auth                 *auth.Authenticator // nil leaves every route open
+	secrets              *secrets.Box        // nil disables secrets
 }
 
 // NewService creates a workflow Service with the given storage backend
@@ -29,7 +45,12 @@ func NewService(store storage.Storage, deps nodes.Deps) (*Service, error) {
 	if store == nil {
 		return nil, fmt.Errorf("service: store cannot be nil")
 	}
-	return &Service{storage: store, deps: deps}, nil
+	return &Service{storage: store, deps: deps, debug: newDebugSessions(), limits: newExecutionLimiter(), now: time.Now, idempotencyRetention: DefaultIdempotencyRetention}, nil
+}
+
+// SetMetrics makes the service record run and node metrics in m.
+func (s *Service) SetMetrics(m *metrics.Metrics) {
+	s.metrics = m
 }
 
 // requestIDMiddleware assigns a unique ID to each request for log correlation.
@@ -41,6 +62,8 @@ func requestIDMiddleware(next http.Handler) http.Handler {
 			id = uuid.New().String()
 		}
 		ctx := context.WithValue(r.Context(), requestIDKey, id)
+		// Tie the request's span to the ID its log lines carry.
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("http.request.id", id))
 		w.Header().Set("X-Request-ID", id)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -55,12 +78,108 @@ func jsonMiddleware(next http.Handler) http.Handler {
 }
 
 func (s *Service) LoadRoutes(parentRouter *mux.Router) {
-	router := parentRouter.PathPrefix("/workflows").Subrouter()
-	router.StrictSlash(false)
-	router.Use(requestIDMiddleware)
-	router.Use(jsonMiddleware)
-
-	router.HandleFunc("/{id}", s.HandleGetWorkflow).Methods("GET")
-	router.HandleFunc("/{id}/execute", s.HandleExecuteWorkflow).Methods("POST")
-	router.HandleFunc("/{id}/publish", s.HandlePublishWorkflow).Methods("POST")
+	// Viewers may only read; changing or running a workflow needs an
+	// editor, publishing a publisher and managing API keys or reading the
+	// audit log or secrets an admin. Workspaces and API keys span every workspace, so
+	// they also need credentials not bound to one.
+	viewer := func(h http.HandlerFunc) http.HandlerFunc { return s.require(auth.RoleViewer, h) }
+	editor := func(h http.HandlerFunc) http.HandlerFunc { return s.require(auth.RoleEditor, h) }
+	publisher := func(h http.HandlerFunc) http.HandlerFunc { return s.require(auth.RolePublisher, h) }
+	admin := func(h http.HandlerFunc) http.HandlerFunc { return s.require(auth.RoleAdmin, h) }
+	globalAdmin := func(h http.HandlerFunc) http.HandlerFunc { return s.requireUnbound(auth.RoleAdmin, h) }
+	// Endpoints that run nodes against the live clients are rate limited
+	// and capped in how many may run at once. Execute admits itself once
+	// its idempotency key is claimed.
+	executor := func(h http.HandlerFunc) http.HandlerFunc { return editor(s.limitExecutions(h)) }
+
+	// Workflows, tasks, audit events and secrets are served for the default
+	// workspace at the top level and for every workspace under
+	// /workspaces/{workspace}.
+	for _, scope := range []*mux.Router{parentRouter, parentRouter.PathPrefix("/workspaces/{workspace}").Subrouter()} {
+		router := scope.PathPrefix("/workflows").Subrouter()
+		router.StrictSlash(false)
+		router.Use(requestIDMiddleware)
+		router.Use(s.authenticate)
+		router.Use(s.inWorkspace)
+		router.Use(auditMiddleware)
+		router.Use(jsonMiddleware)
+
+		router.HandleFunc("/{id}", viewer(s.HandleGetWorkflow)).Methods("GET")
+		router.HandleFunc("/{id}/execute", editor(s.HandleExecuteWorkflow)).Methods("POST")
+		router.HandleFunc("/{id}/schema", viewer(s.HandleGetInputSchema)).Methods("GET")
+		router.HandleFunc("/{id}/publish", publisher(s.HandlePublishWorkflow)).Methods("POST")
+		router.HandleFunc("/{id}/export", viewer(s.HandleExportWorkflow)).Methods("GET")
+		router.HandleFunc("/{id}/tests", viewer(s.HandleListTestCases)).Methods("GET")
+		router.HandleFunc("/{id}/tests", editor(s.HandleReplaceTestCases)).Methods("PUT")
+		router.HandleFunc("/{id}/test", editor(s.HandleRunTestCases)).Methods("POST")
+		router.HandleFunc("/{id}/debug", editor(s.HandleStartDebugSession)).Methods("POST")
+		router.HandleFunc("/{id}/debug/{sessionId}", viewer(s.HandleGetDebugSession)).Methods("GET")
+		router.HandleFunc("/{id}/debug/{sessionId}", editor(s.HandleDeleteDebugSession)).Methods("DELETE")
+		router.HandleFunc("/{id}/debug/{sessionId}/step", executor(s.HandleDebugStep)).Methods("POST")
+		router.HandleFunc("/{id}/debug/{sessionId}/continue", executor(s.HandleDebugContinue)).Methods("POST")
+		router.HandleFunc("/{id}/debug/{sessionId}/breakpoints", editor(s.HandleSetBreakpoints)).Methods("PUT")
+		router.HandleFunc("/{id}/debug/{sessionId}/variables", editor(s.HandlePatchDebugVariables)).Methods("PATCH")
+		router.HandleFunc("/{id}/runs", viewer(s.HandleListRuns)).Methods("GET")
+		router.HandleFunc("/{id}/runs/stats", viewer(s.HandleRunStats)).Methods("GET")
+		router.HandleFunc("/{id}/runs/{runId}", viewer(s.HandleGetRun)).Methods("GET")
+		router.HandleFunc("/{id}/runs/{runId}/replay", editor(s.HandleReplayRun)).Methods("POST")
+		router.HandleFunc("/import", editor(s.HandleImportWorkflow)).Methods("POST")
+
+		tasks := scope.PathPrefix("/tasks").Subrouter()
+		tasks.StrictSlash(false)
+		tasks.Use(requestIDMiddleware)
+		tasks.Use(s.authenticate)
+		tasks.Use(s.inWorkspace)
+		tasks.Use(auditMiddleware)
+		tasks.Use(jsonMiddleware)
+
+		tasks.HandleFunc("", viewer(s.HandleListTasks)).Methods("GET")
+		tasks.HandleFunc("/{taskId}", viewer(s.HandleGetTask)).Methods("GET")
+		tasks.HandleFunc("/{taskId}/approve", executor(s.HandleTaskAction(actionApprove))).Methods("POST")
+		tasks.HandleFunc("/{taskId}/reject", executor(s.HandleTaskAction(actionReject))).Methods("POST")
+		tasks.HandleFunc("/{taskId}/submit", executor(s.HandleTaskAction(actionSubmit))).Methods("POST")
+
+		audit := scope.PathPrefix("/audit-events").Subrouter()
+		audit.StrictSlash(false)
+		audit.Use(requestIDMiddleware)
+		audit.Use(s.authenticate)
+		audit.Use(s.inWorkspace)
+		audit.Use(jsonMiddleware)
+
+		audit.HandleFunc("", admin(s.HandleListAuditEvents)).Methods("GET")
+
+		secretRoutes := scope.PathPrefix("/secrets").Subrouter()
+		secretRoutes.StrictSlash(false)
+		secretRoutes.Use(requestIDMiddleware)
+		secretRoutes.Use(s.authenticate)
+		secretRoutes.Use(s.inWorkspace)
+		secretRoutes.Use(auditMiddleware)
+		secretRoutes.Use(jsonMiddleware)
+
+		secretRoutes.HandleFunc("", admin(s.HandleListSecrets)).Methods("GET")
+		secretRoutes.HandleFunc("/{name}", admin(s.HandlePutSecret)).Methods("PUT")
+		secretRoutes.HandleFunc("/{name}", admin(s.HandleDeleteSecret)).Methods("DELETE")
+	}
+
+	keys := parentRouter.PathPrefix("/api-keys").Subrouter()
+	keys.StrictSlash(false)
+	keys.Use(requestIDMiddleware)
+	keys.Use(s.authenticate)
+	keys.Use(auditMiddleware)
+	keys.Use(jsonMiddleware)
+
+	keys.HandleFunc("", globalAdmin(s.HandleListAPIKeys)).Methods("GET")
+	keys.HandleFunc("", globalAdmin(s.HandleCreateAPIKey)).Methods("POST")
+	keys.HandleFunc("/{keyId}", globalAdmin(s.HandleRevokeAPIKey)).Methods("DELETE")
+
+	// Registered after the workspace-scoped routes, which share its prefix.
+	workspaces := parentRouter.PathPrefix("/workspaces").Subrouter()
+	workspaces.StrictSlash(false)
+	workspaces.Use(requestIDMiddleware)
+	workspaces.Use(s.authenticate)
+	workspaces.Use(jsonMiddleware)
+
+	workspaces.HandleFunc("", globalAdmin(s.HandleListWorkspaces)).Methods("GET")
+	workspaces.HandleFunc("", globalAdmin(s.HandleCreateWorkspace)).Methods("POST")
+	workspaces.HandleFunc("/{workspace}", globalAdmin(s.HandleUpdateWorkspace)).Methods("PUT")
 }
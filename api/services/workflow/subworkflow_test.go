@@ -0,0 +1,247 @@
+package workflow_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/pkg/clients/weather"
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/storage"
+	"workflow-code-test/api/services/workflow"
+)
+
+// saveCaller stores workflow id as start -> call -> end, where call is a
+// subworkflow node configured by meta.
+func saveCaller(t *testing.T, store storage.Storage, id uuid.UUID, meta string) {
+	t.Helper()
+	ctx := context.Background()
+	entry := &storage.NodeLibraryEntry{NodeType: "subworkflow", Label: "Call", Metadata: json.RawMessage(meta)}
+	if err := store.CreateNodeLibraryEntry(ctx, entry); err != nil {
+		t.Fatalf("CreateNodeLibraryEntry: %v", err)
+	}
+	wf := &storage.Workflow{
+		ID:   id,
+		Name: "Caller " + id.String(),
+		Nodes: []storage.Node{
+			{ID: "start", Type: "start"},
+			{ID: "call", Type: "subworkflow", LibraryID: entry.ID},
+			{ID: "end", Type: "end"},
+		},
+		Edges: []storage.Edge{
+			{ID: "e1", Source: "start", Target: "call"},
+			{ID: "e2", Source: "call", Target: "end"},
+		},
+	}
+	if err := store.UpsertWorkflow(ctx, wf); err != nil {
+		t.Fatalf("UpsertWorkflow: %v", err)
+	}
+}
+
+func callMeta(target uuid.UUID, version int) string {
+	return fmt.Sprintf(`{"workflowId":%q,"version":%d}`, target, version)
+}
+
+// saveBriefing stores start -> weather-check -> end and returns its ID.
+// The seeded Weather Check blueprint calls the Weather Check System.
+func saveBriefing(t *testing.T, store storage.Storage) uuid.UUID {
+	t.Helper()
+	id := uuid.New()
+	if err := store.UpsertWorkflow(context.Background(), &storage.Workflow{
+		ID:   id,
+		Name: "Morning Briefing",
+		Nodes: []storage.Node{
+			{ID: "start", Type: "start"},
+			{ID: "weather-check", Type: "subworkflow"},
+			{ID: "end", Type: "end"},
+		},
+		Edges: []storage.Edge{
+			{ID: "e1", Source: "start", Target: "weather-check"},
+			{ID: "e2", Source: "weather-check", Target: "end"},
+		},
+	}); err != nil {
+		t.Fatalf("UpsertWorkflow: %v", err)
+	}
+	return id
+}
+
+func TestSubworkflow_NestsChildSteps(t *testing.T) {
+	t.Parallel()
+	store := newMemoryStore(t, storage.SeedFixtures())
+	sent := &countingEmail{}
+	svc, err := workflow.NewService(store, nodes.Deps{Weather: weather.NewStubClient(31.5), Email: sent})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	router := newTestRouter(svc)
+
+	base := "/api/v1/workflows/" + saveBriefing(t, store).String()
+
+	var executed workflow.ExecutionResponse
+	if rec := doRequest(t, router, http.MethodPost, base+"/execute", `{"formData": `+weatherInputsJSON+`}`, &executed); rec.Code != http.StatusOK {
+		t.Fatalf("execute: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if executed.Status != "completed" || stepPath(executed.Steps) != "start,weather-check,end" {
+		t.Fatalf("expected the caller to complete, got %s %s: %s", executed.Status, stepPath(executed.Steps), executed.Error)
+	}
+	call := executed.Steps[1]
+	if got := stepPath(call.Steps); got != "start,form,weather-api,condition,email,end" {
+		t.Errorf("expected the child's steps under the call, got %s", got)
+	}
+	if call.Output["temperature"] != 31.5 || call.Output["conditionMet"] != true || len(call.Output) != 2 {
+		t.Errorf("expected only the mapped outputs, got %v", call.Output)
+	}
+	if sent.sent.Load() != 1 {
+		t.Errorf("expected the child to send one email, got %d", sent.sent.Load())
+	}
+
+	// The child's calls are recorded under the call node, so a replay
+	// answers them without diverging.
+	runURL := base + "/runs/" + executed.RunID.String()
+	var run workflow.RunRecord
+	doRequest(t, router, http.MethodGet, runURL, "", &run)
+	if len(run.Calls) != 2 || run.Calls[0].NodeID != "weather-check/weather-api" || run.Calls[1].NodeID != "weather-check/email" {
+		t.Fatalf("expected the child's calls keyed by the call node, got %+v", run.Calls)
+	}
+	var report workflow.ReplayReport
+	if rec := doRequest(t, router, http.MethodPost, runURL+"/replay", "", &report); rec.Code != http.StatusOK {
+		t.Fatalf("replay: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if report.Diverged {
+		t.Errorf("expected no divergence, got %+v", report.Divergences)
+	}
+
+	// A dry run can mock the child's integration nodes.
+	executed = workflow.ExecutionResponse{}
+	body := `{"formData": ` + weatherInputsJSON + `, "mocks": {"weather-check/weather-api": {"temperature": 12}}}`
+	if rec := doRequest(t, router, http.MethodPost, base+"/execute?mode=dry-run", body, &executed); rec.Code != http.StatusOK {
+		t.Fatalf("dry run: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if executed.Status != "completed" || executed.Steps[1].Output["temperature"] != 12.0 || executed.Steps[1].Output["conditionMet"] != false {
+		t.Errorf("expected the mocked reading, got %+v", executed.Steps[1])
+	}
+	if sent.sent.Load() != 1 {
+		t.Errorf("expected no email from the dry run, got %d", sent.sent.Load())
+	}
+}
+
+func TestSubworkflow_Errors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, store storage.Storage) uuid.UUID // returns the workflow to execute
+		wantErr string
+	}{
+		{
+			name: "calls itself",
+			setup: func(t *testing.T, store storage.Storage) uuid.UUID {
+				id := uuid.New()
+				saveCaller(t, store, id, callMeta(id, 0))
+				return id
+			},
+			wantErr: "sub-workflow cycle",
+		},
+		{
+			name: "mutual recursion",
+			setup: func(t *testing.T, store storage.Storage) uuid.UUID {
+				a, b := uuid.New(), uuid.New()
+				saveCaller(t, store, a, callMeta(b, 0))
+				saveCaller(t, store, b, callMeta(a, 0))
+				return a
+			},
+			wantErr: "sub-workflow cycle",
+		},
+		{
+			name: "nested too deeply",
+			setup: func(t *testing.T, store storage.Storage) uuid.UUID {
+				ids := make([]uuid.UUID, 8)
+				for i := range ids {
+					ids[i] = uuid.New()
+				}
+				for i := 0; i < len(ids)-1; i++ {
+					saveCaller(t, store, ids[i], callMeta(ids[i+1], 0))
+				}
+				return ids[0]
+			},
+			wantErr: "nested deeper than",
+		},
+		{
+			name: "unknown workflow",
+			setup: func(t *testing.T, store storage.Storage) uuid.UUID {
+				id := uuid.New()
+				saveCaller(t, store, id, callMeta(uuid.New(), 0))
+				return id
+			},
+			wantErr: "not found",
+		},
+		{
+			name: "unpublished version",
+			setup: func(t *testing.T, store storage.Storage) uuid.UUID {
+				id := uuid.New()
+				saveCaller(t, store, id, callMeta(storage.SeedWeatherWorkflowID, 3))
+				return id
+			},
+			wantErr: "(version 3) not found",
+		},
+		{
+			name: "child fails",
+			setup: func(t *testing.T, store storage.Storage) uuid.UUID {
+				id := uuid.New()
+				// No inputs are mapped, so the child's form node fails.
+				saveCaller(t, store, id, callMeta(storage.SeedWeatherWorkflowID, 0))
+				return id
+			},
+			wantErr: "failed: node \"form\" failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			store := newMemoryStore(t, storage.SeedFixtures())
+			svc, err := workflow.NewService(store, nodes.Deps{Weather: weather.NewStubClient(31.5), Email: &countingEmail{}})
+			if err != nil {
+				t.Fatalf("NewService: %v", err)
+			}
+			id := tt.setup(t, store)
+
+			var executed workflow.ExecutionResponse
+			url := "/api/v1/workflows/" + id.String() + "/execute"
+			if rec := doRequest(t, newTestRouter(svc), http.MethodPost, url, `{}`, &executed); rec.Code != http.StatusOK {
+				t.Fatalf("execute: expected 200, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if executed.Status != "failed" || executed.FailedNode != "call" || !strings.Contains(executed.Error, tt.wantErr) {
+				t.Errorf("expected the call to fail with %q, got %s at %q: %s", tt.wantErr, executed.Status, executed.FailedNode, executed.Error)
+			}
+		})
+	}
+}
+
+func TestSubworkflow_TestCases(t *testing.T) {
+	t.Parallel()
+	store := newMemoryStore(t, storage.SeedFixtures())
+	svc, err := workflow.NewService(store, nodes.Deps{})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	base := "/api/v1/workflows/" + saveBriefing(t, store).String()
+
+	// The child's nodes are mocked and captured under the call node.
+	body := `{"cases":[{"name":"hot day","inputs":` + weatherInputsJSON + `,
+		"mocks":{"weather-check/weather-api":{"temperature":31.5}},
+		"expect":{"path":["start","weather-check","end"],"variables":{"temperature":31.5,"conditionMet":true},
+			"messages":[{"node":"weather-check/email","to":"alice@example.com"}]}}]}`
+	var report workflow.TestReport
+	if rec := doRequest(t, newTestRouter(svc), http.MethodPost, base+"/test", body, &report); rec.Code != http.StatusOK {
+		t.Fatalf("test: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if report.Passed != 1 {
+		t.Fatalf("expected the case to pass, got %+v", report.Cases)
+	}
+}
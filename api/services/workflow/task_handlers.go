@@ -0,0 +1,220 @@
+package workflow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/storage"
+)
+
+// taskAction is one of the ways a person can respond to a task.
+type taskAction struct {
+	kind    string // the task kind the action applies to
+	outcome string
+	status  string // the task status after the action
+}
+
+var (
+	actionApprove = taskAction{kind: "approval", outcome: nodes.OutcomeApproved, status: storage.TaskApproved}
+	actionReject  = taskAction{kind: "approval", outcome: nodes.OutcomeRejected, status: storage.TaskRejected}
+	actionSubmit  = taskAction{kind: "input", outcome: nodes.OutcomeSubmitted, status: storage.TaskSubmitted}
+)
+
+type tasksBody struct {
+	Tasks []storage.Task `json:"tasks"`
+}
+
+// taskActionBody is the optional body of an approve, reject or submit
+// request. By names who responds, and defaults to the authenticated
+// principal; Fields carries the task's fields.
+type taskActionBody struct {
+	By     string         `json:"by"`
+	Fields map[string]any `json:"fields"`
+}
+
+// taskActionResponse returns the completed task with the run it resumed.
+type taskActionResponse struct {
+	Task *storage.Task      `json:"task"`
+	Run  *ExecutionResponse `json:"run"`
+}
+
+// HandleListTasks lists tasks, pending ones by default. ?assignee= narrows
+// the list to one person and ?status= selects another status, or all.
+func (s *Service) HandleListTasks(w http.ResponseWriter, r *http.Request) {
+	rid := reqID(r)
+	q := r.URL.Query()
+	filter := storage.TaskFilter{Assignee: q.Get("assignee"), Status: storage.TaskPending}
+	switch status := q.Get("status"); status {
+	case "":
+	case "all":
+		filter.Status = ""
+	case storage.TaskPending, storage.TaskApproved, storage.TaskRejected, storage.TaskSubmitted, storage.TaskExpired:
+		filter.Status = status
+	default:
+		writeErrorJSON(w, "INVALID_STATUS", fmt.Sprintf("unknown task status %q", status), http.StatusBadRequest)
+		return
+	}
+
+	tasks, err := s.storage.ListTasks(r.Context(), filter)
+	if err != nil {
+		slog.Error("failed to list tasks", "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, tasksBody{Tasks: tasks}, uuid.Nil, rid)
+}
+
+// HandleGetTask returns a single task.
+func (s *Service) HandleGetTask(w http.ResponseWriter, r *http.Request) {
+	rid := reqID(r)
+	task, ok := s.loadTask(w, r, rid)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, task, task.WorkflowID, rid)
+}
+
+// HandleTaskAction returns the handler that completes a task with action
+// and resumes its run. The run's next steps execute before the response, so
+// it reports whether the run finished or is waiting on another task.
+func (s *Service) HandleTaskAction(action taskAction) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rid := reqID(r)
+		task, ok := s.loadTask(w, r, rid)
+		if !ok {
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+		var body taskActionBody
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			slog.Warn("failed to decode task action", "task", task.ID, "requestId", rid, "error", err)
+			writeErrorJSON(w, "INVALID_BODY", "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		// An authenticated caller responds as themselves; "by" may only
+		// repeat their subject.
+		if p := principal(r); p != "" {
+			if body.By != "" && body.By != p {
+				writeErrorJSON(w, "INVALID_BODY", "by must match the authenticated principal", http.StatusBadRequest)
+				return
+			}
+			body.By = p
+		}
+
+		if task.Kind != action.kind {
+			writeErrorJSON(w, "INVALID_ACTION", fmt.Sprintf("%s tasks cannot be %s", task.Kind, action.outcome), http.StatusBadRequest)
+			return
+		}
+		if task.Status != storage.TaskPending {
+			writeErrorJSON(w, "TASK_COMPLETED", fmt.Sprintf("task is already %s", task.Status), http.StatusConflict)
+			return
+		}
+		if task.ExpiresAt != nil && !s.now().Before(*task.ExpiresAt) {
+			writeErrorJSON(w, "TASK_EXPIRED", "task has expired", http.StatusConflict)
+			return
+		}
+		if task.Assignee != "" && body.By != task.Assignee {
+			writeErrorJSON(w, "NOT_ASSIGNEE", fmt.Sprintf("task is assigned to %s", task.Assignee), http.StatusForbidden)
+			return
+		}
+		if err := checkTaskFields(task, action, body.Fields); err != nil {
+			writeErrorJSON(w, err.code, err.message, http.StatusBadRequest)
+			return
+		}
+
+		response, err := json.Marshal(body.Fields)
+		if err != nil {
+			slog.Error("failed to encode task response", "task", task.ID, "requestId", rid, "error", err)
+			writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+			return
+		}
+		// CompleteTask only succeeds for one caller, so a task is never
+		// resolved twice even when two people respond at once. If the run
+		// cannot be resumed below, the scheduler retries it.
+		ctx := r.Context()
+		completed, err := s.completeTask(ctx, task.ID, action.status, response, body.By)
+		if err != nil {
+			if errors.Is(err, storage.ErrTaskNotPending) {
+				writeErrorJSON(w, "TASK_COMPLETED", "task was completed concurrently", http.StatusConflict)
+				return
+			}
+			slog.Error("failed to complete task", "task", task.ID, "requestId", rid, "error", err)
+			writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+			return
+		}
+		task = completed
+
+		result, err := s.resolveTask(ctx, task, nodes.Resolution{Outcome: action.outcome, Fields: body.Fields, By: body.By}, rid)
+		if err != nil {
+			slog.Error("failed to resume run, the scheduler will retry", "task", task.ID, "run", task.RunID, "requestId", rid, "error", err)
+			writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, taskActionResponse{Task: task, Run: result}, task.WorkflowID, rid)
+	}
+}
+
+type taskFieldError struct {
+	code    string
+	message string
+}
+
+// checkTaskFields accepts only the task's declared fields, all of which an
+// input submission must provide.
+func checkTaskFields(task *storage.Task, action taskAction, fields map[string]any) *taskFieldError {
+	declared := make(map[string]bool, len(task.Fields))
+	var missing []string
+	for _, f := range task.Fields {
+		declared[f] = true
+		if _, ok := fields[f]; !ok && action.kind == "input" {
+			missing = append(missing, f)
+		}
+	}
+	for _, f := range sortedKeys(fields) {
+		if !declared[f] {
+			return &taskFieldError{"INVALID_BODY", fmt.Sprintf("unknown field %q", f)}
+		}
+	}
+	if len(missing) > 0 {
+		return &taskFieldError{"MISSING_FIELDS", "missing fields: " + strings.Join(missing, ", ")}
+	}
+	return nil
+}
+
+// loadTask parses the task ID in the URL and loads the task, writing the
+// error response when it cannot.
+func (s *Service) loadTask(w http.ResponseWriter, r *http.Request, rid string) (*storage.Task, bool) {
+	raw := mux.Vars(r)["taskId"]
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		slog.Warn("invalid task id", "task", raw, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INVALID_ID", "invalid task id", http.StatusBadRequest)
+		return nil, false
+	}
+	task, err := s.storage.GetTask(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			slog.Warn("task not found", "task", id, "requestId", rid)
+			writeErrorJSON(w, "NOT_FOUND", "task not found", http.StatusNotFound)
+			return nil, false
+		}
+		slog.Error("failed to get task", "task", id, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	return task, true
+}
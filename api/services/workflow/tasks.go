@@ -0,0 +1,316 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/storage"
+)
+
+// waitFor records what a run waits on after result: the resume time of a
+// timer on run, or a new task, which the caller stores after the run. It
+// returns nil when there is no task.
+func (s *Service) waitFor(run *storage.Run, result *ExecutionResponse) *storage.Task {
+	run.ResumeAt = nil
+	w := result.WaitingFor
+	if result.suspended == nil || w == nil {
+		return nil
+	}
+	if w.Kind == nodes.SuspendTimer {
+		run.ResumeAt = w.ResumeAt
+		return nil
+	}
+	return s.newTask(run.WorkflowID, run.ID, w)
+}
+
+// newTask builds the task a suspended run waits on and fills in the task
+// ID and expiry on w so they are returned with the execution.
+func (s *Service) newTask(wfUUID, runID uuid.UUID, w *Waiting) *storage.Task {
+	id := uuid.New()
+	w.TaskID = &id
+	if w.timeout > 0 {
+		expires := s.now().Add(w.timeout).UTC()
+		w.ExpiresAt = &expires
+	}
+	return &storage.Task{
+		ID:         id,
+		WorkflowID: wfUUID,
+		RunID:      runID,
+		NodeID:     w.NodeID,
+		Kind:       w.Kind,
+		Assignee:   w.Assignee,
+		Title:      w.Title,
+		Fields:     w.Fields,
+		ExpiresAt:  w.ExpiresAt,
+	}
+}
+
+// completeTask completes a pending task, scheduling its run to be resumed
+// by ResumeDueRuns after timerRetry in case resolveTask does not finish.
+func (s *Service) completeTask(ctx context.Context, id uuid.UUID, status string, response json.RawMessage, by string) (*storage.Task, error) {
+	return s.storage.CompleteTask(ctx, id, status, response, by, s.now().Add(timerRetry))
+}
+
+// resolveTask resumes the run a completed task belongs to with res.
+func (s *Service) resolveTask(ctx context.Context, task *storage.Task, res nodes.Resolution, rid string) (*ExecutionResponse, error) {
+	run, err := s.storage.GetRun(ctx, task.WorkflowID, task.RunID)
+	if err != nil {
+		return nil, fmt.Errorf("get run %s: %w", task.RunID, err)
+	}
+	result, err := s.resumeRun(ctx, run, res, taskCall(task, res))
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("resumed run", "id", run.WorkflowID, "run", run.ID, "task", task.ID,
+		"outcome", res.Outcome, "status", result.Status, "requestId", rid)
+	return result, nil
+}
+
+// taskCall records a task's response as a call so a replay of the run takes
+// the same branch.
+func taskCall(task *storage.Task, res nodes.Resolution) *RecordedCall {
+	call := &RecordedCall{NodeID: task.NodeID, Client: clientTask}
+	call.Request, _ = json.Marshal(taskRequest{task.Kind, task.Assignee, task.Title})
+	call.Response, _ = json.Marshal(res)
+	return call
+}
+
+// taskResolution is what a completed task resumes its run with.
+func taskResolution(task *storage.Task) (nodes.Resolution, error) {
+	res := nodes.Resolution{By: task.RespondedBy}
+	switch task.Status {
+	case storage.TaskApproved:
+		res.Outcome = nodes.OutcomeApproved
+	case storage.TaskRejected:
+		res.Outcome = nodes.OutcomeRejected
+	case storage.TaskSubmitted:
+		res.Outcome = nodes.OutcomeSubmitted
+	case storage.TaskExpired:
+		res.Outcome = nodes.OutcomeTimeout
+	default:
+		return res, fmt.Errorf("task %s is %s", task.ID, task.Status)
+	}
+	if len(task.Response) > 0 {
+		if err := json.Unmarshal(task.Response, &res.Fields); err != nil {
+			return res, fmt.Errorf("decode response of task %s: %w", task.ID, err)
+		}
+	}
+	return res, nil
+}
+
+// resumeRun continues a suspended run with res and saves the outcome. The
+// run either finishes or suspends again at a later task or timer. call, if
+// set, is recorded before the calls made after resuming.
+func (s *Service) resumeRun(ctx context.Context, run *storage.Run, res nodes.Resolution, call *RecordedCall) (*ExecutionResponse, error) {
+	if run.State == nil {
+		return nil, fmt.Errorf("run %s is not waiting", run.ID)
+	}
+	var (
+		state runState
+		prev  ExecutionResponse
+		calls []RecordedCall
+	)
+	if err := json.Unmarshal(run.State, &state); err != nil {
+		return nil, fmt.Errorf("decode state of run %s: %w", run.ID, err)
+	}
+	if err := json.Unmarshal(run.Result, &prev); err != nil {
+		return nil, fmt.Errorf("decode result of run %s: %w", run.ID, err)
+	}
+	if err := json.Unmarshal(run.Calls, &calls); err != nil {
+		return nil, fmt.Errorf("decode calls of run %s: %w", run.ID, err)
+	}
+	sealed, err := s.openRun(run)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed.Variables) > 0 && state.Variables == nil {
+		state.Variables = make(map[string]any, len(sealed.Variables))
+	}
+	for k, v := range sealed.Variables {
+		state.Variables[k] = v
+	}
+
+	// Resuming is triggered by a person or the scheduler; it must run to its
+	// next stop even if that request goes away.
+	ctx = context.WithoutCancel(ctx)
+	start := time.Now()
+	result, err := resumeWorkflow(ctx, &state, prev.Steps, s.deps, res, s.loadWorkflow, s.lookupSecret)
+	if err != nil {
+		return nil, fmt.Errorf("resume run %s: %w", run.ID, err)
+	}
+	s.observeRun(run.WorkflowID, result, len(prev.Steps), time.Since(start))
+	result.ExecutedAt = prev.ExecutedAt
+	if call != nil {
+		calls = append(calls, *call)
+	}
+	result.calls = append(calls, result.calls...)
+
+	next := s.waitFor(run, result)
+	if err := encodeRunResult(run, result); err != nil {
+		return nil, err
+	}
+	if err := s.sealRun(run, sealed.Inputs, result.suspended); err != nil {
+		return nil, err
+	}
+	if err := s.storage.UpdateRun(ctx, run); err != nil {
+		return nil, fmt.Errorf("update run %s: %w", run.ID, err)
+	}
+	if next != nil {
+		if err := s.storage.CreateTask(ctx, next); err != nil {
+			return nil, fmt.Errorf("create task for run %s: %w", run.ID, err)
+		}
+	}
+	result.RunID = &run.ID
+	return result, nil
+}
+
+// ExpireTasks completes every pending task whose deadline has passed, in
+// every workspace, and resumes its run down the "timeout" branch. It
+// returns how many tasks were expired. Tasks completed concurrently by a
+// person are skipped, and tasks of workflows at a concurrency cap wait for
+// the next sweep.
+func (s *Service) ExpireTasks(ctx context.Context) int {
+	now := s.now()
+	tasks, err := s.storage.ListTasks(ctx, storage.TaskFilter{Status: storage.TaskPending, ExpiresBefore: &now, AllWorkspaces: true})
+	if err != nil {
+		slog.Error("failed to list expired tasks", "error", err)
+		return 0
+	}
+
+	expired := 0
+	for i := range tasks {
+		if s.expireTask(storage.WithWorkspace(ctx, tasks[i].WorkspaceID), &tasks[i]) {
+			expired++
+		}
+	}
+	return expired
+}
+
+// expireTask expires task and resumes its run, and reports whether the
+// task was expired. While the run's workflow or the deployment is at its
+// concurrency cap the task is left pending for the next sweep.
+func (s *Service) expireTask(ctx context.Context, task *storage.Task) bool {
+	release, ok := s.acquireResume(task.WorkflowID, task.RunID)
+	if !ok {
+		return false
+	}
+	defer release()
+
+	completed, err := s.completeTask(ctx, task.ID, storage.TaskExpired, nil, "")
+	if err != nil {
+		if !errors.Is(err, storage.ErrTaskNotPending) {
+			slog.Error("failed to expire task", "task", task.ID, "error", err)
+		}
+		return false
+	}
+	if _, err := s.resolveTask(ctx, completed, nodes.Resolution{Outcome: nodes.OutcomeTimeout}, ""); err != nil {
+		slog.Error("failed to resume expired task", "task", completed.ID, "run", completed.RunID, "error", err)
+	}
+	return true
+}
+
+// ResumeDueRuns resumes every run whose delay or wait_until timer is due,
+// or whose task was completed without the run being resumed, and returns
+// how many were resumed. Each run is claimed first, so several API
+// instances can sweep at once; a claimed run whose resume fails, is
+// interrupted or is refused by a concurrency cap is retried after
+// timerRetry.
+func (s *Service) ResumeDueRuns(ctx context.Context) int {
+	now := s.now()
+	resumed := 0
+	for {
+		runs, err := s.storage.ClaimDueRuns(ctx, now, now.Add(timerRetry), timerBatch)
+		if err != nil {
+			slog.Error("failed to claim due runs", "error", err)
+			return resumed
+		}
+		for i := range runs {
+			run := &runs[i]
+			release, ok := s.acquireResume(run.WorkflowID, run.ID)
+			if !ok {
+				continue
+			}
+			_, err := s.resumeDue(storage.WithWorkspace(ctx, run.WorkspaceID), run)
+			release()
+			if err != nil {
+				slog.Error("failed to resume due run", "id", run.WorkflowID, "run", run.ID, "error", err)
+				continue
+			}
+			resumed++
+		}
+		if len(runs) < timerBatch {
+			return resumed
+		}
+	}
+}
+
+// resumeDue resumes a claimed run. A run waiting on a task is due because
+// the task was completed but resuming the run with its response did not
+// finish, so it is resumed with that response; any other run's timer is due.
+func (s *Service) resumeDue(ctx context.Context, run *storage.Run) (*ExecutionResponse, error) {
+	var prev struct {
+		WaitingFor *Waiting `json:"waitingFor"`
+	}
+	if err := json.Unmarshal(run.Result, &prev); err != nil {
+		return nil, fmt.Errorf("decode result of run %s: %w", run.ID, err)
+	}
+	if prev.WaitingFor == nil || prev.WaitingFor.TaskID == nil {
+		return s.resumeRun(ctx, run, nodes.Resolution{Outcome: nodes.OutcomeElapsed}, nil)
+	}
+
+	task, err := s.storage.GetTask(ctx, *prev.WaitingFor.TaskID)
+	if err != nil {
+		return nil, fmt.Errorf("get task %s: %w", *prev.WaitingFor.TaskID, err)
+	}
+	res, err := taskResolution(task)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.resumeRun(ctx, run, res, taskCall(task, res))
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("resumed run after completed task", "id", run.WorkflowID, "run", run.ID, "task", task.ID,
+		"outcome", res.Outcome, "status", result.Status)
+	return result, nil
+}
+
+const (
+	// timerBatch is how many due runs ResumeDueRuns claims at a time.
+	timerBatch = 50
+	// timerRetry is how long a claimed run stays claimed before another
+	// sweep may pick it up again.
+	timerRetry = 5 * time.Minute
+)
+
+// RunScheduler expires overdue tasks, resumes runs whose timers are due and
+// deletes expired idempotency keys every interval until ctx is cancelled.
+// Deadlines and timers are stored with the tasks and runs, so both catch up
+// after a restart.
+func (s *Service) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n := s.ExpireTasks(ctx); n > 0 {
+			slog.Info("expired tasks", "count", n)
+		}
+		if n := s.ResumeDueRuns(ctx); n > 0 {
+			slog.Info("resumed runs after timers", "count", n)
+		}
+		if n := s.PurgeIdempotencyKeys(ctx); n > 0 {
+			slog.Info("deleted expired idempotency keys", "count", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package workflow_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/secrets"
+	"workflow-code-test/api/services/storage"
+	"workflow-code-test/api/services/workflow"
+)
+
+const approvalInputsJSON = `{"approver":"alice","city":"Sydney","name":"Alice"}`
+
+type taskList struct {
+	Tasks []storage.Task `json:"tasks"`
+}
+
+type taskActionResult struct {
+	Task storage.Task               `json:"task"`
+	Run  workflow.ExecutionResponse `json:"run"`
+}
+
+// newApprovalTestService stores a workflow that asks alice to approve and,
+// once approved, for a phone number:
+//
+//	start -> approve -approved-> ask -submitted-> end
+//	         approve -rejected/timeout-> end, ask -timeout-> end
+func newApprovalTestService(t *testing.T) (*workflow.Service, http.Handler, string) {
+	t.Helper()
+	return newApprovalTestServiceOn(t, newMemoryStore(t, storage.SeedFixtures()))
+}
+
+// newApprovalTestServiceOn is newApprovalTestService over store.
+func newApprovalTestServiceOn(t *testing.T, store storage.Storage) (*workflow.Service, http.Handler, string) {
+	t.Helper()
+	wf := &storage.Workflow{
+		ID:   uuid.New(),
+		Name: "Approval",
+		Nodes: []storage.Node{
+			{ID: "start", Type: "start"},
+			{ID: "approve", Type: "approval"},
+			{ID: "ask", Type: "input"},
+			{ID: "end", Type: "end"},
+		},
+		Edges: []storage.Edge{
+			{ID: "e1", Source: "start", Target: "approve"},
+			{ID: "e2", Source: "approve", Target: "ask", SourceHandle: strPtr("approved")},
+			{ID: "e3", Source: "approve", Target: "end", SourceHandle: strPtr("rejected")},
+			{ID: "e4", Source: "approve", Target: "end", SourceHandle: strPtr("timeout")},
+			{ID: "e5", Source: "ask", Target: "end", SourceHandle: strPtr("submitted")},
+			{ID: "e6", Source: "ask", Target: "end", SourceHandle: strPtr("timeout")},
+		},
+	}
+	if err := store.UpsertWorkflow(context.Background(), wf); err != nil {
+		t.Fatalf("UpsertWorkflow: %v", err)
+	}
+	svc, err := workflow.NewService(store, nodes.Deps{})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	return svc, newTestRouter(svc), "/api/v1/workflows/" + wf.ID.String()
+}
+
+func assertErrorCode(t *testing.T, body []byte, want string) {
+	t.Helper()
+	var resp map[string]any
+	if err := json.Unmarshal(body, &resp); err != nil || resp["code"] != want {
+		t.Errorf("expected code %s, got %s", want, body)
+	}
+}
+
+func startApprovalRun(t *testing.T, router http.Handler, base string) workflow.ExecutionResponse {
+	t.Helper()
+	var executed workflow.ExecutionResponse
+	if rec := doRequest(t, router, http.MethodPost, base+"/execute", `{"formData": `+approvalInputsJSON+`}`, &executed); rec.Code != http.StatusOK {
+		t.Fatalf("execute: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	w := executed.WaitingFor
+	if executed.Status != "waiting" || w == nil || w.TaskID == nil || w.NodeID != "approve" {
+		t.Fatalf("expected the run to wait at the approval, got %+v", executed)
+	}
+	return executed
+}
+
+func TestTasks_ApproveAndSubmit(t *testing.T) {
+	t.Parallel()
+	_, router, base := newApprovalTestService(t)
+	executed := startApprovalRun(t, router, base)
+	w := executed.WaitingFor
+	if w.Kind != "approval" || w.Assignee != "alice" || w.Title != "Approve alert for Sydney" || w.ExpiresAt == nil {
+		t.Errorf("unexpected task %+v", w)
+	}
+	if stepPath(executed.Steps) != "start,approve" || executed.Steps[1].Status != "waiting" {
+		t.Errorf("expected the approval step to be waiting, got %+v", executed.Steps)
+	}
+
+	var list taskList
+	if rec := doRequest(t, router, http.MethodGet, "/api/v1/tasks?assignee=alice", "", &list); rec.Code != http.StatusOK {
+		t.Fatalf("list: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(list.Tasks) != 1 || list.Tasks[0].ID != *w.TaskID || list.Tasks[0].RunID != *executed.RunID {
+		t.Fatalf("expected alice's pending task, got %+v", list.Tasks)
+	}
+	doRequest(t, router, http.MethodGet, "/api/v1/tasks?assignee=bob", "", &list)
+	if len(list.Tasks) != 0 {
+		t.Errorf("expected no tasks for bob, got %+v", list.Tasks)
+	}
+
+	var approved taskActionResult
+	if rec := doRequest(t, router, http.MethodPost, "/api/v1/tasks/"+w.TaskID.String()+"/approve",
+		`{"by":"alice","fields":{"comment":"go ahead"}}`, &approved); rec.Code != http.StatusOK {
+		t.Fatalf("approve: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if approved.Task.Status != storage.TaskApproved || approved.Task.RespondedBy != "alice" {
+		t.Errorf("unexpected task %+v", approved.Task)
+	}
+	run := approved.Run
+	if run.Status != "waiting" || run.WaitingFor == nil || run.WaitingFor.NodeID != "ask" || *run.RunID != *executed.RunID {
+		t.Fatalf("expected the run to wait for input, got %+v", run)
+	}
+	if run.Steps[1].Status != "completed" || run.Steps[1].Output["comment"] != "go ahead" {
+		t.Errorf("expected the approval step to be completed, got %+v", run.Steps[1])
+	}
+
+	var submitted taskActionResult
+	if rec := doRequest(t, router, http.MethodPost, "/api/v1/tasks/"+run.WaitingFor.TaskID.String()+"/submit",
+		`{"by":"alice","fields":{"phone":"+61400000000"}}`, &submitted); rec.Code != http.StatusOK {
+		t.Fatalf("submit: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if submitted.Run.Status != "completed" || stepPath(submitted.Run.Steps) != "start,approve,ask,end" {
+		t.Fatalf("expected the run to complete, got %+v", submitted.Run)
+	}
+
+	var record workflow.RunRecord
+	doRequest(t, router, http.MethodGet, base+"/runs/"+executed.RunID.String(), "", &record)
+	if record.Status != "completed" || len(record.Calls) != 2 || record.Calls[0].Client != "task" {
+		t.Errorf("expected the stored run to be completed with its task responses, got %+v", record)
+	}
+
+	// Replaying applies the recorded responses instead of waiting again.
+	var report workflow.ReplayReport
+	if rec := doRequest(t, router, http.MethodPost, base+"/runs/"+executed.RunID.String()+"/replay", "", &report); rec.Code != http.StatusOK {
+		t.Fatalf("replay: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if report.Diverged || report.Replay.Status != "completed" {
+		t.Errorf("expected the replay to match, got %+v", report.Divergences)
+	}
+}
+
+func TestTasks_SensitiveVariablesSealedInState(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	store := newMemoryStore(t, storage.SeedFixtures())
+	svc, router, base := newApprovalTestServiceOn(t, store)
+	box, err := secrets.NewBox(bytes.Repeat([]byte{1}, secrets.KeySize))
+	if err != nil {
+		t.Fatalf("NewBox: %v", err)
+	}
+	svc.SetSecretsBox(box)
+	wfID := uuid.MustParse(strings.TrimPrefix(base, "/api/v1/workflows/"))
+	wf, err := store.GetWorkflow(ctx, wfID)
+	if err != nil {
+		t.Fatalf("GetWorkflow: %v", err)
+	}
+	wf.Settings.SensitiveVariables = []string{"name"}
+	if err := store.UpsertWorkflow(ctx, wf); err != nil {
+		t.Fatalf("UpsertWorkflow: %v", err)
+	}
+
+	executed := startApprovalRun(t, router, base)
+	run, err := store.GetRun(ctx, wfID, *executed.RunID)
+	if err != nil {
+		t.Fatalf("GetRun: %v", err)
+	}
+	if bytes.Contains(run.State, []byte("Alice")) || !bytes.Contains(run.State, []byte("Sydney")) || run.Sealed == nil {
+		t.Errorf("expected only the sensitive name left out of the state and sealed, got state %s", run.State)
+	}
+
+	// The input task after the approval is titled with the restored name.
+	var approved taskActionResult
+	if rec := doRequest(t, router, http.MethodPost, "/api/v1/tasks/"+executed.WaitingFor.TaskID.String()+"/approve",
+		`{"by":"alice"}`, &approved); rec.Code != http.StatusOK {
+		t.Fatalf("approve: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if w := approved.Run.WaitingFor; w == nil || w.Title != "Provide a phone number for Alice" {
+		t.Errorf("expected the run to resume with the sealed name, got %+v", w)
+	}
+	if run, _ := store.GetRun(ctx, wfID, *executed.RunID); run == nil || bytes.Contains(run.State, []byte("Alice")) || run.Sealed == nil {
+		t.Errorf("expected the name sealed again while the run waits for input, got %+v", run)
+	}
+}
+
+func TestTasks_Reject(t *testing.T) {
+	t.Parallel()
+	_, router, base := newApprovalTestService(t)
+	executed := startApprovalRun(t, router, base)
+
+	var rejected taskActionResult
+	if rec := doRequest(t, router, http.MethodPost, "/api/v1/tasks/"+executed.WaitingFor.TaskID.String()+"/reject",
+		`{"by":"alice"}`, &rejected); rec.Code != http.StatusOK {
+		t.Fatalf("reject: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rejected.Run.Status != "completed" || stepPath(rejected.Run.Steps) != "start,approve,end" {
+		t.Errorf("expected the rejected branch, got %+v", rejected.Run)
+	}
+	if rejected.Run.Steps[1].Output["approved"] != false {
+		t.Errorf("expected approved=false, got %v", rejected.Run.Steps[1].Output)
+	}
+}
+
+func TestTasks_Expiry(t *testing.T) {
+	t.Parallel()
+	svc, router, base := newApprovalTestService(t)
+	executed := startApprovalRun(t, router, base)
+	taskURL := "/api/v1/tasks/" + executed.WaitingFor.TaskID.String()
+
+	if n := svc.ExpireTasks(context.Background()); n != 0 {
+		t.Fatalf("expected nothing to expire yet, got %d", n)
+	}
+
+	later := time.Now().Add(25 * time.Hour)
+	workflow.SetClock(svc, func() time.Time { return later })
+	if rec := doRequest(t, router, http.MethodPost, taskURL+"/approve", `{"by":"alice"}`, nil); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for an overdue task, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if n := svc.ExpireTasks(context.Background()); n != 1 {
+		t.Fatalf("expected one task to expire, got %d", n)
+	}
+
+	var task storage.Task
+	doRequest(t, router, http.MethodGet, taskURL, "", &task)
+	if task.Status != storage.TaskExpired {
+		t.Errorf("expected the task to be expired, got %s", task.Status)
+	}
+	var record workflow.RunRecord
+	doRequest(t, router, http.MethodGet, base+"/runs/"+executed.RunID.String(), "", &record)
+	if record.Status != "completed" || stepPath(record.Result.Steps) != "start,approve,end" || record.Result.Steps[1].Status != "timed_out" {
+		t.Errorf("expected the run to take the timeout branch, got %+v", record.Result)
+	}
+}
+
+func TestTasks_Errors(t *testing.T) {
+	t.Parallel()
+	_, router, base := newApprovalTestService(t)
+	executed := startApprovalRun(t, router, base)
+	taskURL := "/api/v1/tasks/" + executed.WaitingFor.TaskID.String()
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "invalid id", method: http.MethodGet, url: "/api/v1/tasks/nope", wantStatus: http.StatusBadRequest, wantCode: "INVALID_ID"},
+		{name: "unknown task", method: http.MethodGet, url: "/api/v1/tasks/" + uuid.NewString(), wantStatus: http.StatusNotFound, wantCode: "NOT_FOUND"},
+		{name: "invalid status", method: http.MethodGet, url: "/api/v1/tasks?status=done", wantStatus: http.StatusBadRequest, wantCode: "INVALID_STATUS"},
+		{name: "wrong action", method: http.MethodPost, url: taskURL + "/submit", body: `{"by":"alice"}`, wantStatus: http.StatusBadRequest, wantCode: "INVALID_ACTION"},
+		{name: "not the assignee", method: http.MethodPost, url: taskURL + "/approve", body: `{"by":"bob"}`, wantStatus: http.StatusForbidden, wantCode: "NOT_ASSIGNEE"},
+		{name: "unknown field", method: http.MethodPost, url: taskURL + "/approve", body: `{"by":"alice","fields":{"phone":"1"}}`, wantStatus: http.StatusBadRequest, wantCode: "INVALID_BODY"},
+		{name: "malformed body", method: http.MethodPost, url: taskURL + "/approve", body: `{"who":"alice"}`, wantStatus: http.StatusBadRequest, wantCode: "INVALID_BODY"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(t, router, tt.method, tt.url, tt.body, nil)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			assertErrorCode(t, rec.Body.Bytes(), tt.wantCode)
+		})
+	}
+
+	var approved taskActionResult
+	doRequest(t, router, http.MethodPost, taskURL+"/approve", `{"by":"alice"}`, &approved)
+	askURL := "/api/v1/tasks/" + approved.Run.WaitingFor.TaskID.String()
+
+	rec := doRequest(t, router, http.MethodPost, taskURL+"/reject", `{"by":"alice"}`, nil)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a completed task, got %d: %s", rec.Code, rec.Body.String())
+	}
+	assertErrorCode(t, rec.Body.Bytes(), "TASK_COMPLETED")
+
+	rec = doRequest(t, router, http.MethodPost, askURL+"/submit", `{"by":"alice"}`, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for missing fields, got %d: %s", rec.Code, rec.Body.String())
+	}
+	assertErrorCode(t, rec.Body.Bytes(), "MISSING_FIELDS")
+}
+
+// flakyRunUpdates fails the next fail calls to UpdateRun.
+type flakyRunUpdates struct {
+	storage.Storage
+	fail atomic.Int32
+}
+
+func (f *flakyRunUpdates) UpdateRun(ctx context.Context, run *storage.Run) error {
+	if f.fail.Add(-1) >= 0 {
+		return errors.New("connection reset")
+	}
+	return f.Storage.UpdateRun(ctx, run)
+}
+
+func TestTasks_ResumeRetriedAfterFailure(t *testing.T) {
+	t.Parallel()
+	store := &flakyRunUpdates{Storage: newMemoryStore(t, storage.SeedFixtures())}
+	svc, router, base := newApprovalTestServiceOn(t, store)
+	now := time.Now()
+	workflow.SetClock(svc, func() time.Time { return now })
+	executed := startApprovalRun(t, router, base)
+	approve := "/api/v1/tasks/" + executed.WaitingFor.TaskID.String() + "/approve"
+
+	store.fail.Store(1)
+	if rec := doRequest(t, router, http.MethodPost, approve, `{"by":"alice"}`, nil); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("approve: expected 500, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec := doRequest(t, router, http.MethodPost, approve, `{"by":"alice"}`, nil)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("approve again: expected 409, got %d: %s", rec.Code, rec.Body.String())
+	}
+	assertErrorCode(t, rec.Body.Bytes(), "TASK_COMPLETED")
+
+	// The run is left waiting at the approval until the scheduler retries
+	// it with the recorded response.
+	if n := svc.ResumeDueRuns(context.Background()); n != 0 {
+		t.Errorf("expected no retry before the retry time, resumed %d", n)
+	}
+	now = now.Add(6 * time.Minute)
+	if n := svc.ResumeDueRuns(context.Background()); n != 1 {
+		t.Fatalf("expected the run to be resumed, resumed %d", n)
+	}
+	var record workflow.RunRecord
+	doRequest(t, router, http.MethodGet, base+"/runs/"+executed.RunID.String(), "", &record)
+	w := record.Result.WaitingFor
+	if record.Status != "waiting" || w == nil || w.NodeID != "ask" || len(record.Calls) != 1 || record.Calls[0].Client != "task" {
+		t.Errorf("expected the run resumed down the approved branch, got %+v", record)
+	}
+	if n := svc.ResumeDueRuns(context.Background()); n != 0 {
+		t.Errorf("expected the resumed run not to be retried again, resumed %d", n)
+	}
+}
@@ -0,0 +1,318 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/storage"
+)
+
+// TestCase is a regression test for a workflow definition: the inputs to
+// execute with, canned responses for integration nodes, and what the run is
+// expected to do. Test cases never reach real integrations.
+type TestCase struct {
+	Name   string                  `json:"name"`
+	Inputs map[string]any          `json:"inputs,omitempty"`
+	Mocks  map[string]MockResponse `json:"mocks,omitempty"` // keyed by node ID
+	Expect TestExpectations        `json:"expect"`
+}
+
+// MockResponse is the canned result of the integration call made by one
+// node. Weather nodes read Temperature; flood nodes read Discharge and
+// RiskLevel (derived from Discharge when empty). Setting Error makes any
+// node's call fail, including email and SMS delivery.
+type MockResponse struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	Discharge   *float64 `json:"discharge,omitempty"`
+	RiskLevel   string   `json:"riskLevel,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// TestExpectations are the assertions checked after a test case runs.
+// Status defaults to "completed". Path must match the executed node IDs
+// exactly. Variables are checked by key; other variables are ignored.
+// Messages, when present (even as an empty list), must match every email
+// and SMS sent, in order.
+type TestExpectations struct {
+	Status    string             `json:"status,omitempty"`
+	Path      []string           `json:"path,omitempty"`
+	Variables map[string]any     `json:"variables,omitempty"`
+	Messages  *[]ExpectedMessage `json:"messages,omitempty"`
+}
+
+// ExpectedMessage matches one sent message. Empty fields are not checked.
+type ExpectedMessage struct {
+	Node         string `json:"node,omitempty"`
+	Channel      string `json:"channel,omitempty"` // "email" or "sms"
+	To           string `json:"to,omitempty"`
+	Subject      string `json:"subject,omitempty"`
+	BodyContains string `json:"bodyContains,omitempty"`
+}
+
+// SentMessage is an email or SMS captured by the fake clients.
+type SentMessage struct {
+	Node    string `json:"node"`
+	Channel string `json:"channel"`
+	To      string `json:"to"`
+	Subject string `json:"subject,omitempty"`
+	Body    string `json:"body"`
+}
+
+// TestCaseResult reports the outcome of one test case.
+type TestCaseResult struct {
+	Name       string         `json:"name"`
+	Passed     bool           `json:"passed"`
+	Failures   []string       `json:"failures,omitempty"`
+	Status     string         `json:"status"`
+	Error      string         `json:"error,omitempty"`
+	Path       []string       `json:"path"`
+	Variables  map[string]any `json:"variables"`
+	Messages   []SentMessage  `json:"messages"`
+	DurationMs int64          `json:"durationMs"`
+}
+
+// TestReport is the response of the test endpoint and of "wfctl test".
+// Version is the snapshot the cases ran against; 0 means the draft.
+type TestReport struct {
+	WorkflowID uuid.UUID        `json:"workflowId"`
+	Version    int              `json:"version,omitempty"`
+	Passed     int              `json:"passed"`
+	Failed     int              `json:"failed"`
+	Cases      []TestCaseResult `json:"cases"`
+}
+
+// validStatuses are the execution statuses a test case may expect.
+var validStatuses = map[string]bool{"completed": true, "failed": true, "cancelled": true}
+
+// ValidateTestCases checks that cases are well formed before they are saved
+// or run. Whether mocked nodes exist is checked at run time, since the same
+// cases may run against different snapshots.
+func ValidateTestCases(cases []TestCase) error {
+	seen := make(map[string]bool, len(cases))
+	for i, tc := range cases {
+		name := strings.TrimSpace(tc.Name)
+		if name == "" {
+			return fmt.Errorf("case [%d]: name is required", i)
+		}
+		if seen[name] {
+			return fmt.Errorf("case %q: duplicate name", name)
+		}
+		seen[name] = true
+
+		if s := tc.Expect.Status; s != "" && !validStatuses[s] {
+			return fmt.Errorf("case %q: expect.status must be completed, failed or cancelled", name)
+		}
+		if tc.Expect.Messages != nil {
+			for j, m := range *tc.Expect.Messages {
+				if m.Channel != "" && m.Channel != "email" && m.Channel != "sms" {
+					return fmt.Errorf("case %q: expect.messages[%d].channel must be email or sms", name, j)
+				}
+			}
+		}
+		for _, nodeID := range sortedKeys(tc.Mocks) {
+			if err := validateMock(nodeID, tc.Mocks[nodeID]); err != nil {
+				return fmt.Errorf("case %q: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateMocks checks recorded responses passed to a dry run: each must
+// be well formed and belong to a node of wf, or to a node of a workflow
+// one of its subworkflow nodes calls ("<subworkflow node>/<child node>").
+func ValidateMocks(wf *storage.Workflow, mocks map[string]MockResponse) error {
+	nodeIDs := make(map[string]bool, len(wf.Nodes))
+	callers := make(map[string]bool)
+	for _, n := range wf.Nodes {
+		nodeIDs[n.ID] = true
+		callers[n.ID] = n.Type == "subworkflow"
+	}
+	for _, nodeID := range sortedKeys(mocks) {
+		caller, _, nested := strings.Cut(nodeID, "/")
+		if !nodeIDs[nodeID] && !(nested && callers[caller]) {
+			return fmt.Errorf("mock for unknown node %q", nodeID)
+		}
+		if err := validateMock(nodeID, mocks[nodeID]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateMock(nodeID string, m MockResponse) error {
+	if m.Discharge == nil && m.RiskLevel != "" {
+		return fmt.Errorf("mock for node %q sets riskLevel without discharge", nodeID)
+	}
+	return nil
+}
+
+// RunTestCases executes every case against wf with fake integration clients
+// and checks its expectations. Subworkflow nodes call the workflows load
+// returns, with the same fakes; their nodes are mocked as "<node>/<child>".
+// A workflow that fails construction or graph validation fails every case
+// with that error rather than returning it, so callers always get a
+// per-case report.
+func RunTestCases(ctx context.Context, wf *storage.Workflow, cases []TestCase, load WorkflowLoader) *TestReport {
+	report := &TestReport{WorkflowID: wf.ID, Cases: make([]TestCaseResult, 0, len(cases))}
+	for _, tc := range cases {
+		res := runTestCase(ctx, wf, load, tc)
+		if res.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+		report.Cases = append(report.Cases, res)
+	}
+	return report
+}
+
+func runTestCase(ctx context.Context, wf *storage.Workflow, load WorkflowLoader, tc TestCase) TestCaseResult {
+	start := time.Now()
+	res := TestCaseResult{
+		Name:      tc.Name,
+		Path:      []string{},
+		Variables: map[string]any{},
+		Messages:  []SentMessage{},
+	}
+
+	if err := ValidateMocks(wf, tc.Mocks); err != nil {
+		res.Failures = append(res.Failures, err.Error())
+	}
+
+	fakes := newFakeIntegrations(tc.Mocks)
+	// Test cases never read secrets; references run as "[secret:NAME]",
+	// and expanding them without a lookup cannot fail.
+	sec := newRunSecrets(nil)
+	expanded, _ := sec.expand(ctx, wf)
+	g, err := compileWorkflow(expanded, fakes.depsFor)
+	if err != nil {
+		res.Status = "invalid"
+		res.Error = err.Error()
+		res.Failures = append(res.Failures, "workflow is invalid: "+err.Error())
+		res.DurationMs = time.Since(start).Milliseconds()
+		return res
+	}
+	g.resolve = elapseTimers
+	g.load = sec.wrapLoad(load)
+
+	nCtx := &nodes.NodeContext{Variables: make(map[string]any)}
+	for k, v := range tc.Inputs {
+		nCtx.Variables[k] = v
+	}
+	exec := g.run(ctx, nCtx, false)
+
+	res.Status = exec.Status
+	res.Error = exec.Error
+	for _, step := range exec.Steps {
+		res.Path = append(res.Path, step.NodeID)
+	}
+	res.Variables = nCtx.Variables
+	res.Messages = fakes.messages()
+	res.Failures = append(res.Failures, checkExpectations(tc.Expect, res)...)
+	res.Passed = len(res.Failures) == 0
+	res.DurationMs = time.Since(start).Milliseconds()
+	return res
+}
+
+// checkExpectations returns one failure message per unmet assertion.
+func checkExpectations(want TestExpectations, got TestCaseResult) []string {
+	var failures []string
+
+	wantStatus := want.Status
+	if wantStatus == "" {
+		wantStatus = "completed"
+	}
+	if got.Status != wantStatus {
+		msg := fmt.Sprintf("expected status %q, got %q", wantStatus, got.Status)
+		if got.Error != "" {
+			msg += ": " + got.Error
+		}
+		failures = append(failures, msg)
+	}
+
+	if want.Path != nil && !reflect.DeepEqual(want.Path, got.Path) {
+		failures = append(failures, fmt.Sprintf("expected path %s, got %s",
+			strings.Join(want.Path, " → "), strings.Join(got.Path, " → ")))
+	}
+
+	vars := &nodes.NodeContext{Variables: got.Variables}
+	for _, key := range sortedKeys(want.Variables) {
+		actual, ok := vars.Lookup(key)
+		if !ok {
+			failures = append(failures, fmt.Sprintf("expected variable %q, but it was not set", key))
+			continue
+		}
+		if !jsonEqualValues(want.Variables[key], actual) {
+			failures = append(failures, fmt.Sprintf("expected variable %q to be %s, got %s",
+				key, jsonString(want.Variables[key]), jsonString(actual)))
+		}
+	}
+
+	if want.Messages != nil {
+		expected := *want.Messages
+		if len(expected) != len(got.Messages) {
+			failures = append(failures, fmt.Sprintf("expected %d messages sent, got %d", len(expected), len(got.Messages)))
+		}
+		for i := 0; i < len(expected) && i < len(got.Messages); i++ {
+			if problem := matchMessage(expected[i], got.Messages[i]); problem != "" {
+				failures = append(failures, fmt.Sprintf("message [%d]: %s", i, problem))
+			}
+		}
+	}
+	return failures
+}
+
+func matchMessage(want ExpectedMessage, got SentMessage) string {
+	switch {
+	case want.Node != "" && want.Node != got.Node:
+		return fmt.Sprintf("expected node %q, got %q", want.Node, got.Node)
+	case want.Channel != "" && want.Channel != got.Channel:
+		return fmt.Sprintf("expected channel %q, got %q", want.Channel, got.Channel)
+	case want.To != "" && want.To != got.To:
+		return fmt.Sprintf("expected recipient %q, got %q", want.To, got.To)
+	case want.Subject != "" && want.Subject != got.Subject:
+		return fmt.Sprintf("expected subject %q, got %q", want.Subject, got.Subject)
+	case want.BodyContains != "" && !strings.Contains(got.Body, want.BodyContains):
+		return fmt.Sprintf("expected body to contain %q, got %q", want.BodyContains, got.Body)
+	}
+	return ""
+}
+
+// jsonEqualValues compares values by their JSON form, so 25 (int) written by
+// a node equals 25 (float64) decoded from a test case.
+func jsonEqualValues(a, b any) bool {
+	var na, nb any
+	if err := json.Unmarshal([]byte(jsonString(a)), &na); err != nil {
+		return false
+	}
+	if err := json.Unmarshal([]byte(jsonString(b)), &nb); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(na, nb)
+}
+
+func jsonString(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
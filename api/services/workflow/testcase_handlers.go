@@ -0,0 +1,229 @@
+package workflow
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+
+	"workflow-code-test/api/services/storage"
+)
+
+// testCasesBody is the request and response body of the test case endpoints.
+type testCasesBody struct {
+	Cases []TestCase `json:"cases"`
+}
+
+// HandleListTestCases returns the test cases attached to a workflow.
+func (s *Service) HandleListTestCases(w http.ResponseWriter, r *http.Request) {
+	rid := reqID(r)
+	id := mux.Vars(r)["id"]
+	slog.Debug("listing workflow test cases", "id", id, "requestId", rid)
+
+	wfUUID, err := uuid.Parse(id)
+	if err != nil {
+		slog.Warn("invalid workflow id", "id", id, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INVALID_ID", "invalid workflow id", http.StatusBadRequest)
+		return
+	}
+
+	cases, err := s.loadTestCases(r, wfUUID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			slog.Warn("workflow not found for test cases", "id", wfUUID, "requestId", rid)
+			writeErrorJSON(w, "NOT_FOUND", "workflow not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to load test cases", "id", wfUUID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, testCasesBody{Cases: cases}, wfUUID, rid)
+}
+
+// HandleReplaceTestCases replaces every test case attached to a workflow
+// with the cases in the request body.
+func (s *Service) HandleReplaceTestCases(w http.ResponseWriter, r *http.Request) {
+	rid := reqID(r)
+	id := mux.Vars(r)["id"]
+	slog.Debug("replacing workflow test cases", "id", id, "requestId", rid)
+
+	wfUUID, err := uuid.Parse(id)
+	if err != nil {
+		slog.Warn("invalid workflow id", "id", id, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INVALID_ID", "invalid workflow id", http.StatusBadRequest)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+	var body testCasesBody
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil {
+		slog.Warn("failed to decode test cases", "id", wfUUID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INVALID_BODY", "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := ValidateTestCases(body.Cases); err != nil {
+		writeErrorJSON(w, "INVALID_TEST_CASES", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows := make([]storage.TestCase, 0, len(body.Cases))
+	for _, tc := range body.Cases {
+		def, err := json.Marshal(tc)
+		if err != nil {
+			slog.Error("failed to marshal test case", "id", wfUUID, "requestId", rid, "error", err)
+			writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+			return
+		}
+		rows = append(rows, storage.TestCase{Name: tc.Name, Definition: def})
+	}
+
+	if err := s.storage.ReplaceTestCases(r.Context(), wfUUID, rows); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			slog.Warn("workflow not found for test cases", "id", wfUUID, "requestId", rid)
+			writeErrorJSON(w, "NOT_FOUND", "workflow not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to save test cases", "id", wfUUID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("saved workflow test cases", "id", wfUUID, "principal", principal(r), "requestId", rid, "cases", len(body.Cases))
+	if body.Cases == nil {
+		body.Cases = []TestCase{}
+	}
+	writeJSON(w, http.StatusOK, body, wfUUID, rid)
+}
+
+// HandleRunTestCases runs test cases against the workflow's draft, or a
+// published snapshot when the "version" query parameter is set. The cases
+// come from the request body when one is sent ({"cases": [...]}), otherwise
+// the stored cases are used. Failing cases are reported with 200; the
+// response's "failed" count tells callers whether the run passed.
+func (s *Service) HandleRunTestCases(w http.ResponseWriter, r *http.Request) {
+	rid := reqID(r)
+	id := mux.Vars(r)["id"]
+	slog.Debug("running workflow test cases", "id", id, "requestId", rid)
+
+	wfUUID, err := uuid.Parse(id)
+	if err != nil {
+		slog.Warn("invalid workflow id", "id", id, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INVALID_ID", "invalid workflow id", http.StatusBadRequest)
+		return
+	}
+
+	version := 0
+	if v := r.URL.Query().Get("version"); v != "" {
+		if version, err = strconv.Atoi(v); err != nil || version < 1 {
+			writeErrorJSON(w, "INVALID_VERSION", "version must be a positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		slog.Warn("failed to read request body", "id", wfUUID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INVALID_BODY", "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var cases []TestCase
+	inline := len(bytes.TrimSpace(data)) > 0
+	if inline {
+		var body testCasesBody
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&body); err != nil {
+			slog.Warn("failed to decode test cases", "id", wfUUID, "requestId", rid, "error", err)
+			writeErrorJSON(w, "INVALID_BODY", "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := ValidateTestCases(body.Cases); err != nil {
+			writeErrorJSON(w, "INVALID_TEST_CASES", err.Error(), http.StatusBadRequest)
+			return
+		}
+		cases = body.Cases
+	}
+
+	ctx := r.Context()
+	wf, err := s.storage.GetWorkflow(ctx, wfUUID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			slog.Warn("workflow not found for test run", "id", wfUUID, "requestId", rid)
+			writeErrorJSON(w, "NOT_FOUND", "workflow not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to get workflow", "id", wfUUID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if version > 0 {
+		snap, err := s.storage.GetSnapshot(ctx, wfUUID, version)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				slog.Warn("snapshot not found for test run", "id", wfUUID, "version", version, "requestId", rid)
+				writeErrorJSON(w, "NOT_FOUND", "snapshot version not found", http.StatusNotFound)
+				return
+			}
+			slog.Error("failed to get snapshot", "id", wfUUID, "version", version, "requestId", rid, "error", err)
+			writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+			return
+		}
+		wf = &storage.Workflow{
+			ID:       wfUUID,
+			Name:     wf.Name,
+			Nodes:    snap.DagData.Nodes,
+			Edges:    snap.DagData.Edges,
+			Settings: snap.DagData.Settings,
+		}
+	}
+
+	if !inline {
+		if cases, err = s.loadTestCases(r, wfUUID); err != nil {
+			slog.Error("failed to load test cases", "id", wfUUID, "requestId", rid, "error", err)
+			writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	report := RunTestCases(ctx, wf, cases, s.loadWorkflow)
+	report.Version = version
+
+	slog.Info("ran workflow test cases",
+		"id", wfUUID, "requestId", rid, "version", version,
+		"passed", report.Passed, "failed", report.Failed)
+	writeJSON(w, http.StatusOK, report, wfUUID, rid)
+}
+
+// loadTestCases reads the stored test cases of a workflow. The row name is
+// authoritative over the name inside the stored definition.
+func (s *Service) loadTestCases(r *http.Request, wfUUID uuid.UUID) ([]TestCase, error) {
+	rows, err := s.storage.ListTestCases(r.Context(), wfUUID)
+	if err != nil {
+		return nil, err
+	}
+	cases := make([]TestCase, 0, len(rows))
+	for _, row := range rows {
+		var tc TestCase
+		if err := json.Unmarshal(row.Definition, &tc); err != nil {
+			return nil, fmt.Errorf("decode test case %q: %w", row.Name, err)
+		}
+		tc.Name = row.Name
+		cases = append(cases, tc)
+	}
+	return cases, nil
+}
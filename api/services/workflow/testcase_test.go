@@ -0,0 +1,287 @@
+package workflow_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/services/storage"
+	"workflow-code-test/api/services/workflow"
+)
+
+func seededWeatherWorkflow(t *testing.T) *storage.Workflow {
+	t.Helper()
+	wf, err := newMemoryStore(t, storage.SeedFixtures()).GetWorkflow(context.Background(), storage.SeedWeatherWorkflowID)
+	if err != nil {
+		t.Fatalf("GetWorkflow: %v", err)
+	}
+	return wf
+}
+
+func decodeTestCases(t *testing.T, src string) []workflow.TestCase {
+	t.Helper()
+	var body struct {
+		Cases []workflow.TestCase `json:"cases"`
+	}
+	if err := json.Unmarshal([]byte(src), &body); err != nil {
+		t.Fatalf("decode test cases: %v", err)
+	}
+	return body.Cases
+}
+
+const weatherInputsJSON = `{"name":"Alice","email":"alice@example.com","city":"Sydney","operator":"greater_than","threshold":25}`
+
+func TestRunTestCases(t *testing.T) {
+	t.Parallel()
+	wf := seededWeatherWorkflow(t)
+
+	tests := []struct {
+		name         string
+		testCase     string
+		wantPassed   bool
+		wantFailures []string
+	}{
+		{
+			name: "hot day sends the alert",
+			testCase: `{
+				"name": "hot day",
+				"inputs": ` + weatherInputsJSON + `,
+				"mocks": {"weather-api": {"temperature": 31.5}},
+				"expect": {
+					"path": ["start", "form", "weather-api", "condition", "email", "end"],
+					"variables": {"temperature": 31.5, "conditionMet": true, "emailSent": true},
+					"messages": [{"node": "email", "channel": "email", "to": "alice@example.com", "subject": "Weather Alert", "bodyContains": "31.5°C"}]
+				}
+			}`,
+			wantPassed: true,
+		},
+		{
+			name: "cool day sends nothing",
+			testCase: `{
+				"name": "cool day",
+				"inputs": ` + weatherInputsJSON + `,
+				"mocks": {"weather-api": {"temperature": 12}},
+				"expect": {"path": ["start", "form", "weather-api", "condition", "end"], "messages": []}
+			}`,
+			wantPassed: true,
+		},
+		{
+			name: "integration error is an expected failure",
+			testCase: `{
+				"name": "weather down",
+				"inputs": ` + weatherInputsJSON + `,
+				"mocks": {"weather-api": {"error": "503 from upstream"}},
+				"expect": {"status": "failed", "path": ["start", "form", "weather-api"]}
+			}`,
+			wantPassed: true,
+		},
+		{
+			name: "unmet assertions are all reported",
+			testCase: `{
+				"name": "wrong expectations",
+				"inputs": ` + weatherInputsJSON + `,
+				"mocks": {"weather-api": {"temperature": 12}},
+				"expect": {
+					"path": ["start", "form", "weather-api", "condition", "email", "end"],
+					"variables": {"temperature": 31.5, "missing": 1},
+					"messages": [{"channel": "email"}]
+				}
+			}`,
+			wantFailures: []string{
+				"expected path start → form → weather-api → condition → email → end, got start → form → weather-api → condition → end",
+				`expected variable "missing", but it was not set`,
+				`expected variable "temperature" to be 31.5, got 12`,
+				"expected 1 messages sent, got 0",
+			},
+		},
+		{
+			name: "missing mock fails the run",
+			testCase: `{
+				"name": "no mock",
+				"inputs": ` + weatherInputsJSON + `,
+				"expect": {}
+			}`,
+			wantFailures: []string{`expected status "completed", got "failed": node "weather-api" failed: weather lookup failed: no mock response for node "weather-api"`},
+		},
+		{
+			name: "mock for an unknown node is reported",
+			testCase: `{
+				"name": "stale mock",
+				"inputs": ` + weatherInputsJSON + `,
+				"mocks": {"weather-api": {"temperature": 12}, "old-node": {"temperature": 1}},
+				"expect": {}
+			}`,
+			wantFailures: []string{`mock for unknown node "old-node"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var tc workflow.TestCase
+			if err := json.Unmarshal([]byte(tt.testCase), &tc); err != nil {
+				t.Fatalf("decode test case: %v", err)
+			}
+			report := workflow.RunTestCases(context.Background(), wf, []workflow.TestCase{tc}, nil)
+			if len(report.Cases) != 1 {
+				t.Fatalf("expected 1 result, got %d", len(report.Cases))
+			}
+			res := report.Cases[0]
+			if res.Passed != tt.wantPassed {
+				t.Fatalf("expected passed=%v, got %v: %v", tt.wantPassed, res.Passed, res.Failures)
+			}
+			if !tt.wantPassed && strings.Join(res.Failures, "\n") != strings.Join(tt.wantFailures, "\n") {
+				t.Errorf("expected failures:\n%s\ngot:\n%s", strings.Join(tt.wantFailures, "\n"), strings.Join(res.Failures, "\n"))
+			}
+		})
+	}
+}
+
+func TestRunTestCases_InvalidWorkflow(t *testing.T) {
+	t.Parallel()
+
+	wf := seededWeatherWorkflow(t)
+	wf.Edges = append(wf.Edges, storage.Edge{ID: "loop", Source: "end", Target: "start"})
+	cases := decodeTestCases(t, `{"cases":[{"name":"a","expect":{}},{"name":"b","expect":{}}]}`)
+
+	report := workflow.RunTestCases(context.Background(), wf, cases, nil)
+	if report.Passed != 0 || report.Failed != 2 {
+		t.Fatalf("expected every case to fail, got %d passed %d failed", report.Passed, report.Failed)
+	}
+	if got := report.Cases[0].Failures[0]; !strings.Contains(got, "workflow is invalid") {
+		t.Errorf("expected invalid workflow failure, got %q", got)
+	}
+}
+
+func TestValidateTestCases(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		cases   string
+		wantErr string
+	}{
+		{name: "valid", cases: `{"cases":[{"name":"a","expect":{"status":"failed","messages":[{"channel":"sms"}]}}]}`},
+		{name: "missing name", cases: `{"cases":[{"name":" "}]}`, wantErr: "name is required"},
+		{name: "duplicate name", cases: `{"cases":[{"name":"a"},{"name":"a"}]}`, wantErr: "duplicate name"},
+		{name: "unknown status", cases: `{"cases":[{"name":"a","expect":{"status":"done"}}]}`, wantErr: "expect.status"},
+		{name: "unknown channel", cases: `{"cases":[{"name":"a","expect":{"messages":[{"channel":"fax"}]}}]}`, wantErr: "channel must be email or sms"},
+		{name: "risk level without discharge", cases: `{"cases":[{"name":"a","mocks":{"flood-api":{"riskLevel":"high"}}}]}`, wantErr: "without discharge"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			err := workflow.ValidateTestCases(decodeTestCases(t, tt.cases))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestTestCaseEndpoints(t *testing.T) {
+	t.Parallel()
+
+	store := newMemoryStore(t, storage.SeedFixtures())
+	router := newBundleTestService(t, store)
+	base := "/api/v1/workflows/" + storage.SeedWeatherWorkflowID.String()
+
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, url, strings.NewReader(body)))
+		return rec
+	}
+
+	cases := `{"cases":[
+		{"name":"hot day","inputs":` + weatherInputsJSON + `,"mocks":{"weather-api":{"temperature":31.5}},
+		 "expect":{"path":["start","form","weather-api","condition","email","end"]}},
+		{"name":"cool day","inputs":` + weatherInputsJSON + `,"mocks":{"weather-api":{"temperature":12}},
+		 "expect":{"messages":[]}}
+	]}`
+	if rec := do(http.MethodPut, base+"/tests", cases); rec.Code != http.StatusOK {
+		t.Fatalf("PUT tests: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec := do(http.MethodGet, base+"/tests", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET tests: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	listed := decodeTestCases(t, rec.Body.String())
+	if len(listed) != 2 || listed[0].Name != "hot day" || listed[1].Expect.Messages == nil {
+		t.Fatalf("expected stored cases to round-trip, got %s", rec.Body.String())
+	}
+
+	runReport := func(url, body string) workflow.TestReport {
+		t.Helper()
+		rec := do(http.MethodPost, url, body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("POST %s: expected 200, got %d: %s", url, rec.Code, rec.Body.String())
+		}
+		var report workflow.TestReport
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatalf("decode report: %v", err)
+		}
+		return report
+	}
+
+	// Stored cases against the draft.
+	if report := runReport(base+"/test", ""); report.Passed != 2 || report.Failed != 0 {
+		t.Errorf("expected 2 passing cases, got %+v", report)
+	}
+
+	// Inline cases override the stored ones.
+	report := runReport(base+"/test", `{"cases":[{"name":"wrong","inputs":`+weatherInputsJSON+`,"mocks":{"weather-api":{"temperature":12}},"expect":{"variables":{"conditionMet":true}}}]}`)
+	if report.Passed != 0 || report.Failed != 1 || report.Cases[0].Name != "wrong" {
+		t.Errorf("expected the inline case to fail, got %+v", report)
+	}
+
+	// Against a published snapshot.
+	if rec := do(http.MethodPost, base+"/publish", ""); rec.Code != http.StatusOK {
+		t.Fatalf("publish: %d %s", rec.Code, rec.Body.String())
+	}
+	if report := runReport(base+"/test?version=1", ""); report.Version != 1 || report.Passed != 2 {
+		t.Errorf("expected 2 passing cases on version 1, got %+v", report)
+	}
+
+	errorTests := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"invalid id", http.MethodGet, "/api/v1/workflows/nope/tests", "", http.StatusBadRequest, "INVALID_ID"},
+		{"unknown workflow", http.MethodGet, "/api/v1/workflows/" + uuid.NewString() + "/tests", "", http.StatusNotFound, "NOT_FOUND"},
+		{"unknown workflow on save", http.MethodPut, "/api/v1/workflows/" + uuid.NewString() + "/tests", `{"cases":[]}`, http.StatusNotFound, "NOT_FOUND"},
+		{"unknown field", http.MethodPut, base + "/tests", `{"cases":[{"name":"a","expcet":{}}]}`, http.StatusBadRequest, "INVALID_BODY"},
+		{"invalid case", http.MethodPut, base + "/tests", `{"cases":[{"name":""}]}`, http.StatusBadRequest, "INVALID_TEST_CASES"},
+		{"invalid version", http.MethodPost, base + "/test?version=x", "", http.StatusBadRequest, "INVALID_VERSION"},
+		{"unknown version", http.MethodPost, base + "/test?version=9", "", http.StatusNotFound, "NOT_FOUND"},
+		{"invalid inline case", http.MethodPost, base + "/test", `{"cases":[{"name":"a","expect":{"status":"nope"}}]}`, http.StatusBadRequest, "INVALID_TEST_CASES"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := do(tt.method, tt.url, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			var body map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["code"] != tt.wantCode {
+				t.Errorf("expected code %s, got %s", tt.wantCode, rec.Body.String())
+			}
+		})
+	}
+}
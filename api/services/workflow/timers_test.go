@@ -0,0 +1,107 @@
+package workflow_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"workflow-code-test/api/pkg/clients/weather"
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/storage"
+	"workflow-code-test/api/services/workflow"
+)
+
+// newPacedLoopService returns the Weather Monitor Loop with a 15 minute
+// delay on its back-edge, so each re-check waits instead of spinning:
+//
+//	... condition -true-> email -> pause -> weather-api
+func newPacedLoopService(t *testing.T, sent *countingEmail) (*workflow.Service, http.Handler, string) {
+	t.Helper()
+	store := newMemoryStore(t, storage.SeedFixtures())
+	wf, err := store.GetWorkflow(context.Background(), storage.SeedLoopWorkflowID)
+	if err != nil {
+		t.Fatalf("GetWorkflow: %v", err)
+	}
+	wf.Nodes = append(wf.Nodes, storage.Node{ID: "pause", Type: "delay"})
+	for i, e := range wf.Edges {
+		if e.Source == "email" && e.Target == "weather-api" {
+			wf.Edges[i].Target = "pause"
+		}
+	}
+	wf.Edges = append(wf.Edges, storage.Edge{ID: "e7", Source: "pause", Target: "weather-api"})
+	if err := store.UpsertWorkflow(context.Background(), wf); err != nil {
+		t.Fatalf("UpsertWorkflow: %v", err)
+	}
+
+	svc, err := workflow.NewService(store, nodes.Deps{Weather: weather.NewStubClient(31.5), Email: sent})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	return svc, newTestRouter(svc), "/api/v1/workflows/" + storage.SeedLoopWorkflowID.String()
+}
+
+func TestTimers_DelayPacesLoop(t *testing.T) {
+	t.Parallel()
+	sent := &countingEmail{}
+	svc, router, base := newPacedLoopService(t, sent)
+
+	var executed workflow.ExecutionResponse
+	if rec := doRequest(t, router, http.MethodPost, base+"/execute", `{"formData": `+weatherInputsJSON+`}`, &executed); rec.Code != http.StatusOK {
+		t.Fatalf("execute: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	w := executed.WaitingFor
+	if executed.Status != "waiting" || w == nil || w.Kind != nodes.SuspendTimer || w.NodeID != "pause" || w.ResumeAt == nil || w.TaskID != nil {
+		t.Fatalf("expected the run to wait on the delay, got %+v", executed)
+	}
+	if got := stepPath(executed.Steps); got != "start,form,weather-api,condition,email,pause" {
+		t.Errorf("unexpected path %s", got)
+	}
+	if sent.sent.Load() != 1 {
+		t.Errorf("expected one email before the delay, got %d", sent.sent.Load())
+	}
+
+	if n := svc.ResumeDueRuns(context.Background()); n != 0 {
+		t.Fatalf("expected no run to be due yet, got %d", n)
+	}
+
+	// Fire the timer. The loop checks the weather again, emails and waits on
+	// the delay again rather than running to maxExecutionSteps.
+	later := w.ResumeAt.Add(time.Second)
+	workflow.SetClock(svc, func() time.Time { return later })
+	if n := svc.ResumeDueRuns(context.Background()); n != 1 {
+		t.Fatalf("expected one run to resume, got %d", n)
+	}
+	var record workflow.RunRecord
+	doRequest(t, router, http.MethodGet, base+"/runs/"+executed.RunID.String(), "", &record)
+	if record.Status != "waiting" || record.Result.WaitingFor == nil || record.Result.WaitingFor.NodeID != "pause" {
+		t.Fatalf("expected the run to wait on the delay again, got %+v", record.Result)
+	}
+	if got := stepPath(record.Result.Steps); got != "start,form,weather-api,condition,email,pause,weather-api,condition,email,pause" {
+		t.Errorf("unexpected path %s", got)
+	}
+	if record.Result.Steps[5].Status != "completed" {
+		t.Errorf("expected the first delay step to be completed, got %+v", record.Result.Steps[5])
+	}
+	if sent.sent.Load() != 2 {
+		t.Errorf("expected a second email after the delay, got %d", sent.sent.Load())
+	}
+}
+
+func TestTimers_DryRunDoesNotWait(t *testing.T) {
+	t.Parallel()
+	sent := &countingEmail{}
+	_, router, base := newPacedLoopService(t, sent)
+
+	var executed workflow.ExecutionResponse
+	if rec := doRequest(t, router, http.MethodPost, base+"/execute?mode=dry-run", `{"formData": `+weatherInputsJSON+`}`, &executed); rec.Code != http.StatusOK {
+		t.Fatalf("execute: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	// The delay fires immediately, so the loop runs until the step limit.
+	if executed.Status != "failed" || executed.WaitingFor != nil {
+		t.Errorf("expected the dry run to hit the step limit without waiting, got %s: %s", executed.Status, executed.Error)
+	}
+	if sent.sent.Load() != 0 {
+		t.Errorf("expected no email in a dry run, got %d", sent.sent.Load())
+	}
+}
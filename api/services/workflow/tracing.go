@@ -0,0 +1,44 @@
+package workflow
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"workflow-code-test/api/services/storage"
+)
+
+// tracer records a span per executed node. It uses the global tracer
+// provider, which is a no-op unless tracing is configured.
+var tracer = otel.Tracer("workflow-code-test/api/services/workflow")
+
+// startNodeSpan starts the span of one node execution as a child of the
+// span in ctx. Client calls and queries made by the node become its
+// children.
+func startNodeSpan(ctx context.Context, workflowID uuid.UUID, info storage.Node) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("workflow.node.id", info.ID),
+		attribute.String("workflow.node.type", info.Type),
+	}
+	if workflowID != uuid.Nil {
+		attrs = append(attrs, attribute.String("workflow.id", workflowID.String()))
+	}
+	return tracer.Start(ctx, "node "+info.Type, trace.WithAttributes(attrs...))
+}
+
+// endNodeSpan records how the node finished and ends its span.
+func endNodeSpan(span trace.Span, status, branch string, err error) {
+	span.SetAttributes(attribute.String("workflow.node.status", status))
+	if branch != "" {
+		span.SetAttributes(attribute.String("workflow.node.branch", branch))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,98 @@
+package workflow_test
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"workflow-code-test/api/pkg/clients/weather"
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/storage"
+	"workflow-code-test/api/services/workflow"
+)
+
+func TestExecute_NodeSpans(t *testing.T) {
+	t.Parallel()
+	// The engine traces with the global provider. Spans of other tests land
+	// in the recorder too, so only this test's trace is inspected.
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	otel.SetTracerProvider(tp)
+
+	store := newMemoryStore(t, storage.SeedFixtures())
+	wf, err := store.GetWorkflow(context.Background(), storage.SeedWeatherWorkflowID)
+	if err != nil {
+		t.Fatalf("GetWorkflow: %v", err)
+	}
+	deps := nodes.Deps{Weather: weather.NewStubClient(31), Email: &countingEmail{}}
+
+	tests := []struct {
+		name      string
+		city      string
+		wantSpans []string
+		wantError string // node type whose span failed
+	}{
+		{
+			name:      "completed run",
+			city:      "Sydney",
+			wantSpans: []string{"node start", "node form", "node integration", "node condition", "node email", "node end"},
+		},
+		{
+			name:      "failed node",
+			city:      "Darwin",
+			wantSpans: []string{"node start", "node form", "node integration"},
+			wantError: "integration",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, root := tp.Tracer("test").Start(context.Background(), tt.name)
+			inputs := map[string]any{"name": "Alice", "email": "alice@example.com", "city": tt.city, "operator": "greater_than", "threshold": 25}
+			if _, err := workflow.Execute(ctx, wf, inputs, deps, workflow.ExecuteOptions{}); err != nil {
+				t.Fatalf("Execute: %v", err)
+			}
+			root.End()
+
+			var names []string
+			for _, span := range rec.Ended() {
+				if span.SpanContext().TraceID() != root.SpanContext().TraceID() || span.Name() == tt.name {
+					continue
+				}
+				names = append(names, span.Name())
+				if span.Parent().SpanID() != root.SpanContext().SpanID() {
+					t.Errorf("expected %s to be a child of the request span", span.Name())
+				}
+				attrs := attribute.NewSet(span.Attributes()...)
+				status, _ := attrs.Value("workflow.node.status")
+				switch nodeType, _ := attrs.Value("workflow.node.type"); {
+				case nodeType.AsString() == tt.wantError:
+					if span.Status().Code != codes.Error || status.AsString() != "error" {
+						t.Errorf("expected %s to record the error, got %v %q", span.Name(), span.Status(), status.AsString())
+					}
+				case nodeType.AsString() == "condition":
+					if branch, _ := attrs.Value("workflow.node.branch"); branch.AsString() != "true" {
+						t.Errorf("expected the condition span to record branch true, got %q", branch.AsString())
+					}
+				default:
+					if id, _ := attrs.Value("workflow.id"); id.AsString() != storage.SeedWeatherWorkflowID.String() || status.AsString() != "completed" {
+						t.Errorf("expected %s to carry the workflow ID and status, got %v", span.Name(), span.Attributes())
+					}
+				}
+			}
+			if len(names) != len(tt.wantSpans) {
+				t.Fatalf("expected spans %v, got %v", tt.wantSpans, names)
+			}
+			for i := range names {
+				if names[i] != tt.wantSpans[i] {
+					t.Errorf("expected spans %v, got %v", tt.wantSpans, names)
+					break
+				}
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package workflow
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -97,6 +98,7 @@ func (s *Service) HandlePublishWorkflow(w http.ResponseWriter, r *http.Request)
 		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
 		return
 	}
+	slog.Info("published workflow", "id", wfUUID, "version", snap.VersionNumber, "principal", principal(r), "requestId", rid)
 
 	payload, err := json.Marshal(map[string]any{
 		"snapshotId":    snap.ID,
@@ -122,10 +124,19 @@ func (s *Service) HandlePublishWorkflow(w http.ResponseWriter, r *http.Request)
 // Execution failures (node errors, cycles) are returned as 200 with
 // status "failed" and partial results — they are business-level outcomes,
 // not server errors.
+//
+// With ?mode=dry-run, email and SMS nodes render their payloads into the
+// step output without sending, and the body may carry "mocks" (keyed by
+// node ID) to answer read-only integrations from recorded responses.
+//
+// Inputs are checked against the workflow's input schema first; invalid
+// fields are returned as 400 INVALID_INPUT without running the workflow.
+// A valid request then counts against the execution limits, unless its
+// Idempotency-Key replays a stored response.
 func (s *Service) HandleExecuteWorkflow(w http.ResponseWriter, r *http.Request) {
 	rid := reqID(r)
 	id := mux.Vars(r)["id"]
-	slog.Debug("handling workflow execution", "id", id, "requestId", rid)
+	slog.Debug("handling workflow execution", "id", id, "principal", principal(r), "requestId", rid)
 
 	wfUUID, err := uuid.Parse(id)
 	if err != nil {
@@ -134,6 +145,23 @@ func (s *Service) HandleExecuteWorkflow(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	var opts ExecuteOptions
+	switch mode := r.URL.Query().Get("mode"); mode {
+	case "", "live":
+	case ModeDryRun:
+		opts.DryRun = true
+	default:
+		slog.Warn("invalid execution mode", "id", wfUUID, "mode", mode, "requestId", rid)
+		writeErrorJSON(w, "INVALID_MODE", "mode must be live or dry-run", http.StatusBadRequest)
+		return
+	}
+
+	idemKey := r.Header.Get(idempotencyHeader)
+	if len(idemKey) > maxIdempotencyKeyLength || (idemKey == "" && r.Header.Values(idempotencyHeader) != nil) {
+		writeErrorJSON(w, "INVALID_IDEMPOTENCY_KEY", fmt.Sprintf("%s must be 1 to %d characters", idempotencyHeader, maxIdempotencyKeyLength), http.StatusBadRequest)
+		return
+	}
+
 	// Limit request body size to prevent abuse.
 	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
 
@@ -141,14 +169,22 @@ func (s *Service) HandleExecuteWorkflow(w http.ResponseWriter, r *http.Request)
 	//   { "formData": { "name": ..., "city": ... }, "condition": { "operator": ..., "threshold": ... } }
 	// We flatten both into a single variables map for the engine.
 	var body struct {
-		FormData  map[string]any `json:"formData"`
-		Condition map[string]any `json:"condition"`
+		FormData  map[string]any          `json:"formData"`
+		Condition map[string]any          `json:"condition"`
+		Mocks     map[string]MockResponse `json:"mocks"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		slog.Warn("failed to decode request body", "id", wfUUID, "requestId", rid, "error", err)
 		writeErrorJSON(w, "INVALID_BODY", "invalid request body", http.StatusBadRequest)
 		return
 	}
+	if len(body.Mocks) > 0 && !opts.DryRun {
+		writeErrorJSON(w, "INVALID_BODY", "mocks are only allowed with mode=dry-run", http.StatusBadRequest)
+		return
+	}
+	opts.Mocks = body.Mocks
+	opts.Workflows = s.loadWorkflow
+	opts.Secrets = s.lookupSecret
 
 	inputs := make(map[string]any)
 	for k, v := range body.FormData {
@@ -160,47 +196,94 @@ func (s *Service) HandleExecuteWorkflow(w http.ResponseWriter, r *http.Request)
 
 	ctx := r.Context()
 
-	// Prefer executing from a published snapshot if one exists.
-	// This decouples execution from live node_library mutations.
-	var wf *storage.Workflow
-	snapshot, err := s.storage.GetActiveSnapshot(ctx, wfUUID)
-	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-		slog.Error("failed to get active snapshot", "id", wfUUID, "requestId", rid, "error", err)
+	wf, version, err := s.loadExecutable(ctx, wfUUID, rid)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			slog.Warn("workflow not found", "id", wfUUID, "requestId", rid)
+			writeErrorJSON(w, "NOT_FOUND", "workflow not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to load workflow for execution", "id", wfUUID, "requestId", rid, "error", err)
 		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	if snapshot != nil {
-		slog.Debug("executing from snapshot", "id", wfUUID, "version", snapshot.VersionNumber, "requestId", rid)
-		wf = &storage.Workflow{
-			ID:    wfUUID,
-			Nodes: snapshot.DagData.Nodes,
-			Edges: snapshot.DagData.Edges,
-		}
-	} else {
-		// No snapshot — fall back to live tables (backward compat for drafts)
-		wf, err = s.storage.GetWorkflow(ctx, wfUUID)
+	if err := ValidateMocks(wf, opts.Mocks); err != nil {
+		writeErrorJSON(w, "INVALID_BODY", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check the inputs against the form fields before running any node, so
+	// a bad value is reported per field instead of failing deep in a node.
+	fields, err := inputSchema(wf)
+	if err != nil {
+		slog.Error("failed to build input schema", "id", wfUUID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if errs := applySchema(fields, inputs); len(errs) > 0 {
+		slog.Warn("invalid workflow inputs", "id", wfUUID, "requestId", rid, "fields", len(errs))
+		writeInputErrors(w, errs)
+		return
+	}
+
+	// Claim the idempotency key as late as possible, so requests rejected
+	// above can be fixed and retried with the same key. Until the response
+	// is stored, a failure releases the key for the retry.
+	var claim *storage.IdempotencyKey
+	if idemKey != "" {
+		hash, err := requestHash(r.URL.Query().Get("mode"), body)
 		if err != nil {
-			if errors.Is(err, pgx.ErrNoRows) {
-				slog.Warn("workflow not found", "id", wfUUID, "requestId", rid)
-				writeErrorJSON(w, "NOT_FOUND", "workflow not found", http.StatusNotFound)
-				return
-			}
-			slog.Error("failed to get workflow", "id", wfUUID, "requestId", rid, "error", err)
+			slog.Error("failed to hash request", "id", wfUUID, "requestId", rid, "error", err)
 			writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
 			return
 		}
+		if claim = s.claimIdempotencyKey(ctx, w, wfUUID, idemKey, hash, rid); claim == nil {
+			return
+		}
+		defer func() {
+			if claim.Status != storage.IdempotencyCompleted {
+				s.releaseIdempotencyKey(ctx, claim, rid)
+			}
+		}()
+	}
+
+	// Admitted and started after the idempotency key is claimed, so a
+	// repeated request is answered from the stored response even when the
+	// limits or the workspace's quota are reached, and takes no token. A
+	// refused request releases the key for its retry.
+	release, ok := s.admitExecution(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	run := s.startRun(w, r, wf, version, opts, inputs, rid)
+	if run == nil {
+		return
 	}
 
-	executedAt := time.Now().Format(time.RFC3339)
-	result, err := executeWorkflow(ctx, wf, inputs, s.deps)
+	start := time.Now()
+	result, err := Execute(ctx, wf, inputs, s.deps, opts)
+	if errors.Is(err, ErrSecretNotSet) {
+		slog.Warn("workflow refers to a missing secret", "id", wfUUID, "requestId", rid, "error", err)
+		s.abortRun(ctx, run, err.Error(), rid)
+		writeErrorJSON(w, "SECRET_NOT_SET", err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
 	if err != nil {
 		// Hard errors (e.g. invalid node metadata) are server-level failures
 		slog.Error("workflow execution failed", "id", wfUUID, "requestId", rid, "error", err)
+		s.abortRun(ctx, run, "internal server error", rid)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+	s.observeRun(wfUUID, result, 0, time.Since(start))
+
+	if err := s.recordRun(ctx, run, inputs, result, rid); err != nil && result.suspended != nil {
+		// A waiting run that was not stored can never be resumed.
 		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
 		return
 	}
-	result.ExecutedAt = executedAt
 
 	if result.Status == "failed" {
 		slog.Warn("workflow completed with failure",
@@ -218,12 +301,53 @@ func (s *Service) HandleExecuteWorkflow(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if claim != nil {
+		s.completeIdempotencyKey(ctx, claim, http.StatusOK, payload, rid)
+	}
+
 	w.WriteHeader(http.StatusOK)
 	if _, err := w.Write(payload); err != nil {
 		slog.Error("failed to write response", "id", wfUUID, "requestId", rid, "error", err)
 	}
 }
 
+// loadExecutable returns the graph an execution runs and its snapshot
+// version: the active published snapshot when one exists, which decouples
+// execution from live node_library mutations, otherwise the live tables
+// (backward compat for drafts) with version 0. A missing workflow is
+// reported as pgx.ErrNoRows.
+func (s *Service) loadExecutable(ctx context.Context, wfUUID uuid.UUID, rid string) (*storage.Workflow, int, error) {
+	snapshot, err := s.storage.GetActiveSnapshot(ctx, wfUUID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, 0, fmt.Errorf("get active snapshot: %w", err)
+	}
+	if snapshot != nil {
+		slog.Debug("executing from snapshot", "id", wfUUID, "version", snapshot.VersionNumber, "requestId", rid)
+		return &storage.Workflow{
+			ID:       wfUUID,
+			Nodes:    snapshot.DagData.Nodes,
+			Edges:    snapshot.DagData.Edges,
+			Settings: snapshot.DagData.Settings,
+		}, snapshot.VersionNumber, nil
+	}
+	wf, err := s.storage.GetWorkflow(ctx, wfUUID)
+	return wf, 0, err
+}
+
+// loadWorkflow is the WorkflowLoader for subworkflow nodes: a pinned
+// version loads that snapshot, version 0 whatever loadExecutable picks.
+func (s *Service) loadWorkflow(ctx context.Context, id uuid.UUID, version int) (*storage.Workflow, error) {
+	if version == 0 {
+		wf, _, err := s.loadExecutable(ctx, id, "")
+		return wf, err
+	}
+	snap, err := s.storage.GetSnapshot(ctx, id, version)
+	if err != nil {
+		return nil, err
+	}
+	return &storage.Workflow{ID: id, Nodes: snap.DagData.Nodes, Edges: snap.DagData.Edges, Settings: snap.DagData.Settings}, nil
+}
+
 // buildNodeJSONs constructs typed nodes from storage data and calls
 // each node's ToJSON() to produce the frontend representation.
 func buildNodeJSONs(storageNodes []storage.Node, deps nodes.Deps) ([]nodes.NodeJSON, error) {
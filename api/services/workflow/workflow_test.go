@@ -7,12 +7,18 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/jackc/pgx/v5"
 
+	"workflow-code-test/api/pkg/clients/email"
+	"workflow-code-test/api/pkg/clients/flood"
+	"workflow-code-test/api/pkg/clients/sms"
+	"workflow-code-test/api/pkg/clients/weather"
+	"workflow-code-test/api/pkg/metrics"
 	"workflow-code-test/api/services/nodes"
 	"workflow-code-test/api/services/storage"
 	"workflow-code-test/api/services/storage/storagemock"
@@ -435,3 +441,134 @@ func TestHandlePublishWorkflow(t *testing.T) {
 		})
 	}
 }
+
+// countingEmail counts delivery attempts so tests can assert none were made.
+type countingEmail struct{ sent atomic.Int32 }
+
+func (c *countingEmail) Send(context.Context, email.Message) (*email.Result, error) {
+	c.sent.Add(1)
+	return &email.Result{DeliveryStatus: "sent", Sent: true}, nil
+}
+
+func TestHandleExecuteWorkflow_DryRun(t *testing.T) {
+	t.Parallel()
+
+	mailer := &countingEmail{}
+	svc, err := workflow.NewService(newMemoryStore(t, storage.SeedFixtures()), nodes.Deps{
+		Weather: weather.NewStubClient(12), // live reading: too cool to alert
+		Email:   mailer,
+		SMS:     sms.NewStubClient(),
+		Flood:   flood.NewStubClient(50),
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	router := newTestRouter(svc)
+	url := "/api/v1/workflows/" + storage.SeedWeatherWorkflowID.String() + "/execute"
+	inputs := `"formData":` + weatherInputsJSON
+
+	tests := []struct {
+		name       string
+		query      string
+		body       string
+		wantStatus int
+		wantCode   string
+		wantSteps  []string
+	}{
+		{
+			name:       "live reading is used without mocks",
+			query:      "?mode=dry-run",
+			body:       `{` + inputs + `}`,
+			wantStatus: http.StatusOK,
+			wantSteps:  []string{"start", "form", "weather-api", "condition", "end"},
+		},
+		{
+			name:       "recorded response reaches the email node without sending",
+			query:      "?mode=dry-run",
+			body:       `{` + inputs + `,"mocks":{"weather-api":{"temperature":31.5}}}`,
+			wantStatus: http.StatusOK,
+			wantSteps:  []string{"start", "form", "weather-api", "condition", "email", "end"},
+		},
+		{name: "unknown mode", query: "?mode=preview", body: `{}`, wantStatus: http.StatusBadRequest, wantCode: "INVALID_MODE"},
+		{name: "mocks need dry-run", query: "", body: `{` + inputs + `,"mocks":{"weather-api":{"temperature":31.5}}}`, wantStatus: http.StatusBadRequest, wantCode: "INVALID_BODY"},
+		{name: "mock for unknown node", query: "?mode=dry-run", body: `{` + inputs + `,"mocks":{"nope":{"temperature":1}}}`, wantStatus: http.StatusBadRequest, wantCode: "INVALID_BODY"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, url+tt.query, strings.NewReader(tt.body)))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantCode != "" {
+				var body map[string]any
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["code"] != tt.wantCode {
+					t.Errorf("expected code %s, got %s", tt.wantCode, rec.Body.String())
+				}
+				return
+			}
+
+			var result workflow.ExecutionResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if result.Status != "completed" || result.Mode != workflow.ModeDryRun {
+				t.Fatalf("expected completed dry run, got %+v", result)
+			}
+			var path []string
+			for _, step := range result.Steps {
+				path = append(path, step.NodeID)
+				if step.NodeID != "email" {
+					continue
+				}
+				draft, _ := step.Output["emailDraft"].(map[string]any)
+				if step.Status != "skipped" || draft["to"] != "a***@example.com" || !strings.Contains(draft["body"].(string), "31.5") {
+					t.Errorf("expected a skipped email step with the rendered draft, got %+v", step)
+				}
+			}
+			if strings.Join(path, ",") != strings.Join(tt.wantSteps, ",") {
+				t.Errorf("expected path %v, got %v", tt.wantSteps, path)
+			}
+		})
+	}
+
+	if n := mailer.sent.Load(); n != 0 {
+		t.Errorf("expected no emails to be sent, got %d", n)
+	}
+}
+
+func TestHandleExecuteWorkflow_Metrics(t *testing.T) {
+	t.Parallel()
+	m := metrics.New()
+	svc, err := workflow.NewService(newMemoryStore(t, storage.SeedFixtures()), nodes.Deps{
+		Weather: m.Weather(weather.NewStubClient(31)),
+		Email:   m.Email(&countingEmail{}),
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	svc.SetMetrics(m)
+	router := newTestRouter(svc)
+	router.Use(m.Middleware)
+	wfID := storage.SeedWeatherWorkflowID.String()
+
+	doRequest(t, router, http.MethodPost, "/api/v1/workflows/"+wfID+"/execute", `{"formData":`+weatherInputsJSON+`}`, nil)
+	doRequest(t, router, http.MethodPost, "/api/v1/workflows/"+wfID+"/execute?mode=dry-run", `{"formData":`+weatherInputsJSON+`}`, nil)
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		`workflow_runs_total{mode="live",status="completed",workflow_id="` + wfID + `"} 1`,
+		`workflow_runs_total{mode="dry-run",status="completed",workflow_id="` + wfID + `"} 1`,
+		`workflow_node_duration_seconds_count{node_type="email",status="completed"} 1`,
+		`workflow_node_duration_seconds_count{node_type="email",status="skipped"} 1`,
+		`workflow_client_request_duration_seconds_count{client="weather",status="ok"} 2`,
+		`workflow_client_request_duration_seconds_count{client="email",status="ok"} 1`,
+		`workflow_http_request_duration_seconds_count{code="200",method="POST",route="/api/v1/workflows/{id}/execute"} 2`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("expected %s in:\n%s", want, rec.Body.String())
+		}
+	}
+}
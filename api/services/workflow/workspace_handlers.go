@@ -0,0 +1,186 @@
+package workflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"workflow-code-test/api/services/auth"
+	"workflow-code-test/api/services/storage"
+)
+
+// maxWorkspaceName is the length of workspaces.name.
+const maxWorkspaceName = 255
+
+const workspaceKey contextKey = "workspace"
+
+type workspacesBody struct {
+	Workspaces []storage.Workspace `json:"workspaces"`
+}
+
+// workspaceBody is the body of a create or update workspace request. ID is
+// only read on create; a nil quota is unlimited.
+type workspaceBody struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"`
+	MaxWorkflows   *int   `json:"maxWorkflows"`
+	MaxRunsPerHour *int   `json:"maxRunsPerHour"`
+}
+
+// inWorkspace scopes the request to the workspace in its {workspace} path
+// variable, or to the default workspace on the unprefixed routes. It
+// rejects principals bound to another workspace and unknown workspaces,
+// and runs after s.authenticate.
+func (s *Service) inWorkspace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rid := reqID(r)
+		id := mux.Vars(r)["workspace"]
+		if id == "" {
+			id = storage.DefaultWorkspaceID
+		}
+		if p := auth.PrincipalFrom(r.Context()); p != nil && !p.CanAccess(id) {
+			slog.Warn("forbidden workspace", "principal", p.Subject, "workspace", id, "bound", p.Workspace, "requestId", rid)
+			writeErrorJSON(w, "FORBIDDEN", "these credentials are for another workspace", http.StatusForbidden)
+			return
+		}
+		ws, err := s.storage.GetWorkspace(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				writeErrorJSON(w, "WORKSPACE_NOT_FOUND", "workspace not found", http.StatusNotFound)
+				return
+			}
+			slog.Error("failed to get workspace", "workspace", id, "requestId", rid, "error", err)
+			writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+			return
+		}
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("workspace.id", ws.ID))
+		ctx := context.WithValue(storage.WithWorkspace(r.Context(), ws.ID), workspaceKey, ws)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestWorkspace returns the workspace inWorkspace loaded, or nil when the
+// handler is called without it.
+func requestWorkspace(r *http.Request) *storage.Workspace {
+	ws, _ := r.Context().Value(workspaceKey).(*storage.Workspace)
+	return ws
+}
+
+// requireUnbound wraps h so only principals whose role allows role and
+// whose credentials are not bound to a workspace may call it. It guards
+// the routes that manage the whole deployment.
+func (s *Service) requireUnbound(role auth.Role, h http.HandlerFunc) http.HandlerFunc {
+	return s.require(role, func(w http.ResponseWriter, r *http.Request) {
+		if p := auth.PrincipalFrom(r.Context()); p != nil && p.Workspace != "" {
+			slog.Warn("forbidden", "principal", p.Subject, "bound", p.Workspace, "path", r.URL.Path, "requestId", reqID(r))
+			writeErrorJSON(w, "FORBIDDEN", "this requires credentials not bound to a workspace", http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	})
+}
+
+// HandleListWorkspaces lists every workspace with its quotas.
+func (s *Service) HandleListWorkspaces(w http.ResponseWriter, r *http.Request) {
+	rid := reqID(r)
+	workspaces, err := s.storage.ListWorkspaces(r.Context())
+	if err != nil {
+		slog.Error("failed to list workspaces", "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, workspacesBody{Workspaces: workspaces}, uuid.Nil, rid)
+}
+
+// HandleCreateWorkspace creates a workspace. Its workflows are served under
+// /workspaces/{id}.
+func (s *Service) HandleCreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	rid := reqID(r)
+	body, ok := decodeWorkspaceBody(w, r, rid)
+	if !ok {
+		return
+	}
+	if !storage.ValidWorkspaceID(body.ID) {
+		writeErrorJSON(w, "INVALID_ID", "id must be 1 to 63 lowercase letters, digits or dashes, starting with a letter or digit", http.StatusBadRequest)
+		return
+	}
+
+	ws := &storage.Workspace{ID: body.ID, Name: body.Name, MaxWorkflows: body.MaxWorkflows, MaxRunsPerHour: body.MaxRunsPerHour}
+	if err := s.storage.CreateWorkspace(r.Context(), ws); err != nil {
+		if errors.Is(err, storage.ErrWorkspaceExists) {
+			writeErrorJSON(w, "WORKSPACE_EXISTS", fmt.Sprintf("workspace %s already exists", ws.ID), http.StatusConflict)
+			return
+		}
+		slog.Error("failed to create workspace", "workspace", ws.ID, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("created workspace", "workspace", ws.ID, "principal", principal(r), "requestId", rid)
+	writeJSON(w, http.StatusCreated, ws, uuid.Nil, rid)
+}
+
+// HandleUpdateWorkspace replaces the name and quotas of a workspace.
+// Lowering a quota keeps what is already over it.
+func (s *Service) HandleUpdateWorkspace(w http.ResponseWriter, r *http.Request) {
+	rid := reqID(r)
+	id := mux.Vars(r)["workspace"]
+	body, ok := decodeWorkspaceBody(w, r, rid)
+	if !ok {
+		return
+	}
+
+	ws := &storage.Workspace{ID: id, Name: body.Name, MaxWorkflows: body.MaxWorkflows, MaxRunsPerHour: body.MaxRunsPerHour}
+	if err := s.storage.UpdateWorkspace(r.Context(), ws); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			writeErrorJSON(w, "WORKSPACE_NOT_FOUND", "workspace not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to update workspace", "workspace", id, "requestId", rid, "error", err)
+		writeErrorJSON(w, "INTERNAL_ERROR", "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("updated workspace", "workspace", ws.ID, "principal", principal(r), "requestId", rid)
+	writeJSON(w, http.StatusOK, ws, uuid.Nil, rid)
+}
+
+// decodeWorkspaceBody reads and checks the name and quotas of a workspace
+// request, writing the error response when they are invalid.
+func decodeWorkspaceBody(w http.ResponseWriter, r *http.Request, rid string) (workspaceBody, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+	var body workspaceBody
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil {
+		slog.Warn("failed to decode workspace", "requestId", rid, "error", err)
+		writeErrorJSON(w, "INVALID_BODY", "invalid request body", http.StatusBadRequest)
+		return body, false
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" || len(body.Name) > maxWorkspaceName {
+		writeErrorJSON(w, "INVALID_NAME", fmt.Sprintf("name must be 1 to %d characters", maxWorkspaceName), http.StatusBadRequest)
+		return body, false
+	}
+	for _, q := range []*int{body.MaxWorkflows, body.MaxRunsPerHour} {
+		if q != nil && *q < 0 {
+			writeErrorJSON(w, "INVALID_QUOTA", "quotas must not be negative", http.StatusBadRequest)
+			return body, false
+		}
+	}
+	return body, true
+}
@@ -0,0 +1,278 @@
+package workflow_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"workflow-code-test/api/pkg/clients/weather"
+	"workflow-code-test/api/services/auth"
+	"workflow-code-test/api/services/bundle"
+	"workflow-code-test/api/services/nodes"
+	"workflow-code-test/api/services/storage"
+	"workflow-code-test/api/services/workflow"
+)
+
+func TestWorkspaces_ScopeWorkflowsAndQuotas(t *testing.T) {
+	t.Parallel()
+	svc, err := workflow.NewService(newMemoryStore(t, storage.SeedFixtures()), nodes.Deps{Weather: weather.NewStubClient(31), Email: &countingEmail{}})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	router := newTestRouter(svc)
+	seed := storage.SeedWeatherWorkflowID.String()
+
+	if rec := doRequest(t, router, http.MethodPost, "/api/v1/workspaces", `{"id":"team-a","name":"Team A"}`, nil); rec.Code != http.StatusCreated {
+		t.Fatalf("create workspace: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	for _, tc := range []struct {
+		name, method, url, body string
+		wantStatus              int
+		wantCode                string
+	}{
+		{"duplicate workspace", http.MethodPost, "/api/v1/workspaces", `{"id":"team-a","name":"Again"}`, http.StatusConflict, "WORKSPACE_EXISTS"},
+		{"invalid id", http.MethodPost, "/api/v1/workspaces", `{"id":"Team A","name":"Team A"}`, http.StatusBadRequest, "INVALID_ID"},
+		{"negative quota", http.MethodPut, "/api/v1/workspaces/team-a", `{"name":"Team A","maxWorkflows":-1}`, http.StatusBadRequest, "INVALID_QUOTA"},
+		{"update unknown workspace", http.MethodPut, "/api/v1/workspaces/team-b", `{"name":"Team B"}`, http.StatusNotFound, "WORKSPACE_NOT_FOUND"},
+		{"unknown workspace route", http.MethodGet, "/api/v1/workspaces/team-b/workflows/" + seed, "", http.StatusNotFound, "WORKSPACE_NOT_FOUND"},
+		{"other workspace's workflow", http.MethodGet, "/api/v1/workspaces/team-a/workflows/" + seed, "", http.StatusNotFound, "NOT_FOUND"},
+		{"default workspace prefix", http.MethodGet, "/api/v1/workspaces/default/workflows/" + seed, "", http.StatusOK, ""},
+	} {
+		rec := doRequest(t, router, tc.method, tc.url, tc.body, nil)
+		if rec.Code != tc.wantStatus || (tc.wantCode != "" && !strings.Contains(rec.Body.String(), `"code":"`+tc.wantCode+`"`)) {
+			t.Errorf("%s: expected %d %s, got %d: %s", tc.name, tc.wantStatus, tc.wantCode, rec.Code, rec.Body.String())
+		}
+	}
+
+	exported := string(exportBundle(t, router, "/api/v1/workflows/"+seed+"/export"))
+	if rec := doRequest(t, router, http.MethodPost, "/api/v1/workspaces/team-a/workflows/import", exported, nil); rec.Code != http.StatusConflict {
+		t.Errorf("import over another workspace's workflow: expected 409, got %d: %s", rec.Code, rec.Body.String())
+	}
+	copyID := uuid.NewString()
+	if rec := doRequest(t, router, http.MethodPost, "/api/v1/workspaces/team-a/workflows/import", strings.ReplaceAll(exported, seed, copyID), nil); rec.Code != http.StatusCreated {
+		t.Fatalf("import into team-a: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := doRequest(t, router, http.MethodGet, "/api/v1/workspaces/team-a/workflows/"+copyID, "", nil); rec.Code != http.StatusOK {
+		t.Errorf("expected the imported workflow in team-a, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := doRequest(t, router, http.MethodGet, "/api/v1/workflows/"+copyID, "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("expected the imported workflow to be hidden from the default workspace, got %d", rec.Code)
+	}
+
+	if rec := doRequest(t, router, http.MethodPut, "/api/v1/workspaces/team-a", `{"name":"Team A","maxWorkflows":1,"maxRunsPerHour":1}`, nil); rec.Code != http.StatusOK {
+		t.Fatalf("update workspace: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec := doRequest(t, router, http.MethodPost, "/api/v1/workspaces/team-a/workflows/import", strings.ReplaceAll(exported, seed, uuid.NewString()), nil)
+	if rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Body.String(), "QUOTA_EXCEEDED") {
+		t.Errorf("expected a second workflow to exceed the quota, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	execute := `{"formData":` + weatherInputsJSON + `}`
+	if rec := doRequest(t, router, http.MethodPost, "/api/v1/workspaces/team-a/workflows/"+copyID+"/execute", execute, nil); rec.Code != http.StatusOK {
+		t.Fatalf("execute: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = doRequest(t, router, http.MethodPost, "/api/v1/workspaces/team-a/workflows/"+copyID+"/execute", execute, nil)
+	if rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Body.String(), "QUOTA_EXCEEDED") {
+		t.Errorf("expected a second run to exceed the hourly quota, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := doRequest(t, router, http.MethodPost, "/api/v1/workflows/"+seed+"/execute", execute, nil); rec.Code != http.StatusOK {
+		t.Errorf("expected the default workspace to be unaffected by team-a's quota, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+// startBlueprintBundle returns the exported bundle as workflow wfID, with
+// its start blueprint edited and moved to libraryID so importing it creates
+// a library entry.
+func startBlueprintBundle(t *testing.T, exported []byte, wfID uuid.UUID, libraryID string) string {
+	t.Helper()
+	b, err := bundle.Decode(bytes.NewReader(exported), bundle.FormatJSON)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	b.Workflow.ID = wfID
+	for i := range b.Blueprints {
+		bp := &b.Blueprints[i]
+		if bp.NodeType != "start" {
+			continue
+		}
+		for j := range b.Workflow.Nodes {
+			if b.Workflow.Nodes[j].Blueprint == bp.Key() {
+				b.Workflow.Nodes[j].Blueprint = libraryID
+			}
+		}
+		bp.ID, bp.Label, bp.Hash = libraryID, "Team start", ""
+	}
+	var buf bytes.Buffer
+	if err := bundle.Encode(&buf, b, bundle.FormatJSON); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	return buf.String()
+}
+
+func TestWorkspaces_ImportBlueprints(t *testing.T) {
+	t.Parallel()
+	store := newMemoryStore(t, storage.SeedFixtures())
+	svc, err := workflow.NewService(store, nodes.Deps{Weather: weather.NewStubClient(31), Email: &countingEmail{}})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	router := newTestRouter(svc)
+	exported := exportBundle(t, router, "/api/v1/workflows/"+storage.SeedWeatherWorkflowID.String()+"/export")
+	for _, body := range []string{`{"id":"team-a","name":"Team A"}`, `{"id":"team-b","name":"Team B","maxWorkflows":1}`} {
+		if rec := doRequest(t, router, http.MethodPost, "/api/v1/workspaces", body, nil); rec.Code != http.StatusCreated {
+			t.Fatalf("create workspace: expected 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+	startOf := func(resp map[string]any) map[string]any {
+		for _, bp := range resp["blueprints"].([]any) {
+			if bp := bp.(map[string]any); bp["action"] != string(bundle.BlueprintReused) {
+				return bp
+			}
+		}
+		return nil
+	}
+
+	libraryID := uuid.NewString()
+	var resp map[string]any
+	rec := doRequest(t, router, http.MethodPost, "/api/v1/workspaces/team-a/workflows/import", startBlueprintBundle(t, exported, uuid.New(), libraryID), nil)
+	if rec.Code != http.StatusCreated || json.Unmarshal(rec.Body.Bytes(), &resp) != nil {
+		t.Fatalf("import into team-a: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if bp := startOf(resp); bp == nil || bp["libraryId"] != libraryID || bp["action"] != string(bundle.BlueprintCreated) {
+		t.Errorf("expected the start blueprint created as %s, got %v", libraryID, resp["blueprints"])
+	}
+
+	// team-b cannot see team-a's entry, so the plan creates it under the
+	// same ID, which is then moved to a new one.
+	rec = doRequest(t, router, http.MethodPost, "/api/v1/workspaces/team-b/workflows/import", startBlueprintBundle(t, exported, uuid.New(), libraryID), nil)
+	if rec.Code != http.StatusCreated || json.Unmarshal(rec.Body.Bytes(), &resp) != nil {
+		t.Fatalf("import into team-b: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if bp := startOf(resp); bp == nil || bp["libraryId"] == libraryID || bp["action"] != string(bundle.BlueprintCopied) {
+		t.Errorf("expected the start blueprint copied to a new ID, got %v", resp["blueprints"])
+	}
+
+	// Over the quota, nothing is created.
+	rejectedID := uuid.NewString()
+	rec = doRequest(t, router, http.MethodPost, "/api/v1/workspaces/team-b/workflows/import", startBlueprintBundle(t, exported, uuid.New(), rejectedID), nil)
+	if rec.Code != http.StatusTooManyRequests || !strings.Contains(rec.Body.String(), "QUOTA_EXCEEDED") {
+		t.Fatalf("expected the import to exceed the quota, got %d: %s", rec.Code, rec.Body.String())
+	}
+	library, err := store.ListNodeLibrary(storage.WithWorkspace(context.Background(), "team-b"))
+	if err != nil {
+		t.Fatalf("ListNodeLibrary: %v", err)
+	}
+	for _, e := range library {
+		if e.ID == rejectedID {
+			t.Errorf("expected the rejected import to leave no blueprint, found %+v", e)
+		}
+	}
+}
+
+func TestWorkspaces_RunQuotaCountsRunningExecutions(t *testing.T) {
+	t.Parallel()
+	wx := &blockingWeather{started: make(chan struct{}, 1), release: make(chan struct{})}
+	svc, err := workflow.NewService(newMemoryStore(t, storage.SeedFixtures()), nodes.Deps{Weather: wx, Email: &countingEmail{}})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	router := newTestRouter(svc)
+	if rec := doRequest(t, router, http.MethodPut, "/api/v1/workspaces/"+storage.DefaultWorkspaceID, `{"name":"Default","maxRunsPerHour":1}`, nil); rec.Code != http.StatusOK {
+		t.Fatalf("update workspace: expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	execute := "/api/v1/workflows/" + storage.SeedWeatherWorkflowID.String() + "/execute"
+	body := `{"formData":` + weatherInputsJSON + `}`
+
+	done := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, execute, strings.NewReader(body)))
+		done <- rec.Code
+	}()
+	<-wx.started
+
+	// The first run is recorded before it executes, so it already uses up
+	// the quota while it waits on the weather lookup.
+	rec := doRequest(t, router, http.MethodPost, execute, body, nil)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected a concurrent run to exceed the quota, got %d: %s", rec.Code, rec.Body.String())
+	}
+	assertErrorCode(t, rec.Body.Bytes(), "QUOTA_EXCEEDED")
+
+	close(wx.release)
+	if code := <-done; code != http.StatusOK {
+		t.Fatalf("first execution: expected 200, got %d", code)
+	}
+	rec = doRequest(t, router, http.MethodGet, "/api/v1/workflows/"+storage.SeedWeatherWorkflowID.String()+"/runs", "", nil)
+	var runs struct{ Runs []workflow.RunSummary }
+	if err := json.Unmarshal(rec.Body.Bytes(), &runs); err != nil || len(runs.Runs) != 1 || runs.Runs[0].Status != "completed" {
+		t.Errorf("expected the one run completed, got %s", rec.Body.String())
+	}
+}
+
+func TestWorkspaces_BoundCredentials(t *testing.T) {
+	t.Parallel()
+	router := newAuthTestRouter(t)
+	admin := roleToken(t, auth.RoleAdmin)
+	if rec := authRequest(router, http.MethodPost, "/api/v1/workspaces", admin, `{"id":"team-a","name":"Team A"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("create workspace: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	bound, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "team-admin@example.com", "role": "admin", "workspace": "team-a", "exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString(testJWTSecret)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		token      string
+		body       string
+		wantStatus int
+	}{
+		{"bound token in its workspace", http.MethodGet, "/api/v1/workspaces/team-a/tasks", bound, "", http.StatusOK},
+		{"bound token in its audit log", http.MethodGet, "/api/v1/workspaces/team-a/audit-events", bound, "", http.StatusOK},
+		{"bound token in the default workspace", http.MethodGet, "/api/v1/tasks", bound, "", http.StatusForbidden},
+		{"bound token lists workspaces", http.MethodGet, "/api/v1/workspaces", bound, "", http.StatusForbidden},
+		{"bound token manages api keys", http.MethodGet, "/api/v1/api-keys", bound, "", http.StatusForbidden},
+		{"unbound token in any workspace", http.MethodGet, "/api/v1/workspaces/team-a/tasks", admin, "", http.StatusOK},
+		{"editor cannot manage workspaces", http.MethodPost, "/api/v1/workspaces", roleToken(t, auth.RoleEditor), `{"id":"team-b","name":"Team B"}`, http.StatusForbidden},
+		{"api key for unknown workspace", http.MethodPost, "/api/v1/api-keys", admin, `{"name":"ci","role":"editor","workspace":"team-b"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := authRequest(router, tt.method, tt.url, tt.token, tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	rec := authRequest(router, http.MethodPost, "/api/v1/api-keys", admin, `{"name":"team-ci","role":"viewer","workspace":"team-a"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create api key: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var key workflow.CreateAPIKeyResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &key); err != nil {
+		t.Fatalf("decode key: %v", err)
+	}
+	if key.APIKey.WorkspaceID != "team-a" {
+		t.Errorf("expected the key to be bound to team-a, got %+v", key.APIKey)
+	}
+	if rec := authRequest(router, http.MethodGet, "/api/v1/workspaces/team-a/tasks", key.Key, ""); rec.Code != http.StatusOK {
+		t.Errorf("expected the key to work in team-a, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := authRequest(router, http.MethodGet, "/api/v1/workflows/"+storage.SeedWeatherWorkflowID.String(), key.Key, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("expected the key to be rejected in the default workspace, got %d: %s", rec.Code, rec.Body.String())
+	}
+}